@@ -1,16 +1,24 @@
 package main
 
 import (
+	"cmp"
 	"context"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
 	"path/filepath"
+	"slices"
 	"sync"
 	"time"
 
+	"github.com/notassigned/endershare/internal/api"
 	"github.com/notassigned/endershare/internal/core"
 	"github.com/notassigned/endershare/internal/crypto"
 	"github.com/notassigned/endershare/internal/database"
+	"github.com/notassigned/endershare/internal/i18n"
 	"github.com/notassigned/endershare/internal/p2p"
 	"github.com/notassigned/endershare/internal/storage"
 	"github.com/wailsapp/wails/v2/pkg/runtime"
@@ -18,24 +26,62 @@ import (
 
 // FolderItem represents a file or folder for the frontend
 type FolderItem struct {
-	Type       string `json:"type"` // "file" or "folder"
-	Name       string `json:"name"`
-	FolderID   int    `json:"folderId"`   // For folders only
-	Size       int64  `json:"size"`       // For files only
-	ModifiedAt string `json:"modifiedAt"` // ISO format for files
+	Type         string   `json:"type"` // "file" or "folder"
+	Name         string   `json:"name"`
+	FolderID     string   `json:"folderId"`     // For folders only
+	Size         int64    `json:"size"`         // For files only
+	ModifiedAt   string   `json:"modifiedAt"`   // ISO format for files
+	ModifiedAtMs int64    `json:"modifiedAtMs"` // Unix milliseconds for files
+	DropBox      bool     `json:"dropBox"`      // For folders only
+	Symlink      bool     `json:"symlink"`      // For files only, exported as a link
+	Local        bool     `json:"local"`        // For files only, false for a placeholder fetched on first open
+	Pinned       bool     `json:"pinned"`       // Kept stored on this node
+	PinInherited bool     `json:"pinInherited"` // Pinned through a folder above it
+	Archive      string   `json:"archive"`      // For files only, where an archived file's content lives
+	ArchivedAtMs int64    `json:"archivedAtMs"` // Unix milliseconds, for archived files
+	ParentID     string   `json:"parentId"`     // Folder holding the item
+	Tags         []string `json:"tags"`
+	Note         string   `json:"note"`           // For files only
+	LockedBy     string   `json:"lockedBy"`       // For files only, the device a checked out file is being edited on
+	LockedAtMs   int64    `json:"lockedAtMs"`     // Unix milliseconds, for checked out files
+	LockedHere   bool     `json:"lockedHere"`     // Checked out on this device
+	Path         string   `json:"path,omitempty"` // Path from the root, set by Search only
+}
+
+// TagInfo is a tag in use and the number of items carrying it
+type TagInfo struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
 }
 
 // PathSegment represents a breadcrumb segment
 type PathSegment struct {
 	Name     string `json:"name"`
-	FolderID int    `json:"folderId"`
+	FolderID string `json:"folderId"`
 }
 
+// Peer status values reported in PeerInfo.Status
+const (
+	PeerStatusOnline  = "online"
+	PeerStatusOffline = "offline"
+	PeerStatusUnknown = "unknown" // Never seen since this node started
+)
+
 // PeerInfo represents a peer device for the frontend
 type PeerInfo struct {
-	PeerID   string `json:"peerId"`
-	IsOnline bool   `json:"isOnline"`
-	LastSeen string `json:"lastSeen"`
+	PeerID     string `json:"peerId"` // Shortened for display
+	ID         string `json:"id"`     // Full peer ID, for RemovePeer and BanPeer
+	Label      string `json:"label"`
+	IsOnline   bool   `json:"isOnline"`
+	Status     string `json:"status"`
+	LastSeen   string `json:"lastSeen"`   // Localized relative time
+	LastSeenMs int64  `json:"lastSeenMs"` // Unix milliseconds, 0 if never seen
+	Path       string `json:"path"`       // "lan", "direct" or "relay" while online
+	// Storage from the peer's last signed status, master only
+	FreeBytes   int64 `json:"freeBytes"`
+	CapBytes    int64 `json:"capBytes"` // 0 if the peer declared no storage cap
+	StoredBytes int64 `json:"storedBytes"`
+	StatusMs    int64 `json:"statusMs"` // Unix milliseconds, 0 if the peer never reported
 }
 
 // StorageStats represents storage statistics for the frontend
@@ -44,6 +90,237 @@ type StorageStats struct {
 	TotalSize  int64 `json:"totalSize"`
 }
 
+// VaultStatsInfo is a signed vault status snapshot for the frontend
+type VaultStatsInfo struct {
+	UpdateID     uint64 `json:"updateId"`
+	TimestampMs  int64  `json:"timestampMs"`
+	FileCount    int64  `json:"fileCount"`
+	FolderCount  int64  `json:"folderCount"`
+	LogicalBytes int64  `json:"logicalBytes"`
+	StoredBytes  int64  `json:"storedBytes"`
+}
+
+// NodeStatusInfo summarizes this node's replication state for the frontend.
+// It never needs the vault key, so locked replicas can show it.
+type NodeStatusInfo struct {
+	HasVaultKey      bool            `json:"hasVaultKey"`
+	Entries          int64           `json:"entries"`
+	EncryptedBytes   int64           `json:"encryptedBytes"`
+	FilesComplete    int64           `json:"filesComplete"`
+	FilesTotal       int64           `json:"filesTotal"`
+	BytesStored      int64           `json:"bytesStored"`
+	BytesReferenced  int64           `json:"bytesReferenced"`
+	LastUpdateID     uint64          `json:"lastUpdateId"`
+	LastUpdateType   string          `json:"lastUpdateType"`
+	LastUpdateTimeMs int64           `json:"lastUpdateTimeMs"` // 0 if no update was applied
+	Vault            *VaultStatsInfo `json:"vault"`
+	Quarantined      int             `json:"quarantined"`  // Entries that failed verification
+	CorruptBlobs     int             `json:"corruptBlobs"` // Stored files awaiting repair after a scrub
+	BlobBytes        int64           `json:"blobBytes"`    // Stored locally, counted against the quota
+	Quota            int64           `json:"quota"`        // 0 for none
+}
+
+// ViewerInfo describes a running guest viewer session for the frontend
+type ViewerInfo struct {
+	URL         string `json:"url"`
+	Username    string `json:"username"`
+	Password    string `json:"password"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+// SyncRoundInfo describes one data reconciliation round for the frontend
+type SyncRoundInfo struct {
+	UpdateID         uint64 `json:"updateId"`
+	Peer             string `json:"peer"`
+	Mode             string `json:"mode"`
+	Started          string `json:"started"`
+	StartedMs        int64  `json:"startedMs"`
+	DurationMs       int64  `json:"durationMs"`
+	BucketsCompared  int    `json:"bucketsCompared"`
+	BucketsDiffering int    `json:"bucketsDiffering"`
+	EntriesFetched   int    `json:"entriesFetched"`
+	EntriesDeleted   int    `json:"entriesDeleted"`
+	FilesDownloaded  int    `json:"filesDownloaded"`
+	BytesMoved       int64  `json:"bytesMoved"`
+	Error            string `json:"error"`
+}
+
+// ProtocolErrorInfo is a failed exchange with a peer, for the diagnostics panel
+type ProtocolErrorInfo struct {
+	Peer        string `json:"peer"`
+	Protocol    string `json:"protocol"`
+	Phase       string `json:"phase"`
+	Error       string `json:"error"`
+	TimestampMs int64  `json:"timestampMs"`
+}
+
+// ChangeInfo is a data update in the activity feed
+type ChangeInfo struct {
+	UpdateID    uint64 `json:"updateId"`
+	Action      string `json:"action"`
+	Entries     int    `json:"entries"`
+	Note        string `json:"note"`
+	TimestampMs int64  `json:"timestampMs"`
+}
+
+// IntentInfo is an operation of the master and how far it reached the other devices
+type IntentInfo struct {
+	ID        int64    `json:"id"`
+	Summary   string   `json:"summary"`
+	State     string   `json:"state"` // "pending", "published" or "failed"
+	Error     string   `json:"error"`
+	CreatedMs int64    `json:"createdMs"`
+	Delivered int      `json:"delivered"` // Devices that applied it
+	Total     int      `json:"total"`
+	Pending   []string `json:"pending"` // Names of the devices still to apply it
+}
+
+// OrphanInfo describes an entry whose parent folder no longer exists
+type OrphanInfo struct {
+	ID            string `json:"id"`
+	Type          string `json:"type"` // "file" or "folder"
+	Name          string `json:"name"`
+	MissingParent string `json:"missingParent"`
+	Size          int64  `json:"size"`
+}
+
+// TrashItemInfo describes a trashed file or folder
+type TrashItemInfo struct {
+	ID          string `json:"id"`
+	Type        string `json:"type"` // "file" or "folder"
+	Name        string `json:"name"`
+	FolderID    string `json:"folderId"` // Folder it was deleted from
+	Size        int64  `json:"size"`
+	TrashedAtMs int64  `json:"trashedAtMs"`
+	ExpiresAtMs int64  `json:"expiresAtMs"` // When the master deletes it for good
+}
+
+// DropBoxInfo describes an upload-only folder and the peers allowed to drop into it
+type DropBoxInfo struct {
+	FolderID string   `json:"folderId"`
+	Name     string   `json:"name"`
+	Droppers []string `json:"droppers"`
+}
+
+// SyncDeviceInfo describes whether a device replicates a folder
+type SyncDeviceInfo struct {
+	PeerID    string `json:"peerId"` // Shortened for display
+	ID        string `json:"id"`     // Full peer ID, for SetSyncFolder
+	Label     string `json:"label"`
+	Selected  bool   `json:"selected"`  // The folder is one the device was given
+	Inherited bool   `json:"inherited"` // Replicated through a folder above it
+	Folders   int    `json:"folders"`   // Folders the device was given, 0 if it replicates every folder
+}
+
+// FolderReplicationInfo describes how replicas download a folder's files
+type FolderReplicationInfo struct {
+	Mode      string `json:"mode"`      // "everywhere", "on-demand" or "" for each device's setting
+	Inherited bool   `json:"inherited"` // Mode given to a folder above it
+}
+
+// ImportProgressInfo is sent as an "import-progress" event for every file of a folder import
+type ImportProgressInfo struct {
+	Path  string `json:"path"` // Relative to the imported directory
+	Done  int    `json:"done"`
+	Total int    `json:"total"`
+	Error string `json:"error,omitempty"` // Set if the file was not imported
+}
+
+// MigrateProgressInfo is sent as a "migrate-progress" event while
+// MigrateStorage moves the vault: by blob while copying and verifying, then
+// once for the database
+type MigrateProgressInfo struct {
+	Stage string `json:"stage"` // "copy", "verify" or "database"
+	Done  int    `json:"done"`
+	Total int    `json:"total"`
+}
+
+// FileProgressInfo is sent as a "file-progress" event while a file added with
+// AddFile is encrypted, about once per percent
+type FileProgressInfo struct {
+	Name  string `json:"name"`
+	Done  int64  `json:"done"`  // Bytes encrypted so far
+	Total int64  `json:"total"` // Size of the file
+}
+
+// BindProgressInfo is sent as a "bind-progress" event for every stage of binding a new device
+type BindProgressInfo struct {
+	BindingID string `json:"bindingId"`
+	Stage     string `json:"stage"`  // "searching", "peer-found", "verifying", "sending-peer-list", "done" or "failed"
+	PeerID    string `json:"peerId"` // Empty while searching
+	Error     string `json:"error,omitempty"`
+	Code      string `json:"code,omitempty"`     // Error code of Error, see errors.go
+	Restored  bool   `json:"restored,omitempty"` // Set with "done" for a device that was removed before
+	Label     string `json:"label,omitempty"`    // Label the restored device got back
+}
+
+// FormerPeerInfo is a removed device that can be restored unless banned
+type FormerPeerInfo struct {
+	PeerID    string `json:"peerId"` // Shortened for display
+	ID        string `json:"id"`
+	Label     string `json:"label"`
+	Banned    bool   `json:"banned"`
+	RemovedAt int64  `json:"removedAt"` // Unix seconds
+}
+
+// PendingBindingInfo is a binding of a new device in progress
+type PendingBindingInfo struct {
+	BindingID string `json:"bindingId"`
+	Phrase    string `json:"phrase"`
+	Stage     string `json:"stage"`
+	PeerID    string `json:"peerId"`
+	StartedAt int64  `json:"startedAt"` // Unix seconds
+}
+
+// ReleaseInfo represents a staged endershare release for the frontend
+type ReleaseInfo struct {
+	Version     string `json:"version"`
+	Notes       string `json:"notes"`
+	Size        int64  `json:"size"`
+	PublishedMs int64  `json:"publishedMs"`
+}
+
+// VaultPolicyInfo represents the vault's file size and type limits for the frontend
+type VaultPolicyInfo struct {
+	MaxFileSize       int64    `json:"maxFileSize"`  // Encrypted bytes, 0 for no limit
+	MaxVaultSize      int64    `json:"maxVaultSize"` // Encrypted bytes, 0 for no limit
+	BlockedExtensions []string `json:"blockedExtensions"`
+}
+
+// VaultFreezeInfo is the vault's freeze state for the frontend
+type VaultFreezeInfo struct {
+	Frozen   bool   `json:"frozen"`
+	Reason   string `json:"reason"`
+	SinceMs  int64  `json:"sinceMs"` // 0 when not frozen
+	IsMaster bool   `json:"isMaster"`
+}
+
+// FileVersionInfo represents an earlier version of a file for the frontend
+type FileVersionInfo struct {
+	Index        int    `json:"index"` // Pass to RestoreVersion
+	Size         int64  `json:"size"`
+	ModifiedAt   string `json:"modifiedAt"`
+	ModifiedAtMs int64  `json:"modifiedAtMs"`
+	Stored       bool   `json:"stored"` // Whether this node holds the version's blob
+}
+
+// PhotoInfo represents a file with a capture date in the by-date view
+type PhotoInfo struct {
+	Name         string `json:"name"`
+	FolderID     string `json:"folderId"`
+	Size         int64  `json:"size"`
+	CapturedAt   string `json:"capturedAt"`   // Camera wall clock, no time zone
+	CapturedAtMs int64  `json:"capturedAtMs"` // Unix milliseconds of the wall clock read as UTC
+	Camera       string `json:"camera"`
+}
+
+// PhotoMonthInfo groups the photos captured in one month
+type PhotoMonthInfo struct {
+	Year   int         `json:"year"`
+	Month  int         `json:"month"`
+	Photos []PhotoInfo `json:"photos"`
+}
+
 // App struct holds application state
 type App struct {
 	ctx          context.Context
@@ -54,6 +331,11 @@ type App struct {
 	syncPhrase   string
 	bindingMutex sync.Mutex
 	bindCancel   context.CancelFunc
+	viewer       *api.Viewer
+	viewerMutex  sync.Mutex
+	catalog      *i18n.Catalog
+	noteMutex    sync.Mutex
+	changeNote   []byte // Sealed note for the next change published, see SetChangeNote
 }
 
 // NewApp creates a new App instance
@@ -66,6 +348,11 @@ func (a *App) startup(ctx context.Context) {
 	a.ctx = ctx
 	a.db = database.Create()
 	a.keys = a.db.GetKeys()
+	if a.keys == nil {
+		// Replicas keep their peer identity across restarts
+		a.keys = a.db.GetPeerKeys()
+	}
+	a.catalog = i18n.Load(a.locale())
 
 	// If we have full keys (including AES), initialize storage and core
 	if a.keys != nil && a.keys.AESKey != nil {
@@ -73,6 +360,15 @@ func (a *App) startup(ctx context.Context) {
 	}
 }
 
+// shutdown is called when the app is closing
+func (a *App) shutdown(ctx context.Context) {
+	if a.core != nil {
+		if err := a.core.SavePeerstore(); err != nil {
+			fmt.Println("Warning: Failed to save peerstore:", err)
+		}
+	}
+}
+
 // initializeCore sets up the core and storage when keys are available
 func (a *App) initializeCore() {
 	if a.keys == nil || a.keys.AESKey == nil {
@@ -92,6 +388,15 @@ func (a *App) initializeCore() {
 		a.core.OnDataUpdated = func() {
 			runtime.EventsEmit(a.ctx, "data-updated")
 		}
+		a.core.OnReleaseStaged = func(manifest core.ReleaseManifest) {
+			runtime.EventsEmit(a.ctx, "release-staged", manifest.Version)
+		}
+		a.core.OnSyncRound = func(round core.SyncRound) {
+			runtime.EventsEmit(a.ctx, "sync-round", newSyncRoundInfo(round))
+		}
+		a.core.Subscribe(func(e core.Event) {
+			runtime.EventsEmit(a.ctx, string(e.Type), hex.EncodeToString(e.FileHash))
+		}, core.EventBlobCorrupted, core.EventBlobRepaired)
 	}
 }
 
@@ -103,7 +408,10 @@ func (a *App) GetAppState() string {
 	}
 
 	// Check if we're in binding mode
-	if a.syncPhrase != "" {
+	a.bindingMutex.Lock()
+	binding := a.bindCancel != nil
+	a.bindingMutex.Unlock()
+	if binding {
 		return "binding"
 	}
 
@@ -122,6 +430,8 @@ func (a *App) GetAppState() string {
 
 // GetSyncPhrase returns the current binding sync phrase
 func (a *App) GetSyncPhrase() string {
+	a.bindingMutex.Lock()
+	defer a.bindingMutex.Unlock()
 	return a.syncPhrase
 }
 
@@ -143,6 +453,11 @@ func (a *App) StartReplicaBinding() (string, error) {
 	a.bindingMutex.Lock()
 	defer a.bindingMutex.Unlock()
 
+	// Binding is already in progress
+	if a.bindCancel != nil {
+		return a.syncPhrase, nil
+	}
+
 	// Generate peer-only keys if we don't have any
 	if a.keys == nil {
 		a.keys = crypto.CreatePeerOnlyKeys()
@@ -154,55 +469,67 @@ func (a *App) StartReplicaBinding() (string, error) {
 	var err error
 	a.core, err = core.NewCoreForBinding(a.db, a.keys)
 	if err != nil {
-		return "", fmt.Errorf("failed to initialize for binding: %w", err)
+		return "", newAppError(ErrCodeInternal, "failed to initialize for binding: %w", err)
 	}
 
 	// Start binding and get the sync phrase
 	ctx, cancel := context.WithCancel(context.Background())
-	a.bindCancel = cancel
-
-	phrase, err := a.core.StartBinding(ctx, func(info *p2p.ClientInfo) {
-		// Store master public key
-		a.keys.MasterPublicKey = info.MasterPublicKey
-		a.db.StoreKeys(a.keys)
-
-		// Add master node to peers table
-		if err := a.db.AddPeer(info.AddrInfo); err != nil {
-			fmt.Println("Warning: Failed to add master peer:", err)
+	bindingCore := a.core
+
+	phrase, err := bindingCore.StartBinding(ctx, func(info *p2p.ClientInfo, err error) {
+		a.bindingMutex.Lock()
+		defer a.bindingMutex.Unlock()
+		if ctx.Err() != nil {
+			// CancelBinding already tore the session down
+			return
 		}
-
-		// Add all peers from the peer list
-		for _, peerInfo := range info.PeerList {
-			if err := a.db.AddPeer(peerInfo); err != nil {
-				fmt.Printf("Warning: Failed to add peer %s: %v\n", peerInfo.ID, err)
-			}
+		if err == nil {
+			err = bindingCore.StoreBinding(info)
 		}
-
-		// Update P2P node's in-memory peer map
-		allPeers := append(info.PeerList, info.AddrInfo)
-		a.core.ReplacePeers(allPeers)
-
-		a.syncPhrase = ""
+		if err != nil {
+			a.endBinding(true)
+			runtime.EventsEmit(a.ctx, "binding-failed", err.Error())
+			return
+		}
+		a.endBinding(false)
 		runtime.EventsEmit(a.ctx, "binding-complete")
 	})
 	if err != nil {
+		cancel()
+		a.core.Close()
+		a.core = nil
 		return "", err
 	}
 
+	a.bindCancel = cancel
 	a.syncPhrase = phrase
 	return phrase, nil
 }
 
+// endBinding ends the binding session. Unless it completed, the core created
+// for it is closed along with its p2p node. Callers hold bindingMutex.
+func (a *App) endBinding(discardCore bool) {
+	if a.bindCancel != nil {
+		a.bindCancel()
+		a.bindCancel = nil
+	}
+	a.syncPhrase = ""
+	if discardCore && a.core != nil {
+		if err := a.core.Close(); err != nil {
+			fmt.Println("Warning: Failed to close binding node:", err)
+		}
+		a.core = nil
+	}
+}
+
 // CancelBinding cancels the current binding process
 func (a *App) CancelBinding() error {
 	a.bindingMutex.Lock()
 	defer a.bindingMutex.Unlock()
 
 	if a.bindCancel != nil {
-		a.bindCancel()
-		a.bindCancel = nil
+		a.endBinding(true)
 	}
-	a.syncPhrase = ""
 	return nil
 }
 
@@ -216,7 +543,7 @@ func (a *App) UnlockWithMnemonic(mnemonic string) error {
 	// Verify the mnemonic matches our stored master public key if we have one
 	if a.keys != nil && a.keys.MasterPublicKey != nil {
 		if string(keys.MasterPublicKey) != string(a.keys.MasterPublicKey) {
-			return fmt.Errorf("mnemonic does not match this vault")
+			return newAppError(ErrCodeMnemonic, "mnemonic does not match this vault")
 		}
 		// Keep our peer keys
 		keys.PeerPrivateKey = a.keys.PeerPrivateKey
@@ -231,63 +558,209 @@ func (a *App) UnlockWithMnemonic(mnemonic string) error {
 }
 
 // ListFolder returns files and folders in the specified folder
-func (a *App) ListFolder(folderID int) ([]FolderItem, error) {
+func (a *App) ListFolder(folderID string) ([]FolderItem, error) {
 	if a.stor == nil {
-		return nil, fmt.Errorf("vault is locked")
+		return nil, errVaultLocked
 	}
 
-	items, err := a.stor.ListFolder(folderID)
+	items, err := a.stor.ListFolder(storage.FolderID(folderID))
 	if err != nil {
 		return nil, err
 	}
 
+	return folderItems(a.stor, items, a.selfID()), nil
+}
+
+// folderItems converts the entries listed by stor to FolderItems. selfID is
+// this node's peer ID, telling its own locks from those of other devices.
+func folderItems(stor *storage.Storage, items []interface{}, selfID string) []FolderItem {
 	result := make([]FolderItem, 0, len(items))
 	for _, item := range items {
 		switch v := item.(type) {
 		case storage.FileEntry:
-			result = append(result, FolderItem{
-				Type:       "file",
-				Name:       v.Name,
-				Size:       v.Size,
-				ModifiedAt: v.ModifiedAt.Format(time.RFC3339),
-			})
+			folderPinned, _ := stor.FolderPinned(cmp.Or(v.FolderID, storage.RootFolderID))
+			file := FolderItem{
+				Type:         "file",
+				Name:         v.Name,
+				Size:         v.Size,
+				ModifiedAt:   v.ModifiedAt.Format(time.RFC3339),
+				ModifiedAtMs: v.ModifiedAt.UnixMilli(),
+				Symlink:      v.Symlink,
+				Local:        stor.IsLocal(v.Name, cmp.Or(v.FolderID, storage.RootFolderID)),
+				Pinned:       stor.IsPinned(v.Name, cmp.Or(v.FolderID, storage.RootFolderID)),
+				PinInherited: folderPinned,
+				ParentID:     string(cmp.Or(v.FolderID, storage.RootFolderID)),
+				Tags:         v.Tags,
+				Note:         v.Note,
+			}
+			if v.Archive != nil {
+				file.Archive, file.ArchivedAtMs = v.Archive.Location, v.Archive.ArchivedAt.UnixMilli()
+			}
+			if v.Lock != nil {
+				file.LockedBy, file.LockedAtMs = v.Lock.Who(), v.Lock.LockedAt.UnixMilli()
+				file.LockedHere = v.Lock.HeldBy(selfID)
+			}
+			result = append(result, file)
 		case storage.FolderEntry:
-			result = append(result, FolderItem{
+			item := FolderItem{
 				Type:     "folder",
 				Name:     v.Name,
-				FolderID: v.FolderID,
-			})
+				FolderID: string(v.FolderID),
+				DropBox:  v.DropBox,
+				ParentID: string(cmp.Or(v.ParentFolderID, storage.RootFolderID)),
+				Tags:     v.Tags,
+			}
+			item.Pinned, item.PinInherited = stor.FolderPinned(v.FolderID)
+			result = append(result, item)
 		}
 	}
-
-	return result, nil
+	return result
 }
 
 // CreateFolder creates a new folder and returns its ID
-func (a *App) CreateFolder(name string, parentID int) (int, error) {
+func (a *App) CreateFolder(name string, parentID string) (string, error) {
 	if a.stor == nil {
-		return 0, fmt.Errorf("vault is locked")
+		return "", errVaultLocked
+	}
+	if err := a.checkWritable(); err != nil {
+		return "", err
 	}
 
-	folderID, entry, err := a.stor.CreateFolderWithEntry(name, parentID)
+	folderID, entry, err := a.stor.CreateFolderWithEntry(name, storage.FolderID(parentID))
 	if err != nil {
-		return 0, err
+		return "", err
 	}
 
 	// Publish update if master
 	if a.core != nil && a.core.IsMaster() {
-		if err := a.core.PublishDataUpdate("ADD", entry.Key, entry.Value, entry.Size, entry.Hash); err != nil {
+		if err := a.core.PublishDataUpdate("ADD", entry.Key, entry.Value, entry.Size, entry.Hash, a.takeChangeNote()); err != nil {
 			fmt.Println("Warning: Failed to publish data update:", err)
 		}
 	}
 
-	return folderID, nil
+	return string(folderID), nil
+}
+
+// CreateDropBox creates an upload-only folder and returns its ID
+func (a *App) CreateDropBox(name string, parentID string) (string, error) {
+	if a.stor == nil {
+		return "", errVaultLocked
+	}
+	if a.core == nil || !a.core.IsMaster() {
+		return "", newAppError(ErrCodeNotMaster, "only the master can create drop boxes")
+	}
+	if err := a.checkWritable(); err != nil {
+		return "", err
+	}
+
+	folderID, entry, err := a.stor.CreateDropBox(name, storage.FolderID(parentID))
+	if err != nil {
+		return "", err
+	}
+	a.publishEntries("ADD", []*database.DataEntry{entry})
+	return string(folderID), nil
+}
+
+// GetDropBoxes returns every drop box with its designated peers
+func (a *App) GetDropBoxes() ([]DropBoxInfo, error) {
+	if a.stor == nil {
+		return nil, errVaultLocked
+	}
+
+	boxes, err := a.stor.ListDropBoxes()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]DropBoxInfo, 0, len(boxes))
+	for _, box := range boxes {
+		droppers := box.Droppers
+		if droppers == nil {
+			droppers = []string{}
+		}
+		result = append(result, DropBoxInfo{FolderID: string(box.FolderID), Name: box.Name, Droppers: droppers})
+	}
+	return result, nil
+}
+
+// SetDropBoxPeer allows or stops a peer dropping files into a drop box
+func (a *App) SetDropBoxPeer(folderID string, peerID string, allowed bool) error {
+	if a.core == nil {
+		return errVaultLocked
+	}
+	if err := a.core.SetDropper(storage.FolderID(folderID), peerID, allowed); err != nil {
+		return err
+	}
+	runtime.EventsEmit(a.ctx, "data-updated")
+	return nil
+}
+
+// GetSyncDevices returns every device other than the master with whether it
+// replicates the folder (master only)
+func (a *App) GetSyncDevices(folderID string) ([]SyncDeviceInfo, error) {
+	if a.stor == nil {
+		return nil, errVaultLocked
+	}
+	if a.core == nil || !a.core.IsMaster() {
+		return nil, newAppError(ErrCodeNotMaster, "only the master can choose the folders devices replicate")
+	}
+
+	labels := make(map[string]string)
+	for _, p := range a.db.GetAllPeers() {
+		labels[p.PeerID] = p.Label
+	}
+	selection := a.core.GetSyncSelection()
+	id := storage.FolderID(folderID)
+	result := []SyncDeviceInfo{}
+	for _, peerID := range a.core.GetOtherPeerIDs() {
+		info := SyncDeviceInfo{PeerID: truncatePeerID(peerID), ID: peerID, Label: labels[peerID]}
+		if folders, ok := selection.FoldersOf(peerID); ok {
+			info.Folders = len(folders)
+			info.Selected = slices.Contains(folders, id)
+			info.Inherited = !info.Selected && a.stor.FolderWithin(id, folders)
+		}
+		result = append(result, info)
+	}
+	return result, nil
+}
+
+// SetSyncFolder adds a folder to or removes it from the folders a device
+// replicates. A device without folders replicates every folder.
+func (a *App) SetSyncFolder(folderID string, peerID string, selected bool) error {
+	if a.core == nil {
+		return errVaultLocked
+	}
+	return a.core.SetSyncFolder(peerID, storage.FolderID(folderID), selected)
+}
+
+// GetFolderReplication returns the replication mode in effect for a folder (master only)
+func (a *App) GetFolderReplication(folderID string) (FolderReplicationInfo, error) {
+	if a.stor == nil {
+		return FolderReplicationInfo{}, errVaultLocked
+	}
+	if a.core == nil || !a.core.IsMaster() {
+		return FolderReplicationInfo{}, newAppError(ErrCodeNotMaster, "only the master can choose how folders are replicated")
+	}
+	mode, inherited := a.stor.FolderMode(storage.FolderID(folderID), a.core.GetReplicationPolicy())
+	return FolderReplicationInfo{Mode: mode, Inherited: inherited}, nil
+}
+
+// SetFolderReplication gives a folder a replication mode, "" to follow the
+// folder above it
+func (a *App) SetFolderReplication(folderID string, mode string) error {
+	if a.core == nil {
+		return errVaultLocked
+	}
+	return a.core.SetFolderReplication(storage.FolderID(folderID), mode)
 }
 
-// AddFile opens a file picker and adds the selected file to the folder
-func (a *App) AddFile(folderID int) error {
+// AddFile opens a file picker and adds the selected file to the folder,
+// sending "file-progress" events while it is encrypted
+func (a *App) AddFile(folderID string) error {
 	if a.stor == nil {
-		return fmt.Errorf("vault is locked")
+		return errVaultLocked
+	}
+	if err := a.checkWritable(); err != nil {
+		return err
 	}
 
 	filePath, err := runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
@@ -300,137 +773,945 @@ func (a *App) AddFile(folderID int) error {
 		return nil // User cancelled
 	}
 
+	// Import rules may create date folders before the file, publish them too
 	fileName := filepath.Base(filePath)
-	entry, err := a.stor.AddFileWithEntry(filePath, fileName, folderID)
-	if err != nil {
-		return err
+	var replaced *database.DataEntry
+	var added []*database.DataEntry
+	if dup := a.offerStoredCopy(filePath, fileName, storage.FolderID(folderID)); dup != nil {
+		replaced, added, err = a.stor.ImportReference(dup, fileName, storage.FolderID(folderID))
+	} else {
+		replaced, added, err = a.stor.ImportFile(filePath, fileName, storage.FolderID(folderID), func(done, total int64) {
+			runtime.EventsEmit(a.ctx, "file-progress", FileProgressInfo{Name: fileName, Done: done, Total: total})
+		})
 	}
-
-	// Publish update if master
-	if a.core != nil && a.core.IsMaster() {
-		if err := a.core.PublishDataUpdate("ADD", entry.Key, entry.Value, entry.Size, entry.Hash); err != nil {
-			fmt.Println("Warning: Failed to publish data update:", err)
-		}
+	a.publishEntries("ADD", added)
+	if replaced != nil {
+		a.publishEntries("DELETE", []*database.DataEntry{replaced})
 	}
+	return err
+}
 
-	return nil
+// offerStoredCopy asks whether a file whose content is already stored should
+// reference the stored copy, and returns it if so. With dedupe on the import
+// references it anyway, so there is nothing to ask.
+func (a *App) offerStoredCopy(filePath, fileName string, folderID storage.FolderID) *storage.Duplicate {
+	if a.db.GetDedupeFiles() || a.stor.IsDropBox(folderID) {
+		return nil
+	}
+	dup, err := a.stor.FindDuplicateFile(filePath)
+	if err != nil || dup == nil {
+		return nil
+	}
+	choice, err := runtime.MessageDialog(a.ctx, runtime.MessageDialogOptions{
+		Type:          runtime.QuestionDialog,
+		Title:         "File Already Stored",
+		Message:       fmt.Sprintf("%s has the same content as %s, which is already in the vault. Reference the stored copy instead of storing it again?", fileName, dup.Name),
+		Buttons:       []string{"Yes", "No"},
+		DefaultButton: "Yes",
+		CancelButton:  "No",
+	})
+	if err != nil || choice != "Yes" {
+		return nil
+	}
+	return dup
 }
 
-// ExportFile exports a file to the local filesystem
-func (a *App) ExportFile(name string, folderID int) error {
+// AddFolder lets the user pick a local directory and imports it, see AddFolderFromPath
+func (a *App) AddFolder(folderID string) error {
 	if a.stor == nil {
-		return fmt.Errorf("vault is locked")
+		return errVaultLocked
+	}
+	if err := a.checkWritable(); err != nil {
+		return err
 	}
 
-	destPath, err := runtime.SaveFileDialog(a.ctx, runtime.SaveDialogOptions{
-		Title:           "Export File",
-		DefaultFilename: name,
+	dirPath, err := runtime.OpenDirectoryDialog(a.ctx, runtime.OpenDialogOptions{
+		Title: "Select Folder to Add",
 	})
 	if err != nil {
 		return err
 	}
-	if destPath == "" {
+	if dirPath == "" {
 		return nil // User cancelled
 	}
+	return a.AddFolderFromPath(dirPath, folderID)
+}
+
+// AddFolderFromPath imports a local directory with its subdirectories into a
+// folder, sending an "import-progress" event after every file
+func (a *App) AddFolderFromPath(localPath string, folderID string) error {
+	if a.stor == nil {
+		return errVaultLocked
+	}
+	if err := a.checkWritable(); err != nil {
+		return err
+	}
 
-	return a.stor.GetFile(name, folderID, destPath)
+	intent := a.beginIntent("Add folder " + filepath.Base(localPath))
+	_, replaced, added, err := a.stor.AddFolderFromPath(localPath, storage.FolderID(folderID), func(p storage.ImportProgress) {
+		info := ImportProgressInfo{Path: p.Path, Done: p.Done, Total: p.Total}
+		if p.Err != nil {
+			info.Error = p.Err.Error()
+		}
+		runtime.EventsEmit(a.ctx, "import-progress", info)
+	})
+	// Whatever was imported before an error is published too
+	a.publishBatch(added, replaced)
+	intent.Done(err)
+	return err
 }
 
-// DeleteFile removes a file from storage
-func (a *App) DeleteFile(name string, folderID int) error {
+// ImportArchive lets the user pick a zip or tar archive and extracts it into
+// a folder, sending an "import-progress" event after every file
+func (a *App) ImportArchive(folderID string) error {
 	if a.stor == nil {
-		return fmt.Errorf("vault is locked")
+		return errVaultLocked
+	}
+	if err := a.checkWritable(); err != nil {
+		return err
 	}
 
-	entry, err := a.stor.DeleteFileWithEntry(name, folderID)
+	archivePath, err := runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
+		Title:   "Select Archive to Import",
+		Filters: []runtime.FileFilter{{DisplayName: "Zip or tar archives", Pattern: "*.zip;*.tar"}},
+	})
 	if err != nil {
 		return err
 	}
+	if archivePath == "" {
+		return nil // User cancelled
+	}
 
-	// Publish update if master
-	if a.core != nil && a.core.IsMaster() {
-		if err := a.core.PublishDataUpdate("DELETE", entry.Key, entry.Value, entry.Size, entry.Hash); err != nil {
-			fmt.Println("Warning: Failed to publish data update:", err)
+	intent := a.beginIntent("Import " + filepath.Base(archivePath))
+	replaced, added, err := a.stor.ImportArchive(archivePath, storage.FolderID(folderID), func(p storage.ImportProgress) {
+		info := ImportProgressInfo{Path: p.Path, Done: p.Done, Total: p.Total}
+		if p.Err != nil {
+			info.Error = p.Err.Error()
 		}
+		runtime.EventsEmit(a.ctx, "import-progress", info)
+	})
+	a.publishBatch(added, replaced)
+	intent.Done(err)
+	return err
+}
+
+// GetPhotosByDate returns the vault's photos grouped by capture month, newest first
+func (a *App) GetPhotosByDate() ([]PhotoMonthInfo, error) {
+	if a.stor == nil {
+		return nil, errVaultLocked
 	}
 
-	return nil
+	months, err := a.stor.PhotosByDate()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]PhotoMonthInfo, 0, len(months))
+	for _, m := range months {
+		info := PhotoMonthInfo{Year: m.Year, Month: int(m.Month), Photos: make([]PhotoInfo, 0, len(m.Photos))}
+		for _, p := range m.Photos {
+			info.Photos = append(info.Photos, PhotoInfo{
+				Name:         p.Name,
+				FolderID:     string(p.FolderID),
+				Size:         p.Size,
+				CapturedAt:   p.Photo.CapturedAt.Format("2006-01-02T15:04:05"),
+				CapturedAtMs: p.Photo.CapturedAt.UnixMilli(),
+				Camera:       p.Photo.Camera(),
+			})
+		}
+		result = append(result, info)
+	}
+	return result, nil
 }
 
-// DeleteFolder removes a folder from storage
-func (a *App) DeleteFolder(folderID int) error {
+// ExportFile exports a file to the local filesystem
+func (a *App) ExportFile(name string, folderID string) error {
 	if a.stor == nil {
-		return fmt.Errorf("vault is locked")
+		return errVaultLocked
 	}
 
-	entry, err := a.stor.DeleteFolderWithEntry(folderID)
+	destPath, err := runtime.SaveFileDialog(a.ctx, runtime.SaveDialogOptions{
+		Title:           "Export File",
+		DefaultFilename: storage.LocalName(name),
+	})
 	if err != nil {
 		return err
 	}
-
-	// Publish update if master
-	if a.core != nil && a.core.IsMaster() {
-		if err := a.core.PublishDataUpdate("DELETE", entry.Key, entry.Value, entry.Size, entry.Hash); err != nil {
-			fmt.Println("Warning: Failed to publish data update:", err)
-		}
+	if destPath == "" {
+		return nil // User cancelled
 	}
 
-	return nil
+	return a.stor.GetFile(name, storage.FolderID(folderID), destPath)
 }
 
-// GetFolderPath returns the path segments for breadcrumb navigation
-func (a *App) GetFolderPath(folderID int) ([]PathSegment, error) {
+// GetThumbnail returns a small preview of an image file as a JPEG data URL,
+// or "" if the file is no image or is not stored on this node yet
+func (a *App) GetThumbnail(name string, folderID string) (string, error) {
 	if a.stor == nil {
-		return nil, fmt.Errorf("vault is locked")
+		return "", errVaultLocked
 	}
 
-	if folderID == 0 {
-		return []PathSegment{{Name: "/", FolderID: 0}}, nil
+	thumb, err := a.stor.Thumbnail(name, storage.FolderID(folderID))
+	if errors.Is(err, storage.ErrNotFound) {
+		return "", nil
 	}
+	if err != nil {
+		return "", err
+	}
+	return "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(thumb), nil
+}
 
-	// Build path by traversing parent folders
-	path := []PathSegment{}
-	currentID := folderID
+// ExportFolder lets the user pick a local directory and exports a folder with
+// everything below it into a new directory there, see ExportFolderToPath
+func (a *App) ExportFolder(folderID string) error {
+	if a.stor == nil {
+		return errVaultLocked
+	}
 
-	for currentID != 0 {
-		folder, err := a.getFolderByID(currentID)
+	name := "endershare"
+	if id := storage.FolderID(folderID); !id.IsRoot() {
+		folder, err := a.stor.GetFolder(id)
 		if err != nil {
-			break
+			return err
 		}
-		path = append([]PathSegment{{Name: folder.Name, FolderID: folder.FolderID}}, path...)
-		currentID = folder.ParentFolderID
+		name = folder.Name
 	}
 
-	// Add root at the beginning
-	path = append([]PathSegment{{Name: "/", FolderID: 0}}, path...)
-
-	return path, nil
+	dirPath, err := runtime.OpenDirectoryDialog(a.ctx, runtime.OpenDialogOptions{
+		Title: "Export Folder To",
+	})
+	if err != nil {
+		return err
+	}
+	if dirPath == "" {
+		return nil // User cancelled
+	}
+	return a.stor.ExportFolderToPath(storage.FolderID(folderID), filepath.Join(dirPath, storage.LocalName(name)))
 }
 
-// getFolderByID finds a folder by its ID
-func (a *App) getFolderByID(folderID int) (*storage.FolderEntry, error) {
-	items, err := a.db.GetAllData()
-	if err != nil {
-		return nil, err
+// ExportFolderArchive lets the user pick where to save a zip or tar archive
+// of a folder with everything below it, see ExportArchive
+func (a *App) ExportFolderArchive(folderID string, format string) error {
+	if a.stor == nil {
+		return errVaultLocked
 	}
 
-	for _, entry := range items {
-		decrypted, err := crypto.Decrypt(entry.Key, a.keys.AESKey)
+	name := "endershare"
+	if id := storage.FolderID(folderID); !id.IsRoot() {
+		folder, err := a.stor.GetFolder(id)
 		if err != nil {
-			continue
-		}
-
-		var folder storage.FolderEntry
-		if err := parseJSON(decrypted, &folder); err != nil {
-			continue
-		}
-
-		if folder.Type == storage.TypeFolder && folder.FolderID == folderID {
-			return &folder, nil
+			return err
 		}
+		name = folder.Name
 	}
 
-	return nil, fmt.Errorf("folder not found: %d", folderID)
+	destPath, err := runtime.SaveFileDialog(a.ctx, runtime.SaveDialogOptions{
+		Title:           "Export Folder As Archive",
+		DefaultFilename: storage.LocalName(name) + "." + format,
+	})
+	if err != nil {
+		return err
+	}
+	if destPath == "" {
+		return nil // User cancelled
+	}
+	return a.stor.ExportArchive(storage.FolderID(folderID), destPath, format)
+}
+
+// EvictFile frees the local copy of a file's content on a replica, keeping
+// the file as a placeholder that is fetched again when next opened. Returns
+// the bytes freed.
+func (a *App) EvictFile(name string, folderID string) (int64, error) {
+	if a.stor == nil {
+		return 0, errVaultLocked
+	}
+	if a.core == nil {
+		return 0, errNotInitialized
+	}
+	return a.core.EvictFile(name, storage.FolderID(folderID))
+}
+
+// PinFile pins or unpins a file on a replica, so its content is downloaded
+// and kept whatever else decides
+func (a *App) PinFile(name string, folderID string, pinned bool) error {
+	if a.stor == nil {
+		return errVaultLocked
+	}
+	if a.core == nil {
+		return errNotInitialized
+	}
+	return a.core.PinFile(name, storage.FolderID(folderID), pinned)
+}
+
+// PinFolder pins or unpins a folder, with everything below it, on a replica
+func (a *App) PinFolder(folderID string, pinned bool) error {
+	if a.stor == nil {
+		return errVaultLocked
+	}
+	if a.core == nil {
+		return errNotInitialized
+	}
+	return a.core.PinFolder(storage.FolderID(folderID), pinned)
+}
+
+// ArchiveFile lets the user pick the directory of an external disk, copies
+// the file's content there and marks the file as archived at location, see
+// core.ArchiveFile (master only)
+func (a *App) ArchiveFile(name string, folderID string, location string) error {
+	if a.stor == nil {
+		return errVaultLocked
+	}
+	if a.core == nil {
+		return errNotInitialized
+	}
+
+	dirPath, err := runtime.OpenDirectoryDialog(a.ctx, runtime.OpenDialogOptions{
+		Title: "Archive File To",
+	})
+	if err != nil {
+		return err
+	}
+	if dirPath == "" {
+		return nil // User cancelled
+	}
+	return a.core.ArchiveFile(name, storage.FolderID(folderID), dirPath, location)
+}
+
+// RestoreArchivedFile lets the user pick the directory an archived file was
+// archived to and re-ingests its content after checking its hash (master only)
+func (a *App) RestoreArchivedFile(name string, folderID string) error {
+	if a.stor == nil {
+		return errVaultLocked
+	}
+	if a.core == nil {
+		return errNotInitialized
+	}
+
+	dirPath, err := runtime.OpenDirectoryDialog(a.ctx, runtime.OpenDialogOptions{
+		Title: "Restore Archived File From",
+	})
+	if err != nil {
+		return err
+	}
+	if dirPath == "" {
+		return nil // User cancelled
+	}
+	return a.core.RestoreArchived(name, storage.FolderID(folderID), dirPath)
+}
+
+// DeleteFile moves a file to the trash
+func (a *App) DeleteFile(name string, folderID string) error {
+	if a.stor == nil {
+		return errVaultLocked
+	}
+	if err := a.checkWritable(); err != nil {
+		return err
+	}
+
+	removed, added, err := a.stor.TrashFile(name, storage.FolderID(folderID))
+	if err != nil {
+		return err
+	}
+	a.publishEntries("ADD", []*database.DataEntry{added})
+	a.publishEntries("DELETE", []*database.DataEntry{removed})
+	return nil
+}
+
+// ListVersions returns the earlier versions of a file, newest first
+func (a *App) ListVersions(name string, folderID string) ([]FileVersionInfo, error) {
+	if a.stor == nil {
+		return nil, errVaultLocked
+	}
+
+	versions, err := a.stor.ListVersions(name, storage.FolderID(folderID))
+	if err != nil {
+		return nil, err
+	}
+	result := make([]FileVersionInfo, 0, len(versions))
+	for i := len(versions) - 1; i >= 0; i-- {
+		v := versions[i]
+		result = append(result, FileVersionInfo{
+			Index:        i,
+			Size:         v.Size,
+			ModifiedAt:   v.ModifiedAt.Format(time.RFC3339),
+			ModifiedAtMs: v.ModifiedAt.UnixMilli(),
+			Stored:       a.stor.FileExists(v.BlobHash),
+		})
+	}
+	return result, nil
+}
+
+// RestoreVersion rolls a file back to an earlier version; the content it
+// replaces is kept as a version too
+func (a *App) RestoreVersion(name string, folderID string, index int) error {
+	if a.stor == nil {
+		return errVaultLocked
+	}
+	if err := a.checkWritable(); err != nil {
+		return err
+	}
+
+	removed, added, err := a.stor.RestoreVersion(name, storage.FolderID(folderID), index)
+	if err != nil {
+		return err
+	}
+	a.publishEntries("ADD", []*database.DataEntry{added})
+	a.publishEntries("DELETE", []*database.DataEntry{removed})
+	return nil
+}
+
+// RenameFile gives a file a new name in the same folder
+func (a *App) RenameFile(name string, folderID string, newName string) error {
+	if a.stor == nil {
+		return errVaultLocked
+	}
+	if err := a.checkWritable(); err != nil {
+		return err
+	}
+
+	removed, added, err := a.stor.RenameFile(name, storage.FolderID(folderID), newName)
+	if err != nil {
+		return err
+	}
+	a.publishModify(removed, added)
+	return nil
+}
+
+// MoveFile moves a file to another folder
+func (a *App) MoveFile(name string, srcFolderID string, dstFolderID string) error {
+	if a.stor == nil {
+		return errVaultLocked
+	}
+	if err := a.checkWritable(); err != nil {
+		return err
+	}
+
+	removed, added, err := a.stor.MoveFile(name, storage.FolderID(srcFolderID), storage.FolderID(dstFolderID))
+	if err != nil {
+		return err
+	}
+	a.publishModify(removed, added)
+	return nil
+}
+
+// RenameFolder gives a folder a new name
+func (a *App) RenameFolder(folderID string, newName string) error {
+	if a.stor == nil {
+		return errVaultLocked
+	}
+	if err := a.checkWritable(); err != nil {
+		return err
+	}
+
+	change, err := a.stor.RenameFolder(storage.FolderID(folderID), newName)
+	if err != nil {
+		return err
+	}
+	a.publishSubtree(change)
+	return nil
+}
+
+// MoveFolder moves a folder and everything in it into another folder
+func (a *App) MoveFolder(folderID string, dstFolderID string) error {
+	if a.stor == nil {
+		return errVaultLocked
+	}
+	if err := a.checkWritable(); err != nil {
+		return err
+	}
+
+	intent := a.beginIntent("Move folder " + a.folderName(folderID))
+	change, err := a.stor.MoveFolder(storage.FolderID(folderID), storage.FolderID(dstFolderID))
+	if err != nil {
+		intent.Done(err)
+		return err
+	}
+	a.publishSubtree(change)
+	intent.Done(nil)
+	return nil
+}
+
+// TagFile adds tags to and removes tags from a file
+func (a *App) TagFile(name string, folderID string, add []string, remove []string) error {
+	if a.stor == nil {
+		return errVaultLocked
+	}
+	if err := a.checkWritable(); err != nil {
+		return err
+	}
+
+	removed, added, err := a.stor.TagFile(name, storage.FolderID(folderID), add, remove)
+	if err != nil {
+		return err
+	}
+	if added != nil {
+		a.publishModify(removed, added)
+	}
+	return nil
+}
+
+// SetFileNote replaces the note of a file, or removes it when note is blank
+func (a *App) SetFileNote(name string, folderID string, note string) error {
+	if a.stor == nil {
+		return errVaultLocked
+	}
+	if err := a.checkWritable(); err != nil {
+		return err
+	}
+
+	removed, added, err := a.stor.SetNote(name, storage.FolderID(folderID), note)
+	if err != nil {
+		return err
+	}
+	if added != nil {
+		a.publishModify(removed, added)
+	}
+	return nil
+}
+
+// LockFile checks a file out on this device, so other devices see it is
+// being edited. Locks are advisory and only refuse a file another device holds.
+func (a *App) LockFile(name string, folderID string) error {
+	if a.stor == nil {
+		return errVaultLocked
+	}
+	if a.core == nil || !a.core.IsMaster() {
+		return newAppError(ErrCodeNotMaster, "%w can lock files", core.ErrNotMaster)
+	}
+	if err := a.checkWritable(); err != nil {
+		return err
+	}
+
+	removed, added, err := a.stor.LockFile(name, storage.FolderID(folderID), a.core.GetNodeID(), a.core.DeviceLabel())
+	if err != nil {
+		return err
+	}
+	if added != nil {
+		a.publishModify(removed, added)
+	}
+	return nil
+}
+
+// UnlockFile releases the lock on a file, with force one held by another device
+func (a *App) UnlockFile(name string, folderID string, force bool) error {
+	if a.stor == nil {
+		return errVaultLocked
+	}
+	if a.core == nil || !a.core.IsMaster() {
+		return newAppError(ErrCodeNotMaster, "%w can unlock files", core.ErrNotMaster)
+	}
+	if err := a.checkWritable(); err != nil {
+		return err
+	}
+
+	removed, added, err := a.stor.UnlockFile(name, storage.FolderID(folderID), a.core.GetNodeID(), force)
+	if err != nil {
+		return err
+	}
+	if added != nil {
+		a.publishModify(removed, added)
+	}
+	return nil
+}
+
+// SetChangeNote attaches a note to the next change published, such as
+// "replaced with signed copy", which devices holding the vault key show in
+// their activity feed. A blank note removes a note not yet used.
+func (a *App) SetChangeNote(note string) error {
+	if a.stor == nil {
+		return errVaultLocked
+	}
+	sealed, err := a.stor.SealChangeNote(note)
+	if err != nil {
+		return err
+	}
+	a.noteMutex.Lock()
+	defer a.noteMutex.Unlock()
+	a.changeNote = sealed
+	return nil
+}
+
+// takeChangeNote returns the note set with SetChangeNote, nil if there is
+// none, and clears it
+func (a *App) takeChangeNote() []byte {
+	a.noteMutex.Lock()
+	defer a.noteMutex.Unlock()
+	note := a.changeNote
+	a.changeNote = nil
+	return note
+}
+
+// GetFileNote returns the note of a file, empty if it has none
+func (a *App) GetFileNote(name string, folderID string) (string, error) {
+	if a.stor == nil {
+		return "", errVaultLocked
+	}
+	return a.stor.GetNote(name, storage.FolderID(folderID))
+}
+
+// TagFolder adds tags to and removes tags from a folder
+func (a *App) TagFolder(folderID string, add []string, remove []string) error {
+	if a.stor == nil {
+		return errVaultLocked
+	}
+	if err := a.checkWritable(); err != nil {
+		return err
+	}
+
+	removed, added, err := a.stor.TagFolder(storage.FolderID(folderID), add, remove)
+	if err != nil {
+		return err
+	}
+	if added != nil {
+		a.publishModify(removed, added)
+	}
+	return nil
+}
+
+// ListTagged returns the files and folders carrying a tag, wherever they are
+func (a *App) ListTagged(tag string) ([]FolderItem, error) {
+	if a.stor == nil {
+		return nil, errVaultLocked
+	}
+
+	items, err := a.stor.ListTagged(tag)
+	if err != nil {
+		return nil, err
+	}
+	return folderItems(a.stor, items, a.selfID()), nil
+}
+
+// GetTags returns the tags in use with the number of items carrying each
+func (a *App) GetTags() ([]TagInfo, error) {
+	if a.stor == nil {
+		return nil, errVaultLocked
+	}
+
+	tags, err := a.stor.ListTags()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]TagInfo, 0, len(tags))
+	for _, t := range tags {
+		result = append(result, TagInfo{Tag: t.Tag, Count: t.Count})
+	}
+	return result, nil
+}
+
+// Search returns the files and folders in the vault whose name contains every
+// word of query, and with withTags those carrying a matching tag, with their paths
+func (a *App) Search(query string, withTags bool) ([]FolderItem, error) {
+	if a.stor == nil {
+		return nil, errVaultLocked
+	}
+
+	results, err := a.stor.Search(query, withTags)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]interface{}, len(results))
+	for i, r := range results {
+		entries[i] = r.Entry
+	}
+	items := folderItems(a.stor, entries, a.selfID())
+	for i := range items {
+		items[i].Path = results[i].Path
+	}
+	return items, nil
+}
+
+// DeleteFolder moves a folder and everything in it to the trash
+func (a *App) DeleteFolder(folderID string) error {
+	if a.stor == nil {
+		return errVaultLocked
+	}
+	if err := a.checkWritable(); err != nil {
+		return err
+	}
+
+	intent := a.beginIntent("Delete folder " + a.folderName(folderID))
+	removed, added, err := a.stor.TrashFolder(storage.FolderID(folderID))
+	if err != nil {
+		intent.Done(err)
+		return err
+	}
+	a.publishEntries("ADD", []*database.DataEntry{added})
+	a.publishEntries("DELETE", []*database.DataEntry{removed})
+	intent.Done(nil)
+	return nil
+}
+
+// GetTrash returns the trashed files and folders, most recently trashed first
+func (a *App) GetTrash() ([]TrashItemInfo, error) {
+	if a.stor == nil {
+		return nil, errVaultLocked
+	}
+
+	items, err := a.stor.ListTrash()
+	if err != nil {
+		return nil, err
+	}
+	retention := storage.TrashRetention(a.db)
+	result := make([]TrashItemInfo, 0, len(items))
+	for _, item := range items {
+		result = append(result, TrashItemInfo{
+			ID:          hex.EncodeToString(item.Hash),
+			Type:        string(item.Type),
+			Name:        item.Name,
+			FolderID:    string(item.FolderID),
+			Size:        item.Size,
+			TrashedAtMs: item.TrashedAt.UnixMilli(),
+			ExpiresAtMs: item.TrashedAt.Add(retention).UnixMilli(),
+		})
+	}
+	return result, nil
+}
+
+// RestoreFromTrash puts a trashed entry back where it was deleted from, or
+// into the root folder if that folder is gone
+func (a *App) RestoreFromTrash(id string) error {
+	if a.stor == nil {
+		return errVaultLocked
+	}
+	if err := a.checkWritable(); err != nil {
+		return err
+	}
+	hash, err := hex.DecodeString(id)
+	if err != nil {
+		return newAppError(ErrCodeInvalidArgument, "invalid trash id: %w", err)
+	}
+
+	intent := a.beginIntent("Restore from trash")
+	removed, added, err := a.stor.RestoreFromTrash(hash)
+	if err != nil {
+		intent.Done(err)
+		return err
+	}
+	a.publishEntries("ADD", []*database.DataEntry{added})
+	a.publishEntries("DELETE", []*database.DataEntry{removed})
+	intent.Done(nil)
+	return nil
+}
+
+// EmptyTrash permanently deletes everything in the trash
+func (a *App) EmptyTrash() error {
+	if a.stor == nil {
+		return errVaultLocked
+	}
+	if err := a.checkWritable(); err != nil {
+		return err
+	}
+
+	intent := a.beginIntent("Empty trash")
+	entries, err := a.stor.EmptyTrash()
+	a.publishEntries("DELETE", entries)
+	intent.Done(err)
+	return err
+}
+
+// GetTrashRetentionDays returns how many days trashed entries are kept
+func (a *App) GetTrashRetentionDays() int {
+	return int(storage.TrashRetention(a.db) / (24 * time.Hour))
+}
+
+// SetTrashRetentionDays changes how many days trashed entries are kept, 0 for the default
+func (a *App) SetTrashRetentionDays(days int) error {
+	if days < 0 {
+		return newAppError(ErrCodeInvalidArgument, "retention must not be negative")
+	}
+	return a.db.SetTrashRetention(time.Duration(days) * 24 * time.Hour)
+}
+
+// MigrateStorage moves the blobs and the database to dir, sending
+// "migrate-progress" events, and reopens the vault from there. The node goes
+// offline during the move and comes back on either location.
+func (a *App) MigrateStorage(dir string) (int, error) {
+	if a.db == nil {
+		return 0, errNotInitialized
+	}
+	if a.core != nil {
+		if err := a.core.SavePeerstore(); err != nil {
+			fmt.Println("Warning: Failed to save peerstore:", err)
+		}
+		a.core.Close()
+		a.core, a.stor = nil, nil
+	}
+
+	moved, err := storage.MigrateStorage(a.db, dir, func(p storage.MigrateProgress) {
+		runtime.EventsEmit(a.ctx, "migrate-progress", MigrateProgressInfo{Stage: p.Stage, Done: p.Done, Total: p.Total})
+	})
+	if err == nil {
+		a.db = database.Create()
+	}
+	a.initializeCore()
+	return moved, err
+}
+
+// checkWritable refuses edits while the master has frozen the vault
+func (a *App) checkWritable() error {
+	if a.core == nil {
+		return nil
+	}
+	return a.core.CheckWritable()
+}
+
+// publishEntries publishes a data update for each entry if this is the master
+func (a *App) publishEntries(action string, entries []*database.DataEntry) {
+	if a.core == nil || !a.core.IsMaster() {
+		return
+	}
+	note := a.takeChangeNote()
+	for _, entry := range entries {
+		if err := a.core.PublishDataUpdate(action, entry.Key, entry.Value, entry.Size, entry.Hash, note); err != nil {
+			fmt.Println("Warning: Failed to publish data update:", err)
+		}
+	}
+}
+
+// beginIntent records an operation in the master's intent log before it
+// runs, see core.BeginIntent. The returned intent is nil, and Done a no-op,
+// on replicas.
+func (a *App) beginIntent(summary string) *core.Intent {
+	if a.core == nil {
+		return nil
+	}
+	return a.core.BeginIntent(summary)
+}
+
+// publishModify publishes a MODIFY update replacing one entry with another, if this node is the master
+func (a *App) publishModify(removed, added *database.DataEntry) {
+	if a.core == nil || !a.core.IsMaster() {
+		return
+	}
+	if err := a.core.PublishModifyUpdate(removed, added, a.takeChangeNote()); err != nil {
+		fmt.Println("Warning: Failed to publish data update:", err)
+	}
+}
+
+// publishBatch publishes a BATCH update adding and deleting entries together, if this node is the master
+func (a *App) publishBatch(added, deleted []*database.DataEntry) {
+	if a.core == nil || !a.core.IsMaster() {
+		return
+	}
+	if err := a.core.PublishBatchUpdate(added, deleted, a.takeChangeNote()); err != nil {
+		fmt.Println("Warning: Failed to publish data update:", err)
+	}
+}
+
+// publishSubtree publishes a BATCH update for a renamed or moved folder, if this node is the master
+func (a *App) publishSubtree(change *storage.SubtreeChange) {
+	if a.core == nil || !a.core.IsMaster() {
+		return
+	}
+	if err := a.core.PublishSubtreeUpdate(change, a.takeChangeNote()); err != nil {
+		fmt.Println("Warning: Failed to publish data update:", err)
+	}
+}
+
+// GetOrphans returns entries that can't be reached from the root because their parent folder is gone
+func (a *App) GetOrphans() ([]OrphanInfo, error) {
+	if a.stor == nil {
+		return nil, errVaultLocked
+	}
+
+	orphans, err := a.stor.FindOrphans()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]OrphanInfo, 0, len(orphans))
+	for _, o := range orphans {
+		result = append(result, OrphanInfo{
+			ID:            hex.EncodeToString(o.Hash),
+			Type:          string(o.Type),
+			Name:          o.Name,
+			MissingParent: string(o.MissingParent),
+			Size:          o.Size,
+		})
+	}
+	return result, nil
+}
+
+// ReattachOrphan moves an orphaned entry back under the root folder
+func (a *App) ReattachOrphan(id string) error {
+	if a.stor == nil {
+		return errVaultLocked
+	}
+	if err := a.checkWritable(); err != nil {
+		return err
+	}
+	hash, err := hex.DecodeString(id)
+	if err != nil {
+		return newAppError(ErrCodeInvalidArgument, "invalid orphan id: %w", err)
+	}
+
+	removed, added, err := a.stor.ReattachOrphan(hash)
+	if err != nil {
+		return err
+	}
+	a.publishEntries("ADD", []*database.DataEntry{added})
+	a.publishEntries("DELETE", []*database.DataEntry{removed})
+	return nil
+}
+
+// PurgeOrphan permanently deletes an orphaned entry and anything beneath it
+func (a *App) PurgeOrphan(id string) error {
+	if a.stor == nil {
+		return errVaultLocked
+	}
+	if err := a.checkWritable(); err != nil {
+		return err
+	}
+	hash, err := hex.DecodeString(id)
+	if err != nil {
+		return newAppError(ErrCodeInvalidArgument, "invalid orphan id: %w", err)
+	}
+
+	entries, err := a.stor.PurgeOrphan(hash)
+	a.publishEntries("DELETE", entries)
+	return err
+}
+
+// GetFolderPath returns the path segments for breadcrumb navigation
+func (a *App) GetFolderPath(folderID string) ([]PathSegment, error) {
+	if a.stor == nil {
+		return nil, errVaultLocked
+	}
+
+	root := PathSegment{Name: "/", FolderID: string(storage.RootFolderID)}
+	if storage.FolderID(folderID).IsRoot() {
+		return []PathSegment{root}, nil
+	}
+
+	// Build path by traversing parent folders
+	path := []PathSegment{}
+	currentID := storage.FolderID(folderID)
+
+	for !currentID.IsRoot() {
+		folder, err := a.getFolderByID(currentID)
+		if err != nil {
+			break
+		}
+		path = append([]PathSegment{{Name: folder.Name, FolderID: string(folder.FolderID)}}, path...)
+		currentID = folder.ParentFolderID
+	}
+
+	// Add root at the beginning
+	path = append([]PathSegment{root}, path...)
+
+	return path, nil
+}
+
+// folderName names a folder in operation summaries, by its ID if it isn't found
+func (a *App) folderName(folderID string) string {
+	folder, err := a.stor.GetFolder(storage.FolderID(folderID))
+	if err != nil {
+		return folderID
+	}
+	return folder.Name
+}
+
+// getFolderByID finds a folder by its ID
+func (a *App) getFolderByID(folderID storage.FolderID) (*storage.FolderEntry, error) {
+	return a.stor.GetFolder(folderID)
 }
 
 // GetStorageStats returns entry count and total size stored on this node
@@ -439,6 +1720,80 @@ func (a *App) GetStorageStats() StorageStats {
 	return StorageStats{EntryCount: count, TotalSize: size}
 }
 
+// vaultStatsHistoryLimit bounds the snapshots returned for growth charts
+const vaultStatsHistoryLimit = 500
+
+// GetVaultStats returns the latest vault status snapshot published by the master, or nil.
+// Available on every node, including locked replicas.
+func (a *App) GetVaultStats() *VaultStatsInfo {
+	latest := a.db.GetLatestVaultStats()
+	if latest == nil {
+		return nil
+	}
+	info := newVaultStatsInfo(*latest)
+	return &info
+}
+
+// GetVaultStatsHistory returns recent vault status snapshots, oldest first
+func (a *App) GetVaultStatsHistory() []VaultStatsInfo {
+	history := a.db.GetVaultStatsHistory(vaultStatsHistoryLimit)
+	result := make([]VaultStatsInfo, len(history))
+	for i, s := range history {
+		result[len(history)-1-i] = newVaultStatsInfo(s)
+	}
+	return result
+}
+
+func newVaultStatsInfo(s database.DBVaultStats) VaultStatsInfo {
+	return VaultStatsInfo{
+		UpdateID:     s.UpdateID,
+		TimestampMs:  s.Timestamp * 1000,
+		FileCount:    s.FileCount,
+		FolderCount:  s.FolderCount,
+		LogicalBytes: s.LogicalBytes,
+		StoredBytes:  s.StoredBytes,
+	}
+}
+
+// GetNodeStatus returns entry counts, replication progress and the last applied update
+func (a *App) GetNodeStatus() NodeStatusInfo {
+	var status core.NodeStatus
+	if a.core != nil {
+		status = a.core.Status()
+	} else {
+		status = core.ReadNodeStatus(a.db)
+	}
+
+	info := NodeStatusInfo{
+		HasVaultKey:     status.HasVaultKey,
+		Entries:         status.Entries,
+		EncryptedBytes:  status.EncryptedBytes,
+		FilesComplete:   status.FilesComplete,
+		FilesTotal:      status.FilesTotal,
+		BytesStored:     status.BytesStored,
+		BytesReferenced: status.BytesReferenced,
+		LastUpdateID:    status.LastUpdateID,
+		LastUpdateType:  status.LastUpdateType,
+		Quarantined:     status.Quarantined,
+		CorruptBlobs:    status.CorruptBlobs,
+		BlobBytes:       status.BlobBytes,
+		Quota:           status.Quota,
+	}
+	if status.LastUpdateID > 0 {
+		info.LastUpdateTimeMs = status.LastUpdateTime.UnixMilli()
+	}
+	info.Vault = a.GetVaultStats()
+	return info
+}
+
+// selfID returns this node's full peer ID, "" without a running node
+func (a *App) selfID() string {
+	if a.core == nil {
+		return ""
+	}
+	return a.core.GetNodeID()
+}
+
 // GetNodeID returns this node's truncated peer ID
 func (a *App) GetNodeID() string {
 	if a.core == nil {
@@ -449,17 +1804,31 @@ func (a *App) GetNodeID() string {
 
 // GetPeers returns all connected peers with their status
 func (a *App) GetPeers() ([]PeerInfo, error) {
-	if a.core == nil {
-		return []PeerInfo{}, nil
+	// Without a running node, peers are known from the database but their status is not
+	var peerIDs []string
+	if a.core != nil {
+		peerIDs = a.core.GetOtherPeerIDs()
+	} else {
+		peerIDs = a.db.GetAllPeerIDs()
 	}
-	peerIDs := a.core.GetOtherPeerIDs()
 	result := make([]PeerInfo, 0, len(peerIDs))
+	var statuses map[string]core.DeviceStatus
+	if a.core != nil && a.core.IsMaster() {
+		statuses = a.core.DeviceStatuses()
+	}
+	labels := make(map[string]string)
+	for _, p := range a.db.GetAllPeers() {
+		labels[p.PeerID] = p.Label
+	}
 
 	for _, peerID := range peerIDs {
 		info := PeerInfo{
 			PeerID:   truncatePeerID(peerID),
+			ID:       peerID,
+			Label:    labels[peerID],
 			IsOnline: false,
-			LastSeen: "Unknown",
+			Status:   PeerStatusUnknown,
+			LastSeen: a.catalog.T("last_seen.unknown"),
 		}
 
 		// Check if peer is connected via core
@@ -467,8 +1836,20 @@ func (a *App) GetPeers() ([]PeerInfo, error) {
 			isOnline, lastSeen := a.core.GetPeerStatus(peerID)
 			info.IsOnline = isOnline
 			if !lastSeen.IsZero() {
-				info.LastSeen = formatLastSeen(lastSeen)
+				info.Status = PeerStatusOffline
+				info.LastSeen = formatLastSeen(a.catalog, lastSeen)
+				info.LastSeenMs = lastSeen.UnixMilli()
 			}
+			if isOnline {
+				info.Status = PeerStatusOnline
+			}
+			info.Path = a.core.GetPeerPath(peerID)
+		}
+		if status, ok := statuses[peerID]; ok {
+			info.FreeBytes = status.FreeBytes
+			info.CapBytes = status.CapBytes
+			info.StoredBytes = status.StoredBytes
+			info.StatusMs = status.Timestamp * 1000
 		}
 
 		result = append(result, info)
@@ -477,21 +1858,219 @@ func (a *App) GetPeers() ([]PeerInfo, error) {
 	return result, nil
 }
 
-// RemovePeer removes a peer from the network
+// RemovePeer removes a peer from the network. It is restored with its label
+// if it binds again.
 func (a *App) RemovePeer(peerID string) error {
-	return a.db.RemovePeer(peerID)
+	if a.core != nil {
+		return a.core.RemovePeer(peerID)
+	}
+	return a.db.RetirePeer(peerID, false)
+}
+
+// BanPeer removes a peer from the network and refuses to bind it again
+func (a *App) BanPeer(peerID string) error {
+	if a.core != nil {
+		return a.core.BanPeer(peerID)
+	}
+	return a.db.RetirePeer(peerID, true)
+}
+
+// GetFormerPeers lists the removed devices, most recently removed first
+func (a *App) GetFormerPeers() []FormerPeerInfo {
+	former := a.db.GetFormerPeers()
+	result := make([]FormerPeerInfo, len(former))
+	for i, p := range former {
+		result[i] = FormerPeerInfo{
+			PeerID:    truncatePeerID(p.PeerID),
+			ID:        p.PeerID,
+			Label:     p.Label,
+			Banned:    p.Banned,
+			RemovedAt: p.RemovedAt.Unix(),
+		}
+	}
+	return result
+}
+
+// RestorePeer adds a removed device back without binding it again, for
+// devices that kept their copy of the vault
+func (a *App) RestorePeer(peerID string) error {
+	if a.core == nil {
+		return errNotInitialized
+	}
+	return a.core.RestorePeer(peerID)
+}
+
+// ForgetPeer drops the record of a removed device, lifting a ban
+func (a *App) ForgetPeer(peerID string) error {
+	return a.db.ForgetFormerPeer(peerID)
 }
 
 // BindPeerWithPhrase binds a new peer using their 4-word phrase (master only)
+// and waits for the binding to end, see StartPeerBinding
 func (a *App) BindPeerWithPhrase(phrase string) error {
+	done := make(chan error, 1)
+	_, err := a.startPeerBinding(phrase, func(p core.BindProgress) {
+		switch p.Stage {
+		case p2p.BindDone:
+			done <- nil
+		case p2p.BindFailed:
+			done <- p.Err
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return <-done
+}
+
+// StartPeerBinding starts binding a new peer using their 4-word phrase
+// (master only) and returns the binding ID. Several devices can be bound at
+// the same time; each reports its stages as "bind-progress" events.
+func (a *App) StartPeerBinding(phrase string) (string, error) {
+	return a.startPeerBinding(phrase, nil)
+}
+
+func (a *App) startPeerBinding(phrase string, onProgress func(core.BindProgress)) (string, error) {
 	if a.core == nil {
-		return fmt.Errorf("core not initialized")
+		return "", errNotInitialized
 	}
 	if a.keys == nil || a.keys.MasterPrivateKey == nil {
-		return fmt.Errorf("only master nodes can bind new peers")
+		return "", newAppError(ErrCodeNotMaster, "%w can bind new peers", core.ErrNotMaster)
+	}
+
+	id, err := a.core.StartPeerBinding(context.Background(), phrase, func(id string, p core.BindProgress) {
+		info := BindProgressInfo{BindingID: id, Stage: string(p.Stage), PeerID: p.PeerID}
+		if p.Err != nil {
+			info.Error = p.Err.Error()
+			info.Code = string(classifyError(p.Err))
+		}
+		if p.Restored != nil {
+			info.Restored = true
+			info.Label = p.Restored.Label
+		}
+		runtime.EventsEmit(a.ctx, "bind-progress", info)
+		if onProgress != nil {
+			onProgress(p)
+		}
+	})
+	if err != nil {
+		return "", newAppError(ErrCodeInvalidArgument, "%w", err)
+	}
+	return id, nil
+}
+
+// CancelPeerBinding stops a binding of a new peer in progress
+func (a *App) CancelPeerBinding(bindingID string) {
+	if a.core != nil {
+		a.core.CancelPeerBinding(bindingID)
+	}
+}
+
+// GetPendingBindings lists the bindings of new peers in progress, oldest first
+func (a *App) GetPendingBindings() []PendingBindingInfo {
+	if a.core == nil {
+		return []PendingBindingInfo{}
+	}
+	bindings := a.core.PendingBindings()
+	list := make([]PendingBindingInfo, len(bindings))
+	for i, b := range bindings {
+		list[i] = PendingBindingInfo{
+			BindingID: b.ID,
+			Phrase:    b.Phrase,
+			Stage:     string(b.Stage),
+			PeerID:    b.PeerID,
+			StartedAt: b.StartedAt.Unix(),
+		}
+	}
+	return list
+}
+
+// RunConnectivityReport runs a connectivity beacon and saves the report for
+// attaching to bug reports. Returns the saved path, or "" if cancelled.
+func (a *App) RunConnectivityReport() (string, error) {
+	var report *core.ConnectivityReport
+	var err error
+	if a.core != nil {
+		report, err = a.core.RunBeacon(a.ctx, core.DefaultBeaconWindow)
+	} else {
+		report, err = core.RunStandaloneBeacon(a.ctx, a.db, core.DefaultBeaconWindow)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	destPath, err := runtime.SaveFileDialog(a.ctx, runtime.SaveDialogOptions{
+		Title:           "Save Connectivity Report",
+		DefaultFilename: "endershare-connectivity.json",
+	})
+	if err != nil {
+		return "", err
+	}
+	if destPath == "" {
+		return "", nil // User cancelled
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return destPath, os.WriteFile(destPath, data, 0644)
+}
+
+// ExportNetworkMap saves a signed map of all peers for disaster recovery (master only)
+func (a *App) ExportNetworkMap() error {
+	if a.core == nil {
+		return errNotInitialized
+	}
+
+	signed, err := a.core.ExportNetworkMap()
+	if err != nil {
+		return err
+	}
+
+	destPath, err := runtime.SaveFileDialog(a.ctx, runtime.SaveDialogOptions{
+		Title:           "Export Network Map",
+		DefaultFilename: "endershare-network.json",
+	})
+	if err != nil {
+		return err
+	}
+	if destPath == "" {
+		return nil // User cancelled
+	}
+
+	data, err := json.MarshalIndent(signed, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(destPath, data, 0600)
+}
+
+// ImportNetworkMap restores peers from a signed network map and returns how many were imported
+func (a *App) ImportNetworkMap() (int, error) {
+	if a.core == nil {
+		return 0, errNotInitialized
+	}
+
+	filePath, err := runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
+		Title: "Select Network Map",
+	})
+	if err != nil {
+		return 0, err
+	}
+	if filePath == "" {
+		return 0, nil // User cancelled
 	}
 
-	return a.core.BindNewPeer(phrase)
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return 0, err
+	}
+	var signed core.SignedNetworkMap
+	if err := json.Unmarshal(data, &signed); err != nil {
+		return 0, newAppError(ErrCodeInvalidArgument, "invalid network map file: %w", err)
+	}
+	return a.core.ImportNetworkMap(signed)
 }
 
 // IsMaster returns true if this is a master node
@@ -499,6 +2078,124 @@ func (a *App) IsMaster() bool {
 	return a.keys != nil && a.keys.MasterPrivateKey != nil
 }
 
+// PublishRelease opens a file picker and publishes the selected binary as a release (master only)
+func (a *App) PublishRelease(version string, notes string) error {
+	if a.core == nil {
+		return errNotInitialized
+	}
+	if !a.IsMaster() {
+		return newAppError(ErrCodeNotMaster, "%w can publish releases", core.ErrNotMaster)
+	}
+
+	binaryPath, err := runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
+		Title: "Select Release Binary",
+	})
+	if err != nil {
+		return err
+	}
+	if binaryPath == "" {
+		return nil // User cancelled
+	}
+
+	_, err = a.core.PublishRelease(binaryPath, version, "", "", notes)
+	return err
+}
+
+// GetVaultPolicy returns the vault policy in effect on this node
+func (a *App) GetVaultPolicy() (*VaultPolicyInfo, error) {
+	if a.core == nil {
+		return nil, errNotInitialized
+	}
+	p := a.core.GetPolicy()
+	blocked := p.BlockedExtensions
+	if blocked == nil {
+		blocked = []string{}
+	}
+	return &VaultPolicyInfo{MaxFileSize: p.MaxFileSize, MaxVaultSize: p.MaxVaultSize, BlockedExtensions: blocked}, nil
+}
+
+// SetVaultPolicy publishes a new vault policy to all replicas (master only)
+func (a *App) SetVaultPolicy(policy VaultPolicyInfo) error {
+	if a.core == nil {
+		return errNotInitialized
+	}
+	if !a.IsMaster() {
+		return newAppError(ErrCodeNotMaster, "%w can publish vault policies", core.ErrNotMaster)
+	}
+	if policy.MaxFileSize < 0 || policy.MaxVaultSize < 0 {
+		return newAppError(ErrCodeInvalidArgument, "policy limits can't be negative")
+	}
+	return a.core.PublishPolicy(storage.Policy{
+		MaxFileSize:       policy.MaxFileSize,
+		MaxVaultSize:      policy.MaxVaultSize,
+		BlockedExtensions: policy.BlockedExtensions,
+	})
+}
+
+// GetVaultFreeze returns the freeze state in effect on this node
+func (a *App) GetVaultFreeze() (*VaultFreezeInfo, error) {
+	if a.core == nil {
+		return nil, errNotInitialized
+	}
+	f := a.core.GetFreeze()
+	info := &VaultFreezeInfo{Frozen: f.Frozen, Reason: f.Reason, IsMaster: a.IsMaster()}
+	if f.Frozen {
+		info.SinceMs = f.Since * 1000
+	}
+	return info, nil
+}
+
+// SetVaultFreeze freezes or unfreezes the vault on every node (master only)
+func (a *App) SetVaultFreeze(frozen bool, reason string) error {
+	if a.core == nil {
+		return errNotInitialized
+	}
+	if !a.IsMaster() {
+		return newAppError(ErrCodeNotMaster, "%w can freeze the vault", core.ErrNotMaster)
+	}
+	if err := a.core.PublishFreeze(frozen, reason); err != nil {
+		return err
+	}
+	runtime.EventsEmit(a.ctx, "data-updated")
+	return nil
+}
+
+// GetStagedRelease returns the release waiting for confirmation, or nil
+func (a *App) GetStagedRelease() *ReleaseInfo {
+	if a.core == nil {
+		return nil
+	}
+	manifest := a.core.GetStagedRelease()
+	if manifest == nil {
+		return nil
+	}
+	return &ReleaseInfo{
+		Version:     manifest.Version,
+		Notes:       manifest.Notes,
+		Size:        manifest.Size,
+		PublishedMs: manifest.Published * 1000,
+	}
+}
+
+// ApplyStagedRelease installs the staged release after the user has confirmed it
+func (a *App) ApplyStagedRelease() error {
+	if a.core == nil {
+		return errNotInitialized
+	}
+	_, err := a.core.ApplyStagedRelease()
+	return err
+}
+
+// GetReleaseChannelEnabled reports whether this node stages releases from the master
+func (a *App) GetReleaseChannelEnabled() bool {
+	return a.db.GetReleaseChannelEnabled()
+}
+
+// SetReleaseChannelEnabled opts this node in or out of the release channel
+func (a *App) SetReleaseChannelEnabled(enabled bool) error {
+	return a.db.SetReleaseChannelEnabled(enabled)
+}
+
 // Helper functions
 
 func truncatePeerID(peerID string) string {
@@ -508,32 +2205,225 @@ func truncatePeerID(peerID string) string {
 	return peerID
 }
 
-func formatLastSeen(t time.Time) string {
+func formatLastSeen(c *i18n.Catalog, t time.Time) string {
 	diff := time.Since(t)
 	switch {
 	case diff < time.Minute:
-		return "Just now"
+		return c.T("last_seen.just_now")
 	case diff < time.Hour:
-		mins := int(diff.Minutes())
-		if mins == 1 {
-			return "1 minute ago"
-		}
-		return fmt.Sprintf("%d minutes ago", mins)
+		return c.Plural("last_seen.minutes", int(diff.Minutes()))
 	case diff < 24*time.Hour:
-		hours := int(diff.Hours())
-		if hours == 1 {
-			return "1 hour ago"
-		}
-		return fmt.Sprintf("%d hours ago", hours)
+		return c.Plural("last_seen.hours", int(diff.Hours()))
 	default:
-		days := int(diff.Hours() / 24)
-		if days == 1 {
-			return "1 day ago"
+		return c.Plural("last_seen.days", int(diff.Hours()/24))
+	}
+}
+
+// locale returns the configured locale, or the system locale if none is set
+func (a *App) locale() string {
+	if locale := a.db.GetLocale(); locale != "" {
+		return locale
+	}
+	return i18n.SystemLocale()
+}
+
+// GetLocale returns the active display locale
+func (a *App) GetLocale() string {
+	return a.catalog.Locale()
+}
+
+// GetAvailableLocales returns the locales with a built-in message catalog
+func (a *App) GetAvailableLocales() []string {
+	return i18n.Available()
+}
+
+// SetLocale changes the display locale; an empty locale follows the system
+func (a *App) SetLocale(locale string) error {
+	if locale != "" && i18n.Normalize(locale) == "" {
+		return newAppError(ErrCodeInvalidArgument, "unsupported locale: %s", locale)
+	}
+	if err := a.db.SetLocale(i18n.Normalize(locale)); err != nil {
+		return err
+	}
+	a.catalog = i18n.Load(a.locale())
+	runtime.EventsEmit(a.ctx, "locale-changed", a.catalog.Locale())
+	return nil
+}
+
+// GetMessages returns the active message catalog. Keys "error.<code>" give a
+// localized summary for each ErrorCode.
+func (a *App) GetMessages() map[string]string {
+	return a.catalog.Messages()
+}
+
+// StartGuestViewer serves a read-only HTTPS viewer for the given folders on the LAN
+func (a *App) StartGuestViewer(folderIDs []string) (*ViewerInfo, error) {
+	if a.stor == nil {
+		return nil, errVaultLocked
+	}
+	if len(folderIDs) == 0 {
+		return nil, newAppError(ErrCodeInvalidArgument, "select at least one folder to share")
+	}
+
+	a.viewerMutex.Lock()
+	defer a.viewerMutex.Unlock()
+
+	if a.viewer != nil {
+		a.viewer.Stop()
+		a.viewer = nil
+	}
+
+	folders := make([]storage.FolderID, len(folderIDs))
+	for i, id := range folderIDs {
+		folders[i] = storage.FolderID(id)
+	}
+
+	viewer, err := api.StartViewer(a.db, a.stor, folders, api.DefaultViewerAddr)
+	if err != nil {
+		return nil, err
+	}
+	a.viewer = viewer
+
+	return &ViewerInfo{
+		URL:         viewer.URL,
+		Username:    api.GuestUser,
+		Password:    viewer.Password,
+		Fingerprint: viewer.Fingerprint,
+	}, nil
+}
+
+// StopGuestViewer stops the running guest viewer, if any
+func (a *App) StopGuestViewer() error {
+	a.viewerMutex.Lock()
+	defer a.viewerMutex.Unlock()
+
+	if a.viewer == nil {
+		return nil
+	}
+	err := a.viewer.Stop()
+	a.viewer = nil
+	return err
+}
+
+// GetSyncRounds returns the most recent sync rounds, newest first
+func (a *App) GetSyncRounds() []SyncRoundInfo {
+	if a.core == nil {
+		return []SyncRoundInfo{}
+	}
+	rounds := a.core.GetSyncRounds()
+	result := make([]SyncRoundInfo, 0, len(rounds))
+	for i := len(rounds) - 1; i >= 0; i-- {
+		result = append(result, newSyncRoundInfo(rounds[i]))
+	}
+	return result
+}
+
+// protocolErrorLimit bounds the errors shown in the diagnostics panel
+const protocolErrorLimit = 50
+
+// GetProtocolErrors returns the most recent protocol errors of every peer,
+// newest first
+func (a *App) GetProtocolErrors() []ProtocolErrorInfo {
+	if a.core == nil {
+		return []ProtocolErrorInfo{}
+	}
+	entries := a.core.ProtocolErrors("", protocolErrorLimit)
+	result := make([]ProtocolErrorInfo, 0, len(entries))
+	for _, e := range entries {
+		result = append(result, ProtocolErrorInfo{
+			Peer:        truncatePeerID(e.PeerID),
+			Protocol:    e.Protocol,
+			Phase:       e.Phase,
+			Error:       e.Error,
+			TimestampMs: e.Timestamp.UnixMilli(),
+		})
+	}
+	return result
+}
+
+// activityLimit bounds the updates read for the activity feed
+const activityLimit = 50
+
+// GetRecentChanges returns the latest data updates with their change notes,
+// newest first
+func (a *App) GetRecentChanges() ([]ChangeInfo, error) {
+	if a.core == nil {
+		return []ChangeInfo{}, nil
+	}
+	changes, err := a.core.RecentChanges(activityLimit)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]ChangeInfo, 0, len(changes))
+	for _, c := range changes {
+		result = append(result, ChangeInfo{
+			UpdateID:    c.UpdateID,
+			Action:      c.Action,
+			Entries:     c.Entries,
+			Note:        c.Note,
+			TimestampMs: c.Time.UnixMilli(),
+		})
+	}
+	return result, nil
+}
+
+// GetIntents returns the master's recent operations, newest first, with how
+// many of the other devices have applied each
+func (a *App) GetIntents() []IntentInfo {
+	if a.core == nil || !a.core.IsMaster() {
+		return []IntentInfo{}
+	}
+	labels := make(map[string]string)
+	for _, p := range a.db.GetAllPeers() {
+		labels[p.PeerID] = p.Label
+	}
+	intents := a.core.Intents(activityLimit)
+	result := make([]IntentInfo, 0, len(intents))
+	for _, in := range intents {
+		pending := make([]string, 0, len(in.Pending))
+		for _, id := range in.Pending {
+			name := labels[id]
+			if name == "" {
+				name = truncatePeerID(id)
+			}
+			pending = append(pending, name)
 		}
-		return fmt.Sprintf("%d days ago", days)
+		result = append(result, IntentInfo{
+			ID:        in.ID,
+			Summary:   in.Summary,
+			State:     in.State,
+			Error:     in.Error,
+			CreatedMs: in.Created.UnixMilli(),
+			Delivered: in.Delivered,
+			Total:     in.Total,
+			Pending:   pending,
+		})
+	}
+	return result
+}
+
+// ClearProtocolErrors empties the protocol error log
+func (a *App) ClearProtocolErrors() error {
+	if a.core == nil {
+		return errNotInitialized
 	}
+	return a.core.ClearProtocolErrors()
 }
 
-func parseJSON(data []byte, v interface{}) error {
-	return json.Unmarshal(data, v)
+func newSyncRoundInfo(round core.SyncRound) SyncRoundInfo {
+	return SyncRoundInfo{
+		UpdateID:         round.UpdateID,
+		Peer:             truncatePeerID(round.Peer),
+		Mode:             round.Mode,
+		Started:          round.Started.Format(time.RFC3339),
+		StartedMs:        round.Started.UnixMilli(),
+		DurationMs:       round.Duration.Milliseconds(),
+		BucketsCompared:  round.BucketsCompared,
+		BucketsDiffering: round.BucketsDiffering,
+		EntriesFetched:   round.EntriesFetched,
+		EntriesDeleted:   round.EntriesDeleted,
+		FilesDownloaded:  round.FilesDownloaded,
+		BytesMoved:       round.BytesMoved,
+		Error:            round.Error,
+	}
 }
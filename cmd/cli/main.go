@@ -3,18 +3,63 @@ package main
 import (
 	"fmt"
 	"os"
+	"slices"
 	"strings"
 
 	"github.com/notassigned/endershare/internal/core"
 )
 
 func main() {
+	// --json applies to every command that supports it, wherever it is given
+	if slices.Contains(os.Args[1:], "--json") {
+		core.SetJSONOutput(true)
+		os.Args = slices.DeleteFunc(os.Args, func(arg string) bool { return arg == "--json" })
+	}
+
 	if len(os.Args) < 2 {
 		fmt.Println("Usage: endershare <command> [arguments]")
 		fmt.Println("Commands:")
 		fmt.Println("  peer          Start a replica node (joins existing network)")
 		fmt.Println("  peer --init   Initialize a new master node")
 		fmt.Println("  bind <phrase> Authorize a new peer (master nodes only)")
+		fmt.Println("  release       Publish, stage and apply endershare releases")
+		fmt.Println("  viewer <ids>  Serve a read-only web viewer for folders on the LAN")
+		fmt.Println("  netmap        Export or import the signed peer network map")
+		fmt.Println("  config        Show or change local node settings")
+		fmt.Println("  status        Show stored entries, replication progress and last update")
+		fmt.Println("  ls [path]     List a vault folder, the root by default")
+		fmt.Println("  export        Export a vault file or folder to a local directory, or to a .zip or .tar archive")
+		fmt.Println("  peers         List the vault peers and their addresses")
+		fmt.Println("  log [count]   Show the most recent signed updates")
+		fmt.Println("  token         Issue, list or revoke scoped API tokens")
+		fmt.Println("  dropbox       Create upload-only folders and choose who may drop files")
+		fmt.Println("  drop          Send files to a drop box (designated peers only)")
+		fmt.Println("  beacon        Test DHT, relay and transport connectivity for bug reports")
+		fmt.Println("  receipts      Show the replication factor proven by receipts and storage proofs")
+		fmt.Println("  quarantine    List or release entries that failed verification")
+		fmt.Println("  policy        Show or change the vault's file size and type limits")
+		fmt.Println("  fixture       Fill the vault with synthetic files for load testing")
+		fmt.Println("  doctor        Show the per-peer protocol error log for debugging sync")
+		fmt.Println("  usage, du     Show stored bytes per folder against the storage quota")
+		fmt.Println("  search        Find files and folders by name or tag anywhere in the vault")
+		fmt.Println("  freeze        Freeze or unfreeze vault changes for maintenance (master only)")
+		fmt.Println("  tui           Run the node with a terminal view of sync, peers and folders")
+		fmt.Println("  alert         Send a test alert through the channels set with config alert-*")
+		fmt.Println("  add           Add local files to a vault folder, with a progress bar (master only)")
+		fmt.Println("  import        Extract a zip or tar archive into a vault folder (master only)")
+		fmt.Println("  report        Make a signed verification report now, or verify a report file")
+		fmt.Println("  sync-folders  Show or choose the folders each device replicates (master only)")
+		fmt.Println("  replication   Show or set which folders replicas download or keep on-demand (master only)")
+		fmt.Println("  pin, unpin    Keep files and folders stored on this node whatever else decides")
+		fmt.Println("  lock, unlock  List, check out or release files being edited on a device (master only to change)")
+		fmt.Println("  delivery      Show how far recent operations reached the other devices (master only)")
+		fmt.Println("  plan          Show or publish which devices hold which folders for the replication target (master only)")
+		fmt.Println("  archive       List, archive or restore files kept on an external disk instead of in the vault (master only)")
+		fmt.Println("  cold          Show or offload the blobs this node keeps in its S3 cold storage, see config cold-storage")
+		fmt.Println("  migrate <dir> Move the blobs and database to a new directory, verifying every copy")
+		fmt.Println("  adopt [dir]   Store verified encrypted blobs copied from another node instead of downloading them")
+		fmt.Println("Flags:")
+		fmt.Println("  --json        Print JSON instead of text (ls, status, peers, usage, log, doctor)")
 		return
 	}
 
@@ -39,6 +84,114 @@ func main() {
 		syncPhrase := strings.Join(os.Args[2:], " ")
 		core.BindMain(syncPhrase)
 
+	case "release":
+		core.ReleaseMain(os.Args[2:])
+
+	case "viewer":
+		core.ViewerMain(os.Args[2:])
+
+	case "netmap":
+		core.NetworkMapMain(os.Args[2:])
+
+	case "config":
+		core.ConfigMain(os.Args[2:])
+
+	case "status":
+		core.StatusMain()
+
+	case "ls":
+		core.LsMain(os.Args[2:])
+
+	case "export":
+		core.ExportMain(os.Args[2:])
+
+	case "peers":
+		core.PeersMain()
+
+	case "log":
+		core.LogMain(os.Args[2:])
+
+	case "token":
+		core.TokenMain(os.Args[2:])
+
+	case "dropbox":
+		core.DropBoxMain(os.Args[2:])
+
+	case "drop":
+		core.DropMain(os.Args[2:])
+
+	case "beacon":
+		core.BeaconMain(os.Args[2:])
+
+	case "receipts":
+		core.ReceiptsMain()
+
+	case "quarantine":
+		core.QuarantineMain(os.Args[2:])
+
+	case "policy":
+		core.PolicyMain(os.Args[2:])
+
+	case "fixture":
+		core.FixtureMain(os.Args[2:])
+
+	case "doctor":
+		core.DoctorMain(os.Args[2:])
+
+	case "usage", "du":
+		core.UsageMain()
+
+	case "search":
+		core.SearchMain(os.Args[2:])
+
+	case "freeze":
+		core.FreezeMain(os.Args[2:])
+
+	case "tui":
+		core.TuiMain(os.Args[2:])
+
+	case "alert":
+		core.AlertMain(os.Args[2:])
+
+	case "add":
+		core.AddMain(os.Args[2:])
+
+	case "import":
+		core.ImportMain(os.Args[2:])
+
+	case "report":
+		core.ReportMain(os.Args[2:])
+
+	case "sync-folders":
+		core.SyncFoldersMain(os.Args[2:])
+
+	case "replication":
+		core.ReplicationMain(os.Args[2:])
+
+	case "pin", "unpin":
+		core.PinMain(os.Args[2:], command == "pin")
+
+	case "lock", "unlock":
+		core.LockMain(os.Args[2:], command == "lock")
+
+	case "delivery":
+		core.DeliveryMain(os.Args[2:])
+
+	case "plan":
+		core.PlanMain(os.Args[2:])
+
+	case "archive":
+		core.ArchiveMain(os.Args[2:])
+
+	case "cold":
+		core.ColdMain(os.Args[2:])
+
+	case "migrate":
+		core.MigrateMain(os.Args[2:])
+
+	case "adopt":
+		core.AdoptMain(os.Args[2:])
+
 	default:
 		fmt.Println("Unknown command:", command)
 		fmt.Println("Run 'endershare' for usage information")
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/notassigned/endershare/internal/core"
+	"github.com/notassigned/endershare/internal/p2p"
+	"github.com/notassigned/endershare/internal/storage"
+)
+
+// ErrorCode identifies a class of failure the frontend can branch on.
+// Codes are stable; messages are for display and may change.
+type ErrorCode string
+
+const (
+	ErrCodeVaultLocked     ErrorCode = "VAULT_LOCKED"
+	ErrCodeNotInitialized  ErrorCode = "NOT_INITIALIZED"
+	ErrCodeNotMaster       ErrorCode = "NOT_MASTER"
+	ErrCodeNotFound        ErrorCode = "NOT_FOUND"
+	ErrCodeAlreadyExists   ErrorCode = "ALREADY_EXISTS"
+	ErrCodeInvalidArgument ErrorCode = "INVALID_ARGUMENT"
+	ErrCodeMnemonic        ErrorCode = "MNEMONIC_MISMATCH"
+	ErrCodeVaultMismatch   ErrorCode = "VAULT_MISMATCH"
+	ErrCodePolicy          ErrorCode = "POLICY_VIOLATION"
+	ErrCodeVaultFrozen     ErrorCode = "VAULT_FROZEN"
+	ErrCodeFileLocked      ErrorCode = "FILE_LOCKED"
+	ErrCodeNetwork         ErrorCode = "NETWORK"
+	ErrCodeCancelled       ErrorCode = "CANCELLED"
+	ErrCodeIO              ErrorCode = "IO"
+	ErrCodeInternal        ErrorCode = "INTERNAL"
+)
+
+// AppError is the shape every binding error is serialized to
+type AppError struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+	err     error
+}
+
+func (e *AppError) Error() string {
+	return e.Message
+}
+
+func (e *AppError) Unwrap() error {
+	return e.err
+}
+
+func newAppError(code ErrorCode, format string, args ...any) *AppError {
+	err := fmt.Errorf(format, args...)
+	return &AppError{Code: code, Message: err.Error(), err: errors.Unwrap(err)}
+}
+
+var (
+	errVaultLocked    = &AppError{Code: ErrCodeVaultLocked, Message: "vault is locked"}
+	errNotInitialized = &AppError{Code: ErrCodeNotInitialized, Message: "core not initialized"}
+)
+
+// formatError converts any error returned by a binding into an AppError so
+// the frontend always receives {code, message}. Errors that were not created
+// with a code are classified from the sentinel errors they wrap.
+func formatError(err error) any {
+	var appErr *AppError
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+	return &AppError{Code: classifyError(err), Message: err.Error(), err: err}
+}
+
+func classifyError(err error) ErrorCode {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, storage.ErrNotFound), errors.Is(err, os.ErrNotExist):
+		return ErrCodeNotFound
+	case errors.Is(err, storage.ErrNameTaken):
+		return ErrCodeAlreadyExists
+	case errors.Is(err, storage.ErrInvalidName):
+		return ErrCodeInvalidArgument
+	case errors.Is(err, core.ErrNotMaster):
+		return ErrCodeNotMaster
+	case errors.Is(err, p2p.ErrVaultMismatch):
+		return ErrCodeVaultMismatch
+	case errors.Is(err, storage.ErrPolicyViolation), errors.Is(err, core.ErrPeerBanned):
+		return ErrCodePolicy
+	case errors.Is(err, core.ErrVaultFrozen):
+		return ErrCodeVaultFrozen
+	case errors.Is(err, storage.ErrFileLocked):
+		return ErrCodeFileLocked
+	case errors.Is(err, context.Canceled):
+		return ErrCodeCancelled
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr), errors.Is(err, storage.ErrNotLocal):
+		return ErrCodeNetwork
+	case errors.Is(err, os.ErrPermission), errors.Is(err, os.ErrExist):
+		return ErrCodeIO
+	default:
+		return ErrCodeInternal
+	}
+}
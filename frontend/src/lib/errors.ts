@@ -0,0 +1,41 @@
+// Binding errors are rejected as { code, message } (see errors.go)
+export type ErrorCode =
+  | 'VAULT_LOCKED'
+  | 'NOT_INITIALIZED'
+  | 'NOT_MASTER'
+  | 'NOT_FOUND'
+  | 'ALREADY_EXISTS'
+  | 'INVALID_ARGUMENT'
+  | 'MNEMONIC_MISMATCH'
+  | 'VAULT_MISMATCH'
+  | 'POLICY_VIOLATION'
+  | 'VAULT_FROZEN'
+  | 'FILE_LOCKED'
+  | 'NETWORK'
+  | 'CANCELLED'
+  | 'IO'
+  | 'INTERNAL';
+
+export interface AppError {
+  code: ErrorCode;
+  message: string;
+}
+
+export function isAppError(err: unknown): err is AppError {
+  return typeof err === 'object' && err !== null && 'code' in err && 'message' in err;
+}
+
+// errorCode returns the code of a binding error, or INTERNAL for anything else
+export function errorCode(err: unknown): ErrorCode {
+  return isAppError(err) ? err.code : 'INTERNAL';
+}
+
+// errorSummary returns the localized summary for an error's code
+export function errorSummary(err: unknown, messages: Record<string, string>): string {
+  return messages['error.' + errorCode(err)] ?? errorText(err);
+}
+
+// errorText returns a displayable message for any rejected binding call
+export function errorText(err: unknown): string {
+  return isAppError(err) ? err.message : String(err);
+}
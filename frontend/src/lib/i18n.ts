@@ -0,0 +1,22 @@
+import { derived, writable } from 'svelte/store';
+import { GetLocale, GetMessages } from '../../wailsjs/go/main/App';
+import { EventsOn } from '../../wailsjs/runtime/runtime';
+
+// Active locale and message catalog, loaded from Go (internal/i18n)
+export const locale = writable<string>('en');
+export const messages = writable<Record<string, string>>({});
+
+// t looks up a message by ID, falling back to the ID itself
+export const t = derived(messages, ($messages) => (id: string): string => $messages[id] ?? id);
+
+export async function loadMessages() {
+  locale.set(await GetLocale());
+  messages.set(await GetMessages());
+}
+
+// watchLocale reloads the catalog whenever SetLocale is called
+export function watchLocale(): () => void {
+  return EventsOn('locale-changed', () => {
+    loadMessages();
+  });
+}
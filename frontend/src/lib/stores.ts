@@ -4,7 +4,7 @@ import { writable } from 'svelte/store';
 export const appState = writable<string>('fresh');
 
 // Current folder ID for navigation
-export const currentFolderID = writable<number>(0);
+export const currentFolderID = writable<string>('0');
 
 // Settings modal visibility
 export const showSettings = writable<boolean>(false);
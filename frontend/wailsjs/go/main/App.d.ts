@@ -2,40 +2,194 @@
 // This file is automatically generated. DO NOT EDIT
 import {main} from '../models';
 
-export function AddFile(arg1:number):Promise<void>;
+export function AddFile(arg1:string):Promise<void>;
+
+export function AddFolder(arg1:string):Promise<void>;
+
+export function AddFolderFromPath(arg1:string,arg2:string):Promise<void>;
+
+export function ApplyStagedRelease():Promise<void>;
+
+export function ArchiveFile(arg1:string,arg2:string,arg3:string):Promise<void>;
+
+export function BanPeer(arg1:string):Promise<void>;
 
 export function BindPeerWithPhrase(arg1:string):Promise<void>;
 
 export function CancelBinding():Promise<void>;
 
-export function CreateFolder(arg1:string,arg2:number):Promise<number>;
+export function CancelPeerBinding(arg1:string):Promise<void>;
+
+export function ClearProtocolErrors():Promise<void>;
+
+export function CreateDropBox(arg1:string,arg2:string):Promise<string>;
+
+export function CreateFolder(arg1:string,arg2:string):Promise<string>;
 
 export function CreateNewVault():Promise<string>;
 
-export function DeleteFile(arg1:string,arg2:number):Promise<void>;
+export function DeleteFile(arg1:string,arg2:string):Promise<void>;
+
+export function DeleteFolder(arg1:string):Promise<void>;
+
+export function EmptyTrash():Promise<void>;
 
-export function DeleteFolder(arg1:number):Promise<void>;
+export function EvictFile(arg1:string,arg2:string):Promise<number>;
 
-export function ExportFile(arg1:string,arg2:number):Promise<void>;
+export function ExportFile(arg1:string,arg2:string):Promise<void>;
+
+export function ExportFolder(arg1:string):Promise<void>;
+
+export function ExportFolderArchive(arg1:string,arg2:string):Promise<void>;
+
+export function ExportNetworkMap():Promise<void>;
+
+export function ForgetPeer(arg1:string):Promise<void>;
 
 export function GetAppState():Promise<string>;
 
-export function GetFolderPath(arg1:number):Promise<Array<main.PathSegment>>;
+export function GetAvailableLocales():Promise<Array<string>>;
+
+export function GetDropBoxes():Promise<Array<main.DropBoxInfo>>;
+
+export function GetFileNote(arg1:string,arg2:string):Promise<string>;
+
+export function GetFolderPath(arg1:string):Promise<Array<main.PathSegment>>;
+
+export function GetFolderReplication(arg1:string):Promise<main.FolderReplicationInfo>;
+
+export function GetFormerPeers():Promise<Array<main.FormerPeerInfo>>;
+
+export function GetIntents():Promise<Array<main.IntentInfo>>;
+
+export function GetLocale():Promise<string>;
+
+export function GetMessages():Promise<Record<string, string>>;
 
 export function GetNodeID():Promise<string>;
 
+export function GetNodeStatus():Promise<main.NodeStatusInfo>;
+
+export function GetOrphans():Promise<Array<main.OrphanInfo>>;
+
 export function GetPeers():Promise<Array<main.PeerInfo>>;
 
+export function GetPendingBindings():Promise<Array<main.PendingBindingInfo>>;
+
+export function GetPhotosByDate():Promise<Array<main.PhotoMonthInfo>>;
+
+export function GetProtocolErrors():Promise<Array<main.ProtocolErrorInfo>>;
+
+export function GetRecentChanges():Promise<Array<main.ChangeInfo>>;
+
+export function GetReleaseChannelEnabled():Promise<boolean>;
+
+export function GetStagedRelease():Promise<main.ReleaseInfo>;
+
 export function GetStorageStats():Promise<main.StorageStats>;
 
+export function GetSyncDevices(arg1:string):Promise<Array<main.SyncDeviceInfo>>;
+
 export function GetSyncPhrase():Promise<string>;
 
+export function GetSyncRounds():Promise<Array<main.SyncRoundInfo>>;
+
+export function GetTags():Promise<Array<main.TagInfo>>;
+
+export function GetThumbnail(arg1:string,arg2:string):Promise<string>;
+
+export function GetTrash():Promise<Array<main.TrashItemInfo>>;
+
+export function GetTrashRetentionDays():Promise<number>;
+
+export function GetVaultFreeze():Promise<main.VaultFreezeInfo>;
+
+export function GetVaultPolicy():Promise<main.VaultPolicyInfo>;
+
+export function GetVaultStats():Promise<main.VaultStatsInfo>;
+
+export function GetVaultStatsHistory():Promise<Array<main.VaultStatsInfo>>;
+
+export function ImportArchive(arg1:string):Promise<void>;
+
+export function ImportNetworkMap():Promise<number>;
+
 export function IsMaster():Promise<boolean>;
 
-export function ListFolder(arg1:number):Promise<Array<main.FolderItem>>;
+export function ListFolder(arg1:string):Promise<Array<main.FolderItem>>;
+
+export function ListTagged(arg1:string):Promise<Array<main.FolderItem>>;
+
+export function ListVersions(arg1:string,arg2:string):Promise<Array<main.FileVersionInfo>>;
+
+export function LockFile(arg1:string,arg2:string):Promise<void>;
+
+export function MigrateStorage(arg1:string):Promise<number>;
+
+export function MoveFile(arg1:string,arg2:string,arg3:string):Promise<void>;
+
+export function MoveFolder(arg1:string,arg2:string):Promise<void>;
+
+export function PinFile(arg1:string,arg2:string,arg3:boolean):Promise<void>;
+
+export function PinFolder(arg1:string,arg2:boolean):Promise<void>;
+
+export function PublishRelease(arg1:string,arg2:string):Promise<void>;
+
+export function PurgeOrphan(arg1:string):Promise<void>;
+
+export function ReattachOrphan(arg1:string):Promise<void>;
 
 export function RemovePeer(arg1:string):Promise<void>;
 
+export function RenameFile(arg1:string,arg2:string,arg3:string):Promise<void>;
+
+export function RenameFolder(arg1:string,arg2:string):Promise<void>;
+
+export function RestoreArchivedFile(arg1:string,arg2:string):Promise<void>;
+
+export function RestoreFromTrash(arg1:string):Promise<void>;
+
+export function RestorePeer(arg1:string):Promise<void>;
+
+export function RestoreVersion(arg1:string,arg2:string,arg3:number):Promise<void>;
+
+export function RunConnectivityReport():Promise<string>;
+
+export function Search(arg1:string,arg2:boolean):Promise<Array<main.FolderItem>>;
+
+export function SetChangeNote(arg1:string):Promise<void>;
+
+export function SetDropBoxPeer(arg1:string,arg2:string,arg3:boolean):Promise<void>;
+
+export function SetFileNote(arg1:string,arg2:string,arg3:string):Promise<void>;
+
+export function SetFolderReplication(arg1:string,arg2:string):Promise<void>;
+
+export function SetLocale(arg1:string):Promise<void>;
+
+export function SetReleaseChannelEnabled(arg1:boolean):Promise<void>;
+
+export function SetSyncFolder(arg1:string,arg2:string,arg3:boolean):Promise<void>;
+
+export function SetTrashRetentionDays(arg1:number):Promise<void>;
+
+export function SetVaultFreeze(arg1:boolean,arg2:string):Promise<void>;
+
+export function SetVaultPolicy(arg1:main.VaultPolicyInfo):Promise<void>;
+
+export function StartGuestViewer(arg1:Array<string>):Promise<main.ViewerInfo>;
+
+export function StartPeerBinding(arg1:string):Promise<string>;
+
 export function StartReplicaBinding():Promise<string>;
 
+export function StopGuestViewer():Promise<void>;
+
+export function TagFile(arg1:string,arg2:string,arg3:Array<string>,arg4:Array<string>):Promise<void>;
+
+export function TagFolder(arg1:string,arg2:Array<string>,arg3:Array<string>):Promise<void>;
+
+export function UnlockFile(arg1:string,arg2:string,arg3:boolean):Promise<void>;
+
 export function UnlockWithMnemonic(arg1:string):Promise<void>;
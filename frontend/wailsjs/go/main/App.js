@@ -6,6 +6,26 @@ export function AddFile(arg1) {
   return window['go']['main']['App']['AddFile'](arg1);
 }
 
+export function AddFolder(arg1) {
+  return window['go']['main']['App']['AddFolder'](arg1);
+}
+
+export function AddFolderFromPath(arg1, arg2) {
+  return window['go']['main']['App']['AddFolderFromPath'](arg1, arg2);
+}
+
+export function ApplyStagedRelease() {
+  return window['go']['main']['App']['ApplyStagedRelease']();
+}
+
+export function ArchiveFile(arg1, arg2, arg3) {
+  return window['go']['main']['App']['ArchiveFile'](arg1, arg2, arg3);
+}
+
+export function BanPeer(arg1) {
+  return window['go']['main']['App']['BanPeer'](arg1);
+}
+
 export function BindPeerWithPhrase(arg1) {
   return window['go']['main']['App']['BindPeerWithPhrase'](arg1);
 }
@@ -14,6 +34,18 @@ export function CancelBinding() {
   return window['go']['main']['App']['CancelBinding']();
 }
 
+export function CancelPeerBinding(arg1) {
+  return window['go']['main']['App']['CancelPeerBinding'](arg1);
+}
+
+export function ClearProtocolErrors() {
+  return window['go']['main']['App']['ClearProtocolErrors']();
+}
+
+export function CreateDropBox(arg1, arg2) {
+  return window['go']['main']['App']['CreateDropBox'](arg1, arg2);
+}
+
 export function CreateFolder(arg1, arg2) {
   return window['go']['main']['App']['CreateFolder'](arg1, arg2);
 }
@@ -30,34 +62,170 @@ export function DeleteFolder(arg1) {
   return window['go']['main']['App']['DeleteFolder'](arg1);
 }
 
+export function EmptyTrash() {
+  return window['go']['main']['App']['EmptyTrash']();
+}
+
+export function EvictFile(arg1, arg2) {
+  return window['go']['main']['App']['EvictFile'](arg1, arg2);
+}
+
 export function ExportFile(arg1, arg2) {
   return window['go']['main']['App']['ExportFile'](arg1, arg2);
 }
 
+export function ExportFolder(arg1) {
+  return window['go']['main']['App']['ExportFolder'](arg1);
+}
+
+export function ExportFolderArchive(arg1, arg2) {
+  return window['go']['main']['App']['ExportFolderArchive'](arg1, arg2);
+}
+
+export function ExportNetworkMap() {
+  return window['go']['main']['App']['ExportNetworkMap']();
+}
+
+export function ForgetPeer(arg1) {
+  return window['go']['main']['App']['ForgetPeer'](arg1);
+}
+
 export function GetAppState() {
   return window['go']['main']['App']['GetAppState']();
 }
 
+export function GetAvailableLocales() {
+  return window['go']['main']['App']['GetAvailableLocales']();
+}
+
+export function GetDropBoxes() {
+  return window['go']['main']['App']['GetDropBoxes']();
+}
+
+export function GetFileNote(arg1, arg2) {
+  return window['go']['main']['App']['GetFileNote'](arg1, arg2);
+}
+
 export function GetFolderPath(arg1) {
   return window['go']['main']['App']['GetFolderPath'](arg1);
 }
 
+export function GetFolderReplication(arg1) {
+  return window['go']['main']['App']['GetFolderReplication'](arg1);
+}
+
+export function GetFormerPeers() {
+  return window['go']['main']['App']['GetFormerPeers']();
+}
+
+export function GetIntents() {
+  return window['go']['main']['App']['GetIntents']();
+}
+
+export function GetLocale() {
+  return window['go']['main']['App']['GetLocale']();
+}
+
+export function GetMessages() {
+  return window['go']['main']['App']['GetMessages']();
+}
+
 export function GetNodeID() {
   return window['go']['main']['App']['GetNodeID']();
 }
 
+export function GetNodeStatus() {
+  return window['go']['main']['App']['GetNodeStatus']();
+}
+
+export function GetOrphans() {
+  return window['go']['main']['App']['GetOrphans']();
+}
+
 export function GetPeers() {
   return window['go']['main']['App']['GetPeers']();
 }
 
+export function GetPendingBindings() {
+  return window['go']['main']['App']['GetPendingBindings']();
+}
+
+export function GetPhotosByDate() {
+  return window['go']['main']['App']['GetPhotosByDate']();
+}
+
+export function GetProtocolErrors() {
+  return window['go']['main']['App']['GetProtocolErrors']();
+}
+
+export function GetRecentChanges() {
+  return window['go']['main']['App']['GetRecentChanges']();
+}
+
+export function GetReleaseChannelEnabled() {
+  return window['go']['main']['App']['GetReleaseChannelEnabled']();
+}
+
+export function GetStagedRelease() {
+  return window['go']['main']['App']['GetStagedRelease']();
+}
+
 export function GetStorageStats() {
   return window['go']['main']['App']['GetStorageStats']();
 }
 
+export function GetSyncDevices(arg1) {
+  return window['go']['main']['App']['GetSyncDevices'](arg1);
+}
+
 export function GetSyncPhrase() {
   return window['go']['main']['App']['GetSyncPhrase']();
 }
 
+export function GetSyncRounds() {
+  return window['go']['main']['App']['GetSyncRounds']();
+}
+
+export function GetTags() {
+  return window['go']['main']['App']['GetTags']();
+}
+
+export function GetThumbnail(arg1, arg2) {
+  return window['go']['main']['App']['GetThumbnail'](arg1, arg2);
+}
+
+export function GetTrash() {
+  return window['go']['main']['App']['GetTrash']();
+}
+
+export function GetTrashRetentionDays() {
+  return window['go']['main']['App']['GetTrashRetentionDays']();
+}
+
+export function GetVaultFreeze() {
+  return window['go']['main']['App']['GetVaultFreeze']();
+}
+
+export function GetVaultPolicy() {
+  return window['go']['main']['App']['GetVaultPolicy']();
+}
+
+export function GetVaultStats() {
+  return window['go']['main']['App']['GetVaultStats']();
+}
+
+export function GetVaultStatsHistory() {
+  return window['go']['main']['App']['GetVaultStatsHistory']();
+}
+
+export function ImportArchive(arg1) {
+  return window['go']['main']['App']['ImportArchive'](arg1);
+}
+
+export function ImportNetworkMap() {
+  return window['go']['main']['App']['ImportNetworkMap']();
+}
+
 export function IsMaster() {
   return window['go']['main']['App']['IsMaster']();
 }
@@ -66,14 +234,154 @@ export function ListFolder(arg1) {
   return window['go']['main']['App']['ListFolder'](arg1);
 }
 
+export function ListTagged(arg1) {
+  return window['go']['main']['App']['ListTagged'](arg1);
+}
+
+export function ListVersions(arg1, arg2) {
+  return window['go']['main']['App']['ListVersions'](arg1, arg2);
+}
+
+export function LockFile(arg1, arg2) {
+  return window['go']['main']['App']['LockFile'](arg1, arg2);
+}
+
+export function MigrateStorage(arg1) {
+  return window['go']['main']['App']['MigrateStorage'](arg1);
+}
+
+export function MoveFile(arg1, arg2, arg3) {
+  return window['go']['main']['App']['MoveFile'](arg1, arg2, arg3);
+}
+
+export function MoveFolder(arg1, arg2) {
+  return window['go']['main']['App']['MoveFolder'](arg1, arg2);
+}
+
+export function PinFile(arg1, arg2, arg3) {
+  return window['go']['main']['App']['PinFile'](arg1, arg2, arg3);
+}
+
+export function PinFolder(arg1, arg2) {
+  return window['go']['main']['App']['PinFolder'](arg1, arg2);
+}
+
+export function PublishRelease(arg1, arg2) {
+  return window['go']['main']['App']['PublishRelease'](arg1, arg2);
+}
+
+export function PurgeOrphan(arg1) {
+  return window['go']['main']['App']['PurgeOrphan'](arg1);
+}
+
+export function ReattachOrphan(arg1) {
+  return window['go']['main']['App']['ReattachOrphan'](arg1);
+}
+
 export function RemovePeer(arg1) {
   return window['go']['main']['App']['RemovePeer'](arg1);
 }
 
+export function RenameFile(arg1, arg2, arg3) {
+  return window['go']['main']['App']['RenameFile'](arg1, arg2, arg3);
+}
+
+export function RenameFolder(arg1, arg2) {
+  return window['go']['main']['App']['RenameFolder'](arg1, arg2);
+}
+
+export function RestoreArchivedFile(arg1, arg2) {
+  return window['go']['main']['App']['RestoreArchivedFile'](arg1, arg2);
+}
+
+export function RestoreFromTrash(arg1) {
+  return window['go']['main']['App']['RestoreFromTrash'](arg1);
+}
+
+export function RestorePeer(arg1) {
+  return window['go']['main']['App']['RestorePeer'](arg1);
+}
+
+export function RestoreVersion(arg1, arg2, arg3) {
+  return window['go']['main']['App']['RestoreVersion'](arg1, arg2, arg3);
+}
+
+export function RunConnectivityReport() {
+  return window['go']['main']['App']['RunConnectivityReport']();
+}
+
+export function Search(arg1, arg2) {
+  return window['go']['main']['App']['Search'](arg1, arg2);
+}
+
+export function SetChangeNote(arg1) {
+  return window['go']['main']['App']['SetChangeNote'](arg1);
+}
+
+export function SetDropBoxPeer(arg1, arg2, arg3) {
+  return window['go']['main']['App']['SetDropBoxPeer'](arg1, arg2, arg3);
+}
+
+export function SetFileNote(arg1, arg2, arg3) {
+  return window['go']['main']['App']['SetFileNote'](arg1, arg2, arg3);
+}
+
+export function SetFolderReplication(arg1, arg2) {
+  return window['go']['main']['App']['SetFolderReplication'](arg1, arg2);
+}
+
+export function SetLocale(arg1) {
+  return window['go']['main']['App']['SetLocale'](arg1);
+}
+
+export function SetReleaseChannelEnabled(arg1) {
+  return window['go']['main']['App']['SetReleaseChannelEnabled'](arg1);
+}
+
+export function SetSyncFolder(arg1, arg2, arg3) {
+  return window['go']['main']['App']['SetSyncFolder'](arg1, arg2, arg3);
+}
+
+export function SetTrashRetentionDays(arg1) {
+  return window['go']['main']['App']['SetTrashRetentionDays'](arg1);
+}
+
+export function SetVaultFreeze(arg1, arg2) {
+  return window['go']['main']['App']['SetVaultFreeze'](arg1, arg2);
+}
+
+export function SetVaultPolicy(arg1) {
+  return window['go']['main']['App']['SetVaultPolicy'](arg1);
+}
+
+export function StartGuestViewer(arg1) {
+  return window['go']['main']['App']['StartGuestViewer'](arg1);
+}
+
+export function StartPeerBinding(arg1) {
+  return window['go']['main']['App']['StartPeerBinding'](arg1);
+}
+
 export function StartReplicaBinding() {
   return window['go']['main']['App']['StartReplicaBinding']();
 }
 
+export function StopGuestViewer() {
+  return window['go']['main']['App']['StopGuestViewer']();
+}
+
+export function TagFile(arg1, arg2, arg3, arg4) {
+  return window['go']['main']['App']['TagFile'](arg1, arg2, arg3, arg4);
+}
+
+export function TagFolder(arg1, arg2, arg3) {
+  return window['go']['main']['App']['TagFolder'](arg1, arg2, arg3);
+}
+
+export function UnlockFile(arg1, arg2, arg3) {
+  return window['go']['main']['App']['UnlockFile'](arg1, arg2, arg3);
+}
+
 export function UnlockWithMnemonic(arg1) {
   return window['go']['main']['App']['UnlockWithMnemonic'](arg1);
 }
@@ -1,11 +1,82 @@
 export namespace main {
 	
+	export class ChangeInfo {
+	    updateId: number;
+	    action: string;
+	    entries: number;
+	    note: string;
+	    timestampMs: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new ChangeInfo(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.updateId = source["updateId"];
+	        this.action = source["action"];
+	        this.entries = source["entries"];
+	        this.note = source["note"];
+	        this.timestampMs = source["timestampMs"];
+	    }
+	}
+	export class DropBoxInfo {
+	    folderId: string;
+	    name: string;
+	    droppers: Array<string>;
+	
+	    static createFrom(source: any = {}) {
+	        return new DropBoxInfo(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.folderId = source["folderId"];
+	        this.name = source["name"];
+	        this.droppers = source["droppers"];
+	    }
+	}
+	export class FileVersionInfo {
+	    index: number;
+	    size: number;
+	    modifiedAt: string;
+	    modifiedAtMs: number;
+	    stored: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new FileVersionInfo(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.index = source["index"];
+	        this.size = source["size"];
+	        this.modifiedAt = source["modifiedAt"];
+	        this.modifiedAtMs = source["modifiedAtMs"];
+	        this.stored = source["stored"];
+	    }
+	}
 	export class FolderItem {
 	    type: string;
 	    name: string;
-	    folderId: number;
+	    folderId: string;
 	    size: number;
 	    modifiedAt: string;
+	    modifiedAtMs: number;
+	    dropBox: boolean;
+	    symlink: boolean;
+	    local: boolean;
+	    pinned: boolean;
+	    pinInherited: boolean;
+	    archive: string;
+	    archivedAtMs: number;
+	    parentId: string;
+	    tags: Array<string>;
+	    note: string;
+	    lockedBy: string;
+	    lockedAtMs: number;
+	    lockedHere: boolean;
+	    path?: string;
 	
 	    static createFrom(source: any = {}) {
 	        return new FolderItem(source);
@@ -18,11 +89,164 @@ export namespace main {
 	        this.folderId = source["folderId"];
 	        this.size = source["size"];
 	        this.modifiedAt = source["modifiedAt"];
+	        this.modifiedAtMs = source["modifiedAtMs"];
+	        this.dropBox = source["dropBox"];
+	        this.symlink = source["symlink"];
+	        this.local = source["local"];
+	        this.pinned = source["pinned"];
+	        this.pinInherited = source["pinInherited"];
+	        this.archive = source["archive"];
+	        this.archivedAtMs = source["archivedAtMs"];
+	        this.parentId = source["parentId"];
+	        this.tags = source["tags"];
+	        this.note = source["note"];
+	        this.lockedBy = source["lockedBy"];
+	        this.lockedAtMs = source["lockedAtMs"];
+	        this.lockedHere = source["lockedHere"];
+	        this.path = source["path"];
+	    }
+	}
+	export class FolderReplicationInfo {
+	    mode: string;
+	    inherited: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new FolderReplicationInfo(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.mode = source["mode"];
+	        this.inherited = source["inherited"];
+	    }
+	}
+	export class FormerPeerInfo {
+	    peerId: string;
+	    id: string;
+	    label: string;
+	    banned: boolean;
+	    removedAt: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new FormerPeerInfo(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.peerId = source["peerId"];
+	        this.id = source["id"];
+	        this.label = source["label"];
+	        this.banned = source["banned"];
+	        this.removedAt = source["removedAt"];
+	    }
+	}
+	export class IntentInfo {
+	    id: number;
+	    summary: string;
+	    state: string;
+	    error: string;
+	    createdMs: number;
+	    delivered: number;
+	    total: number;
+	    pending: Array<string>;
+	
+	    static createFrom(source: any = {}) {
+	        return new IntentInfo(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.summary = source["summary"];
+	        this.state = source["state"];
+	        this.error = source["error"];
+	        this.createdMs = source["createdMs"];
+	        this.delivered = source["delivered"];
+	        this.total = source["total"];
+	        this.pending = source["pending"];
+	    }
+	}
+	export class NodeStatusInfo {
+	    hasVaultKey: boolean;
+	    entries: number;
+	    encryptedBytes: number;
+	    filesComplete: number;
+	    filesTotal: number;
+	    bytesStored: number;
+	    bytesReferenced: number;
+	    lastUpdateId: number;
+	    lastUpdateType: string;
+	    lastUpdateTimeMs: number;
+	    vault: main.VaultStatsInfo;
+	    quarantined: number;
+	    corruptBlobs: number;
+	    blobBytes: number;
+	    quota: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new NodeStatusInfo(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.hasVaultKey = source["hasVaultKey"];
+	        this.entries = source["entries"];
+	        this.encryptedBytes = source["encryptedBytes"];
+	        this.filesComplete = source["filesComplete"];
+	        this.filesTotal = source["filesTotal"];
+	        this.bytesStored = source["bytesStored"];
+	        this.bytesReferenced = source["bytesReferenced"];
+	        this.lastUpdateId = source["lastUpdateId"];
+	        this.lastUpdateType = source["lastUpdateType"];
+	        this.lastUpdateTimeMs = source["lastUpdateTimeMs"];
+	        this.vault = this.convertValues(source["vault"], main.VaultStatsInfo);
+	        this.quarantined = source["quarantined"];
+	        this.corruptBlobs = source["corruptBlobs"];
+	        this.blobBytes = source["blobBytes"];
+	        this.quota = source["quota"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class OrphanInfo {
+	    id: string;
+	    type: string;
+	    name: string;
+	    missingParent: string;
+	    size: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new OrphanInfo(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.type = source["type"];
+	        this.name = source["name"];
+	        this.missingParent = source["missingParent"];
+	        this.size = source["size"];
 	    }
 	}
 	export class PathSegment {
 	    name: string;
-	    folderId: number;
+	    folderId: string;
 	
 	    static createFrom(source: any = {}) {
 	        return new PathSegment(source);
@@ -36,8 +260,17 @@ export namespace main {
 	}
 	export class PeerInfo {
 	    peerId: string;
+	    id: string;
+	    label: string;
 	    isOnline: boolean;
+	    status: string;
 	    lastSeen: string;
+	    lastSeenMs: number;
+	    path: string;
+	    freeBytes: number;
+	    capBytes: number;
+	    storedBytes: number;
+	    statusMs: number;
 	
 	    static createFrom(source: any = {}) {
 	        return new PeerInfo(source);
@@ -46,8 +279,131 @@ export namespace main {
 	    constructor(source: any = {}) {
 	        if ('string' === typeof source) source = JSON.parse(source);
 	        this.peerId = source["peerId"];
+	        this.id = source["id"];
+	        this.label = source["label"];
 	        this.isOnline = source["isOnline"];
+	        this.status = source["status"];
 	        this.lastSeen = source["lastSeen"];
+	        this.lastSeenMs = source["lastSeenMs"];
+	        this.path = source["path"];
+	        this.freeBytes = source["freeBytes"];
+	        this.capBytes = source["capBytes"];
+	        this.storedBytes = source["storedBytes"];
+	        this.statusMs = source["statusMs"];
+	    }
+	}
+	export class PendingBindingInfo {
+	    bindingId: string;
+	    phrase: string;
+	    stage: string;
+	    peerId: string;
+	    startedAt: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new PendingBindingInfo(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.bindingId = source["bindingId"];
+	        this.phrase = source["phrase"];
+	        this.stage = source["stage"];
+	        this.peerId = source["peerId"];
+	        this.startedAt = source["startedAt"];
+	    }
+	}
+	export class PhotoInfo {
+	    name: string;
+	    folderId: string;
+	    size: number;
+	    capturedAt: string;
+	    capturedAtMs: number;
+	    camera: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new PhotoInfo(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.name = source["name"];
+	        this.folderId = source["folderId"];
+	        this.size = source["size"];
+	        this.capturedAt = source["capturedAt"];
+	        this.capturedAtMs = source["capturedAtMs"];
+	        this.camera = source["camera"];
+	    }
+	}
+	export class PhotoMonthInfo {
+	    year: number;
+	    month: number;
+	    photos: Array<main.PhotoInfo>;
+	
+	    static createFrom(source: any = {}) {
+	        return new PhotoMonthInfo(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.year = source["year"];
+	        this.month = source["month"];
+	        this.photos = this.convertValues(source["photos"], main.PhotoInfo, true);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class ProtocolErrorInfo {
+	    peer: string;
+	    protocol: string;
+	    phase: string;
+	    error: string;
+	    timestampMs: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new ProtocolErrorInfo(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.peer = source["peer"];
+	        this.protocol = source["protocol"];
+	        this.phase = source["phase"];
+	        this.error = source["error"];
+	        this.timestampMs = source["timestampMs"];
+	    }
+	}
+	export class ReleaseInfo {
+	    version: string;
+	    notes: string;
+	    size: number;
+	    publishedMs: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new ReleaseInfo(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.version = source["version"];
+	        this.notes = source["notes"];
+	        this.size = source["size"];
+	        this.publishedMs = source["publishedMs"];
 	    }
 	}
 	export class StorageStats {
@@ -64,6 +420,176 @@ export namespace main {
 	        this.totalSize = source["totalSize"];
 	    }
 	}
+	export class SyncDeviceInfo {
+	    peerId: string;
+	    id: string;
+	    label: string;
+	    selected: boolean;
+	    inherited: boolean;
+	    folders: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new SyncDeviceInfo(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.peerId = source["peerId"];
+	        this.id = source["id"];
+	        this.label = source["label"];
+	        this.selected = source["selected"];
+	        this.inherited = source["inherited"];
+	        this.folders = source["folders"];
+	    }
+	}
+	export class SyncRoundInfo {
+	    updateId: number;
+	    peer: string;
+	    mode: string;
+	    started: string;
+	    startedMs: number;
+	    durationMs: number;
+	    bucketsCompared: number;
+	    bucketsDiffering: number;
+	    entriesFetched: number;
+	    entriesDeleted: number;
+	    filesDownloaded: number;
+	    bytesMoved: number;
+	    error: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new SyncRoundInfo(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.updateId = source["updateId"];
+	        this.peer = source["peer"];
+	        this.mode = source["mode"];
+	        this.started = source["started"];
+	        this.startedMs = source["startedMs"];
+	        this.durationMs = source["durationMs"];
+	        this.bucketsCompared = source["bucketsCompared"];
+	        this.bucketsDiffering = source["bucketsDiffering"];
+	        this.entriesFetched = source["entriesFetched"];
+	        this.entriesDeleted = source["entriesDeleted"];
+	        this.filesDownloaded = source["filesDownloaded"];
+	        this.bytesMoved = source["bytesMoved"];
+	        this.error = source["error"];
+	    }
+	}
+	export class TagInfo {
+	    tag: string;
+	    count: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new TagInfo(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.tag = source["tag"];
+	        this.count = source["count"];
+	    }
+	}
+	export class TrashItemInfo {
+	    id: string;
+	    type: string;
+	    name: string;
+	    folderId: string;
+	    size: number;
+	    trashedAtMs: number;
+	    expiresAtMs: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new TrashItemInfo(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.type = source["type"];
+	        this.name = source["name"];
+	        this.folderId = source["folderId"];
+	        this.size = source["size"];
+	        this.trashedAtMs = source["trashedAtMs"];
+	        this.expiresAtMs = source["expiresAtMs"];
+	    }
+	}
+	export class VaultFreezeInfo {
+	    frozen: boolean;
+	    reason: string;
+	    sinceMs: number;
+	    isMaster: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new VaultFreezeInfo(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.frozen = source["frozen"];
+	        this.reason = source["reason"];
+	        this.sinceMs = source["sinceMs"];
+	        this.isMaster = source["isMaster"];
+	    }
+	}
+	export class VaultPolicyInfo {
+	    maxFileSize: number;
+	    maxVaultSize: number;
+	    blockedExtensions: Array<string>;
+	
+	    static createFrom(source: any = {}) {
+	        return new VaultPolicyInfo(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.maxFileSize = source["maxFileSize"];
+	        this.maxVaultSize = source["maxVaultSize"];
+	        this.blockedExtensions = source["blockedExtensions"];
+	    }
+	}
+	export class VaultStatsInfo {
+	    updateId: number;
+	    timestampMs: number;
+	    fileCount: number;
+	    folderCount: number;
+	    logicalBytes: number;
+	    storedBytes: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new VaultStatsInfo(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.updateId = source["updateId"];
+	        this.timestampMs = source["timestampMs"];
+	        this.fileCount = source["fileCount"];
+	        this.folderCount = source["folderCount"];
+	        this.logicalBytes = source["logicalBytes"];
+	        this.storedBytes = source["storedBytes"];
+	    }
+	}
+	export class ViewerInfo {
+	    url: string;
+	    username: string;
+	    password: string;
+	    fingerprint: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new ViewerInfo(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.url = source["url"];
+	        this.username = source["username"];
+	        this.password = source["password"];
+	        this.fingerprint = source["fingerprint"];
+	    }
+	}
 
 }
 
@@ -0,0 +1,374 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/notassigned/endershare/internal/database"
+	"github.com/notassigned/endershare/internal/storage"
+)
+
+// Item represents a file or folder in REST responses
+type Item struct {
+	Type       string `json:"type"` // "file" or "folder"
+	Name       string `json:"name"`
+	FolderID   string `json:"folderId"`
+	Size       int64  `json:"size,omitempty"`
+	ModifiedAt string `json:"modifiedAt,omitempty"`
+}
+
+// PathSegment represents a breadcrumb segment in REST responses
+type PathSegment struct {
+	Name     string `json:"name"`
+	FolderID string `json:"folderId"`
+}
+
+// ErrNotMaster refuses uploads and deletes on a node that can't publish them
+var ErrNotMaster = errors.New("only master nodes accept uploads and deletes")
+
+// errorResponse is the JSON body of every failed request
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// Server exposes a REST view of the vault. What a request may do is set by
+// the Grant RequireAuth attaches; requests without one are read-only.
+// Drop box folders can't be listed or read without admin access.
+// When Folders is non-empty only those folders and their subtrees are visible.
+type Server struct {
+	storage *storage.Storage
+	folders []storage.FolderID
+	mux     *http.ServeMux
+
+	// IsMaster reports whether this node can publish changes; uploads and
+	// deletes are refused while it returns false
+	IsMaster func() bool
+	// CheckWritable is called before an upload or delete; an error refuses it
+	CheckWritable func() error
+	// OnChange is called after an upload or delete so the change can be
+	// published. removed is nil for a new file; a replaced or trashed file
+	// has both.
+	OnChange func(removed, added *database.DataEntry)
+}
+
+// NewServer creates a REST server over storage restricted to the given folders
+func NewServer(stor *storage.Storage, folders []storage.FolderID) *Server {
+	s := &Server{
+		storage: stor,
+		folders: folders,
+		mux:     http.NewServeMux(),
+	}
+
+	s.mux.HandleFunc("GET /api/roots", s.handleRoots)
+	s.mux.HandleFunc("GET /api/folders/{id}", s.handleListFolder)
+	s.mux.HandleFunc("GET /api/folders/{id}/path", s.handleFolderPath)
+	s.mux.HandleFunc("GET /api/folders/{id}/files/{name}", s.handleDownload)
+	s.mux.HandleFunc("PUT /api/folders/{id}/files/{name}", s.handleUpload)
+	s.mux.HandleFunc("DELETE /api/folders/{id}/files/{name}", s.handleDelete)
+
+	return s
+}
+
+// Handle registers an additional handler on the server's mux
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// handleRoots lists the folders the caller may browse
+func (s *Server) handleRoots(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r, ScopeRead, "") {
+		return
+	}
+	if len(s.folders) == 0 {
+		writeJSON(w, []Item{{Type: "folder", Name: "/", FolderID: string(storage.RootFolderID)}})
+		return
+	}
+
+	roots := make([]Item, 0, len(s.folders))
+	for _, id := range s.folders {
+		name := "/"
+		if !id.IsRoot() {
+			folder, err := s.storage.GetFolder(id)
+			if err != nil {
+				continue
+			}
+			name = folder.Name
+		}
+		roots = append(roots, Item{Type: "folder", Name: name, FolderID: string(id)})
+	}
+	writeJSON(w, roots)
+}
+
+func (s *Server) handleListFolder(w http.ResponseWriter, r *http.Request) {
+	folderID, ok := s.folderParam(w, r)
+	if !ok || !s.authorize(w, r, ScopeRead, folderID) {
+		return
+	}
+
+	entries, err := s.storage.ListFolder(folderID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	items := make([]Item, 0, len(entries))
+	for _, entry := range entries {
+		switch v := entry.(type) {
+		case storage.FileEntry:
+			items = append(items, Item{
+				Type:       "file",
+				Name:       v.Name,
+				FolderID:   string(v.FolderID),
+				Size:       v.Size,
+				ModifiedAt: v.ModifiedAt.Format(time.RFC3339),
+			})
+		case storage.FolderEntry:
+			items = append(items, Item{
+				Type:     "folder",
+				Name:     v.Name,
+				FolderID: string(v.FolderID),
+			})
+		}
+	}
+	writeJSON(w, items)
+}
+
+// handleFolderPath returns breadcrumbs from the nearest visible root to the folder
+func (s *Server) handleFolderPath(w http.ResponseWriter, r *http.Request) {
+	folderID, ok := s.folderParam(w, r)
+	if !ok || !s.authorize(w, r, ScopeRead, folderID) {
+		return
+	}
+
+	path := []PathSegment{}
+	currentID := folderID
+	for {
+		if currentID.IsRoot() {
+			path = append([]PathSegment{{Name: "/", FolderID: string(storage.RootFolderID)}}, path...)
+			break
+		}
+		folder, err := s.storage.GetFolder(currentID)
+		if err != nil {
+			break
+		}
+		path = append([]PathSegment{{Name: folder.Name, FolderID: string(folder.FolderID)}}, path...)
+		if s.isRoot(currentID) {
+			break
+		}
+		currentID = folder.ParentFolderID
+	}
+	writeJSON(w, path)
+}
+
+func (s *Server) handleDownload(w http.ResponseWriter, r *http.Request) {
+	folderID, ok := s.folderParam(w, r)
+	if !ok || !s.authorize(w, r, ScopeRead, folderID) {
+		return
+	}
+	name := r.PathValue("name")
+
+	entry, err := s.storage.StatFile(name, folderID)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	contentType := mime.TypeByExtension(filepath.Ext(name))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+
+	// Uncompressed files serve byte ranges, so media can be streamed
+	seeker, err := s.storage.OpenFileSeeker(name, folderID)
+	if err == nil {
+		defer seeker.Close()
+		http.ServeContent(w, r, name, entry.ModifiedAt, seeker)
+		return
+	}
+	if !errors.Is(err, storage.ErrNotSeekable) {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	content, err := s.storage.OpenFileReader(name, folderID)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	defer content.Close()
+	w.Header().Set("Content-Length", strconv.FormatInt(entry.Size, 10))
+
+	if _, err := io.Copy(w, content); err != nil {
+		// Headers are already sent; the truncated body signals the failure
+		fmt.Println("Error streaming file:", err)
+	}
+}
+
+// handleUpload stores the request body as a file in the folder. Only admins
+// may replace a file that already exists.
+func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
+	folderID, ok := s.folderParam(w, r)
+	if !ok || !s.authorize(w, r, ScopeUpload, folderID) || !s.writable(w) {
+		return
+	}
+	name := r.PathValue("name")
+	if !folderID.IsRoot() {
+		if _, err := s.storage.GetFolder(folderID); err != nil {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+	}
+	if grant, _ := GrantFromContext(r.Context()); grant.Scope != ScopeAdmin {
+		if _, err := s.storage.StatFile(name, folderID); err == nil {
+			writeError(w, http.StatusConflict, fmt.Errorf("%w: %s", storage.ErrNameTaken, name))
+			return
+		}
+	}
+
+	replaced, entry, err := s.storage.AddFileFromReader(r.Body, name, folderID)
+	if errors.Is(err, storage.ErrInvalidName) {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if errors.Is(err, storage.ErrPolicyViolation) {
+		writeError(w, http.StatusForbidden, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	s.changed(replaced, entry)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(Item{Type: "file", Name: name, FolderID: string(folderID)})
+}
+
+// handleDelete moves a file from the folder to the trash
+func (s *Server) handleDelete(w http.ResponseWriter, r *http.Request) {
+	folderID, ok := s.folderParam(w, r)
+	if !ok || !s.authorize(w, r, ScopeAdmin, folderID) || !s.writable(w) {
+		return
+	}
+
+	removed, added, err := s.storage.TrashFile(r.PathValue("name"), folderID)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	s.changed(removed, added)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writable refuses the request on a replica or while CheckWritable fails
+func (s *Server) writable(w http.ResponseWriter) bool {
+	if s.IsMaster != nil && !s.IsMaster() {
+		writeError(w, http.StatusForbidden, ErrNotMaster)
+		return false
+	}
+	if s.CheckWritable == nil {
+		return true
+	}
+	if err := s.CheckWritable(); err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return false
+	}
+	return true
+}
+
+func (s *Server) changed(removed, added *database.DataEntry) {
+	if s.OnChange != nil {
+		s.OnChange(removed, added)
+	}
+}
+
+// authorize rejects the request unless its grant allows scope on folderID
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request, scope Scope, folderID storage.FolderID) bool {
+	grant, ok := GrantFromContext(r.Context())
+	if !ok {
+		grant = Grant{Scope: ScopeRead}
+	}
+	if !grant.Allows(scope, folderID) {
+		writeError(w, http.StatusForbidden, fmt.Errorf("token does not allow %s here", scope))
+		return false
+	}
+	// Drop boxes accept uploads from anyone allowed to upload, but only
+	// admins may see what is already in them
+	if scope == ScopeRead && grant.Scope != ScopeAdmin && s.storage.IsDropBox(folderID) {
+		writeError(w, http.StatusForbidden, fmt.Errorf("folder %s is a drop box", folderID))
+		return false
+	}
+	return true
+}
+
+// folderParam parses the {id} path value and enforces folder visibility
+func (s *Server) folderParam(w http.ResponseWriter, r *http.Request) (storage.FolderID, bool) {
+	folderID := storage.FolderID(r.PathValue("id"))
+	if folderID == "" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid folder id"))
+		return "", false
+	}
+	if !s.folderVisible(folderID) {
+		writeError(w, http.StatusForbidden, fmt.Errorf("folder %s is not shared", folderID))
+		return "", false
+	}
+	return folderID, true
+}
+
+func (s *Server) isRoot(folderID storage.FolderID) bool {
+	for _, id := range s.folders {
+		if id == folderID {
+			return true
+		}
+	}
+	return false
+}
+
+// folderVisible reports whether folderID is a shared folder or inside one
+func (s *Server) folderVisible(folderID storage.FolderID) bool {
+	if len(s.folders) == 0 {
+		return true
+	}
+
+	currentID := folderID
+	// Bound the walk so corrupted parent links can't loop forever
+	for depth := 0; depth < 1024; depth++ {
+		if s.isRoot(currentID) {
+			return true
+		}
+		if currentID.IsRoot() {
+			return false
+		}
+		folder, err := s.storage.GetFolder(currentID)
+		if err != nil {
+			return false
+		}
+		currentID = folder.ParentFolderID
+	}
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errorResponse{Error: err.Error()})
+}
@@ -0,0 +1,158 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/notassigned/endershare/internal/database"
+	"github.com/notassigned/endershare/internal/storage"
+)
+
+// newTestServer returns a server over an empty vault in a temporary directory
+func newTestServer(t *testing.T) (*Server, *database.EndershareDB) {
+	t.Helper()
+	dir := t.TempDir()
+	db := database.Open(filepath.Join(dir, "endershare.db"))
+	t.Cleanup(func() { db.Close() })
+	return NewServer(storage.NewStorageIn(db, make([]byte, 32), dir), nil), db
+}
+
+// issueTestToken issues a token of scope limited to folder, empty for any
+func issueTestToken(t *testing.T, db *database.EndershareDB, scope Scope, folder storage.FolderID) string {
+	t.Helper()
+	token, _, err := IssueToken(db, "test", scope, folder, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// upload sends a small file named name into folderID with token and returns
+// the status code. The path values are set directly, as the mux would
+// redirect a path with a dot segment before it reaches the handler.
+func upload(t *testing.T, s *Server, db *database.EndershareDB, token string, folderID storage.FolderID, name string) int {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPut, "/api/folders/"+string(folderID)+"/files/upload", strings.NewReader("content"))
+	req.SetPathValue("id", string(folderID))
+	req.SetPathValue("name", name)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	RequireAuth(NewTokenAuth(db), http.HandlerFunc(s.handleUpload)).ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestUploadRejectsInvalidNames(t *testing.T) {
+	s, db := newTestServer(t)
+	token := issueTestToken(t, db, ScopeAdmin, "")
+	for _, name := range []string{"", ".", "..", "a/b", `a\b`} {
+		if code := upload(t, s, db, token, storage.RootFolderID, name); code != http.StatusBadRequest {
+			t.Errorf("upload of %q = %d, want %d", name, code, http.StatusBadRequest)
+		}
+	}
+	if code := upload(t, s, db, token, storage.RootFolderID, "photo.jpg"); code != http.StatusCreated {
+		t.Errorf("upload of photo.jpg = %d, want %d", code, http.StatusCreated)
+	}
+}
+
+// An upload-only token limited to a folder gets the same name checks and
+// can't place entries outside its folder
+func TestScopedUploadRejectsInvalidNames(t *testing.T) {
+	s, db := newTestServer(t)
+	folderID, err := s.storage.CreateFolder("inbox", storage.RootFolderID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := issueTestToken(t, db, ScopeUpload, folderID)
+	for _, name := range []string{".", "..", "../escape"} {
+		if code := upload(t, s, db, token, folderID, name); code != http.StatusBadRequest {
+			t.Errorf("upload of %q = %d, want %d", name, code, http.StatusBadRequest)
+		}
+	}
+	if code := upload(t, s, db, token, storage.RootFolderID, "photo.jpg"); code != http.StatusForbidden {
+		t.Errorf("upload outside the token's folder = %d, want %d", code, http.StatusForbidden)
+	}
+	if code := upload(t, s, db, token, folderID, "photo.jpg"); code != http.StatusCreated {
+		t.Errorf("upload of photo.jpg = %d, want %d", code, http.StatusCreated)
+	}
+
+	entries, err := s.storage.ListFolder(folderID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("folder has %d entries after the uploads, want 1", len(entries))
+	}
+}
+
+// A replica serving the API takes no uploads or deletes, it couldn't publish them
+func TestReplicaRefusesWrites(t *testing.T) {
+	s, db := newTestServer(t)
+	token := issueTestToken(t, db, ScopeAdmin, "")
+	if code := upload(t, s, db, token, storage.RootFolderID, "photo.jpg"); code != http.StatusCreated {
+		t.Fatalf("upload on the master = %d, want %d", code, http.StatusCreated)
+	}
+	s.IsMaster = func() bool { return false }
+
+	if code := upload(t, s, db, token, storage.RootFolderID, "other.jpg"); code != http.StatusForbidden {
+		t.Errorf("upload on a replica = %d, want %d", code, http.StatusForbidden)
+	}
+	req := httptest.NewRequest(http.MethodDelete, "/api/folders/"+string(storage.RootFolderID)+"/files/photo.jpg", nil)
+	req.SetPathValue("id", string(storage.RootFolderID))
+	req.SetPathValue("name", "photo.jpg")
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	RequireAuth(NewTokenAuth(db), http.HandlerFunc(s.handleDelete)).ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("delete on a replica = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+	if !strings.Contains(rec.Body.String(), ErrNotMaster.Error()) {
+		t.Errorf("delete on a replica answered %q, want %q", rec.Body.String(), ErrNotMaster)
+	}
+
+	entries, err := s.storage.ListFolder(storage.RootFolderID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("root has %d entries, want the master's upload only", len(entries))
+	}
+}
+
+// Upload tokens can't overwrite what is already there; an admin's replacement
+// is reported as one change
+func TestUploadReplacement(t *testing.T) {
+	s, db := newTestServer(t)
+	type change struct{ removed, added *database.DataEntry }
+	var changes []change
+	s.OnChange = func(removed, added *database.DataEntry) {
+		changes = append(changes, change{removed, added})
+	}
+
+	uploader := issueTestToken(t, db, ScopeUpload, "")
+	if code := upload(t, s, db, uploader, storage.RootFolderID, "photo.jpg"); code != http.StatusCreated {
+		t.Fatalf("first upload = %d, want %d", code, http.StatusCreated)
+	}
+	if code := upload(t, s, db, uploader, storage.RootFolderID, "photo.jpg"); code != http.StatusConflict {
+		t.Errorf("upload over an existing file = %d, want %d", code, http.StatusConflict)
+	}
+	admin := issueTestToken(t, db, ScopeAdmin, "")
+	if code := upload(t, s, db, admin, storage.RootFolderID, "photo.jpg"); code != http.StatusCreated {
+		t.Errorf("admin upload over an existing file = %d, want %d", code, http.StatusCreated)
+	}
+
+	if len(changes) != 2 {
+		t.Fatalf("got %d changes, want 2", len(changes))
+	}
+	if changes[0].removed != nil || changes[0].added == nil {
+		t.Error("new file was not reported as an addition")
+	}
+	if changes[1].removed == nil || changes[1].added == nil {
+		t.Error("replacement was not reported as one change replacing the old entry")
+	}
+	if entries, err := s.storage.ListFolder(storage.RootFolderID); err != nil || len(entries) != 1 {
+		t.Errorf("root has %d entries, %v; want 1", len(entries), err)
+	}
+}
@@ -0,0 +1,105 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+
+	"github.com/notassigned/endershare/internal/storage"
+)
+
+// GuestUser is the HTTP basic auth username for guest viewer sessions
+const GuestUser = "guest"
+
+// Scope is what an authenticated caller may do
+type Scope string
+
+const (
+	// ScopeRead allows browsing and downloading
+	ScopeRead Scope = "read"
+	// ScopeUpload allows adding files, optionally only into one folder
+	ScopeUpload Scope = "upload"
+	// ScopeAdmin allows everything, including deletes
+	ScopeAdmin Scope = "admin"
+)
+
+// ParseScope validates a scope name
+func ParseScope(s string) (Scope, bool) {
+	switch Scope(s) {
+	case ScopeRead, ScopeUpload, ScopeAdmin:
+		return Scope(s), true
+	}
+	return "", false
+}
+
+// Grant is the access an authenticated request carries
+type Grant struct {
+	Scope  Scope
+	Folder storage.FolderID // Upload grants limited to one folder; empty for any
+}
+
+// Allows reports whether the grant permits an operation of scope on folderID
+func (g Grant) Allows(scope Scope, folderID storage.FolderID) bool {
+	switch g.Scope {
+	case ScopeAdmin:
+		return true
+	case ScopeRead:
+		return scope == ScopeRead
+	case ScopeUpload:
+		return scope == ScopeUpload && (g.Folder == "" || g.Folder == folderID)
+	}
+	return false
+}
+
+// Authenticator decides whether a request may reach the API and with what access
+type Authenticator interface {
+	Authenticate(r *http.Request) (Grant, bool)
+}
+
+type grantKey struct{}
+
+// GrantFromContext returns the grant RequireAuth attached to the request
+func GrantFromContext(ctx context.Context) (Grant, bool) {
+	g, ok := ctx.Value(grantKey{}).(Grant)
+	return g, ok
+}
+
+// PasswordAuth accepts HTTP basic auth with a single shared password and grants read access
+type PasswordAuth struct {
+	Password string
+}
+
+// NewPasswordAuth creates a PasswordAuth with a random password
+func NewPasswordAuth() (*PasswordAuth, error) {
+	buf := make([]byte, 18)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	return &PasswordAuth{Password: base64.RawURLEncoding.EncodeToString(buf)}, nil
+}
+
+func (p *PasswordAuth) Authenticate(r *http.Request) (Grant, bool) {
+	user, pass, ok := r.BasicAuth()
+	if !ok || p.Password == "" {
+		return Grant{}, false
+	}
+	userOK := subtle.ConstantTimeCompare([]byte(user), []byte(GuestUser)) == 1
+	passOK := subtle.ConstantTimeCompare([]byte(pass), []byte(p.Password)) == 1
+	return Grant{Scope: ScopeRead}, userOK && passOK
+}
+
+// RequireAuth rejects requests the authenticator does not accept and attaches
+// the grant of accepted ones to the request context
+func RequireAuth(auth Authenticator, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		grant, ok := auth.Authenticate(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="endershare", charset="UTF-8"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), grantKey{}, grant)))
+	})
+}
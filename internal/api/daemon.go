@@ -0,0 +1,76 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/notassigned/endershare/internal/database"
+	"github.com/notassigned/endershare/internal/storage"
+)
+
+// DefaultDaemonAddr is the listen address of the token-authenticated API
+const DefaultDaemonAddr = ":8444"
+
+// Daemon serves the REST API to scripts holding capability tokens
+type Daemon struct {
+	URL         string
+	Fingerprint string
+
+	server *http.Server
+}
+
+// StartDaemon serves the full vault over HTTPS on addr. Requests need a
+// bearer token issued with IssueToken. Uploads and deletes are refused
+// unless isMaster reports true and checkWritable passes; onChange publishes them.
+func StartDaemon(db *database.EndershareDB, stor *storage.Storage, addr string, isMaster func() bool, checkWritable func() error, onChange func(removed, added *database.DataEntry)) (*Daemon, error) {
+	if addr == "" {
+		addr = DefaultDaemonAddr
+	}
+
+	cert, err := LoadOrCreateCertificate(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load API certificate: %w", err)
+	}
+	if err := db.RemoveExpiredTokens(time.Now().Unix()); err != nil {
+		fmt.Println("Warning: Failed to remove expired API tokens:", err)
+	}
+
+	api := NewServer(stor, nil)
+	api.IsMaster = isMaster
+	api.CheckWritable = checkWritable
+	api.OnChange = onChange
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	server := &http.Server{
+		Handler:           RequireAuth(NewTokenAuth(db), api),
+		TLSConfig:         &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12},
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		if err := server.ServeTLS(listener, "", ""); err != nil && err != http.ErrServerClosed {
+			fmt.Println("API server error:", err)
+		}
+	}()
+
+	return &Daemon{
+		URL:         viewerURL(listener.Addr()),
+		Fingerprint: CertificateFingerprint(cert),
+		server:      server,
+	}, nil
+}
+
+// Stop shuts down the API server, waiting briefly for transfers in progress
+func (d *Daemon) Stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return d.server.Shutdown(ctx)
+}
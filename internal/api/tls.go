@@ -0,0 +1,102 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"time"
+
+	"github.com/notassigned/endershare/internal/database"
+)
+
+// LoadOrCreateCertificate returns the viewer's self-signed certificate,
+// generating and persisting one on first use so guests see a stable fingerprint.
+func LoadOrCreateCertificate(db *database.EndershareDB) (tls.Certificate, error) {
+	certPEM, keyPEM, err := db.GetViewerTLS()
+	if err == nil && certPEM != "" && keyPEM != "" {
+		cert, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+		if err == nil && cert.Leaf != nil && time.Now().Before(cert.Leaf.NotAfter) {
+			return cert, nil
+		}
+		fmt.Println("Warning: Regenerating viewer certificate")
+	}
+
+	certPEMBytes, keyPEMBytes, err := generateCertificate()
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	if err := db.SetViewerTLS(string(certPEMBytes), string(keyPEMBytes)); err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.X509KeyPair(certPEMBytes, keyPEMBytes)
+}
+
+// CertificateFingerprint returns the SHA-256 fingerprint of the leaf certificate
+// so guests can verify it out of band.
+func CertificateFingerprint(cert tls.Certificate) string {
+	if len(cert.Certificate) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256(cert.Certificate[0])
+	return fmt.Sprintf("%X", sum[:])
+}
+
+func generateCertificate() (certPEM, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "endershare viewer"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(2, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           localIPs(),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
+
+// localIPs lists the loopback and LAN addresses of this machine
+func localIPs() []net.IP {
+	ips := []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return ips
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() {
+			ips = append(ips, ipNet.IP)
+		}
+	}
+	return ips
+}
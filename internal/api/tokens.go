@@ -0,0 +1,154 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/notassigned/endershare/internal/database"
+	"github.com/notassigned/endershare/internal/storage"
+	"lukechampine.com/blake3"
+)
+
+// Tokens are presented as "Authorization: Bearer est_<id>_<secret>". The ID
+// selects the row; only a hash of the secret is stored.
+const tokenPrefix = "est_"
+
+// TokenInfo describes an issued token without its secret
+type TokenInfo struct {
+	ID      string
+	Name    string
+	Scope   Scope
+	Folder  storage.FolderID
+	Created time.Time
+	Expires time.Time // Zero for no expiry
+}
+
+// IssueToken creates a token with the given scope. folder limits upload
+// tokens to one folder; ttl of 0 never expires. The returned secret is shown
+// once and can't be recovered.
+func IssueToken(db *database.EndershareDB, name string, scope Scope, folder storage.FolderID, ttl time.Duration) (string, *TokenInfo, error) {
+	if folder != "" && scope != ScopeUpload {
+		return "", nil, fmt.Errorf("only upload tokens can be limited to a folder")
+	}
+
+	idBytes := make([]byte, 6)
+	secretBytes := make([]byte, 24)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", nil, err
+	}
+	if _, err := rand.Read(secretBytes); err != nil {
+		return "", nil, err
+	}
+	id := hex.EncodeToString(idBytes)
+	secret := base64.RawURLEncoding.EncodeToString(secretBytes)
+
+	now := time.Now()
+	info := &TokenInfo{ID: id, Name: name, Scope: scope, Folder: folder, Created: now}
+	var expires int64
+	if ttl > 0 {
+		info.Expires = now.Add(ttl)
+		expires = info.Expires.Unix()
+	}
+
+	err := db.AddToken(database.DBToken{
+		TokenID:    id,
+		Name:       name,
+		SecretHash: hashTokenSecret(secret),
+		Scope:      string(scope),
+		FolderID:   string(folder),
+		Created:    now.Unix(),
+		Expires:    expires,
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return tokenPrefix + id + "_" + secret, info, nil
+}
+
+// ListTokens returns every issued token
+func ListTokens(db *database.EndershareDB) []TokenInfo {
+	var tokens []TokenInfo
+	for _, t := range db.GetAllTokens() {
+		tokens = append(tokens, tokenInfo(t))
+	}
+	return tokens
+}
+
+// RevokeToken deletes a token by ID
+func RevokeToken(db *database.EndershareDB, id string) error {
+	found, err := db.RemoveToken(id)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("no token with id %s", id)
+	}
+	return nil
+}
+
+func tokenInfo(t database.DBToken) TokenInfo {
+	info := TokenInfo{
+		ID:      t.TokenID,
+		Name:    t.Name,
+		Scope:   Scope(t.Scope),
+		Folder:  storage.FolderID(t.FolderID),
+		Created: time.Unix(t.Created, 0),
+	}
+	if t.Expires > 0 {
+		info.Expires = time.Unix(t.Expires, 0)
+	}
+	return info
+}
+
+func hashTokenSecret(secret string) []byte {
+	sum := blake3.Sum256([]byte(secret))
+	return sum[:]
+}
+
+// TokenAuth accepts bearer capability tokens stored in the database
+type TokenAuth struct {
+	db *database.EndershareDB
+}
+
+// NewTokenAuth creates an authenticator over the tokens in db
+func NewTokenAuth(db *database.EndershareDB) *TokenAuth {
+	return &TokenAuth{db: db}
+}
+
+func (t *TokenAuth) Authenticate(r *http.Request) (Grant, bool) {
+	header := r.Header.Get("Authorization")
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok {
+		return Grant{}, false
+	}
+	token, ok = strings.CutPrefix(token, tokenPrefix)
+	if !ok {
+		return Grant{}, false
+	}
+	id, secret, ok := strings.Cut(token, "_")
+	if !ok {
+		return Grant{}, false
+	}
+
+	stored := t.db.GetToken(id)
+	if stored == nil {
+		return Grant{}, false
+	}
+	if subtle.ConstantTimeCompare(hashTokenSecret(secret), stored.SecretHash) != 1 {
+		return Grant{}, false
+	}
+	if stored.Expires > 0 && time.Now().Unix() > stored.Expires {
+		return Grant{}, false
+	}
+	scope, ok := ParseScope(stored.Scope)
+	if !ok {
+		return Grant{}, false
+	}
+	return Grant{Scope: scope, Folder: storage.FolderID(stored.FolderID)}, true
+}
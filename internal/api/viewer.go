@@ -0,0 +1,102 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	_ "embed"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/notassigned/endershare/internal/database"
+	"github.com/notassigned/endershare/internal/storage"
+)
+
+// DefaultViewerAddr is the listen address of the guest viewer
+const DefaultViewerAddr = ":8443"
+
+//go:embed viewer.html
+var viewerHTML []byte
+
+// Viewer is a read-only guest web UI served over HTTPS
+type Viewer struct {
+	URL         string
+	Password    string
+	Fingerprint string
+
+	server *http.Server
+}
+
+// StartViewer serves the guest viewer for the given folders on addr.
+// A random guest password is generated for every session.
+func StartViewer(db *database.EndershareDB, stor *storage.Storage, folders []storage.FolderID, addr string) (*Viewer, error) {
+	if addr == "" {
+		addr = DefaultViewerAddr
+	}
+
+	cert, err := LoadOrCreateCertificate(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load viewer certificate: %w", err)
+	}
+	auth, err := NewPasswordAuth()
+	if err != nil {
+		return nil, err
+	}
+
+	api := NewServer(stor, folders)
+	api.Handle("GET /{$}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(viewerHTML)
+	}))
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	server := &http.Server{
+		Handler:           RequireAuth(auth, api),
+		TLSConfig:         &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12},
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		if err := server.ServeTLS(listener, "", ""); err != nil && err != http.ErrServerClosed {
+			fmt.Println("Viewer server error:", err)
+		}
+	}()
+
+	return &Viewer{
+		URL:         viewerURL(listener.Addr()),
+		Password:    auth.Password,
+		Fingerprint: CertificateFingerprint(cert),
+		server:      server,
+	}, nil
+}
+
+// Stop shuts down the viewer, waiting briefly for downloads in progress
+func (v *Viewer) Stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return v.server.Shutdown(ctx)
+}
+
+// viewerURL picks a LAN address guests can reach when listening on all interfaces
+func viewerURL(addr net.Addr) string {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return "https://" + addr.String()
+	}
+	host := tcpAddr.IP
+	if host.IsUnspecified() {
+		host = net.IPv4(127, 0, 0, 1)
+		for _, ip := range localIPs() {
+			if ip.To4() != nil && !ip.IsLoopback() && ip.IsPrivate() {
+				host = ip
+				break
+			}
+		}
+	}
+	return "https://" + net.JoinHostPort(host.String(), fmt.Sprint(tcpAddr.Port))
+}
@@ -0,0 +1,183 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+const (
+	// updateAckProtocolID lets the master ask a peer which update it applied
+	updateAckProtocolID = "/endershare/update-ack/1.0"
+	updateAckDomainTag  = "endershare/update-ack"
+
+	updateAckInterval = time.Minute
+	updateAckTimeout  = 30 * time.Second
+	// updateAckDelay gives peers time to apply a change before they are asked
+	updateAckDelay = 10 * time.Second
+)
+
+// UpdateAck states the latest update a peer applied, signed with its peer
+// key. A peer only moves its update ID once the data of the update is stored.
+type UpdateAck struct {
+	PeerID    string `json:"peer_id"`
+	UpdateID  uint64 `json:"update_id"`
+	Timestamp int64  `json:"timestamp"`
+	Nonce     []byte `json:"nonce"` // From the master's request, so old acks can't be replayed
+}
+
+// SignedUpdateAck is an UpdateAck signed with the acknowledging peer's key
+type SignedUpdateAck struct {
+	AckBytes  []byte `json:"ack_bytes"` // JSON bytes of the ack
+	Signature []byte `json:"signature"` // Covers UpdateAck.CanonicalBytes
+}
+
+// UpdateAckRequest asks a peer for its ack
+type UpdateAckRequest struct {
+	Nonce []byte `json:"nonce"`
+}
+
+// CanonicalBytes returns the deterministic encoding covered by the peer signature
+func (a UpdateAck) CanonicalBytes() []byte {
+	e := &canonicalEncoder{}
+	e.writeString(updateAckDomainTag)
+	e.writeString(a.PeerID)
+	e.writeUint64(a.UpdateID)
+	e.writeInt64(a.Timestamp)
+	e.writeBytes(a.Nonce)
+	return e.Bytes()
+}
+
+// VerifyUpdateAck checks that an ack was signed by the peer it names
+func VerifyUpdateAck(signed SignedUpdateAck) (*UpdateAck, error) {
+	var a UpdateAck
+	if err := json.Unmarshal(signed.AckBytes, &a); err != nil {
+		return nil, fmt.Errorf("invalid update ack: %w", err)
+	}
+	id, err := peer.Decode(a.PeerID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid update ack peer: %w", err)
+	}
+	pub, err := id.ExtractPublicKey()
+	if err != nil {
+		return nil, err
+	}
+	ok, err := pub.Verify(a.CanonicalBytes(), signed.Signature)
+	if err != nil || !ok {
+		return nil, fmt.Errorf("update ack signature is invalid")
+	}
+	return &a, nil
+}
+
+// handleUpdateAckRequest answers the master's request with the update this
+// node applied last
+func (c *Core) handleUpdateAckRequest(s network.Stream) {
+	defer s.Close()
+
+	var req UpdateAckRequest
+	if err := json.NewDecoder(io.LimitReader(s, maxRequestSize)).Decode(&req); err != nil {
+		c.logStreamError(s, "decode request", err)
+		return
+	}
+	updateID, _ := c.db.GetCurrentUpdateID()
+	ack := UpdateAck{
+		PeerID:    c.GetNodeID(),
+		UpdateID:  updateID,
+		Timestamp: time.Now().Unix(),
+		Nonce:     req.Nonce,
+	}
+	ackBytes, err := json.Marshal(ack)
+	if err != nil {
+		return
+	}
+	signed := SignedUpdateAck{
+		AckBytes:  ackBytes,
+		Signature: ed25519.Sign(c.keys.PeerPrivateKey, ack.CanonicalBytes()),
+	}
+	if err := json.NewEncoder(s).Encode(signed); err != nil {
+		c.logStreamError(s, "send response", err)
+	}
+}
+
+// requestUpdateAck asks a peer for its ack and records it once verified
+func (c *Core) requestUpdateAck(from peer.ID) error {
+	req := UpdateAckRequest{Nonce: make([]byte, 32)}
+	if _, err := rand.Read(req.Nonce); err != nil {
+		return err
+	}
+	stream, err := c.p2pNode.NewStreamToPeer(from, updateAckProtocolID)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+	stream.SetDeadline(time.Now().Add(updateAckTimeout))
+
+	if err := json.NewEncoder(stream).Encode(req); err != nil {
+		return err
+	}
+	var signed SignedUpdateAck
+	if err := json.NewDecoder(io.LimitReader(stream, maxRequestSize)).Decode(&signed); err != nil {
+		return err
+	}
+	a, err := VerifyUpdateAck(signed)
+	if err != nil {
+		return err
+	}
+	if a.PeerID != from.String() || !bytes.Equal(a.Nonce, req.Nonce) {
+		return fmt.Errorf("update ack does not answer the request")
+	}
+	return c.db.SetUpdateAck(a.PeerID, a.UpdateID, a.Timestamp)
+}
+
+// collectUpdateAcks asks the online peers that haven't acknowledged every
+// recorded operation yet for their ack (master only)
+func (c *Core) collectUpdateAcks() {
+	for _, id := range c.undeliveredPeers() {
+		if online, _ := c.GetPeerStatus(id); !online {
+			continue
+		}
+		pid, err := peer.Decode(id)
+		if err != nil {
+			continue
+		}
+		if err := c.requestUpdateAck(pid); err != nil {
+			fmt.Printf("Warning: Failed to get update ack from %s: %v\n", id, err)
+		}
+	}
+}
+
+// kickUpdateAcks has the ack collection ask the peers soon, after an
+// operation was published
+func (c *Core) kickUpdateAcks() {
+	select {
+	case c.ackKick <- struct{}{}:
+	default:
+	}
+}
+
+// runUpdateAckCollection collects acks periodically and shortly after each
+// recorded operation, while some operation hasn't reached every peer (master only)
+func (c *Core) runUpdateAckCollection(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.ackKick:
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(updateAckDelay):
+			}
+		case <-time.After(c.jittered(updateAckInterval)):
+		}
+		c.collectUpdateAcks()
+	}
+}
@@ -0,0 +1,121 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/notassigned/endershare/internal/database"
+	"github.com/notassigned/endershare/internal/storage"
+)
+
+// progressBarWidth is the number of cells in a CLI progress bar
+const progressBarWidth = 30
+
+// AddMain (CLI only) adds local files to a vault folder given by its path,
+// showing a progress bar while each is encrypted (master only)
+func AddMain(args []string) {
+	if len(args) < 2 {
+		fmt.Println("Usage: endershare add <folder-path> <file> [file...]")
+		os.Exit(1)
+	}
+
+	c := coreStartup(false)
+	if !c.IsMaster() {
+		exitWithError(fmt.Errorf("%w can add files", ErrNotMaster))
+	}
+	if err := c.CheckWritable(); err != nil {
+		exitWithError(err)
+	}
+	if err := c.setupNotifyService(context.Background()); err != nil {
+		fmt.Println("Error setting up notify service:", err)
+	}
+	folderID, err := resolveFolderPath(c.storage, args[0])
+	if err != nil {
+		exitWithError(err)
+	}
+
+	for _, path := range args[1:] {
+		name := filepath.Base(path)
+		if lock := c.lockedElsewhere(name, folderID); lock != nil {
+			fmt.Printf("Warning: %s is checked out on %s\n", name, describeLock(*lock))
+		}
+		replaced, added, err := c.storage.ImportFile(path, name, folderID, func(done, total int64) {
+			fmt.Print("\r" + progressBar(name, done, total))
+		})
+		fmt.Println()
+		for _, entry := range added {
+			if err := c.publishEntry("ADD", entry); err != nil {
+				fmt.Println("Warning: Failed to publish data update:", err)
+			}
+		}
+		if replaced != nil {
+			if err := c.publishEntry("DELETE", replaced); err != nil {
+				fmt.Println("Warning: Failed to publish data update:", err)
+			}
+		}
+		if err != nil {
+			exitWithError(fmt.Errorf("adding %s: %w", path, err))
+		}
+		fmt.Println("Added", path)
+	}
+}
+
+// ImportMain (CLI only) extracts a zip or tar archive into a vault folder
+// given by its path, see storage.ImportArchive (master only)
+func ImportMain(args []string) {
+	if len(args) != 2 {
+		fmt.Println("Usage: endershare import <folder-path> <archive>")
+		os.Exit(1)
+	}
+
+	c := coreStartup(false)
+	if !c.IsMaster() {
+		exitWithError(fmt.Errorf("%w can import archives", ErrNotMaster))
+	}
+	if err := c.CheckWritable(); err != nil {
+		exitWithError(err)
+	}
+	if err := c.setupNotifyService(context.Background()); err != nil {
+		fmt.Println("Error setting up notify service:", err)
+	}
+	folderID, err := resolveFolderPath(c.storage, args[0])
+	if err != nil {
+		exitWithError(err)
+	}
+
+	replaced, added, err := c.storage.ImportArchive(args[1], folderID, func(p storage.ImportProgress) {
+		if p.Err != nil {
+			fmt.Printf("\nSkipped %s: %v\n", p.Path, p.Err)
+		}
+		fmt.Printf("\rImporting %d/%d", p.Done, p.Total)
+	})
+	fmt.Println()
+	// Whatever was imported before an error is published too
+	if perr := c.PublishBatchUpdate(added, replaced, nil); perr != nil {
+		fmt.Println("Warning: Failed to publish data update:", perr)
+	}
+	if err != nil {
+		exitWithError(err)
+	}
+	fmt.Printf("Imported %s, %d entries added\n", args[1], len(added))
+}
+
+// publishEntry publishes an ADD or DELETE update for one entry
+func (c *Core) publishEntry(action string, entry *database.DataEntry) error {
+	return c.PublishDataUpdate(action, entry.Key, entry.Value, entry.Size, entry.Hash, nil)
+}
+
+// progressBar renders a one-line progress bar such as
+// "movie.mkv [#########.....]  64% 1.2 GB of 1.9 GB"
+func progressBar(label string, done, total int64) string {
+	percent := int64(100)
+	if total > 0 {
+		percent = min(done*100/total, 100)
+	}
+	filled := int(percent) * progressBarWidth / 100
+	bar := strings.Repeat("#", filled) + strings.Repeat(".", progressBarWidth-filled)
+	return fmt.Sprintf("%s [%s] %3d%% %s of %s", truncate(label, 30), bar, percent, formatBytes(done), formatBytes(total))
+}
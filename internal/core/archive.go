@@ -0,0 +1,117 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/notassigned/endershare/internal/storage"
+)
+
+// ArchiveFile copies a file's blob to dir and marks the file as archived at
+// location, then frees the blob here. Replicas leave the file's content
+// behind as well. See storage.ArchiveFile (master only).
+func (c *Core) ArchiveFile(name string, folderID storage.FolderID, dir, location string) error {
+	if !c.IsMaster() || c.storage == nil {
+		return fmt.Errorf("%w can archive files", ErrNotMaster)
+	}
+	if err := c.CheckWritable(); err != nil {
+		return err
+	}
+	removed, added, err := c.storage.ArchiveFile(name, folderID, dir, location)
+	if err != nil {
+		return err
+	}
+	if err := c.PublishModifyUpdate(removed, added, nil); err != nil {
+		return err
+	}
+	c.evictArchived()
+	return nil
+}
+
+// RestoreArchived re-ingests an archived file from the archive in dir,
+// verifying it against the file's hash, so replicas replicate it again. See
+// storage.RestoreArchived (master only).
+func (c *Core) RestoreArchived(name string, folderID storage.FolderID, dir string) error {
+	if !c.IsMaster() || c.storage == nil {
+		return fmt.Errorf("%w can restore archived files", ErrNotMaster)
+	}
+	if err := c.CheckWritable(); err != nil {
+		return err
+	}
+	removed, added, err := c.storage.RestoreArchived(name, folderID, dir)
+	if err != nil {
+		return err
+	}
+	return c.PublishModifyUpdate(removed, added, nil)
+}
+
+// evictArchived frees the blobs only archived files use
+func (c *Core) evictArchived() {
+	evicted, freed, err := c.storage.EvictArchived()
+	if err != nil {
+		fmt.Println("Warning: Failed to evict archived files:", err)
+		return
+	}
+	if evicted > 0 {
+		fmt.Printf("Archived files: %d evicted (%s freed)\n", evicted, formatBytes(freed))
+	}
+}
+
+// ArchiveMain (CLI only) lists the archived files, archives a file to a
+// directory or restores it from there (master only)
+func ArchiveMain(args []string) {
+	c := coreStartup(false)
+	if c.storage == nil {
+		exitWithError(fmt.Errorf("this node does not store file contents"))
+	}
+	if len(args) == 0 {
+		files, err := c.storage.ListArchived()
+		if err != nil {
+			exitWithError(err)
+		}
+		if len(files) == 0 {
+			fmt.Println("No file is archived")
+			return
+		}
+		slices.SortFunc(files, func(a, b storage.ArchivedFile) int { return strings.Compare(a.Archive.Location, b.Archive.Location) })
+		for _, f := range files {
+			fmt.Printf("%s  %s  %s (%s)\n", f.Archive.ArchivedAt.Format(time.DateOnly), f.Archive.Location, path.Join(folderPath(c.storage, f.FolderID), f.Name), formatBytes(f.Size))
+		}
+		return
+	}
+
+	restore := args[0] == "--restore"
+	if restore {
+		args = args[1:]
+	}
+	if len(args) < 2 || (restore && len(args) > 2) {
+		fmt.Println("Usage: endershare archive [<path> <dir> [location] | --restore <path> <dir>]")
+		os.Exit(1)
+	}
+	if !c.IsMaster() {
+		exitWithError(fmt.Errorf("%w can archive files", ErrNotMaster))
+	}
+	if err := c.setupNotifyService(context.Background()); err != nil {
+		fmt.Println("Error setting up notify service:", err)
+	}
+	folderID, name, err := resolveFilePath(c.storage, args[0])
+	if err != nil {
+		exitWithError(err)
+	}
+	if restore {
+		if err := c.RestoreArchived(name, folderID, args[1]); err != nil {
+			exitWithError(err)
+		}
+		fmt.Println("Restored", args[0], "from", args[1])
+		return
+	}
+	if err := c.ArchiveFile(name, folderID, args[1], strings.Join(args[2:], " ")); err != nil {
+		exitWithError(err)
+	}
+	fmt.Println("Archived", args[0], "to", args[1])
+}
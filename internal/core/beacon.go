@@ -0,0 +1,139 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/notassigned/endershare/internal/crypto"
+	"github.com/notassigned/endershare/internal/database"
+	"github.com/notassigned/endershare/internal/p2p"
+)
+
+// Beacon runs put a record in the public DHT, so they are rate limited and
+// kept short
+const (
+	beaconMinInterval   = 10 * time.Minute
+	DefaultBeaconWindow = time.Minute
+	maxBeaconWindow     = 5 * time.Minute
+)
+
+// ErrBeaconRateLimited is returned when a beacon ran too recently
+var ErrBeaconRateLimited = errors.New("a connectivity beacon ran recently")
+
+// ConnectivityReport is a beacon report with the software that produced it
+type ConnectivityReport struct {
+	Version  string `json:"version"`
+	Platform string `json:"platform"`
+	*p2p.ConnectivityReport
+}
+
+// RunBeacon runs a connectivity beacon on this node's P2P host
+func (c *Core) RunBeacon(ctx context.Context, window time.Duration) (*ConnectivityReport, error) {
+	return runBeacon(ctx, c.db, c.p2pNode, window)
+}
+
+func runBeacon(ctx context.Context, db *database.EndershareDB, node *p2p.P2PNode, window time.Duration) (*ConnectivityReport, error) {
+	if window <= 0 || window > maxBeaconWindow {
+		return nil, fmt.Errorf("beacon window must be between 1s and %s", maxBeaconWindow)
+	}
+	if wait := time.Until(db.GetLastBeacon().Add(beaconMinInterval)); wait > 0 {
+		return nil, fmt.Errorf("%w, try again in %s", ErrBeaconRateLimited, wait.Round(time.Second))
+	}
+	if err := db.SetLastBeacon(time.Now()); err != nil {
+		return nil, err
+	}
+
+	report, err := node.RunBeacon(ctx, window)
+	if err != nil {
+		return nil, err
+	}
+	return &ConnectivityReport{
+		Version:            Version,
+		Platform:           runtime.GOOS + "/" + runtime.GOARCH,
+		ConnectivityReport: report,
+	}, nil
+}
+
+// RunStandaloneBeacon runs a beacon from a throwaway identity, so it works
+// before binding and reveals nothing about the vault
+func RunStandaloneBeacon(ctx context.Context, db *database.EndershareDB, window time.Duration) (*ConnectivityReport, error) {
+	keys := crypto.CreatePeerOnlyKeys()
+
+	// Probe the usual port so NAT mappings match a real node; if a node is
+	// already running there, fall back to a random port
+	node, err := p2p.NewP2PNode(keys.PeerPrivateKey, ctx, nil, 13000, transportOptions(db))
+	if err != nil {
+		fmt.Println("Port 13000 is in use, probing from a random port")
+		node, err = p2p.NewP2PNode(keys.PeerPrivateKey, ctx, nil, 0, transportOptions(db))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error starting P2P node: %w", err)
+	}
+	defer node.Close()
+
+	return runBeacon(ctx, db, node, window)
+}
+
+// BeaconMain (CLI only) runs a standalone connectivity beacon and writes the report
+func BeaconMain(args []string) {
+	window := DefaultBeaconWindow
+	out := fmt.Sprintf("endershare-connectivity-%s.json", time.Now().Format("20060102-150405"))
+	for i := 0; i+1 < len(args); i += 2 {
+		switch args[i] {
+		case "--window":
+			d, err := time.ParseDuration(args[i+1])
+			if err != nil {
+				fmt.Println("Error: invalid window:", args[i+1])
+				os.Exit(1)
+			}
+			window = d
+		case "--out":
+			out = args[i+1]
+		default:
+			fmt.Println("Usage: endershare beacon [--window duration] [--out file]")
+			os.Exit(1)
+		}
+	}
+
+	fmt.Printf("Running connectivity beacon for %s...\n", window)
+	report, err := RunStandaloneBeacon(context.Background(), database.Create(), window)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+
+	ok := 0
+	for _, b := range report.Bootstrap {
+		if b.OK {
+			ok++
+		}
+	}
+	fmt.Printf("Bootstrap servers reached: %d/%d\n", ok, len(report.Bootstrap))
+	fmt.Println("Reachability:", report.Reachability)
+	if report.AdvertiseOK {
+		fmt.Printf("DHT advertise: ok (%d ms)\n", report.AdvertiseMs)
+	} else {
+		fmt.Println("DHT advertise: failed:", report.AdvertiseError)
+	}
+	fmt.Printf("DHT servers answering lookup: %d, routing table: %d\n", len(report.DHTServers), report.DHTPeers)
+	fmt.Printf("Relays available: %d\n", len(report.Relays))
+	for transport, n := range report.Transports {
+		fmt.Printf("  %s connections: %d\n", transport, n)
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(out, data, 0644); err != nil {
+		fmt.Println("Error writing report:", err)
+		os.Exit(1)
+	}
+	fmt.Println("Report written to", out)
+}
@@ -0,0 +1,162 @@
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/notassigned/endershare/internal/p2p"
+)
+
+// PendingBinding is a binding of a new peer the master is running. Every
+// binding has its own phrase and context, so several devices can be set up
+// at the same time.
+type PendingBinding struct {
+	ID        string
+	Phrase    string
+	Stage     p2p.BindStage
+	PeerID    string // The peer being bound, empty while searching
+	StartedAt time.Time
+}
+
+type pendingBinding struct {
+	PendingBinding
+	cancel context.CancelFunc
+}
+
+// bindingTable tracks the bindings in progress by ID
+type bindingTable struct {
+	mu      sync.Mutex
+	pending map[string]*pendingBinding
+	commit  sync.Mutex // Serializes adding and publishing bound peers
+}
+
+// normalizePhrase makes phrases that differ only in case or spacing compare equal
+func normalizePhrase(phrase string) string {
+	return strings.Join(strings.Fields(strings.ToLower(phrase)), " ")
+}
+
+// add registers a binding of syncPhrase, failing if the phrase is already
+// being bound. The returned context is cancelled by CancelPeerBinding.
+func (t *bindingTable) add(ctx context.Context, syncPhrase string) (*pendingBinding, context.Context, error) {
+	phrase := normalizePhrase(syncPhrase)
+	if phrase == "" {
+		return nil, nil, fmt.Errorf("empty sync phrase")
+	}
+	var id [8]byte
+	rand.Read(id[:])
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, b := range t.pending {
+		if b.Phrase == phrase {
+			return nil, nil, fmt.Errorf("phrase %q is already being bound", phrase)
+		}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	b := &pendingBinding{
+		PendingBinding: PendingBinding{
+			ID:        hex.EncodeToString(id[:]),
+			Phrase:    phrase,
+			Stage:     p2p.BindSearching,
+			StartedAt: time.Now(),
+		},
+		cancel: cancel,
+	}
+	if t.pending == nil {
+		t.pending = map[string]*pendingBinding{}
+	}
+	t.pending[b.ID] = b
+	return b, ctx, nil
+}
+
+func (t *bindingTable) update(id string, p BindProgress) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if b, ok := t.pending[id]; ok {
+		b.Stage = p.Stage
+		b.PeerID = p.PeerID
+	}
+}
+
+func (t *bindingTable) remove(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if b, ok := t.pending[id]; ok {
+		b.cancel()
+		delete(t.pending, id)
+	}
+}
+
+// StartPeerBinding starts binding the peer showing syncPhrase in the
+// background (master only) and returns the ID of the binding. progress
+// receives every stage with that ID, ending with p2p.BindDone or
+// p2p.BindFailed, after which the binding leaves the table. Cancelling ctx
+// cancels the binding like CancelPeerBinding.
+func (c *Core) StartPeerBinding(ctx context.Context, syncPhrase string, progress func(id string, p BindProgress)) (string, error) {
+	if c.keys.MasterPrivateKey == nil {
+		return "", fmt.Errorf("%w can bind new peers", ErrNotMaster)
+	}
+	b, ctx, err := c.bindings.add(ctx, syncPhrase)
+	if err != nil {
+		return "", err
+	}
+	go c.runPeerBinding(ctx, b, func(p BindProgress) {
+		if progress != nil {
+			progress(b.ID, p)
+		}
+	})
+	return b.ID, nil
+}
+
+// runPeerBinding runs a binding registered in the table and removes it when done
+func (c *Core) runPeerBinding(ctx context.Context, b *pendingBinding, progress func(BindProgress)) error {
+	defer c.bindings.remove(b.ID)
+	report := func(p BindProgress) {
+		c.bindings.update(b.ID, p)
+		progress(p)
+	}
+	var peerID string
+	restored, err := c.bindNewPeer(ctx, b.Phrase, func(stage p2p.BindStage, id peer.ID) {
+		peerID = id.String()
+		report(BindProgress{Stage: stage, PeerID: peerID})
+	})
+	if err != nil {
+		report(BindProgress{Stage: p2p.BindFailed, PeerID: peerID, Err: err})
+		return err
+	}
+	report(BindProgress{Stage: p2p.BindDone, PeerID: peerID, Restored: restored})
+	return nil
+}
+
+// CancelPeerBinding cancels a binding in progress. It reports false if no
+// binding has the ID, e.g. because it already ended.
+func (c *Core) CancelPeerBinding(id string) bool {
+	c.bindings.mu.Lock()
+	defer c.bindings.mu.Unlock()
+	b, ok := c.bindings.pending[id]
+	if ok {
+		b.cancel()
+	}
+	return ok
+}
+
+// PendingBindings lists the bindings in progress, oldest first
+func (c *Core) PendingBindings() []PendingBinding {
+	c.bindings.mu.Lock()
+	defer c.bindings.mu.Unlock()
+	list := make([]PendingBinding, 0, len(c.bindings.pending))
+	for _, b := range c.bindings.pending {
+		list = append(list, b.PendingBinding)
+	}
+	slices.SortFunc(list, func(a, b PendingBinding) int {
+		return a.StartedAt.Compare(b.StartedAt)
+	})
+	return list
+}
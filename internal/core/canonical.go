@@ -0,0 +1,216 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+)
+
+// Update encoding versions. The version is carried in Update.Version and
+// selects which bytes the master signature covers.
+const (
+	// UpdateEncodingLegacyJSON signs the raw JSON in SignedUpdate.UpdateBytes.
+	// Updates without a version field are treated as this encoding.
+	UpdateEncodingLegacyJSON = 1
+	// UpdateEncodingCanonical signs the length-prefixed encoding produced by
+	// Update.CanonicalBytes, so re-marshaling the JSON can't break verification.
+	UpdateEncodingCanonical = 2
+	// UpdateEncodingKeyEpoch adds Update.KeyEpoch to the canonical encoding
+	UpdateEncodingKeyEpoch = 3
+	// UpdateEncodingModify adds DataUpdate.PrevKey and PrevHash, which name
+	// the entry a MODIFY replaces
+	UpdateEncodingModify = 4
+	// UpdateEncodingDigestKey adds Update.DigestKeyID, which is set when the
+	// update's digests are keyed with the vault digest key
+	UpdateEncodingDigestKey = 5
+	// UpdateEncodingBatch adds DataUpdate.Batch and Subtree, which carry the
+	// updates of a BATCH
+	UpdateEncodingBatch = 6
+	// UpdateEncodingNote adds DataUpdate.Note, the sealed change note
+	UpdateEncodingNote = 7
+
+	CurrentUpdateEncoding = UpdateEncodingNote
+)
+
+// Peer list hash versions
+const (
+	// PeerListHashLegacy concatenates sorted peer IDs without delimiters
+	PeerListHashLegacy = 1
+	// PeerListHashLengthPrefixed length-prefixes every sorted peer ID
+	PeerListHashLengthPrefixed = 2
+	// PeerListHashKeyed is PeerListHashLengthPrefixed keyed with the digest key
+	PeerListHashKeyed = 3
+)
+
+const (
+	updateDomainTag   = "endershare/update"
+	peerListDomainTag = "endershare/peer-list"
+)
+
+// canonicalEncoder writes fixed-width integers and length-prefixed byte fields.
+// Every variable-length field carries a 4-byte big-endian length so no two
+// distinct field sequences produce the same encoding.
+type canonicalEncoder struct {
+	buf bytes.Buffer
+}
+
+func (e *canonicalEncoder) writeUint16(v uint16) {
+	binary.Write(&e.buf, binary.BigEndian, v)
+}
+
+func (e *canonicalEncoder) writeUint32(v uint32) {
+	binary.Write(&e.buf, binary.BigEndian, v)
+}
+
+func (e *canonicalEncoder) writeUint64(v uint64) {
+	binary.Write(&e.buf, binary.BigEndian, v)
+}
+
+func (e *canonicalEncoder) writeInt64(v int64) {
+	binary.Write(&e.buf, binary.BigEndian, v)
+}
+
+func (e *canonicalEncoder) writeBool(v bool) {
+	if v {
+		e.buf.WriteByte(1)
+	} else {
+		e.buf.WriteByte(0)
+	}
+}
+
+func (e *canonicalEncoder) writeBytes(b []byte) {
+	e.writeUint32(uint32(len(b)))
+	e.buf.Write(b)
+}
+
+func (e *canonicalEncoder) writeString(s string) {
+	e.writeBytes([]byte(s))
+}
+
+func (e *canonicalEncoder) writeStrings(ss []string) {
+	e.writeUint32(uint32(len(ss)))
+	for _, s := range ss {
+		e.writeString(s)
+	}
+}
+
+func (e *canonicalEncoder) writeByteSlices(bs [][]byte) {
+	e.writeUint32(uint32(len(bs)))
+	for _, b := range bs {
+		e.writeBytes(b)
+	}
+}
+
+// writeDataUpdate writes the fields of a data update that the encoding
+// version covers, and those of the updates in its batch. Updates setting
+// fields their version doesn't cover are refused, see checkVersionFields.
+func (e *canonicalEncoder) writeDataUpdate(d DataUpdate, version int) {
+	e.writeString(d.Action)
+	e.writeBytes(d.Key)
+	e.writeBytes(d.Value)
+	e.writeInt64(d.Size)
+	e.writeBytes(d.Hash)
+	if version >= UpdateEncodingModify {
+		e.writeBytes(d.PrevKey)
+		e.writeBytes(d.PrevHash)
+	}
+	if version >= UpdateEncodingBatch {
+		e.writeUint32(uint32(len(d.Batch)))
+		for _, op := range d.Batch {
+			e.writeDataUpdate(op, version)
+		}
+		e.writeByteSlices(d.Subtree)
+	}
+	if version >= UpdateEncodingNote {
+		e.writeBytes(d.Note)
+	}
+}
+
+func (e *canonicalEncoder) Bytes() []byte {
+	return e.buf.Bytes()
+}
+
+// CanonicalBytes returns the deterministic encoding of the update that is
+// covered by the master signature for UpdateEncodingCanonical.
+func (u Update) CanonicalBytes() ([]byte, error) {
+	e := &canonicalEncoder{}
+	e.writeString(updateDomainTag)
+	e.writeUint16(uint16(u.Version))
+	e.writeUint64(u.UpdateID)
+	e.writeBytes(u.PeerListHash)
+	e.writeBytes(u.PrevPeerListHash)
+	e.writeBytes(u.DataHash)
+	e.writeBytes(u.PrevDataHash)
+	e.writeUint64(uint64(u.NumBuckets))
+	e.writeString(u.UpdateDataType)
+
+	switch u.UpdateDataType {
+	case "PEER":
+		peerUpdate, err := u.PeerUpdate()
+		if err != nil {
+			return nil, err
+		}
+		e.writeString(peerUpdate.Action)
+		e.writeString(peerUpdate.PeerID)
+		e.writeStrings(peerUpdate.Addresses)
+	case "DATA":
+		dataUpdate, err := u.DataUpdate()
+		if err != nil {
+			return nil, err
+		}
+		e.writeDataUpdate(dataUpdate, u.Version)
+	case "RELEASE":
+		var manifest ReleaseManifest
+		if err := json.Unmarshal(u.UpdateData, &manifest); err != nil {
+			return nil, err
+		}
+		e.writeString(manifest.Version)
+		e.writeString(manifest.GOOS)
+		e.writeString(manifest.GOARCH)
+		e.writeBytes(manifest.FileHash)
+		e.writeInt64(manifest.Size)
+		e.writeString(manifest.Notes)
+		e.writeInt64(manifest.Published)
+	default:
+		// Unknown payloads are covered verbatim
+		e.writeBytes(u.UpdateData)
+	}
+
+	e.writeInt64(u.Timestamp)
+	if u.Version >= UpdateEncodingKeyEpoch {
+		e.writeUint32(u.KeyEpoch)
+	}
+	if u.Version >= UpdateEncodingDigestKey {
+		e.writeBytes(u.DigestKeyID)
+	}
+	return e.Bytes(), nil
+}
+
+// EncodingVersion returns the signature encoding version of the update
+func (u Update) EncodingVersion() int {
+	if u.Version == 0 {
+		return UpdateEncodingLegacyJSON
+	}
+	return u.Version
+}
+
+// PeerUpdate decodes the update payload as a PeerUpdate
+func (u Update) PeerUpdate() (PeerUpdate, error) {
+	var peerUpdate PeerUpdate
+	if u.UpdateDataType != "PEER" {
+		return peerUpdate, fmt.Errorf("update %d is not a peer update", u.UpdateID)
+	}
+	err := json.Unmarshal(u.UpdateData, &peerUpdate)
+	return peerUpdate, err
+}
+
+// DataUpdate decodes the update payload as a DataUpdate
+func (u Update) DataUpdate() (DataUpdate, error) {
+	var dataUpdate DataUpdate
+	if u.UpdateDataType != "DATA" {
+		return dataUpdate, fmt.Errorf("update %d is not a data update", u.UpdateID)
+	}
+	err := json.Unmarshal(u.UpdateData, &dataUpdate)
+	return dataUpdate, err
+}
@@ -0,0 +1,56 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// A database restored from its backup, or rebuilt around salvaged keys, may
+// be behind updates the master already published. Publishing from it would
+// reuse update IDs peers have applied, so the node publishes nothing until a
+// peer answered with its latest signed update and the answers that arrived
+// in the following round were applied, leaving it at the highest of them.
+
+// catchUpRound is how long the node waits for answers to each request
+const catchUpRound = 3 * time.Second
+
+// checkSynced returns ErrNotSynced while the node is catching up
+func (c *Core) checkSynced() error {
+	if c.db.GetUnsynced() {
+		return ErrNotSynced
+	}
+	return nil
+}
+
+// catchUp asks peers for their latest update until the node has caught up.
+// applying is held while a received update is applied.
+func (c *Core) catchUp(ctx context.Context, applying sync.Locker) {
+	if len(c.GetOtherPeerIDs()) == 0 {
+		// No peer has updates this node could have missed
+		c.db.SetUnsynced(false)
+		return
+	}
+	fmt.Println("Database was recovered, catching up with peers before publishing")
+	c.peerAnswered.Store(false)
+	answered := false
+	for {
+		c.RequestLatestUpdate()
+		select {
+		case <-time.After(catchUpRound):
+		case <-ctx.Done():
+			return
+		}
+		if answered {
+			break
+		}
+		answered = c.peerAnswered.Load()
+	}
+
+	applying.Lock()
+	defer applying.Unlock()
+	c.db.SetUnsynced(false)
+	currentID, _ := c.db.GetCurrentUpdateID()
+	fmt.Println("Caught up with peers at update", currentID)
+}
@@ -0,0 +1,86 @@
+package core
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/notassigned/endershare/internal/database"
+	"github.com/notassigned/endershare/internal/storage"
+)
+
+// Change is a data update as shown in the activity feed
+type Change struct {
+	UpdateID uint64
+	Time     time.Time
+	Action   string // "ADD", "MODIFY", "DELETE" or "BATCH"
+	Entries  int    // Number of entries the update changes
+	Note     string // Empty without a change note or the vault key
+}
+
+// RecentChanges returns the data updates among the latest limit updates,
+// newest first
+func (c *Core) RecentChanges(limit int) ([]Change, error) {
+	updates, err := recentUpdates(c.db, limit)
+	if err != nil {
+		return nil, err
+	}
+	var changes []Change
+	for _, update := range updates {
+		if update.UpdateDataType != "DATA" {
+			continue
+		}
+		dataUpdate, err := update.DataUpdate()
+		if err != nil {
+			continue
+		}
+		changes = append(changes, Change{
+			UpdateID: update.UpdateID,
+			Time:     time.Unix(update.Timestamp, 0),
+			Action:   dataUpdate.Action,
+			Entries:  changedEntries(dataUpdate),
+			Note:     changeNote(c.storage, dataUpdate),
+		})
+	}
+	return changes, nil
+}
+
+// recentUpdates returns up to limit of the latest updates stored, newest
+// first, skipping any that can't be decoded
+func recentUpdates(db *database.EndershareDB, limit int) ([]Update, error) {
+	signedUpdates, err := db.GetRecentUpdates(limit)
+	if err != nil {
+		return nil, err
+	}
+	updates := make([]Update, 0, len(signedUpdates))
+	for _, s := range signedUpdates {
+		var signedUpdate SignedUpdate
+		if err := json.Unmarshal([]byte(s), &signedUpdate); err != nil {
+			continue
+		}
+		if update, err := signedUpdate.GetUpdate(); err == nil {
+			updates = append(updates, update)
+		}
+	}
+	return updates, nil
+}
+
+// changedEntries returns the number of entries a data update changes
+func changedEntries(dataUpdate DataUpdate) int {
+	if dataUpdate.Action == "BATCH" {
+		return len(dataUpdate.Batch)
+	}
+	return 1
+}
+
+// changeNote returns the change note of a data update, empty if it has none
+// or stor can't decrypt it
+func changeNote(stor *storage.Storage, dataUpdate DataUpdate) string {
+	if stor == nil || dataUpdate.Note == nil {
+		return ""
+	}
+	note, err := stor.OpenChangeNote(dataUpdate.Note)
+	if err != nil {
+		return ""
+	}
+	return note
+}
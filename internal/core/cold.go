@@ -0,0 +1,86 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/notassigned/endershare/internal/database"
+	"github.com/notassigned/endershare/internal/storage"
+)
+
+// ColdMain (CLI only) shows what this node offloaded to its cold storage,
+// offloads the files and folders at the given vault paths, the whole vault
+// without any, or deletes the offloaded blobs no file uses anymore
+func ColdMain(args []string) {
+	db := database.Create()
+	keys := db.GetKeys()
+	if keys == nil || keys.AESKey == nil {
+		exitWithError(fmt.Errorf("this node does not store file contents"))
+	}
+	stor := storage.NewStorage(db, keys.AESKey)
+	cold := stor.ColdStore()
+	if cold == nil {
+		exitWithError(fmt.Errorf("%w, see endershare config cold-storage", storage.ErrNoColdStore))
+	}
+
+	if len(args) == 0 {
+		var offloaded, cached int
+		var bytes int64
+		for _, b := range db.GetColdBlobs() {
+			offloaded++
+			bytes += b.Size
+			if db.GetDownloadProgress(b.BlobHash) >= b.Size {
+				cached++
+			}
+		}
+		fmt.Println("Cold storage:", cold)
+		fmt.Printf("%d blobs offloaded (%s), %d of them fetched back and stored locally\n", offloaded, formatBytes(bytes), cached)
+		return
+	}
+
+	switch args[0] {
+	case "offload":
+		paths := args[1:]
+		if len(paths) == 0 {
+			paths = []string{"/"}
+		}
+		for _, p := range paths {
+			n, freed, err := offloadPath(stor, p)
+			if err != nil {
+				exitWithError(err)
+			}
+			fmt.Printf("Offloaded %s: %d blobs, %s freed\n", p, n, formatBytes(freed))
+		}
+
+	case "prune":
+		n, size, err := stor.PruneCold()
+		if err != nil {
+			exitWithError(err)
+		}
+		fmt.Printf("Deleted %d blobs no file uses anymore (%s)\n", n, formatBytes(size))
+
+	default:
+		fmt.Println("Usage: endershare cold [offload [<path>...] | prune]")
+		os.Exit(1)
+	}
+}
+
+// offloadPath offloads the folder at a vault path, or the file if no folder
+// is there, and returns the blobs offloaded and the bytes freed
+func offloadPath(stor *storage.Storage, p string) (int, int64, error) {
+	if id, err := resolveFolderPath(stor, p); err == nil {
+		return stor.OffloadFolder(id)
+	} else if !errors.Is(err, storage.ErrNotFound) {
+		return 0, 0, err
+	}
+	folderID, name, err := resolveFilePath(stor, p)
+	if err != nil {
+		return 0, 0, err
+	}
+	freed, err := stor.OffloadFile(name, folderID)
+	if freed == 0 {
+		return 0, 0, err
+	}
+	return 1, freed, err
+}
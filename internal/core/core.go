@@ -1,8 +1,13 @@
 package core
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/libp2p/go-libp2p/core/peer"
@@ -12,69 +17,142 @@ import (
 	"github.com/notassigned/endershare/internal/storage"
 )
 
+// Sync protocol IDs. Version 1.1 streams begin with the vault fingerprint hello.
+const (
+	peerListProtocolID         = "/endershare/peer-list/1.1"
+	treeBucketHashesProtocolID = "/endershare/tree-bucket-hashes/1.1"
+	dataBucketHashesProtocolID = "/endershare/data-bucket-hashes/1.1"
+	metadataProtocolID         = "/endershare/metadata/1.1"
+	fileDataProtocolID         = "/endershare/file-data/1.1"
+)
+
+// ErrNotMaster is wrapped by errors from operations that need the master private key
+var ErrNotMaster = errors.New("only master nodes")
+
+// ErrNotSynced is returned by publishing while a recovered database catches
+// up with its peers
+var ErrNotSynced = errors.New("database was recovered and hasn't caught up with peers yet")
+
+// ErrBindingCancelled is passed to a binding's onDone when its context was cancelled
+var ErrBindingCancelled = errors.New("binding cancelled")
+
+// ErrPeerBanned is returned when a device that was removed with a ban tries to bind again
+var ErrPeerBanned = errors.New("device is banned from this vault")
+
 type Core struct {
 	p2pNode       *p2p.P2PNode
 	keys          *crypto.CryptoKeys
 	db            *database.EndershareDB
 	storage       *storage.Storage
 	merkleTree    *crypto.MerkleTree
+	digestKey     []byte // Keys exchanged digests, nil until this node has it
 	publishUpdate func([]byte) error
 	OnDataUpdated func() // Called when data is synced from another device
+	// Called when a release published by the master has been verified and staged
+	OnReleaseStaged func(manifest ReleaseManifest)
+	// Called after every data reconciliation round
+	OnSyncRound   func(round SyncRound)
+	republishRoot bool // Set when the data root differs from the latest published update
+	syncRounds    syncRoundLog
+	events        eventBus
+	peerAddrs     peerAddrCoalescer
+	peerTable     sync.Mutex // Keeps the peers table and the p2p peer map in step
+	bindings      bindingTable
+	uploads       chan struct{} // Slots for served file streams, see acquireUpload
+	uploadsOnce   sync.Once
+	newestUpdate  atomic.Uint64 // Highest update ID seen with a valid signature, for alerts
+	peerAnswered  atomic.Bool   // A peer's update was processed, see catchUp
+	fetches       blobFetches   // Placeholder blobs being fetched on first read
+	ackKick       chan struct{} // Asks for update acks soon, see kickUpdateAcks
 }
 
 func coreStartup(initMode bool) *Core {
-	core := &Core{
-		db: database.Create(),
-	}
+	db := database.Create()
 
 	//Check for keys in db
-	keys := core.db.GetKeys()
+	keys := db.GetKeys()
 	if keys == nil {
 		if initMode {
 			// Master node initialization - generate full keys
 			var mnemonic string
 			keys, mnemonic = crypto.CreateCryptoKeys()
-			core.db.StoreKeys(keys)
+			db.StoreKeys(keys)
 			fmt.Println("Generated new keys with mnemonic:", mnemonic)
-		} else {
+		} else if keys = db.GetPeerKeys(); keys == nil {
 			// Replica node - generate peer-only keys
 			keys = crypto.CreatePeerOnlyKeys()
-			core.db.StoreKeys(keys)
+			db.StoreKeys(keys)
 			fmt.Println("Generated peer keys (waiting for network binding)")
 		}
 	}
 
 	ctx := context.Background()
-	p2pNode, err := p2p.NewP2PNode(keys.PeerPrivateKey, ctx, core.db.GetPeers(), 13000)
+	p2pNode, err := p2p.NewP2PNode(keys.PeerPrivateKey, ctx, db.GetPeers(), 13000, transportOptions(db))
 	if err != nil {
 		panic(fmt.Sprintf("Error starting P2P node: %v", err))
 	}
 
-	core.p2pNode = p2pNode
-	core.keys = keys
 	// Storage might not have AES key yet for replica nodes - will be set after binding
+	var stor *storage.Storage
 	if keys.AESKey != nil {
-		core.storage = storage.NewStorage(core.db, keys.AESKey)
-		core.storage.BackfillFolderTags()
+		stor = storage.NewStorage(db, keys.AESKey)
+	}
+	return newCore(db, keys, p2pNode, stor)
+}
+
+// newCore wires a core around an open database, its keys and a started p2p node
+func newCore(db *database.EndershareDB, keys *crypto.CryptoKeys, p2pNode *p2p.P2PNode, stor *storage.Storage) *Core {
+	core := &Core{
+		db:      db,
+		p2pNode: p2pNode,
+		keys:    keys,
+		storage: stor,
+		ackKick: make(chan struct{}, 1),
+	}
+	core.restorePeerstore()
+	if keys.MasterPublicKey != nil {
+		p2pNode.SetVaultFingerprint(crypto.VaultFingerprint(keys.MasterPublicKey))
 	}
+	if stor != nil {
+		stor.BackfillFolderTags()
+		stor.SetBlobFetcher(core.fetchBlob)
+	}
+
+	core.loadDigestKey()
 
 	// Initialize node table properties if not set
 	core.initializeNodeProperties()
 
 	// Build merkle tree from data table
-	dataHashes := core.db.GetAllDataHashes()
-	core.merkleTree = crypto.NewMerkleTree(dataHashes)
+	core.merkleTree = buildDataTree(core.db, crypto.NumBucketsFor(core.db.CountData()), core.digestKey)
 
 	// Store merkle root in node properties
 	rootHash := core.merkleTree.GetRootHash()
 	core.db.SetDataRootHash(rootHash)
 
+	// A master that committed data but crashed before publishing the update
+	// republishes its root once the notify service is up
+	if keys.MasterPrivateKey != nil && !core.republishRoot && core.dataRootUnpublished(rootHash) {
+		fmt.Println("Warning: Local data was committed but never published, will resync peers")
+		core.republishRoot = true
+	}
+
 	// Setup sync stream handlers
 	core.setupSyncHandlers()
 
 	return core
 }
 
+// buildDataTree builds the merkle tree of the data table, streaming the
+// hashes from the database instead of loading them all first
+func buildDataTree(db *database.EndershareDB, numBuckets int, key []byte) *crypto.MerkleTree {
+	b := crypto.NewMerkleTreeBuilder(numBuckets, key)
+	if err := db.ForEachDataHash(b.Add); err != nil {
+		fmt.Println("Warning: Failed to read data hashes:", err)
+	}
+	return b.Build()
+}
+
 // initializeNodeProperties initializes node table properties if they don't exist
 func (c *Core) initializeNodeProperties() {
 	zeroHash := make([]byte, 32)
@@ -85,46 +163,150 @@ func (c *Core) initializeNodeProperties() {
 	if _, err := c.db.GetPeerListHash(); err != nil {
 		c.db.SetPeerListHash(zeroHash)
 	}
+	// Peer list hashes stored before the length-prefixed encoding, or before
+	// this node had the digest key, are recomputed
+	if version := peerListHashVersionForKey(c.digestKey); c.db.GetPeerListHashVersion() < version {
+		c.db.SetPeerListHash(ComputePeerListHash(c.db.GetAllPeerIDs(), c.digestKey))
+		c.db.SetPeerListHashVersion(version)
+	}
 	if _, err := c.db.GetDataRootHash(); err != nil {
 		c.db.SetDataRootHash(zeroHash)
 	}
 }
 
+// dataRootUnpublished reports whether rootHash differs from the data hash of
+// the latest published update
+func (c *Core) dataRootUnpublished(rootHash []byte) bool {
+	latestJSON, err := c.db.GetLatestUpdateJSON()
+	if err != nil {
+		// Nothing published yet; only data added since then is unpublished
+		return c.db.CountData() > 0
+	}
+	var signedUpdate SignedUpdate
+	if err := json.Unmarshal([]byte(latestJSON), &signedUpdate); err != nil {
+		return false
+	}
+	update, err := signedUpdate.GetUpdate()
+	if err != nil {
+		return false
+	}
+	return !bytes.Equal(update.DataHash, rootHash)
+}
+
 // setupSyncHandlers registers stream handlers for syncing
 func (c *Core) setupSyncHandlers() {
-	c.p2pNode.NewStreamHandler("/endershare/peer-list/1.0", c.handlePeerListRequest)
-	c.p2pNode.NewStreamHandler("/endershare/tree-bucket-hashes/1.0", c.handleTreeBucketHashesRequest)
-	c.p2pNode.NewStreamHandler("/endershare/data-bucket-hashes/1.0", c.handleDataBucketHashesRequest)
-	c.p2pNode.NewStreamHandler("/endershare/metadata/1.0", c.handleMetadataRequest)
-	c.p2pNode.NewStreamHandler("/endershare/file-data/1.0", c.handleFileDataRequest)
+	c.p2pNode.NewStreamHandler(peerListProtocolID, c.handlePeerListRequest)
+	c.p2pNode.NewStreamHandler(treeBucketHashesProtocolID, c.handleTreeBucketHashesRequest)
+	c.p2pNode.NewStreamHandler(dataBucketHashesProtocolID, c.handleDataBucketHashesRequest)
+	c.p2pNode.NewStreamHandler(metadataProtocolID, c.handleMetadataRequest)
+	c.p2pNode.NewStreamHandler(fileDataProtocolID, c.handleFileDataRequest)
+	c.p2pNode.NewStreamHandler(receiptProtocolID, c.handleReceipt)
+	c.p2pNode.NewStreamHandler(receiptListProtocolID, c.handleReceiptListRequest)
+	c.p2pNode.NewStreamHandler(storageProofProtocolID, c.handleStorageChallenge)
+	c.p2pNode.NewStreamHandler(deviceStatusProtocolID, c.handleDeviceStatusRequest)
+	c.p2pNode.NewStreamHandler(updateAckProtocolID, c.handleUpdateAckRequest)
+	c.p2pNode.NewStreamHandler(digestKeyProtocolID, c.handleDigestKeyRequest)
+	if c.IsMaster() {
+		c.p2pNode.NewStreamHandler(dropProtocolID, c.handleDropRequest)
+	}
 }
 
 // NewCore creates and initializes a Core instance for use with the UI.
 // It starts the P2P node and background sync but does not block.
 func NewCore() (*Core, error) {
 	c := coreStartup(true)
+	if err := c.start(context.Background()); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// EmbeddedNode is what NewEmbeddedCore runs a core on
+type EmbeddedNode struct {
+	DB      *database.EndershareDB
+	Keys    *crypto.CryptoKeys
+	P2PNode *p2p.P2PNode // nil to start one listening on Port
+	Port    int          // 0 for any free port
+	DataDir string       // Blob directory, used when Keys hold the vault key
+}
+
+// NewEmbeddedCore runs a core on the given database, keys and p2p node
+// instead of the ones in the working directory, so several nodes can share a
+// process. Background work stops when ctx is done. A node that has no master
+// public key yet is returned in binding mode, like NewCoreForBinding.
+func NewEmbeddedCore(ctx context.Context, n EmbeddedNode) (*Core, error) {
+	p2pNode := n.P2PNode
+	if p2pNode == nil {
+		var err error
+		p2pNode, err = p2p.NewP2PNode(n.Keys.PeerPrivateKey, ctx, n.DB.GetPeers(), n.Port, transportOptions(n.DB))
+		if err != nil {
+			return nil, fmt.Errorf("error starting P2P node: %w", err)
+		}
+	}
+	var stor *storage.Storage
+	if n.Keys.AESKey != nil {
+		stor = storage.NewStorageIn(n.DB, n.Keys.AESKey, n.DataDir)
+	}
+	c := newCore(n.DB, n.Keys, p2pNode, stor)
+	if n.Keys.MasterPublicKey == nil {
+		return c, nil
+	}
+	if err := c.start(ctx); err != nil {
+		if n.P2PNode == nil {
+			p2pNode.Close()
+		}
+		return nil, err
+	}
+	return c, nil
+}
 
+// start brings up the notify service and the background loops
+func (c *Core) start(ctx context.Context) error {
 	// Setup notify service
-	err := c.setupNotifyService(context.Background())
+	err := c.setupNotifyService(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to setup notify service: %w", err)
+		return fmt.Errorf("failed to setup notify service: %w", err)
 	}
 
 	// Start connection management in background
 	if c.keys.MasterPublicKey != nil {
-		go c.p2pNode.ManageConnections(context.Background(), string(c.keys.MasterPublicKey))
+		go c.p2pNode.ManageConnections(ctx, string(c.keys.MasterPublicKey))
 	}
 
+	if c.IsMaster() && c.storage != nil {
+		// Operations the last run recorded but didn't finish were interrupted
+		c.db.FailPendingIntents("interrupted before it finished")
+		go c.runStatusSnapshots(ctx)
+		go c.runReceiptCollection(ctx)
+		go c.runStorageChallenges(ctx)
+		go c.runDeviceStatusCollection(ctx)
+		go c.runUpdateAckCollection(ctx)
+		go c.runTrashPurge(ctx)
+		go c.runReports(ctx)
+	}
+	go c.runPeerstoreSaves(ctx)
+	go c.runAlerts(ctx)
+	if c.storage != nil {
+		go c.runScrubber(ctx)
+		if !c.IsMaster() {
+			go c.runSelection(ctx)
+		}
+	}
+	c.startContentProcessors(ctx)
+
 	// Start periodic sync in background
 	go func() {
 		c.RequestLatestUpdate()
-		t := time.NewTicker(time.Second * 5)
-		for range t.C {
-			c.RequestLatestUpdate()
+		for {
+			select {
+			case <-time.After(c.jittered(time.Second * 5)):
+				c.RequestLatestUpdate()
+			case <-ctx.Done():
+				return
+			}
 		}
 	}()
-
-	return c, nil
+	return nil
 }
 
 // Storage returns the storage instance for file operations
@@ -145,7 +327,7 @@ func (c *Core) IsMaster() bool {
 // NewCoreForBinding creates a Core instance for replica binding (no master keys yet)
 func NewCoreForBinding(db *database.EndershareDB, keys *crypto.CryptoKeys) (*Core, error) {
 	ctx := context.Background()
-	p2pNode, err := p2p.NewP2PNode(keys.PeerPrivateKey, ctx, db.GetPeers(), 13000)
+	p2pNode, err := p2p.NewP2PNode(keys.PeerPrivateKey, ctx, db.GetPeers(), 13000, transportOptions(db))
 	if err != nil {
 		return nil, fmt.Errorf("error starting P2P node: %w", err)
 	}
@@ -155,34 +337,54 @@ func NewCoreForBinding(db *database.EndershareDB, keys *crypto.CryptoKeys) (*Cor
 		p2pNode: p2pNode,
 		keys:    keys,
 	}
+	c.restorePeerstore()
 
 	c.initializeNodeProperties()
 	return c, nil
 }
 
 // StartBinding starts the binding process for a replica node
-// Returns the 4-word sync phrase and calls onComplete when binding finishes
-func (c *Core) StartBinding(ctx context.Context, onComplete func(info *p2p.ClientInfo)) (string, error) {
+// Returns the 4-word sync phrase and calls onDone once binding ends, with the
+// vault details of the master that bound this node, or with an error if ctx
+// was cancelled or p2p.BindTimeout passed first. The bind handler and the
+// advertisement are gone by then. Nothing is stored; see StoreBinding.
+func (c *Core) StartBinding(ctx context.Context, onDone func(info *p2p.ClientInfo, err error)) (string, error) {
+	if err := c.discardPartialBinding(); err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(ctx, p2p.BindTimeout)
 	clientInfo, phrase, err := p2p.StartBindingService(c.p2pNode, ctx)
 	if err != nil {
+		cancel()
 		return "", err
 	}
 
 	// Wait for binding to complete in background
 	go func() {
-		select {
-		case info := <-clientInfo:
-			if info != nil && onComplete != nil {
-				onComplete(info)
-			}
-		case <-ctx.Done():
-			// Cancelled
+		defer cancel()
+		info, ok := <-clientInfo
+		var err error
+		switch {
+		case ok:
+		case errors.Is(ctx.Err(), context.DeadlineExceeded):
+			err = fmt.Errorf("no master bound this node within %v", p2p.BindTimeout)
+		default:
+			err = ErrBindingCancelled
+		}
+		if onDone != nil {
+			onDone(info, err)
 		}
 	}()
 
 	return phrase, nil
 }
 
+// Close shuts down the p2p node. It is used to discard a core created with
+// NewCoreForBinding whose binding did not complete.
+func (c *Core) Close() error {
+	return c.p2pNode.Close()
+}
+
 // GetNodeID returns this node's peer ID as a string
 func (c *Core) GetNodeID() string {
 	return c.p2pNode.GetPeerId().String()
@@ -196,6 +398,14 @@ func (c *Core) GetPeerStatus(peerID string) (isOnline bool, lastSeen time.Time)
 	return c.p2pNode.GetPeerStatus(peerID)
 }
 
+// GetPeerPath returns how a peer is currently reached ("lan", "direct", "relay" or "" when offline)
+func (c *Core) GetPeerPath(peerID string) string {
+	if c.p2pNode == nil {
+		return ""
+	}
+	return c.p2pNode.GetPeerPath(peerID)
+}
+
 // ReplacePeers updates the P2P node's in-memory peer map
 func (c *Core) ReplacePeers(peers []peer.AddrInfo) {
 	c.p2pNode.ReplacePeers(peers)
@@ -0,0 +1,227 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/notassigned/endershare/internal/database"
+	"github.com/notassigned/endershare/internal/storage"
+)
+
+const (
+	// deviceStatusProtocolID lets the master ask a peer for its signed status
+	deviceStatusProtocolID = "/endershare/device-status/1.0"
+	deviceStatusDomainTag  = "endershare/device-status"
+
+	deviceStatusInterval = 5 * time.Minute
+	deviceStatusTimeout  = 30 * time.Second
+)
+
+// DeviceStatus is a peer's heartbeat stating how much it can store, signed
+// with its peer key
+type DeviceStatus struct {
+	PeerID      string `json:"peer_id"`
+	FreeBytes   int64  `json:"free_bytes"`   // Disk space left where the peer keeps blobs
+	CapBytes    int64  `json:"cap_bytes"`    // Storage quota the peer declared, 0 for none
+	StoredBytes int64  `json:"stored_bytes"` // Blob bytes the peer holds
+	Timestamp   int64  `json:"timestamp"`
+	Nonce       []byte `json:"nonce"` // From the master's request, so old statuses can't be replayed
+}
+
+// SignedDeviceStatus is a DeviceStatus signed with the reporting peer's key
+type SignedDeviceStatus struct {
+	StatusBytes []byte `json:"status_bytes"` // JSON bytes of the status
+	Signature   []byte `json:"signature"`    // Covers DeviceStatus.CanonicalBytes
+}
+
+// DeviceStatusRequest asks a peer for its status
+type DeviceStatusRequest struct {
+	Nonce []byte `json:"nonce"`
+}
+
+// CanonicalBytes returns the deterministic encoding covered by the peer signature
+func (s DeviceStatus) CanonicalBytes() []byte {
+	e := &canonicalEncoder{}
+	e.writeString(deviceStatusDomainTag)
+	e.writeString(s.PeerID)
+	e.writeInt64(s.FreeBytes)
+	e.writeInt64(s.CapBytes)
+	e.writeInt64(s.StoredBytes)
+	e.writeInt64(s.Timestamp)
+	e.writeBytes(s.Nonce)
+	return e.Bytes()
+}
+
+// Room returns how many more blob bytes the device can hold: its free disk
+// space, or less if its storage cap leaves less
+func (s DeviceStatus) Room() int64 {
+	room := s.FreeBytes
+	if s.CapBytes > 0 {
+		room = min(room, max(s.CapBytes-s.StoredBytes, 0))
+	}
+	return room
+}
+
+// Capacity returns how many blob bytes the device can hold in all: what it
+// stores and its free disk space, at most its storage cap
+func (s DeviceStatus) Capacity() int64 {
+	capacity := s.StoredBytes + s.FreeBytes
+	if s.CapBytes > 0 {
+		capacity = min(capacity, s.CapBytes)
+	}
+	return capacity
+}
+
+// VerifyDeviceStatus checks that a status was signed by the peer it names
+func VerifyDeviceStatus(signed SignedDeviceStatus) (*DeviceStatus, error) {
+	var s DeviceStatus
+	if err := json.Unmarshal(signed.StatusBytes, &s); err != nil {
+		return nil, fmt.Errorf("invalid device status: %w", err)
+	}
+	id, err := peer.Decode(s.PeerID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid device status peer: %w", err)
+	}
+	pub, err := id.ExtractPublicKey()
+	if err != nil {
+		return nil, err
+	}
+	ok, err := pub.Verify(s.CanonicalBytes(), signed.Signature)
+	if err != nil || !ok {
+		return nil, fmt.Errorf("device status signature is invalid")
+	}
+	return &s, nil
+}
+
+// localDeviceStatus measures this node's storage for a status report
+func (c *Core) localDeviceStatus(nonce []byte) DeviceStatus {
+	s := DeviceStatus{
+		PeerID:    c.GetNodeID(),
+		CapBytes:  c.db.GetStorageQuota(),
+		Timestamp: time.Now().Unix(),
+		Nonce:     nonce,
+	}
+	_, s.StoredBytes = c.db.GetStoredBlobStats()
+	if free, _, err := storage.DiskSpace(storage.DataDir(c.db)); err == nil {
+		s.FreeBytes = int64(free)
+	}
+	return s
+}
+
+// handleDeviceStatusRequest answers the master's request with this node's
+// signed status
+func (c *Core) handleDeviceStatusRequest(s network.Stream) {
+	defer s.Close()
+
+	var req DeviceStatusRequest
+	if err := json.NewDecoder(io.LimitReader(s, maxRequestSize)).Decode(&req); err != nil {
+		c.logStreamError(s, "decode request", err)
+		return
+	}
+	status := c.localDeviceStatus(req.Nonce)
+	statusBytes, err := json.Marshal(status)
+	if err != nil {
+		return
+	}
+	signed := SignedDeviceStatus{
+		StatusBytes: statusBytes,
+		Signature:   ed25519.Sign(c.keys.PeerPrivateKey, status.CanonicalBytes()),
+	}
+	if err := json.NewEncoder(s).Encode(signed); err != nil {
+		c.logStreamError(s, "send response", err)
+	}
+}
+
+// requestDeviceStatus asks a peer for its status and stores it once verified
+func (c *Core) requestDeviceStatus(from peer.ID) error {
+	req := DeviceStatusRequest{Nonce: make([]byte, 32)}
+	if _, err := rand.Read(req.Nonce); err != nil {
+		return err
+	}
+	stream, err := c.p2pNode.NewStreamToPeer(from, deviceStatusProtocolID)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+	stream.SetDeadline(time.Now().Add(deviceStatusTimeout))
+
+	if err := json.NewEncoder(stream).Encode(req); err != nil {
+		return err
+	}
+	var signed SignedDeviceStatus
+	if err := json.NewDecoder(io.LimitReader(stream, maxRequestSize)).Decode(&signed); err != nil {
+		return err
+	}
+	s, err := VerifyDeviceStatus(signed)
+	if err != nil {
+		return err
+	}
+	if s.PeerID != from.String() || !bytes.Equal(s.Nonce, req.Nonce) {
+		return fmt.Errorf("device status does not answer the request")
+	}
+	signedJSON, err := json.Marshal(signed)
+	if err != nil {
+		return err
+	}
+	return c.db.SetDeviceStatus(database.DBDeviceStatus{
+		PeerID:      s.PeerID,
+		FreeBytes:   s.FreeBytes,
+		CapBytes:    s.CapBytes,
+		StoredBytes: s.StoredBytes,
+		Timestamp:   s.Timestamp,
+		SignedJSON:  string(signedJSON),
+	})
+}
+
+// collectDeviceStatuses asks every online peer for its status (master only)
+func (c *Core) collectDeviceStatuses() {
+	for _, id := range c.GetOtherPeerIDs() {
+		if online, _ := c.GetPeerStatus(id); !online {
+			continue
+		}
+		pid, err := peer.Decode(id)
+		if err != nil {
+			continue
+		}
+		if err := c.requestDeviceStatus(pid); err != nil {
+			fmt.Printf("Warning: Failed to get device status from %s: %v\n", id, err)
+		}
+	}
+}
+
+// runDeviceStatusCollection collects the peers' statuses periodically and
+// replans replication with them (master only)
+func (c *Core) runDeviceStatusCollection(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(c.jittered(deviceStatusInterval)):
+		}
+		c.collectDeviceStatuses()
+		c.replanReplication()
+	}
+}
+
+// DeviceStatuses returns the latest status every peer reported, by peer ID
+func (c *Core) DeviceStatuses() map[string]DeviceStatus {
+	statuses := make(map[string]DeviceStatus)
+	for _, s := range c.db.GetDeviceStatuses() {
+		statuses[s.PeerID] = DeviceStatus{
+			PeerID:      s.PeerID,
+			FreeBytes:   s.FreeBytes,
+			CapBytes:    s.CapBytes,
+			StoredBytes: s.StoredBytes,
+			Timestamp:   s.Timestamp,
+		}
+	}
+	return statuses
+}
@@ -0,0 +1,123 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/notassigned/endershare/internal/crypto"
+)
+
+// digestKeyProtocolID lets members that joined before digests were keyed
+// fetch the digest key from a peer that has it
+const digestKeyProtocolID = "/endershare/digest-key/1.0"
+
+// loadDigestKey reads the digest key. A master derives it from the vault key
+// the first time it starts without one and, if it published updates before,
+// republishes its root so members move over to keyed digests.
+func (c *Core) loadDigestKey() {
+	c.digestKey = c.db.GetDigestKey()
+	if c.digestKey != nil || c.keys.MasterPrivateKey == nil || c.keys.AESKey == nil {
+		return
+	}
+	c.digestKey = crypto.DeriveDigestKey(c.keys.AESKey)
+	if err := c.db.SetDigestKey(c.digestKey); err != nil {
+		fmt.Println("Warning: Failed to store digest key:", err)
+	}
+	if _, err := c.db.GetLatestUpdateJSON(); err == nil {
+		fmt.Println("Keying vault digests, will resync peers")
+		c.republishRoot = true
+	}
+}
+
+// digestKeyID returns the ID of the digest key for updates, nil without one
+func (c *Core) digestKeyID() []byte {
+	if c.digestKey == nil {
+		return nil
+	}
+	return crypto.DigestKeyID(c.digestKey)
+}
+
+// setDigestKey stores a new digest key and rehashes the merkle tree and peer
+// list hash with it
+func (c *Core) setDigestKey(key []byte) error {
+	if err := c.db.SetDigestKey(key); err != nil {
+		return err
+	}
+	c.digestKey = key
+
+	numBuckets := 1
+	if c.merkleTree != nil {
+		numBuckets = c.merkleTree.GetNumBuckets()
+	}
+	c.merkleTree = buildDataTree(c.db, numBuckets, key)
+	c.db.SetDataRootHash(c.merkleTree.GetRootHash())
+	c.db.SetPeerListHash(ComputePeerListHash(c.db.GetAllPeerIDs(), key))
+	c.db.SetPeerListHashVersion(PeerListHashKeyed)
+	return nil
+}
+
+// ensureDigestKey makes sure this node holds the digest key keyID names. A
+// node with the vault key derives it; others ask from, then the other peers.
+// Fetched keys are checked against keyID, which the master signed.
+func (c *Core) ensureDigestKey(keyID []byte, from peer.ID) error {
+	if c.digestKey != nil && bytes.Equal(crypto.DigestKeyID(c.digestKey), keyID) {
+		return nil
+	}
+	if c.keys.AESKey != nil {
+		if key := crypto.DeriveDigestKey(c.keys.AESKey); bytes.Equal(crypto.DigestKeyID(key), keyID) {
+			return c.setDigestKey(key)
+		}
+	}
+
+	candidates := []peer.ID{from}
+	self := c.p2pNode.GetPeerId()
+	for _, id := range c.db.GetAllPeerIDs() {
+		if pid, err := peer.Decode(id); err == nil && pid != from && pid != self {
+			candidates = append(candidates, pid)
+		}
+	}
+	err := fmt.Errorf("no peer has the digest key")
+	for _, pid := range candidates {
+		key, reqErr := c.RequestDigestKey(pid)
+		if reqErr != nil {
+			err = reqErr
+			continue
+		}
+		if !bytes.Equal(crypto.DigestKeyID(key), keyID) {
+			err = fmt.Errorf("peer %s sent a digest key that does not match the update", pid)
+			continue
+		}
+		return c.setDigestKey(key)
+	}
+	return err
+}
+
+// RequestDigestKey asks a vault peer for the digest key
+func (c *Core) RequestDigestKey(peerID peer.ID) ([]byte, error) {
+	stream, err := c.p2pNode.NewStreamToPeer(peerID, digestKeyProtocolID)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	key, err := io.ReadAll(io.LimitReader(stream, 33))
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("peer %s has no digest key", peerID)
+	}
+	return key, nil
+}
+
+// handleDigestKeyRequest sends the digest key to a vault peer. The stream
+// handler only admits peers of the vault.
+func (c *Core) handleDigestKeyRequest(s network.Stream) {
+	defer s.Close()
+	if c.digestKey != nil {
+		s.Write(c.digestKey)
+	}
+}
@@ -0,0 +1,366 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/notassigned/endershare/internal/crypto"
+	"github.com/notassigned/endershare/internal/database"
+	"github.com/notassigned/endershare/internal/storage"
+)
+
+// dropProtocolID carries files from designated peers into drop box folders.
+// Only the master registers it, so other peers refuse the stream.
+const dropProtocolID = "/endershare/drop/1.0"
+
+// dropConnectTimeout is how long the drop command waits for the master
+const dropConnectTimeout = 2 * time.Minute
+
+// DropRequest opens a drop stream
+type DropRequest struct {
+	FolderID storage.FolderID `json:"folder_id"`
+	Name     string           `json:"name"`
+	Size     int64            `json:"size"` // Original file size
+}
+
+// DropResponse answers a DropRequest with the drop box public key and, once
+// the blob was received, reports whether it was stored
+type DropResponse struct {
+	PublicKey []byte `json:"public_key,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// DropHeader precedes the encrypted blob on a drop stream
+type DropHeader struct {
+	SealedKey []byte `json:"sealed_key"`
+}
+
+// DropRejectedError is returned when the master refused a dropped file
+type DropRejectedError struct {
+	Reason string
+}
+
+func (e *DropRejectedError) Error() string {
+	return "master rejected the file: " + e.Reason
+}
+
+// handleDropRequest accepts a file from a designated dropper (master only)
+func (c *Core) handleDropRequest(s network.Stream) {
+	defer s.Close()
+
+	decoder := json.NewDecoder(io.LimitReader(s, maxRequestSize))
+	encoder := json.NewEncoder(s)
+	from := s.Conn().RemotePeer().String()
+	reject := func(err error) {
+		fmt.Printf("Rejected drop from %s: %v\n", from, err)
+		c.logStreamError(s, "accept drop", err)
+		encoder.Encode(DropResponse{Error: err.Error()})
+	}
+
+	var req DropRequest
+	if err := decoder.Decode(&req); err != nil {
+		c.logStreamError(s, "decode request", err)
+		return
+	}
+	if c.storage == nil {
+		reject(fmt.Errorf("vault key is not available"))
+		return
+	}
+	if err := c.CheckWritable(); err != nil {
+		reject(err)
+		return
+	}
+	if req.Name == "" || req.Name == "." || req.Name == ".." || strings.ContainsAny(req.Name, "/\\") || req.Size < 0 {
+		reject(fmt.Errorf("invalid file"))
+		return
+	}
+
+	publicKey, err := c.storage.DropBoxKey(req.FolderID, from)
+	if err != nil {
+		reject(err)
+		return
+	}
+	if err := encoder.Encode(DropResponse{PublicKey: publicKey}); err != nil {
+		c.logStreamError(s, "send response", err)
+		return
+	}
+
+	var header DropHeader
+	if err := decoder.Decode(&header); err != nil {
+		c.logStreamError(s, "decode header", err)
+		return
+	}
+
+	// Encryption adds well under 1/16 of the size, the limit only stops a
+	// dropper from filling the disk with a blob larger than it announced
+	limit := req.Size + req.Size/16 + 1<<20
+	blob := io.LimitReader(io.MultiReader(decoder.Buffered(), s), limit)
+	entry, err := c.storage.AddSealedFile(blob, header.SealedKey, req.Name, req.Size, req.FolderID)
+	if err != nil {
+		reject(err)
+		return
+	}
+
+	if err := c.PublishDataUpdate("ADD", entry.Key, entry.Value, entry.Size, entry.Hash, nil); err != nil {
+		fmt.Println("Warning: Failed to publish data update:", err)
+	}
+	if c.OnDataUpdated != nil {
+		c.OnDataUpdated()
+	}
+	fmt.Printf("Received %s (%d bytes) from %s\n", req.Name, req.Size, from)
+	encoder.Encode(DropResponse{})
+}
+
+// DropFile encrypts a local file and sends it to a drop box on the master.
+// The content key is sealed to the drop box key, so this node can't decrypt
+// the file again, nor any other file in the drop box.
+func (c *Core) DropFile(folderID storage.FolderID, localPath string) error {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if stat.IsDir() {
+		return fmt.Errorf("%s is a directory", localPath)
+	}
+
+	req := DropRequest{FolderID: folderID, Name: filepath.Base(localPath), Size: stat.Size()}
+	lastErr := fmt.Errorf("no peer accepted the drop")
+	for _, p := range c.db.GetPeers() {
+		if p.ID == c.p2pNode.GetPeerId() {
+			continue
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		err := c.dropToPeer(p.ID, req, f)
+		if err == nil {
+			return nil
+		}
+		var rejected *DropRejectedError
+		if errors.As(err, &rejected) {
+			return err
+		}
+		lastErr = err
+	}
+	return lastErr
+}
+
+func (c *Core) dropToPeer(to peer.ID, req DropRequest, src io.Reader) error {
+	stream, err := c.p2pNode.NewStreamToPeer(to, dropProtocolID)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	decoder := json.NewDecoder(stream)
+	encoder := json.NewEncoder(stream)
+	if err := encoder.Encode(req); err != nil {
+		return err
+	}
+
+	var offer DropResponse
+	if err := decoder.Decode(&offer); err != nil {
+		return err
+	}
+	if offer.Error != "" {
+		return &DropRejectedError{Reason: offer.Error}
+	}
+
+	key, err := crypto.NewContentKey()
+	if err != nil {
+		return err
+	}
+	sealedKey, err := crypto.SealKey(key, offer.PublicKey)
+	if err != nil {
+		return err
+	}
+	if err := encoder.Encode(DropHeader{SealedKey: sealedKey}); err != nil {
+		return err
+	}
+	if err := crypto.EncryptStream(stream, src, key, c.db.GetKeyEpoch(), nil); err != nil {
+		return err
+	}
+	if err := stream.CloseWrite(); err != nil {
+		return err
+	}
+
+	var result DropResponse
+	if err := decoder.Decode(&result); err != nil {
+		return fmt.Errorf("no confirmation from master: %w", err)
+	}
+	if result.Error != "" {
+		return &DropRejectedError{Reason: result.Error}
+	}
+	return nil
+}
+
+// DropMain (CLI only) sends files to a drop box on the master. This node must
+// be one of the drop box's designated peers.
+func DropMain(args []string) {
+	if len(args) < 2 {
+		fmt.Println("Usage: endershare drop <folder-id> <file> [file...]")
+		os.Exit(1)
+	}
+
+	c := coreStartup(false)
+	if c.keys.MasterPublicKey == nil {
+		fmt.Println("Error: This node is not bound to a vault")
+		os.Exit(1)
+	}
+	if c.IsMaster() {
+		fmt.Println("Error: The master adds files to drop boxes directly")
+		os.Exit(1)
+	}
+	go c.p2pNode.ManageConnections(context.Background(), string(c.keys.MasterPublicKey))
+
+	folderID := storage.FolderID(args[0])
+	deadline := time.Now().Add(dropConnectTimeout)
+	for _, path := range args[1:] {
+		for {
+			err := c.DropFile(folderID, path)
+			if err == nil {
+				fmt.Println("Dropped", path)
+				break
+			}
+			var rejected *DropRejectedError
+			if errors.As(err, &rejected) || time.Now().After(deadline) {
+				fmt.Println("Error dropping", path+":", err)
+				os.Exit(1)
+			}
+			time.Sleep(2 * time.Second)
+		}
+	}
+}
+
+// DropBoxMain (CLI only) creates drop boxes and manages their designated peers
+func DropBoxMain(args []string) {
+	if len(args) == 0 {
+		fmt.Println("Usage:")
+		fmt.Println("  endershare dropbox create <name> [parent-folder-id]")
+		fmt.Println("  endershare dropbox list")
+		fmt.Println("  endershare dropbox allow <folder-id> <peer-id>")
+		fmt.Println("  endershare dropbox deny <folder-id> <peer-id>")
+		os.Exit(1)
+	}
+
+	db := database.Create()
+	keys := db.GetKeys()
+	if keys == nil {
+		fmt.Println("Error: Only master nodes can manage drop boxes")
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "list":
+		boxes, err := storage.NewStorage(db, keys.AESKey).ListDropBoxes()
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		if len(boxes) == 0 {
+			fmt.Println("No drop boxes")
+			return
+		}
+		for _, box := range boxes {
+			fmt.Printf("%s  %s\n", box.FolderID, box.Name)
+			for _, p := range box.Droppers {
+				fmt.Println("    dropper", p)
+			}
+		}
+		return
+
+	case "create", "allow", "deny":
+	default:
+		fmt.Println("Unknown dropbox command:", args[0])
+		os.Exit(1)
+	}
+
+	c := coreStartup(true)
+	if err := c.setupNotifyService(context.Background()); err != nil {
+		fmt.Println("Error setting up notify service:", err)
+	}
+
+	switch args[0] {
+	case "create":
+		if len(args) < 2 {
+			fmt.Println("Error: dropbox create requires a name")
+			os.Exit(1)
+		}
+		parent := storage.RootFolderID
+		if len(args) > 2 {
+			parent = storage.FolderID(args[2])
+		}
+		if err := c.CheckWritable(); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		folderID, entry, err := c.storage.CreateDropBox(args[1], parent)
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		if err := c.PublishDataUpdate("ADD", entry.Key, entry.Value, entry.Size, entry.Hash, nil); err != nil {
+			fmt.Println("Warning: Failed to publish data update:", err)
+		}
+		fmt.Println("Created drop box", folderID)
+
+	case "allow", "deny":
+		if len(args) < 3 {
+			fmt.Printf("Error: dropbox %s requires a folder id and a peer id\n", args[0])
+			os.Exit(1)
+		}
+		if err := c.SetDropper(storage.FolderID(args[1]), args[2], args[0] == "allow"); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Updated droppers of %s\n", args[1])
+	}
+}
+
+// SetDropper adds or removes a designated peer of a drop box and publishes
+// the changed folder entry (master only)
+func (c *Core) SetDropper(folderID storage.FolderID, peerID string, allowed bool) error {
+	if !c.IsMaster() || c.storage == nil {
+		return fmt.Errorf("%w can change drop boxes", ErrNotMaster)
+	}
+	if err := c.CheckWritable(); err != nil {
+		return err
+	}
+	if allowed && !slices.Contains(c.db.GetAllPeerIDs(), peerID) {
+		return fmt.Errorf("peer %w in this vault: %s", storage.ErrNotFound, peerID)
+	}
+	folder, err := c.storage.GetFolder(folderID)
+	if err != nil {
+		return err
+	}
+
+	droppers := slices.DeleteFunc(slices.Clone(folder.Droppers), func(p string) bool { return p == peerID })
+	if allowed {
+		droppers = append(droppers, peerID)
+	}
+	removed, added, err := c.storage.SetDroppers(folderID, droppers)
+	if err != nil {
+		return err
+	}
+
+	// Add first so replicas never see the folder missing
+	if err := c.PublishDataUpdate("ADD", added.Key, added.Value, added.Size, added.Hash, nil); err != nil {
+		return err
+	}
+	return c.PublishDataUpdate("DELETE", removed.Key, removed.Value, removed.Size, removed.Hash, nil)
+}
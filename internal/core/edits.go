@@ -0,0 +1,87 @@
+package core
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/notassigned/endershare/internal/database"
+	"github.com/notassigned/endershare/internal/storage"
+)
+
+// The changes below store an edit and publish it in one step, for programs
+// that embed a vault rather than drive storage and publishing themselves.
+// Each carries note, nil for none, and is refused on frozen vaults.
+
+// checkEditable returns why this node can't change the vault, nil if it can
+func (c *Core) checkEditable(what string) error {
+	if !c.IsMaster() || c.storage == nil {
+		return fmt.Errorf("%w can %s", ErrNotMaster, what)
+	}
+	return c.CheckWritable()
+}
+
+// AddFile encrypts the content of r into folderID as name, applying the
+// import rules, see storage.ImportFromReader (master only)
+func (c *Core) AddFile(r io.Reader, name string, folderID storage.FolderID, note []byte) error {
+	if err := c.checkEditable("add files"); err != nil {
+		return err
+	}
+	replaced, added, err := c.storage.ImportFromReader(r, name, folderID)
+	// Folders the import rules created are published even if the file failed
+	var deleted []*database.DataEntry
+	if replaced != nil {
+		deleted = append(deleted, replaced)
+	}
+	if perr := c.PublishBatchUpdate(added, deleted, note); err == nil {
+		err = perr
+	}
+	return err
+}
+
+// CreateFolder creates a folder called name in parent and returns its ID (master only)
+func (c *Core) CreateFolder(name string, parent storage.FolderID, note []byte) (storage.FolderID, error) {
+	if err := c.checkEditable("create folders"); err != nil {
+		return "", err
+	}
+	folderID, entry, err := c.storage.CreateFolderWithEntry(name, parent)
+	if err != nil {
+		return "", err
+	}
+	return folderID, c.PublishDataUpdate("ADD", entry.Key, entry.Value, entry.Size, entry.Hash, note)
+}
+
+// RenameFile gives a file a new name in its folder (master only)
+func (c *Core) RenameFile(name string, folderID storage.FolderID, newName string, note []byte) error {
+	if err := c.checkEditable("rename files"); err != nil {
+		return err
+	}
+	removed, added, err := c.storage.RenameFile(name, folderID, newName)
+	if err != nil {
+		return err
+	}
+	return c.PublishModifyUpdate(removed, added, note)
+}
+
+// TrashFile moves a file to the trash (master only)
+func (c *Core) TrashFile(name string, folderID storage.FolderID, note []byte) error {
+	if err := c.checkEditable("delete files"); err != nil {
+		return err
+	}
+	removed, added, err := c.storage.TrashFile(name, folderID)
+	if err != nil {
+		return err
+	}
+	return c.PublishModifyUpdate(removed, added, note)
+}
+
+// TrashFolder moves a folder and everything in it to the trash (master only)
+func (c *Core) TrashFolder(folderID storage.FolderID, note []byte) error {
+	if err := c.checkEditable("delete folders"); err != nil {
+		return err
+	}
+	removed, added, err := c.storage.TrashFolder(folderID)
+	if err != nil {
+		return err
+	}
+	return c.PublishModifyUpdate(removed, added, note)
+}
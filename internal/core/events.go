@@ -0,0 +1,143 @@
+package core
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/notassigned/endershare/internal/database"
+)
+
+// EventType identifies what happened in a Core event
+type EventType string
+
+// Core event types
+const (
+	EventEntryAdded       EventType = "entry-added"       // Entry inserted locally or synced from a peer
+	EventEntryRemoved     EventType = "entry-removed"     // Entry deleted locally or synced from a peer
+	EventUpdateApplied    EventType = "update-applied"    // Signed update published or applied
+	EventPeerJoined       EventType = "peer-joined"       // Peer added to the vault's peer list
+	EventPeerLeft         EventType = "peer-left"         // Peer removed from the vault's peer list
+	EventDownloadFinished EventType = "download-finished" // Blob downloaded and verified
+	EventBlobCorrupted    EventType = "blob-corrupted"    // Stored blob missing or not matching its hash
+	EventBlobRepaired     EventType = "blob-repaired"     // Corrupt blob downloaded again from a peer
+	EventSubtreeMoved     EventType = "subtree-moved"     // Folder renamed or moved along with the entries below it
+	EventPinsChanged      EventType = "pins-changed"      // File or folder pinned or unpinned on this node
+)
+
+// eventQueueSize is how many events a slow subscriber may fall behind
+// before new events are dropped for it
+const eventQueueSize = 256
+
+// Event is delivered to subscribers. Only the fields relevant to its type are set.
+type Event struct {
+	Type     EventType
+	Time     time.Time
+	Entry    *database.DataEntry // Entry events and the folder of EventSubtreeMoved, Key and Value are still encrypted
+	Update   *Update             // EventUpdateApplied
+	PeerID   string              // Peer events, and the serving peer of a download or repair
+	FileHash []byte              // Blob events
+	Size     int64               // Blob events
+	Subtree  [][]byte            // EventSubtreeMoved, hashes of the entries below the folder
+}
+
+type eventSubscriber struct {
+	types []EventType // Empty for every type
+	queue chan Event
+}
+
+// eventBus fans Core events out to subscribers. Each subscriber has its own
+// queue and goroutine, so a slow handler never blocks sync.
+type eventBus struct {
+	mu   sync.Mutex
+	subs []*eventSubscriber
+}
+
+// Subscribe calls handler for every event of the given types, or of every
+// type if none are given. Handlers run on their own goroutine, one event at a
+// time in order. The returned function cancels the subscription.
+func (c *Core) Subscribe(handler func(Event), types ...EventType) (cancel func()) {
+	sub := &eventSubscriber{types: types, queue: make(chan Event, eventQueueSize)}
+
+	c.events.mu.Lock()
+	c.events.subs = append(c.events.subs, sub)
+	c.events.mu.Unlock()
+
+	go func() {
+		for event := range sub.queue {
+			handler(event)
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			c.events.mu.Lock()
+			defer c.events.mu.Unlock()
+			c.events.subs = slices.DeleteFunc(c.events.subs, func(s *eventSubscriber) bool { return s == sub })
+			close(sub.queue)
+		})
+	}
+}
+
+func (s *eventSubscriber) wants(t EventType) bool {
+	return len(s.types) == 0 || slices.Contains(s.types, t)
+}
+
+// hasSubscribers reports whether any subscriber wants events of type t, so
+// callers can skip work that only feeds events
+func (c *Core) hasSubscribers(t EventType) bool {
+	c.events.mu.Lock()
+	defer c.events.mu.Unlock()
+	for _, sub := range c.events.subs {
+		if sub.wants(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// emit queues an event for every interested subscriber
+func (c *Core) emit(event Event) {
+	event.Time = time.Now()
+
+	c.events.mu.Lock()
+	defer c.events.mu.Unlock()
+	for _, sub := range c.events.subs {
+		if !sub.wants(event.Type) {
+			continue
+		}
+		select {
+		case sub.queue <- event:
+		default:
+			fmt.Println("Warning: Event subscriber is falling behind, dropped", event.Type)
+		}
+	}
+}
+
+func (c *Core) emitEntry(t EventType, entry database.DataEntry) {
+	c.emit(Event{Type: t, Entry: &entry})
+}
+
+func (c *Core) emitUpdate(update Update) {
+	c.emit(Event{Type: EventUpdateApplied, Update: &update})
+}
+
+func (c *Core) emitPeer(t EventType, peerID string) {
+	c.emit(Event{Type: t, PeerID: peerID})
+}
+
+// emitPeerListChange emits joined and left events between two peer lists
+func (c *Core) emitPeerListChange(before, after []string) {
+	for _, id := range after {
+		if !slices.Contains(before, id) {
+			c.emitPeer(EventPeerJoined, id)
+		}
+	}
+	for _, id := range before {
+		if !slices.Contains(after, id) {
+			c.emitPeer(EventPeerLeft, id)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/notassigned/endershare/internal/database"
+	"github.com/notassigned/endershare/internal/storage"
+)
+
+// ExportMain (CLI only) exports the file or folder at a vault path to dest. A
+// folder becomes a new directory, or a zip or tar archive when dest ends
+// with .zip or .tar. Files only stored on other nodes are skipped.
+func ExportMain(args []string) {
+	if len(args) != 2 {
+		fmt.Println("Usage: endershare export <path> <destination[.zip|.tar]>")
+		os.Exit(1)
+	}
+	db := database.Create()
+	keys := db.GetKeys()
+	if keys == nil || keys.AESKey == nil {
+		exitWithError(fmt.Errorf("exporting files needs the vault key, this node doesn't hold it"))
+	}
+	stor := storage.NewStorage(db, keys.AESKey)
+	src, dest := args[0], args[1]
+
+	folderID, err := resolveFolderPath(stor, src)
+	if errors.Is(err, storage.ErrNotFound) {
+		parent, name, err := resolveFilePath(stor, src)
+		if err != nil {
+			exitWithError(err)
+		}
+		if err := stor.GetFile(name, parent, dest); err != nil {
+			exitWithError(err)
+		}
+		fmt.Println("Exported", src, "to", dest)
+		return
+	} else if err != nil {
+		exitWithError(err)
+	}
+
+	switch format := strings.TrimPrefix(strings.ToLower(filepath.Ext(dest)), "."); format {
+	case storage.ArchiveZip, storage.ArchiveTar:
+		err = stor.ExportArchive(folderID, dest, format)
+	default:
+		err = stor.ExportFolderToPath(folderID, dest)
+	}
+	if err != nil {
+		exitWithError(err)
+	}
+	fmt.Println("Exported", src, "to", dest)
+}
@@ -0,0 +1,70 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/notassigned/endershare/internal/database"
+	"github.com/notassigned/endershare/internal/storage"
+)
+
+// FixtureMain (CLI only) fills the local vault with synthetic files and
+// folders for load testing
+func FixtureMain(args []string) {
+	usage := func() {
+		fmt.Println("Usage: endershare fixture [--files n] [--min-size bytes] [--max-size bytes] [--dist uniform|log] [--depth n] [--fanout n] [--seed n]")
+		os.Exit(1)
+	}
+	if len(args)%2 != 0 {
+		usage()
+	}
+
+	spec := storage.DefaultFixtureSpec()
+	for i := 0; i+1 < len(args); i += 2 {
+		var err error
+		switch args[i] {
+		case "--files":
+			spec.Files, err = strconv.Atoi(args[i+1])
+		case "--min-size":
+			spec.MinSize, err = strconv.ParseInt(args[i+1], 10, 64)
+		case "--max-size":
+			spec.MaxSize, err = strconv.ParseInt(args[i+1], 10, 64)
+		case "--dist":
+			spec.SizeDist = args[i+1]
+		case "--depth":
+			spec.Depth, err = strconv.Atoi(args[i+1])
+		case "--fanout":
+			spec.Fanout, err = strconv.Atoi(args[i+1])
+		case "--seed":
+			spec.Seed, err = strconv.ParseUint(args[i+1], 10, 64)
+		default:
+			usage()
+		}
+		if err != nil {
+			fmt.Printf("Error: invalid %s: %v\n", args[i], err)
+			os.Exit(1)
+		}
+	}
+
+	db := database.Create()
+	keys := db.GetKeys()
+	if keys == nil {
+		fmt.Println("Error: Only master nodes can generate fixtures")
+		os.Exit(1)
+	}
+
+	step := max(spec.Files/100, 1)
+	stats, err := storage.NewStorage(db, keys.AESKey).GenerateFixture(spec, func(done, total int) {
+		if done%step == 0 || done == total {
+			fmt.Printf("\r%d/%d files", done, total)
+		}
+	})
+	fmt.Println()
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Generated %d files (%d bytes) in %d folders\n", stats.Files, stats.Bytes, stats.Folders)
+	fmt.Println("Peers pick the fixture up when this node next starts")
+}
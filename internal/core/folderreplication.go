@@ -0,0 +1,121 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/notassigned/endershare/internal/database"
+	"github.com/notassigned/endershare/internal/storage"
+)
+
+// GetReplicationPolicy returns the folder replication modes in effect on this node
+func (c *Core) GetReplicationPolicy() storage.ReplicationPolicy {
+	return storage.LoadReplicationPolicy(c.db)
+}
+
+// SetFolderReplication gives a folder a replication mode, or none with "",
+// and broadcasts the policy so replicas download accordingly. The root folder
+// sets the mode of the whole vault (master only).
+func (c *Core) SetFolderReplication(folderID storage.FolderID, mode string) error {
+	if !c.IsMaster() || c.storage == nil {
+		return fmt.Errorf("%w can choose how folders are replicated", ErrNotMaster)
+	}
+	if mode != "" && mode != storage.ReplicateEverywhere && mode != storage.ReplicateOnDemand {
+		return fmt.Errorf("unknown replication mode %q", mode)
+	}
+	if !folderID.IsRoot() {
+		if _, err := c.storage.GetFolder(folderID); err != nil {
+			return err
+		}
+	}
+
+	p := c.GetReplicationPolicy()
+	p.Folders = slices.DeleteFunc(slices.Clone(p.Folders), func(f storage.FolderReplication) bool { return f.FolderID == folderID })
+	if mode != "" {
+		p.Folders = append(p.Folders, storage.FolderReplication{FolderID: folderID, Mode: mode})
+	}
+	if err := storage.SaveReplicationPolicy(c.db, p); err != nil {
+		return err
+	}
+	return c.publishControlUpdate("REPLICATION", p)
+}
+
+// applyReplicationUpdate stores the folder replication modes carried by a
+// REPLICATION update
+func (c *Core) applyReplicationUpdate(update Update) error {
+	var p storage.ReplicationPolicy
+	if err := json.Unmarshal(update.UpdateData, &p); err != nil {
+		return err
+	}
+	return storage.SaveReplicationPolicy(c.db, p)
+}
+
+// syncScope returns what this node keeps the content of, from the master's
+// folder selection and replication policy and its own pins and on-demand
+// setting
+func (c *Core) syncScope() storage.Scope {
+	folders, selective := c.selectedFolders()
+	return storage.Scope{
+		Selective:   selective,
+		Folders:     folders,
+		Replication: c.GetReplicationPolicy(),
+		Pins:        storage.LoadPins(c.db),
+		OnDemand:    c.db.GetOnDemand(),
+	}
+}
+
+// ReplicationMain (CLI only) shows the folder replication modes, or sets the
+// mode of one folder (master only)
+func ReplicationMain(args []string) {
+	if len(args) == 0 {
+		db := database.Create()
+		p := storage.LoadReplicationPolicy(db)
+		if len(p.Folders) == 0 {
+			fmt.Println("No folder has a replication mode, every device follows its on-demand setting")
+			return
+		}
+		var stor *storage.Storage
+		if keys := db.GetKeys(); keys != nil && keys.AESKey != nil {
+			stor = storage.NewStorage(db, keys.AESKey)
+		}
+		for _, f := range p.Folders {
+			path := string(f.FolderID)
+			if stor != nil {
+				path = folderPath(stor, f.FolderID)
+			}
+			fmt.Printf("%-10s %s\n", f.Mode, path)
+		}
+		return
+	}
+	if len(args) != 2 {
+		fmt.Println("Usage: endershare replication [<folder-path> everywhere|on-demand|default]")
+		os.Exit(1)
+	}
+	mode := args[1]
+	if mode == "default" {
+		mode = ""
+	}
+
+	c := coreStartup(false)
+	if !c.IsMaster() {
+		exitWithError(fmt.Errorf("%w can choose how folders are replicated", ErrNotMaster))
+	}
+	if err := c.setupNotifyService(context.Background()); err != nil {
+		fmt.Println("Error setting up notify service:", err)
+	}
+	id, err := resolveFolderPath(c.storage, args[0])
+	if err != nil {
+		exitWithError(err)
+	}
+	if err := c.SetFolderReplication(id, mode); err != nil {
+		exitWithError(err)
+	}
+	if mode == "" {
+		fmt.Println(folderPath(c.storage, id), "has no replication mode of its own")
+	} else {
+		fmt.Println(folderPath(c.storage, id), "is replicated", mode)
+	}
+}
@@ -0,0 +1,106 @@
+package core
+
+import (
+	"fmt"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/notassigned/endershare/internal/database"
+	"github.com/notassigned/endershare/internal/storage"
+)
+
+// retirePeer removes a vault peer, keeping its record as a former peer, and
+// disconnects it
+func (c *Core) retirePeer(peerID string, banned bool) error {
+	c.peerTable.Lock()
+	defer c.peerTable.Unlock()
+	if err := c.db.RetirePeer(peerID, banned); err != nil {
+		return err
+	}
+	if id, err := peer.Decode(peerID); err == nil && c.p2pNode != nil {
+		c.p2pNode.RemovePeer(id)
+	}
+	return nil
+}
+
+// BanPeer removes a peer like RemovePeer and refuses to bind it again until
+// ForgetPeer lifts the ban
+func (c *Core) BanPeer(peerID string) error {
+	before := c.db.GetAllPeerIDs()
+	if err := c.retirePeer(peerID, true); err != nil {
+		return err
+	}
+	c.emitPeerListChange(before, c.db.GetAllPeerIDs())
+	return nil
+}
+
+// FormerPeers lists the removed peers, most recently removed first
+func (c *Core) FormerPeers() []database.DBFormerPeer {
+	return c.db.GetFormerPeers()
+}
+
+// ForgetPeer drops the record of a removed peer, lifting a ban. The device
+// binds as a new one afterwards.
+func (c *Core) ForgetPeer(peerID string) error {
+	return c.db.ForgetFormerPeer(peerID)
+}
+
+// RestorePeer adds a removed peer back with its former addresses and label,
+// without binding it again. This suits devices that kept their copy of the
+// vault; one that was reset binds again instead, which restores it the same
+// way. On a master the peer is published to the vault.
+func (c *Core) RestorePeer(peerID string) error {
+	former := c.db.GetFormerPeer(peerID)
+	if former == nil {
+		return fmt.Errorf("removed peer %w: %s", storage.ErrNotFound, peerID)
+	}
+	if former.Banned {
+		return fmt.Errorf("%w: %s", ErrPeerBanned, peerID)
+	}
+	id, err := peer.Decode(peerID)
+	if err != nil {
+		return err
+	}
+	info := peer.AddrInfo{ID: id}
+	for _, s := range former.Addresses {
+		if addr, err := multiaddr.NewMultiaddr(s); err == nil {
+			info.Addrs = append(info.Addrs, addr)
+		}
+	}
+
+	c.bindings.commit.Lock()
+	defer c.bindings.commit.Unlock()
+	before := c.db.GetAllPeerIDs()
+	if err := c.addPeer(info); err != nil {
+		return err
+	}
+	c.restoreFormerPeer(peerID)
+	c.emitPeerListChange(before, c.db.GetAllPeerIDs())
+
+	if c.keys.MasterPrivateKey != nil {
+		if err := c.publishPeerAddrs(peerID, nil, false, addrStrings(info.Addrs)); err != nil {
+			fmt.Println("Warning: Failed to publish peer update:", err)
+		}
+	}
+	return nil
+}
+
+// restoreFormerPeer carries the record of a removed peer over to the peer
+// that was just added with its ID, and returns the record, or nil if the peer
+// was never removed
+func (c *Core) restoreFormerPeer(peerID string) *database.DBFormerPeer {
+	former := c.db.GetFormerPeer(peerID)
+	if former == nil {
+		return nil
+	}
+	if former.Label != "" {
+		if err := c.db.SetPeerLabel(peerID, former.Label); err != nil {
+			fmt.Println("Warning: Failed to restore peer label:", err)
+		}
+	}
+	if err := c.db.ForgetFormerPeer(peerID); err != nil {
+		fmt.Println("Warning: Failed to drop former peer record:", err)
+	}
+	fmt.Println("Restored former peer:", peerID)
+	return former
+}
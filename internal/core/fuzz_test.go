@@ -0,0 +1,128 @@
+package core
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"testing"
+)
+
+var fuzzPrivateKey = ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+
+// fuzzUpdateSeeds are signed updates of every payload type, including one
+// without a payload, whose signature SignUpdate once got wrong
+func fuzzUpdateSeeds(f *testing.F) [][]byte {
+	f.Helper()
+	peerData, err := newUpdateData(PeerUpdate{Action: "ADD", PeerID: "12D3KooWGh3bXz5teaWogQzNBsDmGroDgGzhKHp3Ni4ij5bBemgR", Addresses: []string{"/ip4/10.0.0.2/tcp/13000"}})
+	if err != nil {
+		f.Fatal(err)
+	}
+	batchData, err := newUpdateData(DataUpdate{
+		Action:  "BATCH",
+		Batch:   []DataUpdate{{Action: "MODIFY", Key: []byte("new"), Hash: []byte("new"), PrevKey: []byte("old"), PrevHash: []byte("old")}},
+		Subtree: [][]byte{[]byte("below")},
+		Note:    []byte("sealed note"),
+	})
+	if err != nil {
+		f.Fatal(err)
+	}
+
+	data := Update{UpdateID: 7, NumBuckets: 1, UpdateDataType: "DATA", Timestamp: 1700000000, KeyEpoch: 1, DigestKeyID: []byte("digest key")}
+	peerUpdate, batch, empty := data, data, data
+	data.UpdateData = testDataUpdatePayload(f)
+	peerUpdate.UpdateDataType, peerUpdate.UpdateData = "PEER", peerData
+	batch.UpdateData = batchData
+	empty.UpdateData = nil
+
+	var seeds [][]byte
+	for _, u := range []Update{data, peerUpdate, batch, empty} {
+		signed, err := SignUpdate(u, fuzzPrivateKey)
+		if err != nil {
+			f.Fatal(err)
+		}
+		seed, err := json.Marshal(signed)
+		if err != nil {
+			f.Fatal(err)
+		}
+		seeds = append(seeds, seed)
+	}
+	return seeds
+}
+
+// checkSignedUpdate feeds a gossiped SignedUpdate through signature
+// verification and payload decoding, which run before the signature is known
+// to be good, and fails t when an invariant breaks. valid reports whether the
+// seed is one the master signed.
+func checkSignedUpdate(t *testing.T, data []byte, valid bool) {
+	var signed SignedUpdate
+	if err := json.Unmarshal(data, &signed); err != nil {
+		return
+	}
+	publicKey := fuzzPrivateKey.Public().(ed25519.PublicKey)
+	if ok := VerifySignedUpdate(signed, publicKey); valid && !ok {
+		t.Fatal("signed update does not verify")
+	}
+
+	update, err := signed.GetUpdate()
+	if err != nil {
+		return
+	}
+	update.PeerUpdate()
+	update.DataUpdate()
+	canonical, err := update.CanonicalBytes()
+	if err != nil {
+		return
+	}
+	if again, _ := update.CanonicalBytes(); !bytes.Equal(canonical, again) {
+		t.Fatal("canonical encoding is not deterministic")
+	}
+
+	resigned, err := SignUpdate(update, fuzzPrivateKey)
+	if err != nil {
+		return
+	}
+	if !VerifySignedUpdate(resigned, publicKey) {
+		t.Fatal("re-signed update does not verify")
+	}
+}
+
+func FuzzSignedUpdate(f *testing.F) {
+	seeds := fuzzUpdateSeeds(f)
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+	f.Add([]byte(`{"update_bytes":"e30=","signature":""}`))
+	f.Add([]byte(`{"update_bytes":"bnVsbA==","signature":null}`))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		checkSignedUpdate(t, data, isSeed(seeds, data))
+	})
+}
+
+// FuzzNotification feeds a raw gossip message through type parsing and, for
+// updates, the checks of FuzzSignedUpdate
+func FuzzNotification(f *testing.F) {
+	seeds := fuzzUpdateSeeds(f)
+	for _, seed := range seeds {
+		f.Add(append([]byte("update\n"), seed...))
+	}
+	f.Add(append([]byte("update\n"), append(seeds[0], "     "...)...)) // Padded for gossip
+	f.Add([]byte("request_latest_update\n"))
+	f.Add([]byte("no type line"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		msgType, content, err := parseNotification(data)
+		if err != nil || msgType != "update" {
+			return
+		}
+		checkSignedUpdate(t, content, isSeed(seeds, content))
+	})
+}
+
+// isSeed reports whether data is one of the signed seeds
+func isSeed(seeds [][]byte, data []byte) bool {
+	for _, seed := range seeds {
+		if bytes.Equal(seed, data) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,109 @@
+package core
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/notassigned/endershare/internal/storage"
+)
+
+// blobFetches tracks the placeholder fetches in flight, so readers of the
+// same placeholder wait for one download instead of appending to the blob
+// together
+type blobFetches struct {
+	mu      sync.Mutex
+	running map[string]chan struct{}
+}
+
+// syncFile downloads the file of an entry synced from a peer, given its
+// encrypted key, unless the node keeps synced files as placeholders that are
+// fetched on first access. The folders the master selected for the node or
+// replicates everywhere are downloaded either way, other files are left as
+// placeholders when the master made them on-demand or selected other folders,
+// and archived files aren't downloaded at all.
+func (c *Core) syncFile(from peer.ID, key, fileHash []byte, fileSize int64) error {
+	if c.storage != nil {
+		if !c.storage.Keeps(key, c.syncScope()) {
+			return nil
+		}
+	} else if c.db.GetOnDemand() {
+		return nil
+	}
+	return c.downloadFile(from, fileHash, fileSize)
+}
+
+// fetchBlob downloads the blob of a placeholder that is being read from the
+// first online peer that serves it, see storage.SetBlobFetcher
+func (c *Core) fetchBlob(hash []byte, size int64) error {
+	key := string(hash)
+	var done chan struct{}
+	for {
+		c.fetches.mu.Lock()
+		running, busy := c.fetches.running[key]
+		if !busy {
+			if c.fetches.running == nil {
+				c.fetches.running = make(map[string]chan struct{})
+			}
+			done = make(chan struct{})
+			c.fetches.running[key] = done
+		}
+		c.fetches.mu.Unlock()
+		if !busy {
+			break
+		}
+		<-running
+		if c.db.GetDownloadProgress(hash) >= size {
+			return nil
+		}
+	}
+	defer func() {
+		c.fetches.mu.Lock()
+		delete(c.fetches.running, key)
+		c.fetches.mu.Unlock()
+		close(done)
+	}()
+
+	if err := c.checkDownloadPolicy(hash, size); err != nil {
+		return err
+	}
+
+	// One attempt per peer, LAN peers first: a peer that holds the blob as a
+	// placeholder too fails at once, and the next resumes where one stopped
+	started := time.Now()
+	sources := c.p2pNode.LANPeers()
+	for _, id := range c.GetOtherPeerIDs() {
+		if online, _ := c.GetPeerStatus(id); !online {
+			continue
+		}
+		if pid, err := peer.Decode(id); err == nil && !slices.Contains(sources, pid) {
+			sources = append(sources, pid)
+		}
+	}
+	err := fmt.Errorf("no peer online to fetch %x from", hash[:8])
+	for _, source := range sources {
+		if c.isQuarantined(hash, source, QuarantineBlob) {
+			continue
+		}
+		if err = c.downloadFileAttempt(source, hash, size); err == nil {
+			return c.finishDownload(source, hash, size, started)
+		}
+		c.logPeerError(source, fileDataProtocolID, "transfer", err)
+	}
+	return err
+}
+
+// EvictFile removes the local copy of a file's content and returns the bytes
+// freed, leaving a placeholder that is fetched from a peer when next read.
+// The master keeps the content of every file, as other nodes fetch from it.
+func (c *Core) EvictFile(name string, folderID storage.FolderID) (int64, error) {
+	if c.storage == nil {
+		return 0, fmt.Errorf("this node does not store file contents")
+	}
+	if c.IsMaster() {
+		return 0, fmt.Errorf("the master node keeps the content of every file")
+	}
+	return c.storage.EvictFile(name, folderID)
+}
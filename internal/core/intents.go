@@ -0,0 +1,206 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/notassigned/endershare/internal/database"
+)
+
+// intentListLimit is how many operations Intents returns by default
+const intentListLimit = 50
+
+// Intent is an operation of the master recorded in the intent log before it
+// runs, so it can be followed to the peers that were offline when it ran
+type Intent struct {
+	c       *Core
+	id      int64
+	startID uint64 // Latest update before the operation
+}
+
+// BeginIntent records an operation described by summary that is about to
+// run, for the peers the vault has now. It returns nil on replicas or if the
+// log can't be written; Done is safe to call on nil.
+func (c *Core) BeginIntent(summary string) *Intent {
+	if !c.IsMaster() {
+		return nil
+	}
+	startID, _ := c.db.GetCurrentUpdateID()
+	id, err := c.db.AddIntent(summary, c.GetOtherPeerIDs())
+	if err != nil {
+		fmt.Println("Warning: Failed to record operation:", err)
+		return nil
+	}
+	return &Intent{c: c, id: id, startID: startID}
+}
+
+// Done records how the operation ended, err nil if it succeeded, and the
+// updates it published. An operation that failed part way still records the
+// updates it got out.
+func (in *Intent) Done(err error) {
+	if in == nil {
+		return
+	}
+	var first, last uint64
+	if currentID, _ := in.c.db.GetCurrentUpdateID(); currentID > in.startID {
+		first, last = in.startID+1, currentID
+	}
+	state, errText := database.IntentPublished, ""
+	if err != nil {
+		errText = err.Error()
+		if last == 0 {
+			state = database.IntentFailed
+		}
+	}
+	if err := in.c.db.FinishIntent(in.id, state, errText, first, last); err != nil {
+		fmt.Println("Warning: Failed to record operation:", err)
+	}
+	if last > 0 {
+		in.c.kickUpdateAcks()
+	}
+}
+
+// IntentStatus is a recorded operation and how far it reached the peers
+type IntentStatus struct {
+	ID          int64
+	Summary     string
+	State       string // database.IntentPending, IntentPublished or IntentFailed
+	Error       string
+	Created     time.Time
+	FirstUpdate uint64
+	LastUpdate  uint64
+	Delivered   int      // Peers that acknowledged its last update
+	Total       int      // Peers it was for that are still in the vault
+	Pending     []string // Peer IDs yet to acknowledge it
+}
+
+// Intents returns the latest limit recorded operations, newest first, with
+// their delivery to the peers by their acks
+func (c *Core) Intents(limit int) []IntentStatus {
+	return intentStatuses(c.db, c.GetNodeID(), limit)
+}
+
+// intentStatuses reads the intent log of db for the node selfID, see Intents
+func intentStatuses(db *database.EndershareDB, selfID string, limit int) []IntentStatus {
+	if limit <= 0 {
+		limit = intentListLimit
+	}
+	current := make(map[string]bool)
+	for _, id := range db.GetAllPeerIDs() {
+		current[id] = id != selfID
+	}
+	acks := db.GetUpdateAcks()
+
+	var statuses []IntentStatus
+	for _, in := range db.GetIntents(limit) {
+		s := IntentStatus{
+			ID:          in.ID,
+			Summary:     in.Summary,
+			State:       in.State,
+			Error:       in.Error,
+			Created:     in.Created,
+			FirstUpdate: in.FirstUpdate,
+			LastUpdate:  in.LastUpdate,
+		}
+		for _, id := range in.Targets {
+			if !current[id] {
+				continue
+			}
+			s.Total++
+			switch {
+			case in.LastUpdate == 0:
+				// Nothing was published, so there is nothing to deliver
+				if in.State == database.IntentPublished {
+					s.Delivered++
+				}
+			case acks[id].UpdateID >= in.LastUpdate:
+				s.Delivered++
+			default:
+				s.Pending = append(s.Pending, id)
+			}
+		}
+		statuses = append(statuses, s)
+	}
+	return statuses
+}
+
+// undeliveredPeers returns the peers some published operation in the log
+// hasn't reached yet
+func (c *Core) undeliveredPeers() []string {
+	seen := make(map[string]bool)
+	var peers []string
+	for _, s := range c.Intents(intentListLimit) {
+		for _, id := range s.Pending {
+			if !seen[id] {
+				seen[id] = true
+				peers = append(peers, id)
+			}
+		}
+	}
+	return peers
+}
+
+// Delivery describes how far an operation reached the peers, such as
+// "delivered to 2 of 4 devices"
+func (s IntentStatus) Delivery() string {
+	switch {
+	case s.State == database.IntentPending:
+		return "in progress"
+	case s.State == database.IntentFailed:
+		return "failed: " + s.Error
+	case s.Total == 0:
+		return "no other devices"
+	}
+	devices := "devices"
+	if s.Total == 1 {
+		devices = "device"
+	}
+	return fmt.Sprintf("delivered to %d of %d %s", s.Delivered, s.Total, devices)
+}
+
+// DeliveryMain (CLI only) lists the master's recent operations and how far
+// each reached the other devices, from the database alone
+func DeliveryMain(args []string) {
+	limit := intentListLimit
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n <= 0 {
+			fmt.Println("Usage: endershare delivery [count]")
+			os.Exit(1)
+		}
+		limit = n
+	}
+	db := database.Create()
+	keys := db.GetKeys()
+	if keys == nil || keys.MasterPrivateKey == nil {
+		exitWithError(fmt.Errorf("%w record operations", ErrNotMaster))
+	}
+	selfID, err := keysPeerID(keys)
+	if err != nil {
+		exitWithError(err)
+	}
+	labels := make(map[string]string)
+	for _, p := range db.GetAllPeers() {
+		labels[p.PeerID] = p.Label
+	}
+	statuses := intentStatuses(db, selfID.String(), limit)
+	if len(statuses) == 0 {
+		fmt.Println("No operations recorded")
+		return
+	}
+	for _, s := range statuses {
+		fmt.Printf("%s  %s  %s\n", s.Created.Local().Format("2006-01-02 15:04"), s.Summary, s.Delivery())
+		if s.Error != "" && s.State != database.IntentFailed {
+			fmt.Printf("    error: %s\n", s.Error)
+		}
+		for _, id := range s.Pending {
+			name := labels[id]
+			if name == "" {
+				name = shortPeerID(id)
+			}
+			fmt.Printf("    waiting for %s\n", name)
+		}
+	}
+}
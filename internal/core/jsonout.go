@@ -0,0 +1,265 @@
+package core
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/notassigned/endershare/internal/database"
+	"github.com/notassigned/endershare/internal/storage"
+)
+
+// With the global --json flag, the ls, status, peers, usage (du), log and
+// doctor commands print one JSON document instead of text. The types below
+// are the schema of those documents, kept apart from the structs they are
+// filled from: fields are only ever added, never renamed or removed, so
+// scripts and dashboards can rely on them. Times are RFC 3339 and hashes hex.
+
+var jsonOutput bool
+
+// SetJSONOutput (CLI only) makes the commands that support it print JSON
+func SetJSONOutput(on bool) {
+	jsonOutput = on
+}
+
+// printJSON prints a JSON document and exits if it can't be encoded
+func printJSON(v any) {
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		exitWithError(err)
+	}
+	fmt.Println(string(out))
+}
+
+// exitWithError prints err, as {"error": "..."} with --json, and exits with status 1
+func exitWithError(err error) {
+	if jsonOutput {
+		out, _ := json.Marshal(map[string]string{"error": err.Error()})
+		fmt.Println(string(out))
+	} else {
+		fmt.Println("Error:", err)
+	}
+	os.Exit(1)
+}
+
+type statusJSON struct {
+	HasVaultKey     bool        `json:"has_vault_key"`
+	Entries         int64       `json:"entries"`
+	EncryptedBytes  int64       `json:"encrypted_bytes"`
+	Blobs           int64       `json:"blobs"`
+	BlobBytes       int64       `json:"blob_bytes"`
+	Quota           int64       `json:"quota"` // 0 for none
+	FilesComplete   int64       `json:"files_complete"`
+	FilesTotal      int64       `json:"files_total"`
+	BytesStored     int64       `json:"bytes_stored"`
+	BytesReferenced int64       `json:"bytes_referenced"`
+	LastUpdate      *updateJSON `json:"last_update"` // null before the first update
+	Vault           *vaultJSON  `json:"vault"`       // null until the master sent a snapshot
+	Quarantined     int         `json:"quarantined"`
+	CorruptBlobs    int         `json:"corrupt_blobs"`
+	Freeze          freezeJSON  `json:"freeze"`
+	Profile         string      `json:"profile"`      // "standard" or "low-resource"
+	ProfileAuto     bool        `json:"profile_auto"` // Picked from the machine's memory
+	Peers           []peerJSON  `json:"peers"`
+}
+
+type vaultJSON struct {
+	Files        int64 `json:"files"`
+	Folders      int64 `json:"folders"`
+	LogicalBytes int64 `json:"logical_bytes"`
+	StoredBytes  int64 `json:"stored_bytes"`
+}
+
+type freezeJSON struct {
+	Frozen bool       `json:"frozen"`
+	Reason string     `json:"reason"`
+	Since  *time.Time `json:"since"` // null unless frozen
+}
+
+type peerJSON struct {
+	PeerID              string   `json:"peer_id"`
+	Label               string   `json:"label"`
+	Addresses           []string `json:"addresses"`
+	UnverifiedAddresses []string `json:"unverified_addresses"`
+}
+
+type peersJSON struct {
+	Peers []peerJSON `json:"peers"`
+}
+
+// updateJSON is a signed update. Action is the peer or data update action,
+// and Entries the number of entries a data update changes.
+type updateJSON struct {
+	ID        uint64    `json:"id"`
+	Type      string    `json:"type"` // "PEER", "DATA", ...
+	Action    string    `json:"action"`
+	PeerID    string    `json:"peer_id,omitempty"` // Peer updates
+	Entries   int       `json:"entries,omitempty"` // Data updates
+	Note      string    `json:"note,omitempty"`    // Data updates, with the vault key
+	DataHash  string    `json:"data_hash"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type logJSON struct {
+	Updates []updateJSON `json:"updates"`
+}
+
+type usageJSON struct {
+	EncryptedBytes int64             `json:"encrypted_bytes"`
+	Blobs          int64             `json:"blobs"`
+	Quota          int64             `json:"quota"`   // 0 for none
+	Folders        []folderUsageJSON `json:"folders"` // null without the vault key
+}
+
+type folderUsageJSON struct {
+	FolderID string `json:"folder_id"`
+	Name     string `json:"name"` // "/" for the root
+	Files    int    `json:"files"`
+	Bytes    int64  `json:"bytes"`
+}
+
+type listingJSON struct {
+	Path    string      `json:"path"`
+	Entries []entryJSON `json:"entries"`
+}
+
+type entryJSON struct {
+	Type       string     `json:"type"` // "file" or "folder"
+	Name       string     `json:"name"`
+	FolderID   string     `json:"folder_id,omitempty"`   // Folders
+	Size       int64      `json:"size"`                  // Files
+	ModifiedAt *time.Time `json:"modified_at,omitempty"` // Files
+	Tags       []string   `json:"tags"`
+	Note       string     `json:"note,omitempty"`      // Files
+	LockedBy   string     `json:"locked_by,omitempty"` // Files checked out, the device's name or peer ID
+}
+
+type protocolErrorsJSON struct {
+	Errors []ProtocolError `json:"errors"`
+}
+
+// newStatusJSON describes the node status, with the latest update and the
+// peers read from db
+func newStatusJSON(db *database.EndershareDB, status NodeStatus) statusJSON {
+	out := statusJSON{
+		HasVaultKey:     status.HasVaultKey,
+		Entries:         status.Entries,
+		EncryptedBytes:  status.EncryptedBytes,
+		Blobs:           status.Blobs,
+		BlobBytes:       status.BlobBytes,
+		Quota:           status.Quota,
+		FilesComplete:   status.FilesComplete,
+		FilesTotal:      status.FilesTotal,
+		BytesStored:     status.BytesStored,
+		BytesReferenced: status.BytesReferenced,
+		Quarantined:     status.Quarantined,
+		CorruptBlobs:    status.CorruptBlobs,
+		Freeze:          freezeJSON{Frozen: status.Freeze.Frozen, Reason: status.Freeze.Reason},
+		Profile:         storage.ProfileStandard,
+		ProfileAuto:     db.GetResourceProfile() == "",
+		Peers:           newPeersJSON(db.GetAllPeers()),
+	}
+	if latestJSON, err := db.GetLatestUpdateJSON(); err == nil {
+		var signedUpdate SignedUpdate
+		if err := json.Unmarshal([]byte(latestJSON), &signedUpdate); err == nil {
+			if update, err := signedUpdate.GetUpdate(); err == nil {
+				latest := newUpdateJSON(update, nil)
+				out.LastUpdate = &latest
+			}
+		}
+	}
+	if storage.LowResource(db) {
+		out.Profile = storage.ProfileLowResource
+	}
+	if status.Vault != nil {
+		out.Vault = &vaultJSON{
+			Files:        status.Vault.FileCount,
+			Folders:      status.Vault.FolderCount,
+			LogicalBytes: status.Vault.LogicalBytes,
+			StoredBytes:  status.Vault.StoredBytes,
+		}
+	}
+	if status.Freeze.Frozen {
+		since := time.Unix(status.Freeze.Since, 0)
+		out.Freeze.Since = &since
+	}
+	return out
+}
+
+func newPeersJSON(peers []database.DBPeer) []peerJSON {
+	out := make([]peerJSON, 0, len(peers))
+	for _, p := range peers {
+		out = append(out, peerJSON{
+			PeerID:              p.PeerID,
+			Label:               p.Label,
+			Addresses:           nonNil(p.Addresses),
+			UnverifiedAddresses: nonNil(p.Unverified),
+		})
+	}
+	return out
+}
+
+// newUpdateJSON describes a signed update, with the type alone if its
+// payload can't be decoded. stor, which may be nil, decrypts change notes.
+func newUpdateJSON(update Update, stor *storage.Storage) updateJSON {
+	out := updateJSON{
+		ID:        update.UpdateID,
+		Type:      update.UpdateDataType,
+		DataHash:  hex.EncodeToString(update.DataHash),
+		Timestamp: time.Unix(update.Timestamp, 0),
+	}
+	switch update.UpdateDataType {
+	case "PEER":
+		if peerUpdate, err := update.PeerUpdate(); err == nil {
+			out.Action, out.PeerID = peerUpdate.Action, peerUpdate.PeerID
+		}
+	case "DATA":
+		if dataUpdate, err := update.DataUpdate(); err == nil {
+			out.Action, out.Entries = dataUpdate.Action, changedEntries(dataUpdate)
+			out.Note = changeNote(stor, dataUpdate)
+		}
+	}
+	return out
+}
+
+func newUsageJSON(usage storage.Usage) usageJSON {
+	out := usageJSON{EncryptedBytes: usage.EncryptedBytes, Blobs: usage.Blobs, Quota: usage.Quota}
+	if usage.Folders == nil {
+		return out
+	}
+	out.Folders = make([]folderUsageJSON, 0, len(usage.Folders))
+	for _, f := range usage.Folders {
+		name := f.Name
+		if f.FolderID == storage.RootFolderID {
+			name = "/"
+		}
+		out.Folders = append(out.Folders, folderUsageJSON{FolderID: string(f.FolderID), Name: name, Files: f.Files, Bytes: f.Bytes})
+	}
+	return out
+}
+
+// newEntryJSON describes a FileEntry or FolderEntry as listed by ListFolder
+func newEntryJSON(item interface{}) entryJSON {
+	switch e := item.(type) {
+	case storage.FileEntry:
+		modified := e.ModifiedAt
+		out := entryJSON{Type: "file", Name: e.Name, Size: e.Size, ModifiedAt: &modified, Tags: nonNil(e.Tags), Note: e.Note}
+		if e.Lock != nil {
+			out.LockedBy = e.Lock.Who()
+		}
+		return out
+	case storage.FolderEntry:
+		return entryJSON{Type: "folder", Name: e.Name, FolderID: string(e.FolderID), Tags: nonNil(e.Tags)}
+	}
+	return entryJSON{}
+}
+
+// nonNil returns an empty list for nil, so lists are [] rather than null
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
@@ -0,0 +1,180 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/notassigned/endershare/internal/database"
+	"github.com/notassigned/endershare/internal/storage"
+)
+
+// logDefaultLimit is how many updates endershare log shows without a count
+const logDefaultLimit = 20
+
+// LsMain (CLI only) lists a vault folder given by its path, the root by
+// default. Reading names needs the vault key.
+func LsMain(args []string) {
+	path := "/"
+	if len(args) > 0 {
+		path = args[0]
+	}
+
+	db := database.Create()
+	keys := db.GetKeys()
+	if keys == nil {
+		exitWithError(fmt.Errorf("listing folders needs the vault key, this node doesn't hold it"))
+	}
+	stor := storage.NewStorage(db, keys.AESKey)
+	folderID, err := resolveFolderPath(stor, path)
+	if err != nil {
+		exitWithError(err)
+	}
+	items, err := stor.ListFolder(folderID)
+	if err != nil {
+		exitWithError(err)
+	}
+
+	if jsonOutput {
+		listing := listingJSON{Path: path, Entries: make([]entryJSON, 0, len(items))}
+		for _, item := range items {
+			listing.Entries = append(listing.Entries, newEntryJSON(item))
+		}
+		printJSON(listing)
+		return
+	}
+	for _, item := range items {
+		switch e := item.(type) {
+		case storage.FolderEntry:
+			fmt.Printf("%-14s %-20s %s/%s\n", "", "", e.Name, formatTags(e.Tags))
+		case storage.FileEntry:
+			fmt.Printf("%14d %-20s %s%s%s\n", e.Size, e.ModifiedAt.Format(time.DateTime), e.Name, formatTags(e.Tags), formatLock(e.Lock))
+		}
+	}
+}
+
+// ResolveFolder returns the folder a slash-separated vault path names, the
+// root for "" or "/", failing with storage.ErrNotFound if there is none
+func (c *Core) ResolveFolder(path string) (storage.FolderID, error) {
+	if c.storage == nil {
+		return "", fmt.Errorf("this node does not store file contents")
+	}
+	return resolveFolderPath(c.storage, path)
+}
+
+// resolveFolderPath returns the folder a slash-separated path names, walking
+// down from the root by folder name
+func resolveFolderPath(stor *storage.Storage, path string) (storage.FolderID, error) {
+	folderID := storage.RootFolderID
+	for _, name := range strings.Split(path, "/") {
+		if name == "" {
+			continue
+		}
+		items, err := stor.ListFolder(folderID)
+		if err != nil {
+			return "", err
+		}
+		found := false
+		for _, item := range items {
+			if folder, ok := item.(storage.FolderEntry); ok && folder.Name == name {
+				folderID, found = folder.FolderID, true
+				break
+			}
+		}
+		if !found {
+			return "", fmt.Errorf("folder %w: %s", storage.ErrNotFound, path)
+		}
+	}
+	return folderID, nil
+}
+
+// resolveFilePath splits a slash-separated vault path into the folder the
+// file at it would be in and its name
+func resolveFilePath(stor *storage.Storage, p string) (storage.FolderID, string, error) {
+	dir, name := path.Split(path.Clean("/" + p))
+	if name == "" {
+		return "", "", fmt.Errorf("file %w: %s", storage.ErrNotFound, p)
+	}
+	folderID, err := resolveFolderPath(stor, dir)
+	return folderID, name, err
+}
+
+// PeersMain (CLI only) lists the vault peers this node knows with their addresses
+func PeersMain() {
+	db := database.Create()
+	peers := db.GetAllPeers()
+	if jsonOutput {
+		printJSON(peersJSON{Peers: newPeersJSON(peers)})
+		return
+	}
+	if len(peers) == 0 {
+		fmt.Println("No peers")
+		return
+	}
+	for _, p := range peers {
+		line := p.PeerID
+		if p.Label != "" {
+			line += " (" + p.Label + ")"
+		}
+		fmt.Println(line)
+		for _, addr := range p.Addresses {
+			fmt.Println("    " + addr)
+		}
+		for _, addr := range p.Unverified {
+			fmt.Println("    " + addr + " (unverified)")
+		}
+	}
+}
+
+// LogMain (CLI only) prints the most recent signed updates, newest first,
+// with their change notes when this node holds the vault key
+func LogMain(args []string) {
+	limit := logDefaultLimit
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n <= 0 {
+			fmt.Println("Usage: endershare log [count]")
+			os.Exit(1)
+		}
+		limit = n
+	}
+
+	db := database.Create()
+	recent, err := recentUpdates(db, limit)
+	if err != nil {
+		exitWithError(err)
+	}
+	var stor *storage.Storage
+	if keys := db.GetKeys(); keys != nil {
+		stor = storage.NewStorage(db, keys.AESKey)
+	}
+	updates := make([]updateJSON, 0, len(recent))
+	for _, update := range recent {
+		updates = append(updates, newUpdateJSON(update, stor))
+	}
+
+	if jsonOutput {
+		printJSON(logJSON{Updates: updates})
+		return
+	}
+	if len(updates) == 0 {
+		fmt.Println("No updates")
+		return
+	}
+	for _, u := range updates {
+		line := fmt.Sprintf("#%d %s %s %s", u.ID, u.Timestamp.Format(time.RFC3339), u.Type, u.Action)
+		switch {
+		case u.PeerID != "":
+			line += " " + u.PeerID
+		case u.Entries > 1:
+			line += fmt.Sprintf(" (%d entries)", u.Entries)
+		}
+		if u.Note != "" {
+			line += fmt.Sprintf(" %q", u.Note)
+		}
+		fmt.Println(line)
+	}
+}
@@ -0,0 +1,144 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/notassigned/endershare/internal/database"
+	"github.com/notassigned/endershare/internal/storage"
+)
+
+// DeviceLabel names this node on the locks it takes, by its peer label or
+// else the host name
+func (c *Core) DeviceLabel() string {
+	selfID := c.GetNodeID()
+	for _, p := range c.db.GetAllPeers() {
+		if p.PeerID == selfID && p.Label != "" {
+			return p.Label
+		}
+	}
+	return nodeName()
+}
+
+// LockFile checks a file out on this device so the vault's other devices
+// see it is being edited, see storage.LockFile (master only)
+func (c *Core) LockFile(name string, folderID storage.FolderID, note []byte) error {
+	if err := c.checkEditable("lock files"); err != nil {
+		return err
+	}
+	removed, added, err := c.storage.LockFile(name, folderID, c.GetNodeID(), c.DeviceLabel())
+	if err != nil || added == nil {
+		return err
+	}
+	return c.PublishModifyUpdate(removed, added, note)
+}
+
+// UnlockFile releases a lock this device holds on a file, or with force one
+// held by any device (master only)
+func (c *Core) UnlockFile(name string, folderID storage.FolderID, force bool, note []byte) error {
+	if err := c.checkEditable("unlock files"); err != nil {
+		return err
+	}
+	removed, added, err := c.storage.UnlockFile(name, folderID, c.GetNodeID(), force)
+	if err != nil || added == nil {
+		return err
+	}
+	return c.PublishModifyUpdate(removed, added, note)
+}
+
+// lockedElsewhere returns the lock another device holds on a file, nil if
+// there is none
+func (c *Core) lockedElsewhere(name string, folderID storage.FolderID) *storage.FileLock {
+	lock, err := c.storage.GetLock(name, folderID)
+	if err != nil || lock.HeldBy(c.GetNodeID()) {
+		return nil
+	}
+	return lock
+}
+
+// describeLock names who holds a lock and since when
+func describeLock(l storage.FileLock) string {
+	who := l.Label
+	if who == "" {
+		who = shortPeerID(l.Holder)
+	}
+	return fmt.Sprintf("%s since %s", who, l.LockedAt.Local().Format("2006-01-02 15:04"))
+}
+
+// formatLock marks a checked out file in listings, "" if it isn't
+func formatLock(l *storage.FileLock) string {
+	if l == nil {
+		return ""
+	}
+	return " [checked out on " + describeLock(*l) + "]"
+}
+
+// LockMain (CLI only) lists the files that are checked out, or locks or
+// unlocks the files at the given vault paths (master only to change them)
+func LockMain(args []string, locked bool) {
+	if len(args) == 0 {
+		if !locked {
+			fmt.Println("Usage: endershare unlock [--force] <path>...")
+			os.Exit(1)
+		}
+		listLocks()
+		return
+	}
+	force := false
+	if !locked && args[0] == "--force" {
+		force, args = true, args[1:]
+	}
+
+	c := coreStartup(false)
+	if !c.IsMaster() {
+		exitWithError(fmt.Errorf("%w can lock files", ErrNotMaster))
+	}
+	if err := c.CheckWritable(); err != nil {
+		exitWithError(err)
+	}
+	if err := c.setupNotifyService(context.Background()); err != nil {
+		fmt.Println("Error setting up notify service:", err)
+	}
+	for _, p := range args {
+		folderID, name, err := resolveFilePath(c.storage, p)
+		if err != nil {
+			exitWithError(err)
+		}
+		if locked {
+			err = c.LockFile(name, folderID, nil)
+		} else {
+			err = c.UnlockFile(name, folderID, force, nil)
+		}
+		if err != nil {
+			exitWithError(err)
+		}
+		if locked {
+			fmt.Println("Locked", p)
+		} else {
+			fmt.Println("Unlocked", p)
+		}
+	}
+}
+
+// listLocks prints the files that are checked out, from the database alone
+func listLocks() {
+	db := database.Create()
+	keys := db.GetKeys()
+	if keys == nil || keys.AESKey == nil {
+		exitWithError(fmt.Errorf("this node does not store file contents"))
+	}
+	stor := storage.NewStorage(db, keys.AESKey)
+	locks, err := stor.ListLocks()
+	if err != nil {
+		exitWithError(err)
+	}
+	if len(locks) == 0 {
+		fmt.Println("No files are checked out")
+		return
+	}
+	for _, l := range locks {
+		fmt.Printf("%s  %s\n", path.Join(folderPath(stor, l.FolderID), l.Name), describeLock(l.Lock))
+	}
+}
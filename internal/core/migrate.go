@@ -0,0 +1,78 @@
+package core
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/notassigned/endershare/internal/database"
+	"github.com/notassigned/endershare/internal/storage"
+)
+
+// MigrateMain (CLI only) moves the blobs and the database to a new directory,
+// switching to it once every copy is verified. The node must be stopped.
+func MigrateMain(args []string) {
+	if len(args) != 1 {
+		fmt.Println("Usage: endershare migrate <dir>")
+		fmt.Println("Stop the node first; blobs go to <dir>/data and the database to <dir>/endershare.db")
+		os.Exit(1)
+	}
+
+	db := database.Create()
+	stage := ""
+	moved, err := storage.MigrateStorage(db, args[0], func(p storage.MigrateProgress) {
+		if p.Stage != stage {
+			if stage != "" {
+				fmt.Println()
+			}
+			stage = p.Stage
+		}
+		switch p.Stage {
+		case storage.MigrateCopy:
+			fmt.Printf("\rCopying blobs: %d/%d", p.Done, p.Total)
+		case storage.MigrateVerify:
+			fmt.Printf("\rVerifying blobs: %d/%d", p.Done, p.Total)
+		case storage.MigrateDatabase:
+			fmt.Print("\rCopying database")
+		}
+	})
+	if stage != "" {
+		fmt.Println()
+	}
+	if err != nil {
+		exitWithError(err)
+	}
+	fmt.Printf("Vault moved to %s; %d blobs moved\n", args[0], moved)
+}
+
+// AdoptMain (CLI only) stores the encrypted blobs found in a directory, such
+// as the data directory of another node copied to an external disk, once
+// each matches the vault's metadata, instead of downloading them again.
+// Without a directory it adopts the blobs copied into the data directory.
+func AdoptMain(args []string) {
+	if len(args) > 1 {
+		fmt.Println("Usage: endershare adopt [dir]")
+		os.Exit(1)
+	}
+	db := database.Create()
+	keys := db.GetKeys()
+	if keys == nil || keys.AESKey == nil {
+		exitWithError(fmt.Errorf("this node does not store file contents"))
+	}
+	dir := storage.DataDir(db)
+	if len(args) == 1 {
+		dir = args[0]
+	}
+
+	stor := storage.NewStorage(db, keys.AESKey)
+	stats, err := stor.AdoptBlobs(dir, func(done, total int) {
+		fmt.Printf("\rVerifying blobs: %d/%d", done, total)
+	})
+	fmt.Println()
+	if err != nil {
+		exitWithError(err)
+	}
+	fmt.Printf("%d blobs adopted (%s), %d stored already, %d not used by any file\n", stats.Adopted, formatBytes(stats.Bytes), stats.Local, stats.Unknown)
+	if stats.Rejected > 0 {
+		fmt.Printf("%d blobs rejected, first: %v\n", stats.Rejected, stats.FirstErr)
+	}
+}
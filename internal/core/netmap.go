@@ -0,0 +1,245 @@
+package core
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	libp2pcrypto "github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/notassigned/endershare/internal/crypto"
+	"github.com/notassigned/endershare/internal/database"
+)
+
+const (
+	networkMapVersion   = 1
+	networkMapDomainTag = "endershare/network-map"
+)
+
+// Peer roles recorded in a network map
+const (
+	RoleMaster  = "master"
+	RoleReplica = "replica"
+)
+
+// NetworkMapPeer is a device entry in a network map
+type NetworkMapPeer struct {
+	PeerID    string   `json:"peer_id"`
+	Addresses []string `json:"addresses"`
+	Role      string   `json:"role"`
+	Label     string   `json:"label,omitempty"`
+}
+
+// NetworkMap describes the device fleet of a vault so a reinstalled node can
+// reconstruct its peer list without rebinding every device.
+type NetworkMap struct {
+	Version          int              `json:"version"`
+	VaultFingerprint []byte           `json:"vault_fingerprint"`
+	UpdateID         uint64           `json:"update_id"` // Latest update when the map was exported
+	Exported         int64            `json:"exported"`
+	Peers            []NetworkMapPeer `json:"peers"`
+}
+
+// SignedNetworkMap is a NetworkMap signed by the master key
+type SignedNetworkMap struct {
+	MapBytes  []byte `json:"map_bytes"` // JSON bytes of the map
+	Signature []byte `json:"signature"` // Covers NetworkMap.CanonicalBytes
+}
+
+// CanonicalBytes returns the deterministic encoding covered by the master signature
+func (m NetworkMap) CanonicalBytes() []byte {
+	e := &canonicalEncoder{}
+	e.writeString(networkMapDomainTag)
+	e.writeUint16(uint16(m.Version))
+	e.writeBytes(m.VaultFingerprint)
+	e.writeUint64(m.UpdateID)
+	e.writeInt64(m.Exported)
+	e.writeUint32(uint32(len(m.Peers)))
+	for _, p := range m.Peers {
+		e.writeString(p.PeerID)
+		e.writeStrings(p.Addresses)
+		e.writeString(p.Role)
+		e.writeString(p.Label)
+	}
+	return e.Bytes()
+}
+
+// ExportNetworkMap builds and signs a network map of every known peer
+func (c *Core) ExportNetworkMap() (*SignedNetworkMap, error) {
+	if c.keys == nil || c.keys.MasterPrivateKey == nil {
+		return nil, fmt.Errorf("%w can export the network map", ErrNotMaster)
+	}
+
+	selfID, err := keysPeerID(c.keys)
+	if err != nil {
+		return nil, err
+	}
+
+	updateID, _ := c.db.GetCurrentUpdateID()
+	m := NetworkMap{
+		Version:          networkMapVersion,
+		VaultFingerprint: crypto.VaultFingerprint(c.keys.MasterPublicKey),
+		UpdateID:         updateID,
+		Exported:         time.Now().Unix(),
+		Peers:            []NetworkMapPeer{},
+	}
+	for _, p := range c.db.GetAllPeers() {
+		role := RoleReplica
+		if p.PeerID == selfID.String() {
+			role = RoleMaster
+		}
+		addrs := p.Addresses
+		if addrs == nil {
+			addrs = []string{}
+		}
+		m.Peers = append(m.Peers, NetworkMapPeer{
+			PeerID:    p.PeerID,
+			Addresses: addrs,
+			Role:      role,
+			Label:     p.Label,
+		})
+	}
+
+	mapBytes, err := json.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal network map: %w", err)
+	}
+	return &SignedNetworkMap{
+		MapBytes:  mapBytes,
+		Signature: ed25519.Sign(c.keys.MasterPrivateKey, m.CanonicalBytes()),
+	}, nil
+}
+
+// VerifyNetworkMap checks the map signature and vault fingerprint and returns the map
+func VerifyNetworkMap(signed SignedNetworkMap, masterPub ed25519.PublicKey) (*NetworkMap, error) {
+	var m NetworkMap
+	if err := json.Unmarshal(signed.MapBytes, &m); err != nil {
+		return nil, fmt.Errorf("invalid network map: %w", err)
+	}
+	if m.Version != networkMapVersion {
+		return nil, fmt.Errorf("unsupported network map version %d", m.Version)
+	}
+	if !ed25519.Verify(masterPub, m.CanonicalBytes(), signed.Signature) {
+		return nil, fmt.Errorf("network map signature is invalid")
+	}
+	if string(m.VaultFingerprint) != string(crypto.VaultFingerprint(masterPub)) {
+		return nil, fmt.Errorf("network map belongs to a different vault")
+	}
+	return &m, nil
+}
+
+// ImportNetworkMap restores the peer list from a map signed by this vault's master.
+// Existing peers are kept; peers in the map are added or have their addresses
+// and labels refreshed. Returns the number of peers imported.
+func (c *Core) ImportNetworkMap(signed SignedNetworkMap) (int, error) {
+	if c.keys == nil || c.keys.MasterPublicKey == nil {
+		return 0, fmt.Errorf("restore the vault keys before importing a network map")
+	}
+
+	m, err := VerifyNetworkMap(signed, c.keys.MasterPublicKey)
+	if err != nil {
+		return 0, err
+	}
+
+	imported := 0
+	for _, p := range m.Peers {
+		pid, err := peer.Decode(p.PeerID)
+		if err != nil {
+			fmt.Printf("Warning: Skipping invalid peer ID %s in network map\n", p.PeerID)
+			continue
+		}
+		addrInfo := peer.AddrInfo{ID: pid}
+		for _, addr := range p.Addresses {
+			ma, err := multiaddr.NewMultiaddr(addr)
+			if err != nil {
+				continue
+			}
+			addrInfo.Addrs = append(addrInfo.Addrs, ma)
+		}
+
+		if err := c.addPeer(addrInfo); err != nil {
+			return imported, fmt.Errorf("failed to add peer %s: %w", p.PeerID, err)
+		}
+		if p.Label != "" {
+			c.db.SetPeerLabel(p.PeerID, p.Label)
+		}
+		if c.p2pNode != nil {
+			c.VerifyPeerAddrs(addrInfo)
+		}
+		imported++
+	}
+
+	c.db.SetPeerListHash(ComputePeerListHash(c.db.GetAllPeerIDs(), c.digestKey))
+	c.db.SetPeerListHashVersion(peerListHashVersionForKey(c.digestKey))
+	return imported, nil
+}
+
+// keysPeerID derives the libp2p peer ID of this node from its keys
+func keysPeerID(keys *crypto.CryptoKeys) (peer.ID, error) {
+	lpriv, err := libp2pcrypto.UnmarshalEd25519PrivateKey(keys.PeerPrivateKey)
+	if err != nil {
+		return "", err
+	}
+	return peer.IDFromPrivateKey(lpriv)
+}
+
+// NetworkMapMain (CLI only) exports or imports the signed network map
+func NetworkMapMain(args []string) {
+	if len(args) < 2 || (args[0] != "export" && args[0] != "import" && args[0] != "label") {
+		fmt.Println("Usage: endershare netmap <export|import> <file>")
+		fmt.Println("       endershare netmap label <peer-id> <label>")
+		os.Exit(1)
+	}
+
+	db := database.Create()
+	c := &Core{db: db, keys: db.GetKeys()}
+
+	switch args[0] {
+	case "export":
+		signed, err := c.ExportNetworkMap()
+		if err != nil {
+			fmt.Println("Error exporting network map:", err)
+			os.Exit(1)
+		}
+		data, err := json.MarshalIndent(signed, "", "  ")
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		if err := os.WriteFile(args[1], data, 0600); err != nil {
+			fmt.Println("Error writing network map:", err)
+			os.Exit(1)
+		}
+		fmt.Println("Network map written to", args[1])
+
+	case "import":
+		data, err := os.ReadFile(args[1])
+		if err != nil {
+			fmt.Println("Error reading network map:", err)
+			os.Exit(1)
+		}
+		var signed SignedNetworkMap
+		if err := json.Unmarshal(data, &signed); err != nil {
+			fmt.Println("Error: invalid network map file:", err)
+			os.Exit(1)
+		}
+		n, err := c.ImportNetworkMap(signed)
+		if err != nil {
+			fmt.Println("Error importing network map:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Imported %d peers\n", n)
+
+	case "label":
+		label := strings.Join(args[2:], " ")
+		if err := db.SetPeerLabel(args[1], label); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Labelled %s as %q\n", args[1], label)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"sync"
 
 	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/notassigned/endershare/internal/p2p"
 )
 
 func (c *Core) setupNotifyService(ctx context.Context) error {
@@ -17,16 +18,13 @@ func (c *Core) setupNotifyService(ctx context.Context) error {
 		mtx.Lock()
 		defer mtx.Unlock()
 
-		// Parse message type
-		buf := bytes.NewBuffer(data)
-		msgType, err := buf.ReadString('\n')
+		msgType, msgContent, err := parseNotification(data)
 		if err != nil {
 			return
 		}
-		msgContent := buf.Bytes()
 		fmt.Println("Recvd", msgType, "from", from, ":\n", string(msgContent))
 
-		switch strings.TrimSpace(msgType) {
+		switch msgType {
 		case "update":
 			c.handleUpdate(msgContent, from)
 		case "request_latest_update":
@@ -34,9 +32,70 @@ func (c *Core) setupNotifyService(ctx context.Context) error {
 		default:
 			return
 		}
-	}, c.keys.MasterPublicKey[:32])
+	}, c.keys.MasterPublicKey[:32], c.notifyOptions())
 	c.publishUpdate = publishNotification
-	return err
+	if err != nil {
+		return err
+	}
+
+	if c.db.GetUnsynced() {
+		go c.catchUp(ctx, mtx)
+	}
+
+	if c.republishRoot {
+		// Peers see the new data hash and reconcile through the merkle tree
+		if err := c.publishControlUpdate("RESYNC", struct{}{}); err != nil {
+			fmt.Println("Warning: failed to publish resync update:", err)
+		} else {
+			c.republishRoot = false
+		}
+	}
+	return nil
+}
+
+// notifyOptions returns the gossip topic settings configured for this node,
+// validating messages before they reach the handler
+func (c *Core) notifyOptions() p2p.NotifyOptions {
+	opts := p2p.DefaultNotifyOptions()
+	if d := c.db.GetGossipHistory(); d > 0 {
+		opts.History = d
+	}
+	opts.Validate = c.validateNotification
+	opts.Rejected = func(from peer.ID, err error) {
+		c.logPeerError(from, gossipProtocol, "validate", err)
+	}
+	return opts
+}
+
+// validateNotification rejects updates not signed by the master. Unknown
+// message types pass, they may come from newer versions and are dropped by
+// the handler.
+func (c *Core) validateNotification(data []byte) error {
+	msgType, msgContent, err := parseNotification(data)
+	if err != nil {
+		return err
+	}
+	if msgType != "update" {
+		return nil
+	}
+	var signedUpdate SignedUpdate
+	if err := json.Unmarshal(msgContent, &signedUpdate); err != nil {
+		return fmt.Errorf("failed to decode update: %w", err)
+	}
+	if !VerifySignedUpdate(signedUpdate, c.keys.MasterPublicKey) {
+		return fmt.Errorf("invalid update signature")
+	}
+	return nil
+}
+
+// parseNotification splits a gossip message into its type line and content,
+// dropping traffic padding
+func parseNotification(data []byte) (msgType string, content []byte, err error) {
+	line, content, found := bytes.Cut(data, []byte{'\n'})
+	if !found {
+		return "", nil, fmt.Errorf("notification has no type line")
+	}
+	return strings.TrimSpace(string(line)), bytes.TrimRight(content, " "), nil
 }
 
 // Notify sends a message to all peers via gossipsub
@@ -44,20 +103,24 @@ func (c *Core) notify(msgType string, msg []byte) error {
 	if c.publishUpdate == nil {
 		return fmt.Errorf("notify service not initialized")
 	}
-	return c.publishUpdate(append([]byte(msgType+"\n"), msg...))
+	return c.publishUpdate(c.padGossip(append([]byte(msgType+"\n"), msg...)))
 }
 
 func (c *Core) handleUpdate(notification []byte, from peer.ID) {
 	var signedUpdate SignedUpdate
 	if err := json.Unmarshal(notification, &signedUpdate); err != nil {
 		fmt.Println("Failed to unmarshal update notification:", err)
+		c.logPeerError(from, gossipProtocol, "decode update", err)
 		return
 	}
 
 	// Sync logic is implemented in sync.go
 	if err := c.processUpdate(signedUpdate, from); err != nil {
 		fmt.Println("Failed to process update:", err)
+		c.logPeerError(from, gossipProtocol, "process update", err)
+		return
 	}
+	c.peerAnswered.Store(true)
 }
 
 func (c *Core) handleLatestUpdateRequest() {
@@ -0,0 +1,84 @@
+package core
+
+import (
+	"bytes"
+	"io"
+	"math/rand/v2"
+	"time"
+)
+
+// Traffic padding hides how much a node syncs from someone watching the
+// network. Gossip messages and sync requests and responses are padded with
+// JSON whitespace up to the next size bucket, which every decoder skips, so
+// padded and unpadded nodes interoperate. Raw hash lists and file data are
+// sent as is.
+const (
+	minPaddedSize = 512 // Smallest bucket, buckets double from here
+
+	// maxPaddedGossip is the largest message peers accept on the notify
+	// topic (see p2p.DefaultNotifyOptions)
+	maxPaddedGossip = 256 << 10
+
+	jitterFraction = 0.25 // Periodic requests move by up to this share of their interval
+)
+
+// paddedSize returns the bucket a message of n bytes is padded to
+func paddedSize(n int64) int64 {
+	size := int64(minPaddedSize)
+	for size < n {
+		size *= 2
+	}
+	return size
+}
+
+// padGossip pads a gossip message when traffic padding is on
+func (c *Core) padGossip(msg []byte) []byte {
+	if !c.db.GetTrafficPadding() {
+		return msg
+	}
+	size := paddedSize(int64(len(msg)))
+	if size > maxPaddedGossip {
+		return msg
+	}
+	return append(msg, bytes.Repeat([]byte{' '}, int(size)-len(msg))...)
+}
+
+// paddedWriter counts what is written through it so pad can fill the
+// message up to its bucket
+type paddedWriter struct {
+	w       io.Writer
+	n       int64
+	enabled bool
+}
+
+// padWriter wraps a stream whose JSON messages are padded when traffic
+// padding is on. Call pad once the message is written.
+func (c *Core) padWriter(w io.Writer) *paddedWriter {
+	return &paddedWriter{w: w, enabled: c.db.GetTrafficPadding()}
+}
+
+func (p *paddedWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.n += int64(n)
+	return n, err
+}
+
+// pad writes whitespace up to the bucket of what was written so far
+func (p *paddedWriter) pad() error {
+	if !p.enabled {
+		return nil
+	}
+	fill := paddedSize(p.n) - p.n
+	_, err := p.Write(bytes.Repeat([]byte{' '}, int(fill)))
+	return err
+}
+
+// jittered returns interval moved randomly by up to jitterFraction when
+// traffic padding is on, so periodic requests do not tick like a clock
+func (c *Core) jittered(interval time.Duration) time.Duration {
+	if !c.db.GetTrafficPadding() {
+		return interval
+	}
+	spread := float64(interval) * jitterFraction
+	return interval + time.Duration((rand.Float64()*2-1)*spread)
+}
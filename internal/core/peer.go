@@ -10,6 +10,8 @@ import (
 	"strings"
 	"time"
 
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
 	"github.com/notassigned/endershare/internal/crypto"
 	"github.com/notassigned/endershare/internal/database"
 	"github.com/notassigned/endershare/internal/p2p"
@@ -59,6 +61,19 @@ func PeerMain(initMode bool) {
 		}
 	}
 
+	c.serve()
+
+	// Wait indefinitely, periodically requesting latest updates
+	for {
+		c.RequestLatestUpdate()
+		time.Sleep(c.jittered(time.Second * 15))
+	}
+}
+
+// serve starts everything a running node does in the background: update
+// notifications, connection management, the master's periodic work, content
+// processors and, if configured, the API daemon
+func (c *Core) serve() {
 	// Setup notify service for all nodes
 	err := c.setupNotifyService(context.Background())
 	if err != nil {
@@ -72,11 +87,26 @@ func PeerMain(initMode bool) {
 		fmt.Println("Warning: No master public key available, cannot manage connections yet")
 	}
 
-	// Wait indefinitely, periodically requesting latest updates
-	t := time.NewTicker(time.Second * 15)
-	for {
-		c.RequestLatestUpdate()
-		<-t.C
+	if c.IsMaster() && c.storage != nil {
+		// Operations the last run recorded but didn't finish were interrupted
+		c.db.FailPendingIntents("interrupted before it finished")
+		go c.runStatusSnapshots(context.Background())
+		go c.runReceiptCollection(context.Background())
+		go c.runStorageChallenges(context.Background())
+		go c.runDeviceStatusCollection(context.Background())
+		go c.runUpdateAckCollection(context.Background())
+		go c.runTrashPurge(context.Background())
+		go c.runReports(context.Background())
+	}
+	if !c.IsMaster() && c.storage != nil {
+		go c.runSelection(context.Background())
+	}
+	go c.runPeerstoreSaves(context.Background())
+	go c.runAlerts(context.Background())
+	c.startContentProcessors(context.Background())
+
+	if addr := c.db.GetAPIListen(); addr != "" {
+		c.startAPIDaemon(addr)
 	}
 }
 
@@ -96,6 +126,7 @@ func BindMain(syncPhrase string) {
 		fmt.Println("Error binding peer:", err)
 		os.Exit(1)
 	}
+	c.flushAllPeerAddrs()
 
 	fmt.Println("Successfully bound new peer")
 }
@@ -112,10 +143,45 @@ func (c *Core) GetOtherPeerIDs() []string {
 	return otherPeerIDs
 }
 
+// BindProgress reports a stage of binding a new peer
+type BindProgress struct {
+	Stage  p2p.BindStage
+	PeerID string // The peer being bound, empty while searching
+	Err    error  // Set with p2p.BindFailed
+	// Set with p2p.BindDone if the peer was removed earlier and got its
+	// former record back
+	Restored *database.DBFormerPeer
+}
+
 // BindNewPeer discovers and authorizes a new replica peer using the sync phrase
 func (c *Core) BindNewPeer(syncPhrase string) error {
+	return c.BindNewPeerWithProgress(context.Background(), syncPhrase, nil)
+}
+
+// BindNewPeerWithProgress is BindNewPeer reporting every stage to progress,
+// ending with p2p.BindDone or p2p.BindFailed. Cancelling ctx aborts the
+// binding unless the peer list was already sent. The binding is listed by
+// PendingBindings while it runs, see StartPeerBinding.
+func (c *Core) BindNewPeerWithProgress(ctx context.Context, syncPhrase string, progress func(BindProgress)) error {
+	if progress == nil {
+		progress = func(BindProgress) {}
+	}
 	if c.keys.MasterPrivateKey == nil {
-		return fmt.Errorf("only master nodes can bind new peers")
+		return fmt.Errorf("%w can bind new peers", ErrNotMaster)
+	}
+	b, ctx, err := c.bindings.add(ctx, syncPhrase)
+	if err != nil {
+		return err
+	}
+	return c.runPeerBinding(ctx, b, progress)
+}
+
+// bindNewPeer binds the peer showing syncPhrase. A peer that was removed
+// earlier gets its former record back, which is returned; a banned one is
+// refused before it receives anything.
+func (c *Core) bindNewPeer(ctx context.Context, syncPhrase string, progress func(p2p.BindStage, peer.ID)) (*database.DBFormerPeer, error) {
+	if c.keys.MasterPrivateKey == nil {
+		return nil, fmt.Errorf("%w can bind new peers", ErrNotMaster)
 	}
 
 	// Get existing peers to send to the new peer
@@ -123,37 +189,63 @@ func (c *Core) BindNewPeer(syncPhrase string) error {
 
 	// Discover and bind the new peer, sending them the peer list
 	peerInfo, err := p2p.BindNewPeer(
+		ctx,
 		syncPhrase,
 		c.p2pNode,
 		c.keys.MasterPublicKey,
 		c.keys.MasterPrivateKey,
+		c.digestKey,
 		existingPeers,
+		progress,
+		func(id peer.ID) error {
+			if former := c.db.GetFormerPeer(id.String()); former != nil && former.Banned {
+				return fmt.Errorf("%w: %s", ErrPeerBanned, id)
+			}
+			return nil
+		},
 	)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// Add to allowed peers
-	err = c.db.AddPeer(*peerInfo)
-	if err != nil {
-		return fmt.Errorf("error adding peer to database: %v", err)
+	// Check the addresses before publishing them to the whole vault, and keep
+	// only those the replicas would accept
+	peerInfo.Addrs = p2p.FilterPeerAddrs(peerInfo.Addrs)
+	var unverified []string
+	if c.db.GetVerifyPeerAddrs() {
+		var bad []multiaddr.Multiaddr
+		peerInfo.Addrs, bad = c.p2pNode.VerifyAddrs(context.Background(), *peerInfo)
+		unverified = addrStrings(bad)
 	}
 
-	// Also add to p2pNode's in-memory map
-	c.p2pNode.AddPeer(*peerInfo)
+	// Concurrent bindings add their peers one at a time, so each publishes
+	// an update on top of the previous one
+	c.bindings.commit.Lock()
+	defer c.bindings.commit.Unlock()
+
+	// Rebinding a known peer must not republish unchanged addresses
+	before, known := c.db.GetPeerAddresses(peerInfo.ID.String())
+
+	// Add to allowed peers, in the database and the p2p node's peer map
+	err = c.addPeer(*peerInfo)
+	if err != nil {
+		return nil, fmt.Errorf("error adding peer to database: %v", err)
+	}
+	if len(unverified) > 0 {
+		if err := c.db.SetPeerAddresses(peerInfo.ID.String(), addrStrings(peerInfo.Addrs), unverified); err != nil {
+			fmt.Println("Warning: Failed to store unverified addresses:", err)
+		}
+	}
+	former := c.restoreFormerPeer(peerInfo.ID.String())
 
 	fmt.Println("Successfully bound peer:", peerInfo.ID)
 
 	// Publish peer update to network
-	addrs := []string{}
-	for _, addr := range peerInfo.Addrs {
-		addrs = append(addrs, addr.String())
-	}
-	if err := c.PublishPeerUpdate("ADD", peerInfo.ID.String(), addrs); err != nil {
+	if err := c.publishPeerAddrs(peerInfo.ID.String(), before, known, addrStrings(peerInfo.Addrs)); err != nil {
 		fmt.Println("Warning: Failed to publish peer update:", err)
 	}
 
-	return nil
+	return former, nil
 }
 
 // bindToMaster is called by replica nodes to receive authorization from a master node
@@ -163,38 +255,72 @@ func (c *Core) bindToMaster() {
 		panic(fmt.Sprintf("Error binding to master: %v", err))
 	}
 
-	// Store master public key
-	err = c.db.SetMasterPublicKey(clientInfo.MasterPublicKey)
-	if err != nil {
-		panic(fmt.Sprintf("Error storing master public key: %v", err))
+	if err := c.StoreBinding(clientInfo); err != nil {
+		panic(fmt.Sprintf("Error binding to master: %v", err))
 	}
 
-	// Update keys with received master public key
-	c.keys.MasterPublicKey = clientInfo.MasterPublicKey
-
-	// Store the updated keys
-	c.db.StoreKeys(c.keys)
+	fmt.Println("Successfully bound to master node:", clientInfo.PeerID)
+	fmt.Printf("Received %d peers from network\n", len(clientInfo.PeerList))
+	fmt.Println("Note: This replica node does not have the encryption key and cannot decrypt data")
+}
 
-	// Add master node to allowed peers
-	err = c.db.AddPeer(clientInfo.AddrInfo)
-	if err != nil {
-		panic(fmt.Sprintf("Error adding master peer: %v", err))
+// StoreBinding persists the vault details a master sent while binding this
+// node. The digest key is kept first, then the master and the peers of its
+// list are added and removed again if one fails; the master public key is stored last, so a binding that
+// fails or is interrupted leaves the node unbound.
+func (c *Core) StoreBinding(info *p2p.ClientInfo) error {
+	if info.DigestKey != nil {
+		if err := c.setDigestKey(info.DigestKey); err != nil {
+			return fmt.Errorf("failed to store digest key: %w", err)
+		}
 	}
 
-	// Store all peers from the received list
-	for _, peerInfo := range clientInfo.PeerList {
-		if err := c.db.AddPeer(peerInfo); err != nil {
-			fmt.Printf("Warning: Failed to add peer %s: %v\n", peerInfo.ID, err)
+	known := make(map[string]bool)
+	for _, id := range c.db.GetAllPeerIDs() {
+		known[id] = true
+	}
+	allPeers := append(info.PeerList, info.AddrInfo)
+	var added []string
+	for _, p := range allPeers {
+		if err := c.db.AddPeer(p); err != nil {
+			for _, id := range added {
+				if err := c.db.RemovePeer(id); err != nil {
+					fmt.Printf("Warning: Failed to remove peer %s: %v\n", id, err)
+				}
+			}
+			return fmt.Errorf("failed to add peer %s: %w", p.ID, err)
+		}
+		if !known[p.ID.String()] {
+			added = append(added, p.ID.String())
 		}
 	}
 
+	c.keys.MasterPublicKey = info.MasterPublicKey
+	c.db.StoreKeys(c.keys)
+	c.p2pNode.SetVaultFingerprint(crypto.VaultFingerprint(info.MasterPublicKey))
+
 	// Update P2P node's in-memory peer map with all peers (including master)
-	allPeers := append(clientInfo.PeerList, clientInfo.AddrInfo)
 	c.p2pNode.ReplacePeers(allPeers)
+	c.VerifyPeerAddrs(allPeers...)
+	return nil
+}
 
-	fmt.Println("Successfully bound to master node:", clientInfo.PeerID)
-	fmt.Printf("Received %d peers from network\n", len(clientInfo.PeerList))
-	fmt.Println("Note: This replica node does not have the encryption key and cannot decrypt data")
+// discardPartialBinding removes the peers an interrupted binding may have
+// left behind. An unbound node knows no peers but itself.
+func (c *Core) discardPartialBinding() error {
+	if c.keys.MasterPublicKey != nil {
+		return fmt.Errorf("node is already bound to a vault")
+	}
+	self := c.p2pNode.GetPeerId().String()
+	for _, id := range c.db.GetAllPeerIDs() {
+		if id == self {
+			continue
+		}
+		if err := c.db.RemovePeer(id); err != nil {
+			return fmt.Errorf("failed to remove peer %s: %w", id, err)
+		}
+	}
+	return nil
 }
 
 // coreStartupWithMnemonic initializes a core with a specific mnemonic
@@ -211,14 +337,17 @@ func coreStartupWithMnemonic(mnemonic string) *Core {
 	}
 
 	ctx := context.Background()
-	p2pNode, err := p2p.NewP2PNode(keys.PeerPrivateKey, ctx, c.db.GetPeers(), 13000)
+	p2pNode, err := p2p.NewP2PNode(keys.PeerPrivateKey, ctx, c.db.GetPeers(), 13000, transportOptions(c.db))
 	if err != nil {
 		panic(fmt.Sprintf("Error starting P2P node: %v", err))
 	}
 
 	c.p2pNode = p2pNode
 	c.keys = keys
+	c.restorePeerstore()
+	c.p2pNode.SetVaultFingerprint(crypto.VaultFingerprint(keys.MasterPublicKey))
 	c.storage = storage.NewStorage(c.db, keys.AESKey)
+	c.storage.SetBlobFetcher(c.fetchBlob)
 
 	return c
 }
@@ -228,10 +357,105 @@ func (c *Core) RequestLatestUpdate() {
 	c.notify("request_latest_update", nil)
 }
 
-// PublishDataUpdate creates and broadcasts a data update (ADD or DELETE)
-func (c *Core) PublishDataUpdate(action string, key, value []byte, size int64, hash []byte) error {
+// PublishDataUpdate creates and broadcasts a data update (ADD or DELETE).
+// note is a change note sealed with storage.SealChangeNote, or nil; the
+// other Publish*Update functions take one too.
+func (c *Core) PublishDataUpdate(action string, key, value []byte, size int64, hash, note []byte) error {
+	return c.publishDataUpdate(DataUpdate{
+		Action: action,
+		Key:    key,
+		Value:  value,
+		Size:   size,
+		Hash:   hash,
+		Note:   note,
+	})
+}
+
+// PublishModifyUpdate creates and broadcasts a MODIFY update replacing prev
+// with entry. Both are expected to be in the database already: entry stored
+// and prev deleted by the storage layer.
+func (c *Core) PublishModifyUpdate(prev, entry *database.DataEntry, note []byte) error {
+	return c.publishDataUpdate(DataUpdate{
+		Action:   "MODIFY",
+		Key:      entry.Key,
+		Value:    entry.Value,
+		Size:     entry.Size,
+		Hash:     entry.Hash,
+		PrevKey:  prev.Key,
+		PrevHash: prev.Hash,
+		Note:     note,
+	})
+}
+
+// PublishSubtreeUpdate creates and broadcasts a BATCH update for a renamed or
+// moved folder, so replicas replace the folder and any rewritten entries
+// below it at once and learn which entries changed path. The entries are
+// expected to be in the database already, see PublishModifyUpdate.
+func (c *Core) PublishSubtreeUpdate(change *storage.SubtreeChange, note []byte) error {
+	batch := DataUpdate{Action: "BATCH", Subtree: change.Descendants, Note: note}
+	for _, ec := range change.Changes {
+		batch.Batch = append(batch.Batch, DataUpdate{
+			Action:   "MODIFY",
+			Key:      ec.Added.Key,
+			Value:    ec.Added.Value,
+			Size:     ec.Added.Size,
+			Hash:     ec.Added.Hash,
+			PrevKey:  ec.Removed.Key,
+			PrevHash: ec.Removed.Hash,
+		})
+	}
+	return c.publishDataUpdate(batch)
+}
+
+// maxBatchBytes bounds the encoded operations of one BATCH update published
+// by PublishBatchUpdate, well below the gossip message limit
+const maxBatchBytes = 128 << 10
+
+// PublishBatchUpdate creates and broadcasts BATCH updates adding added and
+// deleting deleted, in that order, so replicas apply a folder import in one
+// step. An import too large for one message is split into as few updates as
+// fit; each is still applied all at once and carries note. The entries are
+// expected to be in the database already, see PublishModifyUpdate.
+func (c *Core) PublishBatchUpdate(added, deleted []*database.DataEntry, note []byte) error {
+	var ops []DataUpdate
+	for _, e := range added {
+		ops = append(ops, DataUpdate{Action: "ADD", Key: e.Key, Value: e.Value, Size: e.Size, Hash: e.Hash})
+	}
+	for _, e := range deleted {
+		ops = append(ops, DataUpdate{Action: "DELETE", Key: e.Key, Value: e.Value, Size: e.Size, Hash: e.Hash})
+	}
+
+	batch, size := DataUpdate{Action: "BATCH", Note: note}, 0
+	for _, op := range ops {
+		encoded, err := json.Marshal(op)
+		if err != nil {
+			return fmt.Errorf("failed to marshal update data: %w", err)
+		}
+		if len(batch.Batch) > 0 && size+len(encoded) > maxBatchBytes {
+			if err := c.publishDataUpdate(batch); err != nil {
+				return err
+			}
+			batch, size = DataUpdate{Action: "BATCH", Note: note}, 0
+		}
+		batch.Batch = append(batch.Batch, op)
+		size += len(encoded)
+	}
+	if len(batch.Batch) == 0 {
+		return nil
+	}
+	return c.publishDataUpdate(batch)
+}
+
+// publishDataUpdate signs, stores and broadcasts a data update
+func (c *Core) publishDataUpdate(dataUpdate DataUpdate) error {
 	if c.keys.MasterPrivateKey == nil {
-		return fmt.Errorf("only master nodes can publish data updates")
+		return fmt.Errorf("%w can publish data updates", ErrNotMaster)
+	}
+	if err := c.checkSynced(); err != nil {
+		return err
+	}
+	if err := c.CheckWritable(); err != nil {
+		return err
 	}
 
 	// Get current state
@@ -250,22 +474,13 @@ func (c *Core) PublishDataUpdate(action string, key, value []byte, size int64, h
 		prevPeerHash = make([]byte, 32)
 	}
 
-	// Create DataUpdate
-	dataUpdate := DataUpdate{
-		Action: action,
-		Key:    key,
-		Value:  value,
-		Size:   size,
-		Hash:   hash,
+	updateData, err := newUpdateData(dataUpdate)
+	if err != nil {
+		return err
 	}
 
 	// Update merkle tree (data is already in DB from the storage layer)
-	switch action {
-	case "ADD", "MODIFY":
-		c.merkleTree.Insert(hash)
-	case "DELETE":
-		c.merkleTree.Delete(hash)
-	}
+	updateTree(c.merkleTree, dataUpdate)
 	c.updateDataHash()
 
 	// Get new data hash from merkle tree
@@ -280,8 +495,10 @@ func (c *Core) PublishDataUpdate(action string, key, value []byte, size int64, h
 		PrevDataHash:     prevDataHash,
 		NumBuckets:       c.merkleTree.GetNumBuckets(),
 		UpdateDataType:   "DATA",
-		UpdateData:       dataUpdate,
+		UpdateData:       updateData,
 		Timestamp:        time.Now().Unix(),
+		KeyEpoch:         c.db.GetKeyEpoch(),
+		DigestKeyID:      c.digestKeyID(),
 	}
 
 	// Sign update
@@ -304,12 +521,65 @@ func (c *Core) PublishDataUpdate(action string, key, value []byte, size int64, h
 	c.db.SetDataRootHash(newDataHash)
 	c.db.SetLatestUpdateJSON(string(signedUpdateJSON))
 
+	c.emitDataUpdate(dataUpdate, update.KeyEpoch)
+	c.emitUpdate(update)
+
 	// Broadcast notification
 	return c.notify("update", signedUpdateJSON)
 }
 
+// updateTree applies the entry changes of a data update to a merkle tree
+func updateTree(tree *crypto.MerkleTree, dataUpdate DataUpdate) {
+	switch dataUpdate.Action {
+	case "ADD", "MODIFY":
+		if dataUpdate.PrevHash != nil {
+			tree.Delete(dataUpdate.PrevHash)
+		}
+		tree.Insert(dataUpdate.Hash)
+	case "DELETE":
+		tree.Delete(dataUpdate.Hash)
+	case "BATCH":
+		for _, op := range dataUpdate.Batch {
+			updateTree(tree, op)
+		}
+	}
+}
+
+// emitDataUpdate emits the entry events of a data update. A BATCH with a
+// subtree also emits EventSubtreeMoved for the folder it starts with.
+func (c *Core) emitDataUpdate(dataUpdate DataUpdate, keyEpoch uint32) {
+	if dataUpdate.Action == "BATCH" {
+		for _, op := range dataUpdate.Batch {
+			c.emitDataUpdate(op, keyEpoch)
+		}
+		if len(dataUpdate.Batch) > 0 && dataUpdate.Subtree != nil {
+			folder := dataUpdate.Batch[0]
+			c.emit(Event{
+				Type:    EventSubtreeMoved,
+				Entry:   &database.DataEntry{Key: folder.Key, Hash: folder.Hash, KeyEpoch: keyEpoch},
+				Subtree: dataUpdate.Subtree,
+			})
+		}
+		return
+	}
+
+	entry := database.DataEntry{Key: dataUpdate.Key, Value: dataUpdate.Value, Size: dataUpdate.Size, Hash: dataUpdate.Hash, KeyEpoch: keyEpoch}
+	if dataUpdate.PrevKey != nil {
+		c.emitEntry(EventEntryRemoved, database.DataEntry{Key: dataUpdate.PrevKey, Hash: dataUpdate.PrevHash})
+	}
+	if dataUpdate.Action == "DELETE" {
+		c.emitEntry(EventEntryRemoved, entry)
+	} else {
+		c.emitEntry(EventEntryAdded, entry)
+	}
+}
+
 // PublishPeerUpdate creates and broadcasts a peer update (ADD or REMOVE)
 func (c *Core) PublishPeerUpdate(action string, peerID string, addrs []string) error {
+	if err := c.checkSynced(); err != nil {
+		return err
+	}
+
 	// Get current state
 	currentID, err := c.db.GetCurrentUpdateID()
 	if err != nil {
@@ -327,7 +597,7 @@ func (c *Core) PublishPeerUpdate(action string, peerID string, addrs []string) e
 	}
 
 	// Compute new peer list hash
-	newPeerHash := ComputePeerListHash(c.db.GetAllPeerIDs())
+	newPeerHash := ComputePeerListHash(c.db.GetAllPeerIDs(), c.digestKey)
 
 	// Create update data
 	peerUpdate := PeerUpdate{
@@ -335,6 +605,10 @@ func (c *Core) PublishPeerUpdate(action string, peerID string, addrs []string) e
 		PeerID:    peerID,
 		Addresses: addrs,
 	}
+	updateData, err := newUpdateData(peerUpdate)
+	if err != nil {
+		return err
+	}
 
 	// Create update
 	update := Update{
@@ -344,8 +618,10 @@ func (c *Core) PublishPeerUpdate(action string, peerID string, addrs []string) e
 		DataHash:         prevDataHash,
 		PrevDataHash:     prevDataHash,
 		UpdateDataType:   "PEER",
-		UpdateData:       peerUpdate,
+		UpdateData:       updateData,
 		Timestamp:        time.Now().Unix(),
+		KeyEpoch:         c.db.GetKeyEpoch(),
+		DigestKeyID:      c.digestKeyID(),
 	}
 
 	// Sign entire update JSON
@@ -366,8 +642,17 @@ func (c *Core) PublishPeerUpdate(action string, peerID string, addrs []string) e
 	// Update node state
 	c.db.SetCurrentUpdateID(update.UpdateID)
 	c.db.SetPeerListHash(newPeerHash)
+	c.db.SetPeerListHashVersion(peerListHashVersionForKey(c.digestKey))
 	c.db.SetLatestUpdateJSON(string(signedUpdateJSON))
 
+	switch action {
+	case "ADD":
+		c.emitPeer(EventPeerJoined, peerID)
+	case "REMOVE":
+		c.emitPeer(EventPeerLeft, peerID)
+	}
+	c.emitUpdate(update)
+
 	// Broadcast notification
 	notificationJSON, err := json.Marshal(signedUpdate)
 	if err != nil {
@@ -376,3 +661,103 @@ func (c *Core) PublishPeerUpdate(action string, peerID string, addrs []string) e
 
 	return c.notify("update", notificationJSON)
 }
+
+// publishControlUpdate creates and broadcasts a signed update that carries a
+// control payload (e.g. "RELEASE") and leaves the peer list and data hashes unchanged
+func (c *Core) publishControlUpdate(dataType string, payload interface{}) error {
+	if c.keys.MasterPrivateKey == nil {
+		return fmt.Errorf("%w can publish %s updates", ErrNotMaster, strings.ToLower(dataType))
+	}
+	if err := c.checkSynced(); err != nil {
+		return err
+	}
+
+	currentID, err := c.db.GetCurrentUpdateID()
+	if err != nil {
+		currentID = 0
+	}
+
+	peerHash, err := c.db.GetPeerListHash()
+	if err != nil {
+		peerHash = make([]byte, 32)
+	}
+
+	dataHash, err := c.db.GetDataRootHash()
+	if err != nil {
+		dataHash = make([]byte, 32)
+	}
+
+	updateData, err := newUpdateData(payload)
+	if err != nil {
+		return err
+	}
+
+	numBuckets := 0
+	if c.merkleTree != nil {
+		numBuckets = c.merkleTree.GetNumBuckets()
+	}
+
+	update := Update{
+		UpdateID:         currentID + 1,
+		PeerListHash:     peerHash,
+		PrevPeerListHash: peerHash,
+		DataHash:         dataHash,
+		PrevDataHash:     dataHash,
+		NumBuckets:       numBuckets,
+		UpdateDataType:   dataType,
+		UpdateData:       updateData,
+		Timestamp:        time.Now().Unix(),
+		KeyEpoch:         c.db.GetKeyEpoch(),
+		DigestKeyID:      c.digestKeyID(),
+	}
+
+	signedUpdate, err := SignUpdate(update, c.keys.MasterPrivateKey)
+	if err != nil {
+		return fmt.Errorf("failed to sign update: %w", err)
+	}
+
+	signedUpdateJSON, err := json.Marshal(signedUpdate)
+	if err != nil {
+		return fmt.Errorf("failed to marshal signed update: %w", err)
+	}
+	if err := c.db.InsertSignedUpdate(update.UpdateID, string(signedUpdateJSON)); err != nil {
+		return fmt.Errorf("failed to insert update: %w", err)
+	}
+
+	c.db.SetCurrentUpdateID(update.UpdateID)
+	c.db.SetLatestUpdateJSON(string(signedUpdateJSON))
+	c.emitUpdate(update)
+
+	return c.notify("update", signedUpdateJSON)
+}
+
+// VerifyPeerAddrs dial-back checks the stored addresses of peers in the
+// background, if enabled. Addresses that don't lead to the peer are marked
+// unverified so reconnects stop trying them.
+func (c *Core) VerifyPeerAddrs(peers ...peer.AddrInfo) {
+	if !c.db.GetVerifyPeerAddrs() || len(peers) == 0 {
+		return
+	}
+	go func() {
+		for _, info := range peers {
+			verified, unverified := c.p2pNode.VerifyAddrs(context.Background(), info)
+			if len(unverified) == 0 {
+				continue
+			}
+			fmt.Printf("Peer %s: %d of %d addresses failed dial-back\n", info.ID, len(unverified), len(info.Addrs))
+			if err := c.db.SetPeerAddresses(info.ID.String(), addrStrings(verified), addrStrings(unverified)); err != nil {
+				fmt.Println("Warning: Failed to store verified addresses:", err)
+				continue
+			}
+			c.p2pNode.SetPeerAddrs(peer.AddrInfo{ID: info.ID, Addrs: verified})
+		}
+	}()
+}
+
+func addrStrings(addrs []multiaddr.Multiaddr) []string {
+	out := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		out = append(out, addr.String())
+	}
+	return out
+}
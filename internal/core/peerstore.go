@@ -0,0 +1,79 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/notassigned/endershare/internal/database"
+	"github.com/notassigned/endershare/internal/p2p"
+)
+
+const (
+	peerstoreSaveInterval = 5 * time.Minute
+	peerRecordMaxAge      = 7 * 24 * time.Hour // Older addresses are likely stale
+)
+
+// restorePeerstore seeds the libp2p peerstore with the records saved by a
+// previous run
+func (c *Core) restorePeerstore() {
+	var records []p2p.PeerRecord
+	for _, r := range c.db.GetPeerRecords(time.Now().Add(-peerRecordMaxAge)) {
+		id, err := peer.Decode(r.PeerID)
+		if err != nil {
+			continue
+		}
+		record := p2p.PeerRecord{ID: id, Latency: r.Latency}
+		for _, s := range r.Addrs {
+			if addr, err := multiaddr.NewMultiaddr(s); err == nil {
+				record.Addrs = append(record.Addrs, addr)
+			}
+		}
+		for _, s := range r.Protocols {
+			record.Protocols = append(record.Protocols, protocol.ID(s))
+		}
+		if len(record.Addrs) > 0 {
+			records = append(records, record)
+		}
+	}
+	c.p2pNode.RestorePeerRecords(context.Background(), records)
+}
+
+// SavePeerstore saves what the libp2p peerstore knows about vault peers
+func (c *Core) SavePeerstore() error {
+	now := time.Now()
+	var records []database.DBPeerRecord
+	for _, r := range c.p2pNode.PeerRecords() {
+		record := database.DBPeerRecord{
+			PeerID:  r.ID.String(),
+			Addrs:   addrStrings(r.Addrs),
+			Latency: r.Latency,
+			Updated: now,
+		}
+		for _, proto := range r.Protocols {
+			record.Protocols = append(record.Protocols, string(proto))
+		}
+		records = append(records, record)
+	}
+	return c.db.SavePeerRecords(records)
+}
+
+// runPeerstoreSaves saves the peerstore periodically, since nodes are
+// usually stopped without a chance to save on exit
+func (c *Core) runPeerstoreSaves(ctx context.Context) {
+	t := time.NewTicker(peerstoreSaveInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		if err := c.SavePeerstore(); err != nil {
+			fmt.Println("Warning: Failed to save peerstore:", err)
+		}
+	}
+}
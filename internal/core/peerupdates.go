@@ -0,0 +1,183 @@
+package core
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/notassigned/endershare/internal/database"
+)
+
+// peerAddrCoalesceDelay is how long address changes of a known peer are
+// collected before a single update with the latest addresses is published
+const peerAddrCoalesceDelay = 30 * time.Second
+
+// pendingPeerAddr is an address change waiting to be published
+type pendingPeerAddr struct {
+	published []string // Addresses before the first change of the window
+	latest    []string
+}
+
+// peerAddrCoalescer holds address changes of known peers until their window ends
+type peerAddrCoalescer struct {
+	mu      sync.Mutex
+	pending map[string]*pendingPeerAddr
+}
+
+// sameAddrs reports whether two address lists hold the same set
+func sameAddrs(a, b []string) bool {
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(slices.Compact(a), slices.Compact(b))
+}
+
+// publishPeerAddrs announces the addresses of a bound peer (master only).
+// before and known describe the peer list entry prior to the change. A new
+// peer is published at once so it can sync; unchanged addresses publish
+// nothing; address changes of a known peer are coalesced so a flapping peer
+// costs one update per window.
+func (c *Core) publishPeerAddrs(peerID string, before []string, known bool, addrs []string) error {
+	if !known {
+		return c.PublishPeerUpdate("ADD", peerID, addrs)
+	}
+
+	c.peerAddrs.mu.Lock()
+	defer c.peerAddrs.mu.Unlock()
+	if p, ok := c.peerAddrs.pending[peerID]; ok {
+		p.latest = addrs
+		return nil
+	}
+	if sameAddrs(before, addrs) {
+		fmt.Println("Peer addresses unchanged, not publishing an update for", peerID)
+		return nil
+	}
+
+	if c.peerAddrs.pending == nil {
+		c.peerAddrs.pending = map[string]*pendingPeerAddr{}
+	}
+	c.peerAddrs.pending[peerID] = &pendingPeerAddr{published: before, latest: addrs}
+	time.AfterFunc(peerAddrCoalesceDelay, func() { c.flushPeerAddrs(peerID) })
+	return nil
+}
+
+// flushPeerAddrs publishes the latest addresses collected for a peer, unless
+// they ended up where they started
+func (c *Core) flushPeerAddrs(peerID string) {
+	c.peerAddrs.mu.Lock()
+	p, ok := c.peerAddrs.pending[peerID]
+	delete(c.peerAddrs.pending, peerID)
+	c.peerAddrs.mu.Unlock()
+
+	if !ok || sameAddrs(p.published, p.latest) {
+		return
+	}
+	if _, stillBound := c.db.GetPeerAddresses(peerID); !stillBound {
+		return
+	}
+	if err := c.PublishPeerUpdate("ADD", peerID, p.latest); err != nil {
+		fmt.Println("Warning: Failed to publish peer update:", err)
+	}
+}
+
+// flushAllPeerAddrs publishes every pending address change now, for
+// processes that exit before the coalescing window ends
+func (c *Core) flushAllPeerAddrs() {
+	c.peerAddrs.mu.Lock()
+	var peerIDs []string
+	for peerID := range c.peerAddrs.pending {
+		peerIDs = append(peerIDs, peerID)
+	}
+	c.peerAddrs.mu.Unlock()
+
+	for _, peerID := range peerIDs {
+		c.flushPeerAddrs(peerID)
+	}
+}
+
+// Peer table changes go through these helpers so the p2p layer's allow-list,
+// gossip filter and connection manager learn about them as soon as the
+// database does
+
+// addPeer stores a new vault peer and admits it on the p2p layer
+func (c *Core) addPeer(info peer.AddrInfo) error {
+	c.peerTable.Lock()
+	defer c.peerTable.Unlock()
+	if err := c.db.AddPeer(info); err != nil {
+		return err
+	}
+	if c.p2pNode != nil {
+		c.p2pNode.AddPeer(info)
+	}
+	return nil
+}
+
+// updatePeerAddrs replaces the addresses of a known peer
+func (c *Core) updatePeerAddrs(info peer.AddrInfo) error {
+	c.peerTable.Lock()
+	defer c.peerTable.Unlock()
+	if err := c.db.UpdatePeerAddresses(info.ID.String(), addrStrings(info.Addrs)); err != nil {
+		return err
+	}
+	if c.p2pNode != nil {
+		c.p2pNode.SetPeerAddrs(info)
+	}
+	return nil
+}
+
+// removePeer deletes a vault peer and disconnects it
+func (c *Core) removePeer(peerID string) error {
+	c.peerTable.Lock()
+	defer c.peerTable.Unlock()
+	if err := c.db.RemovePeer(peerID); err != nil {
+		return err
+	}
+	if id, err := peer.Decode(peerID); err == nil && c.p2pNode != nil {
+		c.p2pNode.RemovePeer(id)
+	}
+	return nil
+}
+
+// mergePeers brings the peer table in line with a full peer list, adding,
+// updating and disconnecting only the peers that differ. It returns the
+// peers whose addresses are new to this node.
+func (c *Core) mergePeers(peers []database.DBPeer) ([]peer.AddrInfo, error) {
+	c.peerTable.Lock()
+	defer c.peerTable.Unlock()
+	diff, err := c.db.MergePeers(peers)
+	if err != nil {
+		return nil, err
+	}
+
+	var updated []peer.AddrInfo
+	for _, info := range c.db.GetPeers() {
+		id := info.ID.String()
+		if slices.Contains(diff.Added, id) || slices.Contains(diff.Changed, id) {
+			updated = append(updated, info)
+		}
+	}
+	if c.p2pNode != nil {
+		for _, info := range updated {
+			c.p2pNode.AddPeer(info)
+		}
+		for _, peerID := range diff.Removed {
+			if id, err := peer.Decode(peerID); err == nil {
+				c.p2pNode.RemovePeer(id)
+			}
+		}
+	}
+	return updated, nil
+}
+
+// RemovePeer removes a peer from this node's peer list and disconnects it.
+// Its record is kept, so it is restored if it binds again, see RestorePeer.
+func (c *Core) RemovePeer(peerID string) error {
+	before := c.db.GetAllPeerIDs()
+	if err := c.retirePeer(peerID, false); err != nil {
+		return err
+	}
+	c.emitPeerListChange(before, c.db.GetAllPeerIDs())
+	return nil
+}
@@ -0,0 +1,108 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/notassigned/endershare/internal/database"
+	"github.com/notassigned/endershare/internal/storage"
+)
+
+// checkPinnable refuses pins on nodes that keep every file or none
+func (c *Core) checkPinnable() error {
+	if c.storage == nil {
+		return fmt.Errorf("this node does not store file contents")
+	}
+	if c.IsMaster() {
+		return fmt.Errorf("the master node keeps the content of every file")
+	}
+	return nil
+}
+
+// PinFile pins or unpins a file on this node. A pinned file's content is
+// downloaded and kept, whatever the selective sync, the replication policy
+// or the on-demand setting say. Pins are not replicated.
+func (c *Core) PinFile(name string, folderID storage.FolderID, pinned bool) error {
+	if err := c.checkPinnable(); err != nil {
+		return err
+	}
+	if err := c.storage.SetFilePinned(name, folderID, pinned); err != nil {
+		return err
+	}
+	c.emit(Event{Type: EventPinsChanged})
+	return nil
+}
+
+// PinFolder pins or unpins a folder, with everything below it, on this node
+func (c *Core) PinFolder(folderID storage.FolderID, pinned bool) error {
+	if err := c.checkPinnable(); err != nil {
+		return err
+	}
+	if err := c.storage.SetFolderPinned(folderID, pinned); err != nil {
+		return err
+	}
+	c.emit(Event{Type: EventPinsChanged})
+	return nil
+}
+
+// PinMain (CLI only) lists the pins of this node, or pins or unpins the
+// files and folders at the given vault paths. A running node fetches newly
+// pinned files at its next check.
+func PinMain(args []string, pinned bool) {
+	db := database.Create()
+	keys := db.GetKeys()
+	if keys == nil || keys.AESKey == nil {
+		exitWithError(fmt.Errorf("this node does not store file contents"))
+	}
+	if keys.MasterPrivateKey != nil {
+		exitWithError(fmt.Errorf("the master node keeps the content of every file"))
+	}
+	stor := storage.NewStorage(db, keys.AESKey)
+
+	if len(args) == 0 {
+		if !pinned {
+			fmt.Println("Usage: endershare unpin <path>...")
+			os.Exit(1)
+		}
+		pins := storage.LoadPins(db)
+		if pins.Empty() {
+			fmt.Println("Nothing is pinned on this node")
+			return
+		}
+		for _, id := range pins.Folders {
+			fmt.Println(folderPath(stor, id) + "/")
+		}
+		for _, f := range pins.Files {
+			fmt.Println(path.Join(folderPath(stor, f.FolderID), f.Name))
+		}
+		return
+	}
+
+	for _, p := range args {
+		if err := pinPath(stor, p, pinned); err != nil {
+			exitWithError(err)
+		}
+		if pinned {
+			fmt.Println("Pinned", p)
+		} else {
+			fmt.Println("Unpinned", p)
+		}
+	}
+}
+
+// pinPath pins or unpins the folder at a vault path, or the file if no
+// folder is there
+func pinPath(stor *storage.Storage, p string, pinned bool) error {
+	if id, err := resolveFolderPath(stor, p); err == nil && !id.IsRoot() {
+		return stor.SetFolderPinned(id, pinned)
+	} else if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+	folderID, name, err := resolveFilePath(stor, p)
+	if err != nil {
+		return err
+	}
+	return stor.SetFilePinned(name, folderID, pinned)
+}
@@ -0,0 +1,301 @@
+package core
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/notassigned/endershare/internal/storage"
+)
+
+// ReplicationPlan is the replication planner's assignment of folders to
+// devices, aiming for Target copies of every file with the master's own
+// copy included
+type ReplicationPlan struct {
+	Target   int          `json:"target"`
+	Devices  []DevicePlan `json:"devices"`
+	Problems []string     `json:"problems"` // Constraints the plan can't satisfy
+}
+
+// DevicePlan is what the planner gives one device to hold
+type DevicePlan struct {
+	PeerID     string             `json:"peerId"`
+	Everything bool               `json:"everything"` // Replicates every folder
+	Folders    []storage.FolderID `json:"folders"`    // Selected for the device otherwise
+	Bytes      int64              `json:"bytes"`      // Assigned to the device
+	Capacity   int64              `json:"capacity"`   // From its last status, see DeviceStatus.Capacity
+}
+
+// planUnit is a folder the planner assigns whole, or the files directly in
+// a folder whose subfolders are assigned separately
+type planUnit struct {
+	id       storage.FolderID
+	bytes    int64
+	copies   int
+	onDemand bool // Devices that replicate every folder leave it as placeholders
+}
+
+// PlanReplication works out which devices should hold which folders for
+// the replication target, from the storage the devices last reported. A
+// device that can hold the whole vault replicates every folder, the others
+// are given the folders with the fewest copies that fit. The files directly
+// in the root, or in a folder too large to give any of those devices whole,
+// are only held by the devices replicating everything.
+func (c *Core) PlanReplication() (ReplicationPlan, error) {
+	target := c.db.GetReplicationTarget()
+	plan := ReplicationPlan{Target: target, Devices: []DevicePlan{}, Problems: []string{}}
+	if !c.IsMaster() || c.storage == nil {
+		return plan, fmt.Errorf("%w can plan replication", ErrNotMaster)
+	}
+	usage, err := c.storage.Usage()
+	if err != nil {
+		return plan, err
+	}
+	folders := make(map[storage.FolderID]storage.FolderUsage)
+	children := make(map[storage.FolderID][]storage.FolderID)
+	for _, f := range usage.Folders {
+		folders[f.FolderID] = f
+		if !f.FolderID.IsRoot() {
+			// Largest first, as Usage sorts them
+			children[f.Parent] = append(children[f.Parent], f.FolderID)
+		}
+	}
+	total := folders[storage.RootFolderID].Bytes
+	policy := c.GetReplicationPolicy()
+	mode := func(id storage.FolderID) string {
+		m, _ := c.storage.FolderMode(id, policy)
+		return m
+	}
+
+	// The devices that haven't reported their storage keep their selection
+	statuses := c.DeviceStatuses()
+	var full, small []DevicePlan
+	for _, id := range c.GetOtherPeerIDs() {
+		s, ok := statuses[id]
+		if !ok {
+			plan.Problems = append(plan.Problems, fmt.Sprintf("%s has not reported its storage yet", id))
+			continue
+		}
+		d := DevicePlan{PeerID: id, Capacity: s.Capacity()}
+		if d.Capacity >= total {
+			d.Everything, d.Bytes = true, total
+			full = append(full, d)
+		} else {
+			small = append(small, d)
+		}
+	}
+	slices.SortFunc(small, func(a, b DevicePlan) int { return cmp.Compare(b.Capacity, a.Capacity) })
+	largest := total
+	if len(small) > 0 {
+		largest = small[0].Capacity
+	}
+
+	// Folders replicated everywhere are held by every device anyway
+	var forced int64
+	var units, loose []planUnit
+	var split func(id storage.FolderID, depth int)
+	split = func(id storage.FolderID, depth int) {
+		f := folders[id]
+		m := mode(id)
+		if m == storage.ReplicateEverywhere {
+			forced += f.Bytes
+			return
+		}
+		if !id.IsRoot() && (f.Bytes <= largest || len(children[id]) == 0 || depth > 256) {
+			if f.Bytes > 0 {
+				units = append(units, planUnit{id: id, bytes: f.Bytes, onDemand: m == storage.ReplicateOnDemand})
+			}
+			return
+		}
+		direct := f.Bytes
+		for _, child := range children[id] {
+			direct -= folders[child].Bytes
+			split(child, depth+1)
+		}
+		if direct > 0 {
+			loose = append(loose, planUnit{id: id, bytes: direct, onDemand: m == storage.ReplicateOnDemand})
+		}
+	}
+	split(storage.RootFolderID, 0)
+	for _, list := range [][]planUnit{units, loose} {
+		for i := range list {
+			list[i].copies = 1
+			if !list[i].onDemand {
+				list[i].copies += len(full)
+			}
+		}
+	}
+
+	for i := range small {
+		d := &small[i]
+		room := d.Capacity - forced
+		if room < 0 {
+			plan.Problems = append(plan.Problems, fmt.Sprintf("%s can't hold the folders replicated everywhere (%s)", d.PeerID, formatBytes(forced)))
+		}
+		d.Bytes = forced
+		assigned := make([]bool, len(units))
+		for {
+			best := -1
+			for j, u := range units {
+				if assigned[j] || u.bytes > room {
+					continue
+				}
+				if best < 0 || u.copies < units[best].copies || (u.copies == units[best].copies && u.bytes > units[best].bytes) {
+					best = j
+				}
+			}
+			if best < 0 {
+				break
+			}
+			assigned[best] = true
+			units[best].copies++
+			room -= units[best].bytes
+			d.Bytes += units[best].bytes
+			d.Folders = append(d.Folders, units[best].id)
+		}
+		if len(d.Folders) == 0 {
+			plan.Problems = append(plan.Problems, fmt.Sprintf("%s can't hold any folder whole, its selection is kept", d.PeerID))
+		}
+	}
+
+	for _, u := range units {
+		if u.copies < target {
+			plan.Problems = append(plan.Problems, fmt.Sprintf("%s (%s): %d of %d copies", folderPath(c.storage, u.id), formatBytes(u.bytes), u.copies, target))
+		}
+	}
+	for _, u := range loose {
+		if u.copies < target {
+			plan.Problems = append(plan.Problems, fmt.Sprintf("files directly in %s (%s): %d of %d copies, only devices holding the whole vault keep them", folderPath(c.storage, u.id), formatBytes(u.bytes), u.copies, target))
+		}
+	}
+	plan.Devices = append(full, small...)
+	slices.SortFunc(plan.Devices, func(a, b DevicePlan) int { return cmp.Compare(a.PeerID, b.PeerID) })
+	return plan, nil
+}
+
+// selection returns the selective sync that carries out the plan. Devices
+// the plan gives no folders keep their current selection.
+func (p ReplicationPlan) selection(current SyncSelection) SyncSelection {
+	s := SyncSelection{Devices: []DeviceSelection{}}
+	planned := make(map[string]bool)
+	for _, d := range p.Devices {
+		if d.Everything || len(d.Folders) > 0 {
+			planned[d.PeerID] = true
+		}
+		if len(d.Folders) > 0 {
+			s.Devices = append(s.Devices, DeviceSelection{PeerID: d.PeerID, Folders: d.Folders})
+		}
+	}
+	for _, d := range current.Devices {
+		if !planned[d.PeerID] {
+			s.Devices = append(s.Devices, d)
+		}
+	}
+	slices.SortFunc(s.Devices, func(a, b DeviceSelection) int { return cmp.Compare(a.PeerID, b.PeerID) })
+	return s
+}
+
+// PublishReplicationPlan plans replication and publishes the assignments as
+// the selective sync, replacing the selection of every device planned. It
+// reports whether the selection changed (master only).
+func (c *Core) PublishReplicationPlan() (ReplicationPlan, bool, error) {
+	plan, err := c.PlanReplication()
+	if err != nil {
+		return plan, false, err
+	}
+	if plan.Target == 0 {
+		return plan, false, fmt.Errorf("no replication target is set")
+	}
+	current := c.GetSyncSelection()
+	s := plan.selection(current)
+	currentJSON, _ := json.Marshal(current.Devices)
+	newJSON, _ := json.Marshal(s.Devices)
+	if bytes.Equal(currentJSON, newJSON) || (len(current.Devices) == 0 && len(s.Devices) == 0) {
+		return plan, false, nil
+	}
+	if err := saveSelection(c.db, s); err != nil {
+		return plan, false, err
+	}
+	return plan, true, c.publishControlUpdate("SELECTION", s)
+}
+
+// replanReplication publishes a new plan when a replication target is set
+// and the devices' storage changed it (master only)
+func (c *Core) replanReplication() {
+	if c.storage == nil || c.db.GetReplicationTarget() == 0 {
+		return
+	}
+	plan, changed, err := c.PublishReplicationPlan()
+	if err != nil {
+		fmt.Println("Warning: Replication planning failed:", err)
+		return
+	}
+	if changed {
+		fmt.Printf("Replication plan published for %d devices, %d problems\n", len(plan.Devices), len(plan.Problems))
+		for _, problem := range plan.Problems {
+			fmt.Println("  " + problem)
+		}
+	}
+}
+
+// PlanMain (CLI only) shows the replication plan, and with --publish
+// publishes it (master only)
+func PlanMain(args []string) {
+	publish := len(args) > 0 && args[0] == "--publish"
+	if len(args) > 1 || (len(args) == 1 && !publish) {
+		fmt.Println("Usage: endershare plan [--publish]")
+		os.Exit(1)
+	}
+	c := coreStartup(false)
+	if !c.IsMaster() {
+		exitWithError(fmt.Errorf("%w can plan replication", ErrNotMaster))
+	}
+	if c.db.GetReplicationTarget() == 0 {
+		exitWithError(fmt.Errorf("no replication target is set, see endershare config replication-target"))
+	}
+
+	var plan ReplicationPlan
+	var err error
+	changed := false
+	if publish {
+		if err := c.setupNotifyService(context.Background()); err != nil {
+			fmt.Println("Error setting up notify service:", err)
+		}
+		plan, changed, err = c.PublishReplicationPlan()
+	} else {
+		plan, err = c.PlanReplication()
+	}
+	if err != nil {
+		exitWithError(err)
+	}
+
+	fmt.Printf("Target: %d copies, the master's included\n", plan.Target)
+	for _, d := range plan.Devices {
+		held := "every folder"
+		if !d.Everything {
+			held = fmt.Sprintf("%d folders", len(d.Folders))
+		}
+		fmt.Printf("%s  %s, %s of %s\n", d.PeerID, held, formatBytes(d.Bytes), formatBytes(d.Capacity))
+		for _, id := range d.Folders {
+			fmt.Println("    " + folderPath(c.storage, id))
+		}
+	}
+	if len(plan.Problems) > 0 {
+		fmt.Println("Can't be satisfied:")
+		for _, problem := range plan.Problems {
+			fmt.Println("  " + problem)
+		}
+	}
+	switch {
+	case !publish:
+		fmt.Println("Publish it with endershare plan --publish")
+	case changed:
+		fmt.Println("Plan published")
+	default:
+		fmt.Println("The published selection already matches the plan")
+	}
+}
@@ -0,0 +1,159 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/notassigned/endershare/internal/database"
+	"github.com/notassigned/endershare/internal/storage"
+)
+
+// GetPolicy returns the vault policy in effect on this node
+func (c *Core) GetPolicy() storage.Policy {
+	return storage.LoadPolicy(c.db)
+}
+
+// PublishPolicy stores a new vault policy and broadcasts it so replicas
+// enforce the same limits (master only)
+func (c *Core) PublishPolicy(p storage.Policy) error {
+	if c.keys.MasterPrivateKey == nil {
+		return fmt.Errorf("%w can publish vault policies", ErrNotMaster)
+	}
+	if p.MaxFileSize < 0 || p.MaxVaultSize < 0 {
+		return fmt.Errorf("policy limits can't be negative")
+	}
+	blocked := []string{}
+	for _, ext := range p.BlockedExtensions {
+		if ext = storage.NormalizeExtension(ext); ext != "" && !slices.Contains(blocked, ext) {
+			blocked = append(blocked, ext)
+		}
+	}
+	slices.Sort(blocked)
+	p.BlockedExtensions = blocked
+
+	if err := storage.SavePolicy(c.db, p); err != nil {
+		return err
+	}
+	return c.publishControlUpdate("POLICY", p)
+}
+
+// applyPolicyUpdate stores the vault policy carried by a POLICY update
+func (c *Core) applyPolicyUpdate(update Update) error {
+	var p storage.Policy
+	if err := json.Unmarshal(update.UpdateData, &p); err != nil {
+		return err
+	}
+	return storage.SavePolicy(c.db, p)
+}
+
+// checkDownloadPolicy refuses to download a blob that the vault policy
+// doesn't allow on this node's disk. File names are encrypted, so replicas
+// enforce the size limits only.
+func (c *Core) checkDownloadPolicy(fileHash []byte, fileSize int64) error {
+	// A partial download already counts towards the stored bytes
+	_, _, storedBytes, _ := c.db.GetReplicationProgress()
+	storedBytes -= c.db.GetDownloadProgress(fileHash)
+	if err := c.GetPolicy().CheckSize(fileSize, storedBytes); err != nil {
+		return fmt.Errorf("%x: %w", fileHash[:8], err)
+	}
+	if err := storage.CheckQuota(c.db, fileSize-c.db.GetDownloadProgress(fileHash)); err != nil {
+		return fmt.Errorf("%x: %w", fileHash[:8], err)
+	}
+	return nil
+}
+
+// parseByteSize parses a size such as "500M" or "2GB" (binary units), or
+// "off" for no limit
+func parseByteSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if s == "OFF" {
+		return 0, nil
+	}
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "B"), "I")
+	multiplier := int64(1)
+	if n := len(s); n > 0 {
+		if i := strings.IndexByte("KMGT", s[n-1]); i >= 0 {
+			multiplier = 1 << (10 * (i + 1))
+			s = s[:n-1]
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size")
+	}
+	return n * multiplier, nil
+}
+
+func formatLimit(n int64) string {
+	if n == 0 {
+		return "none"
+	}
+	return fmt.Sprintf("%d bytes", n)
+}
+
+// PolicyMain (CLI only) shows or changes the vault policy
+// Subcommands: max-file-size <size|off>, max-vault-size <size|off>, block <ext>..., unblock <ext>...
+func PolicyMain(args []string) {
+	if len(args) == 0 {
+		p := storage.LoadPolicy(database.Create())
+		fmt.Println("Max file size:", formatLimit(p.MaxFileSize))
+		fmt.Println("Max vault size:", formatLimit(p.MaxVaultSize))
+		if len(p.BlockedExtensions) == 0 {
+			fmt.Println("Blocked extensions: none")
+		} else {
+			fmt.Println("Blocked extensions:", strings.Join(p.BlockedExtensions, " "))
+		}
+		return
+	}
+	if len(args) < 2 {
+		fmt.Println("Usage: endershare policy [max-file-size <size|off> | max-vault-size <size|off> | block <ext>... | unblock <ext>...]")
+		os.Exit(1)
+	}
+
+	c := coreStartup(true)
+	if c.keys.MasterPrivateKey == nil {
+		fmt.Println("Error: Only master nodes can change the vault policy")
+		os.Exit(1)
+	}
+	p := c.GetPolicy()
+
+	switch args[0] {
+	case "max-file-size", "max-vault-size":
+		n, err := parseByteSize(args[1])
+		if err != nil {
+			fmt.Println("Error: expected a size such as 500M or 2G, or off")
+			os.Exit(1)
+		}
+		if args[0] == "max-file-size" {
+			p.MaxFileSize = n
+		} else {
+			p.MaxVaultSize = n
+		}
+
+	case "block":
+		p.BlockedExtensions = append(p.BlockedExtensions, args[1:]...)
+
+	case "unblock":
+		p.BlockedExtensions = slices.DeleteFunc(p.BlockedExtensions, func(ext string) bool {
+			return slices.ContainsFunc(args[1:], func(arg string) bool { return storage.NormalizeExtension(arg) == ext })
+		})
+
+	default:
+		fmt.Println("Unknown policy setting:", args[0])
+		os.Exit(1)
+	}
+
+	if err := c.setupNotifyService(context.Background()); err != nil {
+		fmt.Println("Error setting up notify service:", err)
+	}
+	if err := c.PublishPolicy(p); err != nil {
+		fmt.Println("Error publishing policy:", err)
+		os.Exit(1)
+	}
+	fmt.Println("Vault policy published")
+}
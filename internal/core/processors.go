@@ -0,0 +1,49 @@
+package core
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/notassigned/endershare/internal/database"
+	"github.com/notassigned/endershare/internal/storage"
+)
+
+// startContentProcessors runs the registered content processors on files as
+// they are added or finish downloading, and drops their results once no
+// entry refers to the blob anymore
+func (c *Core) startContentProcessors(ctx context.Context) {
+	if len(storage.Processors()) == 0 {
+		return
+	}
+
+	cancel := c.Subscribe(func(e Event) {
+		switch e.Type {
+		case EventEntryAdded:
+			c.processEntry(ctx, *e.Entry)
+		case EventDownloadFinished:
+			for _, entry := range c.db.GetDataByValue(e.FileHash) {
+				c.processEntry(ctx, entry)
+			}
+		case EventEntryRemoved:
+			if err := c.db.DeleteUnreferencedContentMetadata(); err != nil {
+				fmt.Println("Warning: Failed to remove content metadata:", err)
+			}
+		}
+	}, EventEntryAdded, EventDownloadFinished, EventEntryRemoved)
+
+	go func() {
+		<-ctx.Done()
+		cancel()
+	}()
+}
+
+// processEntry runs the content processors on a file whose blob is stored
+// locally; folders and blobs still downloading are skipped
+func (c *Core) processEntry(ctx context.Context, entry database.DataEntry) {
+	if c.storage == nil || entry.Value == nil || c.db.GetDownloadProgress(entry.Value) < entry.Size {
+		return
+	}
+	if err := c.storage.RunProcessors(ctx, entry); err != nil {
+		fmt.Println("Warning: Failed to run content processors:", err)
+	}
+}
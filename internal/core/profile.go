@@ -0,0 +1,87 @@
+package core
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/notassigned/endershare/internal/database"
+	"github.com/notassigned/endershare/internal/storage"
+)
+
+// resourceLimits are the sync and transfer sizes of a resource profile
+type resourceLimits struct {
+	// A sync round asks a peer for the data hashes of syncBatchBuckets
+	// buckets and the metadata of syncBatchEntries entries at a time,
+	// storing each batch before fetching the next so memory use doesn't
+	// grow with the vault
+	syncBatchBuckets int
+	syncBatchEntries int
+	// Downloaded bytes held before they are written out
+	writeBuffer int
+	// Bytes read from or written to a file stream at a time
+	streamChunk int
+	// File streams served at once, 0 for no limit
+	maxUploads int
+}
+
+var (
+	standardLimits = resourceLimits{
+		syncBatchBuckets: 256,
+		syncBatchEntries: 256,
+		writeBuffer:      20 << 20,
+		streamChunk:      FILE_STREAM_CHUNK_SIZE,
+	}
+	lowResourceLimits = resourceLimits{
+		syncBatchBuckets: 64,
+		syncBatchEntries: 64,
+		writeBuffer:      2 << 20,
+		streamChunk:      16 << 10,
+		maxUploads:       2,
+	}
+)
+
+// limits returns the limits of this node's resource profile
+func (c *Core) limits() resourceLimits {
+	if storage.LowResource(c.db) {
+		return lowResourceLimits
+	}
+	return standardLimits
+}
+
+// acquireUpload waits up to timeout for a free slot to serve a file stream
+// from and returns its release function, or false if none became free. Only
+// low-resource nodes limit the slots.
+func (c *Core) acquireUpload(timeout time.Duration) (release func(), ok bool) {
+	maxUploads := c.limits().maxUploads
+	if maxUploads == 0 {
+		return func() {}, true
+	}
+	c.uploadsOnce.Do(func() {
+		c.uploads = make(chan struct{}, maxUploads)
+	})
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case c.uploads <- struct{}{}:
+		return func() { <-c.uploads }, true
+	case <-timer.C:
+		return nil, false
+	}
+}
+
+// describeProfile names the resource profile in effect and, when it was
+// picked automatically, why
+func describeProfile(db *database.EndershareDB) string {
+	name := storage.ProfileStandard
+	if storage.LowResource(db) {
+		name = storage.ProfileLowResource
+	}
+	if db.GetResourceProfile() != "" {
+		return name
+	}
+	if mem := storage.TotalMemory(); mem > 0 {
+		return fmt.Sprintf("%s (auto, %d MiB of memory)", name, mem>>20)
+	}
+	return name + " (auto, memory unknown)"
+}
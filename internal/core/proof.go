@@ -0,0 +1,216 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/notassigned/endershare/internal/database"
+	"lukechampine.com/blake3"
+)
+
+const (
+	// storageProofProtocolID answers storage challenges for locally held blobs
+	storageProofProtocolID = "/endershare/storage-proof/1.0"
+
+	storageChallengeInterval = 30 * time.Minute
+	challengesPerPeer        = 3
+	challengeSegmentSize     = 64 * 1024
+	maxChallengeSegment      = 1 << 20
+	challengeTimeout         = 30 * time.Second
+)
+
+// StorageChallenge asks a peer to prove it holds a blob by hashing a segment of it
+type StorageChallenge struct {
+	FileHash []byte `json:"file_hash"`
+	Offset   int64  `json:"offset"`
+	Length   int64  `json:"length"`
+	Nonce    []byte `json:"nonce"` // Keys the hash so proofs can't be precomputed
+}
+
+// StorageProof answers a StorageChallenge
+type StorageProof struct {
+	Proof []byte `json:"proof,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// segmentProof hashes length bytes of r at offset, keyed by the challenge nonce
+func segmentProof(r io.ReaderAt, ch StorageChallenge) ([]byte, error) {
+	if len(ch.Nonce) != 32 {
+		return nil, fmt.Errorf("invalid challenge nonce")
+	}
+	if ch.Offset < 0 || ch.Length <= 0 || ch.Length > maxChallengeSegment {
+		return nil, fmt.Errorf("invalid challenge segment")
+	}
+	hasher := blake3.New(32, ch.Nonce)
+	binary.Write(hasher, binary.BigEndian, ch.Offset)
+	binary.Write(hasher, binary.BigEndian, ch.Length)
+	n, err := io.Copy(hasher, io.NewSectionReader(r, ch.Offset, ch.Length))
+	if err != nil {
+		return nil, err
+	}
+	if n != ch.Length {
+		return nil, fmt.Errorf("blob is shorter than the challenged segment")
+	}
+	return hasher.Sum(nil), nil
+}
+
+// proveStorage computes the proof for a challenge from the local blob
+func (c *Core) proveStorage(ch StorageChallenge) ([]byte, error) {
+	if c.storage == nil {
+		return nil, fmt.Errorf("no blobs stored on this node")
+	}
+	file, _, err := c.storage.OpenFileForReading(ch.FileHash)
+	if err != nil {
+		return nil, fmt.Errorf("blob not held")
+	}
+	defer file.Close()
+	return segmentProof(file, ch)
+}
+
+// handleStorageChallenge answers a storage challenge for a locally held blob
+func (c *Core) handleStorageChallenge(s network.Stream) {
+	defer s.Close()
+
+	var ch StorageChallenge
+	if err := json.NewDecoder(io.LimitReader(s, maxRequestSize)).Decode(&ch); err != nil {
+		c.logStreamError(s, "decode request", err)
+		return
+	}
+	proof, err := c.proveStorage(ch)
+	if err != nil {
+		c.logStreamError(s, "prove storage", err)
+		json.NewEncoder(s).Encode(StorageProof{Error: err.Error()})
+		return
+	}
+	json.NewEncoder(s).Encode(StorageProof{Proof: proof})
+}
+
+// ChallengePeer checks that a peer still holds a blob by comparing its proof
+// for a random segment with one computed from the local copy
+func (c *Core) ChallengePeer(to peer.ID, fileHash []byte, size int64) error {
+	ch := StorageChallenge{FileHash: fileHash, Length: min(size, challengeSegmentSize), Nonce: make([]byte, 32)}
+	if ch.Length <= 0 {
+		return nil
+	}
+	if _, err := rand.Read(ch.Nonce); err != nil {
+		return err
+	}
+	var offset [8]byte
+	if _, err := rand.Read(offset[:]); err != nil {
+		return err
+	}
+	if span := size - ch.Length; span > 0 {
+		ch.Offset = int64(binary.BigEndian.Uint64(offset[:]) % uint64(span+1))
+	}
+
+	expected, err := c.proveStorage(ch)
+	if err != nil {
+		return fmt.Errorf("cannot check %x locally: %w", fileHash[:8], err)
+	}
+
+	stream, err := c.p2pNode.NewStreamToPeer(to, storageProofProtocolID)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+	stream.SetDeadline(time.Now().Add(challengeTimeout))
+
+	if err := json.NewEncoder(stream).Encode(ch); err != nil {
+		return err
+	}
+	var resp StorageProof
+	if err := json.NewDecoder(stream).Decode(&resp); err != nil {
+		return err
+	}
+
+	result := database.DBStorageProof{
+		PeerID:    to.String(),
+		FileHash:  fileHash,
+		Passed:    resp.Error == "" && bytes.Equal(resp.Proof, expected),
+		Error:     resp.Error,
+		Timestamp: time.Now().Unix(),
+	}
+	if !result.Passed && result.Error == "" {
+		result.Error = "proof does not match"
+	}
+	if err := c.db.SetStorageProof(result); err != nil {
+		return err
+	}
+	if !result.Passed {
+		fmt.Printf("Warning: Peer %s failed storage challenge for %x: %s\n", to, fileHash[:8], result.Error)
+	}
+	return nil
+}
+
+// challengeRound challenges every online peer for a few random blobs it
+// acknowledged with a receipt (master only)
+func (c *Core) challengeRound() {
+	sizes := map[string]int64{}
+	err := c.db.ForEachData(func(e database.DataEntry) error {
+		if e.Value != nil && c.db.GetDownloadProgress(e.Value) >= e.Size {
+			sizes[string(e.Value)] = e.Size
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	for _, id := range c.GetOtherPeerIDs() {
+		if online, _ := c.GetPeerStatus(id); !online {
+			continue
+		}
+		pid, err := peer.Decode(id)
+		if err != nil {
+			continue
+		}
+		var held [][]byte
+		for _, hash := range c.db.GetReceivedFileHashes(id) {
+			if _, ok := sizes[string(hash)]; ok {
+				held = append(held, hash)
+			}
+		}
+		for _, hash := range pickRandom(held, challengesPerPeer) {
+			if err := c.ChallengePeer(pid, hash, sizes[string(hash)]); err != nil {
+				fmt.Printf("Warning: Storage challenge to %s failed: %v\n", id, err)
+				break
+			}
+		}
+	}
+}
+
+// pickRandom returns up to n distinct random elements of items
+func pickRandom(items [][]byte, n int) [][]byte {
+	picked := make([][]byte, len(items))
+	copy(picked, items)
+	for i := len(picked) - 1; i > 0; i-- {
+		var b [8]byte
+		rand.Read(b[:])
+		j := int(binary.BigEndian.Uint64(b[:]) % uint64(i+1))
+		picked[i], picked[j] = picked[j], picked[i]
+	}
+	if len(picked) > n {
+		picked = picked[:n]
+	}
+	return picked
+}
+
+// runStorageChallenges challenges peers periodically (master only)
+func (c *Core) runStorageChallenges(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(c.jittered(storageChallengeInterval)):
+		}
+		c.challengeRound()
+	}
+}
@@ -0,0 +1,105 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/notassigned/endershare/internal/database"
+)
+
+// gossipProtocol names the notify topic in the protocol error log
+const gossipProtocol = "gossip"
+
+// doctorErrorLimit is how many logged errors endershare doctor --errors shows
+const doctorErrorLimit = 100
+
+// ProtocolError is a failed exchange with a peer, kept for debugging sync
+type ProtocolError struct {
+	PeerID    string    `json:"peer_id"`
+	Protocol  string    `json:"protocol"`
+	Phase     string    `json:"phase"`
+	Error     string    `json:"error"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// logStreamError records a failed exchange on a stream a peer opened or this
+// node opened to a peer
+func (c *Core) logStreamError(s network.Stream, phase string, err error) {
+	c.logPeerError(s.Conn().RemotePeer(), string(s.Protocol()), phase, err)
+}
+
+// logPeerError records a failed exchange with a peer in the protocol error log
+func (c *Core) logPeerError(from peer.ID, protocol, phase string, err error) {
+	if err := c.db.RecordProtocolError(from.String(), protocol, phase, err.Error()); err != nil {
+		fmt.Println("Warning: Failed to record protocol error:", err)
+	}
+}
+
+// ProtocolErrors returns up to limit logged protocol errors, newest first,
+// of one peer or of every peer if peerID is empty
+func (c *Core) ProtocolErrors(peerID string, limit int) []ProtocolError {
+	return protocolErrors(c.db, peerID, limit)
+}
+
+// ClearProtocolErrors empties the protocol error log
+func (c *Core) ClearProtocolErrors() error {
+	return c.db.ClearProtocolErrors()
+}
+
+func protocolErrors(db *database.EndershareDB, peerID string, limit int) []ProtocolError {
+	entries := db.GetProtocolErrors(peerID, limit)
+	list := make([]ProtocolError, 0, len(entries))
+	for _, e := range entries {
+		list = append(list, ProtocolError{
+			PeerID:    e.PeerID,
+			Protocol:  e.Protocol,
+			Phase:     e.Phase,
+			Error:     e.Error,
+			Timestamp: e.Timestamp,
+		})
+	}
+	return list
+}
+
+// DoctorMain (CLI only) shows diagnostics for debugging sync failures
+func DoctorMain(args []string) {
+	if len(args) == 0 || (args[0] != "--errors" && args[0] != "--clear-errors") {
+		fmt.Println("Usage: endershare doctor --errors [peer-id]")
+		fmt.Println("       endershare doctor --clear-errors")
+		os.Exit(1)
+	}
+	db := database.Create()
+
+	if args[0] == "--clear-errors" {
+		if err := db.ClearProtocolErrors(); err != nil {
+			exitWithError(err)
+		}
+		if jsonOutput {
+			printJSON(map[string]bool{"cleared": true})
+			return
+		}
+		fmt.Println("Cleared the protocol error log")
+		return
+	}
+
+	peerID := ""
+	if len(args) > 1 {
+		peerID = args[1]
+	}
+	list := protocolErrors(db, peerID, doctorErrorLimit)
+	if jsonOutput {
+		printJSON(protocolErrorsJSON{Errors: list})
+		return
+	}
+	if len(list) == 0 {
+		fmt.Println("No protocol errors logged")
+		return
+	}
+	for _, e := range list {
+		fmt.Printf("%s %s %s\n", e.Timestamp.Format(time.RFC3339), e.PeerID, e.Protocol)
+		fmt.Printf("    %s: %s\n", e.Phase, e.Error)
+	}
+}
@@ -0,0 +1,110 @@
+package core
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/notassigned/endershare/internal/database"
+)
+
+// Kinds of quarantined entries
+const (
+	QuarantineMetadata = "metadata" // Metadata didn't match its entry hash
+	QuarantineBlob     = "blob"     // Downloaded blob didn't match its hash
+)
+
+// A quarantined entry is retried from the same peer after a backoff that
+// doubles with every failure, so a bad peer isn't asked again every round
+const (
+	quarantineBaseBackoff = 10 * time.Minute
+	quarantineMaxBackoff  = 24 * time.Hour
+)
+
+// ErrQuarantined is returned when an entry is not fetched from a peer because
+// it failed verification from that peer recently
+var ErrQuarantined = errors.New("entry is quarantined")
+
+func quarantineBackoff(failures int) time.Duration {
+	backoff := quarantineBaseBackoff
+	for i := 1; i < failures && backoff < quarantineMaxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, quarantineMaxBackoff)
+}
+
+// isQuarantined reports whether an entry from a peer is still backing off
+func (c *Core) isQuarantined(entryHash []byte, from peer.ID, kind string) bool {
+	e := c.db.GetQuarantineEntry(entryHash, from.String(), kind)
+	return e != nil && time.Since(e.LastSeen) < quarantineBackoff(e.Failures)
+}
+
+// quarantine records a verification failure of an entry fetched from a peer
+func (c *Core) quarantine(entryHash []byte, from peer.ID, kind, reason string) {
+	fmt.Printf("Warning: quarantined %s %x from %s: %s\n", kind, entryHash[:min(8, len(entryHash))], from, reason)
+	if err := c.db.RecordQuarantine(entryHash, from.String(), kind, reason); err != nil {
+		fmt.Println("Warning: Failed to record quarantine:", err)
+	}
+}
+
+// filterQuarantined drops the entry hashes whose metadata is quarantined for a peer
+func (c *Core) filterQuarantined(hashes [][]byte, from peer.ID) [][]byte {
+	kept := hashes[:0:0]
+	for _, hash := range hashes {
+		if !c.isQuarantined(hash, from, QuarantineMetadata) {
+			kept = append(kept, hash)
+		}
+	}
+	if skipped := len(hashes) - len(kept); skipped > 0 {
+		fmt.Printf("Skipping %d quarantined entries from %s\n", skipped, from)
+	}
+	return kept
+}
+
+// QuarantineMain (CLI only) lists quarantined entries or releases them
+func QuarantineMain(args []string) {
+	db := database.Create()
+
+	if len(args) == 0 {
+		entries := db.GetQuarantine()
+		if len(entries) == 0 {
+			fmt.Println("No quarantined entries")
+			return
+		}
+		for _, e := range entries {
+			retry := e.LastSeen.Add(quarantineBackoff(e.Failures))
+			fmt.Printf("%s %x from %s\n", e.Kind, e.EntryHash, e.PeerID)
+			fmt.Printf("    %s (%d failures, last %s, retry after %s)\n", e.Reason, e.Failures,
+				e.LastSeen.Format(time.RFC3339), retry.Format(time.RFC3339))
+		}
+		return
+	}
+
+	if args[0] != "clear" {
+		fmt.Println("Usage: endershare quarantine [clear [hash]]")
+		os.Exit(1)
+	}
+	if len(args) < 2 {
+		if err := db.ClearAllQuarantine(); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		fmt.Println("Released all quarantined entries")
+		return
+	}
+	hash, err := hex.DecodeString(args[1])
+	if err != nil {
+		fmt.Println("Error: invalid hash:", args[1])
+		os.Exit(1)
+	}
+	for _, kind := range []string{QuarantineMetadata, QuarantineBlob} {
+		if err := db.ClearQuarantine(hash, kind); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+	}
+	fmt.Println("Released", args[1])
+}
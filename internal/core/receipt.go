@@ -0,0 +1,373 @@
+package core
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/notassigned/endershare/internal/database"
+	"lukechampine.com/blake3"
+)
+
+const (
+	// receiptProtocolID delivers a receipt to the peer that served the file
+	receiptProtocolID = "/endershare/receipt/1.0"
+	// receiptListProtocolID lets the master collect the receipts a peer issued
+	receiptListProtocolID = "/endershare/receipt-list/1.0"
+	receiptDomainTag      = "endershare/transfer-receipt"
+
+	receiptCollectInterval = 10 * time.Minute
+	receiptListLimit       = 1000
+)
+
+// TransferReceipt states that Receiver downloaded a file from Server and
+// whether the blob matched its hash
+type TransferReceipt struct {
+	FileHash   []byte `json:"file_hash"`
+	Bytes      int64  `json:"bytes"`
+	DurationMs int64  `json:"duration_ms"`
+	Server     string `json:"server"`
+	Receiver   string `json:"receiver"`
+	Verified   bool   `json:"verified"`
+	Timestamp  int64  `json:"timestamp"`
+}
+
+// SignedReceipt is a TransferReceipt signed with the receiver's peer key
+type SignedReceipt struct {
+	ReceiptBytes []byte `json:"receipt_bytes"` // JSON bytes of the receipt
+	Signature    []byte `json:"signature"`     // Covers TransferReceipt.CanonicalBytes
+}
+
+// ReceiptListRequest asks a peer for the receipts it issued after Since
+type ReceiptListRequest struct {
+	Since int64 `json:"since"`
+}
+
+// CanonicalBytes returns the deterministic encoding covered by the receiver signature
+func (r TransferReceipt) CanonicalBytes() []byte {
+	e := &canonicalEncoder{}
+	e.writeString(receiptDomainTag)
+	e.writeBytes(r.FileHash)
+	e.writeInt64(r.Bytes)
+	e.writeInt64(r.DurationMs)
+	e.writeString(r.Server)
+	e.writeString(r.Receiver)
+	e.writeBool(r.Verified)
+	e.writeInt64(r.Timestamp)
+	return e.Bytes()
+}
+
+// VerifyReceipt checks that a receipt was signed by the peer it names as receiver
+func VerifyReceipt(signed SignedReceipt) (*TransferReceipt, error) {
+	var r TransferReceipt
+	if err := json.Unmarshal(signed.ReceiptBytes, &r); err != nil {
+		return nil, fmt.Errorf("invalid receipt: %w", err)
+	}
+	receiver, err := peer.Decode(r.Receiver)
+	if err != nil {
+		return nil, fmt.Errorf("invalid receipt receiver: %w", err)
+	}
+	pub, err := receiver.ExtractPublicKey()
+	if err != nil {
+		return nil, err
+	}
+	ok, err := pub.Verify(r.CanonicalBytes(), signed.Signature)
+	if err != nil || !ok {
+		return nil, fmt.Errorf("receipt signature is invalid")
+	}
+	return &r, nil
+}
+
+// issueReceipt signs a receipt for a finished download, keeps it for the
+// master to collect and delivers it to the serving peer
+func (c *Core) issueReceipt(server peer.ID, fileHash []byte, size int64, started time.Time, verified bool) {
+	r := TransferReceipt{
+		FileHash:   fileHash,
+		Bytes:      size,
+		DurationMs: time.Since(started).Milliseconds(),
+		Server:     server.String(),
+		Receiver:   c.p2pNode.GetPeerId().String(),
+		Verified:   verified,
+		Timestamp:  time.Now().Unix(),
+	}
+	receiptBytes, err := json.Marshal(r)
+	if err != nil {
+		return
+	}
+	signed := SignedReceipt{
+		ReceiptBytes: receiptBytes,
+		Signature:    ed25519.Sign(c.keys.PeerPrivateKey, r.CanonicalBytes()),
+	}
+	if err := c.storeReceipt(signed, &r); err != nil {
+		fmt.Println("Warning: Failed to store transfer receipt:", err)
+	}
+
+	go func() {
+		stream, err := c.p2pNode.NewStreamToPeer(server, receiptProtocolID)
+		if err != nil {
+			return
+		}
+		defer stream.Close()
+		json.NewEncoder(stream).Encode(signed)
+	}()
+}
+
+func (c *Core) storeReceipt(signed SignedReceipt, r *TransferReceipt) error {
+	signedJSON, err := json.Marshal(signed)
+	if err != nil {
+		return err
+	}
+	id := blake3.Sum256(signed.Signature)
+	return c.db.AddReceipt(database.DBReceipt{
+		ReceiptID:  id[:],
+		FileHash:   r.FileHash,
+		Server:     r.Server,
+		Receiver:   r.Receiver,
+		Bytes:      r.Bytes,
+		DurationMs: r.DurationMs,
+		Verified:   r.Verified,
+		Timestamp:  r.Timestamp,
+		SignedJSON: string(signedJSON),
+	})
+}
+
+// handleReceipt accepts a receipt for a file this node served
+func (c *Core) handleReceipt(s network.Stream) {
+	defer s.Close()
+
+	var signed SignedReceipt
+	if err := json.NewDecoder(io.LimitReader(s, maxRequestSize)).Decode(&signed); err != nil {
+		c.logStreamError(s, "decode request", err)
+		return
+	}
+	r, err := VerifyReceipt(signed)
+	if err != nil {
+		fmt.Printf("Rejected receipt from %s: %v\n", s.Conn().RemotePeer(), err)
+		c.logStreamError(s, "verify receipt", err)
+		return
+	}
+	if r.Receiver != s.Conn().RemotePeer().String() || r.Server != c.GetNodeID() {
+		fmt.Printf("Rejected receipt from %s: not a transfer between us\n", s.Conn().RemotePeer())
+		return
+	}
+	if err := c.storeReceipt(signed, r); err != nil {
+		fmt.Println("Warning: Failed to store transfer receipt:", err)
+	}
+}
+
+// handleReceiptListRequest returns the receipts this node issued
+func (c *Core) handleReceiptListRequest(s network.Stream) {
+	defer s.Close()
+
+	var req ReceiptListRequest
+	if err := json.NewDecoder(io.LimitReader(s, maxRequestSize)).Decode(&req); err != nil {
+		c.logStreamError(s, "decode request", err)
+		return
+	}
+	response := []SignedReceipt{}
+	for _, r := range c.db.GetReceiptsByReceiver(c.GetNodeID(), req.Since, receiptListLimit) {
+		var signed SignedReceipt
+		if err := json.Unmarshal([]byte(r.SignedJSON), &signed); err == nil {
+			response = append(response, signed)
+		}
+	}
+	if err := json.NewEncoder(s).Encode(response); err != nil {
+		c.logStreamError(s, "send response", err)
+	}
+}
+
+// collectReceipts fetches new receipts from every connected peer (master only)
+func (c *Core) collectReceipts() {
+	for _, id := range c.GetOtherPeerIDs() {
+		if online, _ := c.GetPeerStatus(id); !online {
+			continue
+		}
+		pid, err := peer.Decode(id)
+		if err != nil {
+			continue
+		}
+		if err := c.requestReceipts(pid); err != nil {
+			fmt.Printf("Warning: Failed to collect receipts from %s: %v\n", id, err)
+		}
+	}
+}
+
+func (c *Core) requestReceipts(from peer.ID) error {
+	stream, err := c.p2pNode.NewStreamToPeer(from, receiptListProtocolID)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	req := ReceiptListRequest{Since: c.db.GetLatestReceiptTime(from.String())}
+	if err := json.NewEncoder(stream).Encode(req); err != nil {
+		return err
+	}
+	var response []SignedReceipt
+	if err := json.NewDecoder(stream).Decode(&response); err != nil {
+		return err
+	}
+	for _, signed := range response {
+		r, err := VerifyReceipt(signed)
+		if err != nil || r.Receiver != from.String() {
+			continue
+		}
+		if err := c.storeReceipt(signed, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runReceiptCollection collects receipts from peers periodically (master only)
+func (c *Core) runReceiptCollection(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(c.jittered(receiptCollectInterval)):
+		}
+		c.collectReceipts()
+	}
+}
+
+// PeerReplication summarizes the receipts of one peer
+type PeerReplication struct {
+	PeerID       string `json:"peer_id"`
+	FilesHeld    int    `json:"files_held"` // Current files the peer has a verified receipt for
+	BytesHeld    int64  `json:"bytes_held"`
+	FilesServed  int    `json:"files_served"`
+	FailedServes int    `json:"failed_serves"` // Transfers from this peer that failed verification
+	ProofsPassed int    `json:"proofs_passed"`
+	ProofsFailed int    `json:"proofs_failed"` // Blobs the peer no longer proves it holds
+}
+
+// ReplicationView is the replication factor of the vault's files as proven
+// by receipts and storage challenges. Peers with failed serves claimed data
+// they didn't hold; peers with failed proofs lost blobs they acknowledged.
+type ReplicationView struct {
+	Files    int               `json:"files"`
+	ByCopies map[int]int       `json:"by_copies"` // Number of files held by exactly n peers
+	Peers    []PeerReplication `json:"peers"`
+}
+
+// ReplicationView aggregates the known receipts into a replication view
+func (c *Core) ReplicationView() (*ReplicationView, error) {
+	return buildReplicationView(c.db)
+}
+
+func buildReplicationView(db *database.EndershareDB) (*ReplicationView, error) {
+	files := map[string]int64{}
+	local := map[string]bool{}
+	err := db.ForEachData(func(e database.DataEntry) error {
+		if e.Value != nil {
+			files[string(e.Value)] = e.Size
+			local[string(e.Value)] = db.GetDownloadProgress(e.Value) >= e.Size
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	known := map[string]bool{}
+	for _, id := range db.GetAllPeerIDs() {
+		known[id] = true
+	}
+
+	peers := map[string]*PeerReplication{}
+	stats := func(id string) *PeerReplication {
+		if peers[id] == nil {
+			peers[id] = &PeerReplication{PeerID: id}
+		}
+		return peers[id]
+	}
+	// A failed latest challenge outweighs the receipt for that blob
+	lost := map[string]bool{}
+	for _, p := range db.GetStorageProofs() {
+		if !known[p.PeerID] {
+			continue
+		}
+		if p.Passed {
+			stats(p.PeerID).ProofsPassed++
+		} else {
+			stats(p.PeerID).ProofsFailed++
+			lost[p.PeerID+string(p.FileHash)] = true
+		}
+	}
+
+	holders := map[string]map[string]bool{}
+	for _, r := range db.GetAllReceipts() {
+		if !known[r.Server] || !known[r.Receiver] {
+			continue
+		}
+		if !r.Verified {
+			stats(r.Server).FailedServes++
+			continue
+		}
+		stats(r.Server).FilesServed++
+		size, current := files[string(r.FileHash)]
+		if !current || lost[r.Receiver+string(r.FileHash)] {
+			continue
+		}
+		if holders[string(r.FileHash)] == nil {
+			holders[string(r.FileHash)] = map[string]bool{}
+		}
+		if !holders[string(r.FileHash)][r.Receiver] {
+			holders[string(r.FileHash)][r.Receiver] = true
+			stats(r.Receiver).FilesHeld++
+			stats(r.Receiver).BytesHeld += size
+		}
+	}
+
+	view := &ReplicationView{Files: len(files), ByCopies: map[int]int{}}
+	for hash := range files {
+		copies := len(holders[hash])
+		if local[hash] {
+			copies++
+		}
+		view.ByCopies[copies]++
+	}
+	for _, p := range peers {
+		view.Peers = append(view.Peers, *p)
+	}
+	sort.Slice(view.Peers, func(i, j int) bool { return view.Peers[i].PeerID < view.Peers[j].PeerID })
+	return view, nil
+}
+
+// ReceiptsMain (CLI only) prints the replication view built from transfer receipts
+func ReceiptsMain() {
+	db := database.Create()
+	view, err := buildReplicationView(db)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Files: %d\n", view.Files)
+	copies := make([]int, 0, len(view.ByCopies))
+	for n := range view.ByCopies {
+		copies = append(copies, n)
+	}
+	sort.Ints(copies)
+	for _, n := range copies {
+		fmt.Printf("  %d copies: %d files\n", n, view.ByCopies[n])
+	}
+	for _, p := range view.Peers {
+		fmt.Printf("Peer %s: holds %d files (%d bytes), served %d", p.PeerID, p.FilesHeld, p.BytesHeld, p.FilesServed)
+		if p.FailedServes > 0 {
+			fmt.Printf(", %d failed verification", p.FailedServes)
+		}
+		if p.ProofsPassed+p.ProofsFailed > 0 {
+			fmt.Printf(", storage proofs %d/%d passed", p.ProofsPassed, p.ProofsPassed+p.ProofsFailed)
+		}
+		fmt.Println()
+	}
+}
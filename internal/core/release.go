@@ -0,0 +1,367 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/notassigned/endershare/internal/database"
+	"github.com/notassigned/endershare/internal/storage"
+	"golang.org/x/mod/semver"
+	"lukechampine.com/blake3"
+)
+
+// Version is the running endershare version, set at build time with
+// -ldflags "-X github.com/notassigned/endershare/internal/core.Version=..."
+var Version = "dev"
+
+// ReleaseManifest describes a release binary published by the master
+type ReleaseManifest struct {
+	Version   string `json:"version"`
+	GOOS      string `json:"goos"`
+	GOARCH    string `json:"goarch"`
+	FileHash  []byte `json:"file_hash"` // BLAKE3 hash of the binary
+	Size      int64  `json:"size"`
+	Notes     string `json:"notes,omitempty"`
+	Published int64  `json:"published"`
+}
+
+// fileName is the name the binary is stored under in storage.ReleaseFolderID
+func (m ReleaseManifest) fileName() string {
+	return fmt.Sprintf("endershare-%s-%s-%s", m.Version, m.GOOS, m.GOARCH)
+}
+
+// releaseVersion returns version in the form golang.org/x/mod/semver
+// compares, with a leading "v", or false if it isn't a semantic version
+func releaseVersion(version string) (string, bool) {
+	if !strings.HasPrefix(version, "v") {
+		version = "v" + version
+	}
+	return version, semver.IsValid(version)
+}
+
+// releaseNewer reports whether version is newer than the running one. Any
+// release is newer than a build without a semantic version, such as "dev".
+func releaseNewer(version string) bool {
+	v, ok := releaseVersion(version)
+	if !ok {
+		return false
+	}
+	running, _ := releaseVersion(Version)
+	return semver.Compare(v, running) > 0
+}
+
+// PublishRelease adds a release binary to the vault's release folder and
+// broadcasts its signed manifest. Only nodes on the same GOOS/GOARCH stage it.
+func (c *Core) PublishRelease(binaryPath, version, goos, goarch, notes string) (*ReleaseManifest, error) {
+	if c.keys.MasterPrivateKey == nil {
+		return nil, fmt.Errorf("%w can publish releases", ErrNotMaster)
+	}
+	if c.storage == nil {
+		return nil, fmt.Errorf("publishing releases needs the vault key")
+	}
+	if _, ok := releaseVersion(version); !ok {
+		return nil, fmt.Errorf("release version %q is not a semantic version such as 1.4.0", version)
+	}
+	if goos == "" {
+		goos = runtime.GOOS
+	}
+	if goarch == "" {
+		goarch = runtime.GOARCH
+	}
+
+	src, err := os.Open(binaryPath)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &ReleaseManifest{
+		Version:   version,
+		GOOS:      goos,
+		GOARCH:    goarch,
+		Size:      info.Size(),
+		Notes:     notes,
+		Published: time.Now().Unix(),
+	}
+	hasher := blake3.New(32, nil)
+	replaced, entry, err := c.storage.AddFileFromReader(io.TeeReader(src, hasher), manifest.fileName(), storage.ReleaseFolderID)
+	if err != nil {
+		return nil, err
+	}
+	manifest.FileHash = hasher.Sum(nil)
+
+	if replaced != nil {
+		err = c.PublishModifyUpdate(replaced, entry, nil)
+	} else {
+		err = c.PublishDataUpdate("ADD", entry.Key, entry.Value, entry.Size, entry.Hash, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := c.publishControlUpdate("RELEASE", manifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// applyReleaseUpdate stages a release announced by a verified update if this
+// node has opted in to the release channel and the release is newer than
+// this node's version and targets its platform
+func (c *Core) applyReleaseUpdate(update Update) error {
+	var manifest ReleaseManifest
+	if err := json.Unmarshal(update.UpdateData, &manifest); err != nil {
+		return fmt.Errorf("invalid release manifest: %w", err)
+	}
+
+	if !c.db.GetReleaseChannelEnabled() {
+		return nil
+	}
+	if manifest.GOOS != runtime.GOOS || manifest.GOARCH != runtime.GOARCH {
+		return nil
+	}
+	if !releaseNewer(manifest.Version) {
+		return nil
+	}
+	if c.storage == nil {
+		return fmt.Errorf("staging release %s needs the vault key", manifest.Version)
+	}
+
+	// Fetching the binary can take a while; don't hold up update processing
+	go func() {
+		if err := c.stageRelease(manifest); err != nil {
+			fmt.Println("Warning: failed to stage release:", err)
+		}
+	}()
+	return nil
+}
+
+// stageRelease verifies a release binary and records it as staged.
+// Nothing is installed until ApplyStagedRelease is called after user confirmation.
+func (c *Core) stageRelease(manifest ReleaseManifest) error {
+	if err := c.writeRelease(manifest, io.Discard); err != nil {
+		return err
+	}
+
+	manifestJSON, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	if err := c.db.SetStagedReleaseJSON(string(manifestJSON)); err != nil {
+		return err
+	}
+
+	fmt.Printf("Release %s staged for upgrade (run 'endershare release apply' to install)\n", manifest.Version)
+	if c.OnReleaseStaged != nil {
+		c.OnReleaseStaged(manifest)
+	}
+	return nil
+}
+
+// writeRelease writes the release binary from the vault to w, fetching it
+// from peers if it isn't stored yet, and checks it against the manifest
+func (c *Core) writeRelease(manifest ReleaseManifest, w io.Writer) error {
+	r, err := c.storage.OpenFileReader(manifest.fileName(), storage.ReleaseFolderID)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	hasher := blake3.New(32, nil)
+	n, err := io.Copy(io.MultiWriter(w, hasher), io.LimitReader(r, manifest.Size+1))
+	if err != nil {
+		return err
+	}
+	if n != manifest.Size {
+		return fmt.Errorf("release size mismatch: expected %d bytes, got %d", manifest.Size, n)
+	}
+	if !bytes.Equal(hasher.Sum(nil), manifest.FileHash) {
+		return fmt.Errorf("release hash verification failed")
+	}
+	return nil
+}
+
+// GetStagedRelease returns the release waiting for confirmation, or nil
+func (c *Core) GetStagedRelease() *ReleaseManifest {
+	manifestJSON, err := c.db.GetStagedReleaseJSON()
+	if err != nil || manifestJSON == "" {
+		return nil
+	}
+	var manifest ReleaseManifest
+	if err := json.Unmarshal([]byte(manifestJSON), &manifest); err != nil {
+		return nil
+	}
+	return &manifest
+}
+
+// SetReleaseChannelEnabled opts this node in or out of staging published releases
+func (c *Core) SetReleaseChannelEnabled(enabled bool) error {
+	return c.db.SetReleaseChannelEnabled(enabled)
+}
+
+// ReleaseChannelEnabled reports whether this node stages published releases
+func (c *Core) ReleaseChannelEnabled() bool {
+	return c.db.GetReleaseChannelEnabled()
+}
+
+// ApplyStagedRelease replaces the running executable with the staged release.
+// The previous binary is kept next to it with a .old suffix. A restart is
+// required for the new version to take effect.
+func (c *Core) ApplyStagedRelease() (*ReleaseManifest, error) {
+	manifest := c.GetStagedRelease()
+	if manifest == nil {
+		return nil, fmt.Errorf("no release staged")
+	}
+	if c.storage == nil {
+		return nil, fmt.Errorf("installing releases needs the vault key")
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	exe, err = filepath.EvalSymlinks(exe)
+	if err != nil {
+		return nil, err
+	}
+
+	newPath := exe + ".new"
+	oldPath := exe + ".old"
+	if err := c.installRelease(*manifest, newPath); err != nil {
+		os.Remove(newPath)
+		c.db.DeleteNodeProperty("staged_release")
+		return nil, fmt.Errorf("staged release binary is missing or corrupted: %w", err)
+	}
+
+	os.Remove(oldPath)
+	if err := os.Rename(exe, oldPath); err != nil {
+		os.Remove(newPath)
+		return nil, fmt.Errorf("failed to move current binary aside: %w", err)
+	}
+	if err := os.Rename(newPath, exe); err != nil {
+		os.Rename(oldPath, exe)
+		return nil, fmt.Errorf("failed to install new binary: %w", err)
+	}
+
+	c.db.DeleteNodeProperty("staged_release")
+	return manifest, nil
+}
+
+// installRelease writes the verified release binary to dst as an executable
+func (c *Core) installRelease(manifest ReleaseManifest, dst string) error {
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
+	if err != nil {
+		return err
+	}
+	if err := c.writeRelease(manifest, out); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// releaseCore returns a core over the database in the working directory
+// that can read release binaries from the vault, without starting a p2p node
+func releaseCore() *Core {
+	db := database.Create()
+	c := &Core{db: db, keys: db.GetKeys()}
+	if c.keys != nil && c.keys.AESKey != nil {
+		c.storage = storage.NewStorage(db, c.keys.AESKey)
+	}
+	return c
+}
+
+// ReleaseMain (CLI only) manages the release channel
+// Subcommands: publish <binary> <version> [notes], enable, disable, status, apply
+func ReleaseMain(args []string) {
+	if len(args) == 0 {
+		fmt.Println("Usage: endershare release <publish|enable|disable|status|apply>")
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "publish":
+		if len(args) < 3 {
+			fmt.Println("Usage: endershare release publish <binary> <version> [notes]")
+			os.Exit(1)
+		}
+		c := coreStartup(false)
+		if c.keys.MasterPublicKey == nil {
+			exitWithError(fmt.Errorf("this node has no vault keys, set it up as the master with 'endershare peer --init' first"))
+		}
+		if !c.IsMaster() {
+			exitWithError(fmt.Errorf("%w can publish releases", ErrNotMaster))
+		}
+		if err := c.setupNotifyService(context.Background()); err != nil {
+			fmt.Println("Error setting up notify service:", err)
+		}
+		notes := strings.Join(args[3:], " ")
+		manifest, err := c.PublishRelease(args[1], args[2], "", "", notes)
+		if err != nil {
+			fmt.Println("Error publishing release:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Published release %s for %s/%s (%d bytes)\n", manifest.Version, manifest.GOOS, manifest.GOARCH, manifest.Size)
+
+	case "enable", "disable":
+		db := database.Create()
+		if err := db.SetReleaseChannelEnabled(args[0] == "enable"); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Release channel %sd\n", args[0])
+
+	case "status":
+		c := &Core{db: database.Create()}
+		fmt.Println("Running version:", Version)
+		fmt.Println("Release channel enabled:", c.ReleaseChannelEnabled())
+		if manifest := c.GetStagedRelease(); manifest != nil {
+			fmt.Printf("Staged release: %s (%d bytes)\n", manifest.Version, manifest.Size)
+			if manifest.Notes != "" {
+				fmt.Println("Notes:", manifest.Notes)
+			}
+		} else {
+			fmt.Println("Staged release: none")
+		}
+
+	case "apply":
+		c := releaseCore()
+		manifest := c.GetStagedRelease()
+		if manifest == nil {
+			fmt.Println("No release staged")
+			return
+		}
+		fmt.Printf("Install endershare %s (currently %s)? (y/n): ", manifest.Version, Version)
+		input, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		input = strings.TrimSpace(strings.ToLower(input))
+		if input != "y" && input != "yes" {
+			fmt.Println("Upgrade cancelled")
+			return
+		}
+		if _, err := c.ApplyStagedRelease(); err != nil {
+			fmt.Println("Error applying release:", err)
+			os.Exit(1)
+		}
+		fmt.Println("Installed release", manifest.Version, "- restart endershare to use it")
+
+	default:
+		fmt.Println("Unknown release command:", args[0])
+		os.Exit(1)
+	}
+}
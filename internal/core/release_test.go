@@ -0,0 +1,27 @@
+package core
+
+import "testing"
+
+func TestReleaseNewer(t *testing.T) {
+	running := Version
+	t.Cleanup(func() { Version = running })
+
+	for _, tc := range []struct {
+		running, release string
+		want             bool
+	}{
+		{"1.2.0", "1.2.1", true},
+		{"1.2.0", "v1.10.0", true},
+		{"1.2.0", "1.2.0", false},
+		{"1.10.0", "1.9.9", false},
+		{"1.2.0", "1.2.0-rc.1", false},
+		{"1.2.0-rc.1", "1.2.0", true},
+		{"dev", "0.1.0", true},
+		{"1.2.0", "latest", false},
+	} {
+		Version = tc.running
+		if got := releaseNewer(tc.release); got != tc.want {
+			t.Errorf("release %s on %s newer = %v, want %v", tc.release, tc.running, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,486 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/notassigned/endershare/internal/crypto"
+	"github.com/notassigned/endershare/internal/database"
+	"github.com/notassigned/endershare/internal/storage"
+)
+
+// Verification reports. The master periodically sums up the vault size, what
+// each device holds and has proven to hold, its own integrity scrubs and the
+// errors seen since the previous report, signs the summary with the master
+// key and adds it to the vault as a file, so every device keeps a copy
+// replicated like any other file. With report-alerts on, the summary is also
+// sent through the alert channels.
+
+const (
+	reportVersion   = 1
+	reportDomainTag = "endershare/verification-report"
+
+	defaultReportInterval = 7 * 24 * time.Hour
+	// reportCheckInterval is how often the master looks whether a report is due
+	reportCheckInterval = time.Hour
+	// reportErrorLimit bounds the protocol errors read per device
+	reportErrorLimit = 1000
+
+	// ReportFolderName is the root folder reports are added to
+	ReportFolderName = "Verification reports"
+)
+
+// ReportDevice is what a verification report says about one device
+type ReportDevice struct {
+	PeerID       string `json:"peer_id"`
+	Label        string `json:"label,omitempty"`
+	Online       bool   `json:"online"`
+	LastSeen     int64  `json:"last_seen,omitempty"` // Unix time, 0 if unknown
+	FilesHeld    int    `json:"files_held"`          // Proven by verified receipts
+	BytesHeld    int64  `json:"bytes_held"`
+	ProofsPassed int    `json:"proofs_passed"`
+	ProofsFailed int    `json:"proofs_failed"`
+	FailedServes int    `json:"failed_serves"`
+	Errors       int    `json:"errors"` // Protocol errors logged since the previous report
+	LastError    string `json:"last_error,omitempty"`
+}
+
+// VerificationReport sums up the state of the vault's backups
+type VerificationReport struct {
+	Version          int    `json:"version"`
+	VaultFingerprint []byte `json:"vault_fingerprint"`
+	UpdateID         uint64 `json:"update_id"` // Latest update when the report was made
+	Generated        int64  `json:"generated"`
+	Since            int64  `json:"since"` // Previous report, 0 for the first
+
+	Vault VaultStats `json:"vault"`
+	// FilesByCopies[n] is the number of files held by exactly n devices,
+	// the master included
+	FilesByCopies []int          `json:"files_by_copies"`
+	Devices       []ReportDevice `json:"devices"`
+
+	LastScrub    int64 `json:"last_scrub,omitempty"` // Master's last integrity scrub, Unix time
+	CorruptBlobs int   `json:"corrupt_blobs"`
+	Quarantined  int   `json:"quarantined"`
+
+	Problems []string `json:"problems"` // Empty when everything checks out
+}
+
+// SignedReport is a VerificationReport signed by the master key, the
+// content of a report file in the vault
+type SignedReport struct {
+	ReportBytes []byte `json:"report_bytes"` // JSON bytes of the report
+	Signature   []byte `json:"signature"`    // Covers VerificationReport.CanonicalBytes
+}
+
+// CanonicalBytes returns the deterministic encoding covered by the master signature
+func (r VerificationReport) CanonicalBytes() []byte {
+	e := &canonicalEncoder{}
+	e.writeString(reportDomainTag)
+	e.writeUint16(uint16(r.Version))
+	e.writeBytes(r.VaultFingerprint)
+	e.writeUint64(r.UpdateID)
+	e.writeInt64(r.Generated)
+	e.writeInt64(r.Since)
+	e.writeInt64(r.Vault.FileCount)
+	e.writeInt64(r.Vault.FolderCount)
+	e.writeInt64(r.Vault.LogicalBytes)
+	e.writeInt64(r.Vault.StoredBytes)
+	e.writeUint32(uint32(len(r.FilesByCopies)))
+	for _, n := range r.FilesByCopies {
+		e.writeInt64(int64(n))
+	}
+	e.writeUint32(uint32(len(r.Devices)))
+	for _, d := range r.Devices {
+		e.writeString(d.PeerID)
+		e.writeString(d.Label)
+		e.writeBool(d.Online)
+		e.writeInt64(d.LastSeen)
+		e.writeInt64(int64(d.FilesHeld))
+		e.writeInt64(d.BytesHeld)
+		e.writeInt64(int64(d.ProofsPassed))
+		e.writeInt64(int64(d.ProofsFailed))
+		e.writeInt64(int64(d.FailedServes))
+		e.writeInt64(int64(d.Errors))
+		e.writeString(d.LastError)
+	}
+	e.writeInt64(r.LastScrub)
+	e.writeInt64(int64(r.CorruptBlobs))
+	e.writeInt64(int64(r.Quarantined))
+	e.writeStrings(r.Problems)
+	return e.Bytes()
+}
+
+// reportInterval returns the configured time between verification reports
+func reportInterval(db *database.EndershareDB) time.Duration {
+	if d := db.GetReportInterval(); d > 0 {
+		return d
+	}
+	return defaultReportInterval
+}
+
+// BuildReport gathers a verification report covering the time since the
+// previous one (master only)
+func (c *Core) BuildReport() (*VerificationReport, error) {
+	if !c.IsMaster() {
+		return nil, fmt.Errorf("%w can make verification reports", ErrNotMaster)
+	}
+	stats, err := c.computeVaultStats()
+	if err != nil {
+		return nil, err
+	}
+	view, err := c.ReplicationView()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	since := c.db.GetLastReport()
+	updateID, _ := c.db.GetCurrentUpdateID()
+	status := c.Status()
+	r := &VerificationReport{
+		Version:          reportVersion,
+		VaultFingerprint: crypto.VaultFingerprint(c.keys.MasterPublicKey),
+		UpdateID:         updateID,
+		Generated:        now.Unix(),
+		Vault:            stats,
+		FilesByCopies:    []int{},
+		Devices:          []ReportDevice{},
+		CorruptBlobs:     status.CorruptBlobs,
+		Quarantined:      status.Quarantined,
+		Problems:         []string{},
+	}
+	if !since.IsZero() {
+		r.Since = since.Unix()
+	}
+	if last := c.db.GetLastScrub(); !last.IsZero() {
+		r.LastScrub = last.Unix()
+	}
+	for n, files := range view.ByCopies {
+		for len(r.FilesByCopies) <= n {
+			r.FilesByCopies = append(r.FilesByCopies, 0)
+		}
+		r.FilesByCopies[n] = files
+	}
+
+	replication := make(map[string]PeerReplication, len(view.Peers))
+	for _, p := range view.Peers {
+		replication[p.PeerID] = p
+	}
+	offlineLimit := alertPeerOffline(c.db)
+	for _, p := range status.Peers {
+		rep := replication[p.PeerID]
+		d := ReportDevice{
+			PeerID:       p.PeerID,
+			Label:        p.Label,
+			Online:       p.Online,
+			FilesHeld:    rep.FilesHeld,
+			BytesHeld:    rep.BytesHeld,
+			ProofsPassed: rep.ProofsPassed,
+			ProofsFailed: rep.ProofsFailed,
+			FailedServes: rep.FailedServes,
+		}
+		if !p.LastSeen.IsZero() {
+			d.LastSeen = p.LastSeen.Unix()
+		}
+		for _, e := range c.db.GetProtocolErrors(p.PeerID, reportErrorLimit) {
+			if e.Timestamp.Before(since) {
+				break // Newest first
+			}
+			if d.Errors == 0 {
+				d.LastError = e.Error
+			}
+			d.Errors++
+		}
+		r.Devices = append(r.Devices, d)
+
+		name := deviceName(p.PeerID, p.Label)
+		if !p.Online && (p.LastSeen.IsZero() || now.Sub(p.LastSeen) >= offlineLimit) {
+			if p.LastSeen.IsZero() {
+				r.Problems = append(r.Problems, fmt.Sprintf("%s is offline", name))
+			} else {
+				r.Problems = append(r.Problems, fmt.Sprintf("%s has been offline since %s", name, p.LastSeen.Format(time.DateTime)))
+			}
+		}
+		if d.ProofsFailed > 0 {
+			r.Problems = append(r.Problems, fmt.Sprintf("%s failed %d storage proofs, it lost files it had acknowledged", name, d.ProofsFailed))
+		}
+		if d.FailedServes > 0 {
+			r.Problems = append(r.Problems, fmt.Sprintf("%s served %d files that failed verification", name, d.FailedServes))
+		}
+	}
+
+	if single := filesWithCopies(r.FilesByCopies, 1); single > 0 {
+		r.Problems = append(r.Problems, fmt.Sprintf("%d files are stored on one device only", single))
+	}
+	if r.CorruptBlobs > 0 {
+		r.Problems = append(r.Problems, fmt.Sprintf("%d stored files are corrupt and await repair", r.CorruptBlobs))
+	}
+	if r.Quarantined > 0 {
+		r.Problems = append(r.Problems, fmt.Sprintf("%d entries are quarantined after failing verification", r.Quarantined))
+	}
+	if r.LastScrub == 0 || now.Sub(time.Unix(r.LastScrub, 0)) > 2*scrubInterval(c.db) {
+		r.Problems = append(r.Problems, "the master's stored files have not been scrubbed recently")
+	}
+	return r, nil
+}
+
+// filesWithCopies returns the number of files held by at most n devices
+func filesWithCopies(byCopies []int, n int) int {
+	files := 0
+	for copies, count := range byCopies {
+		if copies <= n {
+			files += count
+		}
+	}
+	return files
+}
+
+// deviceName names a device by its label and short peer ID
+func deviceName(peerID, label string) string {
+	if label != "" {
+		return label + " (" + shortPeerID(peerID) + ")"
+	}
+	return "device " + shortPeerID(peerID)
+}
+
+// SignReport signs a verification report with the master key
+func (c *Core) SignReport(r *VerificationReport) (*SignedReport, error) {
+	if !c.IsMaster() {
+		return nil, fmt.Errorf("%w can sign verification reports", ErrNotMaster)
+	}
+	reportBytes, err := json.Marshal(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal report: %w", err)
+	}
+	return &SignedReport{
+		ReportBytes: reportBytes,
+		Signature:   ed25519.Sign(c.keys.MasterPrivateKey, r.CanonicalBytes()),
+	}, nil
+}
+
+// VerifyReport checks the report signature and vault fingerprint and returns the report
+func VerifyReport(signed SignedReport, masterPub ed25519.PublicKey) (*VerificationReport, error) {
+	var r VerificationReport
+	if err := json.Unmarshal(signed.ReportBytes, &r); err != nil {
+		return nil, fmt.Errorf("invalid report: %w", err)
+	}
+	if r.Version != reportVersion {
+		return nil, fmt.Errorf("unsupported report version %d", r.Version)
+	}
+	if !ed25519.Verify(masterPub, r.CanonicalBytes(), signed.Signature) {
+		return nil, fmt.Errorf("report signature is invalid")
+	}
+	if !bytes.Equal(r.VaultFingerprint, crypto.VaultFingerprint(masterPub)) {
+		return nil, fmt.Errorf("report belongs to a different vault")
+	}
+	return &r, nil
+}
+
+// Summary renders the report as plain text for alerts and the CLI
+func (r VerificationReport) Summary() string {
+	var b strings.Builder
+	generated := time.Unix(r.Generated, 0)
+	fmt.Fprintf(&b, "Verification report of %s", generated.Format(time.DateTime))
+	if r.Since > 0 {
+		fmt.Fprintf(&b, ", covering the time since %s", time.Unix(r.Since, 0).Format(time.DateTime))
+	}
+	fmt.Fprintf(&b, "\n\nVault: %d files in %d folders, %s (%s encrypted), update %d\n",
+		r.Vault.FileCount, r.Vault.FolderCount, formatBytes(r.Vault.LogicalBytes), formatBytes(r.Vault.StoredBytes), r.UpdateID)
+	for copies, files := range r.FilesByCopies {
+		if files > 0 {
+			fmt.Fprintf(&b, "  %d files on %d devices\n", files, copies)
+		}
+	}
+
+	b.WriteString("\nDevices:\n")
+	for _, d := range r.Devices {
+		state := "online"
+		if !d.Online {
+			state = "offline"
+			if d.LastSeen > 0 {
+				state += ", last seen " + time.Unix(d.LastSeen, 0).Format(time.DateTime)
+			}
+		}
+		fmt.Fprintf(&b, "  %s: %s; holds %d files (%s)", deviceName(d.PeerID, d.Label), state, d.FilesHeld, formatBytes(d.BytesHeld))
+		if d.ProofsPassed+d.ProofsFailed > 0 {
+			fmt.Fprintf(&b, ", storage proofs %d/%d passed", d.ProofsPassed, d.ProofsPassed+d.ProofsFailed)
+		}
+		if d.Errors > 0 {
+			fmt.Fprintf(&b, ", %d errors, last: %s", d.Errors, d.LastError)
+		}
+		b.WriteString("\n")
+	}
+
+	b.WriteString("\nMaster integrity: ")
+	if r.LastScrub > 0 {
+		fmt.Fprintf(&b, "last scrub %s", time.Unix(r.LastScrub, 0).Format(time.DateTime))
+	} else {
+		b.WriteString("never scrubbed")
+	}
+	fmt.Fprintf(&b, ", %d corrupt files, %d quarantined entries\n", r.CorruptBlobs, r.Quarantined)
+
+	if len(r.Problems) == 0 {
+		b.WriteString("\nNo problems found.\n")
+	} else {
+		b.WriteString("\nProblems:\n")
+		for _, p := range r.Problems {
+			fmt.Fprintf(&b, "  - %s\n", p)
+		}
+	}
+	return b.String()
+}
+
+// reportFileName names the vault file a report made at t is stored as
+func reportFileName(t time.Time) string {
+	return "report-" + t.Format("2006-01-02") + ".json"
+}
+
+// PublishReport builds and signs a verification report, adds it to the
+// report folder of the vault and publishes it to the replicas. With
+// report-alerts on it is also sent through the alert channels. (master only)
+func (c *Core) PublishReport(ctx context.Context) (*VerificationReport, error) {
+	if c.storage == nil {
+		return nil, fmt.Errorf("storage is not available")
+	}
+	if err := c.CheckWritable(); err != nil {
+		return nil, err
+	}
+	r, err := c.BuildReport()
+	if err != nil {
+		return nil, err
+	}
+	signed, err := c.SignReport(r)
+	if err != nil {
+		return nil, err
+	}
+	content, err := json.MarshalIndent(signed, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	var added, deleted []*database.DataEntry
+	folderID, created, err := c.storage.ChildFolder(storage.RootFolderID, ReportFolderName)
+	if err != nil {
+		return nil, fmt.Errorf("report folder: %w", err)
+	}
+	if created != nil {
+		added = append(added, created)
+	}
+	replaced, entry, err := c.storage.AddFileFromReader(bytes.NewReader(content), reportFileName(time.Unix(r.Generated, 0)), folderID)
+	if err != nil {
+		return nil, fmt.Errorf("storing report: %w", err)
+	}
+	added = append(added, entry)
+	if replaced != nil {
+		deleted = append(deleted, replaced)
+	}
+	note, err := c.storage.SealChangeNote("Verification report")
+	if err != nil {
+		return nil, err
+	}
+	if err := c.PublishBatchUpdate(added, deleted, note); err != nil {
+		return nil, fmt.Errorf("publishing report: %w", err)
+	}
+	c.db.SetLastReport(time.Unix(r.Generated, 0))
+
+	if c.db.GetReportAlerts() {
+		channels, err := alertChannels(c.db)
+		if err != nil {
+			fmt.Println("Warning: Report not sent:", err)
+		} else if len(channels) > 0 {
+			title := "endershare: verification report"
+			if len(r.Problems) > 0 {
+				title = fmt.Sprintf("endershare: verification report, %d problems", len(r.Problems))
+			}
+			deliverAlert(ctx, channels, title, r.Summary())
+		}
+	}
+	return r, nil
+}
+
+// runReports publishes a verification report whenever the report interval
+// has passed since the last one. A master that never made a report waits
+// one interval, so the first report covers a full period.
+func (c *Core) runReports(ctx context.Context) {
+	if c.db.GetLastReport().IsZero() {
+		c.db.SetLastReport(time.Now())
+	}
+	t := time.NewTicker(reportCheckInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		if time.Since(c.db.GetLastReport()) < reportInterval(c.db) {
+			continue
+		}
+		if _, err := c.PublishReport(ctx); err != nil {
+			if !errors.Is(err, ErrVaultFrozen) {
+				fmt.Println("Warning: Verification report failed:", err)
+			}
+			continue
+		}
+		fmt.Println("Verification report added to", ReportFolderName)
+	}
+}
+
+// ReportMain (CLI only) makes a verification report now, or verifies a
+// report file exported from the vault
+func ReportMain(args []string) {
+	if len(args) == 2 && args[0] == "--verify" {
+		verifyReportFile(args[1])
+		return
+	}
+	if len(args) != 1 || args[0] != "--now" {
+		fmt.Println("Usage: endershare report --now | --verify <file>")
+		fmt.Println("Reports are added weekly to the " + ReportFolderName + " folder, see endershare config report-*")
+		os.Exit(1)
+	}
+
+	c := coreStartup(false)
+	if !c.IsMaster() {
+		exitWithError(fmt.Errorf("%w can make verification reports", ErrNotMaster))
+	}
+	if err := c.setupNotifyService(context.Background()); err != nil {
+		fmt.Println("Error setting up notify service:", err)
+	}
+	r, err := c.PublishReport(context.Background())
+	if err != nil {
+		exitWithError(err)
+	}
+	fmt.Print(r.Summary())
+	fmt.Println("\nAdded to", ReportFolderName+"/"+reportFileName(time.Unix(r.Generated, 0)))
+}
+
+// verifyReportFile checks a report file against this node's vault and prints it
+func verifyReportFile(path string) {
+	keys := database.Create().GetKeys()
+	if keys == nil || keys.MasterPublicKey == nil {
+		exitWithError(fmt.Errorf("this node is not part of a vault"))
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		exitWithError(err)
+	}
+	var signed SignedReport
+	if err := json.Unmarshal(content, &signed); err != nil {
+		exitWithError(fmt.Errorf("not a verification report: %w", err))
+	}
+	r, err := VerifyReport(signed, keys.MasterPublicKey)
+	if err != nil {
+		exitWithError(err)
+	}
+	fmt.Println("Signature valid, signed by this vault's master")
+	fmt.Println()
+	fmt.Print(r.Summary())
+}
@@ -0,0 +1,190 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/notassigned/endershare/internal/database"
+	"github.com/notassigned/endershare/internal/storage"
+)
+
+const (
+	// defaultScrubInterval is how often stored blobs are re-hashed unless
+	// the node sets its own interval
+	defaultScrubInterval = 24 * time.Hour
+	// scrubCheckInterval is how often the scrubber looks whether a scrub is due
+	scrubCheckInterval = 10 * time.Minute
+)
+
+// ScrubReport sums up one integrity scrub of the stored blobs
+type ScrubReport struct {
+	Checked   int // Complete blobs re-hashed
+	Corrupted int // Blobs found missing or not matching their hash
+	Repaired  int // Corrupted blobs, including earlier ones, downloaded again
+	Duration  time.Duration
+}
+
+// scrubInterval returns the configured time between scrubs
+func scrubInterval(db *database.EndershareDB) time.Duration {
+	if d := db.GetScrubInterval(); d > 0 {
+		return d
+	}
+	return defaultScrubInterval
+}
+
+// ScrubBlobs re-hashes every complete blob referenced by the data table. A
+// blob that is missing or does not match its hash is removed, marked corrupt
+// and downloaded again from a peer; EventBlobCorrupted is emitted when it is
+// found and EventBlobRepaired once it is restored. Blobs marked corrupt by
+// earlier scrubs are retried first.
+func (c *Core) ScrubBlobs(ctx context.Context) (report ScrubReport, err error) {
+	if c.storage == nil {
+		return report, fmt.Errorf("this node does not store file contents")
+	}
+	started := time.Now()
+	defer func() { report.Duration = time.Since(started) }()
+
+	blobs, sizes, err := c.referencedBlobs()
+	if err != nil {
+		return report, err
+	}
+	if report.Repaired, err = c.repairCorruptBlobs(ctx, sizes); err != nil {
+		return report, err
+	}
+
+	for _, hash := range blobs {
+		if ctx.Err() != nil {
+			return report, ctx.Err()
+		}
+		size := sizes[string(hash)]
+		if c.db.GetDownloadProgress(hash) < size {
+			continue // Not downloaded yet, or waiting for repair
+		}
+		report.Checked++
+		err := c.storage.ValidateOrRemoveFile(hash)
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, storage.ErrBlobCorrupted) && !errors.Is(err, os.ErrNotExist) {
+			fmt.Printf("Warning: Could not scrub blob %x: %v\n", hash[:8], err)
+			continue
+		}
+
+		report.Corrupted++
+		fmt.Printf("Warning: Stored blob %x is corrupt: %v\n", hash[:8], err)
+		c.db.SetDownloadProgress(hash, 0)
+		if err := c.db.MarkBlobCorrupt(hash, size, err.Error()); err != nil {
+			fmt.Println("Warning: Failed to mark blob corrupt:", err)
+		}
+		c.emit(Event{Type: EventBlobCorrupted, FileHash: hash, Size: size})
+		if c.repairBlob(hash, size) {
+			report.Repaired++
+		}
+	}
+	return report, nil
+}
+
+// referencedBlobs lists the distinct blobs of the data table with their sizes
+func (c *Core) referencedBlobs() ([][]byte, map[string]int64, error) {
+	sizes := make(map[string]int64)
+	var blobs [][]byte
+	err := c.db.ForEachData(func(e database.DataEntry) error {
+		if e.Value == nil {
+			return nil
+		}
+		if _, ok := sizes[string(e.Value)]; !ok {
+			blobs = append(blobs, e.Value)
+		}
+		sizes[string(e.Value)] = e.Size
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return blobs, sizes, nil
+}
+
+// repairCorruptBlobs retries the blobs marked corrupt and returns how many
+// were repaired. Marks of blobs no entry references any more are dropped.
+func (c *Core) repairCorruptBlobs(ctx context.Context, sizes map[string]int64) (int, error) {
+	repaired := 0
+	for _, b := range c.db.GetCorruptBlobs() {
+		if ctx.Err() != nil {
+			return repaired, ctx.Err()
+		}
+		if _, ok := sizes[string(b.BlobHash)]; !ok {
+			c.db.ClearBlobCorrupt(b.BlobHash)
+			continue
+		}
+		if c.repairBlob(b.BlobHash, b.Size) {
+			repaired++
+		}
+	}
+	return repaired, nil
+}
+
+// repairBlob downloads a corrupt blob again from the first online peer that
+// serves it and clears its corrupt mark
+func (c *Core) repairBlob(hash []byte, size int64) bool {
+	for _, id := range c.GetOtherPeerIDs() {
+		if online, _ := c.GetPeerStatus(id); !online {
+			continue
+		}
+		pid, err := peer.Decode(id)
+		if err != nil {
+			continue
+		}
+		if err := c.downloadFile(pid, hash, size); err != nil {
+			fmt.Printf("Warning: Peer %s could not repair blob %x: %v\n", id, hash[:8], err)
+			continue
+		}
+		c.db.ClearBlobCorrupt(hash)
+		c.emit(Event{Type: EventBlobRepaired, PeerID: id, FileHash: hash, Size: size})
+		fmt.Printf("Repaired blob %x from %s\n", hash[:8], id)
+		return true
+	}
+	return false
+}
+
+// runScrubber scrubs the stored blobs whenever the scrub interval has passed
+// since the last scrub, and retries the repair of corrupt blobs in between.
+// A node that never scrubbed waits one interval, as its blobs were verified
+// when they were stored.
+func (c *Core) runScrubber(ctx context.Context) {
+	if c.db.GetLastScrub().IsZero() {
+		c.db.SetLastScrub(time.Now())
+	}
+	t := time.NewTicker(scrubCheckInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		if time.Since(c.db.GetLastScrub()) < scrubInterval(c.db) {
+			if c.db.CountCorruptBlobs() > 0 {
+				if _, sizes, err := c.referencedBlobs(); err == nil {
+					c.repairCorruptBlobs(ctx, sizes)
+				}
+			}
+			continue
+		}
+		report, err := c.ScrubBlobs(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			fmt.Println("Warning: Integrity scrub failed:", err)
+		} else if report.Corrupted > 0 || report.Repaired > 0 {
+			fmt.Printf("Integrity scrub: %d blobs checked, %d corrupt, %d repaired in %s\n",
+				report.Checked, report.Corrupted, report.Repaired, report.Duration.Round(time.Second))
+		}
+		c.db.SetLastScrub(time.Now())
+	}
+}
@@ -0,0 +1,56 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/notassigned/endershare/internal/database"
+	"github.com/notassigned/endershare/internal/storage"
+)
+
+// SearchMain (CLI only) prints the files and folders whose name contains
+// every word given, with --tags also those carrying a matching tag
+func SearchMain(args []string) {
+	withTags := len(args) > 0 && args[0] == "--tags"
+	if withTags {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		fmt.Println("Usage: endershare search [--tags] <words...>")
+		os.Exit(1)
+	}
+
+	db := database.Create()
+	keys := db.GetKeys()
+	if keys == nil {
+		fmt.Println("Error: searching needs the vault key, this node doesn't hold it")
+		os.Exit(1)
+	}
+	results, err := storage.NewStorage(db, keys.AESKey).Search(strings.Join(args, " "), withTags)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	if len(results) == 0 {
+		fmt.Println("Nothing found")
+		return
+	}
+	for _, r := range results {
+		switch e := r.Entry.(type) {
+		case storage.FolderEntry:
+			fmt.Printf("%s/%s\n", r.Path, formatTags(e.Tags))
+		case storage.FileEntry:
+			fmt.Printf("%s  %d bytes%s\n", r.Path, e.Size, formatTags(e.Tags))
+		}
+	}
+}
+
+// formatTags returns tags as " #a #b", or "" without tags
+func formatTags(tags []string) string {
+	var b strings.Builder
+	for _, t := range tags {
+		b.WriteString(" #" + t)
+	}
+	return b.String()
+}
@@ -0,0 +1,287 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/notassigned/endershare/internal/database"
+	"github.com/notassigned/endershare/internal/storage"
+)
+
+// selectionCheckInterval is how often a device with selected folders fetches
+// what it is missing and evicts what it no longer keeps
+const selectionCheckInterval = time.Hour
+
+// DeviceSelection lists the folders one device replicates, each with
+// everything below it
+type DeviceSelection struct {
+	PeerID  string             `json:"peerId"`
+	Folders []storage.FolderID `json:"folders"`
+}
+
+// SyncSelection is the selective sync published by the master. A listed
+// device keeps the content of its folders only, the files elsewhere stay
+// placeholders that are fetched when read. Devices not listed replicate
+// every folder.
+type SyncSelection struct {
+	Devices []DeviceSelection `json:"devices"`
+}
+
+// FoldersOf returns the folders selected for a device, false if the device
+// replicates every folder
+func (s SyncSelection) FoldersOf(peerID string) ([]storage.FolderID, bool) {
+	for _, d := range s.Devices {
+		if d.PeerID == peerID {
+			return d.Folders, true
+		}
+	}
+	return nil, false
+}
+
+// GetSyncSelection returns the selective sync in effect on this node
+func (c *Core) GetSyncSelection() SyncSelection {
+	return loadSelection(c.db)
+}
+
+func loadSelection(db *database.EndershareDB) SyncSelection {
+	var s SyncSelection
+	if selectionJSON := db.GetSyncSelectionJSON(); selectionJSON != "" {
+		if err := json.Unmarshal([]byte(selectionJSON), &s); err != nil {
+			fmt.Println("Warning: Ignoring unreadable sync selection:", err)
+			return SyncSelection{}
+		}
+	}
+	return s
+}
+
+func saveSelection(db *database.EndershareDB, s SyncSelection) error {
+	selectionJSON, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return db.SetSyncSelectionJSON(string(selectionJSON))
+}
+
+// PublishSyncSelection sets the folders a device replicates and broadcasts
+// the selection as a signed update, so the device follows it without being
+// configured itself. No folders lets the device replicate everything again
+// (master only).
+func (c *Core) PublishSyncSelection(peerID string, folders []storage.FolderID) error {
+	if !c.IsMaster() || c.storage == nil {
+		return fmt.Errorf("%w can choose the folders devices replicate", ErrNotMaster)
+	}
+	if peerID == c.p2pNode.GetPeerId().String() {
+		return fmt.Errorf("the master node keeps the content of every file")
+	}
+	if !slices.Contains(c.db.GetAllPeerIDs(), peerID) {
+		return fmt.Errorf("peer %w in this vault: %s", storage.ErrNotFound, peerID)
+	}
+	var selected []storage.FolderID
+	for _, id := range folders {
+		if id.IsRoot() {
+			return fmt.Errorf("the root folder can't be selected, replicate every folder instead")
+		}
+		if _, err := c.storage.GetFolder(id); err != nil {
+			return err
+		}
+		if !slices.Contains(selected, id) {
+			selected = append(selected, id)
+		}
+	}
+
+	s := c.GetSyncSelection()
+	s.Devices = slices.DeleteFunc(slices.Clone(s.Devices), func(d DeviceSelection) bool { return d.PeerID == peerID })
+	if len(selected) > 0 {
+		s.Devices = append(s.Devices, DeviceSelection{PeerID: peerID, Folders: selected})
+	}
+	if err := saveSelection(c.db, s); err != nil {
+		return err
+	}
+	return c.publishControlUpdate("SELECTION", s)
+}
+
+// SetSyncFolder adds a folder to or removes it from the folders a device
+// replicates. Removing the last one lets the device replicate everything.
+func (c *Core) SetSyncFolder(peerID string, folderID storage.FolderID, selected bool) error {
+	current, _ := c.GetSyncSelection().FoldersOf(peerID)
+	folders := slices.DeleteFunc(slices.Clone(current), func(id storage.FolderID) bool { return id == folderID })
+	if selected {
+		folders = append(folders, folderID)
+	}
+	return c.PublishSyncSelection(peerID, folders)
+}
+
+// applySelectionUpdate stores the selective sync carried by a SELECTION update
+func (c *Core) applySelectionUpdate(update Update) error {
+	var s SyncSelection
+	if err := json.Unmarshal(update.UpdateData, &s); err != nil {
+		return err
+	}
+	return saveSelection(c.db, s)
+}
+
+// selectedFolders returns the folders the master selected for this node,
+// false if it replicates every folder
+func (c *Core) selectedFolders() ([]storage.FolderID, bool) {
+	return c.GetSyncSelection().FoldersOf(c.p2pNode.GetPeerId().String())
+}
+
+// runSelection keeps the stored blobs in step with the folders selected for
+// this node, the folder replication modes and the node's pins: on start, when
+// any of them changes, when a folder moves, and every selectionCheckInterval
+// to retry failed downloads
+func (c *Core) runSelection(ctx context.Context) {
+	changed := make(chan struct{}, 1)
+	cancel := c.Subscribe(func(e Event) {
+		if e.Type == EventUpdateApplied && e.Update.UpdateDataType != "SELECTION" && e.Update.UpdateDataType != "REPLICATION" {
+			return
+		}
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}, EventUpdateApplied, EventSubtreeMoved, EventPinsChanged)
+	defer cancel()
+
+	t := time.NewTicker(selectionCheckInterval)
+	defer t.Stop()
+	reselected := false
+	for {
+		c.reconcileSelection(ctx, reselected)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			reselected = false
+		case <-changed:
+			reselected = true
+		}
+	}
+}
+
+// reconcileSelection evicts the blobs of archived files and those this node
+// no longer keeps in scope, and fetches the missing ones it does. A node whose selection, policy or pins
+// were just lifted fetches every missing blob, unless it keeps placeholders
+// anyway.
+func (c *Core) reconcileSelection(ctx context.Context, reselected bool) {
+	c.evictArchived()
+	sc := c.syncScope()
+	if sc.Empty() && (!reselected || sc.OnDemand) {
+		return
+	}
+	inside, outside, err := c.storage.SplitBlobs(sc)
+	if err != nil {
+		fmt.Println("Warning: Selective sync failed:", err)
+		return
+	}
+
+	var evicted, fetched int
+	var freed int64
+	for _, entry := range outside {
+		n, err := c.storage.EvictBlob(entry.Value, entry.Size)
+		if err != nil {
+			fmt.Println("Warning: Failed to evict blob:", err)
+			continue
+		}
+		if n > 0 {
+			evicted++
+			freed += n
+		}
+	}
+	for _, entry := range inside {
+		if ctx.Err() != nil {
+			return
+		}
+		if c.db.GetDownloadProgress(entry.Value) >= entry.Size {
+			continue
+		}
+		if err := c.fetchBlob(entry.Value, entry.Size); err != nil {
+			fmt.Printf("Warning: failed to download file: %v\n", err)
+			continue
+		}
+		fetched++
+	}
+	if evicted > 0 || fetched > 0 {
+		fmt.Printf("Selective sync: %d files fetched, %d evicted (%s freed)\n", fetched, evicted, formatBytes(freed))
+	}
+}
+
+// folderPath returns the slash-separated path of a folder, as taken by
+// resolveFolderPath, or its ID if a folder on the way is unknown
+func folderPath(stor *storage.Storage, folderID storage.FolderID) string {
+	var names []string
+	for id, steps := folderID, 0; !id.IsRoot() && steps < 256; steps++ {
+		folder, err := stor.GetFolder(id)
+		if err != nil {
+			return string(folderID)
+		}
+		names = append([]string{folder.Name}, names...)
+		id = folder.ParentFolderID
+	}
+	return "/" + strings.Join(names, "/")
+}
+
+// SyncFoldersMain (CLI only) shows the folders each device replicates, or
+// sets them for one device (master only)
+func SyncFoldersMain(args []string) {
+	if len(args) == 0 {
+		db := database.Create()
+		keys := db.GetKeys()
+		var stor *storage.Storage
+		if keys != nil && keys.AESKey != nil {
+			stor = storage.NewStorage(db, keys.AESKey)
+		}
+		s := loadSelection(db)
+		if len(s.Devices) == 0 {
+			fmt.Println("Every device replicates every folder")
+			return
+		}
+		for _, d := range s.Devices {
+			fmt.Println(d.PeerID)
+			for _, id := range d.Folders {
+				if stor != nil {
+					fmt.Println("    " + folderPath(stor, id))
+				} else {
+					fmt.Println("    " + string(id))
+				}
+			}
+		}
+		fmt.Println("Devices not listed replicate every folder")
+		return
+	}
+	if len(args) < 2 {
+		fmt.Println("Usage: endershare sync-folders [<peer-id> all | <peer-id> <folder-path>...]")
+		os.Exit(1)
+	}
+
+	c := coreStartup(false)
+	if !c.IsMaster() {
+		exitWithError(fmt.Errorf("%w can choose the folders devices replicate", ErrNotMaster))
+	}
+	if err := c.setupNotifyService(context.Background()); err != nil {
+		fmt.Println("Error setting up notify service:", err)
+	}
+	var folders []storage.FolderID
+	if !(len(args) == 2 && args[1] == "all") {
+		for _, path := range args[1:] {
+			id, err := resolveFolderPath(c.storage, path)
+			if err != nil {
+				exitWithError(err)
+			}
+			folders = append(folders, id)
+		}
+	}
+	if err := c.PublishSyncSelection(args[0], folders); err != nil {
+		exitWithError(err)
+	}
+	if len(folders) == 0 {
+		fmt.Println(args[0], "replicates every folder")
+	} else {
+		fmt.Printf("%s replicates %d folders\n", args[0], len(folders))
+	}
+}
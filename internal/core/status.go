@@ -0,0 +1,175 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/notassigned/endershare/internal/database"
+)
+
+// NodeStatus summarizes what a node holds and how current it is. Everything
+// is read from unencrypted columns and signed updates, so locked replicas
+// without the vault key can report it.
+type NodeStatus struct {
+	HasVaultKey bool
+
+	// Entries and bytes referenced by the current data table
+	Entries        int64
+	EncryptedBytes int64
+
+	// Distinct blobs and their bytes stored locally, against the node's
+	// storage quota (0 for none)
+	Blobs     int64
+	BlobBytes int64
+	Quota     int64
+
+	// Blobs stored locally out of those referenced
+	FilesComplete   int64
+	FilesTotal      int64
+	BytesStored     int64
+	BytesReferenced int64
+
+	// Latest update applied
+	LastUpdateID   uint64
+	LastUpdateType string
+	LastUpdateTime time.Time
+
+	// Latest signed vault snapshot from the master, nil if none was received
+	Vault *VaultStats
+
+	// Entries that failed verification and are not refetched for a while
+	Quarantined int
+
+	// Stored blobs that failed an integrity scrub and await repair
+	CorruptBlobs int
+
+	// Freeze state last published by the master
+	Freeze VaultFreeze
+
+	// Resource profile in effect, with how it was chosen
+	Profile string
+
+	Peers []PeerHealth
+}
+
+// PeerHealth is the known state of one vault peer
+type PeerHealth struct {
+	PeerID     string
+	Label      string
+	Online     bool
+	LastSeen   time.Time
+	Path       string
+	Unverified int // Addresses that failed a dial-back check
+}
+
+// ReadNodeStatus builds a NodeStatus from the database alone. Peer
+// connectivity is unknown without a running node, so peers are listed offline.
+func ReadNodeStatus(db *database.EndershareDB) NodeStatus {
+	var status NodeStatus
+	status.HasVaultKey = db.GetKeys() != nil
+	status.Entries, status.EncryptedBytes = db.GetStorageStats()
+	status.FilesComplete, status.FilesTotal, status.BytesStored, status.BytesReferenced = db.GetReplicationProgress()
+	status.Blobs, status.BlobBytes = db.GetStoredBlobStats()
+	status.Quota = db.GetStorageQuota()
+	status.Freeze = loadFreeze(db)
+	status.Profile = describeProfile(db)
+
+	if latestJSON, err := db.GetLatestUpdateJSON(); err == nil {
+		var signedUpdate SignedUpdate
+		if err := json.Unmarshal([]byte(latestJSON), &signedUpdate); err == nil {
+			if update, err := signedUpdate.GetUpdate(); err == nil {
+				status.LastUpdateID = update.UpdateID
+				status.LastUpdateType = update.UpdateDataType
+				status.LastUpdateTime = time.Unix(update.Timestamp, 0)
+			}
+		}
+	}
+
+	if latest := db.GetLatestVaultStats(); latest != nil {
+		stats := vaultStatsFromDB(*latest)
+		status.Vault = &stats
+	}
+
+	status.Quarantined = db.CountQuarantine()
+	status.CorruptBlobs = db.CountCorruptBlobs()
+
+	for _, p := range db.GetAllPeers() {
+		status.Peers = append(status.Peers, PeerHealth{PeerID: p.PeerID, Label: p.Label, Unverified: len(p.Unverified)})
+	}
+	return status
+}
+
+// Status returns the node status with live peer connectivity
+func (c *Core) Status() NodeStatus {
+	status := ReadNodeStatus(c.db)
+	selfID := c.GetNodeID()
+
+	peers := status.Peers[:0]
+	for _, p := range status.Peers {
+		if p.PeerID == selfID {
+			continue
+		}
+		p.Online, p.LastSeen = c.GetPeerStatus(p.PeerID)
+		p.Path = c.GetPeerPath(p.PeerID)
+		peers = append(peers, p)
+	}
+	status.Peers = peers
+	return status
+}
+
+// StatusMain (CLI only) prints the node status without needing the vault key
+func StatusMain() {
+	db := database.Create()
+	status := ReadNodeStatus(db)
+	if jsonOutput {
+		printJSON(newStatusJSON(db, status))
+		return
+	}
+
+	if status.HasVaultKey {
+		fmt.Println("Vault key: present")
+	} else {
+		fmt.Println("Vault key: not present (metadata-only replica)")
+	}
+	fmt.Printf("Entries: %d (%d encrypted bytes)\n", status.Entries, status.EncryptedBytes)
+	fmt.Printf("Replication: %d/%d files, %d/%d bytes\n", status.FilesComplete, status.FilesTotal, status.BytesStored, status.BytesReferenced)
+	if status.Quota > 0 {
+		fmt.Printf("Quota: %d/%d bytes used by %d blobs\n", status.BlobBytes, status.Quota, status.Blobs)
+	}
+	fmt.Println("Profile:", status.Profile)
+
+	if status.LastUpdateID > 0 {
+		fmt.Printf("Last update: #%d %s at %s\n", status.LastUpdateID, status.LastUpdateType, status.LastUpdateTime.Format(time.RFC3339))
+	} else {
+		fmt.Println("Last update: none")
+	}
+
+	if status.Vault != nil {
+		fmt.Printf("Vault: %d files, %d folders, %d bytes\n", status.Vault.FileCount, status.Vault.FolderCount, status.Vault.LogicalBytes)
+	}
+
+	if status.Freeze.Frozen {
+		fmt.Printf("Frozen: since %s %s\n", time.Unix(status.Freeze.Since, 0).Format(time.RFC3339), status.Freeze.Reason)
+	}
+
+	if status.Quarantined > 0 {
+		fmt.Printf("Quarantined: %d entries failed verification (see endershare quarantine)\n", status.Quarantined)
+	}
+
+	if status.CorruptBlobs > 0 {
+		fmt.Printf("Corrupt: %d stored files failed an integrity scrub and await repair\n", status.CorruptBlobs)
+	}
+
+	fmt.Printf("Peers: %d known (live status is shown by the running node)\n", len(status.Peers))
+	for _, p := range status.Peers {
+		line := "  " + p.PeerID
+		if p.Label != "" {
+			line += " (" + p.Label + ")"
+		}
+		if p.Unverified > 0 {
+			line += fmt.Sprintf(", %d unverified addresses", p.Unverified)
+		}
+		fmt.Println(line)
+	}
+}
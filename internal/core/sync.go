@@ -4,13 +4,17 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 
 	"github.com/libp2p/go-libp2p/core/peer"
-	"github.com/multiformats/go-multiaddr"
 	"github.com/notassigned/endershare/internal/crypto"
 	"github.com/notassigned/endershare/internal/database"
+	"github.com/notassigned/endershare/internal/p2p"
 )
 
+// maxPeerListResponseSize bounds the bytes read from a peer list response
+const maxPeerListResponseSize = 16 << 20
+
 // processUpdate is called when an update is received via gossipsub
 func (c *Core) processUpdate(signedUpdate SignedUpdate, from peer.ID) error {
 	// 1. Verify signature
@@ -33,6 +37,20 @@ func (c *Core) processUpdate(signedUpdate SignedUpdate, from peer.ID) error {
 	if update.UpdateID <= currentID {
 		return nil
 	}
+	c.sawUpdate(update.UpdateID)
+
+	// Keyed digests can only be compared holding the same digest key
+	if len(update.DigestKeyID) > 0 {
+		if err := c.ensureDigestKey(update.DigestKeyID, from); err != nil {
+			return fmt.Errorf("failed to get digest key: %w", err)
+		}
+	}
+
+	// Key epochs only move forward
+	localEpoch := c.db.GetKeyEpoch()
+	if update.KeyEpoch < localEpoch {
+		return fmt.Errorf("update key epoch %d is older than current epoch %d", update.KeyEpoch, localEpoch)
+	}
 
 	// 4. Sync peer list if needed
 	if err := c.syncPeerList(update, from); err != nil {
@@ -44,10 +62,42 @@ func (c *Core) processUpdate(signedUpdate SignedUpdate, from peer.ID) error {
 		return fmt.Errorf("failed to sync data: %w", err)
 	}
 
+	// Control updates carry payloads outside the peer list and data table
+	switch update.UpdateDataType {
+	case "RELEASE":
+		if err := c.applyReleaseUpdate(update); err != nil {
+			fmt.Println("Warning: failed to apply release update:", err)
+		}
+	case "STATUS":
+		if err := c.applyStatusUpdate(update); err != nil {
+			fmt.Println("Warning: failed to apply status update:", err)
+		}
+	case "POLICY":
+		if err := c.applyPolicyUpdate(update); err != nil {
+			fmt.Println("Warning: failed to apply policy update:", err)
+		}
+	case "FREEZE":
+		if err := c.applyFreezeUpdate(update); err != nil {
+			fmt.Println("Warning: failed to apply freeze update:", err)
+		}
+	case "SELECTION":
+		if err := c.applySelectionUpdate(update); err != nil {
+			fmt.Println("Warning: failed to apply selection update:", err)
+		}
+	case "REPLICATION":
+		if err := c.applyReplicationUpdate(update); err != nil {
+			fmt.Println("Warning: failed to apply replication update:", err)
+		}
+	}
+
 	// 6. Update node state
 	c.db.SetCurrentUpdateID(update.UpdateID)
 	c.db.SetPeerListHash(update.PeerListHash)
+	c.db.SetPeerListHashVersion(peerListHashVersionFor(update))
 	c.db.SetDataRootHash(update.DataHash)
+	if update.KeyEpoch > localEpoch {
+		c.db.SetKeyEpoch(update.KeyEpoch)
+	}
 
 	// 7. Store update in database
 	signedUpdateJSON, err := json.Marshal(signedUpdate)
@@ -61,10 +111,11 @@ func (c *Core) processUpdate(signedUpdate SignedUpdate, from peer.ID) error {
 
 	// Update storage state after sync
 	if c.storage != nil {
-		c.storage.ReloadNextFolderID()
 		c.storage.BackfillFolderTags()
 	}
 
+	c.emitUpdate(update)
+
 	// Notify UI of data change
 	if c.OnDataUpdated != nil {
 		c.OnDataUpdated()
@@ -83,30 +134,34 @@ func (c *Core) syncPeerList(update Update, from peer.ID) error {
 
 	// Check if peer list hash differs
 	if bytes.Equal(update.PeerListHash, currentHash) {
-		// Peer list is already in sync
+		// Peer list is already in sync, but an address change of a known
+		// peer leaves the hash unchanged
+		if update.UpdateDataType == "PEER" {
+			return c.applyPeerUpdate(update, from)
+		}
 		return nil
 	}
 
 	// Check if we can fast-forward
 	if bytes.Equal(update.PrevPeerListHash, currentHash) && update.UpdateDataType == "PEER" {
 		// Fast-forward: apply update directly
-		return c.applyPeerUpdate(update.UpdateData, update.PeerListHash, from)
+		return c.applyPeerUpdate(update, from)
 	}
 
 	// Full sync needed: request entire peer list
-	return c.syncPeerListFull(update.PeerListHash, from)
+	return c.syncPeerListFull(update.PeerListHash, peerListHashVersionFor(update), from)
 }
 
 // applyPeerUpdate applies a peer update directly (fast-forward path)
-func (c *Core) applyPeerUpdate(updateData interface{}, expectedHash []byte, from peer.ID) error {
-	// Parse as PeerUpdate
-	updateJSON, err := json.Marshal(updateData)
+func (c *Core) applyPeerUpdate(update Update, from peer.ID) error {
+	peerUpdate, err := update.PeerUpdate()
 	if err != nil {
 		return err
 	}
 
-	var peerUpdate PeerUpdate
-	if err := json.Unmarshal(updateJSON, &peerUpdate); err != nil {
+	// Validate before anything is stored; only the sanitized addresses are kept
+	peerInfo, err := peerInfoFromPeerUpdate(peerUpdate)
+	if err != nil {
 		return err
 	}
 
@@ -122,60 +177,82 @@ func (c *Core) applyPeerUpdate(updateData interface{}, expectedHash []byte, from
 			}
 		}
 
-		if peerExists {
-			// Update addresses
-			c.db.UpdatePeerAddresses(peerUpdate.PeerID, peerUpdate.Addresses)
-		} else {
-			// Add new peer
-			// Convert to AddrInfo format (simplified - just store in database directly)
-			// The full conversion will happen when GetPeers is called
-			// For now, use the raw insert
-			c.db.AddPeer(peerInfoFromPeerUpdate(peerUpdate))
+		if !peerExists {
+			if err := c.addPeer(peerInfo); err != nil {
+				return fmt.Errorf("failed to add peer: %w", err)
+			}
+			c.emitPeer(EventPeerJoined, peerUpdate.PeerID)
+			c.VerifyPeerAddrs(peerInfo)
+		} else if known, _ := c.db.GetPeerAddresses(peerUpdate.PeerID); !sameAddrs(known, addrStrings(peerInfo.Addrs)) {
+			if err := c.updatePeerAddrs(peerInfo); err != nil {
+				return fmt.Errorf("failed to update peer addresses: %w", err)
+			}
+			c.VerifyPeerAddrs(peerInfo)
 		}
 
 	case "REMOVE":
-		c.db.RemovePeer(peerUpdate.PeerID)
+		if err := c.removePeer(peerUpdate.PeerID); err != nil {
+			return fmt.Errorf("failed to remove peer: %w", err)
+		}
+		c.emitPeer(EventPeerLeft, peerUpdate.PeerID)
 
 	default:
 		return fmt.Errorf("unknown peer update action: %s", peerUpdate.Action)
 	}
 
 	// Verify the new peer list hash matches, if not pull full list
-	currentHash := ComputePeerListHash(c.db.GetAllPeerIDs())
-	if !bytes.Equal(currentHash, expectedHash) {
-		return c.syncPeerListFull(expectedHash, from)
+	hashVersion := peerListHashVersionFor(update)
+	currentHash := ComputePeerListHashVersion(c.db.GetAllPeerIDs(), hashVersion, c.digestKey)
+	if !bytes.Equal(currentHash, update.PeerListHash) {
+		return c.syncPeerListFull(update.PeerListHash, hashVersion, from)
 	}
 
 	return nil
 }
 
 // syncPeerListFull requests the full peer list from a peer
-func (c *Core) syncPeerListFull(expectedHash []byte, from peer.ID) error {
+// and verifies it against expectedHash computed with the given hash version
+func (c *Core) syncPeerListFull(expectedHash []byte, hashVersion int, from peer.ID) error {
 	resp, err := c.RequestPeerList(from)
 	if err != nil {
 		return err
 	}
 
-	// Convert response to DBPeer slice
+	if len(resp) > p2p.MaxPeerListEntries {
+		return fmt.Errorf("peer list has %d entries, limit is %d", len(resp), p2p.MaxPeerListEntries)
+	}
+
+	// Convert response to DBPeer slice, rejecting the list if any entry is invalid
 	dbPeers := make([]database.DBPeer, len(resp))
 	for i, p := range resp {
+		if _, err := p2p.ParsePeerID(p.PeerID); err != nil {
+			return fmt.Errorf("invalid peer list entry: %w", err)
+		}
+		addrs, err := p2p.ParsePeerAddrs(p.Addresses)
+		if err != nil {
+			return fmt.Errorf("invalid addresses for peer %s: %w", p.PeerID, err)
+		}
 		dbPeers[i] = database.DBPeer{
 			PeerID:    p.PeerID,
-			Addresses: p.Addresses,
+			Addresses: addrStrings(addrs),
 		}
 	}
 
-	// Atomically replace all peers
-	if err := c.db.ReplaceAllPeers(dbPeers); err != nil {
-		return fmt.Errorf("failed to replace peers: %w", err)
+	// Merge the list in, keeping local peer metadata
+	before := c.db.GetAllPeerIDs()
+	updated, err := c.mergePeers(dbPeers)
+	if err != nil {
+		return fmt.Errorf("failed to merge peers: %w", err)
 	}
+	c.emitPeerListChange(before, c.db.GetAllPeerIDs())
 
 	// Verify the new peer list hash matches
-	currentHash := ComputePeerListHash(c.db.GetAllPeerIDs())
+	currentHash := ComputePeerListHashVersion(c.db.GetAllPeerIDs(), hashVersion, c.digestKey)
 	if !bytes.Equal(currentHash, expectedHash) {
 		return fmt.Errorf("peer list hash mismatch after sync")
 	}
 
+	c.VerifyPeerAddrs(updated...)
 	return nil
 }
 
@@ -196,35 +273,48 @@ func (c *Core) syncData(update Update, from peer.ID) error {
 	// Check if we can fast-forward
 	if bytes.Equal(update.PrevDataHash, currentHash) && update.UpdateDataType == "DATA" {
 		// Fast-forward: apply update directly
-		return c.applyDataUpdate(update.UpdateData, from)
+		done := c.beginSyncRound(update, from, SyncModeFastForward)
+		err := c.applyDataUpdate(update, from)
+		if err == nil {
+			c.dropSyncProgress()
+		}
+		done(err)
+		return err
 	}
 
 	// Full sync needed: use merkle tree diff
-	return c.syncDataFull(update, from)
+	mode := SyncModeDiff
+	if c.merkleTree == nil || c.merkleTree.GetNumBuckets() != update.NumBuckets {
+		mode = SyncModeRebuild
+	}
+	done := c.beginSyncRound(update, from, mode)
+	err = c.syncDataFull(update, from)
+	done(err)
+	return err
 }
 
 // applyDataUpdate applies a data update directly (fast-forward path)
-func (c *Core) applyDataUpdate(updateData interface{}, from peer.ID) error {
-	// Parse as DataUpdate
-	updateJSON, err := json.Marshal(updateData)
+func (c *Core) applyDataUpdate(update Update, from peer.ID) error {
+	dataUpdate, err := update.DataUpdate()
 	if err != nil {
 		return err
 	}
 
-	var dataUpdate DataUpdate
-	if err := json.Unmarshal(updateJSON, &dataUpdate); err != nil {
-		// Not a data update, might be a peer update - ignore
-		return nil
-	}
-
 	switch dataUpdate.Action {
 	case "ADD", "MODIFY":
 		// Insert metadata into database and merkle tree
-		c.insertData(dataUpdate.Key, dataUpdate.Value, dataUpdate.Size, dataUpdate.Hash)
+		c.insertData(dataUpdate.Key, dataUpdate.Value, dataUpdate.Size, dataUpdate.Hash, update.KeyEpoch)
+		c.recordSync(func(r *SyncRound) { r.EntriesFetched++ })
+
+		// A MODIFY replaces an entry; the old one goes after the new one is in
+		if dataUpdate.PrevKey != nil {
+			c.deleteData(dataUpdate.PrevKey, dataUpdate.PrevHash)
+			c.recordSync(func(r *SyncRound) { r.EntriesDeleted++ })
+		}
 
 		// Download file if Value is not nil (folders have nil value)
 		if dataUpdate.Value != nil {
-			if err := c.downloadFile(from, dataUpdate.Value, dataUpdate.Size); err != nil {
+			if err := c.syncFile(from, dataUpdate.Key, dataUpdate.Value, dataUpdate.Size); err != nil {
 				fmt.Printf("Warning: failed to download file: %v\n", err)
 			}
 		}
@@ -232,6 +322,12 @@ func (c *Core) applyDataUpdate(updateData interface{}, from peer.ID) error {
 	case "DELETE":
 		// Remove entry from database and merkle tree
 		c.deleteData(dataUpdate.Key, dataUpdate.Hash)
+		c.recordSync(func(r *SyncRound) { r.EntriesDeleted++ })
+
+	case "BATCH":
+		if err := c.applyBatch(dataUpdate, update.KeyEpoch, from); err != nil {
+			return err
+		}
 
 	default:
 		return fmt.Errorf("unknown data update action: %s", dataUpdate.Action)
@@ -243,84 +339,96 @@ func (c *Core) applyDataUpdate(updateData interface{}, from peer.ID) error {
 	return nil
 }
 
+// applyBatch applies the updates of a BATCH in one transaction, so the
+// storage index never holds part of them, then downloads any files they add
+func (c *Core) applyBatch(batch DataUpdate, keyEpoch uint32, from peer.ID) error {
+	var puts []database.DataPut
+	var deletes [][]byte
+	for _, op := range batch.Batch {
+		switch op.Action {
+		case "ADD", "MODIFY":
+			puts = append(puts, database.DataPut{Entry: database.DataEntry{Key: op.Key, Value: op.Value, Size: op.Size, Hash: op.Hash, KeyEpoch: keyEpoch}})
+			if op.PrevKey != nil {
+				deletes = append(deletes, op.PrevKey)
+			}
+		case "DELETE":
+			deletes = append(deletes, op.Key)
+		default:
+			return fmt.Errorf("unknown data update action in batch: %s", op.Action)
+		}
+	}
+	if err := c.db.WriteDataBatch(puts, deletes); err != nil {
+		return fmt.Errorf("failed to apply batch: %w", err)
+	}
+	updateTree(c.merkleTree, batch)
+	c.emitDataUpdate(batch, keyEpoch)
+	c.recordSync(func(r *SyncRound) {
+		r.EntriesFetched += len(puts)
+		r.EntriesDeleted += len(deletes)
+	})
+
+	for _, put := range puts {
+		if put.Entry.Value != nil {
+			if err := c.syncFile(from, put.Entry.Key, put.Entry.Value, put.Entry.Size); err != nil {
+				fmt.Printf("Warning: failed to download file: %v\n", err)
+			}
+		}
+	}
+	return nil
+}
+
 // syncDataFull performs full data sync using merkle tree
 func (c *Core) syncDataFull(update Update, from peer.ID) error {
 	// Phase 1: Check if tree structure matches
 	if c.merkleTree == nil || c.merkleTree.GetNumBuckets() != update.NumBuckets {
 		// Bucket count mismatch - need full rebuild
-		return c.rebuildTreeFromPeer(update.NumBuckets, update.DataHash, from)
+		return c.rebuildTreeFromPeer(update, from)
 	}
 
-	// Phase 2: Request peer's merkle tree bucket hashes and find differences
+	// Phase 2: Request peer's merkle tree bucket hashes and find differences,
+	// leaving out the buckets an interrupted sync already completed
 	peerTreeBuckets := c.RequestTreeBucketHashes(from, update.NumBuckets)
 	localTreeBuckets := c.merkleTree.GetBucketHashes()
+	completed := c.resumeSync(update.NumBuckets)
 
 	diffBucketIndices := []int{}
+	resumed := 0
 	for i := 0; i < len(localTreeBuckets); i++ {
 		if i >= len(peerTreeBuckets) || !bytes.Equal(localTreeBuckets[i], peerTreeBuckets[i]) {
+			if bucketCompleted(completed, peerTreeBuckets, i) {
+				resumed++
+				continue
+			}
 			diffBucketIndices = append(diffBucketIndices, i)
 		}
 	}
+	c.recordSync(func(r *SyncRound) {
+		r.BucketsCompared = len(localTreeBuckets)
+		r.BucketsDiffering = len(diffBucketIndices)
+		r.BucketsResumed = resumed
+	})
 
-	// Phase 3: For each differing bucket, get data entry hashes and compute diff
-	c.db.MarkAllStale() // Mark all entries as stale
-
-	hashesToDownload := [][]byte{} // Data entry hashes needing metadata/files
-
-	// Batch request all differing buckets at once
-	peerBucketHashes, err := c.RequestDataBucketHashes(from, diffBucketIndices, update.NumBuckets)
-	if err != nil {
-		return err
-	}
-
-	for _, bucketIdx := range diffBucketIndices {
-		// Get peer and local data hashes for this bucket
-		peerDataHashes := peerBucketHashes[bucketIdx]
-		localDataHashes := c.db.GetBucketHashes(bucketIdx, update.NumBuckets)
-
-		// Mark peer hashes as current
-		for _, hash := range peerDataHashes {
-			if !containsHash(localDataHashes, hash) {
-				// New hash - need to download metadata and file
-				hashesToDownload = append(hashesToDownload, hash)
-			}
-			// Mark as current (will be inserted or already exists)
-			c.db.MarkHashCurrent(hash)
-		}
+	// Phase 3: For each differing bucket, get data entry hashes, then
+	// download metadata and files for new hashes
+	insert := func(metadata MetadataEntry) {
+		c.insertData(metadata.Key, metadata.Value, metadata.Size, metadata.Hash, metadata.KeyEpoch)
 	}
-
-	// Phase 4: Download metadata and files for new hashes
-	if len(hashesToDownload) > 0 {
-		// Request metadata (key + file hash) for all needed hashes at once
-		metadataList, err := c.RequestMetadata(from, hashesToDownload)
-		if err != nil {
-			return fmt.Errorf("failed to request metadata: %w", err)
-		}
-
-		for _, metadata := range metadataList {
-			// Insert metadata into database
-			c.db.PutData(metadata.Key, metadata.Value, metadata.Size, metadata.Hash)
-			c.merkleTree.Insert(metadata.Hash)
-
-			// Request file if Value is not nil (folders have nil value)
-			if metadata.Value != nil {
-				if err := c.downloadFile(from, metadata.Value, metadata.Size); err != nil {
-					fmt.Printf("Warning: failed to download file: %v\n", err)
-				}
-			}
-		}
+	if err := c.syncBuckets(update, from, diffBucketIndices, peerTreeBuckets, insert, nil); err != nil {
+		return err
 	}
 
-	// Phase 5: Delete stale entries and update hash
+	// Phase 4: Delete stale entries and update hash
 	staleHashes := c.db.GetStaleHashes()
 	for _, hash := range staleHashes {
 		c.merkleTree.Delete(hash)
 	}
-	c.db.DeleteStaleEntries()
+	c.deleteStaleEntries(staleHashes)
+	c.recordSync(func(r *SyncRound) { r.EntriesDeleted += len(staleHashes) })
 
 	c.updateDataHash() // Call once at end
 
-	// Verify root hash
+	// Verify root hash. Either way the sync is over and starts afresh next time.
+	c.db.ClearSyncProgress()
 	if !bytes.Equal(c.merkleTree.GetRootHash(), update.DataHash) {
 		return fmt.Errorf("merkle root mismatch after sync")
 	}
@@ -330,75 +438,186 @@ func (c *Core) syncDataFull(update Update, from peer.ID) error {
 
 // rebuildTreeFromPeer performs a full rebuild when bucket count mismatches.
 // Requests all data from the peer and rebuilds the local merkle tree with the peer's bucket count.
-func (c *Core) rebuildTreeFromPeer(numBuckets int, expectedHash []byte, from peer.ID) error {
-	// Build list of all bucket indices
-	allIndices := make([]int, numBuckets)
-	for i := range allIndices {
-		allIndices[i] = i
+func (c *Core) rebuildTreeFromPeer(update Update, from peer.ID) error {
+	numBuckets := update.NumBuckets
+	expectedHash := update.DataHash
+
+	// The peer's tree hashes tell which buckets an interrupted rebuild
+	// completed; without them every bucket is fetched
+	peerTreeBuckets := c.RequestTreeBucketHashes(from, numBuckets)
+	completed := c.resumeSync(numBuckets)
+
+	// Fetch the peer's entries bucket by bucket, building the new tree from
+	// every peer hash as it arrives. Completed buckets hold the peer's
+	// hashes already.
+	tree := crypto.NewMerkleTreeBuilder(numBuckets, c.digestKey)
+	var indices []int
+	for i := 0; i < numBuckets; i++ {
+		if bucketCompleted(completed, peerTreeBuckets, i) {
+			for _, hash := range c.db.GetCurrentBucketHashes(i, numBuckets) {
+				tree.Add(hash)
+			}
+			continue
+		}
+		indices = append(indices, i)
 	}
 
-	// Request all data entry hashes from peer
-	peerBucketHashes, err := c.RequestDataBucketHashes(from, allIndices, numBuckets)
-	if err != nil {
+	c.recordSync(func(r *SyncRound) {
+		r.BucketsCompared = numBuckets
+		r.BucketsDiffering = len(indices)
+		r.BucketsResumed = numBuckets - len(indices)
+	})
+
+	put := func(metadata MetadataEntry) {
+		c.db.PutData(metadata.Key, metadata.Value, metadata.Size, metadata.Hash, metadata.KeyEpoch)
+		c.emitEntry(EventEntryAdded, database.DataEntry{Key: metadata.Key, Value: metadata.Value, Size: metadata.Size, Hash: metadata.Hash, KeyEpoch: metadata.KeyEpoch})
+	}
+	if err := c.syncBuckets(update, from, indices, peerTreeBuckets, put, tree.Add); err != nil {
 		return err
 	}
 
-	// Collect all peer hashes and determine which are new
-	c.db.MarkAllStale()
-	var hashesToDownload [][]byte
-	var allPeerHashes [][]byte
+	// Delete stale entries
+	staleHashes := c.db.GetStaleHashes()
+	c.deleteStaleEntries(staleHashes)
+	c.recordSync(func(r *SyncRound) { r.EntriesDeleted += len(staleHashes) })
+
+	// Switch to the tree with the peer's bucket count
+	c.merkleTree = tree.Build()
+	c.updateDataHash()
+
+	c.db.ClearSyncProgress()
+	if !bytes.Equal(c.merkleTree.GetRootHash(), expectedHash) {
+		return fmt.Errorf("merkle root mismatch after rebuild")
+	}
+
+	return nil
+}
+
+// syncBuckets fetches the peer's data hashes of bucketIndices a batch at a
+// time, marks them current and stores the entries missing locally with
+// store, downloading their files. seen, if set, gets every peer hash. The
+// other entries of each bucket are left stale. Once a batch is stored its
+// buckets are recorded as completed with their hash in peerTree, so an
+// interrupted sync resumes after them, see resumeSync.
+func (c *Core) syncBuckets(update Update, from peer.ID, bucketIndices []int, peerTree [][]byte, store func(MetadataEntry), seen func(hash []byte)) error {
+	batchSize := c.limits().syncBatchBuckets
+	for start := 0; start < len(bucketIndices); start += batchSize {
+		batch := bucketIndices[start:min(start+batchSize, len(bucketIndices))]
+		peerBucketHashes, err := c.RequestDataBucketHashes(from, batch, update.NumBuckets)
+		if err != nil {
+			return err
+		}
+
+		var hashesToDownload [][]byte // Data entry hashes needing metadata/files
+		for _, bucketIdx := range batch {
+			c.db.MarkBucketStale(bucketIdx, update.NumBuckets)
+			localHashes := c.db.GetBucketHashes(bucketIdx, update.NumBuckets)
+			for _, hash := range peerBucketHashes[bucketIdx] {
+				if seen != nil {
+					seen(hash)
+				}
+				if !containsHash(localHashes, hash) {
+					// New hash - need to download metadata and file
+					hashesToDownload = append(hashesToDownload, hash)
+				}
+				// Mark as current (will be inserted or already exists)
+				c.db.MarkHashCurrent(hash)
+			}
+		}
 
-	for _, bucketIdx := range allIndices {
-		localHashes := c.db.GetBucketHashes(bucketIdx, numBuckets)
-		for _, hash := range peerBucketHashes[bucketIdx] {
-			allPeerHashes = append(allPeerHashes, hash)
-			c.db.MarkHashCurrent(hash)
-			if !containsHash(localHashes, hash) {
-				hashesToDownload = append(hashesToDownload, hash)
+		if err := c.fetchEntries(update, from, c.filterQuarantined(hashesToDownload, from), store); err != nil {
+			return err
+		}
+		for _, bucketIdx := range batch {
+			if bucketIdx < len(peerTree) {
+				c.db.SetSyncBucketDone(bucketIdx, update.NumBuckets, peerTree[bucketIdx])
 			}
 		}
 	}
+	return nil
+}
 
-	// Download metadata and files for new hashes
-	if len(hashesToDownload) > 0 {
-		metadataList, err := c.RequestMetadata(from, hashesToDownload)
+// resumeSync returns the buckets an interrupted full sync of a tree with
+// numBuckets buckets completed, with the peer tree hash each had. Without
+// any a new sync starts, clearing the stale marks of the last one.
+func (c *Core) resumeSync(numBuckets int) map[int][]byte {
+	completed := c.db.GetSyncProgress(numBuckets)
+	if len(completed) == 0 {
+		c.db.ClearSyncProgress()
+		c.db.MarkAllCurrent()
+	}
+	return completed
+}
+
+// bucketCompleted reports whether an interrupted sync completed bucket i and
+// the peer's tree still has the hash it had then
+func bucketCompleted(completed map[int][]byte, peerTree [][]byte, i int) bool {
+	hash, ok := completed[i]
+	return ok && i < len(peerTree) && bytes.Equal(hash, peerTree[i])
+}
+
+// dropSyncProgress forgets an interrupted full sync that a fast-forward
+// moved past, along with its stale marks
+func (c *Core) dropSyncProgress() {
+	if c.db.HasSyncProgress() {
+		c.db.ClearSyncProgress()
+		c.db.MarkAllCurrent()
+	}
+}
+
+// fetchEntries requests the metadata of hashes from the peer a batch at a
+// time and stores each entry with store, downloading its file
+func (c *Core) fetchEntries(update Update, from peer.ID, hashes [][]byte, store func(MetadataEntry)) error {
+	batchSize := c.limits().syncBatchEntries
+	for start := 0; start < len(hashes); start += batchSize {
+		metadataList, err := c.RequestMetadata(from, hashes[start:min(start+batchSize, len(hashes))])
 		if err != nil {
 			return fmt.Errorf("failed to request metadata: %w", err)
 		}
+
 		for _, metadata := range metadataList {
-			c.db.PutData(metadata.Key, metadata.Value, metadata.Size, metadata.Hash)
+			if metadata.KeyEpoch > update.KeyEpoch {
+				fmt.Printf("Warning: skipping entry with key epoch %d newer than update epoch %d\n", metadata.KeyEpoch, update.KeyEpoch)
+				continue
+			}
+			store(metadata)
+			c.recordSync(func(r *SyncRound) { r.EntriesFetched++ })
+
+			// Request file if Value is not nil (folders have nil value)
 			if metadata.Value != nil {
-				if err := c.downloadFile(from, metadata.Value, metadata.Size); err != nil {
+				if err := c.syncFile(from, metadata.Key, metadata.Value, metadata.Size); err != nil {
 					fmt.Printf("Warning: failed to download file: %v\n", err)
 				}
 			}
 		}
 	}
+	return nil
+}
 
-	// Delete stale entries
+// deleteStaleEntries deletes the entries left stale by a sync round. The
+// entries are only read back when someone listens for their removal.
+func (c *Core) deleteStaleEntries(staleHashes [][]byte) {
+	var removed []database.DataEntry
+	if len(staleHashes) > 0 && c.hasSubscribers(EventEntryRemoved) {
+		removed = c.db.GetDataByHashes(staleHashes)
+	}
 	c.db.DeleteStaleEntries()
-
-	// Rebuild merkle tree with peer's bucket count
-	c.merkleTree = crypto.NewMerkleTreeWithBuckets(allPeerHashes, numBuckets)
-	c.updateDataHash()
-
-	if !bytes.Equal(c.merkleTree.GetRootHash(), expectedHash) {
-		return fmt.Errorf("merkle root mismatch after rebuild")
+	for _, entry := range removed {
+		c.emitEntry(EventEntryRemoved, entry)
 	}
-
-	return nil
 }
 
 // Helper to convert PeerUpdate to peer.AddrInfo
-func peerInfoFromPeerUpdate(pu PeerUpdate) peer.AddrInfo {
-	var addrs []multiaddr.Multiaddr
-	for _, addrStr := range pu.Addresses {
-		addr, err := multiaddr.NewMultiaddr(addrStr)
-		if err == nil {
-			addrs = append(addrs, addr)
-		}
+func peerInfoFromPeerUpdate(pu PeerUpdate) (peer.AddrInfo, error) {
+	id, err := p2p.ParsePeerID(pu.PeerID)
+	if err != nil {
+		return peer.AddrInfo{}, fmt.Errorf("invalid peer ID in peer update: %w", err)
+	}
+	addrs, err := p2p.ParsePeerAddrs(pu.Addresses)
+	if err != nil {
+		return peer.AddrInfo{}, fmt.Errorf("invalid addresses for peer %s: %w", id, err)
 	}
-	return peer.AddrInfo{ID: peer.ID(pu.PeerID), Addrs: addrs}
+	return peer.AddrInfo{ID: id, Addrs: addrs}, nil
 }
 
 // RequestPeerList requests the full peer list from a connected peer
@@ -406,16 +625,16 @@ func (c *Core) RequestPeerList(peerID peer.ID) ([]PeerInfoResponse, error) {
 	// Open stream to peer
 	stream, err := c.p2pNode.NewStreamToPeer(
 		peer.ID(peerID),
-		"/endershare/peer-list/1.0",
+		peerListProtocolID,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open stream: %w", err)
 	}
 	defer stream.Close()
 
-	// Read response
+	// Read response, a full list at the p2p limits fits well within the bound
 	var response []PeerInfoResponse
-	decoder := json.NewDecoder(stream)
+	decoder := json.NewDecoder(io.LimitReader(stream, maxPeerListResponseSize))
 	if err := decoder.Decode(&response); err != nil {
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
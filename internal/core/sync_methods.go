@@ -5,14 +5,21 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"time"
 
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/notassigned/endershare/internal/crypto"
+	"github.com/notassigned/endershare/internal/database"
+	"github.com/notassigned/endershare/internal/p2p"
 )
 
+// FILE_STREAM_CHUNK_SIZE is the file stream chunk of the standard profile
 const FILE_STREAM_CHUNK_SIZE = 64 * 1024
 
+// maxRequestSize bounds the bytes read while decoding a request from a peer
+const maxRequestSize = 1 << 20
+
 // Stream handler methods for p2p protocol handlers
 
 // handlePeerListRequest handles requests for the full peer list
@@ -34,8 +41,12 @@ func (c *Core) handlePeerListRequest(s network.Stream) {
 		})
 	}
 
-	encoder := json.NewEncoder(s)
-	encoder.Encode(response)
+	w := c.padWriter(s)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		c.logStreamError(s, "send response", err)
+		return
+	}
+	w.pad()
 }
 
 // handleTreeBucketHashesRequest handles requests for merkle tree bucket hashes
@@ -43,20 +54,29 @@ func (c *Core) handleTreeBucketHashesRequest(s network.Stream) {
 	defer s.Close()
 
 	var req TreeBucketHashesRequest
-	decoder := json.NewDecoder(s)
+	decoder := json.NewDecoder(io.LimitReader(s, maxRequestSize))
 	if err := decoder.Decode(&req); err != nil {
+		c.logStreamError(s, "decode request", err)
 		return
 	}
 	var response [][]byte
-	if c.merkleTree == nil || c.merkleTree.GetNumBuckets() != req.NumBuckets {
+	if c.merkleTree == nil {
+		c.logStreamError(s, "validate request", fmt.Errorf("no merkle tree"))
+		return
+	} else if c.merkleTree.GetNumBuckets() != req.NumBuckets {
 		// Tree structure mismatch
+		c.logStreamError(s, "validate request", fmt.Errorf("tree has %d buckets, peer asked for %d", c.merkleTree.GetNumBuckets(), req.NumBuckets))
 		return
 	} else {
 		response = c.merkleTree.GetBucketHashes()
 	}
 
-	encoder := json.NewEncoder(s)
-	encoder.Encode(response)
+	w := c.padWriter(s)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		c.logStreamError(s, "send response", err)
+		return
+	}
+	w.pad()
 }
 
 // handleDataBucketHashesRequest handles requests for data bucket hashes
@@ -64,30 +84,55 @@ func (c *Core) handleDataBucketHashesRequest(s network.Stream) {
 	defer s.Close()
 
 	var req DataBucketHashesRequest
-	decoder := json.NewDecoder(s)
+	decoder := json.NewDecoder(io.LimitReader(s, maxRequestSize))
 	if err := decoder.Decode(&req); err != nil {
+		c.logStreamError(s, "decode request", err)
 		return
 	}
 
-	// Build response for each requested bucket
-	response := make([]DataBucketHashesResponse, 0, len(req.BucketIndices))
-	for _, bucketIdx := range req.BucketIndices {
-		hashes := c.db.GetBucketHashes(bucketIdx, req.NumBuckets)
-		response = append(response, DataBucketHashesResponse{
-			BucketIndex: bucketIdx,
-			Hashes:      hashes,
-		})
+	// Each bucket is asked for at most once
+	if req.NumBuckets < 1 || len(req.BucketIndices) > req.NumBuckets {
+		c.logStreamError(s, "validate request", fmt.Errorf("%d bucket indices for %d buckets", len(req.BucketIndices), req.NumBuckets))
+		return
 	}
 
-	encoder := json.NewEncoder(s)
-	encoder.Encode(response)
+	// Write the response array a bucket at a time, a peer rebuilding its
+	// tree asks for every bucket of the vault
+	w := c.padWriter(s)
+	encoder := json.NewEncoder(w)
+	if _, err := io.WriteString(w, "["); err != nil {
+		c.logStreamError(s, "send response", err)
+		return
+	}
+	for i, bucketIdx := range req.BucketIndices {
+		if i > 0 {
+			if _, err := io.WriteString(w, ","); err != nil {
+				c.logStreamError(s, "send response", err)
+				return
+			}
+		}
+		resp := DataBucketHashesResponse{
+			BucketIndex: bucketIdx,
+			Hashes:      c.db.GetBucketHashes(bucketIdx, req.NumBuckets),
+		}
+		if err := encoder.Encode(resp); err != nil {
+			c.logStreamError(s, "send response", err)
+			return
+		}
+	}
+	if _, err := io.WriteString(w, "]\n"); err != nil {
+		c.logStreamError(s, "send response", err)
+		return
+	}
+	w.pad()
 }
 
 // handleMetadataRequest handles requests for metadata (key+value) by hash list
 func (c *Core) handleMetadataRequest(s network.Stream) {
 	defer s.Close()
 
-	encoder := json.NewEncoder(s)
+	w := c.padWriter(s)
+	encoder := json.NewEncoder(w)
 	buf := make([]byte, 8192)
 
 	for {
@@ -101,11 +146,13 @@ func (c *Core) handleMetadataRequest(s network.Stream) {
 			// Process partial buffer if we got some data
 		} else if err != nil {
 			// Other error
+			c.logStreamError(s, "read hashes", err)
 			return
 		}
 
 		// Parse hashes from buffer (each hash is 32 bytes)
 		if n%32 != 0 {
+			c.logStreamError(s, "read hashes", fmt.Errorf("%d bytes is not a list of hashes", n))
 			return //invalid data
 		}
 
@@ -123,19 +170,22 @@ func (c *Core) handleMetadataRequest(s network.Stream) {
 		// Check if we got all requested hashes
 		if len(entries) != len(hashes) {
 			// Some hash not found - close stream immediately
+			c.logStreamError(s, "look up entries", fmt.Errorf("%d of %d requested entries not found", len(hashes)-len(entries), len(hashes)))
 			return
 		}
 
 		// Send each entry as individual JSON object
 		for _, entry := range entries {
 			metaEntry := MetadataEntry{
-				Hash:  entry.Hash,
-				Key:   entry.Key,
-				Value: entry.Value,
-				Size:  entry.Size,
+				Hash:     entry.Hash,
+				Key:      entry.Key,
+				Value:    entry.Value,
+				Size:     entry.Size,
+				KeyEpoch: entry.KeyEpoch,
 			}
 
 			if err := encoder.Encode(metaEntry); err != nil {
+				c.logStreamError(s, "send response", err)
 				return
 			}
 		}
@@ -145,6 +195,7 @@ func (c *Core) handleMetadataRequest(s network.Stream) {
 			break
 		}
 	}
+	w.pad()
 }
 
 // handleFileDataRequest handles requests for file data with offset support
@@ -153,24 +204,36 @@ func (c *Core) handleFileDataRequest(s network.Stream) {
 
 	// Decode request
 	var req FileDataRequest
-	decoder := json.NewDecoder(s)
+	decoder := json.NewDecoder(io.LimitReader(s, maxRequestSize))
 	if err := decoder.Decode(&req); err != nil {
+		c.logStreamError(s, "decode request", err)
 		return
 	}
 
 	if c.storage == nil {
+		c.logStreamError(s, "open file", fmt.Errorf("vault key is not available"))
+		return
+	}
+
+	idleTimeout := c.transferIdleTimeout()
+	release, ok := c.acquireUpload(idleTimeout)
+	if !ok {
+		c.logStreamError(s, "open file", fmt.Errorf("all upload slots stayed busy for %v", idleTimeout))
 		return
 	}
+	defer release()
 
 	// Open file for reading
 	file, totalSize, err := c.storage.OpenFileForReading(req.FileHash)
 	if err != nil {
+		c.logStreamError(s, "open file", err)
 		return
 	}
 	defer file.Close()
 
 	// Seek to requested offset
 	if _, err := file.Seek(req.Offset, 0); err != nil {
+		c.logStreamError(s, "open file", err)
 		return
 	}
 
@@ -180,24 +243,27 @@ func (c *Core) handleFileDataRequest(s network.Stream) {
 		remaining = req.Length
 	}
 
-	// Stream file in 64KB chunks
-	buf := make([]byte, FILE_STREAM_CHUNK_SIZE)
+	// Stream file in chunks of the profile's size
+	buf := make([]byte, c.limits().streamChunk)
 
 	for remaining > 0 {
-		toRead := FILE_STREAM_CHUNK_SIZE
+		toRead := len(buf)
 		if int64(toRead) > remaining {
 			toRead = int(remaining)
 		}
 
 		n, err := file.Read(buf[:toRead])
 		if err != nil && err != io.EOF {
+			c.logStreamError(s, "read file", err)
 			return
 		}
 		if n == 0 {
 			break
 		}
 
+		s.SetWriteDeadline(time.Now().Add(idleTimeout))
 		if _, err := s.Write(buf[:n]); err != nil {
+			c.logStreamError(s, "send file", err)
 			return
 		}
 
@@ -207,10 +273,11 @@ func (c *Core) handleFileDataRequest(s network.Stream) {
 
 // MetadataEntry represents a data table entry for protocol response
 type MetadataEntry struct {
-	Hash  []byte `json:"hash"`
-	Key   []byte `json:"key"`
-	Value []byte `json:"value"`
-	Size  int64  `json:"size"`
+	Hash     []byte `json:"hash"`
+	Key      []byte `json:"key"`
+	Value    []byte `json:"value"`
+	Size     int64  `json:"size"`
+	KeyEpoch uint32 `json:"key_epoch,omitempty"`
 }
 
 // PeerInfoResponse represents peer information for protocol response
@@ -248,16 +315,22 @@ type FileDataRequest struct {
 // RequestTreeBucketHashes requests merkle tree bucket hashes from a peer
 func (c *Core) RequestTreeBucketHashes(from peer.ID, numBuckets int) [][]byte {
 	// Open stream to peer
-	stream, err := c.p2pNode.NewStreamToPeer(from, "/endershare/tree-bucket-hashes/1.0")
+	stream, err := c.p2pNode.NewStreamToPeer(from, treeBucketHashesProtocolID)
 	if err != nil {
+		c.logPeerError(from, treeBucketHashesProtocolID, "open stream", err)
 		return [][]byte{}
 	}
 	defer stream.Close()
 
 	// Encode request
 	req := TreeBucketHashesRequest{NumBuckets: numBuckets}
-	encoder := json.NewEncoder(stream)
-	if err := encoder.Encode(req); err != nil {
+	w := c.padWriter(stream)
+	if err := json.NewEncoder(w).Encode(req); err != nil {
+		c.logStreamError(stream, "send request", err)
+		return [][]byte{}
+	}
+	if err := w.pad(); err != nil {
+		c.logStreamError(stream, "send request", err)
 		return [][]byte{}
 	}
 
@@ -265,6 +338,7 @@ func (c *Core) RequestTreeBucketHashes(from peer.ID, numBuckets int) [][]byte {
 	var response [][]byte
 	decoder := json.NewDecoder(stream)
 	if err := decoder.Decode(&response); err != nil {
+		c.logStreamError(stream, "decode response", err)
 		return [][]byte{}
 	}
 
@@ -278,7 +352,7 @@ func (c *Core) RequestDataBucketHashes(from peer.ID, bucketIndices []int, numBuc
 	}
 
 	// Open stream to peer
-	stream, err := c.p2pNode.NewStreamToPeer(from, "/endershare/data-bucket-hashes/1.0")
+	stream, err := c.p2pNode.NewStreamToPeer(from, dataBucketHashesProtocolID)
 	if err != nil {
 		return nil, err
 	}
@@ -289,8 +363,11 @@ func (c *Core) RequestDataBucketHashes(from peer.ID, bucketIndices []int, numBuc
 		BucketIndices: bucketIndices,
 		NumBuckets:    numBuckets,
 	}
-	encoder := json.NewEncoder(stream)
-	if err := encoder.Encode(req); err != nil {
+	w := c.padWriter(stream)
+	if err := json.NewEncoder(w).Encode(req); err != nil {
+		return nil, err
+	}
+	if err := w.pad(); err != nil {
 		return nil, err
 	}
 
@@ -324,7 +401,7 @@ func (c *Core) RequestMetadata(from peer.ID, hashes [][]byte) ([]MetadataEntry,
 	}
 
 	// Open stream to peer
-	stream, err := c.p2pNode.NewStreamToPeer(from, "/endershare/metadata/1.0")
+	stream, err := c.p2pNode.NewStreamToPeer(from, metadataProtocolID)
 	if err != nil {
 		return nil, err
 	}
@@ -355,12 +432,17 @@ func (c *Core) RequestMetadata(from peer.ID, hashes [][]byte) ([]MetadataEntry,
 			return nil, err
 		}
 
-		// Verify hash matches
+		// Verify hash matches; a bad entry is quarantined instead of failing
+		// the whole batch, which would refetch it every sync round
 		computedHash := crypto.ComputeDataHash(entry.Key, entry.Value, entry.Size)
 
 		if !bytes.Equal(computedHash, entry.Hash) {
-			return nil, fmt.Errorf("hash verification failed for entry")
+			if containsHash(hashes, entry.Hash) {
+				c.quarantine(entry.Hash, from, QuarantineMetadata, "metadata does not match entry hash")
+			}
+			continue
 		}
+		c.db.ClearQuarantine(entry.Hash, QuarantineMetadata)
 
 		entries = append(entries, entry)
 	}
@@ -380,10 +462,20 @@ func containsHash(hashes [][]byte, target []byte) bool {
 
 // Data mutation methods that maintain both database and merkle tree
 
-// insertData inserts a data entry and updates the merkle tree
-func (c *Core) insertData(key, value []byte, size int64, hash []byte) error {
-	c.db.PutData(key, value, size, hash)
+// insertData inserts a data entry and updates the merkle tree. An entry that
+// reuses a blob another entry already downloaded, like a renamed file, keeps
+// that download progress.
+func (c *Core) insertData(key, value []byte, size int64, hash []byte, keyEpoch uint32) error {
+	var progress int64
+	if value != nil {
+		progress = c.db.GetDownloadProgress(value)
+	}
+	c.db.PutData(key, value, size, hash, keyEpoch)
+	if progress > 0 {
+		c.db.SetDownloadProgress(value, progress)
+	}
 	c.merkleTree.Insert(hash)
+	c.emitEntry(EventEntryAdded, database.DataEntry{Key: key, Value: value, Size: size, Hash: hash, KeyEpoch: keyEpoch})
 	return nil
 }
 
@@ -391,6 +483,7 @@ func (c *Core) insertData(key, value []byte, size int64, hash []byte) error {
 func (c *Core) deleteData(key, hash []byte) error {
 	c.db.DeleteData(key)
 	c.merkleTree.Delete(hash)
+	c.emitEntry(EventEntryRemoved, database.DataEntry{Key: key, Hash: hash})
 	return nil
 }
 
@@ -399,18 +492,88 @@ func (c *Core) updateDataHash() {
 	c.db.SetDataRootHash(c.merkleTree.GetRootHash())
 }
 
-// downloadFile downloads a file from a peer with resumable support
+// downloadFile downloads a file from a peer, retrying stalled or broken
+// streams and resuming each attempt from the recorded download progress
 func (c *Core) downloadFile(from peer.ID, fileHash []byte, fileSize int64) error {
 	if c.storage == nil {
 		return nil
 	}
+	if c.db.GetDownloadProgress(fileHash) == fileSize {
+		return nil
+	}
+	if c.isQuarantined(fileHash, from, QuarantineBlob) {
+		return fmt.Errorf("%x from %s: %w", fileHash[:8], from, ErrQuarantined)
+	}
+	if err := c.checkDownloadPolicy(fileHash, fileSize); err != nil {
+		return err
+	}
 
+	// Prefer a LAN peer over the announcing peer when it is further away.
+	// Replicas usually hold every blob, and one that keeps it as a
+	// placeholder fails the attempt, leaving the transfer to the announcer.
+	started := time.Now()
+	var err error
+	if c.p2pNode.GetPeerPath(from.String()) != p2p.PathLAN {
+		for _, source := range c.p2pNode.LANPeers() {
+			if source == from || c.isQuarantined(fileHash, source, QuarantineBlob) {
+				continue
+			}
+			if err = c.downloadFileAttempt(source, fileHash, fileSize); err == nil {
+				return c.finishDownload(source, fileHash, fileSize, started)
+			}
+		}
+	}
+
+	for attempt := 1; attempt <= maxTransferAttempts; attempt++ {
+		err = c.downloadFileAttempt(from, fileHash, fileSize)
+		if err == nil {
+			break
+		}
+		c.logPeerError(from, fileDataProtocolID, "transfer", err)
+		if attempt < maxTransferAttempts {
+			progress := c.db.GetDownloadProgress(fileHash)
+			fmt.Printf("Transfer of %x interrupted at %d/%d bytes (%v), retrying\n", fileHash[:8], progress, fileSize, err)
+			time.Sleep(time.Duration(attempt) * transferRetryBackoff)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return c.finishDownload(from, fileHash, fileSize, started)
+}
+
+// finishDownload marks a download complete, verifies the blob hash and
+// sends a receipt for the outcome to the peer that served the last bytes
+func (c *Core) finishDownload(server peer.ID, fileHash []byte, fileSize int64, started time.Time) error {
+	if err := c.db.SetDownloadProgress(fileHash, fileSize); err != nil {
+		return err
+	}
+
+	//Verify downloaded file hash matches and remove the file if invalid
+	err := c.storage.ValidateOrRemoveFile(fileHash)
+	if err != nil {
+		c.db.SetDownloadProgress(fileHash, 0)
+		c.issueReceipt(server, fileHash, fileSize, started, false)
+		c.quarantine(fileHash, server, QuarantineBlob, err.Error())
+		return err
+	}
+	c.issueReceipt(server, fileHash, fileSize, started, true)
+	c.db.ClearQuarantine(fileHash, QuarantineBlob)
+	c.recordSync(func(r *SyncRound) { r.FilesDownloaded++ })
+	c.emit(Event{Type: EventDownloadFinished, PeerID: server.String(), FileHash: fileHash, Size: fileSize})
+	return nil
+}
+
+// downloadFileAttempt streams the rest of a file from the recorded progress.
+// Received bytes are persisted even when the stream dies so the next attempt
+// continues where this one stopped.
+func (c *Core) downloadFileAttempt(from peer.ID, fileHash []byte, fileSize int64) error {
 	offset := c.db.GetDownloadProgress(fileHash)
 	if offset == fileSize {
 		return nil
 	}
 
-	stream, err := c.p2pNode.NewStreamToPeer(from, "/endershare/file-data/1.0")
+	stream, err := c.p2pNode.NewStreamToPeer(from, fileDataProtocolID)
 	if err != nil {
 		return err
 	}
@@ -427,16 +590,32 @@ func (c *Core) downloadFile(from peer.ID, fileHash []byte, fileSize int64) error
 		return err
 	}
 
-	const WRITE_BUFFER_SIZE = 20 * 1024 * 1024
-	buffer := make([]byte, 0, WRITE_BUFFER_SIZE)
-	chunk := make([]byte, FILE_STREAM_CHUNK_SIZE)
+	idleTimeout := c.transferIdleTimeout()
+
+	limits := c.limits()
+	buffer := make([]byte, 0, limits.writeBuffer)
+	chunk := make([]byte, limits.streamChunk)
 	totalWritten := int64(0)
 	eof := false
 
-	for totalWritten < req.Length {
+	flush := func() error {
+		if len(buffer) == 0 {
+			return nil
+		}
+		if err := c.storage.AppendFileData(fileHash, buffer); err != nil {
+			return err
+		}
+		totalWritten += int64(len(buffer))
+		moved := int64(len(buffer))
+		c.recordSync(func(r *SyncRound) { r.BytesMoved += moved })
 		buffer = buffer[:0] // Reuse buffer capacity
+		return c.db.SetDownloadProgress(fileHash, offset+totalWritten)
+	}
 
-		for len(buffer) < WRITE_BUFFER_SIZE && totalWritten+int64(len(buffer)) < req.Length && !eof {
+	for totalWritten < req.Length {
+		for len(buffer) < limits.writeBuffer && totalWritten+int64(len(buffer)) < req.Length && !eof {
+			// A stalled peer fails the read instead of hanging the transfer
+			stream.SetReadDeadline(time.Now().Add(idleTimeout))
 			n, err := stream.Read(chunk)
 			if n > 0 {
 				buffer = append(buffer, chunk[:n]...)
@@ -446,6 +625,9 @@ func (c *Core) downloadFile(from peer.ID, fileHash []byte, fileSize int64) error
 					eof = true
 					break
 				}
+				if flushErr := flush(); flushErr != nil {
+					return flushErr
+				}
 				return err
 			}
 		}
@@ -454,13 +636,7 @@ func (c *Core) downloadFile(from peer.ID, fileHash []byte, fileSize int64) error
 			break
 		}
 
-		if err := c.storage.AppendFileData(fileHash, buffer); err != nil {
-			return err
-		}
-
-		totalWritten += int64(len(buffer))
-
-		if err := c.db.SetDownloadProgress(fileHash, offset+totalWritten); err != nil {
+		if err := flush(); err != nil {
 			return err
 		}
 	}
@@ -468,15 +644,5 @@ func (c *Core) downloadFile(from peer.ID, fileHash []byte, fileSize int64) error
 	if totalWritten != req.Length {
 		return fmt.Errorf("incomplete download: expected %d bytes, got %d", req.Length, totalWritten)
 	}
-
-	if err := c.db.SetDownloadProgress(fileHash, fileSize); err != nil {
-		return err
-	}
-
-	//Verify downloaded file hash matches and remove the file if invalid
-	err = c.storage.ValidateOrRemoveFile(fileHash)
-	if err != nil {
-		c.db.SetDownloadProgress(fileHash, 0)
-	}
-	return err
+	return nil
 }
@@ -0,0 +1,115 @@
+package core
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// Reconciliation modes of a sync round
+const (
+	SyncModeFastForward = "fast-forward"
+	SyncModeDiff        = "diff"
+	SyncModeRebuild     = "rebuild"
+)
+
+// syncRoundHistory is how many recent rounds are kept for inspection
+const syncRoundHistory = 50
+
+// SyncRound records what one data reconciliation round did
+type SyncRound struct {
+	UpdateID         uint64        `json:"update_id"`
+	Peer             string        `json:"peer"`
+	Mode             string        `json:"mode"`
+	Started          time.Time     `json:"started"`
+	Duration         time.Duration `json:"duration"`
+	BucketsCompared  int           `json:"buckets_compared"`
+	BucketsDiffering int           `json:"buckets_differing"`
+	BucketsResumed   int           `json:"buckets_resumed,omitempty"` // Completed by an interrupted round
+	EntriesFetched   int           `json:"entries_fetched"`
+	EntriesDeleted   int           `json:"entries_deleted"`
+	FilesDownloaded  int           `json:"files_downloaded"`
+	BytesMoved       int64         `json:"bytes_moved"`
+	Error            string        `json:"error,omitempty"`
+}
+
+// syncRoundLog keeps the most recent sync rounds and the one in progress
+type syncRoundLog struct {
+	mu     sync.Mutex
+	active *SyncRound
+	rounds []SyncRound
+}
+
+// beginSyncRound starts recording a round; the returned function completes it
+func (c *Core) beginSyncRound(update Update, from peer.ID, mode string) func(err error) {
+	round := &SyncRound{
+		UpdateID: update.UpdateID,
+		Peer:     from.String(),
+		Mode:     mode,
+		Started:  time.Now(),
+	}
+
+	c.syncRounds.mu.Lock()
+	c.syncRounds.active = round
+	c.syncRounds.mu.Unlock()
+
+	return func(err error) {
+		c.syncRounds.mu.Lock()
+		round.Duration = time.Since(round.Started)
+		if err != nil {
+			round.Error = err.Error()
+		}
+		c.syncRounds.active = nil
+		c.syncRounds.rounds = append(c.syncRounds.rounds, *round)
+		if len(c.syncRounds.rounds) > syncRoundHistory {
+			c.syncRounds.rounds = c.syncRounds.rounds[len(c.syncRounds.rounds)-syncRoundHistory:]
+		}
+		finished := *round
+		c.syncRounds.mu.Unlock()
+
+		fmt.Printf("Sync round %d (%s) from %s: %d/%d buckets differ, %d entries fetched, %d deleted, %d files, %d bytes in %s\n",
+			finished.UpdateID, finished.Mode, from, finished.BucketsDiffering, finished.BucketsCompared,
+			finished.EntriesFetched, finished.EntriesDeleted, finished.FilesDownloaded, finished.BytesMoved,
+			finished.Duration.Round(time.Millisecond))
+		if finished.BucketsResumed > 0 {
+			fmt.Printf("Sync round %d resumed an interrupted round, %d buckets were completed already\n", finished.UpdateID, finished.BucketsResumed)
+		}
+		if finished.Error != "" {
+			fmt.Println("Sync round failed:", finished.Error)
+		}
+
+		if c.OnSyncRound != nil {
+			c.OnSyncRound(finished)
+		}
+	}
+}
+
+// recordSync applies fn to the round in progress, if any
+func (c *Core) recordSync(fn func(round *SyncRound)) {
+	c.syncRounds.mu.Lock()
+	defer c.syncRounds.mu.Unlock()
+	if c.syncRounds.active != nil {
+		fn(c.syncRounds.active)
+	}
+}
+
+// GetSyncRounds returns the most recent sync rounds, oldest first
+func (c *Core) GetSyncRounds() []SyncRound {
+	c.syncRounds.mu.Lock()
+	defer c.syncRounds.mu.Unlock()
+	rounds := make([]SyncRound, len(c.syncRounds.rounds))
+	copy(rounds, c.syncRounds.rounds)
+	return rounds
+}
+
+// ActiveSyncRound returns the round in progress, false if there is none
+func (c *Core) ActiveSyncRound() (SyncRound, bool) {
+	c.syncRounds.mu.Lock()
+	defer c.syncRounds.mu.Unlock()
+	if c.syncRounds.active == nil {
+		return SyncRound{}, false
+	}
+	return *c.syncRounds.active, true
+}
@@ -0,0 +1,27 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd)
+
+package core
+
+import (
+	"errors"
+	"os"
+)
+
+// terminal is unavailable here, the TUI needs a Unix terminal
+type terminal struct {
+	*os.File
+}
+
+var errNoTerminal = errors.New("the TUI needs a Unix terminal, use the desktop app or the CLI commands here")
+
+func openTerminal() (*terminal, error) {
+	return nil, errNoTerminal
+}
+
+func redirectOutput(f *os.File) (*os.File, error) {
+	return nil, errNoTerminal
+}
+
+func (t *terminal) size() (width, height int) {
+	return 80, 24
+}
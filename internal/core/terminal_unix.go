@@ -0,0 +1,78 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+
+package core
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// terminal is the controlling terminal put in raw mode for the TUI: keys
+// arrive one at a time without echo and the screen is drawn on the
+// alternate buffer, so the shell's scrollback is left as it was
+type terminal struct {
+	*os.File
+	saved unix.Termios
+}
+
+// openTerminal opens the controlling terminal and switches it to raw mode
+func openTerminal() (*terminal, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("no terminal to draw on: %w", err)
+	}
+	saved, err := unix.IoctlGetTermios(int(tty.Fd()), ioctlReadTermios)
+	if err != nil {
+		tty.Close()
+		return nil, fmt.Errorf("%s is not a terminal: %w", tty.Name(), err)
+	}
+
+	// Output processing stays on so lines still end with a plain newline
+	raw := *saved
+	raw.Iflag &^= unix.ICRNL | unix.IXON | unix.ISTRIP | unix.BRKINT | unix.INPCK
+	raw.Lflag &^= unix.ECHO | unix.ICANON | unix.ISIG | unix.IEXTEN
+	raw.Cc[unix.VMIN] = 1
+	raw.Cc[unix.VTIME] = 0
+	if err := unix.IoctlSetTermios(int(tty.Fd()), ioctlWriteTermios, &raw); err != nil {
+		tty.Close()
+		return nil, err
+	}
+
+	t := &terminal{File: tty, saved: *saved}
+	t.WriteString("\x1b[?1049h\x1b[?25l") // Alternate screen, hidden cursor
+	return t, nil
+}
+
+// redirectOutput points stdout and stderr at f, so the node's output doesn't
+// draw over the TUI, and returns the original stdout for messages after it
+func redirectOutput(f *os.File) (*os.File, error) {
+	fd, err := unix.Dup(int(os.Stdout.Fd()))
+	if err != nil {
+		return nil, err
+	}
+	for _, target := range []int{int(os.Stdout.Fd()), int(os.Stderr.Fd())} {
+		if err := unix.Dup2(int(f.Fd()), target); err != nil {
+			unix.Close(fd)
+			return nil, err
+		}
+	}
+	return os.NewFile(uintptr(fd), "/dev/stdout"), nil
+}
+
+// size returns the terminal's width and height, 80x24 if it can't tell
+func (t *terminal) size() (width, height int) {
+	ws, err := unix.IoctlGetWinsize(int(t.Fd()), unix.TIOCGWINSZ)
+	if err != nil || ws.Col == 0 || ws.Row == 0 {
+		return 80, 24
+	}
+	return int(ws.Col), int(ws.Row)
+}
+
+// Close restores the screen and the terminal mode found by openTerminal
+func (t *terminal) Close() error {
+	t.WriteString("\x1b[?25h\x1b[?1049l")
+	unix.IoctlSetTermios(int(t.Fd()), ioctlWriteTermios, &t.saved)
+	return t.File.Close()
+}
@@ -0,0 +1,146 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/notassigned/endershare/internal/api"
+	"github.com/notassigned/endershare/internal/database"
+	"github.com/notassigned/endershare/internal/storage"
+)
+
+// TokenMain (CLI only) issues, lists and revokes API capability tokens
+func TokenMain(args []string) {
+	if len(args) == 0 {
+		tokenUsage()
+		os.Exit(1)
+	}
+
+	db := database.Create()
+
+	switch args[0] {
+	case "issue":
+		if len(args) < 2 {
+			fmt.Println("Error: token issue requires a name")
+			os.Exit(1)
+		}
+		name := args[1]
+		var scope api.Scope
+		var folder storage.FolderID
+		var ttl time.Duration
+		for i := 2; i < len(args); i += 2 {
+			flag := args[i]
+			if flag != "--scope" && flag != "--folder" && flag != "--ttl" {
+				fmt.Println("Unknown option:", flag)
+				os.Exit(1)
+			}
+			if i+1 == len(args) {
+				fmt.Println("Error:", flag, "requires a value")
+				tokenUsage()
+				os.Exit(1)
+			}
+			value := args[i+1]
+			switch flag {
+			case "--scope":
+				s, ok := api.ParseScope(value)
+				if !ok {
+					fmt.Println("Error: scope must be read, upload or admin")
+					os.Exit(1)
+				}
+				scope = s
+			case "--folder":
+				folder = storage.FolderID(value)
+			case "--ttl":
+				d, err := time.ParseDuration(value)
+				if err != nil || d < 0 {
+					fmt.Println("Error: invalid ttl:", value)
+					os.Exit(1)
+				}
+				ttl = d
+			}
+		}
+		if scope == "" {
+			fmt.Println("Error: --scope is required")
+			os.Exit(1)
+		}
+
+		token, info, err := api.IssueToken(db, name, scope, folder, ttl)
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		fmt.Println("Issued token", info.ID, "for", info.Name)
+		fmt.Println("Token (shown once):", token)
+
+	case "list":
+		tokens := api.ListTokens(db)
+		if len(tokens) == 0 {
+			fmt.Println("No tokens issued")
+			return
+		}
+		for _, t := range tokens {
+			line := fmt.Sprintf("%s  %-8s %-6s", t.ID, t.Name, t.Scope)
+			if t.Folder != "" {
+				line += " folder=" + string(t.Folder)
+			}
+			if t.Expires.IsZero() {
+				line += " never expires"
+			} else if time.Now().After(t.Expires) {
+				line += " expired " + t.Expires.Format(time.RFC3339)
+			} else {
+				line += " expires " + t.Expires.Format(time.RFC3339)
+			}
+			fmt.Println(line)
+		}
+
+	case "revoke":
+		if len(args) < 2 {
+			fmt.Println("Error: token revoke requires an id")
+			os.Exit(1)
+		}
+		if err := api.RevokeToken(db, args[1]); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		fmt.Println("Token revoked")
+
+	default:
+		fmt.Println("Unknown token command:", args[0])
+		os.Exit(1)
+	}
+}
+
+// tokenUsage prints the token subcommands
+func tokenUsage() {
+	fmt.Println("Usage:")
+	fmt.Println("  endershare token issue <name> --scope read|upload|admin [--folder id] [--ttl duration]")
+	fmt.Println("  endershare token list")
+	fmt.Println("  endershare token revoke <id>")
+}
+
+// startAPIDaemon serves the token API from the running node. Uploads and
+// deletes are published, and refused on replicas and while the vault is frozen.
+func (c *Core) startAPIDaemon(addr string) {
+	if c.storage == nil {
+		fmt.Println("Warning: Token API needs the vault key, not starting it")
+		return
+	}
+	daemon, err := api.StartDaemon(c.db, c.storage, addr, c.IsMaster, c.CheckWritable, func(removed, added *database.DataEntry) {
+		var err error
+		if removed == nil {
+			err = c.PublishDataUpdate("ADD", added.Key, added.Value, added.Size, added.Hash, nil)
+		} else {
+			err = c.PublishModifyUpdate(removed, added, nil)
+		}
+		if err != nil {
+			fmt.Println("Warning: Failed to publish data update:", err)
+		}
+	})
+	if err != nil {
+		fmt.Println("Warning: Failed to start token API:", err)
+		return
+	}
+	fmt.Println("Token API listening at", daemon.URL)
+	fmt.Println("Certificate fingerprint (SHA-256):", daemon.Fingerprint)
+}
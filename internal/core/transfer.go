@@ -0,0 +1,38 @@
+package core
+
+import (
+	"time"
+
+	"github.com/notassigned/endershare/internal/database"
+	"github.com/notassigned/endershare/internal/p2p"
+	"github.com/notassigned/endershare/internal/storage"
+)
+
+const (
+	// defaultTransferIdleTimeout fails a file stream that moves no bytes for this long
+	defaultTransferIdleTimeout = 30 * time.Second
+	// maxTransferAttempts bounds how often one download is resumed before giving up
+	maxTransferAttempts  = 5
+	transferRetryBackoff = 2 * time.Second
+)
+
+// transportOptions returns the transport settings for this node's resource
+// profile and configured keepalive
+func transportOptions(db *database.EndershareDB) p2p.TransportOptions {
+	opts := p2p.DefaultTransportOptions()
+	if storage.LowResource(db) {
+		opts = p2p.LowResourceTransportOptions()
+	}
+	if d := db.GetKeepAliveInterval(); d > 0 {
+		opts.KeepAliveInterval = d
+	}
+	return opts
+}
+
+// transferIdleTimeout returns how long a file stream may stall
+func (c *Core) transferIdleTimeout() time.Duration {
+	if d := c.db.GetTransferIdleTimeout(); d > 0 {
+		return d
+	}
+	return defaultTransferIdleTimeout
+}
@@ -0,0 +1,46 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/notassigned/endershare/internal/storage"
+)
+
+// trashPurgeInterval is how often the master deletes trash past its retention
+const trashPurgeInterval = time.Hour
+
+// purgeExpiredTrash deletes trash past its retention and publishes the deletions
+func (c *Core) purgeExpiredTrash() error {
+	// Expired trash waits for the vault to be unfrozen
+	if c.GetFreeze().Frozen {
+		return nil
+	}
+	deleted, err := c.storage.PurgeExpiredTrash(storage.TrashRetention(c.db))
+	for _, entry := range deleted {
+		if err := c.PublishDataUpdate("DELETE", entry.Key, entry.Value, entry.Size, entry.Hash, nil); err != nil {
+			fmt.Println("Warning: Failed to publish data update:", err)
+		}
+	}
+	if len(deleted) > 0 {
+		fmt.Printf("Deleted %d expired trash entries\n", len(deleted))
+	}
+	return err
+}
+
+// runTrashPurge deletes expired trash now and then periodically (master only)
+func (c *Core) runTrashPurge(ctx context.Context) {
+	t := time.NewTicker(trashPurgeInterval)
+	defer t.Stop()
+	for {
+		if err := c.purgeExpiredTrash(); err != nil {
+			fmt.Println("Warning: failed to purge expired trash:", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,614 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/notassigned/endershare/internal/database"
+	"github.com/notassigned/endershare/internal/storage"
+)
+
+// The TUI runs a node like endershare peer and shows it in the terminal, for
+// headless machines where the desktop app can't run. It follows the
+// model/update/view pattern of bubbletea: tuiModel holds all state, update
+// changes it for one message at a time (a key, a tick or a Core event) and
+// render draws it. Slow work such as exports runs as a command whose result
+// comes back as another message.
+
+const (
+	tuiRefresh         = time.Second          // How often the status is read again
+	tuiRecentTransfers = 8                    // Finished downloads kept for the status view
+	tuiLogFile         = "endershare-tui.log" // Receives the node's output while the TUI runs
+)
+
+type tuiView int
+
+const (
+	tuiStatusView tuiView = iota
+	tuiBrowseView
+)
+
+// tuiKey is a key pressed: "up", "down", "left", "right", "pgup", "pgdown",
+// "home", "end", "enter", "backspace", "tab", "esc", "ctrl+c" or the
+// character typed
+type tuiKey string
+
+type tuiTick struct{}
+
+// tuiExportDone is the result of an export command
+type tuiExportDone struct {
+	name string
+	dest string
+	err  error
+}
+
+// tuiTransfer is a finished download shown in the status view
+type tuiTransfer struct {
+	time time.Time
+	name string
+	size int64
+	peer string
+}
+
+// tuiCrumb is a folder on the path to the one being browsed
+type tuiCrumb struct {
+	id   storage.FolderID
+	name string
+}
+
+type tuiModel struct {
+	core          *Core
+	view          tuiView
+	width, height int
+
+	// Status view
+	status    NodeStatus
+	active    *SyncRound
+	lastRound *SyncRound
+	transfers []tuiTransfer
+
+	// Browse view
+	path   []tuiCrumb // Root first, the folder browsed last
+	items  []interface{}
+	cursor int
+	offset int  // First item shown
+	stale  bool // Entries changed since the listing was read
+
+	prompt    bool   // Typing the export destination
+	input     string // Export destination typed so far
+	exporting bool
+	message   string // Result of the last action, shown above the key help
+	quit      bool
+}
+
+// TuiMain (CLI only) starts the node and shows its sync status, peers and
+// transfers in the terminal, with a folder browser that exports to local
+// disk. The node's own output goes to endershare-tui.log.
+func TuiMain(args []string) {
+	if len(args) > 0 {
+		fmt.Println("Usage: endershare tui")
+		os.Exit(1)
+	}
+
+	db := database.Create()
+	bound := getMasterPubKey(db) != nil
+	db.Close()
+	if !bound {
+		fmt.Println("Error: This node isn't part of a vault yet, bind it with endershare peer first")
+		os.Exit(1)
+	}
+
+	logFile, err := os.OpenFile(tuiLogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	fmt.Println("Starting node, its output goes to", tuiLogFile)
+	console, err := redirectOutput(logFile)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+
+	c := coreStartup(false)
+	c.serve()
+	go func() {
+		for {
+			c.RequestLatestUpdate()
+			time.Sleep(c.jittered(time.Second * 15))
+		}
+	}()
+
+	if err := runTUI(c); err != nil {
+		fmt.Fprintln(console, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+// runTUI draws the node on the terminal until the user quits
+func runTUI(c *Core) error {
+	term, err := openTerminal()
+	if err != nil {
+		return err
+	}
+	defer term.Close()
+
+	msgs := make(chan any, 16)
+	go readKeys(term, msgs)
+	cancel := c.Subscribe(func(e Event) { msgs <- e }, EventDownloadFinished, EventUpdateApplied, EventEntryAdded, EventEntryRemoved, EventSubtreeMoved)
+	defer cancel()
+	ticker := time.NewTicker(tuiRefresh)
+	defer ticker.Stop()
+
+	m := &tuiModel{core: c, path: []tuiCrumb{{id: storage.RootFolderID, name: ""}}}
+	m.refreshStatus()
+	m.loadFolder()
+	for !m.quit {
+		m.width, m.height = term.size()
+		term.WriteString(m.render())
+
+		var msg any
+		select {
+		case msg = <-msgs:
+		case <-ticker.C:
+			msg = tuiTick{}
+		}
+		if cmd := m.update(msg); cmd != nil {
+			go func() { msgs <- cmd() }()
+		}
+	}
+	return nil
+}
+
+// readKeys turns the bytes read from the terminal into tuiKey messages
+func readKeys(term *terminal, msgs chan<- any) {
+	sequences := map[string]tuiKey{
+		"\x1b[A": "up", "\x1b[B": "down", "\x1b[C": "right", "\x1b[D": "left",
+		"\x1b[5~": "pgup", "\x1b[6~": "pgdown",
+		"\x1b[H": "home", "\x1b[1~": "home", "\x1b[F": "end", "\x1b[4~": "end",
+	}
+	buf := make([]byte, 64)
+	for {
+		n, err := term.Read(buf)
+		if err != nil {
+			return
+		}
+		in := string(buf[:n])
+		for in != "" {
+			var key tuiKey
+			size := 1
+			switch in[0] {
+			case 0x1b:
+				key = "esc"
+				for seq, k := range sequences {
+					if strings.HasPrefix(in, seq) {
+						key, size = k, len(seq)
+						break
+					}
+				}
+			case 0x03:
+				key = "ctrl+c"
+			case '\r', '\n':
+				key = "enter"
+			case 0x7f, 0x08:
+				key = "backspace"
+			case '\t':
+				key = "tab"
+			default:
+				r, n := utf8.DecodeRuneInString(in)
+				size = n
+				if r >= ' ' {
+					key = tuiKey(string(r))
+				}
+			}
+			in = in[size:]
+			if key != "" {
+				msgs <- key
+			}
+		}
+	}
+}
+
+func (m *tuiModel) update(msg any) func() any {
+	switch msg := msg.(type) {
+	case tuiTick:
+		m.refreshStatus()
+		if m.stale {
+			m.loadFolder()
+		}
+	case Event:
+		switch msg.Type {
+		case EventDownloadFinished:
+			m.addTransfer(msg)
+		case EventUpdateApplied:
+			m.refreshStatus()
+		default:
+			m.stale = true
+		}
+	case tuiExportDone:
+		m.exporting = false
+		if msg.err != nil {
+			m.message = fmt.Sprintf("Export of %s failed: %v", msg.name, msg.err)
+		} else {
+			m.message = fmt.Sprintf("Exported %s to %s", msg.name, msg.dest)
+		}
+	case tuiKey:
+		return m.handleKey(string(msg))
+	}
+	return nil
+}
+
+func (m *tuiModel) handleKey(key string) func() any {
+	if m.prompt {
+		switch key {
+		case "enter":
+			m.prompt = false
+			return m.export(m.input)
+		case "esc", "ctrl+c":
+			m.prompt = false
+		case "backspace":
+			_, size := utf8.DecodeLastRuneInString(m.input)
+			m.input = m.input[:len(m.input)-size]
+		default:
+			if utf8.RuneCountInString(key) == 1 {
+				m.input += key
+			}
+		}
+		return nil
+	}
+
+	switch key {
+	case "q", "ctrl+c":
+		m.quit = true
+	case "tab":
+		m.view = 1 - m.view
+	case "1":
+		m.view = tuiStatusView
+	case "2":
+		m.view = tuiBrowseView
+	case "r":
+		m.refreshStatus()
+		m.loadFolder()
+	}
+	if m.view != tuiBrowseView || m.core.storage == nil {
+		return nil
+	}
+
+	switch key {
+	case "up", "k":
+		m.cursor--
+	case "down", "j":
+		m.cursor++
+	case "pgup":
+		m.cursor -= m.listHeight()
+	case "pgdown":
+		m.cursor += m.listHeight()
+	case "home":
+		m.cursor = 0
+	case "end":
+		m.cursor = len(m.items) - 1
+	case "enter", "right", "l":
+		if folder, ok := m.selected().(storage.FolderEntry); ok {
+			m.path = append(m.path, tuiCrumb{id: folder.FolderID, name: folder.Name})
+			m.cursor, m.offset = 0, 0
+			m.loadFolder()
+		}
+	case "backspace", "left", "h":
+		if len(m.path) > 1 {
+			m.path = m.path[:len(m.path)-1]
+			m.cursor, m.offset = 0, 0
+			m.loadFolder()
+		}
+	case "e":
+		if m.exporting {
+			m.message = "An export is already running"
+			break
+		}
+		name := m.selectedName()
+		if name == "" {
+			break
+		}
+		cwd, _ := os.Getwd()
+		m.prompt, m.input = true, filepath.Join(cwd, storage.LocalName(name))
+	}
+	m.cursor = max(0, min(m.cursor, len(m.items)-1))
+	return nil
+}
+
+// export returns the command exporting the selected file or folder to dest
+func (m *tuiModel) export(dest string) func() any {
+	dest = strings.TrimSpace(dest)
+	if dest == "" {
+		return nil
+	}
+	stor := m.core.storage
+	name := m.selectedName()
+	var run func() error
+	switch e := m.selected().(type) {
+	case storage.FileEntry:
+		folderID := m.path[len(m.path)-1].id
+		run = func() error { return stor.GetFile(e.Name, folderID, dest) }
+	case storage.FolderEntry:
+		run = func() error { return stor.ExportFolderToPath(e.FolderID, dest) }
+	default:
+		return nil
+	}
+	m.exporting = true
+	m.message = fmt.Sprintf("Exporting %s to %s...", name, dest)
+	return func() any {
+		return tuiExportDone{name: name, dest: dest, err: run()}
+	}
+}
+
+func (m *tuiModel) selected() interface{} {
+	if m.cursor < 0 || m.cursor >= len(m.items) {
+		return nil
+	}
+	return m.items[m.cursor]
+}
+
+func (m *tuiModel) selectedName() string {
+	switch e := m.selected().(type) {
+	case storage.FileEntry:
+		return e.Name
+	case storage.FolderEntry:
+		return e.Name
+	}
+	return ""
+}
+
+func (m *tuiModel) refreshStatus() {
+	m.status = m.core.Status()
+	m.active, m.lastRound = nil, nil
+	if round, ok := m.core.ActiveSyncRound(); ok {
+		m.active = &round
+	}
+	if rounds := m.core.GetSyncRounds(); len(rounds) > 0 {
+		m.lastRound = &rounds[len(rounds)-1]
+	}
+}
+
+func (m *tuiModel) loadFolder() {
+	m.stale = false
+	if m.core.storage == nil {
+		return
+	}
+	items, err := m.core.storage.ListFolder(m.path[len(m.path)-1].id)
+	if err != nil {
+		m.message = "Failed to list folder: " + err.Error()
+		return
+	}
+	m.items = items
+	m.cursor = max(0, min(m.cursor, len(m.items)-1))
+}
+
+func (m *tuiModel) addTransfer(e Event) {
+	t := tuiTransfer{time: e.Time, size: e.Size, peer: e.PeerID, name: fmt.Sprintf("%x", e.FileHash)}
+	if m.core.storage != nil {
+		if name, ok := m.core.storage.BlobName(e.FileHash); ok {
+			t.name = name
+		}
+	}
+	m.transfers = append([]tuiTransfer{t}, m.transfers...)
+	if len(m.transfers) > tuiRecentTransfers {
+		m.transfers = m.transfers[:tuiRecentTransfers]
+	}
+}
+
+// listHeight is how many folder entries fit on the screen
+func (m *tuiModel) listHeight() int {
+	return max(1, m.height-6)
+}
+
+// render draws the whole screen, overwriting the previous frame in place
+func (m *tuiModel) render() string {
+	var lines []string
+	role := "replica"
+	if m.core.IsMaster() {
+		role = "master"
+	}
+	tabs := []string{"1 Status", "2 Browse"}
+	tabs[m.view] = "\x1b[7m " + tabs[m.view] + " \x1b[0m"
+	lines = append(lines, fmt.Sprintf("\x1b[1mendershare\x1b[0m %s %s   %s", role, shortPeerID(m.core.GetNodeID()), strings.Join(tabs, "  ")), "")
+
+	if m.view == tuiStatusView {
+		lines = append(lines, m.statusLines()...)
+	} else {
+		lines = append(lines, m.browseLines()...)
+	}
+
+	// Keep the footer on the last two rows
+	body := max(0, m.height-2)
+	if len(lines) > body {
+		lines = lines[:body]
+	}
+	for len(lines) < body {
+		lines = append(lines, "")
+	}
+	lines = append(lines, m.message, m.help())
+
+	var b strings.Builder
+	b.WriteString("\x1b[H")
+	for i, line := range lines {
+		b.WriteString(truncate(line, m.width))
+		b.WriteString("\x1b[K")
+		if i < len(lines)-1 {
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+func (m *tuiModel) statusLines() []string {
+	s := m.status
+	lines := []string{"\x1b[1mSync\x1b[0m"}
+	if s.LastUpdateID > 0 {
+		lines = append(lines, fmt.Sprintf("  Last update   #%d %s, %s", s.LastUpdateID, s.LastUpdateType, ago(s.LastUpdateTime)))
+	} else {
+		lines = append(lines, "  Last update   none")
+	}
+	replication := fmt.Sprintf("  Replication   %d/%d files, %s of %s", s.FilesComplete, s.FilesTotal, formatBytes(s.BytesStored), formatBytes(s.BytesReferenced))
+	if s.BytesReferenced > 0 {
+		replication += fmt.Sprintf(" (%d%%)", s.BytesStored*100/s.BytesReferenced)
+	}
+	lines = append(lines, replication)
+	if r := m.active; r != nil {
+		lines = append(lines, fmt.Sprintf("  Syncing       %s #%d from %s, %d entries, %d files, %s so far",
+			r.Mode, r.UpdateID, shortPeerID(r.Peer), r.EntriesFetched, r.FilesDownloaded, formatBytes(r.BytesMoved)))
+	} else {
+		lines = append(lines, "  Syncing       idle")
+	}
+	if r := m.lastRound; r != nil {
+		line := fmt.Sprintf("  Last round    %s #%d from %s %s, %d entries, %d deleted, %d files in %s",
+			r.Mode, r.UpdateID, shortPeerID(r.Peer), ago(r.Started), r.EntriesFetched, r.EntriesDeleted, r.FilesDownloaded, r.Duration.Round(time.Millisecond))
+		if r.Error != "" {
+			line += ", failed: " + r.Error
+		}
+		lines = append(lines, line)
+	}
+	if s.Freeze.Frozen {
+		lines = append(lines, fmt.Sprintf("  Frozen        since %s %s", time.Unix(s.Freeze.Since, 0).Format(time.DateTime), s.Freeze.Reason))
+	}
+	if s.Quarantined > 0 || s.CorruptBlobs > 0 {
+		lines = append(lines, fmt.Sprintf("  Problems      %d quarantined, %d corrupt", s.Quarantined, s.CorruptBlobs))
+	}
+
+	lines = append(lines, "", fmt.Sprintf("\x1b[1mPeers\x1b[0m (%d)", len(s.Peers)))
+	for _, p := range s.Peers {
+		state := "offline"
+		if p.Online {
+			state = "online " + p.Path
+		} else if !p.LastSeen.IsZero() {
+			state = "last seen " + ago(p.LastSeen)
+		}
+		marker := "○"
+		if p.Online {
+			marker = "●"
+		}
+		lines = append(lines, fmt.Sprintf("  %s %-16s %s  %s", marker, truncate(p.Label, 16), shortPeerID(p.PeerID), state))
+	}
+
+	lines = append(lines, "", "\x1b[1mTransfers\x1b[0m")
+	if len(m.transfers) == 0 {
+		lines = append(lines, "  No downloads since the TUI started")
+	}
+	for _, t := range m.transfers {
+		lines = append(lines, fmt.Sprintf("  %s  %-32s %10s from %s", t.time.Format(time.TimeOnly), truncate(t.name, 32), formatBytes(t.size), shortPeerID(t.peer)))
+	}
+	return lines
+}
+
+func (m *tuiModel) browseLines() []string {
+	if m.core.storage == nil {
+		return []string{"This node doesn't hold the vault key, so folders can't be browsed here."}
+	}
+	names := make([]string, 0, len(m.path))
+	for _, crumb := range m.path[1:] {
+		names = append(names, crumb.name)
+	}
+	lines := []string{"/" + strings.Join(names, "/"), ""}
+	if m.prompt {
+		lines[1] = "Export to: " + m.input + "█"
+	}
+	if len(m.items) == 0 {
+		return append(lines, "  (empty)")
+	}
+
+	height := m.listHeight()
+	if m.cursor < m.offset {
+		m.offset = m.cursor
+	}
+	if m.cursor >= m.offset+height {
+		m.offset = m.cursor - height + 1
+	}
+	for i := m.offset; i < len(m.items) && i < m.offset+height; i++ {
+		var line string
+		switch e := m.items[i].(type) {
+		case storage.FolderEntry:
+			line = fmt.Sprintf("  %-10s %-16s %s/%s", "", "", e.Name, formatTags(e.Tags))
+		case storage.FileEntry:
+			line = fmt.Sprintf("  %10s %-16s %s%s", formatBytes(e.Size), e.ModifiedAt.Format("2006-01-02 15:04"), e.Name, formatTags(e.Tags))
+		}
+		if i == m.cursor {
+			line = "\x1b[7m" + truncate(line, m.width) + "\x1b[0m"
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func (m *tuiModel) help() string {
+	switch {
+	case m.prompt:
+		return "enter export  esc cancel"
+	case m.view == tuiBrowseView:
+		return "↑↓ move  enter open  ← up  e export  r refresh  tab status  q quit"
+	}
+	return "tab browse  r refresh  q quit"
+}
+
+// truncate cuts s to width characters, not counting terminal escapes
+func truncate(s string, width int) string {
+	var b strings.Builder
+	visible := 0
+	for i := 0; i < len(s); {
+		if s[i] == 0x1b {
+			end := strings.IndexByte(s[i:], 'm')
+			if end < 0 {
+				break
+			}
+			b.WriteString(s[i : i+end+1])
+			i += end + 1
+			continue
+		}
+		// Escapes past the cut are kept so attributes are still reset
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if visible < width {
+			b.WriteRune(r)
+			visible++
+		}
+		i += size
+	}
+	return b.String()
+}
+
+// shortPeerID abbreviates a peer ID to its last characters
+func shortPeerID(id string) string {
+	if len(id) <= 8 {
+		return id
+	}
+	return "…" + id[len(id)-8:]
+}
+
+// ago describes how long ago t was, to the second
+func ago(t time.Time) string {
+	d := time.Since(t)
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds ago", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d.Hours()))
+	}
+	return t.Format(time.DateOnly)
+}
+
+// formatBytes formats a byte count with a binary unit, as the desktop app does
+func formatBytes(n int64) string {
+	if n < 1024 {
+		return fmt.Sprintf("%d B", n)
+	}
+	units := []string{"KB", "MB", "GB", "TB"}
+	value := float64(n) / 1024
+	i := 0
+	for value >= 1024 && i < len(units)-1 {
+		value /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.1f %s", value, units[i])
+}
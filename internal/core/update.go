@@ -10,20 +10,25 @@ import (
 )
 
 type Update struct {
-	UpdateID         uint64      `json:"update_id"`
-	PeerListHash     []byte      `json:"peer_list_hash"`
-	PrevPeerListHash []byte      `json:"prev_peer_list_hash"`
-	DataHash         []byte      `json:"data_hash"`
-	PrevDataHash     []byte      `json:"prev_data_hash"`
-	NumBuckets       int         `json:"num_buckets"`
-	UpdateDataType   string      `json:"update_data_type"` // "PEER" or "DATA"
-	UpdateData       interface{} `json:"update_data"`
-	Timestamp        int64       `json:"timestamp"`
+	Version          int             `json:"version,omitempty"` // Signature encoding, see UpdateEncoding*
+	UpdateID         uint64          `json:"update_id"`
+	PeerListHash     []byte          `json:"peer_list_hash"`
+	PrevPeerListHash []byte          `json:"prev_peer_list_hash"`
+	DataHash         []byte          `json:"data_hash"`
+	PrevDataHash     []byte          `json:"prev_data_hash"`
+	NumBuckets       int             `json:"num_buckets"`
+	UpdateDataType   string          `json:"update_data_type"` // "PEER" or "DATA"
+	UpdateData       json.RawMessage `json:"update_data"`
+	Timestamp        int64           `json:"timestamp"`
+	KeyEpoch         uint32          `json:"key_epoch,omitempty"` // Key epoch of the entries this update references
+	// Identifies the digest key the peer list and data hashes are keyed
+	// with, see crypto.DigestKeyID. Empty for unkeyed hashes.
+	DigestKeyID []byte `json:"digest_key_id,omitempty"`
 }
 
 type SignedUpdate struct {
-	UpdateBytes []byte `json:"update_bytes"` // Canonical JSON bytes of the update
-	Signature   []byte `json:"signature"`
+	UpdateBytes []byte `json:"update_bytes"` // JSON bytes of the update
+	Signature   []byte `json:"signature"`    // Covers Update.CanonicalBytes (or UpdateBytes for legacy updates)
 }
 
 type PeerUpdate struct {
@@ -33,15 +38,40 @@ type PeerUpdate struct {
 }
 
 type DataUpdate struct {
-	Action string `json:"action"` // "ADD", "MODIFY", "DELETE"
+	Action string `json:"action"` // "ADD", "MODIFY", "DELETE", "BATCH"
 	Key    []byte `json:"key"`
 	Value  []byte `json:"value,omitempty"` // File hash for files, nil for folders
 	Size   int64  `json:"size,omitempty"`  // Size of file, 0 for folders
 	Hash   []byte `json:"hash,omitempty"`  // For ADD/MODIFY, omitted for DELETE
+
+	// For MODIFY, the entry being replaced. Changing an entry's metadata
+	// changes its encrypted key, so replicas drop this one for the new one.
+	PrevKey  []byte `json:"prev_key,omitempty"`
+	PrevHash []byte `json:"prev_hash,omitempty"`
+
+	// For BATCH, the updates applied together in one transaction. A folder
+	// renamed or moved comes first, and Subtree lists the hashes of the
+	// entries below it, whose path changed along with it.
+	Batch   []DataUpdate `json:"batch,omitempty"`
+	Subtree [][]byte     `json:"subtree,omitempty"`
+
+	// Optional note on why the change was made, sealed with the vault key,
+	// see storage.SealChangeNote. Set on the outermost update only.
+	Note []byte `json:"note,omitempty"`
+}
+
+// ComputePeerListHash creates a BLAKE3 hash of sorted, length-prefixed peer IDs,
+// keyed with digestKey unless it is nil.
+// Addresses are left out on purpose: they change often and an address-only
+// update must not make replicas fetch the whole peer list.
+func ComputePeerListHash(peerIDs []string, digestKey []byte) []byte {
+	return ComputePeerListHashVersion(peerIDs, peerListHashVersionForKey(digestKey), digestKey)
 }
 
-// ComputePeerListHash creates a BLAKE3 hash of sorted peer IDs
-func ComputePeerListHash(peerIDs []string) []byte {
+// ComputePeerListHashVersion computes the peer list hash using a specific encoding version.
+// Legacy updates carry hashes computed with PeerListHashLegacy. digestKey is
+// only used by PeerListHashKeyed.
+func ComputePeerListHashVersion(peerIDs []string, version int, digestKey []byte) []byte {
 	if len(peerIDs) == 0 {
 		return make([]byte, 32) // Return zero hash for empty list
 	}
@@ -50,16 +80,110 @@ func ComputePeerListHash(peerIDs []string) []byte {
 	copy(sorted, peerIDs)
 	sort.Strings(sorted)
 
-	hasher := blake3.New(32, nil)
-	for _, peerID := range sorted {
-		hasher.Write([]byte(peerID))
+	var key []byte
+	if version == PeerListHashKeyed {
+		key = digestKey
 	}
+	hasher := blake3.New(32, key)
+	if version == PeerListHashLegacy {
+		for _, peerID := range sorted {
+			hasher.Write([]byte(peerID))
+		}
+		return hasher.Sum(nil)
+	}
+
+	e := &canonicalEncoder{}
+	e.writeString(peerListDomainTag)
+	e.writeUint16(uint16(version))
+	e.writeStrings(sorted)
+	hasher.Write(e.Bytes())
 	return hasher.Sum(nil)
 }
 
-// VerifySignedUpdate verifies the signature over the canonical update bytes
+// peerListHashVersionFor returns the peer list hash version used by an update's encoding
+func peerListHashVersionFor(update Update) int {
+	switch {
+	case update.EncodingVersion() == UpdateEncodingLegacyJSON:
+		return PeerListHashLegacy
+	case len(update.DigestKeyID) > 0:
+		return PeerListHashKeyed
+	default:
+		return PeerListHashLengthPrefixed
+	}
+}
+
+// peerListHashVersionForKey returns the peer list hash version a node
+// computes with, depending on whether it holds the digest key
+func peerListHashVersionForKey(digestKey []byte) int {
+	if digestKey == nil {
+		return PeerListHashLengthPrefixed
+	}
+	return PeerListHashKeyed
+}
+
+// VerifySignedUpdate verifies the master signature according to the update's encoding version
 func VerifySignedUpdate(signedUpdate SignedUpdate, publicKey ed25519.PublicKey) bool {
-	return ed25519.Verify(publicKey, signedUpdate.UpdateBytes, signedUpdate.Signature)
+	update, err := signedUpdate.GetUpdate()
+	if err != nil {
+		return false
+	}
+	if err := update.checkVersionFields(); err != nil {
+		return false
+	}
+
+	switch update.EncodingVersion() {
+	case UpdateEncodingLegacyJSON:
+		return ed25519.Verify(publicKey, signedUpdate.UpdateBytes, signedUpdate.Signature)
+	case UpdateEncodingCanonical, UpdateEncodingKeyEpoch, UpdateEncodingModify, UpdateEncodingDigestKey, UpdateEncodingBatch, UpdateEncodingNote:
+		canonical, err := update.CanonicalBytes()
+		if err != nil {
+			return false
+		}
+		return ed25519.Verify(publicKey, canonical, signedUpdate.Signature)
+	default:
+		return false
+	}
+}
+
+// checkVersionFields rejects an update that sets fields its encoding version
+// doesn't sign. The signature wouldn't cover them, so a peer relaying the
+// update could have added or changed them.
+func (u Update) checkVersionFields() error {
+	version := u.EncodingVersion()
+	if version < UpdateEncodingKeyEpoch && u.KeyEpoch != 0 {
+		return fmt.Errorf("key epoch on a version %d update", version)
+	}
+	if version < UpdateEncodingDigestKey && len(u.DigestKeyID) > 0 {
+		return fmt.Errorf("digest key ID on a version %d update", version)
+	}
+	if u.UpdateDataType != "DATA" {
+		return nil
+	}
+	dataUpdate, err := u.DataUpdate()
+	if err != nil {
+		return err
+	}
+	return checkDataUpdateFields(dataUpdate, version)
+}
+
+// checkDataUpdateFields checks a data update and those in its batch for
+// fields newer than version, see checkVersionFields
+func checkDataUpdateFields(d DataUpdate, version int) error {
+	if version < UpdateEncodingModify && (len(d.PrevKey) > 0 || len(d.PrevHash) > 0) {
+		return fmt.Errorf("replaced entry on a version %d update", version)
+	}
+	if version < UpdateEncodingBatch && (len(d.Batch) > 0 || len(d.Subtree) > 0) {
+		return fmt.Errorf("batch operations on a version %d update", version)
+	}
+	if version < UpdateEncodingNote && len(d.Note) > 0 {
+		return fmt.Errorf("change note on a version %d update", version)
+	}
+	for _, op := range d.Batch {
+		if err := checkDataUpdateFields(op, version); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // GetUpdate unmarshals the Update from SignedUpdate.UpdateBytes
@@ -69,12 +193,33 @@ func (s *SignedUpdate) GetUpdate() (Update, error) {
 	return update, err
 }
 
+// newUpdateData marshals a PeerUpdate or DataUpdate into an Update payload
+func newUpdateData(v interface{}) (json.RawMessage, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal update data: %w", err)
+	}
+	return data, nil
+}
+
+// SignUpdate signs the canonical encoding of the update with the master key.
+// The encoding is taken from the update as peers will decode it, since
+// marshaling normalizes the payload (a missing payload becomes null).
 func SignUpdate(update Update, privateKey ed25519.PrivateKey) (SignedUpdate, error) {
+	update.Version = CurrentUpdateEncoding
 	updateJSON, err := json.Marshal(update)
 	if err != nil {
 		return SignedUpdate{}, fmt.Errorf("failed to marshal update: %w", err)
 	}
-	signature := ed25519.Sign(privateKey, updateJSON)
+	var decoded Update
+	if err := json.Unmarshal(updateJSON, &decoded); err != nil {
+		return SignedUpdate{}, fmt.Errorf("failed to decode update: %w", err)
+	}
+	canonical, err := decoded.CanonicalBytes()
+	if err != nil {
+		return SignedUpdate{}, fmt.Errorf("failed to encode update: %w", err)
+	}
+	signature := ed25519.Sign(privateKey, canonical)
 	return SignedUpdate{
 		UpdateBytes: updateJSON,
 		Signature:   signature,
@@ -0,0 +1,142 @@
+package core
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"testing"
+)
+
+// testDataUpdate returns an unsigned DATA update adding one entry
+func testDataUpdate(t *testing.T) Update {
+	t.Helper()
+	return Update{
+		UpdateID:       7,
+		DataHash:       []byte("data"),
+		PrevDataHash:   []byte("prev"),
+		NumBuckets:     1,
+		UpdateDataType: "DATA",
+		UpdateData:     testDataUpdatePayload(t),
+		Timestamp:      1700000000,
+	}
+}
+
+// testDataUpdatePayload is the payload of testDataUpdate, adding one entry
+func testDataUpdatePayload(tb testing.TB) json.RawMessage {
+	data, err := newUpdateData(DataUpdate{Action: "ADD", Key: []byte("key"), Value: []byte("blob"), Size: 4, Hash: []byte("hash")})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return data
+}
+
+// signAtVersion signs an update with the canonical encoding of version, as
+// a master running that version would have
+func signAtVersion(t *testing.T, u Update, version int, priv ed25519.PrivateKey) SignedUpdate {
+	t.Helper()
+	u.Version = version
+	updateJSON, err := json.Marshal(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Update
+	if err := json.Unmarshal(updateJSON, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	canonical, err := decoded.CanonicalBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return SignedUpdate{UpdateBytes: updateJSON, Signature: ed25519.Sign(priv, canonical)}
+}
+
+// tamper rewrites a signed update's payload the way a relaying peer could,
+// keeping the master's signature
+func tamper(t *testing.T, signed SignedUpdate, change func(u *Update, d *DataUpdate)) SignedUpdate {
+	t.Helper()
+	u, err := signed.GetUpdate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := u.DataUpdate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	change(&u, &d)
+	if u.UpdateData, err = newUpdateData(d); err != nil {
+		t.Fatal(err)
+	}
+	if signed.UpdateBytes, err = json.Marshal(u); err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestVerifySignedUpdateVersions(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for version := UpdateEncodingCanonical; version <= CurrentUpdateEncoding; version++ {
+		if !VerifySignedUpdate(signAtVersion(t, testDataUpdate(t), version, priv), pub) {
+			t.Errorf("version %d update does not verify", version)
+		}
+	}
+
+	signed, err := SignUpdate(testDataUpdate(t), priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !VerifySignedUpdate(signed, pub) {
+		t.Error("current update does not verify")
+	}
+	changed := tamper(t, signed, func(u *Update, d *DataUpdate) { d.Size++ })
+	if VerifySignedUpdate(changed, pub) {
+		t.Error("current update verifies with a changed size")
+	}
+}
+
+// Fields newer than an update's version aren't signed and must be refused
+func TestVerifySignedUpdateRejectsUnsignedFields(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	added := DataUpdate{Action: "DELETE", Key: []byte("other"), Hash: []byte("other")}
+	tests := []struct {
+		name    string
+		version int
+		change  func(u *Update, d *DataUpdate)
+	}{
+		{"batch on v2", UpdateEncodingCanonical, func(u *Update, d *DataUpdate) {
+			d.Action = "BATCH"
+			d.Batch = []DataUpdate{added}
+		}},
+		{"key epoch on v2", UpdateEncodingCanonical, func(u *Update, d *DataUpdate) {
+			u.KeyEpoch = 2
+		}},
+		{"prev key on v3", UpdateEncodingKeyEpoch, func(u *Update, d *DataUpdate) {
+			d.Action = "MODIFY"
+			d.PrevKey = []byte("other")
+		}},
+		{"prev hash on v3", UpdateEncodingKeyEpoch, func(u *Update, d *DataUpdate) {
+			d.PrevHash = []byte("other")
+		}},
+		{"digest key ID on v4", UpdateEncodingModify, func(u *Update, d *DataUpdate) {
+			u.DigestKeyID = []byte("digest key")
+		}},
+		{"subtree on v5", UpdateEncodingDigestKey, func(u *Update, d *DataUpdate) {
+			d.Subtree = [][]byte{[]byte("below")}
+		}},
+		{"note on v6", UpdateEncodingBatch, func(u *Update, d *DataUpdate) {
+			d.Note = []byte("sealed note")
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signed := signAtVersion(t, testDataUpdate(t), tt.version, priv)
+			if VerifySignedUpdate(tamper(t, signed, tt.change), pub) {
+				t.Error("tampered update verifies")
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package core
+
+import (
+	"fmt"
+
+	"github.com/notassigned/endershare/internal/database"
+	"github.com/notassigned/endershare/internal/storage"
+)
+
+// UsageMain (CLI only) prints what this node stores against its quota and,
+// with the vault key, the size of every folder
+func UsageMain() {
+	db := database.Create()
+	keys := db.GetKeys()
+	if keys == nil {
+		blobs, stored := db.GetStoredBlobStats()
+		usage := storage.Usage{EncryptedBytes: stored, Blobs: blobs, Quota: db.GetStorageQuota()}
+		if jsonOutput {
+			printJSON(newUsageJSON(usage))
+			return
+		}
+		printUsageTotals(usage)
+		fmt.Println("Folders: not readable without the vault key")
+		return
+	}
+
+	usage, err := storage.NewStorage(db, keys.AESKey).Usage()
+	if err != nil {
+		exitWithError(err)
+	}
+	if jsonOutput {
+		printJSON(newUsageJSON(usage))
+		return
+	}
+	printUsageTotals(usage)
+	fmt.Println("Folders:")
+	for _, f := range usage.Folders {
+		name := f.Name
+		if f.FolderID == storage.RootFolderID {
+			name = "/"
+		}
+		fmt.Printf("  %-30s %6d files %14d bytes\n", name, f.Files, f.Bytes)
+	}
+}
+
+func printUsageTotals(usage storage.Usage) {
+	fmt.Printf("Stored: %d encrypted bytes in %d blobs\n", usage.EncryptedBytes, usage.Blobs)
+	if usage.Quota > 0 {
+		fmt.Printf("Quota: %s, %d bytes free\n", formatLimit(usage.Quota), max(0, usage.Quota-usage.EncryptedBytes))
+	} else {
+		fmt.Println("Quota: off")
+	}
+}
@@ -0,0 +1,108 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/notassigned/endershare/internal/database"
+)
+
+// statusSnapshotInterval is how often the master checks whether the vault
+// statistics changed and publishes a new STATUS update
+const statusSnapshotInterval = time.Hour
+
+// VaultStats is the payload of a STATUS update. Counts are computed by the
+// master from decrypted metadata, so replicas that can't decrypt still learn
+// the vault's size.
+type VaultStats struct {
+	FileCount    int64 `json:"fileCount"`
+	FolderCount  int64 `json:"folderCount"`
+	LogicalBytes int64 `json:"logicalBytes"` // Sum of original file sizes
+	StoredBytes  int64 `json:"storedBytes"`  // Sum of encrypted blob sizes
+}
+
+// computeVaultStats counts the vault contents (master only)
+func (c *Core) computeVaultStats() (VaultStats, error) {
+	if c.storage == nil {
+		return VaultStats{}, fmt.Errorf("storage is not available")
+	}
+	files, folders, logicalBytes, err := c.storage.Stats()
+	if err != nil {
+		return VaultStats{}, err
+	}
+	_, storedBytes := c.db.GetStorageStats()
+	return VaultStats{
+		FileCount:    files,
+		FolderCount:  folders,
+		LogicalBytes: logicalBytes,
+		StoredBytes:  storedBytes,
+	}, nil
+}
+
+// publishVaultStats publishes a STATUS update if the statistics changed since
+// the last snapshot
+func (c *Core) publishVaultStats() error {
+	stats, err := c.computeVaultStats()
+	if err != nil {
+		return err
+	}
+	if latest := c.db.GetLatestVaultStats(); latest != nil && vaultStatsFromDB(*latest) == stats {
+		return nil
+	}
+
+	if err := c.publishControlUpdate("STATUS", stats); err != nil {
+		return err
+	}
+	updateID, err := c.db.GetCurrentUpdateID()
+	if err != nil {
+		return err
+	}
+	return c.recordVaultStats(updateID, time.Now().Unix(), stats)
+}
+
+// runStatusSnapshots publishes vault statistics now and then periodically
+func (c *Core) runStatusSnapshots(ctx context.Context) {
+	t := time.NewTicker(statusSnapshotInterval)
+	defer t.Stop()
+	for {
+		if err := c.publishVaultStats(); err != nil {
+			fmt.Println("Warning: failed to publish vault statistics:", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// applyStatusUpdate records the statistics carried by a verified STATUS update
+func (c *Core) applyStatusUpdate(update Update) error {
+	var stats VaultStats
+	if err := json.Unmarshal(update.UpdateData, &stats); err != nil {
+		return err
+	}
+	return c.recordVaultStats(update.UpdateID, update.Timestamp, stats)
+}
+
+func (c *Core) recordVaultStats(updateID uint64, timestamp int64, stats VaultStats) error {
+	return c.db.AddVaultStats(database.DBVaultStats{
+		UpdateID:     updateID,
+		Timestamp:    timestamp,
+		FileCount:    stats.FileCount,
+		FolderCount:  stats.FolderCount,
+		LogicalBytes: stats.LogicalBytes,
+		StoredBytes:  stats.StoredBytes,
+	})
+}
+
+func vaultStatsFromDB(s database.DBVaultStats) VaultStats {
+	return VaultStats{
+		FileCount:    s.FileCount,
+		FolderCount:  s.FolderCount,
+		LogicalBytes: s.LogicalBytes,
+		StoredBytes:  s.StoredBytes,
+	}
+}
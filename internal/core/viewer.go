@@ -0,0 +1,56 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/notassigned/endershare/internal/api"
+	"github.com/notassigned/endershare/internal/database"
+	"github.com/notassigned/endershare/internal/storage"
+)
+
+// ViewerMain serves a read-only guest web viewer for the given folders on the LAN.
+// Only nodes holding the vault key can decrypt files, so replicas can't host it.
+func ViewerMain(args []string) {
+	addr := api.DefaultViewerAddr
+	var folders []storage.FolderID
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--listen" && i+1 < len(args) {
+			addr = args[i+1]
+			i++
+			continue
+		}
+		folders = append(folders, storage.FolderID(args[i]))
+	}
+	if len(folders) == 0 {
+		fmt.Println("Usage: endershare viewer <folder-id>... [--listen addr]")
+		os.Exit(1)
+	}
+
+	db := database.Create()
+	keys := db.GetKeys()
+	if keys == nil || keys.AESKey == nil {
+		fmt.Println("Error: This node does not hold the vault key")
+		os.Exit(1)
+	}
+
+	viewer, err := api.StartViewer(db, storage.NewStorage(db, keys.AESKey), folders, addr)
+	if err != nil {
+		fmt.Println("Error starting viewer:", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("Guest viewer running at", viewer.URL)
+	fmt.Println("Username:", api.GuestUser)
+	fmt.Println("Password:", viewer.Password)
+	fmt.Println("Certificate fingerprint (SHA-256):", viewer.Fingerprint)
+	fmt.Println("Press Ctrl+C to stop")
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	<-sigCh
+
+	viewer.Stop()
+}
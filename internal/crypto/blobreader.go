@@ -0,0 +1,140 @@
+package crypto
+
+import (
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// BlobReader reads the plaintext of an encrypted blob at any offset,
+// decrypting only the chunks that hold the bytes asked for. Chunks of
+// version 2 blobs are checked against their index, so a range can't be served
+// from a chunk moved there from elsewhere.
+type BlobReader struct {
+	src        io.ReaderAt
+	gcm        cipher.AEAD
+	version    uint8
+	dataOffset int64 // Where the first chunk starts
+	blobSize   int64
+	chunks     int64
+	size       int64 // Plaintext size
+
+	mu     sync.Mutex
+	pos    int64 // For Read and Seek
+	cached int64 // Index of the chunk in plain, -1 for none
+	plain  []byte
+}
+
+// NewBlobReader returns a reader of the plaintext of the blobSize bytes blob in src
+func NewBlobReader(src io.ReaderAt, blobSize int64, key []byte) (*BlobReader, error) {
+	header, _, err := ReadBlobHeader(io.NewSectionReader(src, 0, blobSize))
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &BlobReader{src: src, gcm: gcm, version: header.Version, blobSize: blobSize, cached: -1}
+	if header.Version > 0 {
+		r.dataOffset = int64(blobHeaderSize)
+	}
+	payload := blobSize - r.dataOffset
+	full := int64(encryptedChunkSize(gcm))
+	overhead := int64(gcm.NonceSize() + gcm.Overhead())
+	r.chunks = (payload + full - 1) / full
+	if r.chunks == 0 && header.Version >= blobVersionIndexedChunks {
+		return nil, fmt.Errorf("blob ends without a final chunk")
+	}
+	if last := payload - (r.chunks-1)*full; r.chunks > 0 && last < overhead {
+		return nil, fmt.Errorf("blob chunk %d is truncated", r.chunks-1)
+	}
+	r.size = payload - r.chunks*overhead
+	return r, nil
+}
+
+// Size returns the plaintext size of the blob
+func (r *BlobReader) Size() int64 {
+	return r.size
+}
+
+// ReadAt decrypts len(p) bytes of plaintext starting at off
+func (r *BlobReader) ReadAt(p []byte, off int64) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.readAt(p, off)
+}
+
+func (r *BlobReader) readAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	n := 0
+	for n < len(p) && off < r.size {
+		index := off / chunkSize
+		if err := r.loadChunk(index); err != nil {
+			return n, err
+		}
+		copied := copy(p[n:], r.plain[off-index*chunkSize:])
+		n += copied
+		off += int64(copied)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// loadChunk decrypts a chunk into plain unless it is there already
+func (r *BlobReader) loadChunk(index int64) error {
+	if r.cached == index {
+		return nil
+	}
+	full := int64(encryptedChunkSize(r.gcm))
+	start := r.dataOffset + index*full
+	chunk := make([]byte, min(full, r.blobSize-start))
+	if _, err := r.src.ReadAt(chunk, start); err != nil && err != io.EOF {
+		return err
+	}
+	plain, err := openChunk(r.gcm, r.version, chunk, uint64(index), index == r.chunks-1)
+	if err != nil {
+		return err
+	}
+	r.plain, r.cached = plain, index
+	return nil
+}
+
+// Read decrypts from the current position
+func (r *BlobReader) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n, err := r.readAt(p, r.pos)
+	r.pos += int64(n)
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+// Seek moves the position Read continues from
+func (r *BlobReader) Seek(offset int64, whence int) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.pos
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	r.pos = offset
+	return offset, nil
+}
@@ -0,0 +1,72 @@
+package crypto
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestBlobReaderRanges(t *testing.T) {
+	key := bytes.Repeat([]byte{0x42}, 32)
+	for _, size := range []int64{3*chunkSize + 123, 2 * chunkSize} {
+		t.Run(fmt.Sprintf("%d bytes", size), func(t *testing.T) {
+			plaintext := make([]byte, size)
+			for i := range plaintext {
+				plaintext[i] = byte(i * 7 / 3)
+			}
+			var blob bytes.Buffer
+			if err := EncryptStream(&blob, bytes.NewReader(plaintext), key, 0, nil); err != nil {
+				t.Fatal(err)
+			}
+			r, err := NewBlobReader(bytes.NewReader(blob.Bytes()), int64(blob.Len()), key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.Size() != size {
+				t.Fatalf("Size = %d, want %d", r.Size(), size)
+			}
+
+			for _, tc := range []struct {
+				name     string
+				off, len int64
+			}{
+				{"first chunk", 10, 100},
+				{"whole first chunk", 0, chunkSize},
+				{"across a boundary", chunkSize - 10, 20},
+				{"starting on a boundary", chunkSize, 10},
+				{"across two boundaries", chunkSize - 1, chunkSize + 2},
+				{"ending at EOF", size - 500, 500},
+				{"past EOF", size - 10, 20},
+				{"whole blob", 0, size},
+				{"zero length", chunkSize + 5, 0},
+				{"zero length at EOF", size, 0},
+			} {
+				t.Run(tc.name, func(t *testing.T) {
+					p := make([]byte, tc.len)
+					n, err := r.ReadAt(p, tc.off)
+					want := plaintext[tc.off:min(tc.off+tc.len, size)]
+					if int64(len(want)) < tc.len {
+						if err != io.EOF {
+							t.Errorf("short read returned %v, want EOF", err)
+						}
+					} else if err != nil {
+						t.Errorf("ReadAt = %v", err)
+					}
+					if !bytes.Equal(p[:n], want) {
+						t.Errorf("read %d bytes at %d not matching the plaintext, want %d", n, tc.off, len(want))
+					}
+				})
+			}
+
+			// Read and Seek serve the same ranges
+			if _, err := r.Seek(-300, io.SeekEnd); err != nil {
+				t.Fatal(err)
+			}
+			tail, err := io.ReadAll(r)
+			if err != nil || !bytes.Equal(tail, plaintext[size-300:]) {
+				t.Errorf("read from 300 bytes before the end = %d bytes, %v", len(tail), err)
+			}
+		})
+	}
+}
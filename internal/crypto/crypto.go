@@ -1,6 +1,7 @@
 package crypto
 
 import (
+	"bufio"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/ed25519"
@@ -52,6 +53,47 @@ func CreatePeerOnlyKeys() *CryptoKeys {
 	}
 }
 
+// VaultFingerprint identifies a vault by its master public key.
+// Exchanged in stream handshakes so peers of different vaults can reject each other early.
+func VaultFingerprint(masterPublicKey ed25519.PublicKey) []byte {
+	h := blake3.New(32, nil)
+	h.Write([]byte("endershare/vault-fingerprint"))
+	h.Write(masterPublicKey)
+	return h.Sum(nil)
+}
+
+// digestKeyContext separates the digest key from other keys derived from the vault key
+const digestKeyContext = "endershare 2026 vault digest key v1"
+
+// DeriveDigestKey derives the key that keyed BLAKE3 digests exchanged between
+// vault members (bucket hashes, data roots, peer list hashes) are made with.
+// Without it the digests say nothing about the vault's contents.
+func DeriveDigestKey(aesKey []byte) []byte {
+	key := make([]byte, 32)
+	blake3.DeriveKey(key, digestKeyContext, aesKey)
+	return key
+}
+
+// contentHashKeyContext separates the content hash key from other keys derived from the vault key
+const contentHashKeyContext = "endershare 2026 content hash key v1"
+
+// DeriveContentHashKey derives the key file contents are hashed with to find
+// files that are stored already, so the hashes say nothing without the vault key
+func DeriveContentHashKey(aesKey []byte) []byte {
+	key := make([]byte, 32)
+	blake3.DeriveKey(key, contentHashKeyContext, aesKey)
+	return key
+}
+
+// DigestKeyID identifies a digest key without revealing it, so a key fetched
+// from a peer can be checked against the one the master signs updates with
+func DigestKeyID(digestKey []byte) []byte {
+	h := blake3.New(32, nil)
+	h.Write([]byte("endershare/digest-key-id"))
+	h.Write(digestKey)
+	return h.Sum(nil)
+}
+
 func VerifySignature(publicKey ed25519.PublicKey, message []byte, signature []byte) bool {
 	ok := ed25519.Verify(publicKey, message, signature)
 	return ok
@@ -162,90 +204,113 @@ func Decrypt(ciphertext []byte, key []byte) ([]byte, error) {
 const chunkSize = 64 * 1024 // 64KB chunks for streaming encryption
 
 // EncryptStream encrypts a file in chunks using AES-256-GCM and computes hash of encrypted content
-// Returns the hash of the encrypted content
-func EncryptStream(dst io.Writer, src io.Reader, key []byte, hasher *blake3.Hasher) error {
-	block, err := aes.NewCipher(key)
+// The blob header recording keyEpoch is written first and is included in the hash
+func EncryptStream(dst io.Writer, src io.Reader, key []byte, keyEpoch uint32, hasher *blake3.Hasher) error {
+	gcm, err := newGCM(key)
 	if err != nil {
 		return err
 	}
 
-	gcm, err := cipher.NewGCM(block)
+	header, err := writeBlobHeader(dst, keyEpoch)
 	if err != nil {
 		return err
 	}
+	if hasher != nil {
+		hasher.Write(header)
+	}
 
-	buf := make([]byte, chunkSize)
-
-	for {
-		n, err := src.Read(buf)
-		if n > 0 {
-			nonce := make([]byte, gcm.NonceSize())
-			if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
-				return err
-			}
-
-			ciphertext := gcm.Seal(nonce, nonce, buf[:n], nil)
-			if _, err := dst.Write(ciphertext); err != nil {
-				return err
-			}
-
-			if hasher != nil {
-				hasher.Write(ciphertext)
-			}
+	// Chunks must be full but the last, which is read ahead so it can be
+	// marked final. Empty content still gets an empty final chunk.
+	buf, next := make([]byte, chunkSize), make([]byte, chunkSize)
+	n, err := io.ReadFull(src, buf)
+	for index := uint64(0); ; index++ {
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
 		}
-		if err == io.EOF {
-			break
+		final := err != nil
+		var m int
+		var nextErr error
+		if !final {
+			m, nextErr = io.ReadFull(src, next)
+			final = m == 0 && nextErr == io.EOF
 		}
-		if err != nil {
+
+		nonce := make([]byte, gcm.NonceSize())
+		if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+			return err
+		}
+		ciphertext := gcm.Seal(nonce, nonce, buf[:n], chunkAAD(blobHeaderVersion, index, final))
+		if _, err := dst.Write(ciphertext); err != nil {
 			return err
 		}
+		if hasher != nil {
+			hasher.Write(ciphertext)
+		}
+
+		if final {
+			return nil
+		}
+		buf, next = next, buf
+		n, err = m, nextErr
 	}
-	return nil
 }
 
 // DecryptStream decrypts a file that was encrypted with EncryptStream
 func DecryptStream(dst io.Writer, src io.Reader, key []byte) error {
-	block, err := aes.NewCipher(key)
+	header, src, err := ReadBlobHeader(src)
 	if err != nil {
 		return err
 	}
 
-	gcm, err := cipher.NewGCM(block)
+	gcm, err := newGCM(key)
 	if err != nil {
 		return err
 	}
 
-	nonceSize := gcm.NonceSize()
 	// Each chunk is: nonce + encrypted data + auth tag
-	chunkOverhead := nonceSize + gcm.Overhead()
-	encryptedChunkSize := chunkSize + chunkOverhead
-	buf := make([]byte, encryptedChunkSize)
-
-	for {
-		n, err := io.ReadAtLeast(src, buf, nonceSize+1)
-		if err == io.EOF || err == io.ErrUnexpectedEOF {
-			if n == 0 {
-				break
-			}
-		} else if err != nil {
+	r := bufio.NewReader(src)
+	buf := make([]byte, encryptedChunkSize(gcm))
+	for index := uint64(0); ; index++ {
+		n, err := io.ReadFull(r, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
 			return err
 		}
+		final := err != nil
+		if !final {
+			if _, err := r.Peek(1); err == io.EOF {
+				final = true
+			}
+		}
+		if n == 0 {
+			if header.Version >= blobVersionIndexedChunks {
+				return fmt.Errorf("blob ends without a final chunk")
+			}
+			return nil
+		}
 
-		nonce := buf[:nonceSize]
-		ciphertext := buf[nonceSize:n]
-
-		plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+		plaintext, err := openChunk(gcm, header.Version, buf[:n], index, final)
 		if err != nil {
 			return err
 		}
-
 		if _, err := dst.Write(plaintext); err != nil {
 			return err
 		}
 
-		if n < encryptedChunkSize {
-			break
+		if final {
+			return nil
 		}
 	}
-	return nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptedChunkSize is the size of a full chunk in a blob
+func encryptedChunkSize(gcm cipher.AEAD) int {
+	return gcm.NonceSize() + chunkSize + gcm.Overhead()
 }
@@ -0,0 +1,42 @@
+package crypto
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"lukechampine.com/blake3"
+)
+
+// streamSize is the plaintext size of one encrypted streaming operation
+const streamSize = 16 << 20
+
+// BenchmarkEncryptStream measures blob encryption throughput, hashing
+// included as when a file is added
+func BenchmarkEncryptStream(b *testing.B) {
+	plaintext := make([]byte, streamSize)
+	key := bytes.Repeat([]byte{0x42}, 32)
+	b.SetBytes(streamSize)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := EncryptStream(io.Discard, bytes.NewReader(plaintext), key, 0, blake3.New(32, nil)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkDecryptStream measures blob decryption throughput
+func BenchmarkDecryptStream(b *testing.B) {
+	key := bytes.Repeat([]byte{0x42}, 32)
+	var blob bytes.Buffer
+	if err := EncryptStream(&blob, bytes.NewReader(make([]byte, streamSize)), key, 0, nil); err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(streamSize)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := DecryptStream(io.Discard, bytes.NewReader(blob.Bytes()), key); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -24,13 +24,15 @@ type Bucket struct {
 	Hashes     [][]byte
 	cachedHash []byte // cached BLAKE3 hash
 	hashValid  bool   // cache validity flag
+	key        []byte // BLAKE3 key, nil for unkeyed hashes
 }
 
 type MerkleTree struct {
 	Buckets     []*Bucket
 	NumBuckets  int
 	Root        *MerkleNode
-	totalHashes int // cached total count
+	totalHashes int    // cached total count
+	key         []byte // Keys bucket and node hashes, see NewKeyedMerkleTree
 }
 
 // GetHash returns the BLAKE3 hash of the bucket's contents, using cache when valid
@@ -51,7 +53,7 @@ func (b *Bucket) GetHash() []byte {
 		buf.Write(h)
 	}
 
-	hasher := blake3.New(32, nil)
+	hasher := blake3.New(32, b.key)
 	hasher.Write(buf.Bytes())
 	b.cachedHash = hasher.Sum(nil)
 	b.hashValid = true
@@ -98,40 +100,75 @@ func getBucketIndex(hash []byte, numBuckets int) int {
 // NewMerkleTree creates a new Merkle tree from a list of hashes
 // Hashes are distributed into buckets based on their value ranges
 func NewMerkleTree(hashes [][]byte) *MerkleTree {
-	numBuckets := calculateNumBuckets(len(hashes))
-	return NewMerkleTreeWithBuckets(hashes, numBuckets)
+	return NewKeyedMerkleTree(hashes, nil)
 }
 
 // newMerkleTreeWithBuckets creates a tree with a specific number of buckets
 func NewMerkleTreeWithBuckets(hashes [][]byte, numBuckets int) *MerkleTree {
+	return NewKeyedMerkleTreeWithBuckets(hashes, numBuckets, nil)
+}
+
+// NewKeyedMerkleTree creates a tree whose bucket and node hashes are keyed
+// BLAKE3 with a 32-byte key, so only holders of the key can relate them to
+// the hashes they cover. A nil key builds an unkeyed tree.
+func NewKeyedMerkleTree(hashes [][]byte, key []byte) *MerkleTree {
+	numBuckets := calculateNumBuckets(len(hashes))
+	return NewKeyedMerkleTreeWithBuckets(hashes, numBuckets, key)
+}
+
+// NewKeyedMerkleTreeWithBuckets creates a keyed tree with a specific number of buckets
+func NewKeyedMerkleTreeWithBuckets(hashes [][]byte, numBuckets int, key []byte) *MerkleTree {
+	b := NewMerkleTreeBuilder(numBuckets, key)
+	for _, hash := range hashes {
+		b.Add(hash)
+	}
+	return b.Build()
+}
+
+// NumBucketsFor returns the number of buckets a tree of numHashes hashes is built with
+func NumBucketsFor(numHashes int) int {
+	return calculateNumBuckets(numHashes)
+}
+
+// MerkleTreeBuilder builds a tree from hashes added one at a time, so hashes
+// read from disk or a peer in batches need not be collected first
+type MerkleTreeBuilder struct {
+	buckets []*Bucket
+	total   int
+	key     []byte
+}
+
+// NewMerkleTreeBuilder starts a tree with numBuckets buckets, keyed like
+// NewKeyedMerkleTree
+func NewMerkleTreeBuilder(numBuckets int, key []byte) *MerkleTreeBuilder {
 	if numBuckets < 1 {
 		numBuckets = 1
 	}
-
 	buckets := make([]*Bucket, numBuckets)
 	for i := 0; i < numBuckets; i++ {
-		buckets[i] = &Bucket{Hashes: [][]byte{}}
+		buckets[i] = &Bucket{Hashes: [][]byte{}, key: key}
 	}
+	return &MerkleTreeBuilder{buckets: buckets, key: key}
+}
 
-	// Distribute hashes into buckets based on their value
-	for _, hash := range hashes {
-		bucketIdx := getBucketIndex(hash, numBuckets)
-		buckets[bucketIdx].Hashes = append(buckets[bucketIdx].Hashes, hash)
-	}
+// Add puts a hash in the bucket for its value
+func (b *MerkleTreeBuilder) Add(hash []byte) {
+	bucketIdx := getBucketIndex(hash, len(b.buckets))
+	b.buckets[bucketIdx].Hashes = append(b.buckets[bucketIdx].Hashes, hash)
+	b.total++
+}
 
-	// Sort hashes within each bucket
-	for _, bucket := range buckets {
+// Build sorts the buckets and returns the tree. The builder must not be used afterwards.
+func (b *MerkleTreeBuilder) Build() *MerkleTree {
+	for _, bucket := range b.buckets {
 		sortHashes(bucket.Hashes)
 	}
-
-	// Build tree from buckets
-	root := buildTree(buckets)
-
 	return &MerkleTree{
-		Buckets:     buckets,
-		NumBuckets:  numBuckets,
-		Root:        root,
-		totalHashes: len(hashes),
+		Buckets:     b.buckets,
+		NumBuckets:  len(b.buckets),
+		Root:        buildTree(b.buckets, b.key),
+		totalHashes: b.total,
+		key:         b.key,
 	}
 }
 
@@ -143,7 +180,7 @@ func sortHashes(hashes [][]byte) {
 }
 
 // buildTree recursively builds the Merkle tree from buckets
-func buildTree(buckets []*Bucket) *MerkleNode {
+func buildTree(buckets []*Bucket, key []byte) *MerkleNode {
 	if len(buckets) == 0 {
 		return nil
 	}
@@ -157,11 +194,11 @@ func buildTree(buckets []*Bucket) *MerkleNode {
 	}
 
 	// Build tree bottom-up
-	return buildTreeFromNodes(nodes)
+	return buildTreeFromNodes(nodes, key)
 }
 
 // buildTreeFromNodes recursively builds tree from nodes
-func buildTreeFromNodes(nodes []*MerkleNode) *MerkleNode {
+func buildTreeFromNodes(nodes []*MerkleNode, key []byte) *MerkleNode {
 	if len(nodes) == 0 {
 		return nil
 	}
@@ -179,7 +216,7 @@ func buildTreeFromNodes(nodes []*MerkleNode) *MerkleNode {
 		}
 
 		// Compute parent hash from children
-		hasher := blake3.New(32, nil)
+		hasher := blake3.New(32, key)
 		hasher.Write(left.Hash)
 		if right != nil {
 			hasher.Write(right.Hash)
@@ -193,7 +230,7 @@ func buildTreeFromNodes(nodes []*MerkleNode) *MerkleNode {
 		parentLevel = append(parentLevel, parent)
 	}
 
-	return buildTreeFromNodes(parentLevel)
+	return buildTreeFromNodes(parentLevel, key)
 }
 
 // GetRootHash returns the root hash of the tree
@@ -259,7 +296,7 @@ func (mt *MerkleTree) Insert(hash []byte) bool {
 
 	// Invalidate modified bucket and rebuild tree structure
 	mt.Buckets[bucketIdx].Invalidate()
-	mt.Root = buildTree(mt.Buckets)
+	mt.Root = buildTree(mt.Buckets, mt.key)
 	return false
 }
 
@@ -297,23 +334,21 @@ func (mt *MerkleTree) Delete(hash []byte) bool {
 
 	// Invalidate modified bucket and rebuild tree structure
 	mt.Buckets[bucketIdx].Invalidate()
-	mt.Root = buildTree(mt.Buckets)
+	mt.Root = buildTree(mt.Buckets, mt.key)
 	return false
 }
 
-// rebuild collects all hashes and redistributes them into new buckets
+// rebuild redistributes all hashes into a number of buckets suited to their count
 func (mt *MerkleTree) rebuild() {
-	// Collect all hashes
-	allHashes := [][]byte{}
-	for _, bucket := range mt.Buckets {
-		allHashes = append(allHashes, bucket.Hashes...)
+	b := NewMerkleTreeBuilder(calculateNumBuckets(mt.totalHashes), mt.key)
+	for i, bucket := range mt.Buckets {
+		for _, hash := range bucket.Hashes {
+			b.Add(hash)
+		}
+		mt.Buckets[i] = nil
 	}
 
-	// Calculate new number of buckets
-	newNumBuckets := calculateNumBuckets(len(allHashes))
-
-	// Rebuild tree with new bucket count
-	newTree := NewMerkleTreeWithBuckets(allHashes, newNumBuckets)
+	newTree := b.Build()
 	mt.Buckets = newTree.Buckets
 	mt.NumBuckets = newTree.NumBuckets
 	mt.Root = newTree.Root
@@ -0,0 +1,136 @@
+package crypto
+
+import (
+	"encoding/binary"
+	"sync"
+	"testing"
+
+	"lukechampine.com/blake3"
+)
+
+// benchSizes are the tree sizes the merkle benchmarks run at
+var benchSizes = []struct {
+	name string
+	n    int
+}{
+	{"1k", 1_000},
+	{"100k", 100_000},
+	{"1M", 1_000_000},
+}
+
+// diffChanged is the share of entries replaced between the two trees of
+// BenchmarkDiffBuckets, one in diffChanged
+const diffChanged = 100
+
+// syntheticHash returns the i'th hash of a fixed sequence, so every run works
+// on the same data
+func syntheticHash(seed string, i int) []byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(i))
+	h := blake3.New(32, nil)
+	h.Write([]byte(seed))
+	h.Write(buf[:])
+	return h.Sum(nil)
+}
+
+var (
+	hashCacheMu sync.Mutex
+	hashCache   = map[int][][]byte{}
+)
+
+// benchHashes returns the first n hashes of the data sequence. They are
+// generated once and shared, callers must not modify them.
+func benchHashes(n int) [][]byte {
+	hashCacheMu.Lock()
+	defer hashCacheMu.Unlock()
+	if h, ok := hashCache[n]; ok {
+		return h
+	}
+	h := make([][]byte, n)
+	for i := range h {
+		h[i] = syntheticHash("data", i)
+	}
+	hashCache[n] = h
+	return h
+}
+
+// extraHashes are hashes outside the data sequence, for inserting
+func extraHashes(n int) [][]byte {
+	h := make([][]byte, n)
+	for i := range h {
+		h[i] = syntheticHash("extra", i)
+	}
+	return h
+}
+
+// BenchmarkMerkleInsert measures inserting one hash into a tree. The hash is
+// removed again outside the timer so the tree keeps its size.
+func BenchmarkMerkleInsert(b *testing.B) {
+	for _, size := range benchSizes {
+		b.Run(size.name, func(b *testing.B) {
+			tree := NewMerkleTree(benchHashes(size.n))
+			extra := extraHashes(b.N)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				tree.Insert(extra[i])
+				b.StopTimer()
+				tree.Delete(extra[i])
+				b.StartTimer()
+			}
+		})
+	}
+}
+
+// BenchmarkMerkleDelete measures deleting one hash from a tree. The hash is
+// put back outside the timer.
+func BenchmarkMerkleDelete(b *testing.B) {
+	for _, size := range benchSizes {
+		b.Run(size.name, func(b *testing.B) {
+			all := benchHashes(size.n)
+			tree := NewMerkleTree(all)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				h := all[i%size.n]
+				tree.Delete(h)
+				b.StopTimer()
+				tree.Insert(h)
+				b.StartTimer()
+			}
+		})
+	}
+}
+
+// BenchmarkMerkleRebuild measures building a tree from scratch, as done at
+// startup and when a peer's bucket count differs
+func BenchmarkMerkleRebuild(b *testing.B) {
+	for _, size := range benchSizes {
+		b.Run(size.name, func(b *testing.B) {
+			all := benchHashes(size.n)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				NewMerkleTree(all)
+			}
+		})
+	}
+}
+
+// BenchmarkDiffBuckets measures comparing the bucket hashes of two trees that
+// differ in one of every diffChanged entries, the first step of a sync
+func BenchmarkDiffBuckets(b *testing.B) {
+	for _, size := range benchSizes {
+		b.Run(size.name, func(b *testing.B) {
+			all := benchHashes(size.n)
+			other := make([][]byte, size.n)
+			copy(other, all)
+			for i, h := range extraHashes(size.n / diffChanged) {
+				other[i*diffChanged] = h
+			}
+			local := NewMerkleTree(all)
+			remote := NewMerkleTreeWithBuckets(other, local.GetNumBuckets())
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				local.DiffBuckets(remote)
+			}
+		})
+	}
+}
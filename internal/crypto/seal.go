@@ -0,0 +1,103 @@
+package crypto
+
+import (
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+
+	"lukechampine.com/blake3"
+)
+
+// Sealed keys are an ephemeral X25519 public key followed by the content key
+// encrypted with a key derived from the ephemeral-recipient shared secret.
+// Anyone with the recipient public key can seal; only the private key opens.
+const (
+	sealKeyContext = "endershare 2026 drop box key wrap v1"
+	sealPubKeySize = 32
+)
+
+// NewContentKey returns a random AES-256 key for encrypting a single blob
+func NewContentKey() ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// dropKeyContext separates drop box keys from other keys derived from the master key
+const dropKeyContext = "endershare 2026 drop box key v1"
+
+// DeriveSealingKeyPair derives the X25519 keypair content keys of the drop
+// box folderID are sealed to. It depends only on the master key, so the
+// private half never has to leave the master, and a master restored from
+// its mnemonic can still open what was dropped.
+func DeriveSealingKeyPair(masterPrivateKey ed25519.PrivateKey, folderID string) (privateKey, publicKey []byte, err error) {
+	if len(masterPrivateKey) != ed25519.PrivateKeySize {
+		return nil, nil, fmt.Errorf("master private key is not available")
+	}
+	seed := make([]byte, 32)
+	blake3.DeriveKey(seed, dropKeyContext, append(masterPrivateKey.Seed(), folderID...))
+	priv, err := ecdh.X25519().NewPrivateKey(seed)
+	if err != nil {
+		return nil, nil, err
+	}
+	return priv.Bytes(), priv.PublicKey().Bytes(), nil
+}
+
+// SealKey encrypts key so that only the holder of the private half of
+// recipientPublicKey can recover it
+func SealKey(key []byte, recipientPublicKey []byte) ([]byte, error) {
+	recipient, err := ecdh.X25519().NewPublicKey(recipientPublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sealing public key: %w", err)
+	}
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := ephemeral.ECDH(recipient)
+	if err != nil {
+		return nil, err
+	}
+
+	ephemeralPub := ephemeral.PublicKey().Bytes()
+	wrapped, err := Encrypt(key, sealWrapKey(shared, ephemeralPub, recipientPublicKey))
+	if err != nil {
+		return nil, err
+	}
+	return append(ephemeralPub, wrapped...), nil
+}
+
+// OpenSealedKey recovers a key sealed with SealKey
+func OpenSealedKey(sealed []byte, privateKey []byte) ([]byte, error) {
+	if len(sealed) <= sealPubKeySize {
+		return nil, fmt.Errorf("sealed key too short")
+	}
+	priv, err := ecdh.X25519().NewPrivateKey(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sealing private key: %w", err)
+	}
+	ephemeral, err := ecdh.X25519().NewPublicKey(sealed[:sealPubKeySize])
+	if err != nil {
+		return nil, err
+	}
+	shared, err := priv.ECDH(ephemeral)
+	if err != nil {
+		return nil, err
+	}
+	return Decrypt(sealed[sealPubKeySize:], sealWrapKey(shared, sealed[:sealPubKeySize], priv.PublicKey().Bytes()))
+}
+
+// sealWrapKey binds the wrapping key to both public keys so a sealed key
+// can't be replayed against another recipient
+func sealWrapKey(shared, ephemeralPub, recipientPub []byte) []byte {
+	material := make([]byte, 0, len(shared)+len(ephemeralPub)+len(recipientPub))
+	material = append(material, shared...)
+	material = append(material, ephemeralPub...)
+	material = append(material, recipientPub...)
+	key := make([]byte, 32)
+	blake3.DeriveKey(key, sealKeyContext, material)
+	return key
+}
@@ -0,0 +1,90 @@
+package database
+
+import (
+	"strconv"
+	"time"
+)
+
+// Alert channels are URLs, empty when the channel is off. They are local
+// settings of the node that sends the alerts and never synced.
+
+// GetAlertNtfy returns the ntfy topic URL alerts are pushed to
+func (db *EndershareDB) GetAlertNtfy() string {
+	return db.getStringProperty("alert_ntfy")
+}
+
+func (db *EndershareDB) SetAlertNtfy(url string) error {
+	return db.setStringProperty("alert_ntfy", url)
+}
+
+// GetAlertGotify returns the Gotify message URL, with its app token, alerts are pushed to
+func (db *EndershareDB) GetAlertGotify() string {
+	return db.getStringProperty("alert_gotify")
+}
+
+func (db *EndershareDB) SetAlertGotify(url string) error {
+	return db.setStringProperty("alert_gotify", url)
+}
+
+// GetAlertSMTP returns the smtp:// or smtps:// URL alerts are mailed through
+func (db *EndershareDB) GetAlertSMTP() string {
+	return db.getStringProperty("alert_smtp")
+}
+
+func (db *EndershareDB) SetAlertSMTP(url string) error {
+	return db.setStringProperty("alert_smtp", url)
+}
+
+// GetAlertSyncLag returns how long the node may stay behind before an alert (0 for the default)
+func (db *EndershareDB) GetAlertSyncLag() time.Duration {
+	return db.getDurationProperty("alert_sync_lag")
+}
+
+func (db *EndershareDB) SetAlertSyncLag(d time.Duration) error {
+	return db.setDurationProperty("alert_sync_lag", d)
+}
+
+// GetAlertPeerOffline returns how long a peer may be offline before an alert (0 for the default)
+func (db *EndershareDB) GetAlertPeerOffline() time.Duration {
+	return db.getDurationProperty("alert_peer_offline")
+}
+
+func (db *EndershareDB) SetAlertPeerOffline(d time.Duration) error {
+	return db.setDurationProperty("alert_peer_offline", d)
+}
+
+// GetAlertDiskFree returns the percentage of free disk space, or of the
+// storage quota, below which an alert fires (0 for the default)
+func (db *EndershareDB) GetAlertDiskFree() int {
+	s, err := db.getNodeProperty("alert_disk_free")
+	if err != nil {
+		return 0
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < 0 {
+		return 0
+	}
+	return v
+}
+
+func (db *EndershareDB) SetAlertDiskFree(percent int) error {
+	if percent <= 0 {
+		return db.DeleteNodeProperty("alert_disk_free")
+	}
+	return db.setNodeProperty("alert_disk_free", strconv.Itoa(percent))
+}
+
+func (db *EndershareDB) getStringProperty(key string) string {
+	s, err := db.getNodeProperty(key)
+	if err != nil {
+		return ""
+	}
+	return s
+}
+
+func (db *EndershareDB) setStringProperty(key, value string) error {
+	if value == "" {
+		return db.DeleteNodeProperty(key)
+	}
+	return db.setNodeProperty(key, value)
+}
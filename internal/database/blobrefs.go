@@ -0,0 +1,81 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// Several data entries can point at the same blob, e.g. a renamed file or a
+// file added again with content that is already stored. blob_refs counts the
+// rows of the data table referencing each blob; triggers keep it current
+// through every write, including sync. REPLACE does not fire delete
+// triggers, so the row an insert replaces is uncounted before the insert.
+const blobRefTriggers = `
+	CREATE TRIGGER IF NOT EXISTS data_blob_refs_replace BEFORE INSERT ON data BEGIN
+		UPDATE blob_refs SET refs = refs - 1 WHERE blob_hash = (SELECT value FROM data WHERE key = NEW.key);
+		DELETE FROM blob_refs WHERE refs <= 0;
+	END;
+	CREATE TRIGGER IF NOT EXISTS data_blob_refs_insert AFTER INSERT ON data WHEN NEW.value IS NOT NULL BEGIN
+		INSERT INTO blob_refs (blob_hash, refs) VALUES (NEW.value, 1)
+			ON CONFLICT(blob_hash) DO UPDATE SET refs = refs + 1;
+	END;
+	CREATE TRIGGER IF NOT EXISTS data_blob_refs_delete AFTER DELETE ON data WHEN OLD.value IS NOT NULL BEGIN
+		UPDATE blob_refs SET refs = refs - 1 WHERE blob_hash = OLD.value;
+		DELETE FROM blob_refs WHERE blob_hash = OLD.value AND refs <= 0;
+	END;
+`
+
+// createBlobRefTriggers installs the reference counting triggers. Databases
+// written before they existed have their counts built from the data table.
+func (db *EndershareDB) createBlobRefTriggers() error {
+	var existing int
+	if err := db.db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name = 'data_blob_refs_insert'").Scan(&existing); err != nil {
+		return err
+	}
+	if existing > 0 {
+		return nil
+	}
+
+	tx, err := db.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(blobRefTriggers); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM blob_refs"); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("INSERT INTO blob_refs (blob_hash, refs) SELECT value, COUNT(*) FROM data WHERE value IS NOT NULL GROUP BY value"); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetBlobRefs returns how many data entries reference a blob
+func (db *EndershareDB) GetBlobRefs(blobHash []byte) int {
+	var refs int
+	db.db.QueryRow("SELECT refs FROM blob_refs WHERE blob_hash = ?", blobHash).Scan(&refs)
+	return refs
+}
+
+// SetContentHash records the blob a file's content was stored in. Content
+// hashes are keyed with the vault key and never leave this node.
+func (db *EndershareDB) SetContentHash(contentHash, blobHash []byte) error {
+	_, err := db.db.Exec("INSERT OR REPLACE INTO content_hashes (content_hash, blob_hash) VALUES (?, ?)", contentHash, blobHash)
+	return err
+}
+
+// GetBlobByContent returns the blob holding content with contentHash, or nil
+// if none is recorded or no entry references it anymore
+func (db *EndershareDB) GetBlobByContent(contentHash []byte) ([]byte, error) {
+	var blobHash []byte
+	err := db.db.QueryRow(`SELECT c.blob_hash FROM content_hashes c
+		JOIN blob_refs r ON r.blob_hash = c.blob_hash
+		WHERE c.content_hash = ?`, contentHash).Scan(&blobHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return blobHash, err
+}
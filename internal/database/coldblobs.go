@@ -0,0 +1,74 @@
+package database
+
+import "time"
+
+// DBColdBlob is a blob this node offloaded to its cold storage
+type DBColdBlob struct {
+	BlobHash []byte
+	Size     int64
+	Stored   time.Time
+}
+
+// GetColdStorage returns the URL of the S3 bucket blobs are offloaded to ("" if none)
+func (db *EndershareDB) GetColdStorage() string {
+	return db.getStringProperty("cold_storage")
+}
+
+func (db *EndershareDB) SetColdStorage(url string) error {
+	return db.setStringProperty("cold_storage", url)
+}
+
+// GetColdStorageKey returns the keys requests to cold storage are signed with ("" if none)
+func (db *EndershareDB) GetColdStorageKey() (accessKey, secretKey string) {
+	return db.getStringProperty("cold_storage_access_key"), db.getStringProperty("cold_storage_secret_key")
+}
+
+func (db *EndershareDB) SetColdStorageKey(accessKey, secretKey string) error {
+	if err := db.setStringProperty("cold_storage_access_key", accessKey); err != nil {
+		return err
+	}
+	return db.setStringProperty("cold_storage_secret_key", secretKey)
+}
+
+// AddColdBlob records that a blob of size encrypted bytes is in cold storage
+func (db *EndershareDB) AddColdBlob(blobHash []byte, size int64) error {
+	_, err := db.db.Exec("INSERT OR REPLACE INTO cold_blobs (blob_hash, size, stored) VALUES (?, ?, ?)",
+		blobHash, size, time.Now().Unix())
+	return err
+}
+
+// RemoveColdBlob forgets a blob deleted from cold storage
+func (db *EndershareDB) RemoveColdBlob(blobHash []byte) error {
+	_, err := db.db.Exec("DELETE FROM cold_blobs WHERE blob_hash = ?", blobHash)
+	return err
+}
+
+// GetColdBlobSize returns the size of a blob in cold storage, false if it isn't there
+func (db *EndershareDB) GetColdBlobSize(blobHash []byte) (int64, bool) {
+	var size int64
+	if err := db.db.QueryRow("SELECT size FROM cold_blobs WHERE blob_hash = ?", blobHash).Scan(&size); err != nil {
+		return 0, false
+	}
+	return size, true
+}
+
+// GetColdBlobs returns every blob in cold storage, oldest first
+func (db *EndershareDB) GetColdBlobs() []DBColdBlob {
+	rows, err := db.db.Query("SELECT blob_hash, size, stored FROM cold_blobs ORDER BY stored")
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	var blobs []DBColdBlob
+	for rows.Next() {
+		var b DBColdBlob
+		var stored int64
+		if err := rows.Scan(&b.BlobHash, &b.Size, &stored); err != nil {
+			continue
+		}
+		b.Stored = time.Unix(stored, 0)
+		blobs = append(blobs, b)
+	}
+	return blobs
+}
@@ -0,0 +1,34 @@
+package database
+
+import "time"
+
+// SetContentMetadata stores the encrypted output of a content processor for a blob
+func (db *EndershareDB) SetContentMetadata(fileHash []byte, processor string, data []byte) error {
+	_, err := db.db.Exec(`INSERT OR REPLACE INTO content_metadata (file_hash, processor, data, created)
+		VALUES (?, ?, ?, ?)`, fileHash, processor, data, time.Now().Unix())
+	return err
+}
+
+// GetContentMetadata returns the encrypted output of a content processor for a blob, nil if none
+func (db *EndershareDB) GetContentMetadata(fileHash []byte, processor string) []byte {
+	var data []byte
+	row := db.db.QueryRow("SELECT data FROM content_metadata WHERE file_hash = ? AND processor = ?", fileHash, processor)
+	if err := row.Scan(&data); err != nil {
+		return nil
+	}
+	return data
+}
+
+// HasContentMetadata reports whether a content processor already ran for a blob
+func (db *EndershareDB) HasContentMetadata(fileHash []byte, processor string) bool {
+	var n int
+	row := db.db.QueryRow("SELECT COUNT(*) FROM content_metadata WHERE file_hash = ? AND processor = ?", fileHash, processor)
+	return row.Scan(&n) == nil && n > 0
+}
+
+// DeleteUnreferencedContentMetadata removes processor output for blobs no entry refers to anymore
+func (db *EndershareDB) DeleteUnreferencedContentMetadata() error {
+	_, err := db.db.Exec(`DELETE FROM content_metadata
+		WHERE file_hash NOT IN (SELECT value FROM data WHERE value IS NOT NULL)`)
+	return err
+}
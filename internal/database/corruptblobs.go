@@ -0,0 +1,54 @@
+package database
+
+import "time"
+
+// DBCorruptBlob is a stored blob that failed an integrity check and has not
+// been downloaded again yet
+type DBCorruptBlob struct {
+	BlobHash []byte
+	Size     int64
+	Reason   string
+	Detected time.Time
+}
+
+// MarkBlobCorrupt records that a blob is missing or does not match its hash
+func (db *EndershareDB) MarkBlobCorrupt(blobHash []byte, size int64, reason string) error {
+	_, err := db.db.Exec(`INSERT INTO corrupt_blobs (blob_hash, size, reason, detected) VALUES (?, ?, ?, ?)
+		ON CONFLICT(blob_hash) DO UPDATE SET size = excluded.size, reason = excluded.reason`,
+		blobHash, size, reason, time.Now().Unix())
+	return err
+}
+
+// ClearBlobCorrupt removes the record of a repaired or no longer referenced blob
+func (db *EndershareDB) ClearBlobCorrupt(blobHash []byte) error {
+	_, err := db.db.Exec("DELETE FROM corrupt_blobs WHERE blob_hash = ?", blobHash)
+	return err
+}
+
+// GetCorruptBlobs returns the blobs awaiting repair, oldest first
+func (db *EndershareDB) GetCorruptBlobs() []DBCorruptBlob {
+	rows, err := db.db.Query("SELECT blob_hash, size, reason, detected FROM corrupt_blobs ORDER BY detected")
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	var blobs []DBCorruptBlob
+	for rows.Next() {
+		var b DBCorruptBlob
+		var detected int64
+		if err := rows.Scan(&b.BlobHash, &b.Size, &b.Reason, &detected); err != nil {
+			continue
+		}
+		b.Detected = time.Unix(detected, 0)
+		blobs = append(blobs, b)
+	}
+	return blobs
+}
+
+// CountCorruptBlobs returns the number of blobs awaiting repair
+func (db *EndershareDB) CountCorruptBlobs() int {
+	var n int
+	db.db.QueryRow("SELECT COUNT(*) FROM corrupt_blobs").Scan(&n)
+	return n
+}
@@ -9,20 +9,66 @@ import (
 )
 
 type DataEntry struct {
-	Key   []byte
-	Value []byte
-	Size  int64
-	Hash  []byte
+	Key      []byte
+	Value    []byte
+	Size     int64
+	Hash     []byte
+	KeyEpoch uint32 // Epoch of the key that encrypted Key and the blob
 }
 
-func (db *EndershareDB) PutData(key []byte, value []byte, size int64, hash []byte) error {
-	_, err := db.db.Exec("INSERT OR REPLACE INTO data (key, value, size, hash) VALUES (?, ?, ?, ?)", key, value, size, hash)
-	return err
+// DataChange describes a write to the data table. Exactly one field is set;
+// Reset means rows changed in bulk and anything derived from them is stale.
+type DataChange struct {
+	Put     *DataEntry
+	Deleted []byte       // Key of the deleted row
+	Batch   []DataChange // Puts and deletes committed together, see WriteDataBatch
+	Reset   bool
 }
 
-func (db *EndershareDB) PutDataWithTag(key []byte, value []byte, size int64, hash []byte, folderTag []byte) error {
-	_, err := db.db.Exec("INSERT OR REPLACE INTO data (key, value, size, hash, folder_tag) VALUES (?, ?, ?, ?, ?)", key, value, size, hash, folderTag)
-	return err
+// WatchData registers fn to be called after every write to the data table,
+// in commit order. fn must not write to the data table itself.
+func (db *EndershareDB) WatchData(fn func(DataChange)) {
+	db.dataMu.Lock()
+	defer db.dataMu.Unlock()
+	db.dataWatchers = append(db.dataWatchers, fn)
+}
+
+// writeData runs a data table write and tells the watchers if it succeeded
+func (db *EndershareDB) writeData(change DataChange, write func() error) error {
+	db.dataMu.Lock()
+	defer db.dataMu.Unlock()
+	if db.imports > 0 {
+		if err := db.journalChange(change); err != nil {
+			return err
+		}
+	}
+	if err := write(); err != nil {
+		return err
+	}
+	for _, fn := range db.dataWatchers {
+		fn(change)
+	}
+	return nil
+}
+
+// sharedProgress starts a new row at the download progress of the blob it
+// references, which other rows may have downloaded already
+const sharedProgress = "COALESCE((SELECT MAX(download_progress) FROM data WHERE value = ?), 0)"
+
+func (db *EndershareDB) PutData(key []byte, value []byte, size int64, hash []byte, keyEpoch uint32) error {
+	put := &DataEntry{Key: key, Value: value, Size: size, Hash: hash, KeyEpoch: keyEpoch}
+	return db.writeData(DataChange{Put: put}, func() error {
+		_, err := db.db.Exec("INSERT OR REPLACE INTO data (key, value, size, hash, key_epoch, download_progress) VALUES (?, ?, ?, ?, ?, "+sharedProgress+")", key, value, size, hash, keyEpoch, value)
+		return err
+	})
+}
+
+func (db *EndershareDB) PutDataWithTag(key []byte, value []byte, size int64, hash []byte, keyEpoch uint32, folderTag []byte) error {
+	put := &DataEntry{Key: key, Value: value, Size: size, Hash: hash, KeyEpoch: keyEpoch}
+	return db.writeData(DataChange{Put: put}, func() error {
+		_, err := db.db.Exec("INSERT OR REPLACE INTO data (key, value, size, hash, key_epoch, folder_tag, download_progress) VALUES (?, ?, ?, ?, ?, ?, "+sharedProgress+")", key, value, size, hash, keyEpoch, folderTag, value)
+		return err
+	})
 }
 
 func (db *EndershareDB) SetFolderTag(key []byte, folderTag []byte) error {
@@ -32,7 +78,7 @@ func (db *EndershareDB) SetFolderTag(key []byte, folderTag []byte) error {
 
 // GetDataByFolderTag returns entries matching a folder tag for fast folder listing
 func (db *EndershareDB) GetDataByFolderTag(folderTag []byte) ([]DataEntry, error) {
-	rows, err := db.db.Query("SELECT key, value, size, hash FROM data WHERE folder_tag = ?", folderTag)
+	rows, err := db.db.Query("SELECT key, value, size, hash, key_epoch FROM data WHERE folder_tag = ?", folderTag)
 	if err != nil {
 		return nil, err
 	}
@@ -41,7 +87,7 @@ func (db *EndershareDB) GetDataByFolderTag(folderTag []byte) ([]DataEntry, error
 	var entries []DataEntry
 	for rows.Next() {
 		var entry DataEntry
-		if err := rows.Scan(&entry.Key, &entry.Value, &entry.Size, &entry.Hash); err != nil {
+		if err := rows.Scan(&entry.Key, &entry.Value, &entry.Size, &entry.Hash, &entry.KeyEpoch); err != nil {
 			return nil, err
 		}
 		entries = append(entries, entry)
@@ -51,7 +97,7 @@ func (db *EndershareDB) GetDataByFolderTag(folderTag []byte) ([]DataEntry, error
 
 // GetDataWithNullFolderTag returns entries that don't have a folder_tag set yet
 func (db *EndershareDB) GetDataWithNullFolderTag() ([]DataEntry, error) {
-	rows, err := db.db.Query("SELECT key, value, size, hash FROM data WHERE folder_tag IS NULL")
+	rows, err := db.db.Query("SELECT key, value, size, hash, key_epoch FROM data WHERE folder_tag IS NULL")
 	if err != nil {
 		return nil, err
 	}
@@ -60,7 +106,7 @@ func (db *EndershareDB) GetDataWithNullFolderTag() ([]DataEntry, error) {
 	var entries []DataEntry
 	for rows.Next() {
 		var entry DataEntry
-		if err := rows.Scan(&entry.Key, &entry.Value, &entry.Size, &entry.Hash); err != nil {
+		if err := rows.Scan(&entry.Key, &entry.Value, &entry.Size, &entry.Hash, &entry.KeyEpoch); err != nil {
 			return nil, err
 		}
 		entries = append(entries, entry)
@@ -85,27 +131,116 @@ func (db *EndershareDB) GetData(key []byte) ([]byte, error) {
 	return nil, sql.ErrNoRows
 }
 
+// DataPut is a row written by WriteDataBatch. A nil FolderTag is backfilled
+// by the storage layer later, as for rows written by sync.
+type DataPut struct {
+	Entry     DataEntry
+	FolderTag []byte
+}
+
+// WriteDataBatch inserts puts and deletes the rows keyed by deletes in one
+// transaction, so readers and watchers see all of the batch or none of it.
+// Inserts go first, and new rows keep the download progress of rows with the
+// same blob, so replacing entries loses no progress.
+func (db *EndershareDB) WriteDataBatch(puts []DataPut, deletes [][]byte) error {
+	var changes []DataChange
+	for i := range puts {
+		changes = append(changes, DataChange{Put: &puts[i].Entry})
+	}
+	for _, key := range deletes {
+		changes = append(changes, DataChange{Deleted: key})
+	}
+	return db.writeData(DataChange{Batch: changes}, func() error {
+		tx, err := db.db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		for _, p := range puts {
+			e := p.Entry
+			if _, err := tx.Exec("INSERT OR REPLACE INTO data (key, value, size, hash, key_epoch, folder_tag, download_progress) VALUES (?, ?, ?, ?, ?, ?, "+sharedProgress+")", e.Key, e.Value, e.Size, e.Hash, e.KeyEpoch, p.FolderTag, e.Value); err != nil {
+				return err
+			}
+		}
+		for _, key := range deletes {
+			if _, err := tx.Exec("DELETE FROM data WHERE key = ?", key); err != nil {
+				return err
+			}
+		}
+		return tx.Commit()
+	})
+}
+
 func (db *EndershareDB) DeleteData(key []byte) error {
-	_, err := db.db.Exec("DELETE FROM data WHERE key = ?", key)
-	return err
+	return db.writeData(DataChange{Deleted: key}, func() error {
+		_, err := db.db.Exec("DELETE FROM data WHERE key = ?", key)
+		return err
+	})
 }
 
-func (db *EndershareDB) GetAllData() ([]DataEntry, error) {
-	rows, err := db.db.Query("SELECT key, value, size, hash FROM data")
+// dataPageSize is how many rows ForEachData and ForEachDataHash read per query
+const dataPageSize = 1000
+
+// ForEachData calls fn for every entry of the data table, reading it a page
+// at a time so memory stays bounded however large the vault is. No cursor is
+// open while fn runs, so fn may write to the database. Entries added during
+// the walk may or may not be visited. An error from fn stops the walk.
+func (db *EndershareDB) ForEachData(fn func(DataEntry) error) error {
+	var after int64
+	for {
+		page, last, err := db.dataPage(after)
+		if err != nil {
+			return err
+		}
+		for _, entry := range page {
+			if err := fn(entry); err != nil {
+				return err
+			}
+		}
+		if len(page) < dataPageSize {
+			return nil
+		}
+		after = last
+	}
+}
+
+// dataPage reads the entries following rowid after and returns the last rowid read
+func (db *EndershareDB) dataPage(after int64) ([]DataEntry, int64, error) {
+	rows, err := db.db.Query("SELECT rowid, key, value, size, hash, key_epoch FROM data WHERE rowid > ? ORDER BY rowid LIMIT ?", after, dataPageSize)
 	if err != nil {
-		return nil, err
+		return nil, after, err
 	}
 	defer rows.Close()
 
-	var entries []DataEntry
+	page := make([]DataEntry, 0, dataPageSize)
 	for rows.Next() {
 		var entry DataEntry
-		if err := rows.Scan(&entry.Key, &entry.Value, &entry.Size, &entry.Hash); err != nil {
-			return nil, err
+		if err := rows.Scan(&after, &entry.Key, &entry.Value, &entry.Size, &entry.Hash, &entry.KeyEpoch); err != nil {
+			return nil, after, err
 		}
-		entries = append(entries, entry)
+		page = append(page, entry)
 	}
-	return entries, nil
+	return page, after, rows.Err()
+}
+
+// GetDataByValue returns the entries referring to a blob
+func (db *EndershareDB) GetDataByValue(value []byte) []DataEntry {
+	rows, err := db.db.Query("SELECT key, value, size, hash, key_epoch FROM data WHERE value = ?", value)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	var entries []DataEntry
+	for rows.Next() {
+		var e DataEntry
+		if err := rows.Scan(&e.Key, &e.Value, &e.Size, &e.Hash, &e.KeyEpoch); err != nil {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries
 }
 
 func (db *EndershareDB) GetDataHash() ([]byte, error) {
@@ -128,9 +263,51 @@ func (db *EndershareDB) GetDataHash() ([]byte, error) {
 	return h.Sum(nil), nil
 }
 
-// GetAllDataHashes returns all hash column values for merkle tree construction
-func (db *EndershareDB) GetAllDataHashes() [][]byte {
-	rows, err := db.db.Query("SELECT hash FROM data ORDER BY hash")
+// ForEachDataHash calls fn with the hash of every data entry, in no
+// particular order, reading a page at a time like ForEachData
+func (db *EndershareDB) ForEachDataHash(fn func(hash []byte)) error {
+	var after int64
+	for {
+		rows, err := db.db.Query("SELECT rowid, hash FROM data WHERE rowid > ? ORDER BY rowid LIMIT ?", after, dataPageSize)
+		if err != nil {
+			return err
+		}
+		page := make([][]byte, 0, dataPageSize)
+		for rows.Next() {
+			var hash []byte
+			if err := rows.Scan(&after, &hash); err != nil {
+				continue
+			}
+			page = append(page, hash)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return err
+		}
+		for _, hash := range page {
+			fn(hash)
+		}
+		if len(page) < dataPageSize {
+			return nil
+		}
+	}
+}
+
+// CountData returns the number of entries in the data table
+func (db *EndershareDB) CountData() int {
+	var count int
+	if err := db.db.QueryRow("SELECT COUNT(*) FROM data").Scan(&count); err != nil {
+		return 0
+	}
+	return count
+}
+
+// GetBucketHashes returns data entry hashes for a specific bucket index
+func (db *EndershareDB) GetBucketHashes(bucketIdx int, numBuckets int) [][]byte {
+	start, end := computeBucketRange(bucketIdx, numBuckets)
+
+	rows, err := db.db.Query("SELECT hash FROM data WHERE hash >= ? AND hash < ? ORDER BY hash", start, end)
 	if err != nil {
 		return [][]byte{}
 	}
@@ -147,11 +324,11 @@ func (db *EndershareDB) GetAllDataHashes() [][]byte {
 	return hashes
 }
 
-// GetBucketHashes returns data entry hashes for a specific bucket index
-func (db *EndershareDB) GetBucketHashes(bucketIdx int, numBuckets int) [][]byte {
+// GetCurrentBucketHashes returns the hashes in a bucket that are not stale
+func (db *EndershareDB) GetCurrentBucketHashes(bucketIdx int, numBuckets int) [][]byte {
 	start, end := computeBucketRange(bucketIdx, numBuckets)
 
-	rows, err := db.db.Query("SELECT hash FROM data WHERE hash >= ? AND hash < ? ORDER BY hash", start, end)
+	rows, err := db.db.Query("SELECT hash FROM data WHERE hash >= ? AND hash < ? AND in_current = 1 ORDER BY hash", start, end)
 	if err != nil {
 		return [][]byte{}
 	}
@@ -176,25 +353,33 @@ func (db *EndershareDB) GetDataByHashes(hashes [][]byte) []DataEntry {
 
 	var entries []DataEntry
 	for _, hash := range hashes {
-		rows, err := db.db.Query("SELECT key, value, size, hash FROM data WHERE hash = ?", hash)
+		rows, err := db.db.Query("SELECT key, value, size, hash, key_epoch FROM data WHERE hash = ?", hash)
 		if err != nil {
 			continue
 		}
-		defer rows.Close()
-
 		if rows.Next() {
 			var entry DataEntry
-			if err := rows.Scan(&entry.Key, &entry.Value, &entry.Size, &entry.Hash); err == nil {
+			if err := rows.Scan(&entry.Key, &entry.Value, &entry.Size, &entry.Hash, &entry.KeyEpoch); err == nil {
 				entries = append(entries, entry)
 			}
 		}
+		rows.Close()
 	}
 	return entries
 }
 
-// MarkAllStale marks all entries as stale before sync
-func (db *EndershareDB) MarkAllStale() error {
-	_, err := db.db.Exec("UPDATE data SET in_current = 0")
+// MarkAllCurrent clears the stale marks left by an earlier sync before a
+// new one starts
+func (db *EndershareDB) MarkAllCurrent() error {
+	_, err := db.db.Exec("UPDATE data SET in_current = 1 WHERE in_current = 0")
+	return err
+}
+
+// MarkBucketStale marks the entries of a bucket as stale before the sync
+// compares it with a peer
+func (db *EndershareDB) MarkBucketStale(bucketIdx int, numBuckets int) error {
+	start, end := computeBucketRange(bucketIdx, numBuckets)
+	_, err := db.db.Exec("UPDATE data SET in_current = 0 WHERE hash >= ? AND hash < ?", start, end)
 	return err
 }
 
@@ -225,8 +410,10 @@ func (db *EndershareDB) GetStaleHashes() [][]byte {
 
 // DeleteStaleEntries deletes all stale entries (in_current = 0)
 func (db *EndershareDB) DeleteStaleEntries() error {
-	_, err := db.db.Exec("DELETE FROM data WHERE in_current = 0")
-	return err
+	return db.writeData(DataChange{Reset: true}, func() error {
+		_, err := db.db.Exec("DELETE FROM data WHERE in_current = 0")
+		return err
+	})
 }
 
 // SetDownloadProgress updates download progress for a file
@@ -235,22 +422,14 @@ func (db *EndershareDB) SetDownloadProgress(hash []byte, progress int64) error {
 	return err
 }
 
-// GetDownloadProgress returns download progress for a file (0 if not started, size of the file if complete)
+// GetDownloadProgress returns download progress for a file (0 if not started, size of the file if complete).
+// A blob referenced by several entries is as far along as the furthest of them.
 func (db *EndershareDB) GetDownloadProgress(hash []byte) int64 {
-	rows, err := db.db.Query("SELECT download_progress FROM data WHERE value = ?", hash)
-	if err != nil {
+	var progress int64
+	if err := db.db.QueryRow("SELECT COALESCE(MAX(download_progress), 0) FROM data WHERE value = ?", hash).Scan(&progress); err != nil {
 		return 0
 	}
-	defer rows.Close()
-
-	if rows.Next() {
-		var progress int64
-		if err := rows.Scan(&progress); err != nil {
-			return 0
-		}
-		return progress
-	}
-	return 0
+	return progress
 }
 
 // GetStorageStats returns total entry count and total size in bytes
@@ -263,14 +442,51 @@ func (db *EndershareDB) GetStorageStats() (int64, int64) {
 	return count, totalSize
 }
 
+// GetReplicationProgress returns how many file blobs and encrypted bytes are
+// stored locally out of the totals referenced by current entries
+func (db *EndershareDB) GetReplicationProgress() (completeFiles, totalFiles, storedBytes, totalBytes int64) {
+	row := db.db.QueryRow(`SELECT
+		COALESCE(SUM(CASE WHEN download_progress >= size THEN 1 ELSE 0 END), 0),
+		COUNT(*),
+		COALESCE(SUM(MIN(download_progress, size)), 0),
+		COALESCE(SUM(size), 0)
+		FROM data WHERE value IS NOT NULL AND in_current = 1`)
+	if err := row.Scan(&completeFiles, &totalFiles, &storedBytes, &totalBytes); err != nil {
+		return 0, 0, 0, 0
+	}
+	return completeFiles, totalFiles, storedBytes, totalBytes
+}
+
+// GetStoredBlobStats returns how many distinct blobs current entries
+// reference and how many of their encrypted bytes are stored locally. A blob
+// referenced by several entries counts once.
+func (db *EndershareDB) GetStoredBlobStats() (blobs, storedBytes int64) {
+	row := db.db.QueryRow(`SELECT COUNT(*), COALESCE(SUM(stored), 0) FROM (
+		SELECT MIN(MAX(download_progress), MAX(size)) AS stored
+		FROM data WHERE value IS NOT NULL AND in_current = 1 GROUP BY value)`)
+	if err := row.Scan(&blobs, &storedBytes); err != nil {
+		return 0, 0
+	}
+	return blobs, storedBytes
+}
+
 // computeBucketRange calculates the hash range for a bucket index
 // This matches the logic in merkletree.go:getBucketIndex()
+// Indices outside the tree come from peers and get an empty range.
 func computeBucketRange(bucketIdx int, numBuckets int) ([]byte, []byte) {
+	// One byte longer than a hash, so the range of the last bucket includes
+	// the all-ones hash
+	top := bytes.Repeat([]byte{0xFF}, 33)
+
 	if numBuckets <= 1 {
 		// Single bucket covers entire hash space
-		start := make([]byte, 32)
-		end := bytes.Repeat([]byte{0xFF}, 32)
-		return start, end
+		if bucketIdx != 0 {
+			return make([]byte, 32), make([]byte, 32)
+		}
+		return make([]byte, 32), top
+	}
+	if bucketIdx < 0 || bucketIdx >= numBuckets {
+		return make([]byte, 32), make([]byte, 32)
 	}
 
 	// Calculate bucket size: 2^256 / numBuckets
@@ -280,23 +496,19 @@ func computeBucketRange(bucketIdx int, numBuckets int) ([]byte, []byte) {
 	// Calculate start: bucketIdx * bucketSize
 	startInt := new(big.Int).Mul(big.NewInt(int64(bucketIdx)), bucketSize)
 
-	// Calculate end: (bucketIdx + 1) * bucketSize
-	endInt := new(big.Int).Mul(big.NewInt(int64(bucketIdx+1)), bucketSize)
+	// Convert to byte slices (pad to 32 bytes)
+	start := make([]byte, 32)
+	startInt.FillBytes(start)
 
-	// Handle last bucket to cover remainder
+	// Last bucket covers the remainder
 	if bucketIdx == numBuckets-1 {
-		endInt = new(big.Int).Set(maxHash)
+		return start, top
 	}
 
-	// Convert to byte slices (pad to 32 bytes)
-	start := make([]byte, 32)
+	// Calculate end: (bucketIdx + 1) * bucketSize
+	endInt := new(big.Int).Mul(big.NewInt(int64(bucketIdx+1)), bucketSize)
 	end := make([]byte, 32)
-
-	startBytes := startInt.Bytes()
-	endBytes := endInt.Bytes()
-
-	copy(start[32-len(startBytes):], startBytes)
-	copy(end[32-len(endBytes):], endBytes)
+	endInt.FillBytes(end)
 
 	return start, end
 }
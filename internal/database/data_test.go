@@ -0,0 +1,36 @@
+package database
+
+import (
+	"encoding/binary"
+	"path/filepath"
+	"testing"
+
+	"github.com/notassigned/endershare/internal/crypto"
+)
+
+// ingestBatchSize matches the hashes per metadata request batch
+const ingestBatchSize = 256
+
+// BenchmarkMetadataIngest measures storing one metadata batch received during
+// sync: each entry is written to the database and inserted into the tree
+func BenchmarkMetadataIngest(b *testing.B) {
+	db := Open(filepath.Join(b.TempDir(), "endershare.db"))
+	defer db.Close()
+
+	tree := crypto.NewMerkleTree(nil)
+	key := make([]byte, 160) // About the size of encrypted file metadata
+	value := make([]byte, 32)
+	b.SetBytes(int64(ingestBatchSize * (len(key) + len(value))))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < ingestBatchSize; j++ {
+			binary.BigEndian.PutUint64(key, uint64(i*ingestBatchSize+j))
+			copy(value, key[:8])
+			hash := crypto.ComputeDataHash(key, value, 1)
+			if err := db.PutData(key, value, 1, hash, 0); err != nil {
+				b.Fatal(err)
+			}
+			tree.Insert(hash)
+		}
+	}
+}
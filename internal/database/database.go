@@ -2,23 +2,64 @@ package database
 
 import (
 	"database/sql"
+	"fmt"
 	"log"
+	"sync"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
 type EndershareDB struct {
-	db *sql.DB
+	db   *sql.DB
+	path string
+
+	dataMu       sync.Mutex // Serializes data table writes with their notifications
+	dataWatchers []func(DataChange)
+	imports      int // Open imports journaling data writes, see BeginImport
+}
+
+// columnMigration adds a column to an existing table if it is missing.
+// New columns must be nullable or carry a default so existing rows stay valid.
+type columnMigration struct {
+	table      string
+	column     string
+	definition string
+}
+
+// columnMigrations are applied in order on every startup
+var columnMigrations = []columnMigration{
+	{table: "data", column: "key_epoch", definition: "INTEGER DEFAULT 0"},
+	{table: "peers", column: "label", definition: "TEXT NULL"},
+	{table: "peers", column: "unverified_addrs", definition: "TEXT NULL"},
 }
 
 // The node table stores key-value pairs for this node
 // The data table stores data replicated between nodes
 func Create() *EndershareDB {
-	db, err := sql.Open("sqlite3", "./endershare.db")
+	return Open(Path())
+}
+
+// Open opens the database at path, creating it if needed. The backup is kept
+// next to it. Create opens the default path in the working directory, or
+// where the database was moved to, see Path.
+func Open(path string) *EndershareDB {
+	db, err := sql.Open("sqlite3", path)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	// A corrupted database is moved aside and rebuilt instead of failing startup
+	healthy := true
+	var salvaged map[string]string
+	if err := checkIntegrity(db); err != nil {
+		healthy = false
+		db.Close()
+		db, salvaged, err = recoverDatabase(path, err)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	createTables := `
 	CREATE TABLE IF NOT EXISTS node (
         key TEXT NOT NULL PRIMARY KEY,
@@ -31,21 +72,226 @@ func Create() *EndershareDB {
 		hash BLOB NOT NULL,
 		in_current BOOLEAN DEFAULT 1,
 		download_progress INTEGER DEFAULT 0,
-		folder_tag BLOB NULL
+		folder_tag BLOB NULL,
+		key_epoch INTEGER DEFAULT 0
     );
 	CREATE INDEX IF NOT EXISTS idx_data_hash ON data(hash);
 	CREATE INDEX IF NOT EXISTS idx_data_folder_tag ON data(folder_tag);
 	CREATE TABLE IF NOT EXISTS peers (
 		peer_id TEXT PRIMARY KEY,
-		addrs TEXT NULL
+		addrs TEXT NULL,
+		label TEXT NULL,
+		unverified_addrs TEXT NULL
+	);
+	CREATE TABLE IF NOT EXISTS former_peers (
+		peer_id TEXT PRIMARY KEY,
+		addrs TEXT NULL,
+		label TEXT NULL,
+		banned BOOLEAN NOT NULL DEFAULT 0,
+		removed INTEGER NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS peer_records (
+		peer_id TEXT PRIMARY KEY,
+		addrs TEXT NOT NULL,
+		latency_us INTEGER NOT NULL DEFAULT 0,
+		protocols TEXT NULL,
+		updated INTEGER NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS transfer_receipts (
+		receipt_id BLOB PRIMARY KEY,
+		file_hash BLOB NOT NULL,
+		server TEXT NOT NULL,
+		receiver TEXT NOT NULL,
+		bytes INTEGER NOT NULL,
+		duration_ms INTEGER NOT NULL,
+		verified BOOLEAN NOT NULL,
+		timestamp INTEGER NOT NULL,
+		signed_json TEXT NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_transfer_receipts_receiver ON transfer_receipts(receiver, timestamp);
+	CREATE TABLE IF NOT EXISTS storage_proofs (
+		peer_id TEXT NOT NULL,
+		file_hash BLOB NOT NULL,
+		passed BOOLEAN NOT NULL,
+		error TEXT NULL,
+		timestamp INTEGER NOT NULL,
+		PRIMARY KEY (peer_id, file_hash)
+	);
+	CREATE TABLE IF NOT EXISTS device_status (
+		peer_id TEXT PRIMARY KEY,
+		free_bytes INTEGER NOT NULL,
+		cap_bytes INTEGER NOT NULL,
+		stored_bytes INTEGER NOT NULL,
+		timestamp INTEGER NOT NULL,
+		signed_json TEXT NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS quarantine (
+		entry_hash BLOB NOT NULL,
+		peer_id TEXT NOT NULL,
+		kind TEXT NOT NULL,
+		reason TEXT NOT NULL,
+		failures INTEGER NOT NULL,
+		first_seen INTEGER NOT NULL,
+		last_seen INTEGER NOT NULL,
+		PRIMARY KEY (entry_hash, peer_id, kind)
+	);
+	CREATE TABLE IF NOT EXISTS content_metadata (
+		file_hash BLOB NOT NULL,
+		processor TEXT NOT NULL,
+		data BLOB NOT NULL,
+		created INTEGER NOT NULL,
+		PRIMARY KEY (file_hash, processor)
+	);
+	CREATE TABLE IF NOT EXISTS pending_blobs (
+		blob_hash BLOB PRIMARY KEY,
+		created INTEGER NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS import_journal (
+		key BLOB PRIMARY KEY,
+		existed BOOLEAN NOT NULL,
+		value BLOB NULL,
+		size INTEGER NOT NULL DEFAULT 0,
+		hash BLOB NULL,
+		download_progress INTEGER DEFAULT 0,
+		folder_tag BLOB NULL,
+		key_epoch INTEGER DEFAULT 0
+	);
+	CREATE TABLE IF NOT EXISTS corrupt_blobs (
+		blob_hash BLOB PRIMARY KEY,
+		size INTEGER NOT NULL,
+		reason TEXT NOT NULL,
+		detected INTEGER NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS blob_refs (
+		blob_hash BLOB PRIMARY KEY,
+		refs INTEGER NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS content_hashes (
+		content_hash BLOB PRIMARY KEY,
+		blob_hash BLOB NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS protocol_errors (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		peer_id TEXT NOT NULL,
+		protocol TEXT NOT NULL,
+		phase TEXT NOT NULL,
+		error TEXT NOT NULL,
+		timestamp INTEGER NOT NULL
 	);
+	CREATE INDEX IF NOT EXISTS idx_protocol_errors_peer ON protocol_errors(peer_id, id);
 	CREATE TABLE IF NOT EXISTS updates (
 		update_id INTEGER PRIMARY KEY,
 		signed_update_json TEXT NOT NULL
 	);
+	CREATE TABLE IF NOT EXISTS api_tokens (
+		token_id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		secret_hash BLOB NOT NULL,
+		scope TEXT NOT NULL,
+		folder_id TEXT NULL,
+		created INTEGER NOT NULL,
+		expires INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE TABLE IF NOT EXISTS cold_blobs (
+		blob_hash BLOB PRIMARY KEY,
+		size INTEGER NOT NULL,
+		stored INTEGER NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS sync_progress (
+		bucket INTEGER PRIMARY KEY,
+		num_buckets INTEGER NOT NULL,
+		tree_hash BLOB NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS update_acks (
+		peer_id TEXT PRIMARY KEY,
+		update_id INTEGER NOT NULL,
+		timestamp INTEGER NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS intents (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		summary TEXT NOT NULL,
+		state TEXT NOT NULL,
+		error TEXT NULL,
+		created INTEGER NOT NULL,
+		first_update INTEGER NOT NULL DEFAULT 0,
+		last_update INTEGER NOT NULL DEFAULT 0,
+		targets TEXT NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS vault_stats (
+		update_id INTEGER PRIMARY KEY,
+		timestamp INTEGER NOT NULL,
+		file_count INTEGER NOT NULL,
+		folder_count INTEGER NOT NULL,
+		logical_bytes INTEGER NOT NULL,
+		stored_bytes INTEGER NOT NULL
+	);
 	`
 	if _, err := db.Exec(createTables); err != nil {
 		log.Fatal(err)
 	}
-	return &EndershareDB{db: db}
+	e := &EndershareDB{db: db, path: path}
+	if err := e.migrateColumns(); err != nil {
+		log.Fatal(err)
+	}
+	if err := e.createBlobRefTriggers(); err != nil {
+		log.Fatal(err)
+	}
+	for key, value := range salvaged {
+		if err := e.setNodeProperty(key, value); err != nil {
+			fmt.Println("Warning: Failed to restore node property", key+":", err)
+		}
+	}
+
+	if healthy {
+		if err := e.Backup(); err != nil {
+			fmt.Println("Warning: Failed to back up database:", err)
+		}
+	} else if err := e.SetUnsynced(true); err != nil {
+		fmt.Println("Warning: Failed to mark recovered database as unsynced:", err)
+	}
+	return e
+}
+
+// Close closes the database
+func (db *EndershareDB) Close() error {
+	return db.db.Close()
+}
+
+// migrateColumns brings tables created by older versions up to the current schema
+func (db *EndershareDB) migrateColumns() error {
+	for _, m := range columnMigrations {
+		exists, err := db.columnExists(m.table, m.column)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		stmt := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", m.table, m.column, m.definition)
+		if _, err := db.db.Exec(stmt); err != nil {
+			return fmt.Errorf("failed to add column %s.%s: %w", m.table, m.column, err)
+		}
+	}
+	return nil
+}
+
+func (db *EndershareDB) columnExists(table, column string) (bool, error) {
+	rows, err := db.db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
 }
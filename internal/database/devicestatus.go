@@ -0,0 +1,37 @@
+package database
+
+// DBDeviceStatus is the latest storage capacity a peer reported to the master
+type DBDeviceStatus struct {
+	PeerID      string
+	FreeBytes   int64
+	CapBytes    int64
+	StoredBytes int64
+	Timestamp   int64
+	SignedJSON  string
+}
+
+// SetDeviceStatus stores a peer's status, replacing the one it reported before
+func (db *EndershareDB) SetDeviceStatus(s DBDeviceStatus) error {
+	_, err := db.db.Exec(`INSERT OR REPLACE INTO device_status (peer_id, free_bytes, cap_bytes, stored_bytes, timestamp, signed_json)
+		VALUES (?, ?, ?, ?, ?, ?)`, s.PeerID, s.FreeBytes, s.CapBytes, s.StoredBytes, s.Timestamp, s.SignedJSON)
+	return err
+}
+
+// GetDeviceStatuses returns the latest status of every peer that reported one
+func (db *EndershareDB) GetDeviceStatuses() []DBDeviceStatus {
+	rows, err := db.db.Query("SELECT peer_id, free_bytes, cap_bytes, stored_bytes, timestamp, signed_json FROM device_status")
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	var statuses []DBDeviceStatus
+	for rows.Next() {
+		var s DBDeviceStatus
+		if err := rows.Scan(&s.PeerID, &s.FreeBytes, &s.CapBytes, &s.StoredBytes, &s.Timestamp, &s.SignedJSON); err != nil {
+			continue
+		}
+		statuses = append(statuses, s)
+	}
+	return statuses
+}
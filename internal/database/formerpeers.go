@@ -0,0 +1,86 @@
+package database
+
+import (
+	"strings"
+	"time"
+)
+
+// DBFormerPeer is a peer that was removed from the peer list. Its record is
+// kept so the device can be restored with its settings when it binds again,
+// unless it was banned.
+type DBFormerPeer struct {
+	PeerID    string
+	Addresses []string
+	Label     string
+	Banned    bool
+	RemovedAt time.Time
+}
+
+// RetirePeer removes a peer from the peer list and keeps its record as a
+// former peer. A banned peer is not allowed to bind again.
+func (db *EndershareDB) RetirePeer(peerID string, banned bool) error {
+	tx, err := db.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`INSERT INTO former_peers (peer_id, addrs, label, banned, removed)
+		SELECT peer_id, addrs, label, ?, ? FROM peers WHERE peer_id = ?
+		ON CONFLICT(peer_id) DO UPDATE SET
+			addrs = excluded.addrs, label = excluded.label, banned = excluded.banned, removed = excluded.removed`,
+		banned, time.Now().Unix(), peerID)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM peers WHERE peer_id = ?", peerID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetFormerPeer returns the record of a removed peer, or nil
+func (db *EndershareDB) GetFormerPeer(peerID string) *DBFormerPeer {
+	peers := db.queryFormerPeers(`SELECT peer_id, COALESCE(addrs, ''), COALESCE(label, ''), banned, removed
+		FROM former_peers WHERE peer_id = ?`, peerID)
+	if len(peers) == 0 {
+		return nil
+	}
+	return &peers[0]
+}
+
+// GetFormerPeers returns every removed peer, most recently removed first
+func (db *EndershareDB) GetFormerPeers() []DBFormerPeer {
+	return db.queryFormerPeers(`SELECT peer_id, COALESCE(addrs, ''), COALESCE(label, ''), banned, removed
+		FROM former_peers ORDER BY removed DESC`)
+}
+
+// ForgetFormerPeer drops the record of a removed peer, lifting a ban
+func (db *EndershareDB) ForgetFormerPeer(peerID string) error {
+	_, err := db.db.Exec("DELETE FROM former_peers WHERE peer_id = ?", peerID)
+	return err
+}
+
+func (db *EndershareDB) queryFormerPeers(query string, args ...interface{}) []DBFormerPeer {
+	rows, err := db.db.Query(query, args...)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	var peers []DBFormerPeer
+	for rows.Next() {
+		var p DBFormerPeer
+		var addresses string
+		var removed int64
+		if err := rows.Scan(&p.PeerID, &addresses, &p.Label, &p.Banned, &removed); err != nil {
+			continue
+		}
+		if addresses != "" {
+			p.Addresses = strings.Split(addresses, "\n")
+		}
+		p.RemovedAt = time.Unix(removed, 0)
+		peers = append(peers, p)
+	}
+	return peers
+}
@@ -0,0 +1,124 @@
+package database
+
+import "fmt"
+
+// The import journal makes a folder import all or nothing on this node.
+// While an import is open every write to the data table first records how to
+// undo it: the row the key held before the import, or that it had none. A
+// journal left over at startup belongs to an import that crashed part-way and
+// RollbackImport restores the data table to how it was before it began.
+// Other local writes made while an import runs are journaled with it. Bulk
+// resets, which only sync performs, are not journaled.
+
+// BeginImport opens the import journal. Imports may overlap; the journal is
+// cleared when the last one ends.
+func (db *EndershareDB) BeginImport() {
+	db.dataMu.Lock()
+	defer db.dataMu.Unlock()
+	db.imports++
+}
+
+// EndImport closes an import opened with BeginImport, keeping its writes
+func (db *EndershareDB) EndImport() error {
+	db.dataMu.Lock()
+	defer db.dataMu.Unlock()
+	if db.imports == 0 {
+		return nil
+	}
+	db.imports--
+	if db.imports > 0 {
+		return nil
+	}
+	_, err := db.db.Exec("DELETE FROM import_journal")
+	return err
+}
+
+// journalChange records the rows a data write is about to replace or
+// delete. Only the first write to a key is kept, since that holds the row
+// from before the import. Called with dataMu held.
+func (db *EndershareDB) journalChange(change DataChange) error {
+	switch {
+	case change.Put != nil:
+		return db.journalKey(change.Put.Key)
+	case change.Deleted != nil:
+		return db.journalKey(change.Deleted)
+	}
+	for _, c := range change.Batch {
+		if err := db.journalChange(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *EndershareDB) journalKey(key []byte) error {
+	_, err := db.db.Exec(`INSERT OR IGNORE INTO import_journal (key, existed, value, size, hash, download_progress, folder_tag, key_epoch)
+		SELECT ?, EXISTS (SELECT 1 FROM data WHERE key = ?),
+			d.value, COALESCE(d.size, 0), d.hash, COALESCE(d.download_progress, 0), d.folder_tag, COALESCE(d.key_epoch, 0)
+		FROM (SELECT 1) LEFT JOIN data d ON d.key = ?`, key, key, key)
+	if err != nil {
+		return fmt.Errorf("failed to journal import write: %w", err)
+	}
+	return nil
+}
+
+// RollbackImport undoes the writes of an import that never ended and returns
+// the rows it removed, whose blobs may no longer be referenced. It does
+// nothing while an import of this process is open.
+func (db *EndershareDB) RollbackImport() ([]DataEntry, error) {
+	var removed []DataEntry
+	db.dataMu.Lock()
+	pending := db.imports == 0 && db.importJournaled()
+	db.dataMu.Unlock()
+	if !pending {
+		return nil, nil
+	}
+
+	err := db.writeData(DataChange{Reset: true}, func() error {
+		tx, err := db.db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		rows, err := tx.Query("SELECT d.key, d.value, d.size, d.hash, d.key_epoch FROM import_journal j JOIN data d ON d.key = j.key WHERE NOT j.existed")
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var e DataEntry
+			if err := rows.Scan(&e.Key, &e.Value, &e.Size, &e.Hash, &e.KeyEpoch); err != nil {
+				rows.Close()
+				return err
+			}
+			removed = append(removed, e)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec("DELETE FROM data WHERE key IN (SELECT key FROM import_journal WHERE NOT existed)"); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`INSERT OR REPLACE INTO data (key, value, size, hash, download_progress, folder_tag, key_epoch)
+			SELECT key, value, size, hash, download_progress, folder_tag, key_epoch FROM import_journal WHERE existed`); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("DELETE FROM import_journal"); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return removed, nil
+}
+
+// importJournaled reports whether the import journal holds any rows
+func (db *EndershareDB) importJournaled() bool {
+	var n int
+	err := db.db.QueryRow("SELECT COUNT(*) FROM import_journal").Scan(&n)
+	return err == nil && n > 0
+}
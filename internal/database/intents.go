@@ -0,0 +1,124 @@
+package database
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// maxIntents is how many operations the intent log keeps, the oldest are
+// dropped past it
+const maxIntents = 500
+
+// Intent states
+const (
+	IntentPending   = "pending"   // Recorded before the operation ran, still running or interrupted
+	IntentPublished = "published" // Done, its updates are on their way to the peers
+	IntentFailed    = "failed"    // Nothing was published
+)
+
+// DBIntent is an operation of the master recorded in its intent log, with
+// the updates it published
+type DBIntent struct {
+	ID          int64
+	Summary     string
+	State       string
+	Error       string
+	Created     time.Time
+	FirstUpdate uint64   // First update published for it, 0 until it is published
+	LastUpdate  uint64   // Peers that applied this one have the whole operation
+	Targets     []string // Peers that were to receive it
+}
+
+// DBUpdateAck is the latest update a peer acknowledged having applied
+type DBUpdateAck struct {
+	PeerID    string
+	UpdateID  uint64
+	Timestamp int64
+}
+
+// AddIntent records an operation about to run before it does, as pending,
+// and returns its ID
+func (db *EndershareDB) AddIntent(summary string, targets []string) (int64, error) {
+	targetsJSON, err := json.Marshal(targets)
+	if err != nil {
+		return 0, err
+	}
+	res, err := db.db.Exec("INSERT INTO intents (summary, state, created, targets) VALUES (?, ?, ?, ?)",
+		summary, IntentPending, time.Now().Unix(), string(targetsJSON))
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	_, err = db.db.Exec("DELETE FROM intents WHERE id <= ?", id-maxIntents)
+	return id, err
+}
+
+// FinishIntent records how an operation ended and the range of updates it
+// published, errText empty if it succeeded
+func (db *EndershareDB) FinishIntent(id int64, state, errText string, firstUpdate, lastUpdate uint64) error {
+	_, err := db.db.Exec("UPDATE intents SET state = ?, error = NULLIF(?, ''), first_update = ?, last_update = ? WHERE id = ?",
+		state, errText, firstUpdate, lastUpdate, id)
+	return err
+}
+
+// FailPendingIntents marks the operations still pending, which a restart
+// interrupted, as failed with errText
+func (db *EndershareDB) FailPendingIntents(errText string) error {
+	_, err := db.db.Exec("UPDATE intents SET state = ?, error = ? WHERE state = ?", IntentFailed, errText, IntentPending)
+	return err
+}
+
+// GetIntents returns the most recent operations, newest first
+func (db *EndershareDB) GetIntents(limit int) []DBIntent {
+	rows, err := db.db.Query(`SELECT id, summary, state, COALESCE(error, ''), created, first_update, last_update, targets
+		FROM intents ORDER BY id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	var intents []DBIntent
+	for rows.Next() {
+		var in DBIntent
+		var created int64
+		var targets string
+		if err := rows.Scan(&in.ID, &in.Summary, &in.State, &in.Error, &created, &in.FirstUpdate, &in.LastUpdate, &targets); err != nil {
+			continue
+		}
+		in.Created = time.Unix(created, 0)
+		json.Unmarshal([]byte(targets), &in.Targets)
+		intents = append(intents, in)
+	}
+	return intents
+}
+
+// SetUpdateAck records the update a peer acknowledged, unless it
+// acknowledged a later one before
+func (db *EndershareDB) SetUpdateAck(peerID string, updateID uint64, timestamp int64) error {
+	_, err := db.db.Exec(`INSERT INTO update_acks (peer_id, update_id, timestamp) VALUES (?, ?, ?)
+		ON CONFLICT(peer_id) DO UPDATE SET update_id = MAX(update_id, excluded.update_id), timestamp = excluded.timestamp`,
+		peerID, updateID, timestamp)
+	return err
+}
+
+// GetUpdateAcks returns the latest acknowledgement of every peer, by peer ID
+func (db *EndershareDB) GetUpdateAcks() map[string]DBUpdateAck {
+	rows, err := db.db.Query("SELECT peer_id, update_id, timestamp FROM update_acks")
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	acks := make(map[string]DBUpdateAck)
+	for rows.Next() {
+		var a DBUpdateAck
+		if err := rows.Scan(&a.PeerID, &a.UpdateID, &a.Timestamp); err != nil {
+			continue
+		}
+		acks[a.PeerID] = a
+	}
+	return acks
+}
@@ -0,0 +1,73 @@
+package database
+
+import "time"
+
+// Pending blobs journal the window between writing a blob into the data
+// directory and committing the metadata row that references it. A blob still
+// pending at startup was never committed and can be removed.
+
+// AddPendingBlob records that a blob is about to be moved into place
+func (db *EndershareDB) AddPendingBlob(blobHash []byte) error {
+	_, err := db.db.Exec("INSERT OR REPLACE INTO pending_blobs (blob_hash, created) VALUES (?, ?)", blobHash, time.Now().Unix())
+	return err
+}
+
+// RemovePendingBlob clears a pending blob record
+func (db *EndershareDB) RemovePendingBlob(blobHash []byte) error {
+	_, err := db.db.Exec("DELETE FROM pending_blobs WHERE blob_hash = ?", blobHash)
+	return err
+}
+
+// GetPendingBlobs returns the hashes of blobs whose metadata was never committed
+func (db *EndershareDB) GetPendingBlobs() [][]byte {
+	rows, err := db.db.Query("SELECT blob_hash FROM pending_blobs")
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	var hashes [][]byte
+	for rows.Next() {
+		var hash []byte
+		if err := rows.Scan(&hash); err != nil {
+			continue
+		}
+		hashes = append(hashes, hash)
+	}
+	return hashes
+}
+
+// CommitBlobData inserts a data row and clears its pending blob record in one transaction
+func (db *EndershareDB) CommitBlobData(key []byte, value []byte, size int64, hash []byte, keyEpoch uint32, folderTag []byte) error {
+	put := &DataEntry{Key: key, Value: value, Size: size, Hash: hash, KeyEpoch: keyEpoch}
+	return db.writeData(DataChange{Put: put}, func() error {
+		return db.commitBlobData(key, value, size, hash, keyEpoch, folderTag)
+	})
+}
+
+func (db *EndershareDB) commitBlobData(key []byte, value []byte, size int64, hash []byte, keyEpoch uint32, folderTag []byte) error {
+	tx, err := db.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// The blob is already in place, so it counts as fully downloaded
+	if _, err := tx.Exec("INSERT OR REPLACE INTO data (key, value, size, hash, key_epoch, folder_tag, download_progress) VALUES (?, ?, ?, ?, ?, ?, ?)", key, value, size, hash, keyEpoch, folderTag, size); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM pending_blobs WHERE blob_hash = ?", value); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// BlobReferenced reports whether any data row points at the blob
+func (db *EndershareDB) BlobReferenced(blobHash []byte) bool {
+	var count int
+	if err := db.db.QueryRow("SELECT COUNT(*) FROM data WHERE value = ?", blobHash).Scan(&count); err != nil {
+		// Err on the side of keeping the blob
+		return true
+	}
+	return count > 0
+}
@@ -61,6 +61,30 @@ func (db *EndershareDB) GetKeys() *crypto.CryptoKeys {
 	return crypto.NewCryptoKeysFromBytes(mpriv, ppriv, aesKey)
 }
 
+// GetPeerKeys returns the stored peer keys of a node without the vault key,
+// with the master public key if the node is bound. Returns nil if no peer
+// key was stored.
+func (db *EndershareDB) GetPeerKeys() *crypto.CryptoKeys {
+	encoded, err := db.getNodeProperty("peer_private_key")
+	if err != nil || encoded == "" {
+		return nil
+	}
+	ppriv, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(ppriv) != ed25519.PrivateKeySize {
+		return nil
+	}
+
+	peerPrivateKey := ed25519.PrivateKey(ppriv)
+	keys := &crypto.CryptoKeys{
+		PeerPrivateKey: peerPrivateKey,
+		PeerPublicKey:  peerPrivateKey.Public().(ed25519.PublicKey),
+	}
+	if masterPub, err := db.GetMasterPubKey(); err == nil && len(masterPub) == ed25519.PublicKeySize {
+		keys.MasterPublicKey = masterPub
+	}
+	return keys
+}
+
 // StoreKeys saves the master private key, peer private key, and AES key into the database
 // StoreKeys also inserts the peer's public key into the peers table
 func (db *EndershareDB) StoreKeys(keys *crypto.CryptoKeys) {
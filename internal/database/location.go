@@ -0,0 +1,155 @@
+package database
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// locationPath holds the path of a database moved away from dbPath
+const locationPath = "./endershare.location"
+
+// Path returns the database Create opens: dbPath, unless SetPath moved it
+func Path() string {
+	data, err := os.ReadFile(locationPath)
+	if err != nil {
+		return dbPath
+	}
+	if path := strings.TrimSpace(string(data)); path != "" {
+		return path
+	}
+	return dbPath
+}
+
+// SetPath makes Create open the database at path from now on, dbPath for the
+// default. The switch is atomic: Create opens either database, never neither.
+func SetPath(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if defaultAbs, err := filepath.Abs(dbPath); err == nil && abs == defaultAbs {
+		if err := os.Remove(locationPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	tmpPath := locationPath + ".tmp"
+	if err := os.WriteFile(tmpPath, []byte(abs+"\n"), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, locationPath)
+}
+
+// Path returns the file the database was opened from
+func (db *EndershareDB) Path() string {
+	return db.path
+}
+
+// CopyTo writes a consistent copy of the database to path, which must not
+// exist, with props set as node properties in the copy. The copy only
+// appears at path once it passed an integrity check and holds the same data
+// and peers as the database.
+func (db *EndershareDB) CopyTo(path string, props map[string]string) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%s already holds a database", path)
+	}
+	want, err := contentChecksum(db.db)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := path + ".tmp"
+	os.Remove(tmpPath)
+	if _, err := db.db.Exec("VACUUM INTO ?", tmpPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := finishCopy(tmpPath, props, want); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// finishCopy sets props in the copy at path and verifies it against the
+// checksum of the original
+func finishCopy(path string, props map[string]string, want []byte) error {
+	copied, err := openChecked(path)
+	if err != nil {
+		return fmt.Errorf("copied database: %w", err)
+	}
+	defer copied.Close()
+	for key, value := range props {
+		if _, err := copied.Exec("INSERT OR REPLACE INTO node (key, value) VALUES (?, ?)", key, value); err != nil {
+			return err
+		}
+	}
+	got, err := contentChecksum(copied)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(got, want) {
+		return fmt.Errorf("copied database does not match the original")
+	}
+	return nil
+}
+
+// contentChecksum hashes the data and peer rows of a database in a fixed
+// order, so a copy can be compared to its original
+func contentChecksum(db *sql.DB) ([]byte, error) {
+	h := sha256.New()
+	rows, err := db.Query("SELECT key, value, size, hash, COALESCE(download_progress, 0) FROM data ORDER BY key")
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var key, value, hash []byte
+		var size, progress int64
+		if err := rows.Scan(&key, &value, &size, &hash, &progress); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		for _, b := range [][]byte{key, value, hash} {
+			binary.Write(h, binary.BigEndian, uint32(len(b)))
+			h.Write(b)
+		}
+		binary.Write(h, binary.BigEndian, size)
+		binary.Write(h, binary.BigEndian, progress)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query("SELECT peer_id, COALESCE(addrs, '') FROM peers ORDER BY peer_id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var peerID, addrs string
+		if err := rows.Scan(&peerID, &addrs); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(h, "%d:%s%d:%s", len(peerID), peerID, len(addrs), addrs)
+	}
+	return h.Sum(nil), rows.Err()
+}
+
+// Remove deletes the database at path along with its backup. It must not be
+// open anymore.
+func Remove(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Remove(backupPath(path)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/base64"
 	"fmt"
 	"strconv"
+	"time"
 )
 
 func (db *EndershareDB) getNodeProperty(key string) (string, error) {
@@ -72,6 +73,23 @@ func (db *EndershareDB) SetPeerListHash(hash []byte) error {
 	return db.setNodeProperty("peer_list_hash", base64.StdEncoding.EncodeToString(hash))
 }
 
+// GetPeerListHashVersion returns the encoding version of the stored peer_list_hash (1 if never recorded)
+func (db *EndershareDB) GetPeerListHashVersion() int {
+	s, err := db.getNodeProperty("peer_list_hash_version")
+	if err != nil {
+		return 1
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 1
+	}
+	return v
+}
+
+func (db *EndershareDB) SetPeerListHashVersion(version int) error {
+	return db.setNodeProperty("peer_list_hash_version", strconv.Itoa(version))
+}
+
 func (db *EndershareDB) GetLatestUpdateJSON() (string, error) {
 	return db.getNodeProperty("latest_update")
 }
@@ -80,6 +98,502 @@ func (db *EndershareDB) SetLatestUpdateJSON(jsonStr string) error {
 	return db.setNodeProperty("latest_update", jsonStr)
 }
 
+// GetDigestKey returns the key vault digests are keyed with, or nil if this
+// node has not received it
+func (db *EndershareDB) GetDigestKey() []byte {
+	s, err := db.getNodeProperty("digest_key")
+	if err != nil {
+		return nil
+	}
+	key, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || len(key) != 32 {
+		return nil
+	}
+	return key
+}
+
+func (db *EndershareDB) SetDigestKey(key []byte) error {
+	return db.setNodeProperty("digest_key", base64.StdEncoding.EncodeToString(key))
+}
+
+// GetKeyEpoch returns the newest key epoch this node has seen (0 if never recorded)
+func (db *EndershareDB) GetKeyEpoch() uint32 {
+	s, err := db.getNodeProperty("key_epoch")
+	if err != nil {
+		return 0
+	}
+	v, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0
+	}
+	return uint32(v)
+}
+
+func (db *EndershareDB) SetKeyEpoch(epoch uint32) error {
+	return db.setNodeProperty("key_epoch", strconv.FormatUint(uint64(epoch), 10))
+}
+
+// GetReleaseChannelEnabled reports whether this node stages releases published by the master
+func (db *EndershareDB) GetReleaseChannelEnabled() bool {
+	s, err := db.getNodeProperty("release_channel_enabled")
+	return err == nil && s == "1"
+}
+
+func (db *EndershareDB) SetReleaseChannelEnabled(enabled bool) error {
+	if enabled {
+		return db.setNodeProperty("release_channel_enabled", "1")
+	}
+	return db.setNodeProperty("release_channel_enabled", "0")
+}
+
+// GetVerifyPeerAddrs reports whether peer addresses are dial-back checked before use
+func (db *EndershareDB) GetVerifyPeerAddrs() bool {
+	s, err := db.getNodeProperty("verify_peer_addrs")
+	return err == nil && s == "1"
+}
+
+func (db *EndershareDB) SetVerifyPeerAddrs(enabled bool) error {
+	if enabled {
+		return db.setNodeProperty("verify_peer_addrs", "1")
+	}
+	return db.setNodeProperty("verify_peer_addrs", "0")
+}
+
+// GetCompressFiles reports whether new files are compressed before encryption
+func (db *EndershareDB) GetCompressFiles() bool {
+	s, err := db.getNodeProperty("compress_files")
+	return err == nil && s == "1"
+}
+
+func (db *EndershareDB) SetCompressFiles(enabled bool) error {
+	if enabled {
+		return db.setNodeProperty("compress_files", "1")
+	}
+	return db.setNodeProperty("compress_files", "0")
+}
+
+// GetDedupeFiles reports whether files added with content that is already
+// stored reference the stored blob instead of storing a second copy
+func (db *EndershareDB) GetDedupeFiles() bool {
+	s, err := db.getNodeProperty("dedupe_files")
+	return err == nil && s == "1"
+}
+
+func (db *EndershareDB) SetDedupeFiles(enabled bool) error {
+	if enabled {
+		return db.setNodeProperty("dedupe_files", "1")
+	}
+	return db.setNodeProperty("dedupe_files", "0")
+}
+
+// GetOnDemand reports whether synced files are left as placeholders whose
+// content is downloaded when first read, instead of during sync
+func (db *EndershareDB) GetOnDemand() bool {
+	s, err := db.getNodeProperty("on_demand")
+	return err == nil && s == "1"
+}
+
+func (db *EndershareDB) SetOnDemand(enabled bool) error {
+	if enabled {
+		return db.setNodeProperty("on_demand", "1")
+	}
+	return db.setNodeProperty("on_demand", "0")
+}
+
+// GetTrafficPadding reports whether sync traffic is padded and periodic
+// requests are jittered to hide vault activity from network observers
+func (db *EndershareDB) GetTrafficPadding() bool {
+	s, err := db.getNodeProperty("traffic_padding")
+	return err == nil && s == "1"
+}
+
+func (db *EndershareDB) SetTrafficPadding(enabled bool) error {
+	if enabled {
+		return db.setNodeProperty("traffic_padding", "1")
+	}
+	return db.setNodeProperty("traffic_padding", "0")
+}
+
+// GetRenameDuplicates reports whether a file added under a name already
+// taken in its folder gets a numbered name instead of becoming a new version
+func (db *EndershareDB) GetRenameDuplicates() bool {
+	s, err := db.getNodeProperty("rename_duplicates")
+	return err == nil && s == "1"
+}
+
+func (db *EndershareDB) SetRenameDuplicates(enabled bool) error {
+	if enabled {
+		return db.setNodeProperty("rename_duplicates", "1")
+	}
+	return db.setNodeProperty("rename_duplicates", "0")
+}
+
+// GetSortPhotos reports whether imported photos are sorted into Year/Month folders
+func (db *EndershareDB) GetSortPhotos() bool {
+	s, err := db.getNodeProperty("sort_photos")
+	return err == nil && s == "1"
+}
+
+func (db *EndershareDB) SetSortPhotos(enabled bool) error {
+	if enabled {
+		return db.setNodeProperty("sort_photos", "1")
+	}
+	return db.setNodeProperty("sort_photos", "0")
+}
+
+// GetResourceProfile returns the configured resource profile, "" when it is
+// chosen from the available memory
+func (db *EndershareDB) GetResourceProfile() string {
+	profile, err := db.getNodeProperty("resource_profile")
+	if err != nil {
+		return ""
+	}
+	return profile
+}
+
+func (db *EndershareDB) SetResourceProfile(profile string) error {
+	if profile == "" {
+		return db.DeleteNodeProperty("resource_profile")
+	}
+	return db.setNodeProperty("resource_profile", profile)
+}
+
+func (db *EndershareDB) GetStagedReleaseJSON() (string, error) {
+	return db.getNodeProperty("staged_release")
+}
+
+func (db *EndershareDB) SetStagedReleaseJSON(jsonStr string) error {
+	return db.setNodeProperty("staged_release", jsonStr)
+}
+
+// GetVaultPolicyJSON returns the vault policy last published by the master ("" if none)
+func (db *EndershareDB) GetVaultPolicyJSON() string {
+	policy, err := db.getNodeProperty("vault_policy")
+	if err != nil {
+		return ""
+	}
+	return policy
+}
+
+func (db *EndershareDB) SetVaultPolicyJSON(jsonStr string) error {
+	return db.setNodeProperty("vault_policy", jsonStr)
+}
+
+// GetVaultFreezeJSON returns the freeze state last published by the master ("" if none)
+func (db *EndershareDB) GetVaultFreezeJSON() string {
+	freeze, err := db.getNodeProperty("vault_freeze")
+	if err != nil {
+		return ""
+	}
+	return freeze
+}
+
+func (db *EndershareDB) SetVaultFreezeJSON(jsonStr string) error {
+	return db.setNodeProperty("vault_freeze", jsonStr)
+}
+
+// GetSyncSelectionJSON returns the per-device folder selection last published
+// by the master ("" if none)
+func (db *EndershareDB) GetSyncSelectionJSON() string {
+	selection, err := db.getNodeProperty("sync_selection")
+	if err != nil {
+		return ""
+	}
+	return selection
+}
+
+func (db *EndershareDB) SetSyncSelectionJSON(jsonStr string) error {
+	return db.setNodeProperty("sync_selection", jsonStr)
+}
+
+// GetReplicationPolicyJSON returns the per-folder replication modes last
+// published by the master ("" if none)
+func (db *EndershareDB) GetReplicationPolicyJSON() string {
+	policy, err := db.getNodeProperty("replication_policy")
+	if err != nil {
+		return ""
+	}
+	return policy
+}
+
+func (db *EndershareDB) SetReplicationPolicyJSON(jsonStr string) error {
+	return db.setNodeProperty("replication_policy", jsonStr)
+}
+
+// GetPinsJSON returns the files and folders pinned on this node ("" if none)
+func (db *EndershareDB) GetPinsJSON() string {
+	pins, err := db.getNodeProperty("pins")
+	if err != nil {
+		return ""
+	}
+	return pins
+}
+
+func (db *EndershareDB) SetPinsJSON(jsonStr string) error {
+	return db.setNodeProperty("pins", jsonStr)
+}
+
+// GetTempDir returns the configured temp directory for imports ("" for the default)
+func (db *EndershareDB) GetTempDir() string {
+	dir, err := db.getNodeProperty("temp_dir")
+	if err != nil {
+		return ""
+	}
+	return dir
+}
+
+func (db *EndershareDB) SetTempDir(dir string) error {
+	if dir == "" {
+		return db.DeleteNodeProperty("temp_dir")
+	}
+	return db.setNodeProperty("temp_dir", dir)
+}
+
+// GetDataDir returns the configured blob directory ("" for the default)
+func (db *EndershareDB) GetDataDir() string {
+	dir, err := db.getNodeProperty("data_dir")
+	if err != nil {
+		return ""
+	}
+	return dir
+}
+
+func (db *EndershareDB) SetDataDir(dir string) error {
+	if dir == "" {
+		return db.DeleteNodeProperty("data_dir")
+	}
+	return db.setNodeProperty("data_dir", dir)
+}
+
+// GetLocale returns the configured display locale, or "" to follow the system
+func (db *EndershareDB) GetLocale() string {
+	locale, err := db.getNodeProperty("locale")
+	if err != nil {
+		return ""
+	}
+	return locale
+}
+
+func (db *EndershareDB) SetLocale(locale string) error {
+	if locale == "" {
+		return db.DeleteNodeProperty("locale")
+	}
+	return db.setNodeProperty("locale", locale)
+}
+
+// GetAPIListen returns the listen address of the token API, or "" when disabled
+func (db *EndershareDB) GetAPIListen() string {
+	addr, err := db.getNodeProperty("api_listen")
+	if err != nil {
+		return ""
+	}
+	return addr
+}
+
+func (db *EndershareDB) SetAPIListen(addr string) error {
+	if addr == "" {
+		return db.DeleteNodeProperty("api_listen")
+	}
+	return db.setNodeProperty("api_listen", addr)
+}
+
+// getDurationProperty returns a duration stored in seconds, or 0 if unset
+func (db *EndershareDB) getDurationProperty(key string) time.Duration {
+	s, err := db.getNodeProperty(key)
+	if err != nil {
+		return 0
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < 0 {
+		return 0
+	}
+	return time.Duration(v) * time.Second
+}
+
+func (db *EndershareDB) setDurationProperty(key string, d time.Duration) error {
+	if d <= 0 {
+		return db.DeleteNodeProperty(key)
+	}
+	return db.setNodeProperty(key, strconv.Itoa(int(d/time.Second)))
+}
+
+// GetKeepAliveInterval returns the configured connection keepalive (0 for the default)
+func (db *EndershareDB) GetKeepAliveInterval() time.Duration {
+	return db.getDurationProperty("keepalive_interval")
+}
+
+func (db *EndershareDB) SetKeepAliveInterval(d time.Duration) error {
+	return db.setDurationProperty("keepalive_interval", d)
+}
+
+// GetTransferIdleTimeout returns how long a file transfer may stall before it
+// is retried (0 for the default)
+func (db *EndershareDB) GetTransferIdleTimeout() time.Duration {
+	return db.getDurationProperty("transfer_idle_timeout")
+}
+
+func (db *EndershareDB) SetTransferIdleTimeout(d time.Duration) error {
+	return db.setDurationProperty("transfer_idle_timeout", d)
+}
+
+// GetGossipHistory returns how long sent gossip is kept for peers that
+// missed it (0 for the default)
+func (db *EndershareDB) GetGossipHistory() time.Duration {
+	return db.getDurationProperty("gossip_history")
+}
+
+func (db *EndershareDB) SetGossipHistory(d time.Duration) error {
+	return db.setDurationProperty("gossip_history", d)
+}
+
+// GetStorageQuota returns the most encrypted bytes this node stores (0 for no limit)
+func (db *EndershareDB) GetStorageQuota() int64 {
+	s, err := db.getNodeProperty("storage_quota")
+	if err != nil {
+		return 0
+	}
+	quota, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || quota < 0 {
+		return 0
+	}
+	return quota
+}
+
+func (db *EndershareDB) SetStorageQuota(quota int64) error {
+	if quota <= 0 {
+		return db.DeleteNodeProperty("storage_quota")
+	}
+	return db.setNodeProperty("storage_quota", strconv.FormatInt(quota, 10))
+}
+
+// GetReplicationTarget returns the copies of every file the master's
+// replication planner aims for, the master's own included (0 when the
+// planner is off)
+func (db *EndershareDB) GetReplicationTarget() int {
+	s, err := db.getNodeProperty("replication_target")
+	if err != nil {
+		return 0
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+func (db *EndershareDB) SetReplicationTarget(n int) error {
+	return db.setNodeProperty("replication_target", strconv.Itoa(n))
+}
+
+// GetTrashRetention returns how long trashed entries are kept (0 for the default)
+func (db *EndershareDB) GetTrashRetention() time.Duration {
+	return db.getDurationProperty("trash_retention")
+}
+
+func (db *EndershareDB) SetTrashRetention(d time.Duration) error {
+	return db.setDurationProperty("trash_retention", d)
+}
+
+// GetLastBeacon returns when a connectivity beacon last ran (zero if never)
+func (db *EndershareDB) GetLastBeacon() time.Time {
+	s, err := db.getNodeProperty("last_beacon")
+	if err != nil {
+		return time.Time{}
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(v, 0)
+}
+
+func (db *EndershareDB) SetLastBeacon(t time.Time) error {
+	return db.setNodeProperty("last_beacon", strconv.FormatInt(t.Unix(), 10))
+}
+
+// GetScrubInterval returns the time between integrity scrubs of stored blobs (0 for the default)
+func (db *EndershareDB) GetScrubInterval() time.Duration {
+	return db.getDurationProperty("scrub_interval")
+}
+
+func (db *EndershareDB) SetScrubInterval(d time.Duration) error {
+	return db.setDurationProperty("scrub_interval", d)
+}
+
+// GetLastScrub returns when the stored blobs were last scrubbed (zero if never)
+func (db *EndershareDB) GetLastScrub() time.Time {
+	s, err := db.getNodeProperty("last_scrub")
+	if err != nil {
+		return time.Time{}
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(v, 0)
+}
+
+func (db *EndershareDB) SetLastScrub(t time.Time) error {
+	return db.setNodeProperty("last_scrub", strconv.FormatInt(t.Unix(), 10))
+}
+
+// GetReportInterval returns the time between verification reports (0 for the default)
+func (db *EndershareDB) GetReportInterval() time.Duration {
+	return db.getDurationProperty("report_interval")
+}
+
+func (db *EndershareDB) SetReportInterval(d time.Duration) error {
+	return db.setDurationProperty("report_interval", d)
+}
+
+// GetLastReport returns when the last verification report was made (zero if never)
+func (db *EndershareDB) GetLastReport() time.Time {
+	s, err := db.getNodeProperty("last_report")
+	if err != nil {
+		return time.Time{}
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(v, 0)
+}
+
+func (db *EndershareDB) SetLastReport(t time.Time) error {
+	return db.setNodeProperty("last_report", strconv.FormatInt(t.Unix(), 10))
+}
+
+// GetReportAlerts reports whether verification reports are also sent
+// through the alert channels
+func (db *EndershareDB) GetReportAlerts() bool {
+	s, err := db.getNodeProperty("report_alerts")
+	return err == nil && s == "1"
+}
+
+func (db *EndershareDB) SetReportAlerts(enabled bool) error {
+	if enabled {
+		return db.setNodeProperty("report_alerts", "1")
+	}
+	return db.setNodeProperty("report_alerts", "0")
+}
+
+// GetViewerTLS returns the PEM-encoded certificate and key used by the guest viewer
+func (db *EndershareDB) GetViewerTLS() (certPEM, keyPEM string, err error) {
+	certPEM, err = db.getNodeProperty("viewer_tls_cert")
+	if err != nil {
+		return "", "", err
+	}
+	keyPEM, err = db.getNodeProperty("viewer_tls_key")
+	return certPEM, keyPEM, err
+}
+
+func (db *EndershareDB) SetViewerTLS(certPEM, keyPEM string) error {
+	if err := db.setNodeProperty("viewer_tls_cert", certPEM); err != nil {
+		return err
+	}
+	return db.setNodeProperty("viewer_tls_key", keyPEM)
+}
+
 func (db *EndershareDB) SetMasterPublicKey(key []byte) error {
 	return db.setNodeProperty("master_public_key", base64.StdEncoding.EncodeToString(key))
 }
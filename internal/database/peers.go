@@ -1,6 +1,7 @@
 package database
 
 import (
+	"slices"
 	"strings"
 
 	"github.com/libp2p/go-libp2p/core/peer"
@@ -8,8 +9,10 @@ import (
 )
 
 type DBPeer struct {
-	PeerID    string
-	Addresses []string
+	PeerID     string
+	Addresses  []string
+	Label      string
+	Unverified []string // Addresses that failed a dial-back check, never dialed
 }
 
 func (db *EndershareDB) GetPeers() (peers []peer.AddrInfo) {
@@ -58,10 +61,38 @@ func (db *EndershareDB) AddPeer(addrInfo peer.AddrInfo) error {
 		addresses = append(addresses, addr.String())
 	}
 	addressesStr := strings.Join(addresses, "\n")
-	_, err := db.db.Exec("INSERT OR REPLACE INTO peers (peer_id, addrs) VALUES (?, ?)", addrInfo.ID.String(), addressesStr)
+	_, err := db.db.Exec("INSERT INTO peers (peer_id, addrs) VALUES (?, ?) ON CONFLICT(peer_id) DO UPDATE SET addrs = excluded.addrs, unverified_addrs = NULL", addrInfo.ID.String(), addressesStr)
 	return err
 }
 
+// SetPeerAddresses stores the result of a dial-back check. Only verified
+// addresses are returned by GetPeers; unverified ones are kept for display.
+func (db *EndershareDB) SetPeerAddresses(peerID string, verified, unverified []string) error {
+	var unverifiedValue interface{}
+	if len(unverified) > 0 {
+		unverifiedValue = strings.Join(unverified, "\n")
+	}
+	_, err := db.db.Exec("UPDATE peers SET addrs = ?, unverified_addrs = ? WHERE peer_id = ?", strings.Join(verified, "\n"), unverifiedValue, peerID)
+	return err
+}
+
+// GetPeerAddresses returns every address known for a peer, verified or not,
+// and whether the peer is in the peer list
+func (db *EndershareDB) GetPeerAddresses(peerID string) ([]string, bool) {
+	var addresses, unverified string
+	row := db.db.QueryRow("SELECT COALESCE(addrs, ''), COALESCE(unverified_addrs, '') FROM peers WHERE peer_id = ?", peerID)
+	if err := row.Scan(&addresses, &unverified); err != nil {
+		return nil, false
+	}
+	var all []string
+	for _, s := range []string{addresses, unverified} {
+		if s != "" {
+			all = append(all, strings.Split(s, "\n")...)
+		}
+	}
+	return all, true
+}
+
 // GetAllPeerIDs returns a sorted list of all peer IDs
 func (db *EndershareDB) GetAllPeerIDs() []string {
 	rows, err := db.db.Query("SELECT peer_id FROM peers ORDER BY peer_id")
@@ -84,7 +115,7 @@ func (db *EndershareDB) GetAllPeerIDs() []string {
 // UpdatePeerAddresses updates the addresses for an existing peer
 func (db *EndershareDB) UpdatePeerAddresses(peerID string, addrs []string) error {
 	addressesStr := strings.Join(addrs, "\n")
-	_, err := db.db.Exec("UPDATE peers SET addrs = ? WHERE peer_id = ?", addressesStr, peerID)
+	_, err := db.db.Exec("UPDATE peers SET addrs = ?, unverified_addrs = NULL WHERE peer_id = ?", addressesStr, peerID)
 	return err
 }
 
@@ -94,34 +125,129 @@ func (db *EndershareDB) RemovePeer(peerID string) error {
 	return err
 }
 
-// ReplaceAllPeers atomically replaces all peers with a new list
-func (db *EndershareDB) ReplaceAllPeers(peers []DBPeer) error {
+// PeerListDiff lists the peer IDs a merge added, changed the addresses of
+// and removed
+type PeerListDiff struct {
+	Added   []string
+	Changed []string
+	Removed []string
+}
+
+// MergePeers makes the peers table match a full peer list in one
+// transaction, touching only the rows that differ. Local columns such as
+// labels and addresses that failed a dial-back check are kept; a peer's
+// addresses count as changed only if the list differs from every address
+// known for it, verified or not. Peers in both lists are never missing from
+// the table, so concurrent lookups keep finding them.
+func (db *EndershareDB) MergePeers(peers []DBPeer) (PeerListDiff, error) {
+	var diff PeerListDiff
 	tx, err := db.db.Begin()
 	if err != nil {
-		return err
+		return diff, err
 	}
 	defer tx.Rollback()
 
-	// Delete all existing peers
-	_, err = tx.Exec("DELETE FROM peers")
+	known := make(map[string][]string)
+	rows, err := tx.Query("SELECT peer_id, COALESCE(addrs, ''), COALESCE(unverified_addrs, '') FROM peers")
 	if err != nil {
-		return err
+		return diff, err
+	}
+	for rows.Next() {
+		var peerID, addrs, unverified string
+		if err := rows.Scan(&peerID, &addrs, &unverified); err != nil {
+			rows.Close()
+			return diff, err
+		}
+		var all []string
+		for _, s := range []string{addrs, unverified} {
+			if s != "" {
+				all = append(all, strings.Split(s, "\n")...)
+			}
+		}
+		known[peerID] = all
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return diff, err
 	}
 
-	// Insert all new peers
-	stmt, err := tx.Prepare("INSERT INTO peers (peer_id, addrs) VALUES (?, ?)")
-	if err != nil {
-		return err
+	listed := make(map[string]bool, len(peers))
+	for _, p := range peers {
+		listed[p.PeerID] = true
+		var labelValue interface{}
+		if p.Label != "" {
+			labelValue = p.Label
+		}
+		addrs, ok := known[p.PeerID]
+		switch {
+		case !ok:
+			if _, err := tx.Exec("INSERT INTO peers (peer_id, addrs, label) VALUES (?, ?, ?)", p.PeerID, strings.Join(p.Addresses, "\n"), labelValue); err != nil {
+				return diff, err
+			}
+			diff.Added = append(diff.Added, p.PeerID)
+		case !sameAddrs(addrs, p.Addresses):
+			if _, err := tx.Exec("UPDATE peers SET addrs = ?, unverified_addrs = NULL WHERE peer_id = ?", strings.Join(p.Addresses, "\n"), p.PeerID); err != nil {
+				return diff, err
+			}
+			diff.Changed = append(diff.Changed, p.PeerID)
+		}
+		if ok && labelValue != nil {
+			if _, err := tx.Exec("UPDATE peers SET label = ? WHERE peer_id = ?", labelValue, p.PeerID); err != nil {
+				return diff, err
+			}
+		}
 	}
-	defer stmt.Close()
 
-	for _, peer := range peers {
-		addressesStr := strings.Join(peer.Addresses, "\n")
-		_, err = stmt.Exec(peer.PeerID, addressesStr)
-		if err != nil {
-			return err
+	for peerID := range known {
+		if listed[peerID] {
+			continue
 		}
+		if _, err := tx.Exec("DELETE FROM peers WHERE peer_id = ?", peerID); err != nil {
+			return diff, err
+		}
+		diff.Removed = append(diff.Removed, peerID)
 	}
+	slices.Sort(diff.Removed)
+
+	return diff, tx.Commit()
+}
 
-	return tx.Commit()
+// sameAddrs reports whether two address lists hold the same addresses in any order
+func sameAddrs(a, b []string) bool {
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(slices.Compact(a), slices.Compact(b))
+}
+
+// SetPeerLabel sets the human-readable label of a peer
+func (db *EndershareDB) SetPeerLabel(peerID string, label string) error {
+	_, err := db.db.Exec("UPDATE peers SET label = ? WHERE peer_id = ?", label, peerID)
+	return err
+}
+
+// GetAllPeers returns every peer with its raw addresses and label, sorted by peer ID
+func (db *EndershareDB) GetAllPeers() []DBPeer {
+	rows, err := db.db.Query("SELECT peer_id, COALESCE(addrs, ''), COALESCE(label, ''), COALESCE(unverified_addrs, '') FROM peers ORDER BY peer_id")
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	var peers []DBPeer
+	for rows.Next() {
+		var p DBPeer
+		var addresses, unverified string
+		if err := rows.Scan(&p.PeerID, &addresses, &p.Label, &unverified); err != nil {
+			continue
+		}
+		if addresses != "" {
+			p.Addresses = strings.Split(addresses, "\n")
+		}
+		if unverified != "" {
+			p.Unverified = strings.Split(unverified, "\n")
+		}
+		peers = append(peers, p)
+	}
+	return peers
 }
@@ -0,0 +1,76 @@
+package database
+
+import (
+	"strings"
+	"time"
+)
+
+// DBPeerRecord is what the libp2p peerstore knew about a vault peer when it
+// was last saved, so a restarted node can dial it without rediscovery
+type DBPeerRecord struct {
+	PeerID    string
+	Addrs     []string
+	Latency   time.Duration
+	Protocols []string
+	Updated   time.Time
+}
+
+// SavePeerRecords stores peerstore snapshots. Records of peers missing from
+// the list are kept, so an offline peer keeps its last known addresses, but
+// records of peers no longer in the vault are dropped.
+func (db *EndershareDB) SavePeerRecords(records []DBPeerRecord) error {
+	tx, err := db.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`INSERT OR REPLACE INTO peer_records
+		(peer_id, addrs, latency_us, protocols, updated) VALUES (?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, r := range records {
+		_, err := stmt.Exec(r.PeerID, strings.Join(r.Addrs, "\n"), r.Latency.Microseconds(),
+			strings.Join(r.Protocols, "\n"), r.Updated.Unix())
+		if err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec("DELETE FROM peer_records WHERE peer_id NOT IN (SELECT peer_id FROM peers)"); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetPeerRecords returns the peer records saved after since
+func (db *EndershareDB) GetPeerRecords(since time.Time) []DBPeerRecord {
+	rows, err := db.db.Query(`SELECT peer_id, addrs, latency_us, COALESCE(protocols, ''), updated
+		FROM peer_records WHERE updated >= ?`, since.Unix())
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	var records []DBPeerRecord
+	for rows.Next() {
+		var r DBPeerRecord
+		var addrs, protocols string
+		var latencyUs, updated int64
+		if err := rows.Scan(&r.PeerID, &addrs, &latencyUs, &protocols, &updated); err != nil {
+			continue
+		}
+		if addrs != "" {
+			r.Addrs = strings.Split(addrs, "\n")
+		}
+		if protocols != "" {
+			r.Protocols = strings.Split(protocols, "\n")
+		}
+		r.Latency = time.Duration(latencyUs) * time.Microsecond
+		r.Updated = time.Unix(updated, 0)
+		records = append(records, r)
+	}
+	return records
+}
@@ -0,0 +1,41 @@
+package database
+
+// DBStorageProof is the latest storage challenge result for a blob on a peer
+type DBStorageProof struct {
+	PeerID    string
+	FileHash  []byte
+	Passed    bool
+	Error     string
+	Timestamp int64
+}
+
+// SetStorageProof records the outcome of a challenge, replacing the previous
+// result for the same peer and blob
+func (db *EndershareDB) SetStorageProof(p DBStorageProof) error {
+	var errValue interface{}
+	if p.Error != "" {
+		errValue = p.Error
+	}
+	_, err := db.db.Exec(`INSERT OR REPLACE INTO storage_proofs (peer_id, file_hash, passed, error, timestamp)
+		VALUES (?, ?, ?, ?, ?)`, p.PeerID, p.FileHash, p.Passed, errValue, p.Timestamp)
+	return err
+}
+
+// GetStorageProofs returns the latest challenge result of every peer and blob
+func (db *EndershareDB) GetStorageProofs() []DBStorageProof {
+	rows, err := db.db.Query("SELECT peer_id, file_hash, passed, COALESCE(error, ''), timestamp FROM storage_proofs")
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	var proofs []DBStorageProof
+	for rows.Next() {
+		var p DBStorageProof
+		if err := rows.Scan(&p.PeerID, &p.FileHash, &p.Passed, &p.Error, &p.Timestamp); err != nil {
+			continue
+		}
+		proofs = append(proofs, p)
+	}
+	return proofs
+}
@@ -0,0 +1,77 @@
+package database
+
+import "time"
+
+// maxProtocolErrors caps the protocol error log, the oldest entries are
+// dropped first
+const maxProtocolErrors = 1000
+
+// DBProtocolError is a failed protocol exchange with a peer
+type DBProtocolError struct {
+	PeerID    string
+	Protocol  string
+	Phase     string // Step of the exchange that failed, e.g. "decode request"
+	Error     string
+	Timestamp time.Time
+}
+
+// RecordProtocolError logs a failed exchange with a peer, dropping the oldest
+// entries beyond the cap
+func (db *EndershareDB) RecordProtocolError(peerID, protocol, phase, errMsg string) error {
+	tx, err := db.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`INSERT INTO protocol_errors (peer_id, protocol, phase, error, timestamp) VALUES (?, ?, ?, ?, ?)`,
+		peerID, protocol, phase, errMsg, time.Now().Unix())
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM protocol_errors WHERE id <= ?", id-maxProtocolErrors); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetProtocolErrors returns up to limit logged errors, newest first. An empty
+// peerID returns the errors of every peer.
+func (db *EndershareDB) GetProtocolErrors(peerID string, limit int) []DBProtocolError {
+	query := "SELECT peer_id, protocol, phase, error, timestamp FROM protocol_errors"
+	args := []interface{}{}
+	if peerID != "" {
+		query += " WHERE peer_id = ?"
+		args = append(args, peerID)
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := db.db.Query(query, args...)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	var entries []DBProtocolError
+	for rows.Next() {
+		var e DBProtocolError
+		var timestamp int64
+		if err := rows.Scan(&e.PeerID, &e.Protocol, &e.Phase, &e.Error, &timestamp); err != nil {
+			continue
+		}
+		e.Timestamp = time.Unix(timestamp, 0)
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// ClearProtocolErrors empties the protocol error log
+func (db *EndershareDB) ClearProtocolErrors() error {
+	_, err := db.db.Exec("DELETE FROM protocol_errors")
+	return err
+}
@@ -0,0 +1,83 @@
+package database
+
+import "time"
+
+// DBQuarantineEntry is an entry or blob that failed verification when
+// fetched from a peer
+type DBQuarantineEntry struct {
+	EntryHash []byte
+	PeerID    string
+	Kind      string
+	Reason    string
+	Failures  int
+	FirstSeen time.Time
+	LastSeen  time.Time
+}
+
+// RecordQuarantine records a verification failure, counting repeated failures
+// of the same entry from the same peer
+func (db *EndershareDB) RecordQuarantine(entryHash []byte, peerID, kind, reason string) error {
+	now := time.Now().Unix()
+	_, err := db.db.Exec(`INSERT INTO quarantine (entry_hash, peer_id, kind, reason, failures, first_seen, last_seen)
+		VALUES (?, ?, ?, ?, 1, ?, ?)
+		ON CONFLICT(entry_hash, peer_id, kind) DO UPDATE SET
+			reason = excluded.reason, failures = failures + 1, last_seen = excluded.last_seen`,
+		entryHash, peerID, kind, reason, now, now)
+	return err
+}
+
+// GetQuarantineEntry returns the quarantine record of an entry from a peer, or nil
+func (db *EndershareDB) GetQuarantineEntry(entryHash []byte, peerID, kind string) *DBQuarantineEntry {
+	entries := db.queryQuarantine(`SELECT entry_hash, peer_id, kind, reason, failures, first_seen, last_seen
+		FROM quarantine WHERE entry_hash = ? AND peer_id = ? AND kind = ?`, entryHash, peerID, kind)
+	if len(entries) == 0 {
+		return nil
+	}
+	return &entries[0]
+}
+
+// GetQuarantine returns every quarantined entry, most recent failure first
+func (db *EndershareDB) GetQuarantine() []DBQuarantineEntry {
+	return db.queryQuarantine(`SELECT entry_hash, peer_id, kind, reason, failures, first_seen, last_seen
+		FROM quarantine ORDER BY last_seen DESC`)
+}
+
+// CountQuarantine returns the number of quarantined entries
+func (db *EndershareDB) CountQuarantine() int {
+	var n int
+	db.db.QueryRow("SELECT COUNT(*) FROM quarantine").Scan(&n)
+	return n
+}
+
+// ClearQuarantine releases an entry from quarantine for every peer
+func (db *EndershareDB) ClearQuarantine(entryHash []byte, kind string) error {
+	_, err := db.db.Exec("DELETE FROM quarantine WHERE entry_hash = ? AND kind = ?", entryHash, kind)
+	return err
+}
+
+// ClearAllQuarantine releases every quarantined entry
+func (db *EndershareDB) ClearAllQuarantine() error {
+	_, err := db.db.Exec("DELETE FROM quarantine")
+	return err
+}
+
+func (db *EndershareDB) queryQuarantine(query string, args ...interface{}) []DBQuarantineEntry {
+	rows, err := db.db.Query(query, args...)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	var entries []DBQuarantineEntry
+	for rows.Next() {
+		var e DBQuarantineEntry
+		var firstSeen, lastSeen int64
+		if err := rows.Scan(&e.EntryHash, &e.PeerID, &e.Kind, &e.Reason, &e.Failures, &firstSeen, &lastSeen); err != nil {
+			continue
+		}
+		e.FirstSeen = time.Unix(firstSeen, 0)
+		e.LastSeen = time.Unix(lastSeen, 0)
+		entries = append(entries, e)
+	}
+	return entries
+}
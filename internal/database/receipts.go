@@ -0,0 +1,78 @@
+package database
+
+// DBReceipt is a transfer receipt signed by the peer that downloaded a file
+type DBReceipt struct {
+	ReceiptID  []byte // Hash of the signed receipt
+	FileHash   []byte
+	Server     string
+	Receiver   string
+	Bytes      int64
+	DurationMs int64
+	Verified   bool
+	Timestamp  int64
+	SignedJSON string
+}
+
+// AddReceipt records a receipt, ignoring one that is already known
+func (db *EndershareDB) AddReceipt(r DBReceipt) error {
+	_, err := db.db.Exec(`INSERT OR IGNORE INTO transfer_receipts
+		(receipt_id, file_hash, server, receiver, bytes, duration_ms, verified, timestamp, signed_json)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.ReceiptID, r.FileHash, r.Server, r.Receiver, r.Bytes, r.DurationMs, r.Verified, r.Timestamp, r.SignedJSON)
+	return err
+}
+
+// GetReceiptsByReceiver returns receipts issued by receiver after since, oldest first
+func (db *EndershareDB) GetReceiptsByReceiver(receiver string, since int64, limit int) []DBReceipt {
+	return db.queryReceipts(`SELECT receipt_id, file_hash, server, receiver, bytes, duration_ms, verified, timestamp, signed_json
+		FROM transfer_receipts WHERE receiver = ? AND timestamp > ? ORDER BY timestamp LIMIT ?`, receiver, since, limit)
+}
+
+// GetAllReceipts returns every known receipt
+func (db *EndershareDB) GetAllReceipts() []DBReceipt {
+	return db.queryReceipts(`SELECT receipt_id, file_hash, server, receiver, bytes, duration_ms, verified, timestamp, signed_json
+		FROM transfer_receipts`)
+}
+
+// GetLatestReceiptTime returns the timestamp of the newest receipt issued by receiver (0 if none)
+func (db *EndershareDB) GetLatestReceiptTime(receiver string) int64 {
+	var ts int64
+	db.db.QueryRow("SELECT COALESCE(MAX(timestamp), 0) FROM transfer_receipts WHERE receiver = ?", receiver).Scan(&ts)
+	return ts
+}
+
+// GetReceivedFileHashes returns the files receiver acknowledged with a verified receipt
+func (db *EndershareDB) GetReceivedFileHashes(receiver string) [][]byte {
+	rows, err := db.db.Query("SELECT DISTINCT file_hash FROM transfer_receipts WHERE receiver = ? AND verified = 1", receiver)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	var hashes [][]byte
+	for rows.Next() {
+		var hash []byte
+		if err := rows.Scan(&hash); err == nil {
+			hashes = append(hashes, hash)
+		}
+	}
+	return hashes
+}
+
+func (db *EndershareDB) queryReceipts(query string, args ...interface{}) []DBReceipt {
+	rows, err := db.db.Query(query, args...)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	var receipts []DBReceipt
+	for rows.Next() {
+		var r DBReceipt
+		if err := rows.Scan(&r.ReceiptID, &r.FileHash, &r.Server, &r.Receiver, &r.Bytes, &r.DurationMs, &r.Verified, &r.Timestamp, &r.SignedJSON); err != nil {
+			continue
+		}
+		receipts = append(receipts, r)
+	}
+	return receipts
+}
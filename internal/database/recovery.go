@@ -0,0 +1,175 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const dbPath = "./endershare.db"
+
+// backupPath returns where the last copy of the database at path that passed
+// an integrity check is kept
+func backupPath(path string) string {
+	return path + ".bak"
+}
+
+// recoverableProperties are the node properties salvaged from a corrupted
+// database when no healthy backup exists. Sync state is deliberately left out
+// so the node rebuilds data and peers from the network.
+var recoverableProperties = []string{
+	"master_private_key",
+	"peer_private_key",
+	"aes_key",
+	"master_public_key",
+	"key_epoch",
+	"digest_key",
+}
+
+// checkIntegrity runs PRAGMA quick_check and returns an error describing any problems
+func checkIntegrity(db *sql.DB) error {
+	rows, err := db.Query("PRAGMA quick_check")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var problems []string
+	for rows.Next() {
+		var result string
+		if err := rows.Scan(&result); err != nil {
+			return err
+		}
+		if result != "ok" {
+			problems = append(problems, result)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("integrity check failed: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// openChecked opens an existing database at path and verifies its integrity
+func openChecked(path string) (*sql.DB, error) {
+	// sql.Open would silently create an empty database for a missing file
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkIntegrity(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// recoverDatabase moves a corrupted database aside and opens a replacement.
+// The last healthy backup is restored if there is one; otherwise a fresh
+// database is created and the node's keys are salvaged from the corrupted file.
+func recoverDatabase(path string, cause error) (db *sql.DB, salvaged map[string]string, err error) {
+	fmt.Println("Warning: Database is corrupted:", cause)
+
+	corruptPath := fmt.Sprintf("%s.corrupt-%d", path, time.Now().Unix())
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		if err := os.Rename(path+suffix, corruptPath+suffix); err != nil && !os.IsNotExist(err) {
+			return nil, nil, fmt.Errorf("failed to move corrupted database aside: %w", err)
+		}
+	}
+	fmt.Println("Corrupted database moved to", corruptPath)
+
+	if backup, err := openChecked(backupPath(path)); err == nil {
+		backup.Close()
+		if err := copyFile(backupPath(path), path); err != nil {
+			return nil, nil, fmt.Errorf("failed to restore backup: %w", err)
+		}
+		fmt.Println("Restored database from last healthy backup; newer changes will sync from peers before publishing")
+		db, err := sql.Open("sqlite3", path)
+		return db, nil, err
+	}
+
+	salvaged = salvageNodeProperties(corruptPath)
+	if len(salvaged) > 0 {
+		fmt.Println("Recovered node keys from corrupted database; data will be rebuilt from peers")
+	} else {
+		fmt.Println("Could not recover node keys; restore the vault from its mnemonic")
+	}
+
+	db, err = sql.Open("sqlite3", path)
+	return db, salvaged, err
+}
+
+// salvageNodeProperties reads whatever recoverable node properties are still
+// readable from a corrupted database
+func salvageNodeProperties(path string) map[string]string {
+	props := make(map[string]string)
+	db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return props
+	}
+	defer db.Close()
+
+	for _, key := range recoverableProperties {
+		var value string
+		if err := db.QueryRow("SELECT value FROM node WHERE key = ?", key).Scan(&value); err == nil && value != "" {
+			props[key] = value
+		}
+	}
+	return props
+}
+
+// GetUnsynced reports whether the database was recovered and may be behind
+// the updates the vault has already published
+func (db *EndershareDB) GetUnsynced() bool {
+	s, err := db.getNodeProperty("recovered_unsynced")
+	return err == nil && s == "1"
+}
+
+func (db *EndershareDB) SetUnsynced(unsynced bool) error {
+	if unsynced {
+		return db.setNodeProperty("recovered_unsynced", "1")
+	}
+	return db.setNodeProperty("recovered_unsynced", "0")
+}
+
+// Backup writes a consistent copy of the database to the backup path
+func (db *EndershareDB) Backup() error {
+	tmpPath := backupPath(db.path) + ".tmp"
+	os.Remove(tmpPath)
+	if _, err := db.db.Exec("VACUUM INTO ?", tmpPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, backupPath(db.path))
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
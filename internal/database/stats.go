@@ -0,0 +1,49 @@
+package database
+
+// DBVaultStats is one signed vault status snapshot
+type DBVaultStats struct {
+	UpdateID     uint64
+	Timestamp    int64
+	FileCount    int64
+	FolderCount  int64
+	LogicalBytes int64
+	StoredBytes  int64
+}
+
+// AddVaultStats records a vault status snapshot
+func (db *EndershareDB) AddVaultStats(s DBVaultStats) error {
+	_, err := db.db.Exec(`INSERT OR REPLACE INTO vault_stats
+		(update_id, timestamp, file_count, folder_count, logical_bytes, stored_bytes)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		s.UpdateID, s.Timestamp, s.FileCount, s.FolderCount, s.LogicalBytes, s.StoredBytes)
+	return err
+}
+
+// GetLatestVaultStats returns the most recent snapshot, or nil if none was received
+func (db *EndershareDB) GetLatestVaultStats() *DBVaultStats {
+	history := db.GetVaultStatsHistory(1)
+	if len(history) == 0 {
+		return nil
+	}
+	return &history[0]
+}
+
+// GetVaultStatsHistory returns up to limit snapshots, newest first
+func (db *EndershareDB) GetVaultStatsHistory(limit int) []DBVaultStats {
+	rows, err := db.db.Query(`SELECT update_id, timestamp, file_count, folder_count, logical_bytes, stored_bytes
+		FROM vault_stats ORDER BY update_id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	var history []DBVaultStats
+	for rows.Next() {
+		var s DBVaultStats
+		if err := rows.Scan(&s.UpdateID, &s.Timestamp, &s.FileCount, &s.FolderCount, &s.LogicalBytes, &s.StoredBytes); err != nil {
+			continue
+		}
+		history = append(history, s)
+	}
+	return history
+}
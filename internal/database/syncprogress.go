@@ -0,0 +1,51 @@
+package database
+
+// The sync progress table lets a full metadata sync that was interrupted
+// resume instead of starting over. Once every entry of a bucket the peer
+// listed is stored and marked current, the bucket is recorded with the hash
+// the peer's tree had for it. A later sync skips the buckets whose peer hash
+// is still the recorded one; their stale marks are kept for the final
+// delete. Entries fetched before the interruption are in the data table
+// already, so they aren't requested again either way.
+
+// GetSyncProgress returns the tree hash recorded for every bucket an
+// unfinished sync completed, for a tree of numBuckets buckets
+func (db *EndershareDB) GetSyncProgress(numBuckets int) map[int][]byte {
+	rows, err := db.db.Query("SELECT bucket, tree_hash FROM sync_progress WHERE num_buckets = ?", numBuckets)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	done := make(map[int][]byte)
+	for rows.Next() {
+		var bucket int
+		var hash []byte
+		if err := rows.Scan(&bucket, &hash); err != nil {
+			continue
+		}
+		done[bucket] = hash
+	}
+	return done
+}
+
+// SetSyncBucketDone records that a bucket is in sync with a peer whose tree
+// has treeHash for it
+func (db *EndershareDB) SetSyncBucketDone(bucketIdx, numBuckets int, treeHash []byte) error {
+	_, err := db.db.Exec("INSERT OR REPLACE INTO sync_progress (bucket, num_buckets, tree_hash) VALUES (?, ?, ?)",
+		bucketIdx, numBuckets, treeHash)
+	return err
+}
+
+// ClearSyncProgress forgets the progress of an unfinished sync
+func (db *EndershareDB) ClearSyncProgress() error {
+	_, err := db.db.Exec("DELETE FROM sync_progress")
+	return err
+}
+
+// HasSyncProgress reports whether an unfinished sync recorded any buckets
+func (db *EndershareDB) HasSyncProgress() bool {
+	var exists bool
+	err := db.db.QueryRow("SELECT EXISTS (SELECT 1 FROM sync_progress)").Scan(&exists)
+	return err == nil && exists
+}
@@ -0,0 +1,67 @@
+package database
+
+// DBToken is an API capability token. Only a hash of the secret is stored.
+type DBToken struct {
+	TokenID    string
+	Name       string
+	SecretHash []byte
+	Scope      string
+	FolderID   string // Empty when the token is not limited to a folder
+	Created    int64
+	Expires    int64 // Unix seconds, 0 for no expiry
+}
+
+// AddToken stores a new API token
+func (db *EndershareDB) AddToken(t DBToken) error {
+	_, err := db.db.Exec(`INSERT INTO api_tokens (token_id, name, secret_hash, scope, folder_id, created, expires)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		t.TokenID, t.Name, t.SecretHash, t.Scope, t.FolderID, t.Created, t.Expires)
+	return err
+}
+
+// GetToken returns the token with the given ID, or nil if it does not exist
+func (db *EndershareDB) GetToken(tokenID string) *DBToken {
+	var t DBToken
+	row := db.db.QueryRow(`SELECT token_id, name, secret_hash, scope, COALESCE(folder_id, ''), created, expires
+		FROM api_tokens WHERE token_id = ?`, tokenID)
+	if err := row.Scan(&t.TokenID, &t.Name, &t.SecretHash, &t.Scope, &t.FolderID, &t.Created, &t.Expires); err != nil {
+		return nil
+	}
+	return &t
+}
+
+// GetAllTokens returns every API token, oldest first
+func (db *EndershareDB) GetAllTokens() []DBToken {
+	rows, err := db.db.Query(`SELECT token_id, name, secret_hash, scope, COALESCE(folder_id, ''), created, expires
+		FROM api_tokens ORDER BY created`)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	var tokens []DBToken
+	for rows.Next() {
+		var t DBToken
+		if err := rows.Scan(&t.TokenID, &t.Name, &t.SecretHash, &t.Scope, &t.FolderID, &t.Created, &t.Expires); err != nil {
+			continue
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens
+}
+
+// RemoveToken deletes an API token, reporting whether it existed
+func (db *EndershareDB) RemoveToken(tokenID string) (bool, error) {
+	res, err := db.db.Exec("DELETE FROM api_tokens WHERE token_id = ?", tokenID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// RemoveExpiredTokens deletes tokens that expired before now (Unix seconds)
+func (db *EndershareDB) RemoveExpiredTokens(now int64) error {
+	_, err := db.db.Exec("DELETE FROM api_tokens WHERE expires > 0 AND expires < ?", now)
+	return err
+}
@@ -39,3 +39,22 @@ func (db *EndershareDB) GetUpdateByID(updateID uint64) (string, error) {
 	}
 	return signedUpdateJSON, nil
 }
+
+// GetRecentUpdates returns the signed JSON of up to limit updates, newest first
+func (db *EndershareDB) GetRecentUpdates(limit int) ([]string, error) {
+	rows, err := db.db.Query(`SELECT signed_update_json FROM updates ORDER BY update_id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var updates []string
+	for rows.Next() {
+		var signedUpdateJSON string
+		if err := rows.Scan(&signedUpdateJSON); err != nil {
+			return nil, err
+		}
+		updates = append(updates, signedUpdateJSON)
+	}
+	return updates, rows.Err()
+}
@@ -0,0 +1,137 @@
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// DefaultLocale is used when no locale is configured and as the fallback for
+// messages missing from another catalog
+const DefaultLocale = "en"
+
+//go:embed locales/*.json
+var localeFiles embed.FS
+
+// Catalog resolves message IDs to text in one locale
+type Catalog struct {
+	locale   string
+	messages map[string]string
+	fallback *Catalog
+}
+
+// Available returns the locales with a built-in catalog
+func Available() []string {
+	files, err := localeFiles.ReadDir("locales")
+	if err != nil {
+		return []string{DefaultLocale}
+	}
+	locales := make([]string, 0, len(files))
+	for _, f := range files {
+		locales = append(locales, strings.TrimSuffix(f.Name(), ".json"))
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// Normalize reduces a locale tag such as "de_DE.UTF-8" or "de-AT" to the
+// catalog it resolves to, or "" if there is no catalog for the language
+func Normalize(locale string) string {
+	tag := strings.ToLower(locale)
+	if i := strings.IndexAny(tag, "._@"); i >= 0 {
+		tag = tag[:i]
+	}
+	if i := strings.Index(tag, "-"); i >= 0 {
+		tag = tag[:i]
+	}
+	for _, available := range Available() {
+		if available == tag {
+			return tag
+		}
+	}
+	return ""
+}
+
+// SystemLocale returns the catalog matching the environment's LC_ALL,
+// LC_MESSAGES or LANG, falling back to DefaultLocale
+func SystemLocale() string {
+	for _, env := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if locale := Normalize(os.Getenv(env)); locale != "" {
+			return locale
+		}
+	}
+	return DefaultLocale
+}
+
+// Load returns the catalog for a locale. Unknown locales load DefaultLocale.
+func Load(locale string) *Catalog {
+	locale = Normalize(locale)
+	if locale == "" {
+		locale = DefaultLocale
+	}
+
+	c := &Catalog{locale: locale, messages: readLocale(locale)}
+	if locale != DefaultLocale {
+		c.fallback = &Catalog{locale: DefaultLocale, messages: readLocale(DefaultLocale)}
+	}
+	return c
+}
+
+func readLocale(locale string) map[string]string {
+	messages := map[string]string{}
+	data, err := localeFiles.ReadFile(path.Join("locales", locale+".json"))
+	if err != nil {
+		return messages
+	}
+	if err := json.Unmarshal(data, &messages); err != nil {
+		fmt.Printf("Warning: Invalid %s message catalog: %v\n", locale, err)
+	}
+	return messages
+}
+
+// Locale returns the locale of the catalog
+func (c *Catalog) Locale() string {
+	return c.locale
+}
+
+// Messages returns every message of the catalog, including fallbacks, so the
+// frontend can render the same strings
+func (c *Catalog) Messages() map[string]string {
+	all := map[string]string{}
+	if c.fallback != nil {
+		for id, text := range c.fallback.messages {
+			all[id] = text
+		}
+	}
+	for id, text := range c.messages {
+		all[id] = text
+	}
+	return all
+}
+
+// T formats the message with the given ID. Missing messages render as the ID.
+func (c *Catalog) T(id string, args ...any) string {
+	text, ok := c.messages[id]
+	if !ok && c.fallback != nil {
+		text, ok = c.fallback.messages[id]
+	}
+	if !ok {
+		return id
+	}
+	if len(args) == 0 {
+		return text
+	}
+	return fmt.Sprintf(text, args...)
+}
+
+// Plural formats id+".one" when n is 1 and id+".other" otherwise
+func (c *Catalog) Plural(id string, n int) string {
+	if n == 1 {
+		return c.T(id+".one", n)
+	}
+	return c.T(id+".other", n)
+}
@@ -0,0 +1,211 @@
+package p2p
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	dht "github.com/libp2p/go-libp2p-kad-dht"
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/host/eventbus"
+	relayproto "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/proto"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// beaconProbeTimeout bounds each bootstrap dial and the rendezvous round trip
+const beaconProbeTimeout = 20 * time.Second
+
+// ConnectivityReport is what a beacon run observed. It holds no vault data
+// and is meant to be attached to bug reports about binding failures.
+type ConnectivityReport struct {
+	StartedAt  time.Time `json:"startedAt"`
+	DurationMs int64     `json:"durationMs"`
+	PeerID     string    `json:"peerId"`
+
+	ListenAddrs    []string `json:"listenAddrs"`
+	AdvertisedAddr []string `json:"advertisedAddrs"`
+	Reachability   string   `json:"reachability"` // AutoNAT verdict: Public, Private or Unknown
+	ReachableAddrs []string `json:"reachableAddrs,omitempty"`
+	Unreachable    []string `json:"unreachableAddrs,omitempty"`
+
+	Bootstrap []ProbeResult `json:"bootstrap"`
+
+	DHTPeers       int      `json:"dhtPeers"` // Routing table size after the run
+	Rendezvous     string   `json:"rendezvous"`
+	AdvertiseOK    bool     `json:"advertiseOk"`
+	AdvertiseError string   `json:"advertiseError,omitempty"`
+	AdvertiseMs    int64    `json:"advertiseMs"`
+	DHTServers     []string `json:"dhtServers"` // Servers that answered the rendezvous lookup
+	LookupError    string   `json:"lookupError,omitempty"`
+	LookupMs       int64    `json:"lookupMs"`
+
+	Relays     []string       `json:"relays"`     // Connected peers offering circuit relay
+	Transports map[string]int `json:"transports"` // Open connections by transport
+}
+
+// ProbeResult is the outcome of dialing one bootstrap server
+type ProbeResult struct {
+	PeerID    string `json:"peerId"`
+	OK        bool   `json:"ok"`
+	Transport string `json:"transport,omitempty"`
+	Ms        int64  `json:"ms"` // Dial time, 0 if already connected
+	Error     string `json:"error,omitempty"`
+}
+
+// RunBeacon advertises a random rendezvous for window, looks up the DHT
+// servers closest to it and reports which bootstrap servers, relays and
+// transports responded. The
+// rendezvous is unrelated to the vault so the beacon can't be linked to it.
+func (p *P2PNode) RunBeacon(ctx context.Context, window time.Duration) (*ConnectivityReport, error) {
+	if p.dht == nil {
+		return nil, fmt.Errorf("beacon needs the DHT, which this node does not run")
+	}
+	report := &ConnectivityReport{
+		StartedAt:  time.Now(),
+		PeerID:     p.host.ID().String(),
+		Transports: map[string]int{},
+	}
+
+	sub, err := p.host.EventBus().Subscribe([]interface{}{
+		new(event.EvtLocalReachabilityChanged),
+		new(event.EvtHostReachableAddrsChanged),
+	}, eventbus.BufSize(16))
+	if err != nil {
+		return nil, err
+	}
+	defer sub.Close()
+
+	report.Bootstrap = p.probeBootstrap(ctx)
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	report.Rendezvous = "endershare-beacon-" + hex.EncodeToString(nonce)
+
+	start := time.Now()
+	advCtx, cancel := context.WithTimeout(ctx, beaconProbeTimeout)
+	err = p.Advertize(advCtx, report.Rendezvous, window)
+	cancel()
+	report.AdvertiseMs = time.Since(start).Milliseconds()
+	report.AdvertiseOK = err == nil
+	if err != nil {
+		report.AdvertiseError = err.Error()
+	}
+
+	start = time.Now()
+	lookupCtx, cancel := context.WithTimeout(ctx, beaconProbeTimeout)
+	servers, err := p.dht.GetClosestPeers(lookupCtx, report.Rendezvous)
+	cancel()
+	report.LookupMs = time.Since(start).Milliseconds()
+	if err != nil {
+		report.LookupError = err.Error()
+	}
+	for _, id := range servers {
+		report.DHTServers = append(report.DHTServers, id.String())
+	}
+	sort.Strings(report.DHTServers)
+
+	// Give AutoNAT the rest of the window to reach a verdict
+	report.Reachability = network.ReachabilityUnknown.String()
+	deadline := time.NewTimer(time.Until(report.StartedAt.Add(window)))
+	defer deadline.Stop()
+collect:
+	for {
+		select {
+		case e := <-sub.Out():
+			switch ev := e.(type) {
+			case event.EvtLocalReachabilityChanged:
+				report.Reachability = ev.Reachability.String()
+			case event.EvtHostReachableAddrsChanged:
+				report.ReachableAddrs = addrStrings(ev.Reachable)
+				report.Unreachable = addrStrings(ev.Unreachable)
+			}
+		case <-deadline.C:
+			break collect
+		case <-ctx.Done():
+			break collect
+		}
+	}
+
+	report.ListenAddrs = addrStrings(p.host.Network().ListenAddresses())
+	report.AdvertisedAddr = addrStrings(p.host.Addrs())
+	report.DHTPeers = p.dht.RoutingTable().Size()
+	for _, conn := range p.host.Network().Conns() {
+		report.Transports[transportName(conn.RemoteMultiaddr())]++
+	}
+	for _, id := range p.host.Network().Peers() {
+		if ok, _ := p.host.Peerstore().SupportsProtocols(id, relayproto.ProtoIDv2Hop); len(ok) > 0 {
+			report.Relays = append(report.Relays, id.String())
+		}
+	}
+	sort.Strings(report.Relays)
+
+	report.DurationMs = time.Since(report.StartedAt).Milliseconds()
+	return report, nil
+}
+
+// probeBootstrap dials every default bootstrap server and times the result
+func (p *P2PNode) probeBootstrap(ctx context.Context) []ProbeResult {
+	infos := dht.GetDefaultBootstrapPeerAddrInfos()
+	results := make([]ProbeResult, len(infos))
+
+	var wg sync.WaitGroup
+	for i, info := range infos {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dialCtx, cancel := context.WithTimeout(ctx, beaconProbeTimeout)
+			defer cancel()
+
+			if p.host.Network().Connectedness(info.ID) == network.Connected {
+				results[i] = ProbeResult{PeerID: info.ID.String(), OK: true, Transport: p.connTransport(info.ID)}
+				return
+			}
+			start := time.Now()
+			err := p.host.Connect(dialCtx, info)
+			results[i] = ProbeResult{PeerID: info.ID.String(), Ms: time.Since(start).Milliseconds(), OK: err == nil}
+			if err != nil {
+				results[i].Error = err.Error()
+				return
+			}
+			results[i].Transport = p.connTransport(info.ID)
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+func (p *P2PNode) connTransport(id peer.ID) string {
+	if conns := p.host.Network().ConnsToPeer(id); len(conns) > 0 {
+		return transportName(conns[0].RemoteMultiaddr())
+	}
+	return ""
+}
+
+// transportName names the transport of a connection address
+func transportName(addr multiaddr.Multiaddr) string {
+	if isRelayAddr(addr) {
+		return "relay"
+	}
+	for _, code := range []int{multiaddr.P_QUIC_V1, multiaddr.P_QUIC, multiaddr.P_WEBTRANSPORT, multiaddr.P_WEBRTC_DIRECT, multiaddr.P_TCP} {
+		if _, err := addr.ValueForProtocol(code); err == nil {
+			return multiaddr.ProtocolWithCode(code).Name
+		}
+	}
+	return "other"
+}
+
+func addrStrings(addrs []multiaddr.Multiaddr) []string {
+	out := make([]string, 0, len(addrs))
+	for _, a := range addrs {
+		out = append(out, a.String())
+	}
+	return out
+}
@@ -8,6 +8,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io"
 	"math/big"
 	"strings"
 	"sync"
@@ -22,6 +23,23 @@ import (
 
 const bindProtocolID = "/endershare/bind/1.0"
 
+// BindTimeout is how long a replica waits for a master to enter its sync phrase
+const BindTimeout = time.Hour
+
+// BindStage is a step of binding a new peer on the master
+type BindStage string
+
+// Binding stages in the order they are reached. BindNewPeer reports the
+// first four, the caller reports how the binding ended.
+const (
+	BindSearching       BindStage = "searching"         // Looking up the sync phrase
+	BindPeerFound       BindStage = "peer-found"        // Connecting to a peer that advertises it
+	BindVerifying       BindStage = "verifying"         // Proving knowledge of the phrase to each other
+	BindSendingPeerList BindStage = "sending-peer-list" // Sending the master key and peer list
+	BindDone            BindStage = "done"
+	BindFailed          BindStage = "failed"
+)
+
 type PeerListEntry struct {
 	PeerID    string
 	Addresses []string
@@ -31,6 +49,7 @@ type ClientInfoMsg struct {
 	MasterPublicKeyBase64 string
 	PeerID                string
 	PeerList              []PeerListEntry
+	DigestKeyBase64       string `json:",omitempty"` // Empty from masters that don't key digests
 }
 
 type ClientInfo struct {
@@ -38,6 +57,7 @@ type ClientInfo struct {
 	PeerID          peer.ID
 	AddrInfo        peer.AddrInfo
 	PeerList        []peer.AddrInfo
+	DigestKey       []byte // Nil if the master sent none
 }
 
 type challengeResponse struct {
@@ -56,7 +76,7 @@ func BindToClient(node *P2PNode) (*ClientInfo, error) {
 	syncPhrase := newMnemonic(4)
 	ctx, cancelAdvert := context.WithCancel(context.Background())
 	defer cancelAdvert()
-	node.Advertize(ctx, syncPhrase, time.Hour)
+	node.Advertize(ctx, syncPhrase, BindTimeout)
 	//create mutex to rate limit this service and prevent brute forcing
 	var mutex sync.Mutex
 	clientInfo := make(chan *ClientInfo, 1)
@@ -69,34 +89,18 @@ func BindToClient(node *P2PNode) (*ClientInfo, error) {
 
 		verifiedPeer, err := mutualVerification(s, syncPhrase)
 		if err == nil && verifiedPeer {
-			c := &ClientInfoMsg{}
-			buf := new(bytes.Buffer)
-			_, err = buf.ReadFrom(s)
+			info, err := readClientInfo(s)
 			if err != nil {
 				fmt.Println("Error reading client info:", err)
 				return
 			}
-			err = json.Unmarshal(buf.Bytes(), c)
-			if err != nil {
-				fmt.Println("Error unmarshaling client info:", err)
-				return
-			}
-			info, err := clientInfoMsgToClientInfo(c)
-			if err != nil {
-				fmt.Println("Error converting client info message:", err)
-				return
-			}
-			info.AddrInfo = peer.AddrInfo{
-				ID:    info.PeerID,
-				Addrs: []multiaddr.Multiaddr{s.Conn().RemoteMultiaddr()},
-			}
 			clientInfo <- info
 		}
 	})
 
 	//wait for client to connec, time out after 1 hour
 	fmt.Println("Waiting for client to bind with sync phrase:", syncPhrase)
-	timeout := time.After(time.Hour)
+	timeout := time.After(BindTimeout)
 	defer node.host.RemoveStreamHandler(bindProtocolID)
 	select {
 	case info := <-clientInfo:
@@ -108,11 +112,19 @@ func BindToClient(node *P2PNode) (*ClientInfo, error) {
 
 // BindNewPeer is called by a master node to authorize a new replica node
 // It discovers the new peer using the sync phrase, verifies mutual knowledge,
-// and sends the master public key and peer list to the new peer
-func BindNewPeer(syncPhrase string, node *P2PNode, masterPubKey ed25519.PublicKey, masterPrivKey ed25519.PrivateKey, existingPeers []peer.AddrInfo) (*peer.AddrInfo, error) {
-	ctx, cancelDiscover := context.WithCancel(context.Background())
+// and sends the master public key, digest key and peer list to the new peer. progress,
+// if set, is told about every stage reached; the peer ID is empty while
+// searching. accept, if set, is asked about a verified peer before anything
+// is sent to it; its error ends the binding. Cancelling ctx stops the search
+// and any verification in progress.
+func BindNewPeer(ctx context.Context, syncPhrase string, node *P2PNode, masterPubKey ed25519.PublicKey, masterPrivKey ed25519.PrivateKey, digestKey []byte, existingPeers []peer.AddrInfo, progress func(stage BindStage, peerID peer.ID), accept func(peerID peer.ID) error) (*peer.AddrInfo, error) {
+	if progress == nil {
+		progress = func(BindStage, peer.ID) {}
+	}
+	ctx, cancelDiscover := context.WithCancel(ctx)
 	defer cancelDiscover()
 	fmt.Printf("Discovering peer with phrase: `%s`\n", syncPhrase)
+	progress(BindSearching, "")
 	nodes, err := node.discoverPeers(ctx, syncPhrase)
 	if err != nil {
 		return nil, err
@@ -120,6 +132,7 @@ func BindNewPeer(syncPhrase string, node *P2PNode, masterPubKey ed25519.PublicKe
 
 	for peerInfo := range nodes {
 		fmt.Println("Found peer", peerInfo.ID)
+		progress(BindPeerFound, peerInfo.ID)
 		err := node.host.Connect(ctx, peerInfo)
 		if err != nil {
 			fmt.Println("Error connecting to peer:", err)
@@ -130,7 +143,10 @@ func BindNewPeer(syncPhrase string, node *P2PNode, masterPubKey ed25519.PublicKe
 			fmt.Println("Error creating stream to peer:", err)
 			continue
 		}
+		progress(BindVerifying, peerInfo.ID)
+		stop := context.AfterFunc(ctx, func() { stream.Reset() })
 		verifiedPeer, err := mutualVerification(stream, syncPhrase)
+		stop()
 		if err != nil {
 			fmt.Println("Error during mutual verification:", err)
 			stream.Close()
@@ -138,12 +154,22 @@ func BindNewPeer(syncPhrase string, node *P2PNode, masterPubKey ed25519.PublicKe
 		}
 		if verifiedPeer {
 			fmt.Println("Successfully verified peer:", peerInfo.ID)
+			if accept != nil {
+				if err := accept(peerInfo.ID); err != nil {
+					stream.Reset()
+					return nil, err
+				}
+			}
+			progress(BindSendingPeerList, peerInfo.ID)
 
 			// Build peer list entries
 			peerList := make([]PeerListEntry, 0, len(existingPeers))
 			for _, p := range existingPeers {
+				if len(peerList) == MaxPeerListEntries {
+					break
+				}
 				addrs := make([]string, 0, len(p.Addrs))
-				for _, addr := range p.Addrs {
+				for _, addr := range FilterPeerAddrs(p.Addrs) {
 					addrs = append(addrs, addr.String())
 				}
 				peerList = append(peerList, PeerListEntry{
@@ -158,6 +184,9 @@ func BindNewPeer(syncPhrase string, node *P2PNode, masterPubKey ed25519.PublicKe
 				PeerID:                peerInfo.ID.String(),
 				PeerList:              peerList,
 			}
+			if digestKey != nil {
+				c.DigestKeyBase64 = base64.StdEncoding.EncodeToString(digestKey)
+			}
 			jsonData, err := json.Marshal(c)
 			if err != nil {
 				fmt.Println("Error marshaling client info:", err)
@@ -173,6 +202,10 @@ func BindNewPeer(syncPhrase string, node *P2PNode, masterPubKey ed25519.PublicKe
 
 			return &peerInfo, nil
 		}
+		stream.Close()
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
 	return nil, fmt.Errorf("no peers found")
 }
@@ -196,7 +229,7 @@ func mutualVerification(stream network.Stream, syncPhrase string) (result bool,
 	//read challenge
 	challenge := [32]byte{}
 	stream.SetReadDeadline(time.Now().Add(time.Second * 30))
-	_, err = stream.Read(challenge[:])
+	_, err = io.ReadFull(stream, challenge[:])
 	if err != nil {
 		fmt.Println("Error reading from stream:", err)
 		return
@@ -212,22 +245,50 @@ func mutualVerification(stream network.Stream, syncPhrase string) (result bool,
 	}
 	stream.Write(resp)
 
-	peerRespBytes := make([]byte, 1024)
-	n, err := stream.Read(peerRespBytes)
+	peerRespBytes, err := readChallengeResponse(stream)
 	if err != nil {
 		return
 	}
-	//unmarshal peer response
-	var peerResp challengeResponse
-	err = json.Unmarshal(peerRespBytes[:n], &peerResp)
+	peerResp, err := parseChallengeResponse(peerRespBytes)
 	if err != nil {
-		fmt.Println("Error unmarshalling peer response")
+		fmt.Println("Error parsing peer response:", err)
 		return
 	}
 
 	return verifyChallengeResponse(syncPhrase, ourChallenge, peerResp), nil
 }
 
+// readChallengeResponse reads the peer's challenge response up to its closing
+// brace, which can't occur inside the base64 fields. The client info a master
+// sends right after its response is left on the stream.
+func readChallengeResponse(r io.Reader) ([]byte, error) {
+	resp := make([]byte, 0, 128)
+	b := make([]byte, 1)
+	for len(resp) < maxChallengeResponseSize {
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		resp = append(resp, b[0])
+		if b[0] == '}' {
+			return resp, nil
+		}
+	}
+	return nil, fmt.Errorf("challenge response exceeds %d bytes", maxChallengeResponseSize)
+}
+
+// parseChallengeResponse decodes a challenge response, which must carry a
+// full-size scrypt result and salt
+func parseChallengeResponse(data []byte) (challengeResponse, error) {
+	var resp challengeResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return challengeResponse{}, err
+	}
+	if len(resp.Result) != 32 || len(resp.Salt) != 32 {
+		return challengeResponse{}, fmt.Errorf("challenge response has a %d byte result and %d byte salt, expected 32 each", len(resp.Result), len(resp.Salt))
+	}
+	return resp, nil
+}
+
 func solveChallenge(syncPhrase string, challenge [32]byte) (challengeResponse, error) {
 	salt := [32]byte{}
 	_, err := rand.Read(salt[:])
@@ -249,30 +310,69 @@ func verifyChallengeResponse(syncPhrase string, challenge [32]byte, response cha
 	return bytes.Equal(key, response.Result)
 }
 
+// readClientInfo reads the vault details a master sends after verification.
+// The master's address is taken from the connection.
+func readClientInfo(s network.Stream) (*ClientInfo, error) {
+	buf := new(bytes.Buffer)
+	if _, err := buf.ReadFrom(io.LimitReader(s, maxClientInfoSize)); err != nil {
+		return nil, err
+	}
+	info, err := parseClientInfo(buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	info.AddrInfo = peer.AddrInfo{
+		ID:    info.PeerID,
+		Addrs: []multiaddr.Multiaddr{s.Conn().RemoteMultiaddr()},
+	}
+	return info, nil
+}
+
+// parseClientInfo decodes and validates a ClientInfoMsg
+func parseClientInfo(data []byte) (*ClientInfo, error) {
+	var msg ClientInfoMsg
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil, fmt.Errorf("invalid client info message: %w", err)
+	}
+	return clientInfoMsgToClientInfo(&msg)
+}
+
 func clientInfoMsgToClientInfo(msg *ClientInfoMsg) (*ClientInfo, error) {
 	masterPubKeyBytes, err := base64.StdEncoding.DecodeString(msg.MasterPublicKeyBase64)
 	if err != nil {
 		return nil, err
 	}
-	peerID, err := peer.Decode(msg.PeerID)
+	if len(masterPubKeyBytes) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("master public key is %d bytes, expected %d", len(masterPubKeyBytes), ed25519.PublicKeySize)
+	}
+	peerID, err := ParsePeerID(msg.PeerID)
 	if err != nil {
 		return nil, err
 	}
+	var digestKey []byte
+	if msg.DigestKeyBase64 != "" {
+		if digestKey, err = base64.StdEncoding.DecodeString(msg.DigestKeyBase64); err != nil {
+			return nil, err
+		}
+		if len(digestKey) != 32 {
+			return nil, fmt.Errorf("digest key is %d bytes, expected 32", len(digestKey))
+		}
+	}
+	if len(msg.PeerList) > MaxPeerListEntries {
+		return nil, fmt.Errorf("peer list has %d entries, limit is %d", len(msg.PeerList), MaxPeerListEntries)
+	}
 
 	// Parse peer list
 	var peerList []peer.AddrInfo
 	for _, entry := range msg.PeerList {
-		pid, err := peer.Decode(entry.PeerID)
+		pid, err := ParsePeerID(entry.PeerID)
 		if err != nil {
+			fmt.Println("Warning: Skipping peer list entry:", err)
 			continue
 		}
-		var addrs []multiaddr.Multiaddr
-		for _, addrStr := range entry.Addresses {
-			addr, err := multiaddr.NewMultiaddr(addrStr)
-			if err != nil {
-				continue
-			}
-			addrs = append(addrs, addr)
+		addrs, err := ParsePeerAddrs(entry.Addresses)
+		if err != nil {
+			return nil, fmt.Errorf("peer %s: %w", pid, err)
 		}
 		peerList = append(peerList, peer.AddrInfo{ID: pid, Addrs: addrs})
 	}
@@ -281,6 +381,7 @@ func clientInfoMsgToClientInfo(msg *ClientInfoMsg) (*ClientInfo, error) {
 		MasterPublicKey: ed25519.PublicKey(masterPubKeyBytes),
 		PeerID:          peerID,
 		PeerList:        peerList,
+		DigestKey:       digestKey,
 	}, nil
 }
 
@@ -296,52 +397,57 @@ func newMnemonic(numWords int) string {
 
 // StartBindingService is a non-blocking version of BindToClient for UI use.
 // Returns a channel that will receive the ClientInfo when binding completes,
-// and the sync phrase to display to the user.
+// and the sync phrase to display to the user. The session ends with the
+// first verified client or when ctx is done, whichever comes first: the
+// stream handler is removed, the advertisement is stopped, verifications in
+// progress are reset, and the channel is closed without a value if no client
+// bound.
 func StartBindingService(node *P2PNode, ctx context.Context) (<-chan *ClientInfo, string, error) {
 	syncPhrase := newMnemonic(4)
-	node.Advertize(ctx, syncPhrase, time.Hour)
+	advertCtx, cancelAdvert := context.WithCancel(ctx)
+	node.Advertize(advertCtx, syncPhrase, BindTimeout)
 
 	var mutex sync.Mutex
-	clientInfo := make(chan *ClientInfo, 1)
+	verified := make(chan *ClientInfo, 1)
 
 	node.host.SetStreamHandler(bindProtocolID, func(s network.Stream) {
+		stop := context.AfterFunc(ctx, func() { s.Reset() })
+		defer stop()
 		mutex.Lock()
 		defer mutex.Unlock()
 		defer s.Close()
+		if ctx.Err() != nil {
+			return
+		}
 		time.Sleep(time.Millisecond * 250)
 
 		verifiedPeer, err := mutualVerification(s, syncPhrase)
 		if err == nil && verifiedPeer {
-			c := &ClientInfoMsg{}
-			buf := new(bytes.Buffer)
-			_, err = buf.ReadFrom(s)
+			info, err := readClientInfo(s)
 			if err != nil {
 				fmt.Println("Error reading client info:", err)
 				return
 			}
-			err = json.Unmarshal(buf.Bytes(), c)
-			if err != nil {
-				fmt.Println("Error unmarshaling client info:", err)
-				return
-			}
-			info, err := clientInfoMsgToClientInfo(c)
-			if err != nil {
-				fmt.Println("Error converting client info message:", err)
-				return
-			}
-			info.AddrInfo = peer.AddrInfo{
-				ID:    info.PeerID,
-				Addrs: []multiaddr.Multiaddr{s.Conn().RemoteMultiaddr()},
+			// Only the first client binds
+			select {
+			case verified <- info:
+			default:
 			}
-			clientInfo <- info
-			node.host.RemoveStreamHandler(bindProtocolID)
 		}
 	})
 
-	// Clean up handler when context is cancelled
+	clientInfo := make(chan *ClientInfo, 1)
 	go func() {
-		<-ctx.Done()
+		var info *ClientInfo
+		select {
+		case info = <-verified:
+		case <-ctx.Done():
+		}
 		node.host.RemoveStreamHandler(bindProtocolID)
+		cancelAdvert()
+		if info != nil {
+			clientInfo <- info
+		}
 		close(clientInfo)
 	}()
 
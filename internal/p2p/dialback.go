@@ -0,0 +1,87 @@
+package p2p
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/transport"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// dialBackTimeout bounds the probe of a single address
+const dialBackTimeout = 10 * time.Second
+
+// dialer is implemented by the swarm and picks the transport for an address
+type dialer interface {
+	TransportForDialing(multiaddr.Multiaddr) transport.Transport
+}
+
+// VerifyAddrs dials each address of a peer on its own and splits them into
+// those that completed a handshake with the expected peer ID and those that
+// did not. Addresses of open connections count as verified without a dial.
+// If no address answers the peer is probably offline, so the check is
+// inconclusive and every address is returned as verified.
+func (p *P2PNode) VerifyAddrs(ctx context.Context, info peer.AddrInfo) (verified, unverified []multiaddr.Multiaddr) {
+	if info.ID == p.host.ID() || len(info.Addrs) == 0 {
+		return info.Addrs, nil
+	}
+
+	connected := map[string]bool{}
+	for _, conn := range p.host.Network().ConnsToPeer(info.ID) {
+		connected[conn.RemoteMultiaddr().String()] = true
+	}
+
+	ok := make([]bool, len(info.Addrs))
+	var wg sync.WaitGroup
+	for i, addr := range info.Addrs {
+		if connected[addr.String()] {
+			ok[i] = true
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok[i] = p.dialBack(ctx, info.ID, addr)
+		}()
+	}
+	wg.Wait()
+
+	for i, addr := range info.Addrs {
+		if ok[i] {
+			verified = append(verified, addr)
+		} else {
+			unverified = append(unverified, addr)
+		}
+	}
+	if len(verified) == 0 {
+		return info.Addrs, nil
+	}
+	return verified, unverified
+}
+
+// dialBack opens a raw transport connection to one address, bypassing the
+// swarm so other addresses of the peer aren't tried, and closes it again
+func (p *P2PNode) dialBack(ctx context.Context, id peer.ID, addr multiaddr.Multiaddr) bool {
+	d, ok := p.host.Network().(dialer)
+	if !ok {
+		return false
+	}
+	if transportAddr, _ := peer.SplitAddr(addr); transportAddr != nil {
+		addr = transportAddr
+	}
+	tpt := d.TransportForDialing(addr)
+	if tpt == nil {
+		return false
+	}
+
+	dialCtx, cancel := context.WithTimeout(ctx, dialBackTimeout)
+	defer cancel()
+	conn, err := tpt.Dial(dialCtx, addr, id)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return conn.RemotePeer() == id
+}
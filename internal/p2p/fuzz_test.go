@@ -0,0 +1,128 @@
+package p2p
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// fuzzPeerID returns the peer ID of the n'th fixed test key
+func fuzzPeerID(tb testing.TB, n byte) string {
+	tb.Helper()
+	seed := bytes.Repeat([]byte{n}, ed25519.SeedSize)
+	priv, err := crypto.UnmarshalEd25519PrivateKey(ed25519.NewKeyFromSeed(seed))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	id, err := peer.IDFromPrivateKey(priv)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return id.String()
+}
+
+// fuzzClientInfo is a valid bind message, as a master sends it
+func fuzzClientInfo(tb testing.TB) []byte {
+	tb.Helper()
+	msg, err := json.Marshal(ClientInfoMsg{
+		MasterPublicKeyBase64: base64.StdEncoding.EncodeToString(make([]byte, ed25519.PublicKeySize)),
+		PeerID:                fuzzPeerID(tb, 1),
+		PeerList:              []PeerListEntry{{PeerID: fuzzPeerID(tb, 2), Addresses: []string{"/ip4/10.0.0.2/tcp/13000"}}},
+		DigestKeyBase64:       base64.StdEncoding.EncodeToString(make([]byte, 32)),
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return msg
+}
+
+// FuzzClientInfo feeds the bind message a master sends a new replica through
+// decoding and validation
+func FuzzClientInfo(f *testing.F) {
+	valid := fuzzClientInfo(f)
+	f.Add(valid)
+	f.Add([]byte(`{"MasterPublicKeyBase64":"AAAA","PeerID":""}`))
+	f.Add([]byte(`{"PeerList":null}`))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		info, err := parseClientInfo(data)
+		if err != nil {
+			if bytes.Equal(data, valid) {
+				t.Fatalf("valid client info refused: %v", err)
+			}
+			return
+		}
+		if len(info.MasterPublicKey) != ed25519.PublicKeySize {
+			t.Fatalf("accepted a %d byte master public key", len(info.MasterPublicKey))
+		}
+		if len(info.PeerList) > MaxPeerListEntries {
+			t.Fatalf("accepted %d peer list entries", len(info.PeerList))
+		}
+		for _, p := range info.PeerList {
+			if len(p.Addrs) > MaxPeerAddrs {
+				t.Fatalf("accepted %d addresses for %s", len(p.Addrs), p.ID)
+			}
+		}
+	})
+}
+
+// FuzzHello feeds a stream hello frame and a status byte through the checks
+// of both sides of the handshake. A frame is checked against the fingerprint
+// it carries, so well-formed frames pass.
+func FuzzHello(f *testing.F) {
+	valid := append([]byte{helloVersion}, bytes.Repeat([]byte{0xab}, fingerprintSize)...)
+	f.Add(valid)
+	f.Add(append([]byte{helloVersion + 1}, make([]byte, fingerprintSize)...))
+	f.Add([]byte{helloVersion})
+	f.Add([]byte{})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if len(data) > 0 {
+			helloStatusError(data[0])
+		}
+		fingerprint := make([]byte, fingerprintSize)
+		if len(data) == helloFrameSize {
+			copy(fingerprint, data[1:])
+		}
+		status, err := checkHello(data, fingerprint)
+		if (status == helloStatusOK) != (err == nil) {
+			t.Fatalf("hello status %d with error %v", status, err)
+		}
+		if bytes.Equal(data, valid) && err != nil {
+			t.Fatalf("valid hello refused: %v", err)
+		}
+	})
+}
+
+// FuzzChallengeResponse feeds the bytes a binding peer sends after its
+// challenge through framing and decoding. A master sends its client info
+// right after the response, which the framing must leave on the stream.
+func FuzzChallengeResponse(f *testing.F) {
+	resp, err := json.Marshal(challengeResponse{Result: make([]byte, 32), Salt: make([]byte, 32)})
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(resp)
+	f.Add(append(append([]byte{}, resp...), fuzzClientInfo(f)...))
+	f.Add([]byte(`{"Result":"","Salt":""}`))
+	f.Add([]byte(`{"Result":`))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		r := bytes.NewReader(data)
+		got, err := readChallengeResponse(r)
+		if err != nil {
+			return
+		}
+		if !bytes.HasPrefix(data, got) || got[len(got)-1] != '}' {
+			t.Fatal("challenge response framing read past its end")
+		}
+		if r.Len() != len(data)-len(got) {
+			t.Fatal("challenge response framing consumed the bytes after it")
+		}
+		if _, err := parseChallengeResponse(got); err != nil && bytes.HasPrefix(data, resp) {
+			t.Fatalf("valid challenge response refused: %v", err)
+		}
+	})
+}
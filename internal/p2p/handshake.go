@@ -0,0 +1,105 @@
+package p2p
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+)
+
+// Every authenticated stream starts with a hello frame carrying the vault
+// fingerprint of the opening side. The handler answers with a single status
+// byte so both sides learn about a vault mismatch before any payload is sent.
+const (
+	helloVersion        = 1
+	helloFrameSize      = 1 + fingerprintSize
+	fingerprintSize     = 32
+	helloTimeout        = 30 * time.Second
+	helloStatusOK       = 0
+	helloStatusMismatch = 1
+	helloStatusVersion  = 2
+)
+
+// ErrVaultMismatch is returned when the remote peer belongs to a different vault
+var ErrVaultMismatch = errors.New("peer belongs to a different vault (master key fingerprint mismatch)")
+
+// SetVaultFingerprint sets the master key fingerprint sent in every stream hello
+func (p *P2PNode) SetVaultFingerprint(fingerprint []byte) {
+	fp := make([]byte, fingerprintSize)
+	copy(fp, fingerprint)
+	p.fingerprint.Store(&fp)
+}
+
+func (p *P2PNode) vaultFingerprint() []byte {
+	fp := p.fingerprint.Load()
+	if fp == nil {
+		return make([]byte, fingerprintSize)
+	}
+	return *fp
+}
+
+// sendHello writes our hello frame and waits for the remote status byte
+func (p *P2PNode) sendHello(s network.Stream) error {
+	frame := append([]byte{helloVersion}, p.vaultFingerprint()...)
+	if _, err := s.Write(frame); err != nil {
+		return fmt.Errorf("failed to send hello: %w", err)
+	}
+
+	s.SetReadDeadline(time.Now().Add(helloTimeout))
+	defer s.SetReadDeadline(time.Time{})
+
+	status := make([]byte, 1)
+	if _, err := io.ReadFull(s, status); err != nil {
+		return fmt.Errorf("failed to read hello status: %w", err)
+	}
+	return helloStatusError(status[0])
+}
+
+// helloStatusError turns the status byte answering our hello into an error
+func helloStatusError(status byte) error {
+	switch status {
+	case helloStatusOK:
+		return nil
+	case helloStatusMismatch:
+		return ErrVaultMismatch
+	case helloStatusVersion:
+		return fmt.Errorf("peer does not support hello version %d", helloVersion)
+	default:
+		return fmt.Errorf("unknown hello status %d", status)
+	}
+}
+
+// receiveHello reads the remote hello frame and answers with our status byte
+func (p *P2PNode) receiveHello(s network.Stream) error {
+	s.SetReadDeadline(time.Now().Add(helloTimeout))
+	defer s.SetReadDeadline(time.Time{})
+
+	frame := make([]byte, helloFrameSize)
+	if _, err := io.ReadFull(s, frame); err != nil {
+		return fmt.Errorf("failed to read hello: %w", err)
+	}
+
+	status, err := checkHello(frame, p.vaultFingerprint())
+	if _, werr := s.Write([]byte{status}); err == nil {
+		err = werr
+	}
+	return err
+}
+
+// checkHello validates a received hello frame against our fingerprint and
+// returns the status byte to answer with
+func checkHello(frame, fingerprint []byte) (byte, error) {
+	if len(frame) != helloFrameSize {
+		return helloStatusVersion, fmt.Errorf("hello frame is %d bytes, expected %d", len(frame), helloFrameSize)
+	}
+	if frame[0] != helloVersion {
+		return helloStatusVersion, fmt.Errorf("unsupported hello version %d", frame[0])
+	}
+	if !bytes.Equal(frame[1:], fingerprint) {
+		return helloStatusMismatch, ErrVaultMismatch
+	}
+	return helloStatusOK, nil
+}
@@ -3,21 +3,70 @@ package p2p
 import (
 	"context"
 	"encoding/hex"
+	"fmt"
+	"time"
 
 	gossipsub "github.com/libp2p/go-libp2p-pubsub"
 	"github.com/libp2p/go-libp2p/core/peer"
 )
 
-func (p *P2PNode) StartNotifyService(ctx context.Context, notification func([]byte, peer.ID), topicID []byte) (publishNotification func([]byte) error, err error) {
+// NotifyOptions configures the gossip topic of the vault
+type NotifyOptions struct {
+	// History is how long sent messages are kept to answer peers that
+	// missed them, rounded to gossipsub heartbeats
+	History time.Duration
+	// MaxMessageSize is the largest message accepted from a peer
+	MaxMessageSize int
+	// Validate checks the content of a message before it is delivered or
+	// forwarded. Messages it fails count against the peer that sent them.
+	Validate func(data []byte) error
+	// Rejected is called with every message that failed validation
+	Rejected func(from peer.ID, err error)
+}
+
+// DefaultNotifyOptions keeps the gossipsub history and caps messages at the
+// size traffic padding pads up to
+func DefaultNotifyOptions() NotifyOptions {
+	return NotifyOptions{
+		History:        time.Duration(gossipsub.GossipSubHistoryLength) * gossipsub.GossipSubHeartbeatInterval,
+		MaxMessageSize: 256 << 10,
+	}
+}
+
+// Peer scoring: gossipsub prunes peers with a negative score from the mesh,
+// stops gossiping with them below notifyGossipThreshold and ignores them
+// altogether below notifyGraylistThreshold. Every invalid message costs the
+// square of the invalid count times notifyInvalidWeight, so one bad message
+// drops a peer from the mesh and a handful graylists it, for about an hour.
+const (
+	notifyInvalidWeight      = -100
+	notifyInvalidDecay       = time.Hour
+	notifyGossipThreshold    = -100
+	notifyPublishThreshold   = -500
+	notifyGraylistThreshold  = -1000
+	notifyScoreRetention     = 10 * time.Minute
+	notifyFirstDeliveryCap   = 10
+	notifyFirstDeliveryDecay = 10 * time.Minute
+)
+
+func (p *P2PNode) StartNotifyService(ctx context.Context, notification func([]byte, peer.ID), topicID []byte, opts NotifyOptions) (publishNotification func([]byte) error, err error) {
+	topicName := hex.EncodeToString(topicID)
+	params, thresholds := notifyPeerScore(topicName)
 	gossip, err := gossipsub.NewGossipSub(ctx,
 		p.host,
 		gossipsub.WithPeerFilter(p.filterNotifyPeers),
-		gossipsub.WithDiscovery(p.discovery))
+		gossipsub.WithDiscovery(p.discovery),
+		gossipsub.WithGossipSubParams(opts.gossipSubParams()),
+		gossipsub.WithPeerScore(params, thresholds))
 	if err != nil {
 		return nil, err
 	}
 
-	topic, err := gossip.Join(hex.EncodeToString(topicID))
+	if err := gossip.RegisterTopicValidator(topicName, p.notifyValidator(opts)); err != nil {
+		return nil, err
+	}
+
+	topic, err := gossip.Join(topicName)
 	if err != nil {
 		return nil, err
 	}
@@ -45,6 +94,76 @@ func (p *P2PNode) StartNotifyService(ctx context.Context, notification func([]by
 	}, nil
 }
 
+// gossipSubParams applies the history to the default router parameters
+func (o NotifyOptions) gossipSubParams() gossipsub.GossipSubParams {
+	params := gossipsub.DefaultGossipSubParams()
+	if o.History > 0 {
+		params.HistoryLength = max(1, int(o.History/params.HeartbeatInterval))
+		params.HistoryGossip = min(params.HistoryGossip, params.HistoryLength)
+	}
+	return params
+}
+
+// notifyValidator runs in the router before a message is delivered or
+// forwarded, so a rejected message never reaches the handler and counts
+// against the peer that sent it
+func (p *P2PNode) notifyValidator(opts NotifyOptions) gossipsub.ValidatorEx {
+	return func(ctx context.Context, from peer.ID, msg *gossipsub.Message) gossipsub.ValidationResult {
+		if from == p.host.ID() {
+			return gossipsub.ValidationAccept
+		}
+		var err error
+		if opts.MaxMessageSize > 0 && len(msg.Data) > opts.MaxMessageSize {
+			err = fmt.Errorf("message of %d bytes exceeds the %d byte limit", len(msg.Data), opts.MaxMessageSize)
+		} else if _, ok := p.peers.Load(msg.GetFrom()); !ok {
+			// The author may have been bound moments ago; the message is
+			// dropped without blaming the peer that relayed it
+			return gossipsub.ValidationIgnore
+		} else if opts.Validate != nil {
+			err = opts.Validate(msg.Data)
+		}
+		if err != nil {
+			if opts.Rejected != nil {
+				opts.Rejected(from, err)
+			}
+			return gossipsub.ValidationReject
+		}
+		return gossipsub.ValidationAccept
+	}
+}
+
+// notifyPeerScore scores peers on the notify topic by the messages they
+// deliver first and the invalid ones they send. Vault peers often share an
+// address, so IP colocation is not penalized.
+func notifyPeerScore(topicName string) (*gossipsub.PeerScoreParams, *gossipsub.PeerScoreThresholds) {
+	params := &gossipsub.PeerScoreParams{
+		SkipAtomicValidation: true,
+		Topics: map[string]*gossipsub.TopicScoreParams{
+			topicName: {
+				SkipAtomicValidation:           true,
+				TopicWeight:                    1,
+				TimeInMeshQuantum:              time.Second, // Unweighted, but the router divides by it
+				FirstMessageDeliveriesWeight:   1,
+				FirstMessageDeliveriesDecay:    gossipsub.ScoreParameterDecay(notifyFirstDeliveryDecay),
+				FirstMessageDeliveriesCap:      notifyFirstDeliveryCap,
+				InvalidMessageDeliveriesWeight: notifyInvalidWeight,
+				InvalidMessageDeliveriesDecay:  gossipsub.ScoreParameterDecay(notifyInvalidDecay),
+			},
+		},
+		AppSpecificScore: func(peer.ID) float64 { return 0 },
+		DecayInterval:    gossipsub.DefaultDecayInterval,
+		DecayToZero:      gossipsub.DefaultDecayToZero,
+		RetainScore:      notifyScoreRetention,
+	}
+	thresholds := &gossipsub.PeerScoreThresholds{
+		SkipAtomicValidation: true,
+		GossipThreshold:      notifyGossipThreshold,
+		PublishThreshold:     notifyPublishThreshold,
+		GraylistThreshold:    notifyGraylistThreshold,
+	}
+	return params, thresholds
+}
+
 func (p *P2PNode) filterNotifyPeers(peerID peer.ID, topic string) bool {
 	if _, ok := p.peers.Load(peerID); ok {
 		return true
@@ -5,6 +5,7 @@ import (
 	"crypto/ed25519"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/libp2p/go-libp2p"
@@ -15,6 +16,7 @@ import (
 	"github.com/libp2p/go-libp2p/core/host"
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/peerstore"
 	"github.com/libp2p/go-libp2p/core/protocol"
 	"github.com/libp2p/go-libp2p/p2p/discovery/routing"
 	"github.com/libp2p/go-libp2p/p2p/net/connmgr"
@@ -24,15 +26,23 @@ import (
 	"golang.org/x/crypto/scrypt"
 )
 
+// vaultPeerTag protects connections to vault peers in the connection manager
+const vaultPeerTag = "endershare-vault"
+
+// peerDialTimeout bounds the background dial to a newly added peer
+const peerDialTimeout = 30 * time.Second
+
 type P2PNode struct {
 	host        host.Host
 	notifyTopic *gossipsub.Topic
 	peers       *safemap.SafeMap[peer.ID, peer.AddrInfo]
+	peersMu     sync.Mutex // Serializes changes to peers with their libp2p side effects
 	dht         *dht.IpfsDHT
-	discovery   *routing.RoutingDiscovery
+	discovery   discovery.Discovery
+	fingerprint atomic.Pointer[[]byte] // Vault fingerprint sent in stream hellos
 }
 
-func NewP2PNode(peerPrivKey ed25519.PrivateKey, ctx context.Context, peers []peer.AddrInfo, port int) (*P2PNode, error) {
+func NewP2PNode(peerPrivKey ed25519.PrivateKey, ctx context.Context, peers []peer.AddrInfo, port int, opts TransportOptions) (*P2PNode, error) {
 	n := &P2PNode{
 		peers: safemap.NewSafeMap[peer.ID, peer.AddrInfo](),
 	}
@@ -45,7 +55,7 @@ func NewP2PNode(peerPrivKey ed25519.PrivateKey, ctx context.Context, peers []pee
 	if err != nil {
 		return nil, err
 	}
-	mgr, err := connmgr.NewConnManager(50, 100)
+	mgr, err := connmgr.NewConnManager(opts.connLimits())
 	if err != nil {
 		return nil, err
 	}
@@ -53,9 +63,10 @@ func NewP2PNode(peerPrivKey ed25519.PrivateKey, ctx context.Context, peers []pee
 		libp2p.Identity(lpriv),
 		libp2p.EnableAutoNATv2(),
 		libp2p.EnableHolePunching(),
-		libp2p.EnableRelayService(relay.WithACL(NewRelayACL(n)), relay.WithInfiniteLimits()),
+		libp2p.EnableRelayService(relay.WithACL(NewRelayACL(n)), relay.WithResources(opts.relayResources())),
 		libp2p.DisableMetrics(),
 		libp2p.Security(libp2ptls.ID, libp2ptls.New),
+		opts.muxerOption(),
 		libp2p.ConnectionManager(mgr),
 		libp2p.ListenAddrStrings(fmt.Sprintf("/ip4/0.0.0.0/tcp/%d", port),
 			fmt.Sprintf("/ip6/::/tcp/%d", port),
@@ -70,6 +81,9 @@ func NewP2PNode(peerPrivKey ed25519.PrivateKey, ctx context.Context, peers []pee
 	fmt.Println("Node started with ID:", host.ID())
 
 	n.host = host
+	for _, p := range peers {
+		host.ConnManager().Protect(p.ID, vaultPeerTag)
+	}
 
 	err = n.setupDiscovery(ctx)
 	if err != nil {
@@ -79,38 +93,148 @@ func NewP2PNode(peerPrivKey ed25519.PrivateKey, ctx context.Context, peers []pee
 	return n, nil
 }
 
+// NewP2PNodeWithHost wraps an existing host, for nodes embedded in another
+// process such as in-memory test networks. No DHT is started; rendezvous for
+// binding and connection management go through disc instead.
+func NewP2PNodeWithHost(h host.Host, peers []peer.AddrInfo, disc discovery.Discovery) *P2PNode {
+	n := &P2PNode{
+		host:      h,
+		peers:     safemap.NewSafeMap[peer.ID, peer.AddrInfo](),
+		discovery: disc,
+	}
+	for _, p := range peers {
+		n.peers.Store(p.ID, p)
+		h.ConnManager().Protect(p.ID, vaultPeerTag)
+	}
+	return n
+}
+
+// Close shuts down the DHT and the host
+func (p *P2PNode) Close() error {
+	if p.dht != nil {
+		p.dht.Close()
+	}
+	return p.host.Close()
+}
+
 func (p *P2PNode) GetPeerId() peer.ID {
 	return p.host.ID()
 }
 
 // NewStreamToPeer creates a new stream to an authenticated peer
+// and completes the vault fingerprint hello before returning it
 func (p *P2PNode) NewStreamToPeer(peerID peer.ID, protocolID string) (network.Stream, error) {
 	if !p.checkPeerAllowed(peerID) {
 		return nil, fmt.Errorf("peer not allowed")
 	}
 	stream, err := p.host.NewStream(context.Background(), peerID, protocol.ID(protocolID))
-	return stream, err
+	if err != nil {
+		return nil, err
+	}
+	if err := p.sendHello(stream); err != nil {
+		stream.Reset()
+		return nil, fmt.Errorf("%s handshake with %s failed: %w", protocolID, peerID, err)
+	}
+	return stream, nil
 }
 
 // NewStreamHandler sets a stream handler for authenticated peers
+// Streams whose hello carries a different vault fingerprint are rejected
 func (p *P2PNode) NewStreamHandler(protocolID string, handler func(network.Stream)) {
 	p.host.SetStreamHandler(protocol.ID(protocolID), func(s network.Stream) {
 		if !p.checkPeerAllowed(s.Conn().RemotePeer()) {
 			s.Reset()
 			return
 		}
+		if err := p.receiveHello(s); err != nil {
+			fmt.Printf("Rejected %s stream from %s: %v\n", protocolID, s.Conn().RemotePeer(), err)
+			s.Close()
+			return
+		}
 		handler(s)
 	})
 }
 
+// AddPeer allows a vault peer, protects its connections from the connection
+// manager and dials it in the background if it isn't connected yet
 func (p *P2PNode) AddPeer(addrInfo peer.AddrInfo) {
+	p.peersMu.Lock()
+	defer p.peersMu.Unlock()
 	p.peers.Store(addrInfo.ID, addrInfo)
+	p.admitPeer(addrInfo)
+}
+
+// SetPeerAddrs replaces the addresses of a peer that is still in the peers list
+func (p *P2PNode) SetPeerAddrs(addrInfo peer.AddrInfo) {
+	p.peersMu.Lock()
+	defer p.peersMu.Unlock()
+	if _, ok := p.peers.Load(addrInfo.ID); ok {
+		p.peers.Store(addrInfo.ID, addrInfo)
+		p.admitPeer(addrInfo)
+	}
 }
 
+// RemovePeer revokes a peer: its streams and gossip are refused from now on
+// and its open connections are closed
+func (p *P2PNode) RemovePeer(peerID peer.ID) {
+	p.peersMu.Lock()
+	defer p.peersMu.Unlock()
+	p.peers.Delete(peerID)
+	p.evictPeer(peerID)
+}
+
+// ReplacePeers swaps in a new peer list. Peers in both lists stay allowed
+// throughout; peers that are no longer listed are disconnected.
 func (p *P2PNode) ReplacePeers(peers []peer.AddrInfo) {
-	p.peers.Clear()
+	p.peersMu.Lock()
+	defer p.peersMu.Unlock()
+
+	removed := p.peers.Keys()
+	m := make(map[peer.ID]peer.AddrInfo, len(peers))
+	for _, peerInfo := range peers {
+		m[peerInfo.ID] = peerInfo
+	}
+	p.peers.Replace(m)
+
 	for _, peerInfo := range peers {
-		p.peers.Store(peerInfo.ID, peerInfo)
+		p.admitPeer(peerInfo)
+	}
+	for _, id := range removed {
+		if _, ok := m[id]; !ok {
+			p.evictPeer(id)
+		}
+	}
+}
+
+// admitPeer tells libp2p about a peer that was just allowed
+func (p *P2PNode) admitPeer(addrInfo peer.AddrInfo) {
+	if p.host == nil || addrInfo.ID == p.host.ID() {
+		return
+	}
+	p.host.ConnManager().Protect(addrInfo.ID, vaultPeerTag)
+	if len(addrInfo.Addrs) == 0 {
+		return
+	}
+	p.host.Peerstore().AddAddrs(addrInfo.ID, addrInfo.Addrs, peerstore.AddressTTL)
+	if p.host.Network().Connectedness(addrInfo.ID) != network.Connected {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), peerDialTimeout)
+			defer cancel()
+			if err := p.connectPreferred(ctx, addrInfo); err != nil {
+				fmt.Printf("Could not reach new peer %s yet: %v\n", addrInfo.ID, err)
+			}
+		}()
+	}
+}
+
+// evictPeer tells libp2p about a peer that is no longer allowed
+func (p *P2PNode) evictPeer(peerID peer.ID) {
+	if p.host == nil || peerID == p.host.ID() {
+		return
+	}
+	p.host.ConnManager().Unprotect(peerID, vaultPeerTag)
+	if err := p.host.Network().ClosePeer(peerID); err != nil {
+		fmt.Printf("Warning: Failed to disconnect removed peer %s: %v\n", peerID, err)
 	}
 }
 
@@ -191,7 +315,7 @@ func (p *P2PNode) ManageConnections(ctx context.Context, key string) {
 		select {
 		case peer := <-peers:
 			if p.checkPeerAllowed(peer.ID) {
-				p.host.Connect(ctx, peer)
+				p.connectPreferred(ctx, peer)
 			}
 		case <-ctx.Done():
 			return
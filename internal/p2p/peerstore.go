@@ -0,0 +1,66 @@
+package p2p
+
+import (
+	"context"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// restoredAddrTTL is how long restored addresses stay in the peerstore. A
+// peer that was reached again will have its addresses refreshed by then.
+const restoredAddrTTL = time.Hour
+
+// PeerRecord is the part of the peerstore worth keeping across restarts
+type PeerRecord struct {
+	ID        peer.ID
+	Addrs     []multiaddr.Multiaddr
+	Latency   time.Duration // Zero if never measured
+	Protocols []protocol.ID
+}
+
+// PeerRecords snapshots the peerstore entries of vault peers with known addresses
+func (p *P2PNode) PeerRecords() []PeerRecord {
+	ps := p.host.Peerstore()
+	var records []PeerRecord
+	for _, id := range p.peers.Keys() {
+		if id == p.host.ID() {
+			continue
+		}
+		addrs := ps.Addrs(id)
+		if len(addrs) == 0 {
+			continue
+		}
+		protocols, _ := ps.GetProtocols(id)
+		records = append(records, PeerRecord{
+			ID:        id,
+			Addrs:     addrs,
+			Latency:   ps.LatencyEWMA(id),
+			Protocols: protocols,
+		})
+	}
+	return records
+}
+
+// RestorePeerRecords loads saved records into the peerstore and dials the
+// vault peers among them, so known peers reconnect before the DHT finds them
+func (p *P2PNode) RestorePeerRecords(ctx context.Context, records []PeerRecord) {
+	ps := p.host.Peerstore()
+	for _, r := range records {
+		if r.ID == p.host.ID() {
+			continue
+		}
+		ps.AddAddrs(r.ID, r.Addrs, restoredAddrTTL)
+		if r.Latency > 0 {
+			ps.RecordLatency(r.ID, r.Latency)
+		}
+		if len(r.Protocols) > 0 {
+			ps.AddProtocols(r.ID, r.Protocols...)
+		}
+		if p.checkPeerAllowed(r.ID) {
+			go p.connectPreferred(ctx, peer.AddrInfo{ID: r.ID, Addrs: r.Addrs})
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package p2p
+
+import (
+	"context"
+	"net"
+	"sort"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// Connection paths reported for a peer, best first
+const (
+	PathLAN    = "lan"
+	PathDirect = "direct"
+	PathRelay  = "relay"
+)
+
+// Address ranks, lower is preferred. Private ranges come first so peers on
+// the same network talk directly, public IPv6 is preferred over IPv4 on
+// dual-stack hosts since it avoids NAT, and relayed addresses come last.
+const (
+	rankLAN = iota
+	rankPublicIPv6
+	rankPublicIPv4
+	rankOther
+	rankRelay
+)
+
+// addrRank ranks a multiaddr by the routing policy
+func addrRank(addr multiaddr.Multiaddr) int {
+	if isRelayAddr(addr) {
+		return rankRelay
+	}
+	ip, err := manet.ToIP(addr)
+	if err != nil {
+		return rankOther
+	}
+	if isLANIP(ip) {
+		return rankLAN
+	}
+	if ip.To4() == nil {
+		return rankPublicIPv6
+	}
+	return rankPublicIPv4
+}
+
+func isRelayAddr(addr multiaddr.Multiaddr) bool {
+	_, err := addr.ValueForProtocol(multiaddr.P_CIRCUIT)
+	return err == nil
+}
+
+// isLANIP reports whether ip is loopback, link-local, RFC 1918 or an IPv6 ULA
+func isLANIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast()
+}
+
+// RankAddrs returns addrs ordered LAN first and relay last, keeping the
+// original order within a rank
+func RankAddrs(addrs []multiaddr.Multiaddr) []multiaddr.Multiaddr {
+	ranked := make([]multiaddr.Multiaddr, len(addrs))
+	copy(ranked, addrs)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return addrRank(ranked[i]) < addrRank(ranked[j])
+	})
+	return ranked
+}
+
+// rankPath maps an address rank to the path it represents
+func rankPath(rank int) string {
+	switch rank {
+	case rankLAN:
+		return PathLAN
+	case rankRelay:
+		return PathRelay
+	default:
+		return PathDirect
+	}
+}
+
+// bestConnRank returns the best rank among open connections to a peer
+func (p *P2PNode) bestConnRank(peerID peer.ID) (int, bool) {
+	conns := p.host.Network().ConnsToPeer(peerID)
+	if len(conns) == 0 {
+		return 0, false
+	}
+	best := rankRelay
+	for _, conn := range conns {
+		if rank := addrRank(conn.RemoteMultiaddr()); rank < best {
+			best = rank
+		}
+	}
+	return best, true
+}
+
+// GetPeerPath returns the best path currently used to reach a peer, or ""
+// when it is not connected
+func (p *P2PNode) GetPeerPath(peerIDStr string) string {
+	peerID, err := peer.Decode(peerIDStr)
+	if err != nil {
+		return ""
+	}
+	rank, ok := p.bestConnRank(peerID)
+	if !ok {
+		return ""
+	}
+	return rankPath(rank)
+}
+
+// LANPeers returns connected vault peers reachable over the LAN
+func (p *P2PNode) LANPeers() []peer.ID {
+	var lan []peer.ID
+	for _, id := range p.peers.Keys() {
+		if id == p.host.ID() {
+			continue
+		}
+		if rank, ok := p.bestConnRank(id); ok && rank == rankLAN {
+			lan = append(lan, id)
+		}
+	}
+	return lan
+}
+
+// connectPreferred connects to a peer using its best addresses first. If the
+// peer is already connected over a worse path than one it advertises, a direct
+// dial is forced so traffic moves onto the better path.
+func (p *P2PNode) connectPreferred(ctx context.Context, info peer.AddrInfo) error {
+	info.Addrs = RankAddrs(info.Addrs)
+	if len(info.Addrs) > 0 {
+		if current, ok := p.bestConnRank(info.ID); ok && addrRank(info.Addrs[0]) < current {
+			ctx = network.WithForceDirectDial(ctx, "lan-first")
+		}
+	}
+	return p.host.Connect(ctx, info)
+}
@@ -0,0 +1,83 @@
+package p2p
+
+import (
+	"fmt"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// Limits on peer information received from other nodes, checked before
+// anything is stored
+const (
+	MaxPeerListEntries       = 1024
+	MaxPeerAddrs             = 32
+	MaxAddrLength            = 256     // Bytes in the string form of one address
+	maxPeerIDLength          = 128     // Bytes in the string form of a peer ID
+	maxClientInfoSize        = 1 << 20 // Bytes of a bind message
+	maxChallengeResponseSize = 1024    // Bytes of a bind challenge response
+)
+
+// ParsePeerID decodes a peer ID received from another node. IDs that don't
+// encode back to the same string are rejected, so every node stores the
+// canonical form and peer list hashes agree.
+func ParsePeerID(s string) (peer.ID, error) {
+	if len(s) > maxPeerIDLength {
+		return "", fmt.Errorf("peer ID is %d bytes, limit is %d", len(s), maxPeerIDLength)
+	}
+	id, err := peer.Decode(s)
+	if err != nil {
+		return "", fmt.Errorf("invalid peer ID %q: %w", s, err)
+	}
+	if id.String() != s {
+		return "", fmt.Errorf("peer ID %q is not in canonical form", s)
+	}
+	return id, nil
+}
+
+// ParsePeerAddrs parses an address list received from another node. A list
+// over the count or length limits is rejected; addresses that don't parse or
+// can't be dialed are dropped.
+func ParsePeerAddrs(addrs []string) ([]multiaddr.Multiaddr, error) {
+	if len(addrs) > MaxPeerAddrs {
+		return nil, fmt.Errorf("%d addresses, limit is %d", len(addrs), MaxPeerAddrs)
+	}
+	var out []multiaddr.Multiaddr
+	for _, s := range addrs {
+		if len(s) > MaxAddrLength {
+			return nil, fmt.Errorf("address is %d bytes, limit is %d", len(s), MaxAddrLength)
+		}
+		addr, err := multiaddr.NewMultiaddr(s)
+		if err != nil || !dialableAddr(addr) {
+			continue
+		}
+		out = append(out, addr)
+	}
+	return out, nil
+}
+
+// FilterPeerAddrs drops addresses that other nodes would refuse and caps the
+// list at MaxPeerAddrs, for addresses this node sends out
+func FilterPeerAddrs(addrs []multiaddr.Multiaddr) []multiaddr.Multiaddr {
+	var out []multiaddr.Multiaddr
+	for _, addr := range addrs {
+		if len(out) == MaxPeerAddrs {
+			break
+		}
+		if len(addr.String()) <= MaxAddrLength && dialableAddr(addr) {
+			out = append(out, addr)
+		}
+	}
+	return out
+}
+
+// dialableAddr reports whether an address is in a reachability class another
+// node can connect to: public, private or loopback. Unspecified, link-local
+// IPv6 (meaningless without the zone), unroutable and non-IP addresses are not.
+func dialableAddr(addr multiaddr.Multiaddr) bool {
+	if manet.IsIPUnspecified(addr) || manet.IsIP6LinkLocal(addr) {
+		return false
+	}
+	return manet.IsPublicAddr(addr) || manet.IsPrivateAddr(addr)
+}
@@ -0,0 +1,99 @@
+package p2p
+
+import (
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/p2p/muxer/yamux"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/relay"
+)
+
+// TransportOptions tunes connection liveness and how many resources the
+// transport may hold. QUIC connections use libp2p's built-in 15s keepalive;
+// the yamux settings apply to TCP.
+type TransportOptions struct {
+	// KeepAliveInterval is how often yamux pings an idle connection
+	KeepAliveInterval time.Duration
+	// ConnectionWriteTimeout closes a connection whose writes stall this long
+	ConnectionWriteTimeout time.Duration
+	// ConnLowWater and ConnHighWater bound open connections: past the high
+	// mark the connection manager trims back to the low one
+	ConnLowWater, ConnHighWater int
+	// MaxStreamWindow caps the yamux receive window, the data a sender may
+	// have in flight on one stream; 0 keeps the yamux default of 16 MiB
+	MaxStreamWindow uint32
+	// RelayReservations and RelayCircuits bound the peers this node relays
+	// for and the relayed connections of each; 0 keeps the libp2p defaults
+	RelayReservations, RelayCircuits int
+}
+
+// DefaultTransportOptions detects dead links faster than the yamux defaults
+// (30s keepalive, 10s write timeout) so roaming clients reconnect quickly
+func DefaultTransportOptions() TransportOptions {
+	return TransportOptions{
+		KeepAliveInterval:      15 * time.Second,
+		ConnectionWriteTimeout: 10 * time.Second,
+		ConnLowWater:           50,
+		ConnHighWater:          100,
+	}
+}
+
+// LowResourceTransportOptions are the default options trimmed for small
+// always-on machines: fewer connections, smaller stream buffers and relaying
+// for only a few peers
+func LowResourceTransportOptions() TransportOptions {
+	opts := DefaultTransportOptions()
+	opts.ConnLowWater = 10
+	opts.ConnHighWater = 25
+	opts.MaxStreamWindow = 1 << 20
+	opts.RelayReservations = 8
+	opts.RelayCircuits = 4
+	return opts
+}
+
+// muxerOption builds a yamux transport from the options
+func (o TransportOptions) muxerOption() libp2p.Option {
+	defaults := DefaultTransportOptions()
+	tpt := *yamux.DefaultTransport
+	tpt.EnableKeepAlive = true
+	tpt.KeepAliveInterval = defaults.KeepAliveInterval
+	if o.KeepAliveInterval > 0 {
+		tpt.KeepAliveInterval = o.KeepAliveInterval
+	}
+	tpt.ConnectionWriteTimeout = defaults.ConnectionWriteTimeout
+	if o.ConnectionWriteTimeout > 0 {
+		tpt.ConnectionWriteTimeout = o.ConnectionWriteTimeout
+	}
+	if o.MaxStreamWindow > 0 {
+		tpt.MaxStreamWindowSize = o.MaxStreamWindow
+	}
+	return libp2p.Muxer(yamux.ID, &tpt)
+}
+
+// connLimits returns the connection manager watermarks, the defaults for unset ones
+func (o TransportOptions) connLimits() (low, high int) {
+	defaults := DefaultTransportOptions()
+	low, high = defaults.ConnLowWater, defaults.ConnHighWater
+	if o.ConnLowWater > 0 {
+		low = o.ConnLowWater
+	}
+	if o.ConnHighWater > low {
+		high = o.ConnHighWater
+	}
+	return low, high
+}
+
+// relayResources returns the relay service limits. Relayed connections carry
+// vault transfers between peers this node has admitted, so they are never cut
+// off after a duration or amount of data.
+func (o TransportOptions) relayResources() relay.Resources {
+	rc := relay.DefaultResources()
+	rc.Limit = nil
+	if o.RelayReservations > 0 {
+		rc.MaxReservations = o.RelayReservations
+	}
+	if o.RelayCircuits > 0 {
+		rc.MaxCircuits = o.RelayCircuits
+	}
+	return rc
+}
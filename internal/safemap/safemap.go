@@ -33,3 +33,28 @@ func (sm *SafeMap[K, V]) Clear() {
 	defer sm.mu.Unlock()
 	sm.m = make(map[K]V)
 }
+
+// Keys returns a snapshot of the keys in the map
+func (sm *SafeMap[K, V]) Keys() []K {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	keys := make([]K, 0, len(sm.m))
+	for k := range sm.m {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func (sm *SafeMap[K, V]) Delete(key K) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	delete(sm.m, key)
+}
+
+// Replace swaps in new contents in one step, so readers see either the old
+// or the new map and never an empty one in between
+func (sm *SafeMap[K, V]) Replace(m map[K]V) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.m = m
+}
@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/notassigned/endershare/internal/database"
+)
+
+// AdoptStats counts what AdoptBlobs did with the blobs it found
+type AdoptStats struct {
+	Adopted  int   // Verified and stored
+	Bytes    int64 // Size of the blobs adopted
+	Local    int   // Stored here already
+	Unknown  int   // Not used by any file
+	Rejected int   // Wrong size or hash, see the first error
+	FirstErr error // Why the first blob was rejected
+}
+
+// AdoptBlobs stores the encrypted blobs found in dir, as in the data
+// directory of another node of the vault, instead of downloading them again.
+// A blob is adopted when a file or version uses it, it isn't stored here yet
+// and its size and hash match the metadata; it is linked into the data
+// directory when the file system allows and copied otherwise. dir may be the
+// data directory itself, for blobs copied there by hand. Blobs the node's
+// selection leaves out are adopted too and evicted at its next check.
+// progress is called after every blob.
+func (s *Storage) AdoptBlobs(dir string, progress func(done, total int)) (AdoptStats, error) {
+	var stats AdoptStats
+	names, err := listBlobs(dir)
+	if err != nil {
+		return stats, err
+	}
+
+	// Archived files are known, but no node is meant to store their content
+	wanted := make(map[string]int64)
+	archived := make(map[string]bool)
+	err = s.withIndex(func(ix *metaIndex) {
+		for _, e := range ix.byKey {
+			if e.typ != TypeFile {
+				continue
+			}
+			if e.file.Archive != nil {
+				archived[string(e.data.Value)] = true
+			}
+			for _, v := range e.file.Versions {
+				wanted[hexEncode(v.BlobHash)] = v.BlobSize
+			}
+		}
+	})
+	if err != nil {
+		return stats, err
+	}
+	err = s.db.ForEachData(func(entry database.DataEntry) error {
+		if entry.Value != nil && !archived[string(entry.Value)] {
+			wanted[hexEncode(entry.Value)] = entry.Size
+		}
+		return nil
+	})
+	if err != nil {
+		return stats, err
+	}
+
+	for i, name := range names {
+		if size, ok := wanted[name]; !ok {
+			stats.Unknown++
+		} else if adopted, err := s.adoptBlob(dir, name, size); errors.Is(err, ErrBlobCorrupted) {
+			stats.Rejected++
+			if stats.FirstErr == nil {
+				stats.FirstErr = err
+			}
+		} else if err != nil {
+			return stats, err
+		} else if adopted {
+			stats.Adopted++
+			stats.Bytes += size
+		} else {
+			stats.Local++
+		}
+		if progress != nil {
+			progress(i+1, len(names))
+		}
+	}
+	if stats.Adopted > 0 {
+		if err := syncDir(s.dataDir); err != nil {
+			return stats, err
+		}
+	}
+	return stats, nil
+}
+
+// adoptBlob stores the blob name of size encrypted bytes from dir once it is
+// verified, failing with ErrBlobCorrupted if it doesn't match. It reports
+// false if the blob is stored here already.
+func (s *Storage) adoptBlob(dir, name string, size int64) (bool, error) {
+	blobHash, err := hex.DecodeString(name)
+	if err != nil {
+		return false, err
+	}
+	if s.blobLocal(blobHash, size) {
+		return false, nil
+	}
+
+	src := filepath.Join(dir, name)
+	info, err := os.Stat(src)
+	if err != nil {
+		return false, err
+	}
+	if info.Size() != size {
+		return false, fmt.Errorf("%w: %s has %d of %d bytes", ErrBlobCorrupted, name, info.Size(), size)
+	}
+	hash, err := hashBlobFile(src)
+	if err != nil {
+		return false, err
+	}
+	if !bytes.Equal(hash, blobHash) {
+		return false, fmt.Errorf("%w: %s does not match its hash", ErrBlobCorrupted, name)
+	}
+	dst := filepath.Join(s.dataDir, name)
+	if err := placeBlob(src, dst); err != nil {
+		return false, fmt.Errorf("blob %s: %w", name, err)
+	}
+	if err := verifyPlacedBlob(src, dst); err != nil {
+		return false, fmt.Errorf("blob %s: %w", name, err)
+	}
+	if err := s.db.SetDownloadProgress(blobHash, size); err != nil {
+		return false, err
+	}
+	s.db.ClearBlobCorrupt(blobHash)
+	return true, nil
+}
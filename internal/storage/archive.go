@@ -0,0 +1,177 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/notassigned/endershare/internal/database"
+)
+
+// ErrArchived is returned when reading a file whose content is archived
+// outside the vault
+var ErrArchived = errors.New("file is archived externally")
+
+// ArchiveInfo says where the content of a file archived outside the vault
+// lives. The archive holds the encrypted blob, named by its hash as in the
+// data directory.
+type ArchiveInfo struct {
+	Location   string    `json:"location"` // Set by the user, such as "USB disk Backup-2"
+	ArchivedAt time.Time `json:"archivedAt"`
+}
+
+// ArchiveFile copies a file's blob to dir, on a disk kept offline for
+// example, and marks the file as archived at location. The metadata and hash
+// stay in the vault, but no node keeps the content anymore, see
+// EvictArchived; RestoreArchived brings it back from the archive. The copy
+// is verified before the file is marked.
+func (s *Storage) ArchiveFile(name string, folderID FolderID, dir, location string) (removed, added *database.DataEntry, err error) {
+	entry, fileEntry, err := s.findFile(name, folderID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if fileEntry.Archive != nil {
+		return nil, nil, fmt.Errorf("%s is archived on %s already", name, fileEntry.Archive.Location)
+	}
+	if location = strings.TrimSpace(location); location == "" {
+		if location, err = filepath.Abs(dir); err != nil {
+			return nil, nil, err
+		}
+	}
+	if len(location) > maxNoteLen || !utf8.ValidString(location) {
+		return nil, nil, fmt.Errorf("%w: archive locations are limited to %d bytes of text", ErrInvalidName, maxNoteLen)
+	}
+	if err := s.hydrate(entry); err != nil {
+		return nil, nil, err
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, nil, err
+	}
+	src := filepath.Join(s.dataDir, hexEncode(entry.Value))
+	dst := filepath.Join(dir, hexEncode(entry.Value))
+	if err := placeBlob(src, dst); err != nil {
+		return nil, nil, err
+	}
+	if err := syncDir(dir); err != nil {
+		return nil, nil, err
+	}
+	if err := verifyPlacedBlob(src, dst); err != nil {
+		return nil, nil, err
+	}
+
+	fileEntry.Archive = &ArchiveInfo{Location: location, ArchivedAt: time.Now()}
+	return s.replaceEntry(*entry, fileEntry, folderID)
+}
+
+// RestoreArchived re-ingests an archived file from the archive in dir: its
+// blob is checked against the hash in the vault, stored again and the file
+// is no longer marked archived. The archive is left as it is.
+func (s *Storage) RestoreArchived(name string, folderID FolderID, dir string) (removed, added *database.DataEntry, err error) {
+	entry, fileEntry, err := s.findFile(name, folderID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if fileEntry.Archive == nil {
+		return nil, nil, fmt.Errorf("%s is not archived", name)
+	}
+
+	if !s.blobLocal(entry.Value, entry.Size) {
+		src := filepath.Join(dir, hexEncode(entry.Value))
+		info, err := os.Stat(src)
+		if err != nil {
+			return nil, nil, fmt.Errorf("archived copy of %s: %w", name, err)
+		}
+		if info.Size() != entry.Size {
+			return nil, nil, fmt.Errorf("%w: archived copy of %s has the wrong size", ErrBlobCorrupted, name)
+		}
+		hash, err := hashBlobFile(src)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !bytes.Equal(hash, entry.Value) {
+			return nil, nil, fmt.Errorf("%w: archived copy of %s does not match its hash", ErrBlobCorrupted, name)
+		}
+		dst := filepath.Join(s.dataDir, hexEncode(entry.Value))
+		if err := placeBlob(src, dst); err != nil {
+			return nil, nil, err
+		}
+		if err := verifyPlacedBlob(src, dst); err != nil {
+			return nil, nil, err
+		}
+		if err := s.db.SetDownloadProgress(entry.Value, entry.Size); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	fileEntry.Archive = nil
+	return s.replaceEntry(*entry, fileEntry, folderID)
+}
+
+// EvictArchived removes the local copies of the blobs that only archived
+// files use, and returns how many were removed and the bytes freed
+func (s *Storage) EvictArchived() (int, int64, error) {
+	archived := make(map[string]database.DataEntry)
+	used := make(map[string]bool)
+	err := s.withIndex(func(ix *metaIndex) {
+		for _, e := range ix.byKey {
+			if e.typ != TypeFile || e.data.Value == nil {
+				continue
+			}
+			if e.file.Archive != nil {
+				archived[string(e.data.Value)] = e.data
+			} else {
+				used[string(e.data.Value)] = true
+			}
+			for _, v := range e.file.Versions {
+				used[string(v.BlobHash)] = true
+			}
+		}
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var evicted int
+	var freed int64
+	for blob, entry := range archived {
+		if used[blob] {
+			continue
+		}
+		n, err := s.EvictBlob(entry.Value, entry.Size)
+		if err != nil {
+			return evicted, freed, err
+		}
+		if n > 0 {
+			evicted++
+			freed += n
+		}
+	}
+	return evicted, freed, nil
+}
+
+// ArchivedFile is a file archived outside the vault
+type ArchivedFile struct {
+	FolderID FolderID
+	Name     string
+	Size     int64
+	Archive  ArchiveInfo
+}
+
+// ListArchived returns every archived file, in no particular order
+func (s *Storage) ListArchived() ([]ArchivedFile, error) {
+	var files []ArchivedFile
+	err := s.withIndex(func(ix *metaIndex) {
+		for _, e := range ix.byKey {
+			if e.typ == TypeFile && e.file.Archive != nil && e.trashed == nil {
+				files = append(files, ArchivedFile{FolderID: e.parent, Name: e.name, Size: e.file.Size, Archive: *e.file.Archive})
+			}
+		}
+	})
+	return files, err
+}
@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// fileAttrs are the attributes of a local file kept in its entry so an
+// export recreates it faithfully
+type fileAttrs struct {
+	modTime time.Time
+	mode    os.FileMode // Permission bits only
+	symlink bool
+}
+
+// statAttrs reads the attributes of an open local file, nil if they can't be read
+func statAttrs(f *os.File) *fileAttrs {
+	info, err := f.Stat()
+	if err != nil {
+		return nil
+	}
+	return &fileAttrs{modTime: info.ModTime(), mode: info.Mode().Perm()}
+}
+
+// linkAttrs reads the attributes of a symbolic link itself. Links have no
+// permissions of their own, so only the modification time is kept.
+func linkAttrs(path string) *fileAttrs {
+	attrs := &fileAttrs{symlink: true}
+	if info, err := os.Lstat(path); err == nil {
+		attrs.modTime = info.ModTime()
+	}
+	return attrs
+}
+
+// apply records the attributes in a file entry. Without them an entry keeps
+// the time it was added and no mode.
+func (a *fileAttrs) apply(fileEntry *FileEntry) {
+	if a == nil {
+		return
+	}
+	if !a.modTime.IsZero() {
+		fileEntry.ModifiedAt = a.modTime
+	}
+	fileEntry.Mode = a.mode
+	fileEntry.Symlink = a.symlink
+}
+
+// restoreAttrs gives an exported file the mode and modification time of its
+// entry. Entries added from a reader have no mode and leave the default.
+// Links are left alone, both calls would change the file they point to.
+func restoreAttrs(path string, fileEntry *FileEntry) error {
+	if fileEntry.Symlink {
+		return nil
+	}
+	if fileEntry.Mode != 0 {
+		if err := os.Chmod(path, fileEntry.Mode); err != nil {
+			return err
+		}
+	}
+	if fileEntry.ModifiedAt.IsZero() {
+		return nil
+	}
+	return os.Chtimes(path, time.Time{}, fileEntry.ModifiedAt)
+}
+
+// maxLinkTarget bounds the content read back as the target of a link
+const maxLinkTarget = 4096
+
+// restoreLink creates a symbolic link at path to the target held by a
+// decrypted link entry, replacing a link or file already there
+func restoreLink(path string, target []byte) error {
+	if len(target) == 0 || len(target) > maxLinkTarget || bytes.IndexByte(target, 0) >= 0 {
+		return errors.New("entry does not hold a link target")
+	}
+	if info, err := os.Lstat(path); err == nil && !info.IsDir() {
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	} else if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return os.Symlink(string(target), path)
+}
@@ -0,0 +1,274 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/notassigned/endershare/internal/database"
+	"lukechampine.com/blake3"
+)
+
+// ErrNoColdStore is returned when offloading blobs without cold storage
+var ErrNoColdStore = errors.New("no cold storage is configured")
+
+// ColdStore keeps encrypted blobs outside the data directory, in an object
+// store such as an S3 bucket, to free the node's disk. Blobs are encrypted
+// with the vault key before they get there and named by their hash, so the
+// store never sees plaintext or file names. Metadata stays local.
+type ColdStore interface {
+	// Put stores size bytes of r as the object name
+	Put(ctx context.Context, name string, r io.ReaderAt, size int64) error
+	// Get opens the object name for reading
+	Get(ctx context.Context, name string) (io.ReadCloser, error)
+	// Stat returns the size of the object name
+	Stat(ctx context.Context, name string) (int64, error)
+	// Delete removes the object name, if there is one
+	Delete(ctx context.Context, name string) error
+}
+
+// openColdStore returns the cold storage configured in the database, nil if
+// there is none
+func openColdStore(db *database.EndershareDB) ColdStore {
+	raw := db.GetColdStorage()
+	if raw == "" {
+		return nil
+	}
+	raw = migrateColdStorageKey(db, raw)
+	accessKey, secretKey := ColdStorageKey(db)
+	cs, err := ParseS3URL(raw, accessKey, secretKey)
+	if err != nil {
+		fmt.Println("Warning: Cold storage is off:", err)
+		return nil
+	}
+	return cs
+}
+
+// ColdStorageKey returns the keys cold storage requests are signed with:
+// AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY if both are set, the ones
+// configured in db otherwise
+func ColdStorageKey(db *database.EndershareDB) (accessKey, secretKey string) {
+	if accessKey, secretKey := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"); accessKey != "" && secretKey != "" {
+		return accessKey, secretKey
+	}
+	return db.GetColdStorageKey()
+}
+
+// migrateColdStorageKey moves keys configured as part of the bucket URL, as
+// older versions did, to their own setting and returns the URL without them
+func migrateColdStorageKey(db *database.EndershareDB, raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.User == nil {
+		return raw
+	}
+	secretKey, _ := u.User.Password()
+	if err := db.SetColdStorageKey(u.User.Username(), secretKey); err != nil {
+		fmt.Println("Warning: Failed to move cold storage keys out of its URL:", err)
+		return raw
+	}
+	u.User = nil
+	if err := db.SetColdStorage(u.String()); err != nil {
+		fmt.Println("Warning: Failed to move cold storage keys out of its URL:", err)
+	}
+	return u.String()
+}
+
+// ColdStore returns the cold storage blobs are offloaded to, nil if none
+func (s *Storage) ColdStore() ColdStore {
+	return s.cold
+}
+
+// SetColdStore replaces the cold storage configured in the database, nil
+// turning it off. Blobs offloaded before stay recorded as in cold storage.
+func (s *Storage) SetColdStore(cs ColdStore) {
+	s.cold = cs
+}
+
+// OffloadBlob uploads a blob of size encrypted bytes to cold storage, unless
+// it is there already, then removes the local copy and returns the bytes
+// freed. Reading a file using the blob, or a peer requesting it, fetches it
+// back and keeps it locally until it is offloaded again.
+func (s *Storage) OffloadBlob(blobHash []byte, size int64) (int64, error) {
+	if s.cold == nil {
+		return 0, ErrNoColdStore
+	}
+	if !s.blobLocal(blobHash, size) {
+		return 0, nil
+	}
+	if _, ok := s.db.GetColdBlobSize(blobHash); !ok {
+		if err := s.uploadCold(blobHash, size); err != nil {
+			return 0, err
+		}
+	}
+	return s.EvictBlob(blobHash, size)
+}
+
+// uploadCold copies a local blob to cold storage. The blob is checked
+// against its hash first and the stored size after, as the copy in cold
+// storage becomes the only one on this node.
+func (s *Storage) uploadCold(blobHash []byte, size int64) error {
+	name := hexEncode(blobHash)
+	path := filepath.Join(s.dataDir, name)
+	hash, err := hashBlobFile(path)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(hash, blobHash) {
+		return fmt.Errorf("%w: %s, not offloading it", ErrBlobCorrupted, name)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	ctx := context.Background()
+	if err := s.cold.Put(ctx, name, f, size); err != nil {
+		return fmt.Errorf("cold storage: %w", err)
+	}
+	stored, err := s.cold.Stat(ctx, name)
+	if err != nil {
+		return fmt.Errorf("cold storage: %w", err)
+	}
+	if stored != size {
+		return fmt.Errorf("%w: cold storage holds %d of %d bytes of %s", ErrBlobCorrupted, stored, size, name)
+	}
+	return s.db.AddColdBlob(blobHash, size)
+}
+
+// fetchCold downloads a blob of size encrypted bytes from cold storage into
+// the data directory, checking it against its hash
+func (s *Storage) fetchCold(blobHash []byte, size int64) error {
+	name := hexEncode(blobHash)
+	r, err := s.cold.Get(context.Background(), name)
+	if err != nil {
+		return fmt.Errorf("cold storage: %w", err)
+	}
+	defer r.Close()
+
+	tmp, err := os.CreateTemp(s.tempDir, "cold-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	hasher := blake3.New(32, nil)
+	n, err := io.Copy(io.MultiWriter(tmp, hasher), r)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("cold storage: %w", err)
+	}
+	if n != size || !bytes.Equal(hasher.Sum(nil), blobHash) {
+		return fmt.Errorf("%w: copy of %s in cold storage", ErrBlobCorrupted, name)
+	}
+	if err := placeBlob(tmp.Name(), filepath.Join(s.dataDir, name)); err != nil {
+		return err
+	}
+	return s.db.SetDownloadProgress(blobHash, size)
+}
+
+// fetchColdBlob fetches a blob back from cold storage, false if it isn't there
+func (s *Storage) fetchColdBlob(blobHash []byte) (bool, error) {
+	if s.cold == nil {
+		return false, nil
+	}
+	size, ok := s.db.GetColdBlobSize(blobHash)
+	if !ok {
+		return false, nil
+	}
+	return true, s.fetchCold(blobHash, size)
+}
+
+// OffloadFile offloads the content of a file to cold storage, see
+// OffloadBlob. Pinned files are refused with ErrPinned.
+func (s *Storage) OffloadFile(name string, folderID FolderID) (int64, error) {
+	entry, _, err := s.findFile(name, folderID)
+	if err != nil {
+		return 0, err
+	}
+	if s.IsPinned(name, folderID) {
+		return 0, fmt.Errorf("%w, unpin it to offload it: %s", ErrPinned, name)
+	}
+	return s.OffloadBlob(entry.Value, entry.Size)
+}
+
+// OffloadFolder offloads the content of every file below a folder, the whole
+// vault for the root, to cold storage and returns how many blobs were
+// offloaded and the bytes freed. Pinned files are left alone.
+func (s *Storage) OffloadFolder(folderID FolderID) (int, int64, error) {
+	var blobs []database.DataEntry
+	err := s.withIndex(func(ix *metaIndex) {
+		pins := LoadPins(s.db)
+		for _, e := range ix.byKey {
+			if e.typ != TypeFile || e.data.Value == nil || ix.pinnedLocked(e, pins) {
+				continue
+			}
+			if folderID.IsRoot() || ix.withinLocked(e.parent, []FolderID{folderID}) {
+				blobs = append(blobs, e.data)
+			}
+		}
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var offloaded int
+	var freed int64
+	for _, entry := range blobs {
+		n, err := s.OffloadBlob(entry.Value, entry.Size)
+		if err != nil {
+			return offloaded, freed, err
+		}
+		if n > 0 {
+			offloaded++
+			freed += n
+		}
+	}
+	return offloaded, freed, nil
+}
+
+// PruneCold deletes the blobs in cold storage that no file or version uses
+// anymore and returns how many were deleted and their size
+func (s *Storage) PruneCold() (int, int64, error) {
+	if s.cold == nil {
+		return 0, 0, ErrNoColdStore
+	}
+	used := make(map[string]bool)
+	err := s.withIndex(func(ix *metaIndex) {
+		for _, e := range ix.byKey {
+			if e.typ != TypeFile {
+				continue
+			}
+			used[string(e.data.Value)] = true
+			for _, v := range e.file.Versions {
+				used[string(v.BlobHash)] = true
+			}
+		}
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var pruned int
+	var size int64
+	for _, b := range s.db.GetColdBlobs() {
+		if used[string(b.BlobHash)] || s.db.BlobReferenced(b.BlobHash) {
+			continue
+		}
+		if err := s.cold.Delete(context.Background(), hexEncode(b.BlobHash)); err != nil {
+			return pruned, size, fmt.Errorf("cold storage: %w", err)
+		}
+		if err := s.db.RemoveColdBlob(b.BlobHash); err != nil {
+			return pruned, size, err
+		}
+		pruned++
+		size += b.Size
+	}
+	return pruned, size, nil
+}
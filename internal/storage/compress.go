@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/notassigned/endershare/internal/crypto"
+)
+
+// CodecZstd marks file content compressed with zstd before encryption. An
+// empty codec is content stored as is.
+const CodecZstd = "zstd"
+
+// ErrNotSeekable is returned for ranged reads of compressed files, whose
+// plaintext offsets don't map to blob chunks
+var ErrNotSeekable = errors.New("compressed files can't be read by range")
+
+// incompressibleExts are formats that are compressed already, where zstd
+// would only cost time
+var incompressibleExts = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true, ".heic": true, ".avif": true,
+	".mp3": true, ".m4a": true, ".aac": true, ".ogg": true, ".opus": true, ".flac": true,
+	".mp4": true, ".m4v": true, ".mov": true, ".mkv": true, ".webm": true, ".avi": true,
+	".zip": true, ".gz": true, ".tgz": true, ".bz2": true, ".xz": true, ".zst": true, ".7z": true, ".rar": true,
+	".docx": true, ".xlsx": true, ".pptx": true, ".odt": true, ".epub": true, ".jar": true, ".apk": true,
+}
+
+// fileCodec picks the codec for a new file: zstd if the node compresses
+// files and the name is not a compressed format, none otherwise
+func (s *Storage) fileCodec(name string, photo *PhotoInfo) string {
+	if photo != nil || !s.db.GetCompressFiles() || incompressibleExts[strings.ToLower(filepath.Ext(name))] {
+		return ""
+	}
+	return CodecZstd
+}
+
+// compressReader returns a reader of src encoded with codec. Closing it stops
+// the encoder if the reader was not drained.
+func compressReader(src io.Reader, codec string) (io.ReadCloser, error) {
+	switch codec {
+	case "":
+		return io.NopCloser(src), nil
+	case CodecZstd:
+		pr, pw := io.Pipe()
+		go func() {
+			enc, err := zstd.NewWriter(pw, zstd.WithEncoderConcurrency(1))
+			if err == nil {
+				_, err = io.Copy(enc, src)
+				if closeErr := enc.Close(); err == nil {
+					err = closeErr
+				}
+			}
+			pw.CloseWithError(err)
+		}()
+		return pr, nil
+	default:
+		return nil, fmt.Errorf("unknown codec %q", codec)
+	}
+}
+
+// decryptBlob decrypts the blob at path into w, undoing the codec the
+// content was stored with
+func decryptBlob(w io.Writer, path string, key []byte, codec string) error {
+	srcFile, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+
+	switch codec {
+	case "":
+		return crypto.DecryptStream(w, srcFile, key)
+	case CodecZstd:
+		pr, pw := io.Pipe()
+		go func() {
+			pw.CloseWithError(crypto.DecryptStream(pw, srcFile, key))
+		}()
+		defer pr.Close()
+
+		dec, err := zstd.NewReader(pr, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return err
+		}
+		defer dec.Close()
+		_, err = io.Copy(w, dec)
+		return err
+	default:
+		return fmt.Errorf("unknown codec %q", codec)
+	}
+}
+
+// blobSeeker is a ranged reader of a blob that closes the blob file
+type blobSeeker struct {
+	*crypto.BlobReader
+	f *os.File
+}
+
+func (b *blobSeeker) Close() error {
+	return b.f.Close()
+}
+
+// openBlobSeeker opens the blob at path for ranged reads of its plaintext
+func openBlobSeeker(path string, key []byte, codec string) (io.ReadSeekCloser, error) {
+	if codec != "" {
+		return nil, ErrNotSeekable
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	r, err := crypto.NewBlobReader(f, stat.Size(), key)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &blobSeeker{BlobReader: r, f: f}, nil
+}
@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// readBack returns the content of a file read in full and streamed
+func readBack(t *testing.T, s *Storage, name string) (whole, streamed []byte) {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := s.WriteFileTo(name, RootFolderID, &buf); err != nil {
+		t.Fatal(err)
+	}
+	r, err := s.OpenFileReader(name, RootFolderID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	streamed, err = io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes(), streamed
+}
+
+func TestCompression(t *testing.T) {
+	s := newTestStorage(t, make([]byte, 32), false)
+	text := []byte(strings.Repeat("a line of text that compresses well\n", 20000))
+	random := make([]byte, 200000)
+	rand.Read(random)
+
+	// Written before compression was turned on
+	if _, _, err := s.AddFileFromReader(bytes.NewReader(text), "before.txt", RootFolderID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.db.SetCompressFiles(true); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		content []byte
+		codec   string
+	}{
+		{"before.txt", text, ""},
+		{"notes.txt", text, CodecZstd},
+		{"archive.zip", random, ""}, // Compressed already, so stored as is
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.name != "before.txt" {
+				if _, _, err := s.AddFileFromReader(bytes.NewReader(tc.content), tc.name, RootFolderID); err != nil {
+					t.Fatal(err)
+				}
+			}
+			entry, file, err := s.findFile(tc.name, RootFolderID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if file.Codec != tc.codec || file.Size != int64(len(tc.content)) {
+				t.Errorf("stored with codec %q and size %d, want %q and %d", file.Codec, file.Size, tc.codec, len(tc.content))
+			}
+			blob, err := os.Stat(filepath.Join(s.dataDir, hexEncode(entry.Value)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if compressed := blob.Size() < int64(len(tc.content)); compressed != (tc.codec != "") {
+				t.Errorf("blob of %d bytes for %d bytes of content with codec %q", blob.Size(), len(tc.content), tc.codec)
+			}
+
+			whole, streamed := readBack(t, s, tc.name)
+			if !bytes.Equal(whole, tc.content) || !bytes.Equal(streamed, tc.content) {
+				t.Errorf("read back %d and %d bytes, want the %d stored", len(whole), len(streamed), len(tc.content))
+			}
+
+			// Only content stored as is can be read by range
+			seeker, err := s.OpenFileSeeker(tc.name, RootFolderID)
+			if tc.codec != "" {
+				if !errors.Is(err, ErrNotSeekable) {
+					t.Errorf("ranged read of a compressed file = %v, want %v", err, ErrNotSeekable)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer seeker.Close()
+			seeker.Seek(-100, io.SeekEnd)
+			if tail, err := io.ReadAll(seeker); err != nil || !bytes.Equal(tail, tc.content[len(tc.content)-100:]) {
+				t.Errorf("ranged read of the last 100 bytes = %d bytes, %v", len(tail), err)
+			}
+		})
+	}
+}
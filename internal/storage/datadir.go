@@ -0,0 +1,148 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/notassigned/endershare/internal/database"
+)
+
+// DefaultDataDir is where blobs are kept unless another data directory is configured
+const DefaultDataDir = "./data"
+
+// blobNameLen is the length of a blob's file name, its hex encoded hash
+const blobNameLen = 64
+
+// DataDir returns the configured blob directory, or DefaultDataDir
+func DataDir(db *database.EndershareDB) string {
+	if dir := db.GetDataDir(); dir != "" {
+		return dir
+	}
+	return DefaultDataDir
+}
+
+// MoveDataDir makes dir the data directory, "" for the default, after placing
+// every blob of the current one in it. Blobs are hard linked where the
+// filesystem allows and copied otherwise. The setting only changes once all
+// blobs are in place and the old ones are removed after that, so an
+// interrupted move leaves the vault readable from the old directory and can
+// be run again. No node may have the vault open meanwhile. progress is
+// called after every blob; the number of blobs moved is returned.
+func MoveDataDir(db *database.EndershareDB, dir string, progress func(done, total int)) (int, error) {
+	oldDir := DataDir(db)
+	newDir := dir
+	if newDir == "" {
+		newDir = DefaultDataDir
+	}
+	if err := checkDataDir(oldDir, newDir); err != nil {
+		return 0, err
+	}
+
+	blobs, err := listBlobs(oldDir)
+	if err != nil {
+		return 0, err
+	}
+	for i, name := range blobs {
+		if err := placeBlob(filepath.Join(oldDir, name), filepath.Join(newDir, name)); err != nil {
+			return i, fmt.Errorf("blob %s: %w", name, err)
+		}
+		if progress != nil {
+			progress(i+1, len(blobs))
+		}
+	}
+	if err := syncDir(newDir); err != nil {
+		return 0, err
+	}
+	if err := db.SetDataDir(dir); err != nil {
+		return 0, err
+	}
+
+	// Every blob is reachable through the new directory now
+	for _, name := range blobs {
+		if err := os.Remove(filepath.Join(oldDir, name)); err != nil && !os.IsNotExist(err) {
+			fmt.Println("Warning: Failed to remove old blob:", err)
+		}
+	}
+	// Only succeed if nothing else was kept there
+	os.Remove(filepath.Join(oldDir, "tmp"))
+	os.Remove(oldDir)
+	return len(blobs), nil
+}
+
+// checkDataDir makes sure newDir can take over from oldDir, creating it if needed
+func checkDataDir(oldDir, newDir string) error {
+	oldAbs, err := filepath.Abs(oldDir)
+	if err != nil {
+		return err
+	}
+	newAbs, err := filepath.Abs(newDir)
+	if err != nil {
+		return err
+	}
+	if oldAbs == newAbs {
+		return fmt.Errorf("%s is already the data directory", newDir)
+	}
+	if err := os.MkdirAll(newAbs, 0755); err != nil {
+		return fmt.Errorf("cannot use data directory: %w", err)
+	}
+	probe, err := os.CreateTemp(newAbs, moveTempPattern)
+	if err != nil {
+		return fmt.Errorf("data directory is not writable: %w", err)
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+	return nil
+}
+
+// listBlobs returns the names of the blobs in dir, complete or still being
+// downloaded. A missing dir has none.
+func listBlobs(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var blobs []string
+	for _, e := range entries {
+		if e.Type().IsRegular() && isBlobName(e.Name()) {
+			blobs = append(blobs, e.Name())
+		}
+	}
+	return blobs, nil
+}
+
+func isBlobName(name string) bool {
+	if len(name) != blobNameLen {
+		return false
+	}
+	for _, c := range name {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// placeBlob makes a blob available at dst as well as src. A copy an earlier
+// move left at dst is kept if it is complete.
+func placeBlob(src, dst string) error {
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if dstInfo, err := os.Stat(dst); err == nil {
+		if os.SameFile(srcInfo, dstInfo) || dstInfo.Size() == srcInfo.Size() {
+			return nil
+		}
+		if err := os.Remove(dst); err != nil {
+			return err
+		}
+	}
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+	return copyIntoPlace(src, dst)
+}
@@ -0,0 +1,211 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"time"
+
+	"github.com/notassigned/endershare/internal/crypto"
+	"github.com/notassigned/endershare/internal/database"
+	"lukechampine.com/blake3"
+)
+
+// Duplicate is a stored file with the same content as a file being added
+type Duplicate struct {
+	Name     string
+	FolderID FolderID
+	BlobHash []byte
+	Refs     int // Entries referencing the blob
+}
+
+// ErrContentMismatch is returned when a file decrypts to other content than
+// the content hash recorded when it was added
+var ErrContentMismatch = errors.New("content does not match its recorded hash")
+
+// newContentHash returns a hash of plaintext keyed with the vault key, which
+// identifies content across imports without revealing it
+func (s *Storage) newContentHash() hash.Hash {
+	return blake3.New(32, crypto.DeriveContentHashKey(s.aesKey))
+}
+
+// decryptContent decrypts the blob of a file entry at path into w like
+// decryptBlob and, if the entry has a content hash, checks the plaintext
+// against it once all of it is written
+func (s *Storage) decryptContent(w io.Writer, path string, key []byte, fileEntry *FileEntry) error {
+	if len(fileEntry.ContentHash) == 0 {
+		return decryptBlob(w, path, key, fileEntry.Codec)
+	}
+	h := s.newContentHash()
+	if err := decryptBlob(io.MultiWriter(w, h), path, key, fileEntry.Codec); err != nil {
+		return err
+	}
+	if !bytes.Equal(h.Sum(nil), fileEntry.ContentHash) {
+		return fmt.Errorf("%w: %s", ErrContentMismatch, fileEntry.Name)
+	}
+	return nil
+}
+
+// FindDuplicate reads r and returns the stored file with the same content,
+// or nil if there is none
+func (s *Storage) FindDuplicate(r io.Reader) (*Duplicate, error) {
+	h := s.newContentHash()
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, err
+	}
+	src, ok := s.storedContent(h.Sum(nil))
+	if !ok {
+		return nil, nil
+	}
+	return &Duplicate{
+		Name:     src.name,
+		FolderID: src.parent,
+		BlobHash: src.data.Value,
+		Refs:     s.db.GetBlobRefs(src.data.Value),
+	}, nil
+}
+
+// FindDuplicateFile returns the stored file with the same content as a local
+// file, see FindDuplicate
+func (s *Storage) FindDuplicateFile(localPath string) (*Duplicate, error) {
+	f, err := os.Open(longPath(localPath))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return s.FindDuplicate(f)
+}
+
+// storedContent returns an entry whose blob holds the content with
+// contentHash, if the blob is complete on this node and readable with the
+// vault key. Content added here is looked up in the content hash table,
+// content added on other nodes by the hash in its metadata.
+func (s *Storage) storedContent(contentHash []byte) (indexEntry, bool) {
+	blobHash, err := s.db.GetBlobByContent(contentHash)
+	if err != nil {
+		return indexEntry{}, false
+	}
+	if blobHash == nil {
+		if blobHash = s.blobByContentHash(contentHash); blobHash == nil {
+			return indexEntry{}, false
+		}
+	}
+	src, ok := s.entryForBlob(blobHash)
+	if !ok || !s.FileExists(blobHash) || s.db.GetDownloadProgress(blobHash) < src.data.Size {
+		return indexEntry{}, false
+	}
+	return src, true
+}
+
+// blobByContentHash returns the blob of a stored file whose metadata records
+// contentHash, nil if there is none
+func (s *Storage) blobByContentHash(contentHash []byte) []byte {
+	var blobHash []byte
+	s.withIndex(func(ix *metaIndex) {
+		for _, e := range ix.byKey {
+			if e.typ == TypeFile && e.data.Value != nil && bytes.Equal(e.file.ContentHash, contentHash) &&
+				s.blobLocal(e.data.Value, e.data.Size) {
+				blobHash = e.data.Value
+				return
+			}
+		}
+	})
+	return blobHash
+}
+
+// entryForBlob returns a file entry referencing blobHash that does not need
+// a drop key to read
+func (s *Storage) entryForBlob(blobHash []byte) (indexEntry, bool) {
+	var found indexEntry
+	var ok bool
+	err := s.withIndex(func(ix *metaIndex) {
+		for _, e := range ix.byKey {
+			if e.typ == TypeFile && len(e.file.SealedKey) == 0 && bytes.Equal(e.data.Value, blobHash) {
+				found, ok = *e, true
+				return
+			}
+		}
+	})
+	return found, ok && err == nil
+}
+
+// ImportReference adds a file that references the stored blob of dup instead
+// of storing its content again, applying the import rules like
+// ImportFromReader. The blob's reference count goes up by one.
+func (s *Storage) ImportReference(dup *Duplicate, name string, folderID FolderID) (replaced *database.DataEntry, added []*database.DataEntry, err error) {
+	src, ok := s.entryForBlob(dup.BlobHash)
+	if !ok {
+		return nil, nil, fmt.Errorf("stored copy of %s %w", dup.Name, ErrNotFound)
+	}
+	if s.IsDropBox(folderID) {
+		return nil, nil, fmt.Errorf("drop boxes only take files sealed to their own key")
+	}
+
+	if photo := src.file.Photo; photo != nil && s.db.GetSortPhotos() {
+		dateFolder, created, err := s.dateFolder(folderID, photo.CapturedAt)
+		added = append(added, created...)
+		if err != nil {
+			return nil, added, err
+		}
+		folderID = dateFolder
+	}
+
+	replaced, entry, err := s.addReference(src, name, folderID, nil)
+	if entry != nil {
+		added = append(added, entry)
+	}
+	return replaced, added, err
+}
+
+// addReference commits a new file entry for the blob of src. A file with the
+// same name in the folder becomes a version of the new entry, or with
+// rename-duplicates on the new entry gets a numbered name, as in addFile.
+func (s *Storage) addReference(src indexEntry, name string, folderID FolderID, attrs *fileAttrs) (replaced, added *database.DataEntry, err error) {
+	if err := LoadPolicy(s.db).CheckName(name); err != nil {
+		return nil, nil, err
+	}
+	existing, existingFile, err := s.findFile(name, folderID)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, nil, err
+	}
+	if existing != nil && s.db.GetRenameDuplicates() {
+		if name, err = s.freeName(TypeFile, name, folderID); err != nil {
+			return nil, nil, err
+		}
+		existing, existingFile = nil, nil
+	}
+
+	now := time.Now()
+	fileEntry := FileEntry{
+		Type:        TypeFile,
+		Name:        name,
+		CreatedAt:   now,
+		ModifiedAt:  now,
+		Size:        src.file.Size,
+		FolderID:    folderID,
+		ContentKey:  src.file.ContentKey,
+		Codec:       src.file.Codec,
+		ContentHash: src.file.ContentHash,
+		Photo:       src.file.Photo,
+	}
+	attrs.apply(&fileEntry)
+	if existing != nil {
+		fileEntry.CreatedAt = existingFile.CreatedAt
+		fileEntry.Tags = existingFile.Tags
+		fileEntry.Note = existingFile.Note
+		fileEntry.Lock = existingFile.Lock
+		fileEntry.Versions = pushVersion(existingFile.Versions, *existing, existingFile)
+	}
+
+	added, err = s.putFileEntry(fileEntry, src.data.Value, src.data.Size, src.data.KeyEpoch)
+	if err != nil || existing == nil {
+		return nil, added, err
+	}
+	if err := s.db.DeleteData(existing.Key); err != nil {
+		return nil, added, err
+	}
+	return existing, added, nil
+}
@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// Files with the same content share one blob while any of them is left, and
+// the blob is no longer offered for new files once the last one is deleted
+func TestDedupeBlobRefs(t *testing.T) {
+	s := newTestStorage(t, make([]byte, 32), false)
+	if err := s.db.SetDedupeFiles(true); err != nil {
+		t.Fatal(err)
+	}
+	add := func(name string) []byte {
+		t.Helper()
+		_, entry, err := s.AddFileFromReader(strings.NewReader("shared content"), name, RootFolderID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return entry.Value
+	}
+	blob := add("one.txt")
+	if other := add("two.txt"); !bytes.Equal(other, blob) {
+		t.Fatal("file with the same content got a blob of its own")
+	}
+	if refs := s.db.GetBlobRefs(blob); refs != 2 {
+		t.Errorf("blob has %d refs, want 2", refs)
+	}
+	_, file, err := s.findFile("one.txt", RootFolderID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Storing a row again, as sync does, replaces it without counting it twice
+	entry, _, err := s.findFile("two.txt", RootFolderID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.db.PutData(entry.Key, entry.Value, entry.Size, entry.Hash, entry.KeyEpoch); err != nil {
+		t.Fatal(err)
+	}
+	if refs := s.db.GetBlobRefs(blob); refs != 2 {
+		t.Errorf("blob has %d refs after its row was stored again, want 2", refs)
+	}
+
+	if err := s.DeleteFile("one.txt", RootFolderID); err != nil {
+		t.Fatal(err)
+	}
+	if refs := s.db.GetBlobRefs(blob); refs != 1 {
+		t.Errorf("blob has %d refs after one file was deleted, want 1", refs)
+	}
+	if found, err := s.db.GetBlobByContent(file.ContentHash); err != nil || !bytes.Equal(found, blob) {
+		t.Errorf("content lookup = %x, %v; want the blob still referenced", found, err)
+	}
+	var buf bytes.Buffer
+	if err := s.WriteFileTo("two.txt", RootFolderID, &buf); err != nil || buf.String() != "shared content" {
+		t.Errorf("remaining file reads %q, %v", buf.String(), err)
+	}
+
+	if err := s.DeleteFile("two.txt", RootFolderID); err != nil {
+		t.Fatal(err)
+	}
+	if refs := s.db.GetBlobRefs(blob); refs != 0 {
+		t.Errorf("blob has %d refs after both files were deleted, want 0", refs)
+	}
+	if found, err := s.db.GetBlobByContent(file.ContentHash); err != nil || found != nil {
+		t.Errorf("content lookup = %x, %v; want nothing for an unreferenced blob", found, err)
+	}
+	if again := add("three.txt"); bytes.Equal(again, blob) {
+		t.Error("new file reused a blob no entry references")
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !(linux || darwin || freebsd || windows)
+
+package storage
+
+import "errors"
+
+// DiskSpace is not available on this platform
+func DiskSpace(dir string) (free, total uint64, err error) {
+	return 0, 0, errors.ErrUnsupported
+}
@@ -0,0 +1,16 @@
+package storage
+
+import "golang.org/x/sys/windows"
+
+// DiskSpace returns the bytes available to this process and the size of the
+// volume holding dir
+func DiskSpace(dir string) (free, total uint64, err error) {
+	path, err := windows.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := windows.GetDiskFreeSpaceEx(path, &free, &total, nil); err != nil {
+		return 0, 0, err
+	}
+	return free, total, nil
+}
@@ -0,0 +1,327 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/notassigned/endershare/internal/crypto"
+	"github.com/notassigned/endershare/internal/database"
+	"lukechampine.com/blake3"
+)
+
+// ErrNotDropper is returned when a peer drops into a folder it isn't designated for
+var ErrNotDropper = errors.New("peer is not allowed to drop files here")
+
+// CreateDropBox creates an upload-only folder and returns the data entry
+// info for publishing. Only the master can create one: the folder's drop
+// keypair is derived from the master key and only its public half is stored
+// in the folder entry, see dropPrivateKey.
+func (s *Storage) CreateDropBox(name string, parentFolderID FolderID) (FolderID, *database.DataEntry, error) {
+	folderID := NewFolderID()
+	_, publicKey, err := s.deriveDropKey(folderID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	folderEntry := FolderEntry{
+		Type:           TypeFolder,
+		FolderID:       folderID,
+		Name:           name,
+		ParentFolderID: parentFolderID,
+		DropBox:        true,
+		DropPublicKey:  publicKey,
+	}
+	entry, err := s.createFolder(folderEntry)
+	if err != nil {
+		return "", nil, err
+	}
+	return folderEntry.FolderID, entry, nil
+}
+
+// ListDropBoxes returns every drop box folder in the vault
+func (s *Storage) ListDropBoxes() ([]FolderEntry, error) {
+	index, err := s.loadIndex()
+	if err != nil {
+		return nil, err
+	}
+	var boxes []FolderEntry
+	for _, e := range index {
+		if e.typ == TypeFolder && e.folder.DropBox {
+			boxes = append(boxes, e.folder)
+		}
+	}
+	return boxes, nil
+}
+
+// IsDropBox reports whether folderID is a drop box folder
+func (s *Storage) IsDropBox(folderID FolderID) bool {
+	if folderID.IsRoot() {
+		return false
+	}
+	folder, err := s.GetFolder(folderID)
+	return err == nil && folder.DropBox
+}
+
+// DropBoxKey returns the public drop key of a drop box if peerID is one of
+// its designated droppers
+func (s *Storage) DropBoxKey(folderID FolderID, peerID string) ([]byte, error) {
+	folder, err := s.getDropBox(folderID)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(folder.Droppers, peerID) {
+		return nil, fmt.Errorf("%w: %s", ErrNotDropper, folder.Name)
+	}
+	return folder.DropPublicKey, nil
+}
+
+// SetDroppers replaces the peers allowed to drop files into a drop box. The
+// folder's encrypted key changes, so the old entry is returned for a DELETE
+// update and the new one for an ADD update.
+func (s *Storage) SetDroppers(folderID FolderID, droppers []string) (removed, added *database.DataEntry, err error) {
+	e, ok, err := s.lookupFolder(folderID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !ok {
+		return nil, nil, fmt.Errorf("folder %w: %s", ErrNotFound, folderID)
+	}
+	folder := e.folder
+	if !folder.DropBox {
+		return nil, nil, fmt.Errorf("folder %s is not a drop box", folder.Name)
+	}
+	folder.Droppers = droppers
+
+	keyJSON, err := json.Marshal(folder)
+	if err != nil {
+		return nil, nil, err
+	}
+	encryptedKey, err := crypto.Encrypt(keyJSON, s.aesKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	old := e.data
+	newHash := crypto.ComputeDataHash(encryptedKey, nil, 0)
+	folderTag := computeFolderTag(folder.ParentFolderID, s.aesKey)
+
+	// Insert before deleting so a crash leaves a duplicate rather than nothing
+	if err := s.db.PutDataWithTag(encryptedKey, nil, 0, newHash, old.KeyEpoch, folderTag); err != nil {
+		return nil, nil, err
+	}
+	if err := s.db.DeleteData(old.Key); err != nil {
+		return nil, nil, err
+	}
+
+	return &old, &database.DataEntry{
+		Key:      encryptedKey,
+		Size:     0,
+		Hash:     newHash,
+		KeyEpoch: old.KeyEpoch,
+	}, nil
+}
+
+// AddSealedFile stores a blob a dropper encrypted with its own content key
+// and sealed to the drop box key. The blob is checked to decrypt to exactly
+// size bytes before it is committed. Droppers can't see what the drop box
+// holds, so a name already taken gets a numbered one whatever the
+// rename-duplicates setting.
+func (s *Storage) AddSealedFile(r io.Reader, sealedKey []byte, name string, size int64, folderID FolderID) (*database.DataEntry, error) {
+	folder, err := s.getDropBox(folderID)
+	if err != nil {
+		return nil, err
+	}
+	policy := LoadPolicy(s.db)
+	_, vaultSize := s.db.GetStorageStats()
+	if err := policy.Check(name, size, vaultSize); err != nil {
+		return nil, err
+	}
+	privateKey, err := s.dropPrivateKey(folder)
+	if err != nil {
+		return nil, err
+	}
+	key, err := crypto.OpenSealedKey(sealedKey, privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sealed key: %w", err)
+	}
+
+	tempFile, fileHash, err := receiveBlob(r, s.tempDir)
+	if err != nil {
+		return nil, err
+	}
+	plainSize, err := decryptedSize(tempFile, key)
+	if err != nil {
+		os.Remove(tempFile)
+		return nil, fmt.Errorf("dropped file does not decrypt: %w", err)
+	}
+	if plainSize != size {
+		os.Remove(tempFile)
+		return nil, fmt.Errorf("dropped file size mismatch: expected %d bytes, got %d", size, plainSize)
+	}
+
+	if _, taken, err := s.lookupName(TypeFile, name, folderID); err != nil {
+		os.Remove(tempFile)
+		return nil, err
+	} else if taken {
+		if name, err = s.freeName(TypeFile, name, folderID); err != nil {
+			os.Remove(tempFile)
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	return s.commitFile(tempFile, fileHash, s.db.GetKeyEpoch(), FileEntry{
+		Type:       TypeFile,
+		Name:       name,
+		CreatedAt:  now,
+		ModifiedAt: now,
+		Size:       size,
+		FolderID:   folderID,
+		SealedKey:  sealedKey,
+		SealedTo:   folderID,
+	})
+}
+
+// newBlobKey picks the key a new file in folderID is encrypted with. Files in
+// a drop box get their own key sealed to the folder's drop key.
+func (s *Storage) newBlobKey(folderID FolderID) (key, sealedKey []byte, sealedTo FolderID, err error) {
+	if folderID.IsRoot() {
+		return s.aesKey, nil, "", nil
+	}
+	folder, err := s.GetFolder(folderID)
+	if errors.Is(err, ErrNotFound) {
+		return s.aesKey, nil, "", nil
+	}
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if !folder.DropBox {
+		return s.aesKey, nil, "", nil
+	}
+
+	key, err = crypto.NewContentKey()
+	if err != nil {
+		return nil, nil, "", err
+	}
+	sealedKey, err = crypto.SealKey(key, folder.DropPublicKey)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return key, sealedKey, folderID, nil
+}
+
+// blobKey returns the key that decrypts a file's blob
+func (s *Storage) blobKey(fileEntry *FileEntry) ([]byte, error) {
+	if len(fileEntry.ContentKey) > 0 {
+		return fileEntry.ContentKey, nil
+	}
+	if len(fileEntry.SealedKey) == 0 {
+		return s.aesKey, nil
+	}
+	key, err := s.openSealedKey(fileEntry.SealedKey, fileEntry.SealedTo)
+	if err != nil {
+		return nil, fmt.Errorf("drop key for %s unavailable: %w", fileEntry.Name, err)
+	}
+	return key, nil
+}
+
+// openSealedKey recovers a content key sealed to a drop box
+func (s *Storage) openSealedKey(sealedKey []byte, sealedTo FolderID) ([]byte, error) {
+	folder, err := s.getDropBox(sealedTo)
+	if err != nil {
+		return nil, err
+	}
+	privateKey, err := s.dropPrivateKey(folder)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.OpenSealedKey(sealedKey, privateKey)
+}
+
+// dropPrivateKey returns the key that opens content keys sealed to a drop
+// box. It is derived from the master key, so other vault members can store
+// the files of a drop box but not read them.
+func (s *Storage) dropPrivateKey(folder *FolderEntry) ([]byte, error) {
+	privateKey, publicKey, err := s.deriveDropKey(folder.FolderID)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(publicKey, folder.DropPublicKey) {
+		return nil, fmt.Errorf("drop box %s was not created with this master key", folder.Name)
+	}
+	return privateKey, nil
+}
+
+// deriveDropKey derives the drop keypair of folderID, see crypto.DeriveSealingKeyPair
+func (s *Storage) deriveDropKey(folderID FolderID) (privateKey, publicKey []byte, err error) {
+	keys := s.db.GetKeys()
+	if keys == nil || len(keys.MasterPrivateKey) == 0 {
+		return nil, nil, fmt.Errorf("only the master holds drop box keys")
+	}
+	return crypto.DeriveSealingKeyPair(keys.MasterPrivateKey, string(folderID))
+}
+
+func (s *Storage) getDropBox(folderID FolderID) (*FolderEntry, error) {
+	if folderID.IsRoot() {
+		return nil, fmt.Errorf("the root folder is not a drop box")
+	}
+	folder, err := s.GetFolder(folderID)
+	if err != nil {
+		return nil, err
+	}
+	if !folder.DropBox {
+		return nil, fmt.Errorf("folder %s is not a drop box", folder.Name)
+	}
+	return folder, nil
+}
+
+// receiveBlob copies an already encrypted blob into a temp file and returns
+// its path and hash
+func receiveBlob(r io.Reader, tempDir string) (string, []byte, error) {
+	destFile, err := os.CreateTemp(tempDir, encryptTempPattern)
+	if err != nil {
+		return "", nil, err
+	}
+	defer destFile.Close()
+
+	hasher := blake3.New(32, nil)
+	if _, err := io.Copy(io.MultiWriter(destFile, hasher), r); err != nil {
+		os.Remove(destFile.Name())
+		return "", nil, err
+	}
+	if err := destFile.Sync(); err != nil {
+		os.Remove(destFile.Name())
+		return "", nil, err
+	}
+	return destFile.Name(), hasher.Sum(nil), nil
+}
+
+// decryptedSize decrypts a blob without keeping the plaintext and returns its length
+func decryptedSize(path string, key []byte) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	counter := &countingWriter{}
+	if err := crypto.DecryptStream(counter, f, key); err != nil {
+		return 0, err
+	}
+	return counter.n, nil
+}
+
+// countingWriter discards writes and counts their bytes
+type countingWriter struct {
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/notassigned/endershare/internal/crypto"
+	"github.com/notassigned/endershare/internal/database"
+)
+
+// newTestStorage returns storage over an empty database in a temporary
+// directory, holding master keys if master is set
+func newTestStorage(t *testing.T, aesKey []byte, master bool) *Storage {
+	t.Helper()
+	dir := t.TempDir()
+	db := database.Open(filepath.Join(dir, "endershare.db"))
+	t.Cleanup(func() { db.Close() })
+	if master {
+		_, masterPriv, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, peerPriv, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		db.StoreKeys(crypto.NewCryptoKeysFromBytes(masterPriv, peerPriv, aesKey))
+	}
+	return NewStorageIn(db, aesKey, dir)
+}
+
+// The drop private key must not be readable with the vault key alone
+func TestDropBoxKeyStaysOnMaster(t *testing.T) {
+	aesKey := make([]byte, 32)
+	master := newTestStorage(t, aesKey, true)
+	folderID, entry, err := master.CreateDropBox("inbox", RootFolderID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyJSON, err := crypto.Decrypt(entry.Key, aesKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(keyJSON, &fields); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fields["dropPrivateKey"]; ok {
+		t.Error("folder entry carries the drop private key")
+	}
+	var folder FolderEntry
+	if err := json.Unmarshal(keyJSON, &folder); err != nil {
+		t.Fatal(err)
+	}
+	if len(folder.DropPublicKey) == 0 {
+		t.Error("folder entry has no drop public key")
+	}
+
+	content := []byte("dropped content")
+	if _, _, err := master.AddFileFromReader(bytes.NewReader(content), "note.txt", folderID); err != nil {
+		t.Fatal(err)
+	}
+	r, err := master.OpenFileReader("note.txt", folderID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	r.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("master read %q, want %q", got, content)
+	}
+
+	// A vault member with the vault key but no master key
+	replica := newTestStorage(t, aesKey, false)
+	if _, err := replica.dropPrivateKey(&folder); err == nil {
+		t.Error("replica derived the drop private key")
+	}
+	// A master of another vault
+	other := newTestStorage(t, aesKey, true)
+	if _, err := other.dropPrivateKey(&folder); err == nil {
+		t.Error("another master opened the drop box")
+	}
+}
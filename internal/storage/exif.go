@@ -0,0 +1,172 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+	"time"
+)
+
+// exifHeadSize is how much of a file is inspected for EXIF data. The EXIF
+// segment of a JPEG is limited to 64 KiB and sits near the start.
+const exifHeadSize = 128 * 1024
+
+// EXIF tags read from IFD0 and the EXIF sub-IFD
+const (
+	tagMake             = 0x010F
+	tagModel            = 0x0110
+	tagDateTime         = 0x0132
+	tagExifIFD          = 0x8769
+	tagDateTimeOriginal = 0x9003
+)
+
+// PhotoInfo is the camera metadata of an image, read before encryption
+type PhotoInfo struct {
+	// CapturedAt is the camera's wall clock time; EXIF has no time zone, so
+	// it is stored as UTC and must not be converted to local time
+	CapturedAt time.Time `json:"capturedAt"`
+	Make       string    `json:"make,omitempty"`
+	Model      string    `json:"model,omitempty"`
+}
+
+// Camera returns the make and model as one display string
+func (p *PhotoInfo) Camera() string {
+	if p.Model == "" || strings.HasPrefix(p.Model, p.Make) {
+		return p.Model
+	}
+	return strings.TrimSpace(p.Make + " " + p.Model)
+}
+
+// peekPhotoInfo reads the EXIF data at the start of r, if any, and returns a
+// reader that still yields the whole stream
+func peekPhotoInfo(r io.Reader) (*PhotoInfo, io.Reader) {
+	br := bufio.NewReaderSize(r, exifHeadSize)
+	head, _ := br.Peek(exifHeadSize)
+	return parsePhotoInfo(head), br
+}
+
+// parsePhotoInfo extracts photo metadata from the head of a JPEG or TIFF
+// file, nil if there is no usable capture date
+func parsePhotoInfo(head []byte) *PhotoInfo {
+	var tiff []byte
+	switch {
+	case bytes.HasPrefix(head, []byte{0xFF, 0xD8}):
+		tiff = jpegExif(head)
+	case bytes.HasPrefix(head, []byte("II*\x00")), bytes.HasPrefix(head, []byte("MM\x00*")):
+		tiff = head
+	}
+	if tiff == nil {
+		return nil
+	}
+	return parseTIFF(tiff)
+}
+
+// jpegExif returns the TIFF structure inside the APP1 EXIF segment of a JPEG
+func jpegExif(data []byte) []byte {
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			return nil
+		}
+		marker := data[pos+1]
+		if marker == 0xDA || marker == 0xD9 { // Start of scan, end of image
+			return nil
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if length < 2 || pos+2+length > len(data) {
+			return nil
+		}
+		segment := data[pos+4 : pos+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return segment[6:]
+		}
+		pos += 2 + length
+	}
+	return nil
+}
+
+// parseTIFF reads the camera and date tags of a TIFF structure
+func parseTIFF(tiff []byte) *PhotoInfo {
+	if len(tiff) < 8 {
+		return nil
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil
+	}
+
+	info := &PhotoInfo{}
+	var dateTime, dateTimeOriginal string
+	var exifOffset uint32
+	readIFD(tiff, order, order.Uint32(tiff[4:]), func(tag uint16, value []byte, ascii string) {
+		switch tag {
+		case tagMake:
+			info.Make = ascii
+		case tagModel:
+			info.Model = ascii
+		case tagDateTime:
+			dateTime = ascii
+		case tagExifIFD:
+			exifOffset = order.Uint32(value)
+		}
+	})
+	if exifOffset != 0 {
+		readIFD(tiff, order, exifOffset, func(tag uint16, value []byte, ascii string) {
+			if tag == tagDateTimeOriginal {
+				dateTimeOriginal = ascii
+			}
+		})
+	}
+
+	for _, s := range []string{dateTimeOriginal, dateTime} {
+		if t, err := time.Parse("2006:01:02 15:04:05", s); err == nil {
+			info.CapturedAt = t
+			return info
+		}
+	}
+	return nil
+}
+
+// readIFD calls fn with every ASCII or LONG entry of the IFD at offset. For
+// LONG entries value holds the 4 raw bytes; for ASCII entries ascii holds the
+// string without its terminator.
+func readIFD(tiff []byte, order binary.ByteOrder, offset uint32, fn func(tag uint16, value []byte, ascii string)) {
+	if int64(offset)+2 > int64(len(tiff)) {
+		return
+	}
+	count := int(order.Uint16(tiff[offset:]))
+	for i := 0; i < count; i++ {
+		pos := int(offset) + 2 + 12*i
+		if pos+12 > len(tiff) {
+			return
+		}
+		tag := order.Uint16(tiff[pos:])
+		typ := order.Uint16(tiff[pos+2:])
+		n := order.Uint32(tiff[pos+4:])
+		value := tiff[pos+8 : pos+12]
+
+		switch typ {
+		case 2: // ASCII
+			data := value
+			if n > 4 {
+				start := order.Uint32(value)
+				if int64(start)+int64(n) > int64(len(tiff)) {
+					continue
+				}
+				data = tiff[start : start+n]
+			} else {
+				data = value[:n]
+			}
+			fn(tag, value, strings.TrimSpace(strings.TrimRight(string(data), "\x00")))
+		case 4: // LONG
+			fn(tag, value, "")
+		}
+	}
+}
@@ -0,0 +1,361 @@
+package storage
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"cmp"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ExportFolderToPath writes a folder and everything below it to a new local
+// directory at destPath, the reverse of AddFolderFromPath. Every folder is
+// created, empty ones included, and link entries come back as symbolic
+// links. Files get the mode and modification time recorded on import.
+// Trashed entries are left out. On Windows names it can't use are escaped,
+// see exportName, and deep trees are written past MAX_PATH.
+//
+// A file that fails is skipped and the export goes on; the returned error
+// then counts the failures. Folder errors stop the export.
+func (s *Storage) ExportFolderToPath(folderID FolderID, destPath string) error {
+	if !folderID.IsRoot() {
+		if _, err := s.GetFolder(folderID); err != nil {
+			return err
+		}
+	}
+	destPath = longPath(destPath)
+	if err := os.Mkdir(destPath, 0o755); err != nil {
+		return err
+	}
+
+	failed := 0
+	var firstErr error
+	seen := make(map[FolderID]bool) // Guards against parent cycles
+	var export func(folder FolderID, dir, rel string) error
+	export = func(folder FolderID, dir, rel string) error {
+		seen[folder] = true
+		children, err := s.lookupChildren(folder)
+		if err != nil {
+			return err
+		}
+		// Folders first and links last, so no file is written through a
+		// link this export created
+		slices.SortStableFunc(children, func(a, b indexEntry) int {
+			return exportOrder(a) - exportOrder(b)
+		})
+		used := make(map[string]bool)
+
+		for _, e := range children {
+			if e.trashed != nil {
+				continue
+			}
+			path := filepath.Join(rel, e.name)
+			if err := checkEntryName(e.name); err != nil {
+				failed++
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+			dest := filepath.Join(dir, exportName(e.name, used))
+
+			if e.typ == TypeFolder {
+				if seen[e.id] {
+					continue
+				}
+				if err := os.Mkdir(dest, 0o755); err != nil {
+					return fmt.Errorf("folder %s: %w", filepath.ToSlash(path), err)
+				}
+				if err := export(e.id, dest, path); err != nil {
+					return err
+				}
+				continue
+			}
+
+			fileEntry := e.file
+			err := s.hydrate(&e.data)
+			if err == nil {
+				err = s.exportFile(e.data.Value, &fileEntry, dest)
+			}
+			if err != nil {
+				failed++
+				if firstErr == nil {
+					firstErr = fmt.Errorf("%s: %w", filepath.ToSlash(path), err)
+				}
+			}
+		}
+		return nil
+	}
+
+	if err := export(folderID, destPath, ""); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d entries were not exported, first: %w", failed, firstErr)
+	}
+	return nil
+}
+
+// exportOrder ranks entries for ExportFolderToPath: folders, files, links
+func exportOrder(e indexEntry) int {
+	switch {
+	case e.typ == TypeFolder:
+		return 0
+	case e.file.Symlink:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// Archive formats ExportArchive writes
+const (
+	ArchiveZip = "zip"
+	ArchiveTar = "tar"
+)
+
+// ExportArchive writes a folder and everything below it to a new zip or tar
+// archive at destPath, with the files decrypted as they are streamed in. The
+// entries sit under a directory named after the folder, "endershare" for the
+// root, and keep the mode and modification time recorded on import; link
+// entries are stored as symbolic links. Trashed entries are left out.
+//
+// As with ExportFolderToPath a file that fails is skipped, and the returned
+// error counts the failures. Other errors remove the archive.
+func (s *Storage) ExportArchive(folderID FolderID, destPath, format string) error {
+	if format != ArchiveZip && format != ArchiveTar {
+		return fmt.Errorf("unsupported archive format %q, expected %s or %s", format, ArchiveZip, ArchiveTar)
+	}
+	top := "endershare"
+	if !folderID.IsRoot() {
+		folder, err := s.GetFolder(folderID)
+		if err != nil {
+			return err
+		}
+		top = folder.Name
+	}
+
+	f, err := os.OpenFile(longPath(destPath), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	var aw archiveWriter
+	if format == ArchiveZip {
+		aw = newZipArchive(f, LowResource(s.db))
+	} else {
+		aw = tarArchive{tar.NewWriter(f)}
+	}
+	skipped, err := s.writeArchive(folderID, top, aw)
+	if cerr := aw.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return skipped
+}
+
+// writeArchive adds the entries below folderID to aw under top. It returns
+// the error counting the files skipped, and stops on any other error.
+func (s *Storage) writeArchive(folderID FolderID, top string, aw archiveWriter) (skipped, err error) {
+	failed := 0
+	var firstErr error
+	skip := func(err error) {
+		failed++
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	seen := make(map[FolderID]bool) // Guards against parent cycles
+	var add func(folder FolderID, dir string) error
+	add = func(folder FolderID, dir string) error {
+		seen[folder] = true
+		if err := aw.dir(dir + "/"); err != nil {
+			return err
+		}
+		children, err := s.lookupChildren(folder)
+		if err != nil {
+			return err
+		}
+		slices.SortStableFunc(children, func(a, b indexEntry) int {
+			return cmp.Or(exportOrder(a)-exportOrder(b), strings.Compare(a.name, b.name))
+		})
+		// A file and a folder may share a name, archives can't tell them apart
+		used := make(map[string]bool)
+
+		for _, e := range children {
+			if e.trashed != nil {
+				continue
+			}
+			if err := checkEntryName(e.name); err != nil {
+				skip(err)
+				continue
+			}
+			name := path.Join(dir, archiveName(e.name, used))
+
+			if e.typ == TypeFolder {
+				if seen[e.id] {
+					continue
+				}
+				if err := add(e.id, name); err != nil {
+					return err
+				}
+				continue
+			}
+
+			fileEntry := e.file
+			if err := s.hydrate(&e.data); err != nil {
+				skip(fmt.Errorf("%s: %w", name, err))
+				continue
+			}
+			key, err := s.blobKey(&fileEntry)
+			if err != nil {
+				skip(fmt.Errorf("%s: %w", name, err))
+				continue
+			}
+			srcPath := filepath.Join(s.dataDir, hexEncode(e.data.Value))
+			if fileEntry.Symlink {
+				var target bytes.Buffer
+				if err := s.decryptContent(&target, srcPath, key, &fileEntry); err != nil {
+					skip(fmt.Errorf("%s: %w", name, err))
+					continue
+				}
+				if err := aw.link(name, target.String(), &fileEntry); err != nil {
+					return err
+				}
+				continue
+			}
+			w, err := aw.file(name, &fileEntry)
+			if err != nil {
+				return err
+			}
+			// Once the file is started in the archive a failure can't be skipped
+			if err := s.decryptContent(w, srcPath, key, &fileEntry); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		}
+		return nil
+	}
+
+	if err := add(folderID, top); err != nil {
+		return nil, err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d entries were not exported, first: %w", failed, firstErr), nil
+	}
+	return nil, nil
+}
+
+// archiveName returns the name for an entry added to an archive directory
+// that already got the names in used, and adds it there. A name taken by the
+// other type of entry is numbered, as in "photo~2.jpg".
+func archiveName(name string, used map[string]bool) string {
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	candidate := name
+	for i := 2; used[candidate]; i++ {
+		candidate = fmt.Sprintf("%s~%d%s", base, i, ext)
+	}
+	used[candidate] = true
+	return candidate
+}
+
+// archiveMode returns the mode recorded for a file, 0644 if none was
+func archiveMode(fileEntry *FileEntry) fs.FileMode {
+	if fileEntry.Mode != 0 {
+		return fileEntry.Mode.Perm()
+	}
+	return 0o644
+}
+
+// archiveWriter adds entries to a zip or tar archive. Names use forward
+// slashes, directory names end with one.
+type archiveWriter interface {
+	dir(name string) error
+	file(name string, fileEntry *FileEntry) (io.Writer, error)
+	link(name, target string, fileEntry *FileEntry) error
+	Close() error
+}
+
+type zipArchive struct {
+	zw     *zip.Writer
+	method uint16
+}
+
+// newZipArchive returns an archiveWriter writing a zip to w, deflating the
+// files unless store is set
+func newZipArchive(w io.Writer, store bool) zipArchive {
+	method := zip.Deflate
+	if store {
+		method = zip.Store
+	}
+	return zipArchive{zw: zip.NewWriter(w), method: method}
+}
+
+func (a zipArchive) dir(name string) error {
+	h := &zip.FileHeader{Name: name, Method: zip.Store, Modified: time.Now()}
+	h.SetMode(fs.ModeDir | 0o755)
+	_, err := a.zw.CreateHeader(h)
+	return err
+}
+
+func (a zipArchive) file(name string, fileEntry *FileEntry) (io.Writer, error) {
+	h := &zip.FileHeader{Name: name, Method: a.method, Modified: fileEntry.ModifiedAt}
+	h.SetMode(archiveMode(fileEntry))
+	return a.zw.CreateHeader(h)
+}
+
+func (a zipArchive) link(name, target string, fileEntry *FileEntry) error {
+	h := &zip.FileHeader{Name: name, Method: zip.Store, Modified: fileEntry.ModifiedAt}
+	h.SetMode(fs.ModeSymlink | 0o777)
+	w, err := a.zw.CreateHeader(h)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, target)
+	return err
+}
+
+func (a zipArchive) Close() error {
+	return a.zw.Close()
+}
+
+type tarArchive struct {
+	tw *tar.Writer
+}
+
+func (a tarArchive) dir(name string) error {
+	return a.tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: name, Mode: 0o755, ModTime: time.Now()})
+}
+
+func (a tarArchive) file(name string, fileEntry *FileEntry) (io.Writer, error) {
+	err := a.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     fileEntry.Size,
+		Mode:     int64(archiveMode(fileEntry)),
+		ModTime:  fileEntry.ModifiedAt,
+	})
+	return a.tw, err
+}
+
+func (a tarArchive) link(name, target string, fileEntry *FileEntry) error {
+	return a.tw.WriteHeader(&tar.Header{Typeflag: tar.TypeSymlink, Name: name, Linkname: target, Mode: 0o777, ModTime: fileEntry.ModifiedAt})
+}
+
+func (a tarArchive) Close() error {
+	return a.tw.Close()
+}
@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// newExportSource returns storage holding a folder "src" with nested and
+// empty folders, a file spanning several chunks, a link and a trashed file,
+// along with the tree an export of it should bring back
+func newExportSource(t *testing.T) (*Storage, FolderID, map[string]string) {
+	t.Helper()
+	s := newTestStorage(t, make([]byte, 32), false)
+	src, err := s.CreateFolder("src", RootFolderID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	big := strings.Repeat("0123456789abcdef", 40000)
+	if _, _, err := s.ImportArchive(writeArchive(t, "tar", []archiveFile{
+		{name: "readme.txt", body: "hello"},
+		{name: "docs/big.bin", body: big},
+		{name: "docs/deeper/note.txt", body: "deep"},
+		{name: "empty/"},
+		{name: "current", link: "docs/deeper/note.txt"},
+	}), src, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.AddFileFromReader(strings.NewReader("gone"), "trashed.txt", src); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.TrashFile("trashed.txt", src); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"src/":                     "",
+		"src/readme.txt":           "hello",
+		"src/docs/":                "",
+		"src/docs/big.bin":         big,
+		"src/docs/deeper/":         "",
+		"src/docs/deeper/note.txt": "deep",
+		"src/empty/":               "",
+		"src/current":              "-> docs/deeper/note.txt",
+	}
+	return s, src, want
+}
+
+// An archive export imports back into the same names, folders and contents
+func TestExportArchiveRoundTrip(t *testing.T) {
+	for _, format := range []string{ArchiveZip, ArchiveTar} {
+		t.Run(format, func(t *testing.T) {
+			s, src, want := newExportSource(t)
+			archive := filepath.Join(t.TempDir(), "export."+format)
+			if err := s.ExportArchive(src, archive, format); err != nil {
+				t.Fatal(err)
+			}
+
+			restored := newTestStorage(t, make([]byte, 32), false)
+			if _, _, err := restored.ImportArchive(archive, RootFolderID, nil); err != nil {
+				t.Fatal(err)
+			}
+			if got := vaultTree(t, restored, RootFolderID); !maps.Equal(got, want) {
+				t.Errorf("round trip gave %s, want %s", treeNames(got), treeNames(want))
+			}
+		})
+	}
+}
+
+// A directory export imports back the same way
+func TestExportFolderRoundTrip(t *testing.T) {
+	s, src, want := newExportSource(t)
+	dest := filepath.Join(t.TempDir(), "src")
+	if err := s.ExportFolderToPath(src, dest); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := newTestStorage(t, make([]byte, 32), false)
+	if _, _, _, err := restored.AddFolderFromPath(dest, RootFolderID, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := vaultTree(t, restored, RootFolderID); !maps.Equal(got, want) {
+		t.Errorf("round trip gave %s, want %s", treeNames(got), treeNames(want))
+	}
+}
+
+// treeNames lists the paths of a vaultTree for error messages, without the
+// contents, which may be long
+func treeNames(tree map[string]string) string {
+	return strings.Join(slices.Sorted(maps.Keys(tree)), ", ")
+}
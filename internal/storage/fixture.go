@@ -0,0 +1,170 @@
+package storage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// Size distributions of fixture files
+const (
+	FixtureSizeUniform = "uniform" // Every size between the bounds equally likely
+	FixtureSizeLog     = "log"     // Log-uniform: as many files of 1-10 KiB as of 100 KiB-1 MiB
+)
+
+// fixtureEpoch is the creation time of the first fixture file, later ones
+// follow at random intervals
+var fixtureEpoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// FixtureSpec describes a synthetic vault. The folder tree has Fanout
+// subfolders in every folder down to Depth levels below the root, and the
+// files are spread over the root and all folders.
+type FixtureSpec struct {
+	Files    int
+	MinSize  int64
+	MaxSize  int64
+	SizeDist string // FixtureSizeUniform or FixtureSizeLog
+	Depth    int
+	Fanout   int
+	Seed     uint64
+}
+
+// FixtureStats counts what GenerateFixture created
+type FixtureStats struct {
+	Files   int
+	Folders int
+	Bytes   int64 // Plaintext bytes of all files
+}
+
+// DefaultFixtureSpec is a thousand files of 1 KiB to 1 MiB in 20 folders
+func DefaultFixtureSpec() FixtureSpec {
+	return FixtureSpec{
+		Files:    1000,
+		MinSize:  1 << 10,
+		MaxSize:  1 << 20,
+		SizeDist: FixtureSizeLog,
+		Depth:    2,
+		Fanout:   4,
+		Seed:     1,
+	}
+}
+
+func (spec FixtureSpec) validate() error {
+	switch {
+	case spec.Files < 0:
+		return fmt.Errorf("negative file count %d", spec.Files)
+	case spec.MinSize < 0 || spec.MaxSize < spec.MinSize:
+		return fmt.Errorf("invalid size range %d-%d", spec.MinSize, spec.MaxSize)
+	case spec.SizeDist != FixtureSizeUniform && spec.SizeDist != FixtureSizeLog:
+		return fmt.Errorf("unknown size distribution %q", spec.SizeDist)
+	case spec.Depth < 0 || spec.Fanout < 0:
+		return fmt.Errorf("invalid folder tree depth %d, fanout %d", spec.Depth, spec.Fanout)
+	}
+	return nil
+}
+
+// GenerateFixture writes a synthetic vault straight into the database and
+// data directory, without publishing updates; a master resyncs its peers on
+// its next start. Folder IDs, names, sizes, timestamps and file contents are
+// a function of the spec, so the same spec gives the same vault apart from
+// the random nonces of the encryption. progress is called after every file.
+func (s *Storage) GenerateFixture(spec FixtureSpec, progress func(done, total int)) (FixtureStats, error) {
+	var stats FixtureStats
+	if err := spec.validate(); err != nil {
+		return stats, err
+	}
+	rng := rand.New(rand.NewPCG(spec.Seed, 0x656e646572)) // "ender"
+
+	// Breadth first, so the folders of one level are created together
+	folders := []FolderID{RootFolderID}
+	level := []FolderID{RootFolderID}
+	for depth := 1; depth <= spec.Depth && spec.Fanout > 0; depth++ {
+		var next []FolderID
+		for _, parent := range level {
+			for i := 0; i < spec.Fanout; i++ {
+				entry := FolderEntry{
+					Type:           TypeFolder,
+					FolderID:       fixtureFolderID(rng),
+					Name:           fmt.Sprintf("folder-%d-%02d", depth, i),
+					ParentFolderID: parent,
+				}
+				if _, err := s.createFolder(entry); err != nil {
+					return stats, err
+				}
+				next = append(next, entry.FolderID)
+				stats.Folders++
+			}
+		}
+		folders = append(folders, next...)
+		level = next
+	}
+
+	keyEpoch := s.db.GetKeyEpoch()
+	created := fixtureEpoch
+	for i := 0; i < spec.Files; i++ {
+		folderID := folders[rng.IntN(len(folders))]
+		size := spec.fileSize(rng)
+		created = created.Add(time.Duration(rng.Int64N(int64(time.Hour))))
+
+		content := io.LimitReader(fixtureContent(spec.Seed, i), size)
+		contentHash := s.newContentHash()
+		tempFile, fileHash, originalSize, err := streamEncryptWithHash(content, s.tempDir, s.aesKey, keyEpoch, "", contentHash)
+		if err != nil {
+			return stats, err
+		}
+		fileEntry := FileEntry{
+			Type:        TypeFile,
+			Name:        fmt.Sprintf("file-%06d.bin", i),
+			CreatedAt:   created,
+			ModifiedAt:  created,
+			Size:        originalSize,
+			FolderID:    folderID,
+			ContentHash: contentHash.Sum(nil),
+		}
+		if _, err := s.commitFile(tempFile, fileHash, keyEpoch, fileEntry); err != nil {
+			return stats, fmt.Errorf("file %d: %w", i, err)
+		}
+		stats.Files++
+		stats.Bytes += originalSize
+		if progress != nil {
+			progress(i+1, spec.Files)
+		}
+	}
+	return stats, nil
+}
+
+// fileSize draws the size of the next file
+func (spec FixtureSpec) fileSize(rng *rand.Rand) int64 {
+	if spec.MaxSize == spec.MinSize {
+		return spec.MinSize
+	}
+	if spec.SizeDist == FixtureSizeLog {
+		lo := math.Log(float64(max(spec.MinSize, 1)))
+		hi := math.Log(float64(spec.MaxSize))
+		size := int64(math.Exp(lo + rng.Float64()*(hi-lo)))
+		return min(max(size, spec.MinSize), spec.MaxSize)
+	}
+	return spec.MinSize + rng.Int64N(spec.MaxSize-spec.MinSize+1)
+}
+
+// fixtureFolderID draws a version 4 UUID, see NewFolderID
+func fixtureFolderID(rng *rand.Rand) FolderID {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], rng.Uint64())
+	binary.BigEndian.PutUint64(b[8:], rng.Uint64())
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return FolderID(fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]))
+}
+
+// fixtureContent returns the endless content stream of file i, independent
+// of the other files
+func fixtureContent(seed uint64, i int) io.Reader {
+	var key [32]byte
+	binary.BigEndian.PutUint64(key[:8], seed)
+	binary.BigEndian.PutUint64(key[8:16], uint64(i))
+	return rand.NewChaCha8(key)
+}
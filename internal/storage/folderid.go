@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// FolderID identifies a folder. New folders get random UUIDs so any device can
+// create them without coordination. Vaults created before UUIDs stored folder
+// IDs as JSON numbers; those decode to their decimal form (e.g. 7 -> "7") so
+// existing entries keep their identity without being rewritten.
+type FolderID string
+
+// RootFolderID is the implicit root of the vault
+const RootFolderID FolderID = "0"
+
+// ReleaseFolderID holds the release binaries the master publishes. It has no
+// folder entry: its files sync like any others but can't be reached by
+// browsing from the root.
+const ReleaseFolderID FolderID = "releases"
+
+// NewFolderID returns a random RFC 4122 version 4 UUID
+func NewFolderID() FolderID {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(fmt.Sprintf("failed to generate folder ID: %v", err))
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return FolderID(fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]))
+}
+
+// IsRoot reports whether id is the vault root
+func (id FolderID) IsRoot() bool {
+	return id == RootFolderID || id == ""
+}
+
+// legacyInt returns the integer form of a pre-UUID folder ID
+func (id FolderID) legacyInt() (int64, bool) {
+	n, err := strconv.ParseInt(string(id), 10, 64)
+	if err != nil || strconv.FormatInt(n, 10) != string(id) {
+		return 0, false
+	}
+	return n, true
+}
+
+// UnmarshalJSON accepts both legacy numeric IDs and string IDs
+func (id *FolderID) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		*id = FolderID(s)
+		return nil
+	}
+
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("invalid folder ID %s", data)
+	}
+	if _, err := n.Int64(); err != nil {
+		return fmt.Errorf("invalid folder ID %s", data)
+	}
+	*id = FolderID(n.String())
+	return nil
+}
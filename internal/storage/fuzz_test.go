@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/notassigned/endershare/internal/crypto"
+	"github.com/notassigned/endershare/internal/database"
+)
+
+var fuzzKey = make([]byte, 32)
+
+// FuzzMetadata decodes the encrypted key of a data entry. An input starting
+// with 0 is used as the ciphertext itself, so malformed ciphertext is covered;
+// otherwise the rest is encrypted first, so the metadata JSON is.
+func FuzzMetadata(f *testing.F) {
+	trashed := time.Unix(1700000000, 0).UTC()
+	for _, metadata := range []any{
+		FileEntry{Type: TypeFile, Name: "photo.jpg", FolderID: RootFolderID, Size: 1234},
+		FolderEntry{Type: TypeFolder, FolderID: "a", Name: "photos", ParentFolderID: RootFolderID},
+		// A trashed folder that is its own parent, which the trash walk must not follow forever
+		FolderEntry{Type: TypeFolder, FolderID: "b", Name: "loop", ParentFolderID: "b", TrashedAt: &trashed},
+	} {
+		plain, err := json.Marshal(metadata)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(append([]byte{1}, plain...))
+		encrypted, err := crypto.Encrypt(plain, fuzzKey)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(append([]byte{0}, encrypted...))
+	}
+	f.Add([]byte{0})
+	f.Add([]byte{1, '{', '}'})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if len(data) == 0 {
+			return
+		}
+		key := data[1:]
+		if data[0] != 0 {
+			encrypted, err := crypto.Encrypt(key, fuzzKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			key = encrypted
+		}
+
+		s := &Storage{aesKey: fuzzKey}
+		e, ok := s.decodeEntry(database.DataEntry{Key: key})
+		if !ok {
+			return
+		}
+		// The trash walk follows parent IDs taken from the metadata
+		hiddenFolders([]indexEntry{e})
+	})
+}
@@ -2,87 +2,182 @@ package storage
 
 import (
 	"encoding/binary"
-	"encoding/json"
+	"errors"
 	"io"
 	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
 
 	"github.com/notassigned/endershare/internal/crypto"
-	"github.com/notassigned/endershare/internal/database"
 	"lukechampine.com/blake3"
 )
 
 // computeFolderTag produces a keyed hash of folderID using the AES key.
 // Used as an indexed column so folder contents can be queried without decrypting every row.
-func computeFolderTag(folderID int, aesKey []byte) []byte {
+// Legacy numeric IDs keep their original tag so existing rows stay indexed.
+func computeFolderTag(folderID FolderID, aesKey []byte) []byte {
 	h := blake3.New(32, aesKey)
-	binary.Write(h, binary.BigEndian, int64(folderID))
+	if n, ok := folderID.legacyInt(); ok {
+		binary.Write(h, binary.BigEndian, n)
+	} else {
+		h.Write([]byte("folder-uuid:"))
+		h.Write([]byte(folderID))
+	}
 	return h.Sum(nil)
 }
 
-// streamEncryptFileWithHash encrypts a file and returns the hash of the encrypted content
-func streamEncryptFileWithHash(srcPath, destPath string, key []byte) ([]byte, error) {
-	srcFile, err := os.Open(srcPath)
+const (
+	// encryptTempPattern names temp files written while encrypting an import
+	encryptTempPattern = "add-*"
+	// moveTempPattern names copies made when the temp dir is on another filesystem
+	moveTempPattern = ".move-*"
+)
+
+// streamEncryptWithHash encrypts src, compressed with codec, into a uniquely
+// named temp file in tempDir and returns its path, the hash of the encrypted
+// content and the number of plaintext bytes read. The plaintext is also
+// written to contentHash unless it is nil.
+func streamEncryptWithHash(src io.Reader, tempDir string, key []byte, keyEpoch uint32, codec string, contentHash io.Writer) (string, []byte, int64, error) {
+	if contentHash != nil {
+		src = io.TeeReader(src, contentHash)
+	}
+	counter := &countingReader{r: src}
+	encoded, err := compressReader(counter, codec)
 	if err != nil {
-		return nil, err
+		return "", nil, 0, err
 	}
-	defer srcFile.Close()
-
-	destFile, err := os.Create(destPath)
+	defer encoded.Close()
+	destFile, err := os.CreateTemp(tempDir, encryptTempPattern)
 	if err != nil {
-		return nil, err
+		return "", nil, 0, err
 	}
 	defer destFile.Close()
 
 	hasher := blake3.New(32, nil)
-	if err := crypto.EncryptStream(destFile, srcFile, key, hasher); err != nil {
-		return nil, err
+	if err := crypto.EncryptStream(destFile, encoded, key, keyEpoch, hasher); err != nil {
+		os.Remove(destFile.Name())
+		return "", nil, 0, err
 	}
 
-	return hasher.Sum(nil), nil
+	// Flush the blob to disk before it can be renamed into place
+	if err := destFile.Sync(); err != nil {
+		os.Remove(destFile.Name())
+		return "", nil, 0, err
+	}
+
+	return destFile.Name(), hasher.Sum(nil), counter.n, nil
 }
 
-// streamDecryptFile decrypts a file from source to destination
-func streamDecryptFile(srcPath, destPath string, key []byte) error {
-	srcFile, err := os.Open(srcPath)
-	if err != nil {
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// progressMinStep is the fewest bytes between two progress reports
+const progressMinStep = 1 << 20
+
+// progressReader reports the bytes read through it out of total, about once
+// per percent, and once more at the end of the input
+type progressReader struct {
+	r        io.Reader
+	done     int64
+	total    int64
+	next     int64
+	progress func(done, total int64)
+}
+
+func newProgressReader(r io.Reader, total int64, progress func(done, total int64)) *progressReader {
+	return &progressReader{r: r, total: total, progress: progress}
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.done += int64(n)
+	if p.done >= p.next || err == io.EOF {
+		p.progress(p.done, p.total)
+		p.next = p.done + max(p.total/100, progressMinStep)
+	}
+	return n, err
+}
+
+// moveIntoPlace renames tempPath to finalPath. If they are on different
+// filesystems the file is first copied next to finalPath so the final step is
+// still an atomic same-filesystem rename.
+func moveIntoPlace(tempPath, finalPath string) error {
+	err := os.Rename(tempPath, finalPath)
+	if err == nil || !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	if err := copyIntoPlace(tempPath, finalPath); err != nil {
 		return err
 	}
-	defer srcFile.Close()
+	os.Remove(tempPath)
+	return nil
+}
 
-	destFile, err := os.Create(destPath)
+// copyIntoPlace copies srcPath to a temp file next to finalPath, flushes it
+// and renames it into place, so finalPath never holds a partial copy
+func copyIntoPlace(srcPath, finalPath string) error {
+	staged, err := os.CreateTemp(filepath.Dir(finalPath), moveTempPattern)
 	if err != nil {
 		return err
 	}
-	defer destFile.Close()
+	stagedPath := staged.Name()
 
-	return crypto.DecryptStream(destFile, srcFile, key)
+	src, err := os.Open(srcPath)
+	if err != nil {
+		staged.Close()
+		os.Remove(stagedPath)
+		return err
+	}
+	_, err = io.Copy(staged, src)
+	src.Close()
+	if err == nil {
+		err = staged.Sync()
+	}
+	if closeErr := staged.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(stagedPath, finalPath)
+	}
+	if err != nil {
+		os.Remove(stagedPath)
+		return err
+	}
+	return nil
 }
 
-// loadNextFolderID scans the database to find the maximum folder ID
-func loadNextFolderID(db *database.EndershareDB, aesKey []byte) int {
-	rows, err := db.GetAllData()
+// syncDir flushes directory entries (e.g. a rename) to disk
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
 	if err != nil {
-		return 0
+		return err
 	}
+	defer d.Close()
+	if err := d.Sync(); err != nil && runtime.GOOS != "windows" {
+		return err
+	}
+	return nil
+}
 
-	maxFolderID := -1
-	for _, entry := range rows {
-		decryptedKey, err := crypto.Decrypt(entry.Key, aesKey)
-		if err != nil {
-			continue
-		}
-
-		var folder FolderEntry
-		if err := json.Unmarshal(decryptedKey, &folder); err != nil {
-			continue
-		}
-
-		if folder.Type == TypeFolder && folder.FolderID > maxFolderID {
-			maxFolderID = folder.FolderID
-		}
+// streamDecryptFile decrypts the blob of a file entry from source to destination
+func (s *Storage) streamDecryptFile(srcPath, destPath string, key []byte, fileEntry *FileEntry) error {
+	destFile, err := os.Create(destPath)
+	if err != nil {
+		return err
 	}
+	defer destFile.Close()
 
-	return maxFolderID + 1
+	return s.decryptContent(destFile, srcPath, key, fileEntry)
 }
 
 // getOriginalFileSize returns the size of a file before encryption
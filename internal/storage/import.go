@@ -0,0 +1,444 @@
+package storage
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/notassigned/endershare/internal/database"
+)
+
+// ImportProgress reports one file of a folder import
+type ImportProgress struct {
+	Path  string // Relative to the imported directory or archive, with forward slashes
+	Done  int    // Files handled so far, including this one
+	Total int
+	Err   error // Set if this file was not imported
+}
+
+// AddFolderFromPath imports a local directory as a folder below parentFolderID,
+// recreating its subdirectories as folders and importing every regular file
+// with ImportFile. Folders that already exist with the same name are reused,
+// so importing a directory again adds a new version of each of its files.
+// Symbolic links are kept as links, see FileEntry.Symlink, and are not
+// followed. Other special files are skipped.
+//
+// A file that fails is reported to progress and the import goes on; the
+// returned error then counts the failures. Folder errors stop the import.
+// Either way every entry created is returned for publishing, folders before
+// their contents, along with the entries of files replaced by a new version.
+// The database journals the import while it runs, so if the process dies
+// part-way RecoverImport undoes it on the next start rather than leaving a
+// half-imported tree.
+func (s *Storage) AddFolderFromPath(localPath string, parentFolderID FolderID, progress func(ImportProgress)) (folderID FolderID, replaced, added []*database.DataEntry, err error) {
+	root, err := filepath.Abs(localPath)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	root = longPath(root) // Deep trees are read past MAX_PATH on Windows
+	info, err := os.Stat(root)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	if !info.IsDir() {
+		return "", nil, nil, fmt.Errorf("%s is not a directory", localPath)
+	}
+	s.db.BeginImport()
+	defer func() {
+		if endErr := s.db.EndImport(); endErr != nil && err == nil {
+			err = endErr
+		}
+	}()
+
+	// Count first so progress can report a total
+	total := 0
+	if err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && (d.Type().IsRegular() || isLink(d)) {
+			total++
+		}
+		return nil
+	}); err != nil {
+		return "", nil, nil, err
+	}
+
+	folders := make(map[string]FolderID) // Local directory to vault folder
+	ensureFolder := func(dir string, parent FolderID) (FolderID, error) {
+		name := filepath.Base(dir)
+		if err := checkEntryName(name); err != nil {
+			return "", err
+		}
+		id, err := s.findChildFolder(parent, name)
+		if err != nil || id != "" {
+			return id, err
+		}
+		id, entry, err := s.CreateFolderWithEntry(name, parent)
+		if err != nil {
+			return "", err
+		}
+		added = append(added, entry)
+		return id, nil
+	}
+
+	if folderID, err = ensureFolder(root, parentFolderID); err != nil {
+		return "", nil, nil, err
+	}
+	folders[root] = folderID
+
+	done, failed := 0, 0
+	var firstErr error
+	walkErr := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		rel, _ := filepath.Rel(root, path)
+		rel = filepath.ToSlash(rel)
+		if err != nil {
+			if path == root {
+				return err
+			}
+			// An unreadable directory is skipped with its contents
+			failed++
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%s: %w", rel, err)
+			}
+			if progress != nil {
+				progress(ImportProgress{Path: rel, Done: done, Total: total, Err: err})
+			}
+			if d != nil && d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if path == root {
+			return nil
+		}
+
+		parent := folders[filepath.Dir(path)]
+		if d.IsDir() {
+			id, err := ensureFolder(path, parent)
+			if err != nil {
+				return fmt.Errorf("folder %s: %w", rel, err)
+			}
+			folders[path] = id
+			return nil
+		}
+		if !d.Type().IsRegular() && !isLink(d) {
+			return nil
+		}
+
+		done++
+		fileErr := checkEntryName(d.Name())
+		if fileErr == nil {
+			var old *database.DataEntry
+			var entries []*database.DataEntry
+			if isLink(d) {
+				old, entries, fileErr = s.importLink(path, d.Name(), parent)
+			} else {
+				old, entries, fileErr = s.ImportFile(path, d.Name(), parent, nil)
+			}
+			added = append(added, entries...)
+			if old != nil {
+				replaced = append(replaced, old)
+			}
+		}
+		if fileErr != nil {
+			failed++
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%s: %w", rel, fileErr)
+			}
+		}
+		if progress != nil {
+			progress(ImportProgress{Path: rel, Done: done, Total: total, Err: fileErr})
+		}
+		return nil
+	})
+	if walkErr != nil {
+		return folderID, replaced, added, walkErr
+	}
+	if failed > 0 {
+		return folderID, replaced, added, fmt.Errorf("%d entries were not imported, first: %w", failed, firstErr)
+	}
+	return folderID, replaced, added, nil
+}
+
+func isLink(d fs.DirEntry) bool {
+	return d.Type()&fs.ModeSymlink != 0
+}
+
+// importLink adds a symbolic link as a file holding its target. The import
+// rules for photos don't apply to links.
+func (s *Storage) importLink(path, name string, folderID FolderID) (replaced *database.DataEntry, added []*database.DataEntry, err error) {
+	target, err := os.Readlink(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	replaced, entry, err := s.addFile(strings.NewReader(target), name, folderID, nil, linkAttrs(path))
+	if entry != nil {
+		added = append(added, entry)
+	}
+	return replaced, added, err
+}
+
+// maxArchiveLink bounds the target of a symbolic link read from an archive
+const maxArchiveLink = 4096
+
+// ImportArchive extracts a zip or tar archive into folderID, the reverse of
+// ExportArchive. Entries are streamed from the archive into encryption, so
+// no decrypted file is written to disk on the way. Directories become
+// folders, reusing those that exist, and files keep the mode and
+// modification time the archive records; symbolic links are kept as links.
+// The format is told from the content, not the extension. Other entry types,
+// hard links among them, are skipped, and entries whose path leaves the
+// archive are refused.
+//
+// As with AddFolderFromPath, a file that fails is reported to progress and
+// the import goes on, the returned error then counting the failures, and
+// the import is journaled so a crash part-way is rolled back.
+func (s *Storage) ImportArchive(archivePath string, folderID FolderID, progress func(ImportProgress)) (replaced, added []*database.DataEntry, err error) {
+	if !folderID.IsRoot() {
+		if _, err := s.GetFolder(folderID); err != nil {
+			return nil, nil, err
+		}
+	}
+	f, err := os.Open(longPath(archivePath))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	walk, err := archiveWalker(f)
+	if err != nil {
+		return nil, nil, err
+	}
+	s.db.BeginImport()
+	defer func() {
+		if endErr := s.db.EndImport(); endErr != nil && err == nil {
+			err = endErr
+		}
+	}()
+
+	// Count first so progress can report a total; tar skips file data by seeking
+	total := 0
+	if err := walk(func(e archiveEntry) error {
+		if !e.dir {
+			total++
+		}
+		return nil
+	}); err != nil {
+		return nil, nil, err
+	}
+
+	folders := map[string]FolderID{".": folderID} // Archive directory to vault folder
+	var ensureFolder func(dir string) (FolderID, error)
+	ensureFolder = func(dir string) (FolderID, error) {
+		if id, ok := folders[dir]; ok {
+			return id, nil
+		}
+		parent, err := ensureFolder(path.Dir(dir))
+		if err != nil {
+			return "", err
+		}
+		name := path.Base(dir)
+		if err := checkEntryName(name); err != nil {
+			return "", fmt.Errorf("folder %s: %w", dir, err)
+		}
+		id, created, err := s.ChildFolder(parent, name)
+		if err != nil {
+			return "", fmt.Errorf("folder %s: %w", dir, err)
+		}
+		if created != nil {
+			added = append(added, created)
+		}
+		folders[dir] = id
+		return id, nil
+	}
+
+	done, failed := 0, 0
+	var firstErr error
+	walkErr := walk(func(e archiveEntry) error {
+		rel, fileErr := archiveEntryPath(e.name)
+		if e.dir {
+			// The files of a refused directory are refused one by one
+			if fileErr != nil || rel == "." {
+				return nil
+			}
+			_, err := ensureFolder(rel)
+			return err
+		}
+
+		done++
+		if fileErr == nil {
+			fileErr = checkEntryName(path.Base(rel))
+		} else {
+			rel = e.name
+		}
+		if fileErr == nil {
+			parent, err := ensureFolder(path.Dir(rel))
+			if err != nil {
+				return err
+			}
+			var old *database.DataEntry
+			var entries []*database.DataEntry
+			old, entries, fileErr = s.importArchiveEntry(e, path.Base(rel), parent)
+			added = append(added, entries...)
+			if old != nil {
+				replaced = append(replaced, old)
+			}
+		}
+		if fileErr != nil {
+			failed++
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%s: %w", rel, fileErr)
+			}
+		}
+		if progress != nil {
+			progress(ImportProgress{Path: rel, Done: done, Total: total, Err: fileErr})
+		}
+		return nil
+	})
+	if walkErr != nil {
+		return replaced, added, walkErr
+	}
+	if failed > 0 {
+		return replaced, added, fmt.Errorf("%d entries were not imported, first: %w", failed, firstErr)
+	}
+	return replaced, added, nil
+}
+
+// importArchiveEntry adds a file or link entry of an archive as name in
+// folderID. Files go through the import rules, links don't.
+func (s *Storage) importArchiveEntry(e archiveEntry, name string, folderID FolderID) (replaced *database.DataEntry, added []*database.DataEntry, err error) {
+	rc, err := e.open()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rc.Close()
+	if !e.attrs.symlink {
+		return s.importFile(rc, name, folderID, e.attrs)
+	}
+
+	target, err := io.ReadAll(io.LimitReader(rc, maxArchiveLink+1))
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(target) > maxArchiveLink {
+		return nil, nil, fmt.Errorf("link target over %d bytes", maxArchiveLink)
+	}
+	replaced, entry, err := s.addFile(bytes.NewReader(target), name, folderID, nil, e.attrs)
+	if entry != nil {
+		added = append(added, entry)
+	}
+	return replaced, added, err
+}
+
+// archiveEntryPath cleans the path of an archive entry, "." for the top
+// level itself, and refuses paths that would leave it, Windows drive letters
+// included
+func archiveEntryPath(name string) (string, error) {
+	rel := path.Clean(name)
+	drive := len(rel) >= 2 && rel[1] == ':' && ('A' <= rel[0] && rel[0] <= 'Z' || 'a' <= rel[0] && rel[0] <= 'z')
+	if path.IsAbs(rel) || drive || rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", fmt.Errorf("%w: path leaves the archive", ErrInvalidName)
+	}
+	return rel, nil
+}
+
+// archiveEntry is a directory, file or symbolic link read from an archive
+type archiveEntry struct {
+	name  string // As stored, with forward slashes
+	dir   bool
+	attrs *fileAttrs
+	open  func() (io.ReadCloser, error) // A file's content or a link's target
+}
+
+// archiveWalker returns a function calling fn for every directory, file and
+// link of the zip or tar archive in f, in archive order. It can be called
+// more than once; each call reads the archive from the start.
+func archiveWalker(f *os.File) (func(fn func(archiveEntry) error) error, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	magic := make([]byte, 262)
+	n, err := f.ReadAt(magic, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	magic = magic[:n]
+
+	switch {
+	case bytes.HasPrefix(magic, []byte("PK\x03\x04")), bytes.HasPrefix(magic, []byte("PK\x05\x06")):
+		zr, err := zip.NewReader(f, info.Size())
+		if err != nil {
+			return nil, err
+		}
+		return func(fn func(archiveEntry) error) error {
+			return walkZip(zr, fn)
+		}, nil
+	case len(magic) == 262 && bytes.HasPrefix(magic[257:], []byte("ustar")):
+		return func(fn func(archiveEntry) error) error {
+			if _, err := f.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+			return walkTar(tar.NewReader(f), fn)
+		}, nil
+	}
+	return nil, fmt.Errorf("%s is not a zip or tar archive", filepath.Base(f.Name()))
+}
+
+func walkZip(zr *zip.Reader, fn func(archiveEntry) error) error {
+	for _, zf := range zr.File {
+		mode := zf.Mode()
+		e := archiveEntry{name: zf.Name, open: zf.Open}
+		switch {
+		case mode.IsDir():
+			e.dir = true
+		case mode&fs.ModeSymlink != 0:
+			e.attrs = &fileAttrs{modTime: zf.Modified, symlink: true}
+		case mode.IsRegular():
+			e.attrs = &fileAttrs{modTime: zf.Modified, mode: mode.Perm()}
+		default:
+			continue
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func walkTar(tr *tar.Reader, fn func(archiveEntry) error) error {
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		e := archiveEntry{name: h.Name}
+		switch h.Typeflag {
+		case tar.TypeDir:
+			e.dir = true
+		case tar.TypeSymlink:
+			e.attrs = &fileAttrs{modTime: h.ModTime, symlink: true}
+			e.open = func() (io.ReadCloser, error) {
+				return io.NopCloser(strings.NewReader(h.Linkname)), nil
+			}
+		case tar.TypeReg:
+			e.attrs = &fileAttrs{modTime: h.ModTime, mode: fs.FileMode(h.Mode).Perm()}
+			e.open = func() (io.ReadCloser, error) {
+				return io.NopCloser(tr), nil
+			}
+		default:
+			continue
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+}
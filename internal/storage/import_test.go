@@ -0,0 +1,238 @@
+package storage
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/notassigned/endershare/internal/database"
+)
+
+// archiveFile is an entry of a test archive: a directory if name ends in
+// "/", a symbolic link to link if that is set, and a file otherwise
+type archiveFile struct {
+	name string
+	body string
+	link string
+}
+
+// writeArchive builds a zip or tar archive of files in memory and writes it
+// to a temporary file, returning its path
+func writeArchive(t *testing.T, format string, files []archiveFile) string {
+	t.Helper()
+	var buf bytes.Buffer
+	modified := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	switch format {
+	case "zip":
+		zw := zip.NewWriter(&buf)
+		for _, f := range files {
+			h := &zip.FileHeader{Name: f.name, Modified: modified}
+			body := f.body
+			switch {
+			case f.name[len(f.name)-1] == '/':
+				h.SetMode(fs.ModeDir | 0755)
+			case f.link != "":
+				h.SetMode(fs.ModeSymlink | 0777)
+				body = f.link
+			default:
+				h.SetMode(0644)
+			}
+			w, err := zw.CreateHeader(h)
+			if err != nil {
+				t.Fatal(err)
+			}
+			io.WriteString(w, body)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+	case "tar":
+		tw := tar.NewWriter(&buf)
+		for _, f := range files {
+			h := &tar.Header{Name: f.name, Mode: 0644, ModTime: modified, Format: tar.FormatPAX}
+			switch {
+			case f.name[len(f.name)-1] == '/':
+				h.Typeflag, h.Mode = tar.TypeDir, 0755
+			case f.link != "":
+				h.Typeflag, h.Linkname = tar.TypeSymlink, f.link
+			default:
+				h.Typeflag, h.Size = tar.TypeReg, int64(len(f.body))
+			}
+			if err := tw.WriteHeader(h); err != nil {
+				t.Fatal(err)
+			}
+			io.WriteString(tw, f.body)
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	archive := filepath.Join(t.TempDir(), "archive."+format)
+	if err := os.WriteFile(archive, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return archive
+}
+
+// vaultTree returns the content of every file below folderID by path, with
+// "/" after folder names and "-> target" for links
+func vaultTree(t *testing.T, s *Storage, folderID FolderID) map[string]string {
+	t.Helper()
+	tree := make(map[string]string)
+	var walk func(FolderID, string)
+	walk = func(id FolderID, prefix string) {
+		entries, err := s.ListFolder(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range entries {
+			switch e := e.(type) {
+			case FileEntry:
+				var buf bytes.Buffer
+				if err := s.WriteFileTo(e.Name, id, &buf); err != nil {
+					t.Fatal(err)
+				}
+				if e.Symlink {
+					tree[prefix+e.Name] = "-> " + buf.String()
+				} else {
+					tree[prefix+e.Name] = buf.String()
+				}
+			case FolderEntry:
+				tree[prefix+e.Name+"/"] = ""
+				walk(e.FolderID, prefix+e.Name+"/")
+			}
+		}
+	}
+	walk(folderID, "")
+	return tree
+}
+
+func TestImportArchive(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		files    []archiveFile
+		failures int // Entries reported as not imported
+		replaced int // Entries replaced by a later one of the same name
+		want     map[string]string
+	}{
+		{
+			name:  "folders and files",
+			files: []archiveFile{{name: "docs/"}, {name: "docs/a.txt", body: "a"}, {name: "deep/er/b.txt", body: "b"}},
+			want:  map[string]string{"docs/": "", "docs/a.txt": "a", "deep/": "", "deep/er/": "", "deep/er/b.txt": "b"},
+		},
+		{
+			name:     "parent segments",
+			files:    []archiveFile{{name: "../escape.txt", body: "x"}, {name: "a/../../escape.txt", body: "x"}, {name: "ok.txt", body: "ok"}},
+			failures: 2,
+			want:     map[string]string{"ok.txt": "ok"},
+		},
+		{
+			name:     "absolute paths",
+			files:    []archiveFile{{name: "/etc/passwd", body: "x"}, {name: "ok.txt", body: "ok"}},
+			failures: 1,
+			want:     map[string]string{"ok.txt": "ok"},
+		},
+		{
+			name:     "drive letters",
+			files:    []archiveFile{{name: "C:/evil.txt", body: "x"}, {name: `C:\evil.txt`, body: "x"}, {name: `..\evil.txt`, body: "x"}, {name: "ok.txt", body: "ok"}},
+			failures: 3,
+			want:     map[string]string{"ok.txt": "ok"},
+		},
+		{
+			name:     "duplicate names",
+			files:    []archiveFile{{name: "dup.txt", body: "first"}, {name: "dup.txt", body: "second"}},
+			replaced: 1,
+			want:     map[string]string{"dup.txt": "second"},
+		},
+		{
+			name:  "symlinks",
+			files: []archiveFile{{name: "target.txt", body: "t"}, {name: "link", link: "target.txt"}, {name: "outside", link: "../../etc/passwd"}},
+			want:  map[string]string{"target.txt": "t", "link": "-> target.txt", "outside": "-> ../../etc/passwd"},
+		},
+	} {
+		for _, format := range []string{"zip", "tar"} {
+			t.Run(tc.name+"/"+format, func(t *testing.T) {
+				s := newTestStorage(t, make([]byte, 32), false)
+				dest, err := s.CreateFolder("dest", RootFolderID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				failures := 0
+				replaced, _, err := s.ImportArchive(writeArchive(t, format, tc.files), dest, func(p ImportProgress) {
+					if p.Err != nil {
+						failures++
+					}
+				})
+				if (err != nil) != (tc.failures > 0) || failures != tc.failures {
+					t.Errorf("import = %v with %d failures, want %d", err, failures, tc.failures)
+				}
+				if len(replaced) != tc.replaced {
+					t.Errorf("import replaced %d entries, want %d", len(replaced), tc.replaced)
+				}
+
+				got := vaultTree(t, s, dest)
+				for p, want := range tc.want {
+					if got[p] != want {
+						t.Errorf("%s = %q, want %q", p, got[p], want)
+					}
+				}
+				for p := range got {
+					if _, ok := tc.want[p]; !ok {
+						t.Errorf("unexpected entry %s", p)
+					}
+				}
+				// Nothing lands next to the destination folder
+				if root := vaultTree(t, s, RootFolderID); len(root) != len(got)+1 {
+					t.Errorf("root holds %d entries, want only dest and its %d", len(root), len(got))
+				}
+			})
+		}
+	}
+}
+
+// A process that dies part-way through an import leaves the journal behind,
+// and the next start undoes the import, restoring what it replaced
+func TestImportArchiveRollback(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "endershare.db")
+	db := database.Open(dbPath)
+	t.Cleanup(func() { db.Close() })
+	s := NewStorageIn(db, make([]byte, 32), filepath.Join(dir, "data"))
+	if _, _, err := s.AddFileFromReader(bytes.NewReader([]byte("before")), "kept.txt", RootFolderID); err != nil {
+		t.Fatal(err)
+	}
+
+	archive := writeArchive(t, "tar", []archiveFile{
+		{name: "kept.txt", body: "imported"},
+		{name: "new/one.txt", body: "1"},
+		{name: "new/two.txt", body: "2"},
+	})
+	crashed := filepath.Join(dir, "crashed.db")
+	if _, _, err := s.ImportArchive(archive, RootFolderID, func(p ImportProgress) {
+		// A snapshot taken part-way is the database a crash would leave
+		if p.Done == 2 {
+			if err := db.Backup(); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Rename(dbPath+".bak", crashed); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted := database.Open(crashed)
+	t.Cleanup(func() { restarted.Close() })
+	want := map[string]string{"kept.txt": "before"}
+	if got := vaultTree(t, NewStorageIn(restarted, make([]byte, 32), filepath.Join(dir, "data")), RootFolderID); !maps.Equal(got, want) {
+		t.Errorf("after recovery the vault holds %v, want %v", got, want)
+	}
+}
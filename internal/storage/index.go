@@ -0,0 +1,347 @@
+package storage
+
+import (
+	"cmp"
+	"encoding/json"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/notassigned/endershare/internal/crypto"
+	"github.com/notassigned/endershare/internal/database"
+)
+
+// indexEntry is a decrypted data entry with the fields needed to walk the tree
+type indexEntry struct {
+	data    database.DataEntry
+	typ     EntryType
+	name    string
+	id      FolderID // Folders only
+	parent  FolderID
+	file    FileEntry
+	folder  FolderEntry
+	trashed *time.Time
+	seq     uint64 // Insertion order, as the rows of the data table
+}
+
+// entryName identifies the entries called name in a folder
+type entryName struct {
+	parent FolderID
+	name   string
+}
+
+// metaIndex holds the decrypted metadata of every entry this node can read,
+// so lookups don't decrypt the whole data table. It is built on first use and
+// kept current by the database's data change feed, which also carries the
+// writes of sync and of other Storage instances on the same database. The
+// lists of every map are in insertion order.
+type metaIndex struct {
+	mu       sync.Mutex
+	loaded   bool
+	nextSeq  uint64
+	byKey    map[string]*indexEntry
+	byHash   map[string]*indexEntry
+	byName   map[entryName][]*indexEntry
+	children map[FolderID][]*indexEntry
+	folders  map[FolderID][]*indexEntry // Keyed by the folder's own ID
+}
+
+func (ix *metaIndex) reset() {
+	ix.loaded = false
+	ix.byKey, ix.byHash, ix.byName, ix.children, ix.folders = nil, nil, nil, nil, nil
+}
+
+func (ix *metaIndex) add(e indexEntry) {
+	ix.remove(e.data.Key)
+	ix.nextSeq++
+	e.seq = ix.nextSeq
+	p := &e
+	ix.byKey[string(e.data.Key)] = p
+	ix.byHash[string(e.data.Hash)] = p
+	name := entryName{e.parent, e.name}
+	ix.byName[name] = append(ix.byName[name], p)
+	ix.children[e.parent] = append(ix.children[e.parent], p)
+	if e.typ == TypeFolder {
+		ix.folders[e.id] = append(ix.folders[e.id], p)
+	}
+}
+
+func (ix *metaIndex) remove(key []byte) {
+	p, ok := ix.byKey[string(key)]
+	if !ok {
+		return
+	}
+	delete(ix.byKey, string(key))
+	if ix.byHash[string(p.data.Hash)] == p {
+		delete(ix.byHash, string(p.data.Hash))
+	}
+	removeFrom(ix.byName, entryName{p.parent, p.name}, p)
+	removeFrom(ix.children, p.parent, p)
+	if p.typ == TypeFolder {
+		removeFrom(ix.folders, p.id, p)
+	}
+}
+
+func removeFrom[K comparable](m map[K][]*indexEntry, k K, p *indexEntry) {
+	if m[k] = slices.DeleteFunc(m[k], func(e *indexEntry) bool { return e == p }); len(m[k]) == 0 {
+		delete(m, k)
+	}
+}
+
+// withIndex runs fn with the index loaded and locked. fn must not write to
+// the database, the change feed would wait for the lock.
+func (s *Storage) withIndex(fn func(ix *metaIndex)) error {
+	ix := &s.index
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if !ix.loaded {
+		ix.byKey = make(map[string]*indexEntry)
+		ix.byHash = make(map[string]*indexEntry)
+		ix.byName = make(map[entryName][]*indexEntry)
+		ix.children = make(map[FolderID][]*indexEntry)
+		ix.folders = make(map[FolderID][]*indexEntry)
+		err := s.db.ForEachData(func(entry database.DataEntry) error {
+			if e, ok := s.decodeEntry(entry); ok {
+				ix.add(e)
+			}
+			return nil
+		})
+		if err != nil {
+			ix.reset()
+			return err
+		}
+		ix.loaded = true
+	}
+	fn(ix)
+	return nil
+}
+
+// applyDataChange keeps a loaded index in step with the data table
+func (s *Storage) applyDataChange(change database.DataChange) {
+	ix := &s.index
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if !ix.loaded {
+		return
+	}
+	s.applyChangeLocked(change)
+}
+
+// applyChangeLocked applies a data change to the loaded index. A batch goes
+// in under one lock, so lookups never see part of it.
+func (s *Storage) applyChangeLocked(change database.DataChange) {
+	ix := &s.index
+	switch {
+	case change.Reset:
+		ix.reset()
+	case change.Put != nil:
+		if e, ok := s.decodeEntry(*change.Put); ok {
+			ix.add(e)
+		} else {
+			ix.remove(change.Put.Key)
+		}
+	case change.Deleted != nil:
+		ix.remove(change.Deleted)
+	case change.Batch != nil:
+		for _, c := range change.Batch {
+			s.applyChangeLocked(c)
+		}
+	}
+}
+
+// loadIndex returns every entry this node can read, in insertion order.
+// The entries are copies and may be modified. Copying the whole index is
+// for listings and exports; single entries are found with the lookup helpers.
+func (s *Storage) loadIndex() ([]indexEntry, error) {
+	var index []indexEntry
+	err := s.withIndex(func(ix *metaIndex) {
+		index = make([]indexEntry, 0, len(ix.byKey))
+		for _, e := range ix.byKey {
+			index = append(index, *e)
+		}
+	})
+	slices.SortFunc(index, func(a, b indexEntry) int { return cmp.Compare(a.seq, b.seq) })
+	return index, err
+}
+
+// lookupName returns the first entry of type typ called name in folder that
+// is not in the trash itself
+func (s *Storage) lookupName(typ EntryType, name string, folder FolderID) (indexEntry, bool, error) {
+	var found indexEntry
+	var ok bool
+	err := s.withIndex(func(ix *metaIndex) {
+		for _, e := range ix.byName[entryName{folder, name}] {
+			if e.typ == typ && e.trashed == nil {
+				found, ok = *e, true
+				return
+			}
+		}
+	})
+	return found, ok, err
+}
+
+// lookupFolder returns the entry of a folder by ID, trashed or not
+func (s *Storage) lookupFolder(folderID FolderID) (indexEntry, bool, error) {
+	var found indexEntry
+	var ok bool
+	err := s.withIndex(func(ix *metaIndex) {
+		if list := ix.folders[folderID]; len(list) > 0 {
+			found, ok = *list[0], true
+		}
+	})
+	return found, ok, err
+}
+
+// lookupFolders returns every entry of a folder by ID, trashed or not, in
+// insertion order. A folder has more than one after a crash between the two
+// writes of replaceEntry.
+func (s *Storage) lookupFolders(folderID FolderID) ([]indexEntry, error) {
+	var found []indexEntry
+	err := s.withIndex(func(ix *metaIndex) {
+		for _, e := range ix.folders[folderID] {
+			found = append(found, *e)
+		}
+	})
+	return found, err
+}
+
+// lookupHash returns the entry with a data hash, as ListTrash and
+// FindOrphans identify entries
+func (s *Storage) lookupHash(hash []byte) (indexEntry, bool, error) {
+	var found indexEntry
+	var ok bool
+	err := s.withIndex(func(ix *metaIndex) {
+		if e, exists := ix.byHash[string(hash)]; exists {
+			found, ok = *e, true
+		}
+	})
+	return found, ok, err
+}
+
+// lookupChildren returns the entries whose parent is folder, trashed or not
+func (s *Storage) lookupChildren(folder FolderID) ([]indexEntry, error) {
+	var children []indexEntry
+	err := s.withIndex(func(ix *metaIndex) {
+		list := ix.children[folder]
+		children = make([]indexEntry, len(list))
+		for i, e := range list {
+			children[i] = *e
+		}
+	})
+	return children, err
+}
+
+// decodeEntry decrypts the metadata of a data entry. Entries encrypted with
+// another key, or whose metadata is neither a file nor a folder, are skipped.
+func (s *Storage) decodeEntry(entry database.DataEntry) (indexEntry, bool) {
+	decryptedKey, err := crypto.Decrypt(entry.Key, s.aesKey)
+	if err != nil {
+		return indexEntry{}, false
+	}
+
+	var fileEntry FileEntry
+	if err := json.Unmarshal(decryptedKey, &fileEntry); err == nil && fileEntry.Type == TypeFile {
+		return indexEntry{data: entry, typ: TypeFile, name: fileEntry.Name, parent: fileEntry.FolderID, file: fileEntry, trashed: fileEntry.TrashedAt}, true
+	}
+
+	var folderEntry FolderEntry
+	if err := json.Unmarshal(decryptedKey, &folderEntry); err == nil && folderEntry.Type == TypeFolder {
+		return indexEntry{data: entry, typ: TypeFolder, name: folderEntry.Name, id: folderEntry.FolderID, parent: folderEntry.ParentFolderID, folder: folderEntry, trashed: folderEntry.TrashedAt}, true
+	}
+	return indexEntry{}, false
+}
+
+// replaceEntry stores new metadata for an entry in place of the old one. The
+// encrypted key changes, so the old entry is returned for a DELETE update and
+// the new one for an ADD update. Download progress of the blob is kept.
+func (s *Storage) replaceEntry(old database.DataEntry, metadata any, folderID FolderID) (removed, added *database.DataEntry, err error) {
+	put, err := s.encodeReplacement(old, metadata, folderID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The new row starts without progress, copy it over from the old one
+	var progress int64
+	if old.Value != nil {
+		progress = s.db.GetDownloadProgress(old.Value)
+	}
+
+	// Insert before deleting so a crash leaves a duplicate rather than nothing
+	if err := s.db.PutDataWithTag(put.Entry.Key, old.Value, old.Size, put.Entry.Hash, old.KeyEpoch, put.FolderTag); err != nil {
+		return nil, nil, err
+	}
+	if progress > 0 {
+		if err := s.db.SetDownloadProgress(old.Value, progress); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := s.db.DeleteData(old.Key); err != nil {
+		return nil, nil, err
+	}
+
+	return &old, &put.Entry, nil
+}
+
+// encodeReplacement encrypts new metadata for an entry into the row that
+// replaces it, keeping the entry's blob and key epoch
+func (s *Storage) encodeReplacement(old database.DataEntry, metadata any, folderID FolderID) (database.DataPut, error) {
+	keyJSON, err := json.Marshal(metadata)
+	if err != nil {
+		return database.DataPut{}, err
+	}
+	encryptedKey, err := crypto.Encrypt(keyJSON, s.aesKey)
+	if err != nil {
+		return database.DataPut{}, err
+	}
+	return database.DataPut{
+		Entry: database.DataEntry{
+			Key:      encryptedKey,
+			Value:    old.Value,
+			Size:     old.Size,
+			Hash:     crypto.ComputeDataHash(encryptedKey, old.Value, old.Size),
+			KeyEpoch: old.KeyEpoch,
+		},
+		FolderTag: computeFolderTag(folderID, s.aesKey),
+	}, nil
+}
+
+// hiddenFolders returns the folders that are in the trash, directly or
+// because a folder above them is
+func hiddenFolders(index []indexEntry) map[FolderID]bool {
+	parents := make(map[FolderID]FolderID)
+	hidden := make(map[FolderID]bool)
+	for _, e := range index {
+		if e.typ == TypeFolder {
+			parents[e.id] = e.parent
+			if e.trashed != nil {
+				hidden[e.id] = true
+			}
+		}
+	}
+	for id := range parents {
+		// The step bound guards against parent cycles in corrupt indexes
+		for p, steps := id, 0; !p.IsRoot() && steps <= len(parents); p, steps = parents[p], steps+1 {
+			if hidden[p] {
+				hidden[id] = true
+				break
+			}
+		}
+	}
+	return hidden
+}
+
+// Stats returns the number of files and folders and the total original file size
+func (s *Storage) Stats() (files, folders, logicalBytes int64, err error) {
+	err = s.withIndex(func(ix *metaIndex) {
+		for _, e := range ix.byKey {
+			switch e.typ {
+			case TypeFile:
+				files++
+				logicalBytes += e.file.Size
+			case TypeFolder:
+				folders++
+			}
+		}
+	})
+	return files, folders, logicalBytes, err
+}
@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIndexLookups(t *testing.T) {
+	s := newTestStorage(t, make([]byte, 32), false)
+	outer, err := s.CreateFolder("outer", RootFolderID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner, err := s.CreateFolder("inner", outer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.AddFileFromReader(strings.NewReader("content"), "note.txt", inner); err != nil {
+		t.Fatal(err)
+	}
+	if files, folders, _, err := s.Stats(); err != nil || files != 1 || folders != 2 {
+		t.Fatalf("Stats = %d files, %d folders, %v; want 1, 2", files, folders, err)
+	}
+
+	// Trashing a folder hides the folders below it until it is restored
+	removed, added, err := s.TrashFolder(outer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := s.lookupHash(removed.Hash); ok {
+		t.Error("replaced entry is still found by its hash")
+	}
+	if live, err := s.liveFolder(inner); err != nil || live {
+		t.Errorf("liveFolder below a trashed folder = %v, %v; want false", live, err)
+	}
+	if _, _, err := s.TrashFolder(outer); err == nil {
+		t.Error("folder in the trash was trashed again")
+	}
+	if _, _, err := s.RestoreFromTrash(added.Hash); err != nil {
+		t.Fatal(err)
+	}
+	if live, err := s.liveFolder(inner); err != nil || !live {
+		t.Errorf("liveFolder after restore = %v, %v; want true", live, err)
+	}
+
+	// Folder trees are deleted children first
+	deleted, err := s.DeleteFolderTree(outer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range deleted {
+		e, ok := s.decodeEntry(*entry)
+		if !ok {
+			t.Fatal("deleted entry does not decode")
+		}
+		names = append(names, e.name)
+	}
+	if got := strings.Join(names, ","); got != "note.txt,inner,outer" {
+		t.Errorf("DeleteFolderTree deleted %s, want note.txt,inner,outer", got)
+	}
+	if files, folders, _, err := s.Stats(); err != nil || files != 0 || folders != 0 {
+		t.Errorf("Stats after delete = %d files, %d folders, %v; want 0, 0", files, folders, err)
+	}
+}
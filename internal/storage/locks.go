@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/notassigned/endershare/internal/database"
+)
+
+// ErrFileLocked is returned when locking or unlocking a file another device
+// has checked out
+var ErrFileLocked = errors.New("file is checked out on another device")
+
+// maxLockLabelLen bounds the device name stored with a lock
+const maxLockLabelLen = 64
+
+// FileLock marks a file as checked out for editing on one device. Locks live
+// in the encrypted metadata, so they reach every device like tags do. They
+// are advisory: other devices are shown the lock, nothing is refused.
+type FileLock struct {
+	Holder   string    `json:"holder"`          // Peer ID of the device editing the file
+	Label    string    `json:"label,omitempty"` // Name of that device, shown to the others
+	LockedAt time.Time `json:"lockedAt"`
+}
+
+// HeldBy reports whether the lock belongs to the device with peerID
+func (l *FileLock) HeldBy(peerID string) bool {
+	return l != nil && l.Holder == peerID
+}
+
+// Who names the device holding the lock, its peer ID if it has no name
+func (l *FileLock) Who() string {
+	if l.Label != "" {
+		return l.Label
+	}
+	return l.Holder
+}
+
+// LockFile checks a file out for the device holder, named label. Taking a
+// lock the device already holds changes nothing and both entries are nil; a
+// lock held by another device is refused with ErrFileLocked. The entries are
+// published like those of TagFile.
+func (s *Storage) LockFile(name string, folderID FolderID, holder, label string) (removed, added *database.DataEntry, err error) {
+	if holder == "" {
+		return nil, nil, fmt.Errorf("a lock needs the device holding it")
+	}
+	label = strings.TrimSpace(label)
+	if len(label) > maxLockLabelLen || !utf8.ValidString(label) {
+		return nil, nil, fmt.Errorf("%w: device names on locks are limited to %d bytes", ErrInvalidName, maxLockLabelLen)
+	}
+	entry, fileEntry, err := s.findFile(name, folderID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if fileEntry.Lock.HeldBy(holder) {
+		return nil, nil, nil
+	}
+	if fileEntry.Lock != nil {
+		return nil, nil, fmt.Errorf("%w: %s by %s", ErrFileLocked, name, fileEntry.Lock.Who())
+	}
+	fileEntry.Lock = &FileLock{Holder: holder, Label: label, LockedAt: time.Now().UTC()}
+	return s.replaceEntry(*entry, fileEntry, folderID)
+}
+
+// UnlockFile releases the lock on a file. Only the device holding it may
+// release it unless force is set, for a device that is lost or gone. Both
+// entries are nil if the file isn't locked.
+func (s *Storage) UnlockFile(name string, folderID FolderID, holder string, force bool) (removed, added *database.DataEntry, err error) {
+	entry, fileEntry, err := s.findFile(name, folderID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if fileEntry.Lock == nil {
+		return nil, nil, nil
+	}
+	if !force && !fileEntry.Lock.HeldBy(holder) {
+		return nil, nil, fmt.Errorf("%w: %s by %s", ErrFileLocked, name, fileEntry.Lock.Who())
+	}
+	fileEntry.Lock = nil
+	return s.replaceEntry(*entry, fileEntry, folderID)
+}
+
+// GetLock returns the lock on a file, nil if it isn't checked out
+func (s *Storage) GetLock(name string, folderID FolderID) (*FileLock, error) {
+	_, fileEntry, err := s.findFile(name, folderID)
+	if err != nil {
+		return nil, err
+	}
+	return fileEntry.Lock, nil
+}
+
+// LockedFile is a file that is checked out
+type LockedFile struct {
+	Name     string
+	FolderID FolderID
+	Lock     FileLock
+}
+
+// ListLocks returns the files that are checked out, oldest lock first.
+// Trashed files are left out.
+func (s *Storage) ListLocks() ([]LockedFile, error) {
+	var locked []LockedFile
+	err := s.withIndex(func(ix *metaIndex) {
+		for _, e := range ix.byKey {
+			if e.typ == TypeFile && e.trashed == nil && e.file.Lock != nil {
+				locked = append(locked, LockedFile{Name: e.name, FolderID: e.parent, Lock: *e.file.Lock})
+			}
+		}
+	})
+	slices.SortFunc(locked, func(a, b LockedFile) int {
+		return a.Lock.LockedAt.Compare(b.Lock.LockedAt)
+	})
+	return locked, err
+}
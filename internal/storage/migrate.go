@@ -0,0 +1,154 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/notassigned/endershare/internal/database"
+	"lukechampine.com/blake3"
+)
+
+// Migration stages reported to MigrateStorage's progress callback
+const (
+	MigrateCopy     = "copy"     // Placing the blobs in the new data directory
+	MigrateVerify   = "verify"   // Re-hashing the placed blobs
+	MigrateDatabase = "database" // Copying and checking the database
+)
+
+// MigrateProgress reports how far MigrateStorage is through a stage
+type MigrateProgress struct {
+	Stage string
+	Done  int
+	Total int
+}
+
+// MigrateStorage moves every blob and the database to dir, as dir/data and
+// dir/endershare.db. Blobs are hard linked where the filesystem allows and
+// copied otherwise, and every copy is re-hashed. The database is copied and
+// checked against the original. The configured paths only switch once both
+// are verified, and the old copies are removed after that, so an interrupted
+// migration leaves the vault where it was and can be run again. No node may
+// have the vault open meanwhile. db is closed once the paths switched, open
+// the moved database with database.Create. The number of blobs moved is
+// returned.
+func MigrateStorage(db *database.EndershareDB, dir string, progress func(MigrateProgress)) (int, error) {
+	if progress == nil {
+		progress = func(MigrateProgress) {}
+	}
+	newDBPath, err := filepath.Abs(filepath.Join(dir, "endershare.db"))
+	if err != nil {
+		return 0, err
+	}
+	newDataDir := filepath.Join(filepath.Dir(newDBPath), "data")
+	oldDBPath := db.Path()
+	oldDataDir := DataDir(db)
+	if oldAbs, err := filepath.Abs(oldDBPath); err == nil && oldAbs == newDBPath {
+		return 0, fmt.Errorf("the vault is already stored in %s", dir)
+	}
+
+	// A data directory already in place is kept, only the database moves
+	oldDataAbs, err := filepath.Abs(oldDataDir)
+	if err != nil {
+		return 0, err
+	}
+	var blobs []string
+	if oldDataAbs != newDataDir {
+		if err := checkDataDir(oldDataDir, newDataDir); err != nil {
+			return 0, err
+		}
+		if blobs, err = listBlobs(oldDataDir); err != nil {
+			return 0, err
+		}
+		for i, name := range blobs {
+			if err := placeBlob(filepath.Join(oldDataDir, name), filepath.Join(newDataDir, name)); err != nil {
+				return 0, fmt.Errorf("blob %s: %w", name, err)
+			}
+			progress(MigrateProgress{Stage: MigrateCopy, Done: i + 1, Total: len(blobs)})
+		}
+		if err := syncDir(newDataDir); err != nil {
+			return 0, err
+		}
+		for i, name := range blobs {
+			if err := verifyPlacedBlob(filepath.Join(oldDataDir, name), filepath.Join(newDataDir, name)); err != nil {
+				return 0, fmt.Errorf("blob %s: %w", name, err)
+			}
+			progress(MigrateProgress{Stage: MigrateVerify, Done: i + 1, Total: len(blobs)})
+		}
+	}
+
+	progress(MigrateProgress{Stage: MigrateDatabase, Done: 0, Total: 1})
+	if err := db.CopyTo(newDBPath, map[string]string{"data_dir": newDataDir}); err != nil {
+		return 0, err
+	}
+	progress(MigrateProgress{Stage: MigrateDatabase, Done: 1, Total: 1})
+	if err := database.SetPath(newDBPath); err != nil {
+		database.Remove(newDBPath)
+		return 0, err
+	}
+
+	// The vault is reachable through the new paths now
+	db.Close()
+	if err := database.Remove(oldDBPath); err != nil {
+		fmt.Println("Warning: Failed to remove old database:", err)
+	}
+	for _, name := range blobs {
+		if err := os.Remove(filepath.Join(oldDataDir, name)); err != nil && !os.IsNotExist(err) {
+			fmt.Println("Warning: Failed to remove old blob:", err)
+		}
+	}
+	if len(blobs) > 0 {
+		// Only succeed if nothing else was kept there
+		os.Remove(filepath.Join(oldDataDir, "tmp"))
+		os.Remove(oldDataDir)
+	}
+	return len(blobs), nil
+}
+
+// verifyPlacedBlob checks that the blob at dst holds what src does. A
+// complete blob matches its name, the hash of its content; a partial
+// download or a blob already corrupt at src must match src.
+func verifyPlacedBlob(src, dst string) error {
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	dstInfo, err := os.Stat(dst)
+	if err != nil {
+		return err
+	}
+	if os.SameFile(srcInfo, dstInfo) {
+		return nil
+	}
+	dstHash, err := hashBlobFile(dst)
+	if err != nil {
+		return err
+	}
+	if hexEncode(dstHash) == filepath.Base(dst) {
+		return nil
+	}
+	srcHash, err := hashBlobFile(src)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(srcHash, dstHash) {
+		os.Remove(dst)
+		return fmt.Errorf("%w: copy does not match the original", ErrBlobCorrupted)
+	}
+	return nil
+}
+
+func hashBlobFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	hasher := blake3.New(32, nil)
+	if _, err := io.Copy(hasher, f); err != nil {
+		return nil, err
+	}
+	return hasher.Sum(nil), nil
+}
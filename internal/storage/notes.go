@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/notassigned/endershare/internal/crypto"
+	"github.com/notassigned/endershare/internal/database"
+)
+
+// maxNoteLen bounds the length of a note in bytes. Notes live in the
+// metadata of every entry row, which sync sends whole.
+const maxNoteLen = 16 << 10
+
+// SetNote replaces the note of a file, or removes it when note is blank.
+// Notes live in the encrypted metadata like tags, see TagFile; both entries
+// are nil when the note stays the same.
+func (s *Storage) SetNote(name string, folderID FolderID, note string) (removed, added *database.DataEntry, err error) {
+	note = strings.TrimSpace(note)
+	if len(note) > maxNoteLen || !utf8.ValidString(note) {
+		return nil, nil, fmt.Errorf("%w: notes are limited to %d bytes of text", ErrInvalidName, maxNoteLen)
+	}
+	entry, fileEntry, err := s.findFile(name, folderID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if fileEntry.Note == note {
+		return nil, nil, nil
+	}
+	fileEntry.Note = note
+	return s.replaceEntry(*entry, fileEntry, folderID)
+}
+
+// GetNote returns the note of a file, empty if it has none
+func (s *Storage) GetNote(name string, folderID FolderID) (string, error) {
+	_, fileEntry, err := s.findFile(name, folderID)
+	if err != nil {
+		return "", err
+	}
+	return fileEntry.Note, nil
+}
+
+// maxChangeNoteLen bounds a change note in bytes. Change notes travel in
+// the signed update of the change, which is gossiped whole.
+const maxChangeNoteLen = 1 << 10
+
+// SealChangeNote encrypts a note describing a change, such as "replaced with
+// signed copy", to be carried in the update that publishes it. A blank note
+// seals to nil. Like entry keys it is encrypted with the vault key, so
+// replicas without it can't read the note.
+func (s *Storage) SealChangeNote(note string) ([]byte, error) {
+	note = strings.TrimSpace(note)
+	if note == "" {
+		return nil, nil
+	}
+	if len(note) > maxChangeNoteLen || !utf8.ValidString(note) {
+		return nil, fmt.Errorf("%w: change notes are limited to %d bytes of text", ErrInvalidName, maxChangeNoteLen)
+	}
+	return crypto.Encrypt([]byte(note), s.aesKey)
+}
+
+// OpenChangeNote decrypts a note sealed with SealChangeNote
+func (s *Storage) OpenChangeNote(sealed []byte) (string, error) {
+	note, err := crypto.Decrypt(sealed, s.aesKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt change note: %w", err)
+	}
+	return string(note), nil
+}
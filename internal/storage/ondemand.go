@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/notassigned/endershare/internal/database"
+)
+
+// ErrNotLocal is returned when reading a file whose content isn't stored on
+// this node and can't be fetched
+var ErrNotLocal = errors.New("file content is not stored on this node")
+
+// BlobFetcher downloads a blob of size encrypted bytes that isn't stored
+// locally, returning once it is complete and verified
+type BlobFetcher func(blobHash []byte, size int64) error
+
+// SetBlobFetcher sets how the blob of a placeholder, a file whose metadata is
+// synced but whose content isn't stored locally, is fetched when the file is
+// read. Without a fetcher reading a placeholder fails with ErrNotLocal.
+func (s *Storage) SetBlobFetcher(fetch BlobFetcher) {
+	s.fetch = fetch
+}
+
+// hydrate makes sure the blob of a file entry is stored locally, fetching it
+// first, from cold storage or else from peers, if the entry is a placeholder
+func (s *Storage) hydrate(entry *database.DataEntry) error {
+	if entry.Value == nil || s.blobLocal(entry.Value, entry.Size) {
+		return nil
+	}
+	var archive *ArchiveInfo
+	s.withIndex(func(ix *metaIndex) {
+		if e, ok := ix.byKey[string(entry.Key)]; ok {
+			archive = e.file.Archive
+		}
+	})
+	if archive != nil {
+		return fmt.Errorf("%w on %s", ErrArchived, archive.Location)
+	}
+	if cold, err := s.fetchColdBlob(entry.Value); cold {
+		if err == nil {
+			return nil
+		}
+		if s.fetch == nil {
+			return fmt.Errorf("%w: %w", ErrNotLocal, err)
+		}
+		fmt.Println("Warning: Fetching from cold storage failed, trying peers:", err)
+	}
+	if s.fetch == nil {
+		return ErrNotLocal
+	}
+	if err := s.fetch(entry.Value, entry.Size); err != nil {
+		return fmt.Errorf("%w: %w", ErrNotLocal, err)
+	}
+	return nil
+}
+
+// blobLocal reports whether a blob is completely stored on this node
+func (s *Storage) blobLocal(blobHash []byte, size int64) bool {
+	return s.db.GetDownloadProgress(blobHash) >= size
+}
+
+// IsLocal reports whether the content of a file is stored on this node, as
+// opposed to a placeholder that is fetched on first access
+func (s *Storage) IsLocal(name string, folderID FolderID) bool {
+	entry, _, err := s.findFile(name, folderID)
+	return err == nil && s.blobLocal(entry.Value, entry.Size)
+}
+
+// EvictFile removes the local copy of a file's content and returns the bytes
+// freed. The file stays listed as a placeholder and is fetched again when it
+// is next read. Other entries sharing the blob become placeholders too.
+// Pinned files are refused with ErrPinned.
+func (s *Storage) EvictFile(name string, folderID FolderID) (int64, error) {
+	entry, _, err := s.findFile(name, folderID)
+	if err != nil {
+		return 0, err
+	}
+	if s.IsPinned(name, folderID) {
+		return 0, fmt.Errorf("%w, unpin it to free its space: %s", ErrPinned, name)
+	}
+	return s.EvictBlob(entry.Value, entry.Size)
+}
+
+// EvictBlob removes the local copy of a blob of size encrypted bytes and
+// returns the bytes freed. Every entry sharing it becomes a placeholder.
+func (s *Storage) EvictBlob(blobHash []byte, size int64) (int64, error) {
+	if !s.blobLocal(blobHash, size) {
+		return 0, nil
+	}
+	// The blob goes first: a crash in between leaves a missing blob marked
+	// complete, which the next scrub repairs, rather than a stray one
+	if err := os.Remove(filepath.Join(s.dataDir, hexEncode(blobHash))); err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+	if err := s.db.SetDownloadProgress(blobHash, 0); err != nil {
+		return 0, err
+	}
+	return size, nil
+}
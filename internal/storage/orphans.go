@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/notassigned/endershare/internal/database"
+)
+
+// ErrFolderNotEmpty is returned when deleting a single folder entry would
+// leave its children pointing at a parent that no longer exists
+var ErrFolderNotEmpty = errors.New("folder is not empty")
+
+// Orphan is an entry whose parent folder does not exist, so it can't be
+// reached by browsing from the root
+type Orphan struct {
+	Hash          []byte
+	Type          EntryType
+	Name          string
+	MissingParent FolderID
+	Size          int64 // Original size for files
+}
+
+// FindOrphans returns entries whose parent folder is missing. Children of an
+// orphaned folder are not listed; reattaching the folder restores them.
+func (s *Storage) FindOrphans() ([]Orphan, error) {
+	index, err := s.loadIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	folders := make(map[FolderID]bool)
+	for _, e := range index {
+		if e.typ == TypeFolder {
+			folders[e.id] = true
+		}
+	}
+
+	var orphans []Orphan
+	for _, e := range index {
+		if e.parent.IsRoot() || e.parent == ReleaseFolderID || folders[e.parent] {
+			continue
+		}
+		orphans = append(orphans, Orphan{
+			Hash:          e.data.Hash,
+			Type:          e.typ,
+			Name:          e.name,
+			MissingParent: e.parent,
+			Size:          e.file.Size,
+		})
+	}
+	return orphans, nil
+}
+
+// ReattachOrphan moves an orphaned entry to the root folder, under a numbered
+// name if its own is taken there and rename-duplicates is on. The entry's
+// encrypted key changes, so the old entry is returned for a DELETE update
+// and the new one for an ADD update.
+func (s *Storage) ReattachOrphan(hash []byte) (removed, added *database.DataEntry, err error) {
+	orphan, err := s.findOrphan(hash)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	name, err := s.claimName(orphan.typ, orphan.name, RootFolderID)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch orphan.typ {
+	case TypeFile:
+		orphan.file.FolderID = RootFolderID
+		orphan.file.Name = name
+		return s.replaceEntry(orphan.data, orphan.file, RootFolderID)
+	default:
+		orphan.folder.ParentFolderID = RootFolderID
+		orphan.folder.Name = name
+		return s.replaceEntry(orphan.data, orphan.folder, RootFolderID)
+	}
+}
+
+// PurgeOrphan deletes an orphaned entry and, for folders, everything under it.
+// The deleted entries are returned for publishing.
+func (s *Storage) PurgeOrphan(hash []byte) ([]*database.DataEntry, error) {
+	orphan, err := s.findOrphan(hash)
+	if err != nil {
+		return nil, err
+	}
+	if orphan.typ == TypeFolder {
+		return s.DeleteFolderTree(orphan.id)
+	}
+	if err := s.db.DeleteData(orphan.data.Key); err != nil {
+		return nil, err
+	}
+	return []*database.DataEntry{&orphan.data}, nil
+}
+
+func (s *Storage) findOrphan(hash []byte) (*indexEntry, error) {
+	e, ok, err := s.lookupHash(hash)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("orphan %w", ErrNotFound)
+	}
+	if !e.parent.IsRoot() && e.parent != ReleaseFolderID {
+		_, hasParent, err := s.lookupFolder(e.parent)
+		if err != nil {
+			return nil, err
+		}
+		if !hasParent {
+			return &e, nil
+		}
+	}
+	return nil, fmt.Errorf("entry %s is not orphaned", e.name)
+}
+
+// DeleteFolderTree removes a folder together with all files and folders
+// beneath it. Entries are deleted children first and returned in that order
+// so each published DELETE leaves the tree consistent.
+func (s *Storage) DeleteFolderTree(folderID FolderID) ([]*database.DataEntry, error) {
+	root, ok, err := s.lookupFolder(folderID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("folder %w: %s", ErrNotFound, folderID)
+	}
+	// Each folder comes before its contents, so deleting from the end goes
+	// children first
+	below, err := s.descendants(folderID)
+	if err != nil {
+		return nil, err
+	}
+
+	order := append([]indexEntry{root}, below...)
+	deleted := make([]*database.DataEntry, 0, len(order))
+	for i := len(order) - 1; i >= 0; i-- {
+		if err := s.db.DeleteData(order[i].data.Key); err != nil {
+			return deleted, err
+		}
+		deleted = append(deleted, &order[i].data)
+	}
+	return deleted, nil
+}
+
+// hasChildren reports whether any entry lists folderID as its parent
+func (s *Storage) hasChildren(folderID FolderID) (bool, error) {
+	var nonEmpty bool
+	err := s.withIndex(func(ix *metaIndex) {
+		nonEmpty = len(ix.children[folderID]) > 0
+	})
+	return nonEmpty, err
+}
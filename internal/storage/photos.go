@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"io"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/notassigned/endershare/internal/database"
+)
+
+// PhotoFile is a file with camera metadata in the by-date view
+type PhotoFile struct {
+	Name     string
+	FolderID FolderID
+	Size     int64
+	Photo    PhotoInfo
+}
+
+// PhotoMonth groups the photos captured in one month, newest first
+type PhotoMonth struct {
+	Year   int
+	Month  time.Month
+	Photos []PhotoFile
+}
+
+// ImportFile adds a local file and applies the import rules, see
+// ImportFromReader. Unless progress is nil it is called with the bytes read
+// out of the file's size as they are encrypted, about once per percent.
+func (s *Storage) ImportFile(localPath string, name string, folderID FolderID, progress func(done, total int64)) (replaced *database.DataEntry, added []*database.DataEntry, err error) {
+	srcFile, err := os.Open(longPath(localPath))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer srcFile.Close()
+
+	attrs := statAttrs(srcFile)
+	var r io.Reader = srcFile
+	if progress != nil {
+		var size int64
+		if info, err := srcFile.Stat(); err == nil {
+			size = info.Size()
+		}
+		r = newProgressReader(srcFile, size, progress)
+	}
+	return s.importFile(r, name, folderID, attrs)
+}
+
+// ImportFromReader adds a file like AddFileFromReader and applies the import
+// rules: with photo sorting on, an image with a capture date goes into
+// Year/Month folders below folderID, created as needed. It returns every new
+// entry for publishing, folders before the file, and the entry of a file the
+// import replaced with a new version.
+func (s *Storage) ImportFromReader(r io.Reader, name string, folderID FolderID) (replaced *database.DataEntry, added []*database.DataEntry, err error) {
+	return s.importFile(r, name, folderID, nil)
+}
+
+func (s *Storage) importFile(r io.Reader, name string, folderID FolderID, attrs *fileAttrs) (replaced *database.DataEntry, added []*database.DataEntry, err error) {
+	photo, r := peekPhotoInfo(r)
+
+	if photo != nil && s.db.GetSortPhotos() && !s.IsDropBox(folderID) {
+		dateFolder, created, err := s.dateFolder(folderID, photo.CapturedAt)
+		added = append(added, created...)
+		if err != nil {
+			return nil, added, err
+		}
+		folderID = dateFolder
+	}
+
+	replaced, entry, err := s.addFile(r, name, folderID, photo, attrs)
+	if entry != nil {
+		added = append(added, entry)
+	}
+	return replaced, added, err
+}
+
+// dateFolder returns the Year/Month folder below parent for t, creating the
+// folders that don't exist yet
+func (s *Storage) dateFolder(parent FolderID, t time.Time) (FolderID, []*database.DataEntry, error) {
+	var created []*database.DataEntry
+	folderID := parent
+	for _, name := range []string{t.Format("2006"), t.Format("01")} {
+		child, err := s.findChildFolder(folderID, name)
+		if err != nil {
+			return "", created, err
+		}
+		if child == "" {
+			var entry *database.DataEntry
+			child, entry, err = s.CreateFolderWithEntry(name, folderID)
+			if err != nil {
+				return "", created, err
+			}
+			created = append(created, entry)
+		}
+		folderID = child
+	}
+	return folderID, created, nil
+}
+
+// ChildFolder returns the folder called name in parent, creating it if there
+// is none. created is the entry of a new folder, nil if it existed.
+func (s *Storage) ChildFolder(parent FolderID, name string) (folderID FolderID, created *database.DataEntry, err error) {
+	if folderID, err = s.findChildFolder(parent, name); err != nil || folderID != "" {
+		return folderID, nil, err
+	}
+	return s.CreateFolderWithEntry(name, parent)
+}
+
+// findChildFolder returns the ID of the folder called name in parent, "" if there is none
+func (s *Storage) findChildFolder(parent FolderID, name string) (FolderID, error) {
+	e, ok, err := s.lookupName(TypeFolder, name, parent)
+	if !ok {
+		return "", err
+	}
+	return e.id, nil
+}
+
+// PhotosByDate groups every file with a capture date by month, newest first.
+// It is a virtual view; files stay in their folders.
+func (s *Storage) PhotosByDate() ([]PhotoMonth, error) {
+	index, err := s.loadIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	hidden := hiddenFolders(index)
+	var photos []PhotoFile
+	for _, e := range index {
+		if e.typ == TypeFile && e.file.Photo != nil && e.trashed == nil && !hidden[e.parent] {
+			photos = append(photos, PhotoFile{Name: e.name, FolderID: e.parent, Size: e.file.Size, Photo: *e.file.Photo})
+		}
+	}
+	slices.SortFunc(photos, func(a, b PhotoFile) int {
+		return b.Photo.CapturedAt.Compare(a.Photo.CapturedAt)
+	})
+
+	var months []PhotoMonth
+	for _, p := range photos {
+		year, month := p.Photo.CapturedAt.Year(), p.Photo.CapturedAt.Month()
+		if n := len(months); n == 0 || months[n-1].Year != year || months[n-1].Month != month {
+			months = append(months, PhotoMonth{Year: year, Month: month})
+		}
+		months[len(months)-1].Photos = append(months[len(months)-1].Photos, p)
+	}
+	return months, nil
+}
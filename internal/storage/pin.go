@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/notassigned/endershare/internal/database"
+)
+
+// ErrPinned is returned when evicting the content of a pinned file
+var ErrPinned = errors.New("file is pinned")
+
+// PinnedFile names a pinned file by its folder and name, as files are
+// looked up. A pinned file that is renamed or moved is no longer pinned.
+type PinnedFile struct {
+	FolderID FolderID `json:"folderId"`
+	Name     string   `json:"name"`
+}
+
+// Pins are the files and folders, with everything below them, whose content
+// a node keeps whatever its selection, the replication policy or its
+// on-demand setting say. They are stored in the node's own database and
+// never replicated.
+type Pins struct {
+	Folders []FolderID   `json:"folders,omitempty"`
+	Files   []PinnedFile `json:"files,omitempty"`
+}
+
+// pinOf returns the pin of a file, with the root folder under one ID
+func pinOf(name string, folderID FolderID) PinnedFile {
+	if folderID.IsRoot() {
+		folderID = RootFolderID
+	}
+	return PinnedFile{FolderID: folderID, Name: name}
+}
+
+// Empty reports whether nothing is pinned
+func (p Pins) Empty() bool {
+	return len(p.Folders) == 0 && len(p.Files) == 0
+}
+
+// LoadPins returns the pins stored in the database
+func LoadPins(db *database.EndershareDB) Pins {
+	var p Pins
+	if pinsJSON := db.GetPinsJSON(); pinsJSON != "" {
+		if err := json.Unmarshal([]byte(pinsJSON), &p); err != nil {
+			fmt.Println("Warning: Ignoring unreadable pins:", err)
+			return Pins{}
+		}
+	}
+	return p
+}
+
+// SavePins stores the pins in the database
+func SavePins(db *database.EndershareDB, p Pins) error {
+	pinsJSON, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return db.SetPinsJSON(string(pinsJSON))
+}
+
+// pinnedLocked reports whether an entry is pinned itself or lies in a pinned folder
+func (ix *metaIndex) pinnedLocked(e *indexEntry, p Pins) bool {
+	if p.Empty() {
+		return false
+	}
+	if e.typ == TypeFile && slices.Contains(p.Files, pinOf(e.name, e.parent)) {
+		return true
+	}
+	return ix.withinLocked(e.parent, p.Folders)
+}
+
+// SetFilePinned pins or unpins a file on this node
+func (s *Storage) SetFilePinned(name string, folderID FolderID, pinned bool) error {
+	if _, _, err := s.findFile(name, folderID); err != nil && pinned {
+		return err
+	}
+	pin := pinOf(name, folderID)
+	p := LoadPins(s.db)
+	p.Files = slices.DeleteFunc(p.Files, func(f PinnedFile) bool { return f == pin })
+	if pinned {
+		p.Files = append(p.Files, pin)
+	}
+	return SavePins(s.db, p)
+}
+
+// SetFolderPinned pins or unpins a folder, with everything below it, on this node
+func (s *Storage) SetFolderPinned(folderID FolderID, pinned bool) error {
+	if folderID.IsRoot() {
+		return fmt.Errorf("the root folder can't be pinned, turn off on-demand instead")
+	}
+	if _, err := s.GetFolder(folderID); err != nil && pinned {
+		return err
+	}
+	p := LoadPins(s.db)
+	p.Folders = slices.DeleteFunc(p.Folders, func(id FolderID) bool { return id == folderID })
+	if pinned {
+		p.Folders = append(p.Folders, folderID)
+	}
+	return SavePins(s.db, p)
+}
+
+// IsPinned reports whether a file is pinned on this node, itself or through
+// a folder above it
+func (s *Storage) IsPinned(name string, folderID FolderID) bool {
+	pins := LoadPins(s.db)
+	if pins.Empty() {
+		return false
+	}
+	return slices.Contains(pins.Files, pinOf(name, folderID)) || s.FolderWithin(folderID, pins.Folders)
+}
+
+// FolderPinned reports whether a folder is pinned on this node, and whether
+// that is through a folder above it rather than the folder itself
+func (s *Storage) FolderPinned(folderID FolderID) (pinned, inherited bool) {
+	pins := LoadPins(s.db)
+	if slices.Contains(pins.Folders, folderID) {
+		return true, false
+	}
+	inherited = s.FolderWithin(folderID, pins.Folders)
+	return inherited, inherited
+}
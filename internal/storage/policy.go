@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/notassigned/endershare/internal/database"
+)
+
+// ErrPolicyViolation is returned when a file is refused by the vault policy
+var ErrPolicyViolation = errors.New("refused by vault policy")
+
+// Policy limits what the master adds to the vault and what replicas download.
+// Sizes are encrypted blob sizes in bytes, zero means no limit.
+type Policy struct {
+	MaxFileSize       int64    `json:"max_file_size,omitempty"`
+	MaxVaultSize      int64    `json:"max_vault_size,omitempty"`
+	BlockedExtensions []string `json:"blocked_extensions,omitempty"` // Lowercase with the leading dot
+}
+
+// LoadPolicy returns the vault policy stored in the database
+func LoadPolicy(db *database.EndershareDB) Policy {
+	var p Policy
+	if policyJSON := db.GetVaultPolicyJSON(); policyJSON != "" {
+		if err := json.Unmarshal([]byte(policyJSON), &p); err != nil {
+			fmt.Println("Warning: Ignoring unreadable vault policy:", err)
+			return Policy{}
+		}
+	}
+	return p
+}
+
+// SavePolicy stores the vault policy in the database
+func SavePolicy(db *database.EndershareDB, p Policy) error {
+	policyJSON, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return db.SetVaultPolicyJSON(string(policyJSON))
+}
+
+// NormalizeExtension returns ext lowercased with a leading dot
+func NormalizeExtension(ext string) string {
+	ext = strings.ToLower(strings.TrimSpace(ext))
+	if ext != "" && !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	return ext
+}
+
+// CheckName refuses file names with a blocked extension
+func (p Policy) CheckName(name string) error {
+	ext := strings.ToLower(filepath.Ext(name))
+	if ext != "" && slices.Contains(p.BlockedExtensions, ext) {
+		return fmt.Errorf("%w: %s files are blocked", ErrPolicyViolation, ext)
+	}
+	return nil
+}
+
+// CheckSize refuses a blob of size bytes when it is too large on its own or
+// would grow a vault already holding vaultSize bytes past the limit
+func (p Policy) CheckSize(size, vaultSize int64) error {
+	if p.MaxFileSize > 0 && size > p.MaxFileSize {
+		return fmt.Errorf("%w: %d byte file exceeds the %d byte file limit", ErrPolicyViolation, size, p.MaxFileSize)
+	}
+	if p.MaxVaultSize > 0 && vaultSize+size > p.MaxVaultSize {
+		return fmt.Errorf("%w: vault would exceed its %d byte limit", ErrPolicyViolation, p.MaxVaultSize)
+	}
+	return nil
+}
+
+// Check applies every rule of the policy to a new file
+func (p Policy) Check(name string, size, vaultSize int64) error {
+	if err := p.CheckName(name); err != nil {
+		return err
+	}
+	return p.CheckSize(size, vaultSize)
+}
@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/notassigned/endershare/internal/crypto"
+	"github.com/notassigned/endershare/internal/database"
+)
+
+// processorTimeout bounds a single processor run on one file
+const processorTimeout = 2 * time.Minute
+
+// ContentProcessor derives auxiliary metadata, such as a thumbnail, extracted
+// text or a capture date, from the plaintext of a file. Results are stored
+// encrypted with the vault key under the blob hash, so they follow renames.
+type ContentProcessor interface {
+	// Name identifies the processor's results and must not change
+	Name() string
+	// Accepts reports whether the processor handles a file, e.g. by extension
+	Accepts(file FileEntry) bool
+	// Process reads the plaintext and returns the metadata to store
+	Process(ctx context.Context, file FileEntry, r io.Reader) ([]byte, error)
+}
+
+var (
+	processorsMu sync.RWMutex
+	processors   []ContentProcessor
+)
+
+// RegisterProcessor adds a content processor, usually from an init function.
+// It panics if a processor with the same name is already registered.
+func RegisterProcessor(p ContentProcessor) {
+	processorsMu.Lock()
+	defer processorsMu.Unlock()
+	for _, existing := range processors {
+		if existing.Name() == p.Name() {
+			panic("storage: content processor registered twice: " + p.Name())
+		}
+	}
+	processors = append(processors, p)
+}
+
+// Processors returns the registered content processors
+func Processors() []ContentProcessor {
+	processorsMu.RLock()
+	defer processorsMu.RUnlock()
+	return append([]ContentProcessor(nil), processors...)
+}
+
+// DecryptFileEntry returns the decrypted metadata of a file entry
+func (s *Storage) DecryptFileEntry(entry database.DataEntry) (*FileEntry, error) {
+	decryptedKey, err := crypto.Decrypt(entry.Key, s.aesKey)
+	if err != nil {
+		return nil, err
+	}
+	var fileEntry FileEntry
+	if err := json.Unmarshal(decryptedKey, &fileEntry); err != nil || fileEntry.Type != TypeFile {
+		return nil, fmt.Errorf("entry is not a file: %w", ErrNotFound)
+	}
+	return &fileEntry, nil
+}
+
+// RunProcessors runs every registered processor that accepts the file and
+// has no stored result for its blob yet. The blob must be stored locally.
+// Nodes running the low-resource profile run none.
+func (s *Storage) RunProcessors(ctx context.Context, entry database.DataEntry) error {
+	if LowResource(s.db) {
+		return nil
+	}
+	fileEntry, err := s.DecryptFileEntry(entry)
+	if err != nil {
+		return err
+	}
+	for _, p := range Processors() {
+		if !p.Accepts(*fileEntry) || s.db.HasContentMetadata(entry.Value, p.Name()) {
+			continue
+		}
+		if err := s.runProcessor(ctx, p, entry.Value, fileEntry); err != nil {
+			fmt.Printf("Warning: Content processor %s failed on %s: %v\n", p.Name(), fileEntry.Name, err)
+		}
+	}
+	return nil
+}
+
+func (s *Storage) runProcessor(ctx context.Context, p ContentProcessor, fileHash []byte, fileEntry *FileEntry) error {
+	key, err := s.blobKey(fileEntry)
+	if err != nil {
+		return err
+	}
+	srcPath := filepath.Join(s.dataDir, hexEncode(fileHash))
+
+	// Plaintext is streamed to the processor and never touches disk
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(decryptBlob(pw, srcPath, key, fileEntry.Codec))
+	}()
+	defer pr.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, processorTimeout)
+	defer cancel()
+	result, err := p.Process(ctx, *fileEntry, pr)
+	if err != nil {
+		return err
+	}
+
+	encrypted, err := crypto.Encrypt(result, s.aesKey)
+	if err != nil {
+		return err
+	}
+	return s.db.SetContentMetadata(fileHash, p.Name(), encrypted)
+}
+
+// ContentMetadata returns the decrypted result of a processor for a blob,
+// or ErrNotFound if the processor has not run on it
+func (s *Storage) ContentMetadata(fileHash []byte, processor string) ([]byte, error) {
+	encrypted := s.db.GetContentMetadata(fileHash, processor)
+	if encrypted == nil {
+		return nil, fmt.Errorf("%s metadata %w", processor, ErrNotFound)
+	}
+	return crypto.Decrypt(encrypted, s.aesKey)
+}
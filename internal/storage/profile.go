@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/notassigned/endershare/internal/database"
+)
+
+// Resource profiles a node can be configured with. Without one the profile
+// follows the memory of the machine, see LowResource.
+const (
+	ProfileStandard    = "standard"
+	ProfileLowResource = "low-resource"
+)
+
+// lowResourceMemory is the total memory at or below which a node without a
+// configured profile runs low-resource, which covers the Raspberry Pis and
+// small NAS boxes replicas usually run on
+const lowResourceMemory = 2 << 30
+
+// LowResource reports whether the node runs the low-resource profile: fewer
+// connections, smaller sync batches and buffers, and no content processors
+// such as thumbnails or search indexing
+func LowResource(db *database.EndershareDB) bool {
+	switch db.GetResourceProfile() {
+	case ProfileLowResource:
+		return true
+	case ProfileStandard:
+		return false
+	}
+	mem := TotalMemory()
+	return mem > 0 && mem <= lowResourceMemory
+}
+
+// TotalMemory returns the physical memory of the machine in bytes, 0 where
+// it can't be read. Only Linux reports it, through /proc/meminfo.
+var TotalMemory = sync.OnceValue(func() int64 {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// MemTotal:        3884472 kB
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "MemTotal:" {
+			continue
+		}
+		kb, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return 0
+		}
+		return kb << 10
+	}
+	return 0
+})
@@ -0,0 +1,362 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/notassigned/endershare/internal/database"
+)
+
+var (
+	ErrInvalidName = errors.New("invalid name")
+	ErrNameTaken   = errors.New("name is already taken")
+)
+
+// checkEntryName refuses names that can't be a single path element
+func checkEntryName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\\") {
+		return fmt.Errorf("%w: %q", ErrInvalidName, name)
+	}
+	return nil
+}
+
+// maxNumberedNames bounds the numbered names freeName tries
+const maxNumberedNames = 10000
+
+// claimName returns the name a new entry of typ gets in folder: name itself
+// if no live entry of that type has it, with rename-duplicates on the first
+// free numbered name, see freeName, and otherwise ErrNameTaken. Name-based
+// lookups such as GetFile expect names to be unique per folder and type.
+func (s *Storage) claimName(typ EntryType, name string, folder FolderID) (string, error) {
+	_, taken, err := s.lookupName(typ, name, folder)
+	if err != nil || !taken {
+		return name, err
+	}
+	if !s.db.GetRenameDuplicates() {
+		return "", fmt.Errorf("%w: %s in folder %s", ErrNameTaken, name, folder)
+	}
+	return s.freeName(typ, name, folder)
+}
+
+// freeName returns the first of "report (1).pdf", "report (2).pdf", ... that
+// no live entry of typ in folder has. A name that is numbered already is
+// renumbered rather than numbered twice. Folders are numbered at the end of
+// their name.
+func (s *Storage) freeName(typ EntryType, name string, folder FolderID) (string, error) {
+	stem, ext := name, ""
+	if typ == TypeFile {
+		if i := strings.LastIndexByte(name, '.'); i > 0 {
+			stem, ext = name[:i], name[i:]
+		}
+	}
+	if i := strings.LastIndex(stem, " ("); i > 0 && strings.HasSuffix(stem, ")") {
+		if _, err := strconv.Atoi(stem[i+2 : len(stem)-1]); err == nil {
+			stem = stem[:i]
+		}
+	}
+	for n := 1; n <= maxNumberedNames; n++ {
+		candidate := fmt.Sprintf("%s (%d)%s", stem, n, ext)
+		_, taken, err := s.lookupName(typ, candidate, folder)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("%w: no free name like %s in folder %s", ErrNameTaken, name, folder)
+}
+
+// RenameFile gives a file a new name in the same folder. Versions and photo
+// metadata stay with the file. The encrypted key changes, so the old entry is
+// returned along with the new one for a MODIFY update.
+func (s *Storage) RenameFile(name string, folderID FolderID, newName string) (removed, added *database.DataEntry, err error) {
+	if err := checkEntryName(newName); err != nil {
+		return nil, nil, err
+	}
+	entry, fileEntry, err := s.findFile(name, folderID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if newName == name {
+		return nil, nil, fmt.Errorf("%w: %s already has that name", ErrInvalidName, name)
+	}
+	if err := LoadPolicy(s.db).CheckName(newName); err != nil {
+		return nil, nil, err
+	}
+	if _, _, err := s.findFile(newName, folderID); err == nil {
+		return nil, nil, fmt.Errorf("%w: %s in folder %s", ErrNameTaken, newName, folderID)
+	} else if !errors.Is(err, ErrNotFound) {
+		return nil, nil, err
+	}
+
+	fileEntry.Name = newName
+	return s.replaceEntry(*entry, fileEntry, folderID)
+}
+
+// MoveFile moves a file to another folder, keeping its name, versions and
+// content. A file dropped into a drop box no longer depends on it afterwards.
+// The encrypted key changes, see RenameFile.
+func (s *Storage) MoveFile(name string, srcFolderID, dstFolderID FolderID) (removed, added *database.DataEntry, err error) {
+	entry, fileEntry, err := s.findFile(name, srcFolderID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if dstFolderID == srcFolderID {
+		return nil, nil, fmt.Errorf("%w: %s is already in folder %s", ErrNameTaken, name, dstFolderID)
+	}
+	exists, err := s.liveFolder(dstFolderID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !exists {
+		return nil, nil, fmt.Errorf("folder %w: %s", ErrNotFound, dstFolderID)
+	}
+	if _, _, err := s.findFile(name, dstFolderID); err == nil {
+		return nil, nil, fmt.Errorf("%w: %s in folder %s", ErrNameTaken, name, dstFolderID)
+	} else if !errors.Is(err, ErrNotFound) {
+		return nil, nil, err
+	}
+
+	if err := s.unseal(fileEntry); err != nil {
+		return nil, nil, err
+	}
+	fileEntry.FolderID = dstFolderID
+	return s.replaceEntry(*entry, fileEntry, dstFolderID)
+}
+
+// EntryChange is an entry replaced by another, for a MODIFY update
+type EntryChange struct {
+	Removed, Added *database.DataEntry
+}
+
+// SubtreeChange records a folder that was renamed or moved. Entries below it
+// refer to it by ID and are left alone, but their path changes with it, so
+// their hashes are listed for whatever indexes entries by path. Changes holds
+// the folder's own change first, then those of entries that had to be
+// rewritten, all of them written in one transaction.
+type SubtreeChange struct {
+	Changes     []EntryChange
+	Descendants [][]byte // Hashes of the entries below the folder afterwards
+}
+
+// RenameFolder gives a folder a new name. Its contents refer to it by ID and
+// stay where they are. The encrypted key changes, see RenameFile.
+func (s *Storage) RenameFolder(folderID FolderID, newName string) (*SubtreeChange, error) {
+	if folderID.IsRoot() {
+		return nil, fmt.Errorf("%w: the root folder can't be renamed", ErrInvalidName)
+	}
+	if err := checkEntryName(newName); err != nil {
+		return nil, err
+	}
+	folder, ok, err := s.lookupFolder(folderID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok || folder.trashed != nil {
+		return nil, fmt.Errorf("folder %w: %s", ErrNotFound, folderID)
+	}
+	if folder.name == newName {
+		return nil, fmt.Errorf("%w: %s already has that name", ErrInvalidName, newName)
+	}
+	_, taken, err := s.lookupName(TypeFolder, newName, folder.parent)
+	if err != nil {
+		return nil, err
+	}
+	if taken {
+		return nil, fmt.Errorf("%w: %s in folder %s", ErrNameTaken, newName, folder.parent)
+	}
+
+	folder.folder.Name = newName
+	return s.changeSubtree(folder, false)
+}
+
+// MoveFolder moves a folder and everything below it into another folder.
+// Files below it that are sealed to a drop box outside it no longer depend on
+// that drop box afterwards, see MoveFile.
+func (s *Storage) MoveFolder(folderID, dstParentID FolderID) (*SubtreeChange, error) {
+	if folderID.IsRoot() {
+		return nil, fmt.Errorf("%w: the root folder can't be moved", ErrInvalidName)
+	}
+	folder, ok, err := s.lookupFolder(folderID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok || folder.trashed != nil {
+		return nil, fmt.Errorf("folder %w: %s", ErrNotFound, folderID)
+	}
+	if dstParentID == folder.parent {
+		return nil, fmt.Errorf("%w: %s is already in folder %s", ErrNameTaken, folder.name, dstParentID)
+	}
+	exists, err := s.liveFolder(dstParentID)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("folder %w: %s", ErrNotFound, dstParentID)
+	}
+	// The step bound guards against parent cycles in corrupt indexes
+	for p, steps := dstParentID, 0; !p.IsRoot() && steps < 1<<16; steps++ {
+		if p == folderID {
+			return nil, fmt.Errorf("%w: %s can't be moved into itself", ErrInvalidName, folder.name)
+		}
+		parent, ok, err := s.lookupFolder(p)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		p = parent.parent
+	}
+	_, taken, err := s.lookupName(TypeFolder, folder.name, dstParentID)
+	if err != nil {
+		return nil, err
+	}
+	if taken {
+		return nil, fmt.Errorf("%w: %s in folder %s", ErrNameTaken, folder.name, dstParentID)
+	}
+
+	folder.folder.ParentFolderID = dstParentID
+	return s.changeSubtree(folder, true)
+}
+
+// changeSubtree stores the changed entry of a folder together with the
+// entries below it that have to change along with it. When the folder moves,
+// files sealed to a drop box outside it are unsealed.
+func (s *Storage) changeSubtree(folder indexEntry, moved bool) (*SubtreeChange, error) {
+	descendants, err := s.descendants(folder.id)
+	if err != nil {
+		return nil, err
+	}
+	inside := map[FolderID]bool{folder.id: true}
+	for _, e := range descendants {
+		if e.typ == TypeFolder {
+			inside[e.id] = true
+		}
+	}
+
+	put, err := s.encodeReplacement(folder.data, folder.folder, folder.folder.ParentFolderID)
+	if err != nil {
+		return nil, err
+	}
+	puts := []database.DataPut{put}
+	deletes := [][]byte{folder.data.Key}
+	change := &SubtreeChange{Changes: []EntryChange{{Removed: &folder.data}}}
+
+	for _, e := range descendants {
+		if !moved || e.typ != TypeFile || !sealedOutside(e.file, inside) {
+			change.Descendants = append(change.Descendants, e.data.Hash)
+			continue
+		}
+		if err := s.unseal(&e.file); err != nil {
+			return nil, err
+		}
+		put, err := s.encodeReplacement(e.data, e.file, e.parent)
+		if err != nil {
+			return nil, err
+		}
+		puts = append(puts, put)
+		deletes = append(deletes, e.data.Key)
+		change.Changes = append(change.Changes, EntryChange{Removed: &e.data})
+		change.Descendants = append(change.Descendants, put.Entry.Hash)
+	}
+
+	if err := s.db.WriteDataBatch(puts, deletes); err != nil {
+		return nil, err
+	}
+	for i := range change.Changes {
+		change.Changes[i].Added = &puts[i].Entry
+	}
+	return change, nil
+}
+
+// descendants returns the entries below a folder, trashed or not, each
+// folder before its contents
+func (s *Storage) descendants(folderID FolderID) ([]indexEntry, error) {
+	var found []indexEntry
+	seen := map[FolderID]bool{folderID: true}
+	for queue := []FolderID{folderID}; len(queue) > 0; queue = queue[1:] {
+		children, err := s.lookupChildren(queue[0])
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range children {
+			found = append(found, e)
+			if e.typ == TypeFolder && !seen[e.id] {
+				seen[e.id] = true
+				queue = append(queue, e.id)
+			}
+		}
+	}
+	return found, nil
+}
+
+// sealedOutside reports whether a file or one of its versions is sealed to a
+// drop box other than the folders in inside
+func sealedOutside(fileEntry FileEntry, inside map[FolderID]bool) bool {
+	if len(fileEntry.SealedKey) > 0 && !inside[fileEntry.SealedTo] {
+		return true
+	}
+	for _, v := range fileEntry.Versions {
+		if len(v.SealedKey) > 0 && !inside[v.SealedTo] {
+			return true
+		}
+	}
+	return false
+}
+
+// unseal replaces the sealed keys of a file and its versions with the keys
+// themselves, so the file stays readable when it no longer lives in its drop
+// box and that drop box is deleted
+func (s *Storage) unseal(fileEntry *FileEntry) error {
+	if len(fileEntry.SealedKey) > 0 {
+		key, err := s.openSealedKey(fileEntry.SealedKey, fileEntry.SealedTo)
+		if err != nil {
+			return fmt.Errorf("drop key for %s unavailable: %w", fileEntry.Name, err)
+		}
+		fileEntry.ContentKey, fileEntry.SealedKey, fileEntry.SealedTo = key, nil, ""
+	}
+	fileEntry.Versions = slices.Clone(fileEntry.Versions)
+	for i, v := range fileEntry.Versions {
+		if len(v.SealedKey) == 0 {
+			continue
+		}
+		key, err := s.openSealedKey(v.SealedKey, v.SealedTo)
+		if err != nil {
+			return fmt.Errorf("drop key for version %d of %s unavailable: %w", i, fileEntry.Name, err)
+		}
+		fileEntry.Versions[i].ContentKey, fileEntry.Versions[i].SealedKey, fileEntry.Versions[i].SealedTo = key, nil, ""
+	}
+	return nil
+}
+
+// liveFolder reports whether a folder exists and is not in the trash,
+// directly or through a folder above it
+func (s *Storage) liveFolder(folderID FolderID) (bool, error) {
+	if folderID.IsRoot() {
+		return true, nil
+	}
+	var exists, hidden bool
+	err := s.withIndex(func(ix *metaIndex) {
+		exists = len(ix.folders[folderID]) > 0
+		// The step bound guards against parent cycles in corrupt indexes
+		for id, steps := folderID, 0; exists && !id.IsRoot() && steps <= len(ix.folders); steps++ {
+			list := ix.folders[id]
+			if len(list) == 0 {
+				return
+			}
+			for _, e := range list {
+				if e.trashed != nil {
+					hidden = true
+					return
+				}
+			}
+			id = list[len(list)-1].parent
+		}
+	})
+	return exists && !hidden, err
+}
@@ -0,0 +1,383 @@
+package storage
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// s3PartSize is the size of the parts blobs larger than it are uploaded in.
+// S3 allows at most s3MaxParts parts, larger blobs use larger parts.
+const (
+	s3PartSize = 64 << 20
+	s3MaxParts = 10000
+)
+
+// S3Store is a ColdStore keeping blobs as objects in a bucket of S3 or a
+// compatible service, such as MinIO or Backblaze B2. Requests are signed with
+// AWS Signature Version 4 and address the bucket by path.
+type S3Store struct {
+	endpoint  url.URL // Scheme and host
+	bucket    string
+	prefix    string // Prepended to object names, "" or ending with "/"
+	region    string
+	accessKey string
+	secretKey string
+	partSize  int64 // s3PartSize, smaller in tests
+}
+
+// ParseS3URL parses the URL of an S3 bucket, in the form
+// s3://host[:port]/bucket[/prefix][?region=name], and signs requests to it
+// with accessKey and secretKey. s3+http:// talks to the host without TLS, for
+// a local MinIO for example. The region defaults to us-east-1.
+func ParseS3URL(raw, accessKey, secretKey string) (*S3Store, error) {
+	u, err := checkS3URL(raw)
+	if err != nil {
+		return nil, err
+	}
+	if accessKey == "" || secretKey == "" {
+		return nil, fmt.Errorf("no credentials for %s, see endershare config cold-storage-key", u.Host)
+	}
+	scheme := "https"
+	if u.Scheme == "s3+http" {
+		scheme = "http"
+	}
+	bucket, prefix, _ := strings.Cut(strings.Trim(u.Path, "/"), "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return &S3Store{
+		endpoint:  url.URL{Scheme: scheme, Host: u.Host},
+		bucket:    bucket,
+		prefix:    prefix,
+		region:    cmp.Or(u.Query().Get("region"), "us-east-1"),
+		accessKey: accessKey,
+		secretKey: secretKey,
+		partSize:  s3PartSize,
+	}, nil
+}
+
+// CheckS3URL reports whether raw is a bucket URL ParseS3URL accepts
+func CheckS3URL(raw string) error {
+	_, err := checkS3URL(raw)
+	return err
+}
+
+func checkS3URL(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "s3" && u.Scheme != "s3+http" {
+		return nil, fmt.Errorf("expected s3:// or s3+http://, got %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("missing host in %s", u.Redacted())
+	}
+	if u.User != nil {
+		return nil, fmt.Errorf("credentials don't go in the URL, see endershare config cold-storage-key")
+	}
+	if bucket, _, _ := strings.Cut(strings.Trim(u.Path, "/"), "/"); bucket == "" {
+		return nil, fmt.Errorf("missing bucket in %s", u.Redacted())
+	}
+	return u, nil
+}
+
+func (s *S3Store) String() string {
+	return s.endpoint.Host + "/" + s.bucket + "/" + s.prefix
+}
+
+// Put uploads size bytes of r as the object name, in parts if it is large
+func (s *S3Store) Put(ctx context.Context, name string, r io.ReaderAt, size int64) error {
+	partSize := max(s.partSize, (size+s3MaxParts-1)/s3MaxParts)
+	if size <= partSize {
+		_, err := s.do(ctx, http.MethodPut, name, nil, io.NewSectionReader(r, 0, size), size)
+		return err
+	}
+
+	resp, err := s.do(ctx, http.MethodPost, name, url.Values{"uploads": {""}}, nil, 0)
+	if err != nil {
+		return err
+	}
+	var initiated struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := xml.Unmarshal(resp, &initiated); err != nil || initiated.UploadID == "" {
+		return fmt.Errorf("s3: unexpected reply starting upload of %s", name)
+	}
+	upload := url.Values{"uploadId": {initiated.UploadID}}
+
+	type part struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+	}
+	var parts []part
+	for off, n := int64(0), 1; off < size; off, n = off+partSize, n+1 {
+		query := url.Values{"partNumber": {strconv.Itoa(n)}, "uploadId": upload["uploadId"]}
+		etag, err := s.putPart(ctx, name, query, io.NewSectionReader(r, off, min(partSize, size-off)))
+		if err != nil {
+			// Parts uploaded so far are billed until the upload is aborted
+			s.do(context.Background(), http.MethodDelete, name, upload, nil, 0)
+			return err
+		}
+		parts = append(parts, part{PartNumber: n, ETag: etag})
+	}
+
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name `xml:"CompleteMultipartUpload"`
+		Parts   []part   `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return err
+	}
+	resp, err = s.do(ctx, http.MethodPost, name, upload, bytes.NewReader(body), int64(len(body)))
+	if err == nil && bytes.Contains(resp, []byte("<Error>")) {
+		// Completion can fail after a 200 reply
+		err = s3Error(http.StatusOK, resp)
+	}
+	if err != nil {
+		s.do(context.Background(), http.MethodDelete, name, upload, nil, 0)
+	}
+	return err
+}
+
+// putPart uploads one part of a multipart upload and returns its ETag
+func (s *S3Store) putPart(ctx context.Context, name string, query url.Values, part *io.SectionReader) (string, error) {
+	req, err := s.request(ctx, http.MethodPut, name, query, part, part.Size())
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode != http.StatusOK {
+		return "", s3Error(resp.StatusCode, body)
+	}
+	return resp.Header.Get("ETag"), nil
+}
+
+// Get opens the object name for reading
+func (s *S3Store) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	req, err := s.request(ctx, http.MethodGet, name, nil, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		return nil, s3Error(resp.StatusCode, body)
+	}
+	return resp.Body, nil
+}
+
+// Stat returns the size of the object name, failing with os.ErrNotExist if
+// there is none
+func (s *S3Store) Stat(ctx context.Context, name string) (int64, error) {
+	req, err := s.request(ctx, http.MethodHead, name, nil, nil, 0)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.ContentLength, nil
+	case http.StatusNotFound:
+		return 0, fmt.Errorf("s3: %s: %w", name, os.ErrNotExist)
+	default:
+		return 0, s3Error(resp.StatusCode, nil)
+	}
+}
+
+// Delete removes the object name, if there is one
+func (s *S3Store) Delete(ctx context.Context, name string) error {
+	_, err := s.do(ctx, http.MethodDelete, name, nil, nil, 0)
+	return err
+}
+
+// do sends a request and returns the reply's body, failing on error statuses
+func (s *S3Store) do(ctx context.Context, method, name string, query url.Values, body io.ReadSeeker, size int64) ([]byte, error) {
+	req, err := s.request(ctx, method, name, query, body, size)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	reply, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 && !(method == http.MethodDelete && resp.StatusCode == http.StatusNotFound) {
+		return nil, s3Error(resp.StatusCode, reply)
+	}
+	return reply, nil
+}
+
+// request builds a signed request for the object name. The body is read
+// once to hash it for the signature, then rewound.
+func (s *S3Store) request(ctx context.Context, method, name string, query url.Values, body io.ReadSeeker, size int64) (*http.Request, error) {
+	payloadHash := sha256.New()
+	if body != nil {
+		if _, err := io.Copy(payloadHash, body); err != nil {
+			return nil, err
+		}
+		if _, err := body.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+
+	u := s.endpoint
+	u.Path = "/" + s.bucket + "/" + s.prefix + name
+	u.RawPath = s3Escape(u.Path, false)
+	u.RawQuery = s3Query(query)
+	var reqBody io.Reader = http.NoBody
+	if body != nil && size > 0 {
+		reqBody = body
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), reqBody)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = size
+	if body != nil && size > 0 {
+		// Let the client resend the body after a redirect or a dropped connection
+		req.GetBody = func() (io.ReadCloser, error) {
+			if _, err := body.Seek(0, io.SeekStart); err != nil {
+				return nil, err
+			}
+			return io.NopCloser(body), nil
+		}
+	}
+	s.sign(req, hex.EncodeToString(payloadHash.Sum(nil)), time.Now().UTC())
+	return req, nil
+}
+
+// sign adds the AWS Signature Version 4 headers to a request over a payload
+// with the hex encoded SHA-256 payloadHash
+func (s *S3Store) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	sig := sigV4(req.Method, req.URL.EscapedPath(), req.URL.RawQuery, map[string]string{
+		"host":                 req.URL.Host,
+		"x-amz-content-sha256": payloadHash,
+		"x-amz-date":           amzDate,
+	}, payloadHash, s.region, "s3", s.secretKey, now)
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.accessKey+"/"+sig.scope+
+		", SignedHeaders="+sig.signedHeaders+", Signature="+sig.signature)
+}
+
+// sigV4Signature is a Signature Version 4 signature with the steps to it
+type sigV4Signature struct {
+	canonicalRequest string
+	stringToSign     string
+	scope            string // day/region/service/aws4_request
+	signedHeaders    string
+	signature        string
+}
+
+// sigV4 signs a request to service. headers holds the lowercase names and
+// trimmed values of the headers to sign, host among them.
+func sigV4(method, path, rawQuery string, headers map[string]string, payloadHash, region, service, secretKey string, now time.Time) sigV4Signature {
+	day := now.Format("20060102")
+	names := slices.Sorted(maps.Keys(headers))
+	sig := sigV4Signature{
+		scope:         day + "/" + region + "/" + service + "/aws4_request",
+		signedHeaders: strings.Join(names, ";"),
+	}
+
+	var canonical strings.Builder
+	canonical.WriteString(method + "\n" + path + "\n" + rawQuery + "\n")
+	for _, h := range names {
+		canonical.WriteString(h + ":" + headers[h] + "\n")
+	}
+	canonical.WriteString("\n" + sig.signedHeaders + "\n" + payloadHash)
+	sig.canonicalRequest = canonical.String()
+
+	requestHash := sha256.Sum256([]byte(sig.canonicalRequest))
+	sig.stringToSign = "AWS4-HMAC-SHA256\n" + now.Format("20060102T150405Z") + "\n" + sig.scope + "\n" + hex.EncodeToString(requestHash[:])
+	key := hmacSHA256([]byte("AWS4"+secretKey), day)
+	for _, part := range []string{region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	sig.signature = hex.EncodeToString(hmacSHA256(key, sig.stringToSign))
+	return sig
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// s3Escape percent-encodes everything but the unreserved characters, and
+// slashes unless query is set, as Signature Version 4 expects
+func s3Escape(s string, query bool) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && !query:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// s3Query encodes a query sorted by key, as both the URL and the signature use it
+func s3Query(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	var parts []string
+	for _, k := range keys {
+		for _, v := range query[k] {
+			parts = append(parts, s3Escape(k, true)+"="+s3Escape(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// s3Error describes an error reply, with the code and message S3 sent if any
+func s3Error(status int, body []byte) error {
+	var reply struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	if xml.Unmarshal(body, &reply) == nil && reply.Code != "" {
+		return fmt.Errorf("s3: %s: %s (%d)", reply.Code, reply.Message, status)
+	}
+	return fmt.Errorf("s3: unexpected status %d", status)
+}
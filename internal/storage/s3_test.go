@@ -0,0 +1,181 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// The get-vanilla case of the AWS Signature Version 4 test suite
+func TestSigV4KnownAnswer(t *testing.T) {
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+	sig := sigV4("GET", "/", "", map[string]string{
+		"host":       "example.amazonaws.com",
+		"x-amz-date": "20150830T123600Z",
+	}, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		"us-east-1", "service", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", now)
+
+	wantCanonical := "GET\n/\n\nhost:example.amazonaws.com\nx-amz-date:20150830T123600Z\n\nhost;x-amz-date\n" +
+		"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	if sig.canonicalRequest != wantCanonical {
+		t.Errorf("canonical request:\n%s\nwant:\n%s", sig.canonicalRequest, wantCanonical)
+	}
+	wantToSign := "AWS4-HMAC-SHA256\n20150830T123600Z\n20150830/us-east-1/service/aws4_request\n" +
+		"bb579772317eb040ac9ed261061d46c1f17a8133879d6129b6e1c25292927e63"
+	if sig.stringToSign != wantToSign {
+		t.Errorf("string to sign:\n%s\nwant:\n%s", sig.stringToSign, wantToSign)
+	}
+	if want := "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"; sig.signature != want {
+		t.Errorf("signature %s, want %s", sig.signature, want)
+	}
+	if sig.signedHeaders != "host;x-amz-date" {
+		t.Errorf("signed headers %s, want host;x-amz-date", sig.signedHeaders)
+	}
+}
+
+// fakeMultipartS3 is an S3 endpoint taking multipart uploads into one bucket
+type fakeMultipartS3 struct {
+	mu        sync.Mutex
+	ops       []string          // Operations in the order received
+	parts     map[string][]byte // By part number
+	completed []string          // ETags listed by the completion request
+	object    []byte
+	failing   bool // Complete with an error in a 200 reply
+}
+
+func (f *fakeMultipartS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	body, _ := io.ReadAll(r.Body)
+	sum := sha256.Sum256(body)
+	if r.Header.Get("x-amz-content-sha256") != hex.EncodeToString(sum[:]) ||
+		!strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=access/") {
+		http.Error(w, "<Error><Code>SignatureDoesNotMatch</Code></Error>", http.StatusForbidden)
+		return
+	}
+	if r.URL.Path != "/bucket/prefix/blob" {
+		http.NotFound(w, r)
+		return
+	}
+
+	q := r.URL.Query()
+	switch {
+	case r.Method == http.MethodPost && q.Has("uploads"):
+		f.ops = append(f.ops, "initiate")
+		fmt.Fprint(w, "<InitiateMultipartUploadResult><UploadId>upload-1</UploadId></InitiateMultipartUploadResult>")
+	case r.Method == http.MethodPut && q.Get("uploadId") == "upload-1":
+		n := q.Get("partNumber")
+		f.ops = append(f.ops, "part "+n)
+		f.parts[n] = body
+		w.Header().Set("ETag", `"etag-`+n+`"`)
+	case r.Method == http.MethodPost && q.Get("uploadId") == "upload-1":
+		f.ops = append(f.ops, "complete")
+		var req struct {
+			Parts []struct {
+				PartNumber string `xml:"PartNumber"`
+				ETag       string `xml:"ETag"`
+			} `xml:"Part"`
+		}
+		if err := xml.Unmarshal(body, &req); err != nil {
+			http.Error(w, "<Error><Code>MalformedXML</Code></Error>", http.StatusBadRequest)
+			return
+		}
+		if f.failing {
+			fmt.Fprint(w, "<Error><Code>InternalError</Code><Message>try again</Message></Error>")
+			return
+		}
+		var object []byte
+		for _, p := range req.Parts {
+			f.completed = append(f.completed, p.ETag)
+			object = append(object, f.parts[p.PartNumber]...)
+		}
+		f.object = object
+		fmt.Fprint(w, "<CompleteMultipartUploadResult></CompleteMultipartUploadResult>")
+	case r.Method == http.MethodDelete && q.Get("uploadId") == "upload-1":
+		f.ops = append(f.ops, "abort")
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "<Error><Code>NotImplemented</Code></Error>", http.StatusNotImplemented)
+	}
+}
+
+func TestS3MultipartPut(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 25)
+	for _, tc := range []struct {
+		name    string
+		failing bool
+		wantOps []string
+	}{
+		{"completes", false, []string{"initiate", "part 1", "part 2", "part 3", "complete"}},
+		{"aborts when completion fails", true, []string{"initiate", "part 1", "part 2", "part 3", "complete", "abort"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := &fakeMultipartS3{parts: make(map[string][]byte), failing: tc.failing}
+			srv := httptest.NewServer(fake)
+			defer srv.Close()
+			store, err := ParseS3URL("s3+http://"+strings.TrimPrefix(srv.URL, "http://")+"/bucket/prefix", "access", "secret")
+			if err != nil {
+				t.Fatal(err)
+			}
+			store.partSize = 100
+
+			err = store.Put(context.Background(), "blob", bytes.NewReader(content), int64(len(content)))
+			if tc.failing != (err != nil) {
+				t.Fatalf("Put = %v, want failure %v", err, tc.failing)
+			}
+			if got := strings.Join(fake.ops, ", "); got != strings.Join(tc.wantOps, ", ") {
+				t.Errorf("requests: %s\nwant: %s", got, strings.Join(tc.wantOps, ", "))
+			}
+			if tc.failing {
+				return
+			}
+			if got := strings.Join(fake.completed, ","); got != `"etag-1","etag-2","etag-3"` {
+				t.Errorf("completion listed ETags %s", got)
+			}
+			if !bytes.Equal(fake.object, content) {
+				t.Error("assembled object differs from the content put")
+			}
+		})
+	}
+}
+
+func TestParseS3URLCredentials(t *testing.T) {
+	if _, err := ParseS3URL("s3://key:secret@s3.example.com/bucket", "key", "secret"); err == nil {
+		t.Error("URL carrying credentials was accepted")
+	}
+	if _, err := ParseS3URL("s3://s3.example.com/bucket", "", ""); err == nil {
+		t.Error("bucket without credentials was accepted")
+	}
+	store, err := ParseS3URL("s3://s3.example.com/bucket/laptop?region=eu-west-1", "key", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.accessKey != "key" || store.secretKey != "secret" || store.region != "eu-west-1" || store.prefix != "laptop/" {
+		t.Errorf("parsed %+v", store)
+	}
+}
+
+// Keys configured in the URL by older versions move to their own setting
+func TestMigrateColdStorageKey(t *testing.T) {
+	s := newTestStorage(t, make([]byte, 32), false)
+	s.db.SetColdStorage("s3://key:secret@s3.example.com/bucket")
+	if got := migrateColdStorageKey(s.db, s.db.GetColdStorage()); got != "s3://s3.example.com/bucket" {
+		t.Errorf("migrated URL %s", got)
+	}
+	if got := s.db.GetColdStorage(); got != "s3://s3.example.com/bucket" {
+		t.Errorf("stored URL %s", got)
+	}
+	if accessKey, secretKey := s.db.GetColdStorageKey(); accessKey != "key" || secretKey != "secret" {
+		t.Errorf("stored keys %s, %s", accessKey, secretKey)
+	}
+}
@@ -0,0 +1,207 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/notassigned/endershare/internal/database"
+)
+
+// Folder replication modes, for what replicas keep of a folder and
+// everything below it
+const (
+	ReplicateEverywhere = "everywhere" // Every replica downloads the files during sync
+	ReplicateOnDemand   = "on-demand"  // Files stay placeholders, fetched when read
+)
+
+// FolderReplication is the replication mode the master gave one folder
+type FolderReplication struct {
+	FolderID FolderID `json:"folderId"`
+	Mode     string   `json:"mode"`
+}
+
+// ReplicationPolicy is the replication mode of every folder that has one.
+// The nearest folder with a mode decides for a file, files below none follow
+// each replica's on-demand setting.
+type ReplicationPolicy struct {
+	Folders []FolderReplication `json:"folders"`
+}
+
+// ModeOf returns the mode given to a folder itself, "" if none
+func (p ReplicationPolicy) ModeOf(folderID FolderID) string {
+	for _, f := range p.Folders {
+		if f.FolderID == folderID {
+			return f.Mode
+		}
+	}
+	return ""
+}
+
+// LoadReplicationPolicy returns the replication policy stored in the database
+func LoadReplicationPolicy(db *database.EndershareDB) ReplicationPolicy {
+	var p ReplicationPolicy
+	if policyJSON := db.GetReplicationPolicyJSON(); policyJSON != "" {
+		if err := json.Unmarshal([]byte(policyJSON), &p); err != nil {
+			fmt.Println("Warning: Ignoring unreadable replication policy:", err)
+			return ReplicationPolicy{}
+		}
+	}
+	return p
+}
+
+// SaveReplicationPolicy stores the replication policy in the database
+func SaveReplicationPolicy(db *database.EndershareDB, p ReplicationPolicy) error {
+	policyJSON, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return db.SetReplicationPolicyJSON(string(policyJSON))
+}
+
+// Scope decides which files a node keeps the content of. Files archived
+// outside the vault are not kept. A file pinned on the node or in a folder
+// replicated everywhere is. Otherwise a node with selected folders keeps the
+// files in them, and any other node keeps the files below no on-demand
+// folder unless it is on-demand itself.
+type Scope struct {
+	Selective   bool
+	Folders     []FolderID // Selected for the node, if Selective
+	Replication ReplicationPolicy
+	Pins        Pins
+	OnDemand    bool // The node's own on-demand setting
+}
+
+// Empty reports whether nothing but the node's on-demand setting decides
+func (sc Scope) Empty() bool {
+	return !sc.Selective && len(sc.Replication.Folders) == 0 && sc.Pins.Empty()
+}
+
+// withinLocked reports whether an entry with parent lies in one of folders or
+// below it. The step bound guards against parent cycles in corrupt indexes.
+func (ix *metaIndex) withinLocked(parent FolderID, folders []FolderID) bool {
+	for p, steps := parent, 0; !p.IsRoot() && steps <= len(ix.folders); steps++ {
+		if slices.Contains(folders, p) {
+			return true
+		}
+		list := ix.folders[p]
+		if len(list) == 0 {
+			return false
+		}
+		p = list[0].parent
+	}
+	return false
+}
+
+// modeLocked returns the mode of the nearest folder with one that holds an
+// entry with parent, "" if none does
+func (ix *metaIndex) modeLocked(parent FolderID, p ReplicationPolicy) string {
+	if len(p.Folders) == 0 {
+		return ""
+	}
+	for id, steps := parent, 0; steps <= len(ix.folders); steps++ {
+		if mode := p.ModeOf(id); mode != "" {
+			return mode
+		}
+		list := ix.folders[id]
+		if id.IsRoot() || len(list) == 0 {
+			return ""
+		}
+		id = list[0].parent
+	}
+	return ""
+}
+
+// keepsLocked reports whether a node keeps the content of an entry, and
+// whether the scope decided it rather than the node's on-demand setting alone
+func (ix *metaIndex) keepsLocked(e *indexEntry, sc Scope) (keep, decided bool) {
+	if e.file.Archive != nil {
+		return false, true
+	}
+	if ix.pinnedLocked(e, sc.Pins) {
+		return true, true
+	}
+	mode := ix.modeLocked(e.parent, sc.Replication)
+	switch {
+	case mode == ReplicateEverywhere:
+		return true, true
+	case sc.Selective:
+		return ix.withinLocked(e.parent, sc.Folders), true
+	case mode == ReplicateOnDemand:
+		return false, true
+	}
+	return !sc.OnDemand, false
+}
+
+// Keeps reports whether a node keeps the content of the entry with an
+// encrypted key. Entries this node can't place are kept rather than lost.
+func (s *Storage) Keeps(key []byte, sc Scope) bool {
+	keep := true
+	s.withIndex(func(ix *metaIndex) {
+		if e, ok := ix.byKey[string(key)]; ok {
+			keep, _ = ix.keepsLocked(e, sc)
+		}
+	})
+	return keep
+}
+
+// FolderMode returns the replication mode in effect for a folder and
+// whether it was given to a folder above it rather than the folder itself
+func (s *Storage) FolderMode(folderID FolderID, p ReplicationPolicy) (mode string, inherited bool) {
+	if mode = p.ModeOf(folderID); mode != "" {
+		return mode, false
+	}
+	s.withIndex(func(ix *metaIndex) {
+		if list := ix.folders[folderID]; len(list) > 0 {
+			mode = ix.modeLocked(list[0].parent, p)
+		}
+	})
+	return mode, mode != ""
+}
+
+// FolderWithin reports whether a folder is one of folders or lies below one
+func (s *Storage) FolderWithin(folderID FolderID, folders []FolderID) bool {
+	within := slices.Contains(folders, folderID)
+	s.withIndex(func(ix *metaIndex) {
+		within = within || ix.withinLocked(folderID, folders)
+	})
+	return within
+}
+
+// SplitBlobs sorts the blobs of the vault's files by whether a node keeps
+// them in scope, one entry per blob. Files the node's on-demand setting
+// leaves as placeholders are in neither list, their blobs may stay cached. A
+// blob shared by a file kept and one not, or by an earlier version of a
+// kept file, is only returned inside or not at all.
+func (s *Storage) SplitBlobs(sc Scope) (inside, outside []database.DataEntry, err error) {
+	seen := make(map[string]bool)
+	kept := make(map[string]bool)
+	var rest []database.DataEntry
+	err = s.withIndex(func(ix *metaIndex) {
+		for _, e := range ix.byKey {
+			if e.typ != TypeFile || e.data.Value == nil {
+				continue
+			}
+			keep, decided := ix.keepsLocked(e, sc)
+			if keep && !seen[string(e.data.Value)] {
+				seen[string(e.data.Value)] = true
+				inside = append(inside, e.data)
+			}
+			if keep || !decided {
+				kept[string(e.data.Value)] = true
+				for _, v := range e.file.Versions {
+					kept[string(v.BlobHash)] = true
+				}
+			} else {
+				rest = append(rest, e.data)
+			}
+		}
+	})
+	for _, entry := range rest {
+		if !seen[string(entry.Value)] && !kept[string(entry.Value)] {
+			seen[string(entry.Value)] = true
+			outside = append(outside, entry)
+		}
+	}
+	return inside, outside, err
+}
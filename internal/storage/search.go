@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+)
+
+// SearchResult is a file or folder matching a search, as a FileEntry or
+// FolderEntry value like ListFolder, with its path from the root
+type SearchResult struct {
+	Entry interface{}
+	Path  string // As in "/Photos/2024/beach.jpg"
+}
+
+// Search returns the files and folders whose name contains every word of
+// query, ignoring case, folders first and then by path. With withTags a word
+// also matches an entry carrying a tag that contains it. It searches the
+// in-memory metadata index, so nothing is decrypted. Entries in the trash,
+// directly or through a folder above them, and entries that can't be reached
+// from the root are left out.
+func (s *Storage) Search(query string, withTags bool) ([]SearchResult, error) {
+	words := strings.Fields(strings.ToLower(query))
+	if len(words) == 0 {
+		return nil, nil
+	}
+	index, err := s.loadIndex()
+	if err != nil {
+		return nil, err
+	}
+	hidden := hiddenFolders(index)
+	folders := make(map[FolderID]indexEntry)
+	for _, e := range index {
+		if e.typ == TypeFolder {
+			folders[e.id] = e
+		}
+	}
+
+	type match struct {
+		e    indexEntry
+		path string
+	}
+	var matches []match
+	for _, e := range index {
+		if e.trashed != nil || hidden[e.parent] || !matchesWords(e, words, withTags) {
+			continue
+		}
+		path, ok := entryPath(e, folders)
+		if !ok {
+			continue
+		}
+		matches = append(matches, match{e, path})
+	}
+	slices.SortStableFunc(matches, func(a, b match) int {
+		if a.e.typ != b.e.typ {
+			if a.e.typ == TypeFolder {
+				return -1
+			}
+			return 1
+		}
+		return cmp.Compare(a.path, b.path)
+	})
+
+	results := make([]SearchResult, 0, len(matches))
+	for _, m := range matches {
+		if m.e.typ == TypeFile {
+			results = append(results, SearchResult{Entry: m.e.file, Path: m.path})
+		} else {
+			results = append(results, SearchResult{Entry: m.e.folder, Path: m.path})
+		}
+	}
+	return results, nil
+}
+
+// matchesWords reports whether every word is in the entry's name, or with
+// withTags in one of its tags. words are lowercase.
+func matchesWords(e indexEntry, words []string, withTags bool) bool {
+	name := strings.ToLower(e.name)
+	for _, w := range words {
+		if strings.Contains(name, w) {
+			continue
+		}
+		if withTags && slices.ContainsFunc(entryTags(e), func(t string) bool { return strings.Contains(t, w) }) {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+// entryPath returns the path of an entry from the root, or false if a folder
+// above it is missing
+func entryPath(e indexEntry, folders map[FolderID]indexEntry) (string, bool) {
+	names := []string{e.name}
+	// The step bound guards against parent cycles in corrupt indexes
+	for p, steps := e.parent, 0; !p.IsRoot(); p, steps = folders[p].parent, steps+1 {
+		folder, ok := folders[p]
+		if !ok || steps > len(folders) {
+			return "", false
+		}
+		names = append(names, folder.name)
+	}
+	slices.Reverse(names)
+	return "/" + strings.Join(names, "/"), true
+}
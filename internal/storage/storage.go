@@ -3,7 +3,9 @@ package storage
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"os"
 	"path/filepath"
@@ -14,32 +16,121 @@ import (
 	"lukechampine.com/blake3"
 )
 
+// ErrNotFound is returned when a file or folder does not exist
+var ErrNotFound = errors.New("not found")
+
+// ErrBlobCorrupted is returned when a stored blob does not match its hash
+var ErrBlobCorrupted = errors.New("file hash verification failed")
+
 type Storage struct {
-	db           *database.EndershareDB
-	aesKey       []byte
-	dataDir      string
-	nextFolderID int
+	db      *database.EndershareDB
+	aesKey  []byte
+	dataDir string
+	tempDir string // Encrypted temp files, should share a filesystem with dataDir
+	index   metaIndex
+	fetch   BlobFetcher // Downloads placeholder blobs on first read, see SetBlobFetcher
+	cold    ColdStore   // Where blobs are offloaded to, see OffloadBlob
 }
 
-// NewStorage creates a new storage instance
+// NewStorage creates a new storage instance keeping its blobs in the
+// configured data directory, see DataDir
 func NewStorage(db *database.EndershareDB, aesKey []byte) *Storage {
-	dataDir := "./data"
+	return NewStorageIn(db, aesKey, DataDir(db))
+}
+
+// NewStorageIn creates a storage instance keeping its blobs in dataDir
+func NewStorageIn(db *database.EndershareDB, aesKey []byte, dataDir string) *Storage {
 	os.MkdirAll(dataDir, 0755)
 
+	tempDir := db.GetTempDir()
+	if tempDir == "" {
+		tempDir = filepath.Join(dataDir, "tmp")
+	}
+	if err := os.MkdirAll(tempDir, 0700); err != nil {
+		fmt.Println("Warning: Temp directory unavailable, using data directory:", err)
+		tempDir = dataDir
+	}
+
 	s := &Storage{
-		db:           db,
-		aesKey:       aesKey,
-		dataDir:      dataDir,
-		nextFolderID: loadNextFolderID(db, aesKey),
+		db:      db,
+		aesKey:  aesKey,
+		dataDir: dataDir,
+		tempDir: tempDir,
+		cold:    openColdStore(db),
 	}
+	db.WatchData(s.applyDataChange)
+
+	s.RecoverPendingBlobs()
+	s.RecoverImport()
 
 	return s
 }
 
-// ReloadNextFolderID rescans the database to update the folder ID counter.
-// Must be called after syncing data from other devices.
-func (s *Storage) ReloadNextFolderID() {
-	s.nextFolderID = loadNextFolderID(s.db, s.aesKey)
+// RecoverImport undoes a folder import that didn't finish, see
+// AddFolderFromPath, and removes the blobs only it referenced
+func (s *Storage) RecoverImport() {
+	removed, err := s.db.RollbackImport()
+	if err != nil {
+		fmt.Println("Warning: Failed to roll back unfinished import:", err)
+		return
+	}
+	for _, e := range removed {
+		if e.Value != nil {
+			s.abandonBlob(e.Value)
+		}
+	}
+	if len(removed) > 0 {
+		fmt.Printf("Rolled back an unfinished import, removing %d entries\n", len(removed))
+	}
+}
+
+// RecoverPendingBlobs removes blobs left behind by an AddFile that crashed
+// before its metadata was committed, along with stray temp files.
+func (s *Storage) RecoverPendingBlobs() {
+	for _, blobHash := range s.db.GetPendingBlobs() {
+		s.abandonBlob(blobHash)
+	}
+
+	var tempFiles []string
+	for _, pattern := range []string{
+		filepath.Join(s.dataDir, "temp_*"), // Written by older versions
+		filepath.Join(s.dataDir, moveTempPattern),
+		filepath.Join(s.tempDir, encryptTempPattern),
+	} {
+		matches, _ := filepath.Glob(pattern)
+		tempFiles = append(tempFiles, matches...)
+	}
+	for _, path := range tempFiles {
+		os.Remove(path)
+	}
+}
+
+// SetTempDir changes where encrypted temp files are written and persists it.
+// An empty dir restores the default inside the data directory.
+func (s *Storage) SetTempDir(dir string) error {
+	tempDir := dir
+	if tempDir == "" {
+		tempDir = filepath.Join(s.dataDir, "tmp")
+	}
+	if err := os.MkdirAll(tempDir, 0700); err != nil {
+		return err
+	}
+	if err := s.db.SetTempDir(dir); err != nil {
+		return err
+	}
+	s.tempDir = tempDir
+	return nil
+}
+
+// abandonBlob deletes an uncommitted blob unless committed metadata also references it
+func (s *Storage) abandonBlob(blobHash []byte) {
+	if !s.db.BlobReferenced(blobHash) {
+		if err := os.Remove(filepath.Join(s.dataDir, hexEncode(blobHash))); err != nil && !os.IsNotExist(err) {
+			fmt.Println("Warning: Failed to remove uncommitted blob:", err)
+			return
+		}
+	}
+	s.db.RemovePendingBlob(blobHash)
 }
 
 // BackfillFolderTags computes folder_tag for any entries missing it (e.g. after sync).
@@ -56,21 +147,24 @@ func (s *Storage) BackfillFolderTags() {
 			continue
 		}
 
-		var parentFolder int = -1
+		var parentFolder FolderID
+		found := false
 
 		var fileEntry FileEntry
 		if err := json.Unmarshal(decryptedKey, &fileEntry); err == nil && fileEntry.Type == TypeFile {
 			parentFolder = fileEntry.FolderID
+			found = true
 		}
 
-		if parentFolder == -1 {
+		if !found {
 			var folderEntry FolderEntry
 			if err := json.Unmarshal(decryptedKey, &folderEntry); err == nil && folderEntry.Type == TypeFolder {
 				parentFolder = folderEntry.ParentFolderID
+				found = true
 			}
 		}
 
-		if parentFolder >= 0 {
+		if found {
 			tag := computeFolderTag(parentFolder, s.aesKey)
 			s.db.SetFolderTag(entry.Key, tag)
 		}
@@ -78,35 +172,88 @@ func (s *Storage) BackfillFolderTags() {
 }
 
 // AddFile adds a file from local filesystem to encrypted storage
-func (s *Storage) AddFile(localPath string, name string, folderID int) error {
-	_, err := s.AddFileWithEntry(localPath, name, folderID)
+func (s *Storage) AddFile(localPath string, name string, folderID FolderID) error {
+	_, _, err := s.AddFileWithEntry(localPath, name, folderID)
 	return err
 }
 
-// AddFileWithEntry adds a file and returns the data entry info for publishing
-func (s *Storage) AddFileWithEntry(localPath string, name string, folderID int) (*database.DataEntry, error) {
-	originalSize, err := getOriginalFileSize(localPath)
+// AddFileWithEntry adds a file and returns the data entry info for publishing,
+// see AddFileFromReader
+func (s *Storage) AddFileWithEntry(localPath string, name string, folderID FolderID) (replaced, added *database.DataEntry, err error) {
+	srcFile, err := os.Open(longPath(localPath))
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
+	defer srcFile.Close()
 
-	tempFile := filepath.Join(s.dataDir, "temp_"+name)
-	fileHash, err := streamEncryptFileWithHash(localPath, tempFile, s.aesKey)
-	if err != nil {
-		return nil, err
+	photo, r := peekPhotoInfo(srcFile)
+	return s.addFile(r, name, folderID, photo, statAttrs(srcFile))
+}
+
+// AddFileFromReader encrypts the contents of r into storage as a new file and
+// returns the data entry info for publishing. Plaintext never touches disk.
+// If the folder already has a file with this name, it becomes the newest
+// version of the new entry and its entry is returned as replaced for a
+// DELETE update; replaced is nil otherwise. With rename-duplicates on, the
+// new file gets a numbered name such as "report (1).pdf" instead. A name
+// that isn't a single path element is refused with ErrInvalidName.
+func (s *Storage) AddFileFromReader(r io.Reader, name string, folderID FolderID) (replaced, added *database.DataEntry, err error) {
+	photo, r := peekPhotoInfo(r)
+	return s.addFile(r, name, folderID, photo, nil)
+}
+
+// addFile stores the content of r as a file. attrs are those of the local
+// file it is read from, nil for other readers.
+func (s *Storage) addFile(r io.Reader, name string, folderID FolderID, photo *PhotoInfo, attrs *fileAttrs) (replaced, added *database.DataEntry, err error) {
+	if err := checkEntryName(name); err != nil {
+		return nil, nil, err
+	}
+	policy := LoadPolicy(s.db)
+	if err := policy.CheckName(name); err != nil {
+		return nil, nil, err
+	}
+	existing, existingFile, err := s.findFile(name, folderID)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, nil, err
+	}
+	if existing != nil && s.db.GetRenameDuplicates() {
+		if name, err = s.freeName(TypeFile, name, folderID); err != nil {
+			return nil, nil, err
+		}
+		existing, existingFile = nil, nil
+	}
+	// Encryption only grows the file, so stop reading once the plaintext
+	// alone is over the limit; commitFile refuses the result
+	if policy.MaxFileSize > 0 {
+		r = io.LimitReader(r, policy.MaxFileSize+1)
 	}
 
-	// Get encrypted file size for transfer/sync
-	encryptedSize, err := getOriginalFileSize(tempFile)
+	key, sealedKey, sealedTo, err := s.newBlobKey(folderID)
 	if err != nil {
-		os.Remove(tempFile)
-		return nil, err
+		return nil, nil, err
 	}
 
-	finalPath := filepath.Join(s.dataDir, hexEncode(fileHash))
-	if err := os.Rename(tempFile, finalPath); err != nil {
+	// Only vault-key content can be found again, drop box files have keys of their own
+	var contentHash hash.Hash
+	if sealedKey == nil {
+		contentHash = s.newContentHash()
+	}
+
+	keyEpoch := s.db.GetKeyEpoch()
+	codec := s.fileCodec(name, photo)
+	tempFile, fileHash, originalSize, err := streamEncryptWithHash(r, s.tempDir, key, keyEpoch, codec, contentHash)
+	if err != nil {
+		return nil, nil, err
+	}
+	if policy.MaxFileSize > 0 && originalSize > policy.MaxFileSize {
 		os.Remove(tempFile)
-		return nil, err
+		return nil, nil, fmt.Errorf("%w: file exceeds the %d byte file limit", ErrPolicyViolation, policy.MaxFileSize)
+	}
+	if contentHash != nil && s.db.GetDedupeFiles() {
+		if src, ok := s.storedContent(contentHash.Sum(nil)); ok {
+			os.Remove(tempFile)
+			return s.addReference(src, name, folderID, attrs)
+		}
 	}
 
 	now := time.Now()
@@ -117,8 +264,91 @@ func (s *Storage) AddFileWithEntry(localPath string, name string, folderID int)
 		ModifiedAt: now,
 		Size:       originalSize,
 		FolderID:   folderID,
+		SealedKey:  sealedKey,
+		SealedTo:   sealedTo,
+		Codec:      codec,
+		Photo:      photo,
+	}
+	if contentHash != nil {
+		fileEntry.ContentHash = contentHash.Sum(nil)
+	}
+	attrs.apply(&fileEntry)
+	if existing != nil {
+		fileEntry.CreatedAt = existingFile.CreatedAt
+		fileEntry.Tags = existingFile.Tags
+		fileEntry.Note = existingFile.Note
+		fileEntry.Lock = existingFile.Lock
+		fileEntry.Versions = pushVersion(existingFile.Versions, *existing, existingFile)
+	}
+
+	added, err = s.commitFile(tempFile, fileHash, keyEpoch, fileEntry)
+	if err == nil && contentHash != nil {
+		if err := s.db.SetContentHash(contentHash.Sum(nil), fileHash); err != nil {
+			fmt.Println("Warning: Failed to record content hash:", err)
+		}
+	}
+	if err != nil || existing == nil {
+		return nil, added, err
+	}
+
+	// The new entry is committed first so a crash leaves a duplicate rather than nothing
+	if err := s.db.DeleteData(existing.Key); err != nil {
+		return nil, added, err
+	}
+	return existing, added, nil
+}
+
+// commitFile moves an encrypted temp file into the data directory and
+// commits its metadata if the vault policy allows it. The temp file is
+// removed on failure.
+func (s *Storage) commitFile(tempFile string, fileHash []byte, keyEpoch uint32, fileEntry FileEntry) (*database.DataEntry, error) {
+	// Get encrypted file size for transfer/sync
+	encryptedSize, err := getOriginalFileSize(tempFile)
+	if err != nil {
+		os.Remove(tempFile)
+		return nil, err
+	}
+
+	policy := LoadPolicy(s.db)
+	_, vaultSize := s.db.GetStorageStats()
+	if err := policy.Check(fileEntry.Name, encryptedSize, vaultSize); err != nil {
+		os.Remove(tempFile)
+		return nil, err
+	}
+	if err := CheckQuota(s.db, encryptedSize); err != nil {
+		os.Remove(tempFile)
+		return nil, err
+	}
+
+	// Journal the blob before it becomes visible so a crash before the
+	// metadata commit leaves a record for RecoverPendingBlobs to clean up
+	if err := s.db.AddPendingBlob(fileHash); err != nil {
+		os.Remove(tempFile)
+		return nil, err
 	}
 
+	finalPath := filepath.Join(s.dataDir, hexEncode(fileHash))
+	if err := moveIntoPlace(tempFile, finalPath); err != nil {
+		os.Remove(tempFile)
+		s.db.RemovePendingBlob(fileHash)
+		return nil, err
+	}
+	if err := syncDir(s.dataDir); err != nil {
+		s.abandonBlob(fileHash)
+		return nil, err
+	}
+
+	entry, err := s.putFileEntry(fileEntry, fileHash, encryptedSize, keyEpoch)
+	if err != nil {
+		s.abandonBlob(fileHash)
+		return nil, err
+	}
+	return entry, nil
+}
+
+// putFileEntry encrypts file metadata for a blob that is already in the data
+// directory and commits it together with the blob's journal entry
+func (s *Storage) putFileEntry(fileEntry FileEntry, fileHash []byte, encryptedSize int64, keyEpoch uint32) (*database.DataEntry, error) {
 	keyJSON, err := json.Marshal(fileEntry)
 	if err != nil {
 		return nil, err
@@ -130,200 +360,299 @@ func (s *Storage) AddFileWithEntry(localPath string, name string, folderID int)
 	}
 
 	hash := crypto.ComputeDataHash(encryptedKey, fileHash, encryptedSize)
-	folderTag := computeFolderTag(folderID, s.aesKey)
+	folderTag := computeFolderTag(fileEntry.FolderID, s.aesKey)
 
-	if err := s.db.PutDataWithTag(encryptedKey, fileHash, encryptedSize, hash, folderTag); err != nil {
+	// The metadata row and the journal entry are committed together
+	if err := s.db.CommitBlobData(encryptedKey, fileHash, encryptedSize, hash, keyEpoch, folderTag); err != nil {
 		return nil, err
 	}
 
 	return &database.DataEntry{
-		Key:   encryptedKey,
-		Value: fileHash,
-		Size:  encryptedSize,
-		Hash:  hash,
+		Key:      encryptedKey,
+		Value:    fileHash,
+		Size:     encryptedSize,
+		Hash:     hash,
+		KeyEpoch: keyEpoch,
 	}, nil
 }
 
-// GetFile exports a file from encrypted storage to local filesystem
-func (s *Storage) GetFile(name string, folderID int, destPath string) error {
-	entries, err := s.db.GetAllData()
+// GetFile exports a file from encrypted storage to local filesystem with the
+// mode and modification time it was added with. The content of a placeholder
+// is fetched first, see SetBlobFetcher.
+func (s *Storage) GetFile(name string, folderID FolderID, destPath string) error {
+	entry, fileEntry, err := s.findFile(name, folderID)
 	if err != nil {
 		return err
 	}
+	if err := s.hydrate(entry); err != nil {
+		return err
+	}
+	return s.exportFile(entry.Value, fileEntry, destPath)
+}
 
-	for _, entry := range entries {
-		decryptedKey, err := crypto.Decrypt(entry.Key, s.aesKey)
-		if err != nil {
-			continue
-		}
+// exportFile decrypts the blob of a file entry to destPath, or recreates the
+// link the entry stands for
+func (s *Storage) exportFile(blobHash []byte, fileEntry *FileEntry, destPath string) error {
+	destPath = longPath(destPath)
+	key, err := s.blobKey(fileEntry)
+	if err != nil {
+		return err
+	}
 
-		var fileEntry FileEntry
-		if err := json.Unmarshal(decryptedKey, &fileEntry); err != nil {
-			continue
+	srcPath := filepath.Join(s.dataDir, hexEncode(blobHash))
+	if fileEntry.Symlink {
+		var target bytes.Buffer
+		if err := s.decryptContent(&target, srcPath, key, fileEntry); err != nil {
+			return err
 		}
+		return restoreLink(destPath, target.Bytes())
+	}
+	if err := s.streamDecryptFile(srcPath, destPath, key, fileEntry); err != nil {
+		return err
+	}
+	return restoreAttrs(destPath, fileEntry)
+}
 
-		if fileEntry.Type == TypeFile && fileEntry.Name == name && fileEntry.FolderID == folderID {
-			srcPath := filepath.Join(s.dataDir, hexEncode(entry.Value))
-			return streamDecryptFile(srcPath, destPath, s.aesKey)
-		}
+// WriteFileTo decrypts a file from encrypted storage into w
+func (s *Storage) WriteFileTo(name string, folderID FolderID, w io.Writer) error {
+	entry, fileEntry, err := s.findFile(name, folderID)
+	if err != nil {
+		return err
+	}
+	if err := s.hydrate(entry); err != nil {
+		return err
+	}
+	key, err := s.blobKey(fileEntry)
+	if err != nil {
+		return err
+	}
+
+	return s.decryptContent(w, filepath.Join(s.dataDir, hexEncode(entry.Value)), key, fileEntry)
+}
+
+// OpenFileReader returns a reader of a file's plaintext, decrypted on the fly
+// as it is read. Closing the reader before the end stops the decryption.
+func (s *Storage) OpenFileReader(name string, folderID FolderID) (io.ReadCloser, error) {
+	entry, fileEntry, err := s.findFile(name, folderID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.hydrate(entry); err != nil {
+		return nil, err
+	}
+	key, err := s.blobKey(fileEntry)
+	if err != nil {
+		return nil, err
+	}
+	srcPath := filepath.Join(s.dataDir, hexEncode(entry.Value))
+	if _, err := os.Stat(srcPath); err != nil {
+		return nil, err
 	}
 
-	return fmt.Errorf("file not found: %s in folder %d", name, folderID)
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(s.decryptContent(pw, srcPath, key, fileEntry))
+	}()
+	return pr, nil
+}
+
+// OpenFileSeeker returns a reader of a file's plaintext that can seek, for
+// serving byte ranges. Only the chunks holding the bytes read are decrypted.
+// Compressed files fail with ErrNotSeekable and can only be streamed.
+func (s *Storage) OpenFileSeeker(name string, folderID FolderID) (io.ReadSeekCloser, error) {
+	entry, fileEntry, err := s.findFile(name, folderID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.hydrate(entry); err != nil {
+		return nil, err
+	}
+	key, err := s.blobKey(fileEntry)
+	if err != nil {
+		return nil, err
+	}
+	return openBlobSeeker(filepath.Join(s.dataDir, hexEncode(entry.Value)), key, fileEntry.Codec)
+}
+
+// StatFile returns the decrypted metadata of a file
+func (s *Storage) StatFile(name string, folderID FolderID) (*FileEntry, error) {
+	_, fileEntry, err := s.findFile(name, folderID)
+	return fileEntry, err
+}
+
+// findFile returns the data entry and decrypted metadata of a file by name and folder
+func (s *Storage) findFile(name string, folderID FolderID) (*database.DataEntry, *FileEntry, error) {
+	e, ok, err := s.lookupName(TypeFile, name, folderID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !ok {
+		return nil, nil, fmt.Errorf("file %w: %s in folder %s", ErrNotFound, name, folderID)
+	}
+	return &e.data, &e.file, nil
+}
+
+// GetFolder returns the folder entry for a folder ID
+func (s *Storage) GetFolder(folderID FolderID) (*FolderEntry, error) {
+	e, ok, err := s.lookupFolder(folderID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("folder %w: %s", ErrNotFound, folderID)
+	}
+	return &e.folder, nil
 }
 
 // CreateFolder creates a new folder
-func (s *Storage) CreateFolder(name string, parentFolderID int) (int, error) {
+func (s *Storage) CreateFolder(name string, parentFolderID FolderID) (FolderID, error) {
 	folderID, _, err := s.CreateFolderWithEntry(name, parentFolderID)
 	return folderID, err
 }
 
 // CreateFolderWithEntry creates a folder and returns the data entry info for publishing
-func (s *Storage) CreateFolderWithEntry(name string, parentFolderID int) (int, *database.DataEntry, error) {
-	folderID := s.nextFolderID
-	s.nextFolderID++
-
+func (s *Storage) CreateFolderWithEntry(name string, parentFolderID FolderID) (FolderID, *database.DataEntry, error) {
 	folderEntry := FolderEntry{
 		Type:           TypeFolder,
-		FolderID:       folderID,
+		FolderID:       NewFolderID(),
 		Name:           name,
 		ParentFolderID: parentFolderID,
 	}
+	entry, err := s.createFolder(folderEntry)
+	if err != nil {
+		return "", nil, err
+	}
+	return folderEntry.FolderID, entry, nil
+}
+
+// createFolder stores a new folder entry. Drop boxes only hold files, since a
+// subfolder would be readable by anyone with the vault key alone.
+func (s *Storage) createFolder(folderEntry FolderEntry) (*database.DataEntry, error) {
+	if !folderEntry.ParentFolderID.IsRoot() {
+		parent, err := s.GetFolder(folderEntry.ParentFolderID)
+		if err == nil && parent.DropBox {
+			return nil, fmt.Errorf("drop box %s can't contain folders", parent.Name)
+		}
+	}
+	name, err := s.claimName(TypeFolder, folderEntry.Name, folderEntry.ParentFolderID)
+	if err != nil {
+		return nil, err
+	}
+	folderEntry.Name = name
 
 	keyJSON, err := json.Marshal(folderEntry)
 	if err != nil {
-		return 0, nil, err
+		return nil, err
 	}
 
 	encryptedKey, err := crypto.Encrypt(keyJSON, s.aesKey)
 	if err != nil {
-		return 0, nil, err
+		return nil, err
 	}
 
 	hash := crypto.ComputeDataHash(encryptedKey, nil, 0)
-	folderTag := computeFolderTag(parentFolderID, s.aesKey)
+	folderTag := computeFolderTag(folderEntry.ParentFolderID, s.aesKey)
+	keyEpoch := s.db.GetKeyEpoch()
 
-	if err := s.db.PutDataWithTag(encryptedKey, nil, 0, hash, folderTag); err != nil {
-		return 0, nil, err
+	if err := s.db.PutDataWithTag(encryptedKey, nil, 0, hash, keyEpoch, folderTag); err != nil {
+		return nil, err
 	}
 
-	return folderID, &database.DataEntry{
-		Key:   encryptedKey,
-		Value: nil,
-		Size:  0,
-		Hash:  hash,
+	return &database.DataEntry{
+		Key:      encryptedKey,
+		Value:    nil,
+		Size:     0,
+		Hash:     hash,
+		KeyEpoch: keyEpoch,
 	}, nil
 }
 
 // DeleteFile removes a file from storage
-func (s *Storage) DeleteFile(name string, folderID int) error {
+func (s *Storage) DeleteFile(name string, folderID FolderID) error {
 	_, err := s.DeleteFileWithEntry(name, folderID)
 	return err
 }
 
 // DeleteFileWithEntry removes a file and returns the data entry info for publishing
-func (s *Storage) DeleteFileWithEntry(name string, folderID int) (*database.DataEntry, error) {
-	entries, err := s.db.GetAllData()
+func (s *Storage) DeleteFileWithEntry(name string, folderID FolderID) (*database.DataEntry, error) {
+	entry, _, err := s.findFile(name, folderID)
 	if err != nil {
 		return nil, err
 	}
-
-	for _, entry := range entries {
-		decryptedKey, err := crypto.Decrypt(entry.Key, s.aesKey)
-		if err != nil {
-			continue
-		}
-
-		var fileEntry FileEntry
-		if err := json.Unmarshal(decryptedKey, &fileEntry); err != nil {
-			continue
-		}
-
-		if fileEntry.Type == TypeFile && fileEntry.Name == name && fileEntry.FolderID == folderID {
-			if err := s.db.DeleteData(entry.Key); err != nil {
-				return nil, err
-			}
-			return &database.DataEntry{
-				Key:   entry.Key,
-				Value: entry.Value,
-				Size:  entry.Size,
-				Hash:  entry.Hash,
-			}, nil
-		}
+	if err := s.db.DeleteData(entry.Key); err != nil {
+		return nil, err
 	}
-
-	return nil, fmt.Errorf("file not found: %s in folder %d", name, folderID)
+	return entry, nil
 }
 
 // DeleteFolder removes a folder
-func (s *Storage) DeleteFolder(folderID int) error {
+func (s *Storage) DeleteFolder(folderID FolderID) error {
 	_, err := s.DeleteFolderWithEntry(folderID)
 	return err
 }
 
-// DeleteFolderWithEntry removes a folder and returns the data entry info for publishing
-func (s *Storage) DeleteFolderWithEntry(folderID int) (*database.DataEntry, error) {
-	entries, err := s.db.GetAllData()
+// DeleteFolderWithEntry removes an empty folder and returns the data entry info for publishing.
+// Use DeleteFolderTree to remove a folder with its contents.
+func (s *Storage) DeleteFolderWithEntry(folderID FolderID) (*database.DataEntry, error) {
+	folder, ok, err := s.lookupFolder(folderID)
 	if err != nil {
 		return nil, err
 	}
-
-	for _, entry := range entries {
-		decryptedKey, err := crypto.Decrypt(entry.Key, s.aesKey)
-		if err != nil {
-			continue
-		}
-
-		var folderEntry FolderEntry
-		if err := json.Unmarshal(decryptedKey, &folderEntry); err != nil {
-			continue
-		}
-
-		if folderEntry.Type == TypeFolder && folderEntry.FolderID == folderID {
-			if err := s.db.DeleteData(entry.Key); err != nil {
-				return nil, err
-			}
-			return &database.DataEntry{
-				Key:   entry.Key,
-				Value: entry.Value,
-				Size:  entry.Size,
-				Hash:  entry.Hash,
-			}, nil
-		}
+	if !ok {
+		return nil, fmt.Errorf("folder %w: %s", ErrNotFound, folderID)
 	}
-
-	return nil, fmt.Errorf("folder not found: %d", folderID)
+	nonEmpty, err := s.hasChildren(folderID)
+	if err != nil {
+		return nil, err
+	}
+	if nonEmpty {
+		return nil, fmt.Errorf("%w: %s", ErrFolderNotEmpty, folder.name)
+	}
+	if err := s.db.DeleteData(folder.data.Key); err != nil {
+		return nil, err
+	}
+	return &folder.data, nil
 }
 
-// ListFolder lists files and folders in a folder using the indexed folder_tag column
-func (s *Storage) ListFolder(folderID int) ([]interface{}, error) {
-	tag := computeFolderTag(folderID, s.aesKey)
-	entries, err := s.db.GetDataByFolderTag(tag)
+// ListFolder lists files and folders in a folder
+func (s *Storage) ListFolder(folderID FolderID) ([]interface{}, error) {
+	children, err := s.lookupChildren(folderID)
 	if err != nil {
 		return nil, err
 	}
 
 	var results []interface{}
-	for _, entry := range entries {
-		decryptedKey, err := crypto.Decrypt(entry.Key, s.aesKey)
-		if err != nil {
+	for _, e := range children {
+		// Trashed entries are only listed by ListTrash
+		if e.trashed != nil {
 			continue
 		}
-
-		var fileEntry FileEntry
-		if err := json.Unmarshal(decryptedKey, &fileEntry); err == nil && fileEntry.Type == TypeFile {
-			results = append(results, fileEntry)
-			continue
-		}
-
-		var folderEntry FolderEntry
-		if err := json.Unmarshal(decryptedKey, &folderEntry); err == nil && folderEntry.Type == TypeFolder {
-			results = append(results, folderEntry)
+		if e.typ == TypeFile {
+			results = append(results, e.file)
+		} else {
+			results = append(results, e.folder)
 		}
 	}
 
 	return results, nil
 }
 
+// BlobName returns the name of a file whose content is the blob, false if no
+// file references it
+func (s *Storage) BlobName(blobHash []byte) (string, bool) {
+	var name string
+	var ok bool
+	err := s.withIndex(func(ix *metaIndex) {
+		for _, e := range ix.byKey {
+			if e.typ == TypeFile && bytes.Equal(e.data.Value, blobHash) {
+				name, ok = e.name, true
+				return
+			}
+		}
+	})
+	return name, ok && err == nil
+}
+
 // FileExists checks if a file exists in storage by its hash
 func (s *Storage) FileExists(fileHash []byte) bool {
 	filePath := filepath.Join(s.dataDir, hexEncode(fileHash))
@@ -331,10 +660,18 @@ func (s *Storage) FileExists(fileHash []byte) bool {
 	return err == nil
 }
 
-// OpenFileForReading opens a file for reading and returns the file handle and total size
+// OpenFileForReading opens a file for reading and returns the file handle
+// and total size. A blob offloaded to cold storage is fetched back first.
 func (s *Storage) OpenFileForReading(fileHash []byte) (*os.File, int64, error) {
 	filePath := filepath.Join(s.dataDir, hexEncode(fileHash))
 	file, err := os.Open(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		if cold, coldErr := s.fetchColdBlob(fileHash); cold && coldErr != nil {
+			return nil, 0, coldErr
+		} else if cold {
+			file, err = os.Open(filePath)
+		}
+	}
 	if err != nil {
 		return nil, 0, err
 	}
@@ -360,7 +697,8 @@ func (s *Storage) AppendFileData(fileHash []byte, data []byte) error {
 	return err
 }
 
-// ValidateOrRemoveFile verifies the hash of a stored file and removes it if invalid
+// ValidateOrRemoveFile verifies the hash of a stored file and removes it if
+// invalid, failing with ErrBlobCorrupted
 func (s *Storage) ValidateOrRemoveFile(fileHash []byte) error {
 	f, _, err := s.OpenFileForReading(fileHash)
 	if err != nil {
@@ -386,7 +724,7 @@ func (s *Storage) ValidateOrRemoveFile(fileHash []byte) error {
 	if !bytes.Equal(computedHash, fileHash) {
 		f.Close()
 		os.Remove(f.Name())
-		return fmt.Errorf("file hash verification failed expected %s, actual %s", hexEncode(fileHash), hexEncode(computedHash))
+		return fmt.Errorf("%w expected %s, actual %s", ErrBlobCorrupted, hexEncode(fileHash), hexEncode(computedHash))
 	}
 
 	return nil
@@ -0,0 +1,169 @@
+package storage
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/notassigned/endershare/internal/database"
+)
+
+// maxTagLen bounds the length of a tag in bytes
+const maxTagLen = 64
+
+// TagCount is a tag and the number of entries carrying it
+type TagCount struct {
+	Tag   string
+	Count int
+}
+
+// NormalizeTag returns tag trimmed and lowercased, so tags match regardless
+// of case. Empty tags, tags over maxTagLen bytes and tags with control
+// characters are refused.
+func NormalizeTag(tag string) (string, error) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if tag == "" || len(tag) > maxTagLen || strings.ContainsFunc(tag, unicode.IsControl) {
+		return "", fmt.Errorf("%w: tag %q", ErrInvalidName, tag)
+	}
+	return tag, nil
+}
+
+// editTags returns the sorted tags after adding and removing the given ones,
+// and whether they differ from tags
+func editTags(tags, add, remove []string) ([]string, bool, error) {
+	edited := slices.Clone(tags)
+	for _, t := range add {
+		t, err := NormalizeTag(t)
+		if err != nil {
+			return nil, false, err
+		}
+		if !slices.Contains(edited, t) {
+			edited = append(edited, t)
+		}
+	}
+	for _, t := range remove {
+		if t, err := NormalizeTag(t); err == nil {
+			edited = slices.DeleteFunc(edited, func(e string) bool { return e == t })
+		}
+	}
+	slices.Sort(edited)
+	if len(edited) == 0 {
+		edited = nil
+	}
+	return edited, !slices.Equal(edited, tags), nil
+}
+
+// TagFile adds tags to and removes tags from a file. Tags live in the
+// encrypted metadata, so the old entry is returned along with the new one for
+// a MODIFY update; both are nil when the tags stay the same.
+func (s *Storage) TagFile(name string, folderID FolderID, add, remove []string) (removed, added *database.DataEntry, err error) {
+	entry, fileEntry, err := s.findFile(name, folderID)
+	if err != nil {
+		return nil, nil, err
+	}
+	tags, changed, err := editTags(fileEntry.Tags, add, remove)
+	if err != nil || !changed {
+		return nil, nil, err
+	}
+	fileEntry.Tags = tags
+	return s.replaceEntry(*entry, fileEntry, folderID)
+}
+
+// TagFolder adds tags to and removes tags from a folder, see TagFile. The
+// folder's contents keep their own tags.
+func (s *Storage) TagFolder(folderID FolderID, add, remove []string) (removed, added *database.DataEntry, err error) {
+	if folderID.IsRoot() {
+		return nil, nil, fmt.Errorf("the root folder can't be tagged")
+	}
+	folder, ok, err := s.lookupFolder(folderID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !ok || folder.trashed != nil {
+		return nil, nil, fmt.Errorf("folder %w: %s", ErrNotFound, folderID)
+	}
+	tags, changed, err := editTags(folder.folder.Tags, add, remove)
+	if err != nil || !changed {
+		return nil, nil, err
+	}
+	folder.folder.Tags = tags
+	return s.replaceEntry(folder.data, folder.folder, folder.parent)
+}
+
+// ListTagged returns the files and folders carrying tag, folders first and
+// then by name, as FileEntry and FolderEntry values like ListFolder. Entries
+// in the trash, directly or through a folder above them, are left out.
+func (s *Storage) ListTagged(tag string) ([]interface{}, error) {
+	tag, err := NormalizeTag(tag)
+	if err != nil {
+		return nil, err
+	}
+	index, err := s.loadIndex()
+	if err != nil {
+		return nil, err
+	}
+	hidden := hiddenFolders(index)
+
+	var tagged []indexEntry
+	for _, e := range index {
+		if e.trashed != nil || hidden[e.parent] || !slices.Contains(entryTags(e), tag) {
+			continue
+		}
+		tagged = append(tagged, e)
+	}
+	slices.SortStableFunc(tagged, func(a, b indexEntry) int {
+		if a.typ != b.typ {
+			if a.typ == TypeFolder {
+				return -1
+			}
+			return 1
+		}
+		return cmp.Compare(a.name, b.name)
+	})
+
+	results := make([]interface{}, 0, len(tagged))
+	for _, e := range tagged {
+		if e.typ == TypeFile {
+			results = append(results, e.file)
+		} else {
+			results = append(results, e.folder)
+		}
+	}
+	return results, nil
+}
+
+// ListTags returns every tag in use outside the trash with the number of
+// entries carrying it, sorted by tag
+func (s *Storage) ListTags() ([]TagCount, error) {
+	index, err := s.loadIndex()
+	if err != nil {
+		return nil, err
+	}
+	hidden := hiddenFolders(index)
+
+	counts := make(map[string]int)
+	for _, e := range index {
+		if e.trashed != nil || hidden[e.parent] {
+			continue
+		}
+		for _, t := range entryTags(e) {
+			counts[t]++
+		}
+	}
+	tags := make([]TagCount, 0, len(counts))
+	for t, n := range counts {
+		tags = append(tags, TagCount{Tag: t, Count: n})
+	}
+	slices.SortFunc(tags, func(a, b TagCount) int { return cmp.Compare(a.Tag, b.Tag) })
+	return tags, nil
+}
+
+// entryTags returns the tags of a file or folder entry
+func entryTags(e indexEntry) []string {
+	if e.typ == TypeFile {
+		return e.file.Tags
+	}
+	return e.folder.Tags
+}
@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif" // Registers the GIF decoder
+	"image/jpeg"
+	_ "image/png" // Registers the PNG decoder
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// ThumbnailProcessor names the content metadata holding a file's thumbnail
+const ThumbnailProcessor = "thumbnail"
+
+const (
+	thumbnailSize    = 256 // Longer edge in pixels
+	thumbnailQuality = 80
+	thumbnailSamples = 4 // Source samples averaged per pixel along each axis
+
+	// Larger images are not thumbnailed, decoding them would take more
+	// memory than a small replica may have
+	maxThumbnailSource = 64 << 20
+	maxThumbnailPixels = 40 << 20
+)
+
+// thumbnailExts are the image types the standard library can decode
+var thumbnailExts = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".gif": true}
+
+func init() {
+	RegisterProcessor(thumbnailer{})
+}
+
+// thumbnailer makes small JPEG previews of images, so a file browser can
+// show them without decrypting whole files
+type thumbnailer struct{}
+
+func (thumbnailer) Name() string { return ThumbnailProcessor }
+
+func (thumbnailer) Accepts(file FileEntry) bool {
+	return !file.Symlink && file.Size <= maxThumbnailSource && thumbnailExts[strings.ToLower(filepath.Ext(file.Name))]
+}
+
+func (thumbnailer) Process(ctx context.Context, file FileEntry, r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxThumbnailSource+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxThumbnailSource {
+		return nil, fmt.Errorf("image is over %d bytes", maxThumbnailSource)
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > maxThumbnailPixels {
+		return nil, fmt.Errorf("image of %dx%d pixels is too large", cfg.Width, cfg.Height)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	if err := jpeg.Encode(&out, scaleDown(img, thumbnailSize), &jpeg.Options{Quality: thumbnailQuality}); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// scaleDown shrinks an image to fit maxEdge pixels, averaging a grid of
+// samples for each pixel. Transparent areas come out white, JPEG has no alpha.
+func scaleDown(src image.Image, maxEdge int) *image.RGBA {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	tw, th := w, h
+	if w > maxEdge || h > maxEdge {
+		if w >= h {
+			tw, th = maxEdge, max(1, h*maxEdge/w)
+		} else {
+			tw, th = max(1, w*maxEdge/h), maxEdge
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+	const n = thumbnailSamples * thumbnailSamples
+	for y := 0; y < th; y++ {
+		for x := 0; x < tw; x++ {
+			var r, g, bl, a uint32
+			for sy := 0; sy < thumbnailSamples; sy++ {
+				py := b.Min.Y + (y*thumbnailSamples+sy)*h/(th*thumbnailSamples)
+				for sx := 0; sx < thumbnailSamples; sx++ {
+					px := b.Min.X + (x*thumbnailSamples+sx)*w/(tw*thumbnailSamples)
+					cr, cg, cb, ca := src.At(px, py).RGBA()
+					r, g, bl, a = r+cr, g+cg, bl+cb, a+ca
+				}
+			}
+			// Colors are premultiplied, so white shows through what alpha leaves
+			white := 0xffff - a/n
+			dst.SetRGBA(x, y, color.RGBA{
+				R: uint8((r/n + white) >> 8),
+				G: uint8((g/n + white) >> 8),
+				B: uint8((bl/n + white) >> 8),
+				A: 0xff,
+			})
+		}
+	}
+	return dst
+}
+
+// Thumbnail returns the JPEG preview of an image file, at most thumbnailSize
+// pixels along its longer edge. Files added before thumbnails existed get
+// theirs now, unless the node runs low-resource. ErrNotFound means the file
+// is no image or has no thumbnail that can be made on this node yet.
+func (s *Storage) Thumbnail(name string, folderID FolderID) ([]byte, error) {
+	entry, fileEntry, err := s.findFile(name, folderID)
+	if err != nil {
+		return nil, err
+	}
+	p := thumbnailer{}
+	if !p.Accepts(*fileEntry) {
+		return nil, fmt.Errorf("thumbnail of %s %w", name, ErrNotFound)
+	}
+	if thumb, err := s.ContentMetadata(entry.Value, ThumbnailProcessor); err == nil {
+		return thumb, nil
+	}
+	if LowResource(s.db) || !s.FileExists(entry.Value) || s.db.GetDownloadProgress(entry.Value) < entry.Size {
+		return nil, fmt.Errorf("thumbnail of %s %w", name, ErrNotFound)
+	}
+	if err := s.runProcessor(context.Background(), p, entry.Value, fileEntry); err != nil {
+		return nil, err
+	}
+	return s.ContentMetadata(entry.Value, ThumbnailProcessor)
+}
@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/notassigned/endershare/internal/database"
+)
+
+// DefaultTrashRetention is how long trashed entries are kept before they are
+// deleted for good, unless the node configures another period
+const DefaultTrashRetention = 30 * 24 * time.Hour
+
+// TrashRetention returns how long trashed entries are kept on this node
+func TrashRetention(db *database.EndershareDB) time.Duration {
+	if d := db.GetTrashRetention(); d > 0 {
+		return d
+	}
+	return DefaultTrashRetention
+}
+
+// TrashItem is an entry in the trash. Contents of a trashed folder are not
+// listed; restoring the folder restores them.
+type TrashItem struct {
+	Hash      []byte
+	Type      EntryType
+	Name      string
+	FolderID  FolderID // Folder the entry was trashed from
+	Size      int64    // Original size for files
+	TrashedAt time.Time
+}
+
+// TrashFile moves a file to the trash. Like every metadata change this
+// replaces the entry, so the old one is returned for a DELETE update and the
+// new one for an ADD update.
+func (s *Storage) TrashFile(name string, folderID FolderID) (removed, added *database.DataEntry, err error) {
+	entry, fileEntry, err := s.findFile(name, folderID)
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	fileEntry.TrashedAt = &now
+	return s.replaceEntry(*entry, fileEntry, fileEntry.FolderID)
+}
+
+// TrashFolder moves a folder and everything in it to the trash, see TrashFile
+func (s *Storage) TrashFolder(folderID FolderID) (removed, added *database.DataEntry, err error) {
+	if folderID.IsRoot() {
+		return nil, nil, fmt.Errorf("the root folder can't be trashed")
+	}
+	entries, err := s.lookupFolders(folderID)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, e := range entries {
+		if e.trashed == nil {
+			now := time.Now()
+			e.folder.TrashedAt = &now
+			return s.replaceEntry(e.data, e.folder, e.parent)
+		}
+	}
+	return nil, nil, fmt.Errorf("folder %w: %s", ErrNotFound, folderID)
+}
+
+// ListTrash returns the trashed entries, most recently trashed first
+func (s *Storage) ListTrash() ([]TrashItem, error) {
+	index, err := s.loadIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	var items []TrashItem
+	for _, e := range index {
+		if e.trashed == nil {
+			continue
+		}
+		items = append(items, TrashItem{
+			Hash:      e.data.Hash,
+			Type:      e.typ,
+			Name:      e.name,
+			FolderID:  e.parent,
+			Size:      e.file.Size,
+			TrashedAt: *e.trashed,
+		})
+	}
+	slices.SortFunc(items, func(a, b TrashItem) int {
+		return b.TrashedAt.Compare(a.TrashedAt)
+	})
+	return items, nil
+}
+
+// RestoreFromTrash takes an entry, identified by its hash in ListTrash, out
+// of the trash. If the folder it came from is gone or trashed itself, the
+// entry is restored to the root folder. If its name was taken in the meantime
+// it is refused, or renamed with rename-duplicates on, see claimName. See
+// TrashFile for the return values.
+func (s *Storage) RestoreFromTrash(hash []byte) (removed, added *database.DataEntry, err error) {
+	e, ok, err := s.lookupHash(hash)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !ok || e.trashed == nil {
+		return nil, nil, fmt.Errorf("trashed entry %w", ErrNotFound)
+	}
+
+	parent := e.parent
+	if !parent.IsRoot() {
+		folders, err := s.lookupFolders(parent)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !slices.ContainsFunc(folders, func(f indexEntry) bool { return f.trashed == nil }) {
+			parent = RootFolderID
+		}
+	}
+	name, err := s.claimName(e.typ, e.name, parent)
+	if err != nil {
+		return nil, nil, err
+	}
+	if e.typ == TypeFile {
+		e.file.TrashedAt = nil
+		e.file.FolderID = parent
+		e.file.Name = name
+		return s.replaceEntry(e.data, e.file, parent)
+	}
+	e.folder.TrashedAt = nil
+	e.folder.ParentFolderID = parent
+	e.folder.Name = name
+	return s.replaceEntry(e.data, e.folder, parent)
+}
+
+// EmptyTrash deletes every trashed entry, folders with their contents. The
+// deleted entries are returned for publishing.
+func (s *Storage) EmptyTrash() ([]*database.DataEntry, error) {
+	return s.purgeTrash(time.Now())
+}
+
+// PurgeExpiredTrash deletes entries that have been in the trash longer than
+// retention, see EmptyTrash
+func (s *Storage) PurgeExpiredTrash(retention time.Duration) ([]*database.DataEntry, error) {
+	return s.purgeTrash(time.Now().Add(-retention))
+}
+
+// purgeTrash deletes entries trashed before cutoff. Folders go first and take
+// their contents with them; entries already deleted that way are skipped.
+func (s *Storage) purgeTrash(cutoff time.Time) ([]*database.DataEntry, error) {
+	index, err := s.loadIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	var deleted []*database.DataEntry
+	gone := make(map[string]bool)
+	for _, e := range index {
+		if e.typ != TypeFolder || e.trashed == nil || e.trashed.After(cutoff) || gone[string(e.data.Key)] {
+			continue
+		}
+		entries, err := s.DeleteFolderTree(e.id)
+		deleted = append(deleted, entries...)
+		for _, entry := range entries {
+			gone[string(entry.Key)] = true
+		}
+		if err != nil {
+			return deleted, err
+		}
+	}
+	for i, e := range index {
+		if e.typ != TypeFile || e.trashed == nil || e.trashed.After(cutoff) || gone[string(e.data.Key)] {
+			continue
+		}
+		if err := s.db.DeleteData(e.data.Key); err != nil {
+			return deleted, err
+		}
+		deleted = append(deleted, &index[i].data)
+	}
+	return deleted, nil
+}
@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// A trashed folder hides every folder below it, and with them their files,
+// while folders beside it stay visible
+func TestTrashHidesSubtree(t *testing.T) {
+	s := newTestStorage(t, make([]byte, 32), false)
+	outer, err := s.CreateFolder("outer", RootFolderID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner, err := s.CreateFolder("inner", outer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deepest, err := s.CreateFolder("deepest", inner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	beside, err := s.CreateFolder("beside", RootFolderID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, folder := range map[string]FolderID{"hidden.txt": deepest, "shown.txt": beside} {
+		if _, _, err := s.AddFileFromReader(strings.NewReader(name), name, folder); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, _, err := s.TrashFolder(outer); err != nil {
+		t.Fatal(err)
+	}
+
+	index, err := s.loadIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hidden := hiddenFolders(index)
+	for _, id := range []FolderID{outer, inner, deepest} {
+		if !hidden[id] {
+			t.Errorf("folder %s below the trashed folder is not hidden", id)
+		}
+	}
+	if hidden[beside] || hidden[RootFolderID] {
+		t.Error("folder outside the trashed folder is hidden")
+	}
+
+	if results, err := s.Search("txt", false); err != nil || len(results) != 1 || !strings.HasSuffix(results[0].Path, "/shown.txt") {
+		t.Errorf("Search = %v, %v; want shown.txt only", results, err)
+	}
+	// Only the trashed folder itself is listed, its contents come back with it
+	if items, err := s.ListTrash(); err != nil || len(items) != 1 || items[0].Name != "outer" {
+		t.Errorf("ListTrash = %v, %v; want outer only", items, err)
+	}
+}
+
+// Restoring puts an entry back where it was trashed from, or in the root if
+// that folder is in the trash too
+func TestRestoreFromTrash(t *testing.T) {
+	s := newTestStorage(t, make([]byte, 32), false)
+	parent, err := s.CreateFolder("parent", RootFolderID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	child, err := s.CreateFolder("child", parent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.AddFileFromReader(strings.NewReader("content"), "note.txt", parent); err != nil {
+		t.Fatal(err)
+	}
+
+	_, trashedFolder, err := s.TrashFolder(child)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, trashedFile, err := s.TrashFile("note.txt", parent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.RestoreFromTrash(trashedFolder.Hash); err != nil {
+		t.Fatal(err)
+	}
+	if folder, err := s.GetFolder(child); err != nil || folder.ParentFolderID != parent {
+		t.Errorf("restored folder = %+v, %v; want it back in its parent", folder, err)
+	}
+
+	if _, _, err := s.TrashFolder(parent); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.RestoreFromTrash(trashedFile.Hash); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := s.ListFolder(RootFolderID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].(FileEntry).Name != "note.txt" {
+		t.Errorf("root lists %v, want the file restored from a trashed folder", entries)
+	}
+	if _, _, err := s.RestoreFromTrash(trashedFile.Hash); err == nil {
+		t.Error("entry no longer in the trash was restored again")
+	}
+}
+
+// Only entries trashed before the retention period are purged, trashed
+// folders together with their contents
+func TestPurgeExpiredTrash(t *testing.T) {
+	s := newTestStorage(t, make([]byte, 32), false)
+	old, err := s.CreateFolder("old", RootFolderID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, folder := range map[string]FolderID{"inside.txt": old, "old.txt": RootFolderID, "new.txt": RootFolderID} {
+		if _, _, err := s.AddFileFromReader(strings.NewReader(name), name, folder); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, _, err := s.TrashFolder(old); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.TrashFile("old.txt", RootFolderID); err != nil {
+		t.Fatal(err)
+	}
+	cutoff := time.Now()
+	time.Sleep(20 * time.Millisecond)
+	if _, _, err := s.TrashFile("new.txt", RootFolderID); err != nil {
+		t.Fatal(err)
+	}
+
+	deleted, err := s.PurgeExpiredTrash(time.Since(cutoff))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range deleted {
+		e, ok := s.decodeEntry(*entry)
+		if !ok {
+			t.Fatal("deleted entry does not decode")
+		}
+		names = append(names, e.name)
+	}
+	slices.Sort(names)
+	if got := strings.Join(names, ","); got != "inside.txt,old,old.txt" {
+		t.Errorf("purge deleted %s, want inside.txt,old,old.txt", got)
+	}
+	if items, err := s.ListTrash(); err != nil || len(items) != 1 || items[0].Name != "new.txt" {
+		t.Errorf("ListTrash after the purge = %v, %v; want new.txt only", items, err)
+	}
+}
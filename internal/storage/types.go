@@ -1,6 +1,9 @@
 package storage
 
-import "time"
+import (
+	"os"
+	"time"
+)
 
 type EntryType string
 
@@ -15,12 +18,64 @@ type FileEntry struct {
 	CreatedAt  time.Time `json:"createdAt"`
 	ModifiedAt time.Time `json:"modifiedAt"`
 	Size       int64     `json:"size"`
-	FolderID   int       `json:"folderId"`
+	FolderID   FolderID  `json:"folderId"`
+	// Permission bits of the local file it was added from, 0 if unknown.
+	// ModifiedAt is that file's modification time.
+	Mode os.FileMode `json:"mode,omitempty"`
+	// The content is the target of a symbolic link, which an export recreates
+	// as a link. Nodes that don't know the flag see a small text file.
+	Symlink bool `json:"symlink,omitempty"`
+
+	// Files added to a drop box are encrypted with their own key, sealed to the
+	// drop key of the folder named by SealedTo. Empty for vault-key blobs.
+	SealedKey []byte   `json:"sealedKey,omitempty"`
+	SealedTo  FolderID `json:"sealedTo,omitempty"`
+	// Own key of a file that was moved out of its drop box. The metadata is
+	// encrypted with the vault key, so the key is kept unsealed.
+	ContentKey []byte `json:"contentKey,omitempty"`
+	// Codec the content was compressed with before encryption, empty for none
+	Codec string `json:"codec,omitempty"`
+	// Hash of the plaintext keyed with a key derived from the vault key, so
+	// reads can be checked end to end and equal content found again however
+	// it was encrypted. Empty for drop box files and files added before it.
+	ContentHash []byte `json:"contentHash,omitempty"`
+
+	// Camera metadata of images, read from EXIF before encryption
+	Photo *PhotoInfo `json:"photo,omitempty"`
+
+	// Earlier contents of the file, oldest first, kept when it is re-added
+	Versions []FileVersion `json:"versions,omitempty"`
+
+	// Labels set by the user, lowercase and sorted, see TagFile
+	Tags []string `json:"tags,omitempty"`
+	// Free text set by the user, see SetNote
+	Note string `json:"note,omitempty"`
+	// Set while the file is checked out on a device, see LockFile
+	Lock *FileLock `json:"lock,omitempty"`
+
+	// Set while the content is kept outside the vault only, see ArchiveFile
+	Archive *ArchiveInfo `json:"archive,omitempty"`
+
+	// Set while the file is in the trash
+	TrashedAt *time.Time `json:"trashedAt,omitempty"`
 }
 
 type FolderEntry struct {
 	Type           EntryType `json:"type"`
-	FolderID       int       `json:"folderId"`
+	FolderID       FolderID  `json:"folderId"`
 	Name           string    `json:"name"`
-	ParentFolderID int       `json:"parentFolderId"`
+	ParentFolderID FolderID  `json:"parentFolderId"`
+
+	// Drop box folders accept files from designated peers and upload tokens
+	// that can't list or read them. Only the master can open what is dropped,
+	// see dropPrivateKey. Droppers are the peer IDs allowed to drop files.
+	DropBox       bool     `json:"dropBox,omitempty"`
+	DropPublicKey []byte   `json:"dropPublicKey,omitempty"`
+	Droppers      []string `json:"droppers,omitempty"`
+
+	// Labels set by the user, lowercase and sorted, see TagFolder
+	Tags []string `json:"tags,omitempty"`
+
+	// Set while the folder is in the trash; its contents go with it
+	TrashedAt *time.Time `json:"trashedAt,omitempty"`
 }
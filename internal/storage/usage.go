@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/notassigned/endershare/internal/database"
+)
+
+// ErrQuotaExceeded is returned when a blob would take this node past its storage quota
+var ErrQuotaExceeded = errors.New("storage quota exceeded")
+
+// Usage is how much a node stores, in encrypted bytes
+type Usage struct {
+	EncryptedBytes int64 // Stored locally, a blob shared by several entries counts once
+	Blobs          int64
+	Quota          int64 // Zero for no limit
+	Folders        []FolderUsage
+}
+
+// FolderUsage is the size of the files in a folder and its subfolders. A
+// blob shared by several entries counts for each entry.
+type FolderUsage struct {
+	FolderID FolderID
+	Name     string   // Empty for the root
+	Parent   FolderID // Empty for the root
+	Files    int
+	Bytes    int64
+}
+
+// Usage reports what this node stores and the size of every folder, largest first
+func (s *Storage) Usage() (Usage, error) {
+	usage := Usage{Quota: s.db.GetStorageQuota()}
+	usage.Blobs, usage.EncryptedBytes = s.db.GetStoredBlobStats()
+
+	index, err := s.loadIndex()
+	if err != nil {
+		return usage, err
+	}
+	parents := make(map[FolderID]FolderID)
+	folders := map[FolderID]*FolderUsage{RootFolderID: {FolderID: RootFolderID}}
+	for _, e := range index {
+		if e.typ == TypeFolder {
+			parents[e.id] = e.parent
+			folders[e.id] = &FolderUsage{FolderID: e.id, Name: e.name, Parent: cmp.Or(e.parent, RootFolderID)}
+		}
+	}
+	for _, e := range index {
+		if e.typ != TypeFile {
+			continue
+		}
+		// Walk up to the root, guarding against parent cycles
+		seen := make(map[FolderID]bool)
+		for id := e.parent; !seen[id]; id = parents[id] {
+			seen[id] = true
+			if id.IsRoot() {
+				id = RootFolderID
+			}
+			if f, ok := folders[id]; ok {
+				f.Files++
+				f.Bytes += e.data.Size
+			}
+			if id == RootFolderID {
+				break
+			}
+		}
+	}
+
+	for _, f := range folders {
+		usage.Folders = append(usage.Folders, *f)
+	}
+	slices.SortFunc(usage.Folders, func(a, b FolderUsage) int {
+		return cmp.Or(cmp.Compare(b.Bytes, a.Bytes), cmp.Compare(a.Name, b.Name))
+	})
+	return usage, nil
+}
+
+// CheckQuota refuses a blob of size bytes that would take the node past its
+// storage quota
+func CheckQuota(db *database.EndershareDB, size int64) error {
+	quota := db.GetStorageQuota()
+	if quota == 0 {
+		return nil
+	}
+	_, stored := db.GetStoredBlobStats()
+	if stored+size > quota {
+		return fmt.Errorf("%w: %d of %d bytes used, %d more needed", ErrQuotaExceeded, stored, quota, size)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/notassigned/endershare/internal/database"
+)
+
+// maxFileVersions is how many earlier versions a file keeps; the oldest is
+// dropped first
+const maxFileVersions = 16
+
+// FileVersion is an earlier content of a file. Its blob stays in the data
+// directory under BlobHash so the version can be restored.
+type FileVersion struct {
+	BlobHash    []byte      `json:"blobHash"`
+	BlobSize    int64       `json:"blobSize"` // Encrypted size
+	KeyEpoch    uint32      `json:"keyEpoch"`
+	Size        int64       `json:"size"`
+	ModifiedAt  time.Time   `json:"modifiedAt"`
+	Mode        os.FileMode `json:"mode,omitempty"`
+	Symlink     bool        `json:"symlink,omitempty"`
+	SealedKey   []byte      `json:"sealedKey,omitempty"`
+	SealedTo    FolderID    `json:"sealedTo,omitempty"`
+	ContentKey  []byte      `json:"contentKey,omitempty"`
+	Codec       string      `json:"codec,omitempty"`
+	ContentHash []byte      `json:"contentHash,omitempty"`
+	Photo       *PhotoInfo  `json:"photo,omitempty"`
+}
+
+// pushVersion appends the current content of a file to its version chain
+func pushVersion(versions []FileVersion, entry database.DataEntry, fileEntry *FileEntry) []FileVersion {
+	versions = append(slices.Clone(versions), FileVersion{
+		BlobHash:    entry.Value,
+		BlobSize:    entry.Size,
+		KeyEpoch:    entry.KeyEpoch,
+		Size:        fileEntry.Size,
+		ModifiedAt:  fileEntry.ModifiedAt,
+		Mode:        fileEntry.Mode,
+		Symlink:     fileEntry.Symlink,
+		SealedKey:   fileEntry.SealedKey,
+		SealedTo:    fileEntry.SealedTo,
+		ContentKey:  fileEntry.ContentKey,
+		Codec:       fileEntry.Codec,
+		ContentHash: fileEntry.ContentHash,
+		Photo:       fileEntry.Photo,
+	})
+	if len(versions) > maxFileVersions {
+		versions = versions[len(versions)-maxFileVersions:]
+	}
+	return versions
+}
+
+// ListVersions returns the earlier versions of a file, oldest first
+func (s *Storage) ListVersions(name string, folderID FolderID) ([]FileVersion, error) {
+	_, fileEntry, err := s.findFile(name, folderID)
+	if err != nil {
+		return nil, err
+	}
+	return fileEntry.Versions, nil
+}
+
+// RestoreVersion makes an earlier version, by its index in ListVersions, the
+// current content of a file. The content it replaces becomes the newest
+// version, so a restore can itself be undone. The encrypted key changes, so
+// the old entry is returned for a DELETE update and the new one for an ADD.
+func (s *Storage) RestoreVersion(name string, folderID FolderID, index int) (removed, added *database.DataEntry, err error) {
+	current, fileEntry, err := s.findFile(name, folderID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if index < 0 || index >= len(fileEntry.Versions) {
+		return nil, nil, fmt.Errorf("version %d of %s %w", index, name, ErrNotFound)
+	}
+	version := fileEntry.Versions[index]
+	if !s.FileExists(version.BlobHash) {
+		return nil, nil, fmt.Errorf("version %d of %s is not stored on this node", index, name)
+	}
+
+	restored := *fileEntry
+	restored.ModifiedAt = version.ModifiedAt
+	restored.Mode = version.Mode
+	restored.Symlink = version.Symlink
+	restored.Size = version.Size
+	restored.SealedKey = version.SealedKey
+	restored.SealedTo = version.SealedTo
+	restored.ContentKey = version.ContentKey
+	restored.Codec = version.Codec
+	restored.ContentHash = version.ContentHash
+	restored.Photo = version.Photo
+	restored.Versions = pushVersion(slices.Delete(slices.Clone(fileEntry.Versions), index, index+1), *current, fileEntry)
+
+	// Insert before deleting so a crash leaves a duplicate rather than nothing
+	added, err = s.putFileEntry(restored, version.BlobHash, version.BlobSize, version.KeyEpoch)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := s.db.DeleteData(current.Key); err != nil {
+		return nil, nil, err
+	}
+	return current, added, nil
+}
@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Windows limits paths to MAX_PATH (260 characters) unless they are given in
+// the \\?\ form, and reserves device names such as CON and NUL in every
+// folder. Deep trees of family photos hit the first limit on export, and
+// vaults filled on other systems can hold names that are not valid files on
+// Windows. The helpers below leave paths and names alone elsewhere.
+
+// onWindows selects the Windows behavior of the helpers below, a variable so
+// tests can check it on any system
+var onWindows = runtime.GOOS == "windows"
+
+// longPath returns path in the \\?\ form on Windows, which lifts the MAX_PATH
+// limit. Windows doesn't clean such paths up, so path is made absolute and
+// clean first; a path that can't be is returned unchanged.
+func longPath(path string) string {
+	if !onWindows || path == "" || strings.HasPrefix(path, `\\?\`) {
+		return path
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	return longForm(abs)
+}
+
+// longForm returns a clean absolute Windows path in the \\?\ form
+func longForm(abs string) string {
+	if rest, ok := strings.CutPrefix(abs, `\\`); ok {
+		// \\server\share\dir becomes \\?\UNC\server\share\dir
+		return `\\?\UNC\` + rest
+	}
+	return `\\?\` + abs
+}
+
+// windowsReserved are the device names Windows reserves in every folder, also
+// when followed by an extension
+var windowsReserved = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"COM¹": true, "COM²": true, "COM³": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+	"LPT¹": true, "LPT²": true, "LPT³": true,
+}
+
+// windowsName escapes a name Windows can't give a file. Characters it forbids
+// become "_", a reserved device name gets a "_" after its base name, so
+// NUL.txt is written as NUL_.txt, and a trailing dot or space, which Windows
+// would drop, is kept by appending "_".
+func windowsName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || strings.ContainsRune(`<>:"|?*`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	if strings.HasSuffix(name, ".") || strings.HasSuffix(name, " ") {
+		name += "_"
+	}
+	base, ext := name, ""
+	if i := strings.IndexByte(name, '.'); i >= 0 {
+		base, ext = name[:i], name[i:]
+	}
+	if windowsReserved[strings.ToUpper(strings.TrimRight(base, " "))] {
+		name = base + "_" + ext
+	}
+	return name
+}
+
+// LocalName returns the name a file or folder called name gets on the local
+// file system: escaped with windowsName on Windows, unchanged elsewhere
+func LocalName(name string) string {
+	if !onWindows {
+		return name
+	}
+	return windowsName(name)
+}
+
+// exportName returns the local name for an entry exported to a directory that
+// already got the names in used, and adds it there. On Windows, whose file
+// systems ignore case, a name that would match an earlier one but for case
+// or escaping is numbered, as in "photo~2.jpg". Elsewhere name is returned
+// unchanged.
+func exportName(name string, used map[string]bool) string {
+	if !onWindows {
+		return name
+	}
+	safe := LocalName(name)
+	ext := filepath.Ext(safe)
+	base := strings.TrimSuffix(safe, ext)
+	candidate := safe
+	for i := 2; used[strings.ToLower(candidate)]; i++ {
+		candidate = fmt.Sprintf("%s~%d%s", base, i, ext)
+	}
+	used[strings.ToLower(candidate)] = true
+	return candidate
+}
@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+)
+
+// setWindows switches the Windows behavior of the path helpers on or off
+// for the rest of the test
+func setWindows(t *testing.T, on bool) {
+	t.Helper()
+	was := onWindows
+	onWindows = on
+	t.Cleanup(func() { onWindows = was })
+}
+
+func TestWindowsName(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"holiday.jpg", "holiday.jpg"},
+		{"CON", "CON_"},
+		{"NUL", "NUL_"},
+		{"COM1", "COM1_"},
+		{"COM¹", "COM¹_"},
+		{"lpt9.log", "lpt9_.log"},
+		{"con.txt", "con_.txt"},
+		{"NUL.tar.gz", "NUL_.tar.gz"},
+		{"con .txt", "con _.txt"},
+		{"CONSOLE.txt", "CONSOLE.txt"},
+		{"COM10", "COM10"},
+		{"notes.", "notes._"},
+		{"notes ", "notes _"},
+		{"CON.", "CON_._"},
+		{`a<b>:c"d|e?f*g`, "a_b__c_d_e_f_g"},
+		{"tab\there", "tab_here"},
+	}
+	for _, tt := range tests {
+		if got := windowsName(tt.name); got != tt.want {
+			t.Errorf("windowsName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+		// An escaped name is a valid one and is left alone
+		if again := windowsName(tt.want); again != tt.want {
+			t.Errorf("windowsName(%q) = %q, want it unchanged", tt.want, again)
+		}
+	}
+}
+
+func TestLocalName(t *testing.T) {
+	setWindows(t, false)
+	if got := LocalName("con.txt"); got != "con.txt" {
+		t.Errorf("LocalName off Windows = %q, want the name unchanged", got)
+	}
+
+	setWindows(t, true)
+	for _, name := range []string{"con.txt", "notes.", "a:b", "photo.jpg"} {
+		local := LocalName(name)
+		if local != windowsName(name) {
+			t.Errorf("LocalName(%q) = %q, want %q", name, local, windowsName(name))
+		}
+		if again := LocalName(local); again != local {
+			t.Errorf("LocalName(%q) = %q, want it unchanged", local, again)
+		}
+		if exported := exportName(name, map[string]bool{}); exported != local {
+			t.Errorf("exportName(%q) = %q, want its local name %q", name, exported, local)
+		}
+	}
+}
+
+func TestExportName(t *testing.T) {
+	setWindows(t, false)
+	used := map[string]bool{}
+	for _, name := range []string{"photo.jpg", "Photo.jpg"} {
+		if got := exportName(name, used); got != name {
+			t.Errorf("exportName(%q) off Windows = %q, want the name unchanged", name, got)
+		}
+	}
+
+	setWindows(t, true)
+	used = map[string]bool{}
+	tests := []struct {
+		name, want string
+	}{
+		{"photo.jpg", "photo.jpg"},
+		{"Photo.jpg", "Photo~2.jpg"},
+		{"PHOTO.JPG", "PHOTO~3.JPG"},
+		{"con.txt", "con_.txt"},
+		{"CON_.txt", "CON_~2.txt"}, // Matches the escaped name but for case
+		{"a:b", "a_b"},
+		{"a?b", "a_b~2"},
+	}
+	for _, tt := range tests {
+		if got := exportName(tt.name, used); got != tt.want {
+			t.Errorf("exportName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLongPath(t *testing.T) {
+	deep := `C:\Users\me\Pictures\` + strings.Repeat(`family\`, 40) + "photo.jpg"
+	if len(deep) <= 260 {
+		t.Fatalf("test path is only %d characters", len(deep))
+	}
+
+	setWindows(t, false)
+	if got := longPath(deep); got != deep {
+		t.Errorf("longPath off Windows = %q, want the path unchanged", got)
+	}
+
+	setWindows(t, true)
+	for _, path := range []string{"", `\\?\C:\already\long`, `\\?\UNC\server\share\dir`} {
+		if got := longPath(path); got != path {
+			t.Errorf("longPath(%q) = %q, want it unchanged", path, got)
+		}
+	}
+
+	tests := []struct {
+		abs, want string
+	}{
+		{deep, `\\?\` + deep},
+		{`C:\short.txt`, `\\?\C:\short.txt`},
+		{`\\server\share\photos\2024`, `\\?\UNC\server\share\photos\2024`},
+	}
+	for _, tt := range tests {
+		if got := longForm(tt.abs); got != tt.want {
+			t.Errorf("longForm(%q) = %q, want %q", tt.abs, got, tt.want)
+		}
+	}
+}
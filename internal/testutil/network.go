@@ -0,0 +1,218 @@
+package testutil
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	lcrypto "github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/p2p/discovery/mocks"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/notassigned/endershare/internal/core"
+	"github.com/notassigned/endershare/internal/crypto"
+	"github.com/notassigned/endershare/internal/database"
+	"github.com/notassigned/endershare/internal/p2p"
+)
+
+// bindTimeout bounds how long Bind waits for the replica to receive the
+// vault details after the master finished its side
+const bindTimeout = time.Minute
+
+// Node is an endershare node running inside a Network
+type Node struct {
+	Name string
+	Dir  string // Holds the database and, for nodes with the vault key, the blobs
+	DB   *database.EndershareDB
+	Keys *crypto.CryptoKeys
+	P2P  *p2p.P2PNode
+	Core *core.Core
+
+	cancel context.CancelFunc // Stops the background work of Core
+}
+
+// Network runs endershare nodes in one process over libp2p's in-memory
+// network. Every pair of nodes is linked, and the rendezvous used for binding
+// goes through a shared in-memory discovery server instead of the DHT.
+type Network struct {
+	dir   string
+	mn    mocknet.Mocknet
+	disc  *mocks.MockDiscoveryServer
+	mu    sync.Mutex
+	nodes []*Node
+}
+
+// realClock lets the discovery server expire advertisements in real time
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+// NewNetwork creates an empty network keeping node state below dir
+func NewNetwork(dir string) *Network {
+	return &Network{
+		dir:  dir,
+		mn:   mocknet.New(),
+		disc: mocks.NewDiscoveryServer(realClock{}),
+	}
+}
+
+// NewMaster adds a node holding a new vault's keys
+func (n *Network) NewMaster(name string) (*Node, error) {
+	keys, _ := crypto.CreateCryptoKeys()
+	return n.addNode(name, keys)
+}
+
+// NewReplica adds a node with peer keys only, ready to be bound
+func (n *Network) NewReplica(name string) (*Node, error) {
+	return n.addNode(name, crypto.CreatePeerOnlyKeys())
+}
+
+func (n *Network) addNode(name string, keys *crypto.CryptoKeys) (*Node, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	dir := filepath.Join(n.dir, name)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	db := database.Open(filepath.Join(dir, "endershare.db"))
+	db.StoreKeys(keys)
+
+	lpriv, err := lcrypto.UnmarshalEd25519PrivateKey(keys.PeerPrivateKey)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	// Private addresses, so the filters applied to addresses from other
+	// nodes keep them
+	addr, err := multiaddr.NewMultiaddr(fmt.Sprintf("/ip4/10.77.0.%d/tcp/4242", len(n.nodes)+1))
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	h, err := n.mn.AddPeer(lpriv, addr)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := n.mn.LinkAll(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	node := &Node{
+		Name: name,
+		Dir:  dir,
+		DB:   db,
+		Keys: keys,
+		P2P:  p2p.NewP2PNodeWithHost(h, db.GetPeers(), mocks.NewDiscoveryClient(h, n.disc)),
+	}
+	if err := node.startCore(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	n.nodes = append(n.nodes, node)
+	return node, nil
+}
+
+// startCore runs a new core on the node's current keys, replacing the
+// previous one the way an app restarts its core once a vault is unlocked
+func (node *Node) startCore() error {
+	if node.cancel != nil {
+		node.cancel()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c, err := core.NewEmbeddedCore(ctx, core.EmbeddedNode{
+		DB:      node.DB,
+		Keys:    node.Keys,
+		P2PNode: node.P2P,
+		DataDir: filepath.Join(node.Dir, "data"),
+	})
+	if err != nil {
+		cancel()
+		return err
+	}
+	node.Core = c
+	node.cancel = cancel
+	return nil
+}
+
+// Bind runs the binding protocol between a master and an unbound replica:
+// the replica shows a sync phrase, the master enters it and sends the vault
+// details, and the replica stores them as the app does. With withVaultKey the
+// replica is then given the vault's encryption key, as unlocking it would, so
+// it stores and can read file contents. Either way its core is restarted
+// with the new keys.
+func (n *Network) Bind(master, replica *Node, withVaultKey bool) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	bound := make(chan *p2p.ClientInfo, 1)
+	phrase, err := replica.Core.StartBinding(ctx, func(info *p2p.ClientInfo, err error) {
+		bound <- info
+	})
+	if err != nil {
+		return fmt.Errorf("replica failed to start binding: %w", err)
+	}
+	if err := master.Core.BindNewPeer(phrase); err != nil {
+		return fmt.Errorf("master failed to bind %s: %w", replica.Name, err)
+	}
+
+	var info *p2p.ClientInfo
+	select {
+	case info = <-bound:
+	case <-time.After(bindTimeout):
+	}
+	if info == nil {
+		return fmt.Errorf("%s did not receive the vault details", replica.Name)
+	}
+
+	if err := replica.Core.StoreBinding(info); err != nil {
+		return fmt.Errorf("%s failed to store the vault details: %w", replica.Name, err)
+	}
+	if withVaultKey {
+		replica.Keys.AESKey = master.Keys.AESKey
+		replica.DB.StoreKeys(replica.Keys)
+	}
+
+	return replica.startCore()
+}
+
+// Close stops every node and the in-memory network
+func (n *Network) Close() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, node := range n.nodes {
+		if node.cancel != nil {
+			node.cancel()
+		}
+	}
+	n.mn.Close()
+	for _, node := range n.nodes {
+		node.DB.Close()
+	}
+	n.nodes = nil
+}
+
+// WaitFor polls cond until it holds or timeout passes
+func WaitFor(timeout time.Duration, cond func() bool) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		if cond() {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// HasPeer reports whether a node's peer table lists another node
+func (node *Node) HasPeer(other *Node) bool {
+	_, ok := node.DB.GetPeerAddresses(other.P2P.GetPeerId().String())
+	return ok
+}
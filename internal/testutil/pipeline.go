@@ -0,0 +1,100 @@
+package testutil
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/notassigned/endershare/internal/storage"
+)
+
+// pipelineFileSize is the size of the file replicated by RunPipeline, large
+// enough to take several transfer chunks
+const pipelineFileSize = 3<<20 + 1234
+
+// RunPipeline runs a master and a replica in one process and walks them
+// through pairing: bind, peer list exchange, the first data update and
+// replication of a file. It returns an error naming the first stage that did
+// not complete within timeout. Node state is kept below dir.
+func RunPipeline(dir string, timeout time.Duration) error {
+	n := NewNetwork(dir)
+	defer n.Close()
+
+	master, err := n.NewMaster("master")
+	if err != nil {
+		return fmt.Errorf("starting master: %w", err)
+	}
+	replica, err := n.NewReplica("replica")
+	if err != nil {
+		return fmt.Errorf("starting replica: %w", err)
+	}
+
+	// Bind
+	if err := n.Bind(master, replica, true); err != nil {
+		return fmt.Errorf("bind: %w", err)
+	}
+	if !master.HasPeer(replica) || !replica.HasPeer(master) {
+		return fmt.Errorf("bind: nodes did not add each other as peers")
+	}
+
+	// Peer list exchange: the master publishes the new peer, and the replica
+	// ends up with the same peer list
+	if !WaitFor(timeout, func() bool { return samePeerList(master, replica) }) {
+		return fmt.Errorf("peer list exchange: replica has %d peers, master %d",
+			len(replica.DB.GetAllPeerIDs()), len(master.DB.GetAllPeerIDs()))
+	}
+
+	// First data update
+	content := make([]byte, pipelineFileSize)
+	rand.Read(content)
+	_, entry, err := master.Core.Storage().AddFileFromReader(bytes.NewReader(content), "pipeline.bin", storage.RootFolderID)
+	if err != nil {
+		return fmt.Errorf("first update: adding file: %w", err)
+	}
+	if err := master.Core.PublishDataUpdate("ADD", entry.Key, entry.Value, entry.Size, entry.Hash, nil); err != nil {
+		return fmt.Errorf("first update: publishing: %w", err)
+	}
+	if !WaitFor(timeout, func() bool { return sameUpdate(master, replica) }) {
+		return fmt.Errorf("first update: replica did not reach the master's update and data hash")
+	}
+
+	// File replication
+	if !WaitFor(timeout, func() bool { return replica.DB.GetDownloadProgress(entry.Value) == entry.Size }) {
+		return fmt.Errorf("file replication: replica has %d of %d bytes",
+			replica.DB.GetDownloadProgress(entry.Value), entry.Size)
+	}
+	out := filepath.Join(replica.Dir, "pipeline.out")
+	if err := replica.Core.Storage().GetFile("pipeline.bin", storage.RootFolderID, out); err != nil {
+		return fmt.Errorf("file replication: reading replicated file: %w", err)
+	}
+	got, err := os.ReadFile(out)
+	if err != nil {
+		return fmt.Errorf("file replication: %w", err)
+	}
+	if !bytes.Equal(got, content) {
+		return fmt.Errorf("file replication: replicated file differs from the original")
+	}
+	return nil
+}
+
+// samePeerList reports whether two nodes agree on the peer list hash
+func samePeerList(a, b *Node) bool {
+	hashA, errA := a.DB.GetPeerListHash()
+	hashB, errB := b.DB.GetPeerListHash()
+	return errA == nil && errB == nil && bytes.Equal(hashA, hashB)
+}
+
+// sameUpdate reports whether two nodes are at the same update and data hash
+func sameUpdate(a, b *Node) bool {
+	idA, errA := a.DB.GetCurrentUpdateID()
+	idB, errB := b.DB.GetCurrentUpdateID()
+	if errA != nil || errB != nil || idA != idB {
+		return false
+	}
+	hashA, errA := a.DB.GetDataRootHash()
+	hashB, errB := b.DB.GetDataRootHash()
+	return errA == nil && errB == nil && bytes.Equal(hashA, hashB)
+}
@@ -0,0 +1,267 @@
+package testutil
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/notassigned/endershare/internal/core"
+	"github.com/notassigned/endershare/internal/database"
+	"github.com/notassigned/endershare/internal/storage"
+)
+
+func TestPipeline(t *testing.T) {
+	if err := RunPipeline(t.TempDir(), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// boundPair starts a master and a replica holding the vault key and binds them
+func boundPair(t *testing.T) (master, replica *Node) {
+	t.Helper()
+	n := NewNetwork(t.TempDir())
+	t.Cleanup(n.Close)
+	master, err := n.NewMaster("master")
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica, err = n.NewReplica("replica")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Bind(master, replica, true); err != nil {
+		t.Fatal(err)
+	}
+	if !WaitFor(time.Minute, func() bool { return samePeerList(master, replica) }) {
+		t.Fatal("replica did not receive the peer list")
+	}
+	return master, replica
+}
+
+// addFile adds a file to the root folder of the master and publishes it
+func addFile(t *testing.T, master *Node, name string) error {
+	t.Helper()
+	_, entry, err := master.Core.Storage().AddFileFromReader(strings.NewReader(name), name, storage.RootFolderID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return master.Core.PublishDataUpdate("ADD", entry.Key, entry.Value, entry.Size, entry.Hash, nil)
+}
+
+// corruptAndRestart stops a node, overwrites its database so the next open
+// restores the backup, and starts it again
+func corruptAndRestart(t *testing.T, node *Node) {
+	t.Helper()
+	node.cancel()
+	node.DB.Close()
+	path := filepath.Join(node.Dir, "endershare.db")
+	if err := os.WriteFile(path, []byte(strings.Repeat("not a database ", 512)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	node.DB = database.Open(path)
+	if err := node.startCore(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// A master restored from a stale backup must not reuse update IDs its peers
+// have already applied
+func TestRestoredMasterCatchesUp(t *testing.T) {
+	master, replica := boundPair(t)
+	if err := master.DB.Backup(); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"one.txt", "two.txt"} {
+		if err := addFile(t, master, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !WaitFor(time.Minute, func() bool { return sameUpdate(master, replica) }) {
+		t.Fatal("replica did not reach the master's update")
+	}
+	replicaID, _ := replica.DB.GetCurrentUpdateID()
+
+	corruptAndRestart(t, master)
+	if id, _ := master.DB.GetCurrentUpdateID(); id >= replicaID {
+		t.Fatalf("restored master is at update %d, want a backup older than %d", id, replicaID)
+	}
+	if err := addFile(t, master, "early.txt"); !errors.Is(err, core.ErrNotSynced) {
+		t.Fatalf("publishing before catching up = %v, want %v", err, core.ErrNotSynced)
+	}
+
+	if !WaitFor(time.Minute, func() bool { return !master.DB.GetUnsynced() }) {
+		t.Fatal("restored master did not catch up")
+	}
+	if err := addFile(t, master, "three.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if id, _ := master.DB.GetCurrentUpdateID(); id != replicaID+1 {
+		t.Errorf("next update published as %d, want %d", id, replicaID+1)
+	}
+	if !WaitFor(time.Minute, func() bool { return sameUpdate(master, replica) }) {
+		t.Error("replica did not apply the update published after catching up")
+	}
+}
+
+// Releases travel as vault entries and are only staged when newer than the
+// running version
+func TestReleaseStagedFromVault(t *testing.T) {
+	running := core.Version
+	core.Version = "1.2.0"
+	t.Cleanup(func() { core.Version = running })
+
+	master, replica := boundPair(t)
+	replica.DB.SetReleaseChannelEnabled(true)
+	binary := filepath.Join(master.Dir, "endershare-build")
+	if err := os.WriteFile(binary, []byte(strings.Repeat("release binary ", 1000)), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := master.Core.PublishRelease(binary, "not-a-version", "", "", ""); err == nil {
+		t.Error("release with an invalid version was published")
+	}
+	if _, err := master.Core.PublishRelease(binary, "1.1.0", "", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := master.Core.PublishRelease(binary, "1.10.0", "", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if !WaitFor(time.Minute, func() bool { return replica.Core.GetStagedRelease() != nil }) {
+		t.Fatal("replica did not stage the release")
+	}
+	if staged := replica.Core.GetStagedRelease(); staged.Version != "1.10.0" {
+		t.Errorf("replica staged %s, want 1.10.0", staged.Version)
+	}
+	if entries, err := master.Core.Storage().ListFolder(storage.RootFolderID); err != nil || len(entries) != 0 {
+		t.Errorf("root lists %d entries, %v; want the release folder hidden", len(entries), err)
+	}
+}
+
+// The master's trash purge publishes a DELETE for each expired entry and
+// leaves the rest of the trash on the replicas
+func TestTrashPurgeReplicated(t *testing.T) {
+	master, replica := boundPair(t)
+	trash := func(name string) {
+		t.Helper()
+		if err := addFile(t, master, name); err != nil {
+			t.Fatal(err)
+		}
+		removed, added, err := master.Core.Storage().TrashFile(name, storage.RootFolderID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := master.Core.PublishModifyUpdate(removed, added, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	trash("old.txt")
+	// Retention is kept in whole seconds
+	time.Sleep(2 * time.Second)
+	trash("new.txt")
+	if !WaitFor(time.Minute, func() bool { return sameUpdate(master, replica) }) {
+		t.Fatal("replica did not apply the trash updates")
+	}
+
+	// A new core purges right away
+	if err := master.DB.SetTrashRetention(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err := master.startCore(); err != nil {
+		t.Fatal(err)
+	}
+	trashNames := func(node *Node) string {
+		items, err := node.Core.Storage().ListTrash()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, item := range items {
+			names = append(names, item.Name)
+		}
+		return strings.Join(names, ",")
+	}
+	if !WaitFor(time.Minute, func() bool { return trashNames(master) == "new.txt" }) {
+		t.Fatalf("master trash holds %s after the purge, want new.txt", trashNames(master))
+	}
+	if !WaitFor(time.Minute, func() bool { return sameUpdate(master, replica) }) {
+		t.Fatal("replica did not apply the purge")
+	}
+	if got := trashNames(replica); got != "new.txt" {
+		t.Errorf("replica trash holds %s, want new.txt", got)
+	}
+}
+
+// A folder move reaches replicas as one batch, so their index never holds the
+// folder in both places or in neither, and a move that would put a folder
+// inside itself is refused
+func TestSubtreeMoveReplicated(t *testing.T) {
+	master, replica := boundPair(t)
+	stor := master.Core.Storage()
+	var added []*database.DataEntry
+	folder := func(name string, parent storage.FolderID) storage.FolderID {
+		t.Helper()
+		id, entry, err := stor.CreateFolderWithEntry(name, parent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		added = append(added, entry)
+		return id
+	}
+	moved := folder("moved", storage.RootFolderID)
+	below := folder("below", moved)
+	dest := folder("dest", storage.RootFolderID)
+	_, entry, err := stor.AddFileFromReader(strings.NewReader("content"), "note.txt", below)
+	if err != nil {
+		t.Fatal(err)
+	}
+	added = append(added, entry)
+	if err := master.Core.PublishBatchUpdate(added, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !WaitFor(time.Minute, func() bool { return sameUpdate(master, replica) }) {
+		t.Fatal("replica did not apply the new folders")
+	}
+
+	var mu sync.Mutex
+	var changes []database.DataChange
+	replica.DB.WatchData(func(change database.DataChange) {
+		mu.Lock()
+		changes = append(changes, change)
+		mu.Unlock()
+	})
+	for _, dst := range []storage.FolderID{moved, below} {
+		if _, err := stor.MoveFolder(moved, dst); !errors.Is(err, storage.ErrInvalidName) {
+			t.Errorf("moving a folder into %s = %v, want %v", dst, err, storage.ErrInvalidName)
+		}
+	}
+	change, err := stor.MoveFolder(moved, dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := master.Core.PublishSubtreeUpdate(change, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !WaitFor(time.Minute, func() bool { return sameUpdate(master, replica) }) {
+		t.Fatal("replica did not apply the move")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(changes) != 1 || len(changes[0].Batch) != 2 {
+		t.Errorf("replica wrote the move as %d changes, want one batch replacing the folder entry", len(changes))
+	}
+	results, err := replica.Core.Storage().Search("note.txt", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Path != "/dest/moved/below/note.txt" {
+		t.Errorf("replica finds %v, want the file below the moved folder", results)
+	}
+	if entries, err := replica.Core.Storage().ListFolder(storage.RootFolderID); err != nil || len(entries) != 1 {
+		t.Errorf("replica root lists %d entries, %v; want dest only", len(entries), err)
+	}
+}
@@ -0,0 +1,27 @@
+package endershare
+
+import (
+	"context"
+	"io"
+
+	"github.com/notassigned/endershare/internal/storage"
+)
+
+// BlobStore keeps encrypted blobs outside the node's directory, in an object
+// store for instance, as the cold storage tier Vault.Offload moves file
+// contents to. Blobs are named by their hash and encrypted with the vault
+// key before they get there, so a BlobStore never sees plaintext or file
+// names. Reading an offloaded file fetches its blob back and checks it.
+type BlobStore interface {
+	// Put stores size bytes of r as the object name
+	Put(ctx context.Context, name string, r io.ReaderAt, size int64) error
+	// Get opens the object name for reading
+	Get(ctx context.Context, name string) (io.ReadCloser, error)
+	// Stat returns the size of the object name
+	Stat(ctx context.Context, name string) (int64, error)
+	// Delete removes the object name, if there is one
+	Delete(ctx context.Context, name string) error
+}
+
+// A BlobStore is handed to storage as is
+var _ storage.ColdStore = BlobStore(nil)
@@ -0,0 +1,162 @@
+// Package endershare embeds an endershare vault in a Go program. A Node runs
+// the same core, storage and sync as the endershare CLI and app on a
+// directory of its own, without either of them: a program creates or opens a
+// vault there, reads and changes it through Vault and follows sync through
+// Syncer. Changes are published to the vault's other devices as they are made.
+package endershare
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/notassigned/endershare/internal/core"
+	"github.com/notassigned/endershare/internal/crypto"
+	"github.com/notassigned/endershare/internal/database"
+	"github.com/notassigned/endershare/internal/storage"
+)
+
+var (
+	// ErrNoVault is returned by Open when the directory holds no vault
+	ErrNoVault = errors.New("no vault in this directory")
+	// ErrVaultExists is returned by Create when the directory holds a vault already
+	ErrVaultExists = errors.New("this directory holds a vault already")
+	// ErrLocked is returned by Node.Vault on nodes without the vault key
+	ErrLocked = errors.New("this node does not hold the vault key")
+	// ErrNotMaster is returned by changes made on a replica
+	ErrNotMaster = core.ErrNotMaster
+	// ErrNotFound is returned for files and folders that don't exist
+	ErrNotFound = storage.ErrNotFound
+	// ErrFileLocked is returned for locks another device holds
+	ErrFileLocked = storage.ErrFileLocked
+)
+
+// dbName is the database file in Options.Dir, the name the CLI uses too
+const dbName = "endershare.db"
+
+// Options configure a Node
+type Options struct {
+	// Dir holds the node's database and, unless a data directory was set on
+	// it, its blobs in Dir/data. It is created if needed.
+	Dir string
+	// Port the node listens on, 0 for any free port
+	Port int
+	// BlobStore, if set, is the cold storage tier blobs are offloaded to,
+	// replacing any configured in the database
+	BlobStore BlobStore
+}
+
+// Node is a running vault node. It is safe for concurrent use.
+type Node struct {
+	db     *database.EndershareDB
+	core   *core.Core
+	cancel context.CancelFunc
+}
+
+// Create starts a node holding a new vault in opts.Dir and returns it with
+// the vault's recovery phrase. The node is the vault's master.
+func Create(opts Options) (*Node, string, error) {
+	db, err := openDB(opts.Dir)
+	if err != nil {
+		return nil, "", err
+	}
+	if db.GetKeys() != nil {
+		db.Close()
+		return nil, "", fmt.Errorf("%w: %s", ErrVaultExists, opts.Dir)
+	}
+	keys, mnemonic := crypto.CreateCryptoKeys()
+	db.StoreKeys(keys)
+	n, err := start(db, keys, opts)
+	if err != nil {
+		return nil, "", err
+	}
+	return n, mnemonic, nil
+}
+
+// Open starts the node of the vault in opts.Dir, failing with ErrNoVault if
+// there is none or it is a replica that was never bound
+func Open(opts Options) (*Node, error) {
+	db, err := openDB(opts.Dir)
+	if err != nil {
+		return nil, err
+	}
+	keys := db.GetKeys()
+	if keys == nil || keys.MasterPublicKey == nil {
+		db.Close()
+		return nil, fmt.Errorf("%w: %s", ErrNoVault, opts.Dir)
+	}
+	return start(db, keys, opts)
+}
+
+// openDB opens the database in dir, creating both if needed
+func openDB(dir string) (*database.EndershareDB, error) {
+	if dir == "" {
+		return nil, errors.New("no directory given for the node")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return database.Open(filepath.Join(dir, dbName)), nil
+}
+
+// start runs a core on db, closing db if that fails
+func start(db *database.EndershareDB, keys *crypto.CryptoKeys, opts Options) (*Node, error) {
+	dataDir := db.GetDataDir()
+	if dataDir == "" {
+		dataDir = filepath.Join(opts.Dir, storage.DefaultDataDir)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c, err := core.NewEmbeddedCore(ctx, core.EmbeddedNode{
+		DB:      db,
+		Keys:    keys,
+		Port:    opts.Port,
+		DataDir: dataDir,
+	})
+	if err != nil {
+		cancel()
+		db.Close()
+		return nil, err
+	}
+	if opts.BlobStore != nil && c.Storage() != nil {
+		c.Storage().SetColdStore(opts.BlobStore)
+	}
+	return &Node{db: db, core: c, cancel: cancel}, nil
+}
+
+// ID returns the node's peer ID
+func (n *Node) ID() string {
+	return n.core.GetNodeID()
+}
+
+// IsMaster reports whether the node is the vault's master, the only node
+// that can change it
+func (n *Node) IsMaster() bool {
+	return n.core.IsMaster()
+}
+
+// Vault returns the node's files and folders, failing with ErrLocked on a
+// node that only stores the encrypted vault
+func (n *Node) Vault() (Vault, error) {
+	if n.core.Storage() == nil {
+		return nil, ErrLocked
+	}
+	return &vault{core: n.core, stor: n.core.Storage()}, nil
+}
+
+// Syncer returns the node's sync with the vault's other devices
+func (n *Node) Syncer() Syncer {
+	return &syncer{core: n.core}
+}
+
+// Close stops the node and closes its database. The node can't be used after.
+func (n *Node) Close() error {
+	n.cancel()
+	n.core.SavePeerstore()
+	err := n.core.Close()
+	if cerr := n.db.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,154 @@
+package endershare
+
+import (
+	"context"
+	"time"
+
+	"github.com/notassigned/endershare/internal/core"
+)
+
+// Status summarizes what a node holds and how current it is
+type Status struct {
+	Master      bool
+	HasVaultKey bool
+
+	// Entries of the vault's metadata held by the node
+	Entries int64
+
+	// File contents stored on this node out of those the vault references
+	FilesStored     int64
+	FilesTotal      int64
+	BytesStored     int64
+	BytesReferenced int64
+
+	// Latest update applied, from the master or published here
+	LastUpdateID   uint64
+	LastUpdateTime time.Time
+}
+
+// Peer is another device of the vault
+type Peer struct {
+	ID       string
+	Online   bool
+	LastSeen time.Time
+	Path     string // How it is reached: "lan", "direct", "relay" or "" when offline
+}
+
+// SyncRound is one recent reconciliation with a peer
+type SyncRound struct {
+	UpdateID        uint64
+	Peer            string
+	Mode            string // "fast-forward", "diff" or "rebuild"
+	Started         time.Time
+	Duration        time.Duration
+	EntriesFetched  int
+	EntriesDeleted  int
+	FilesDownloaded int
+	Err             string // Why the round failed, empty if it didn't
+}
+
+// EventType identifies what happened in an Event
+type EventType string
+
+// Event types delivered by Syncer.Subscribe
+const (
+	EntryAdded       EventType = EventType(core.EventEntryAdded)       // Entry stored locally or synced from a peer
+	EntryRemoved     EventType = EventType(core.EventEntryRemoved)     // Entry removed locally or synced from a peer
+	UpdateApplied    EventType = EventType(core.EventUpdateApplied)    // Update published or applied
+	PeerJoined       EventType = EventType(core.EventPeerJoined)       // Device added to the vault
+	PeerLeft         EventType = EventType(core.EventPeerLeft)         // Device removed from the vault
+	DownloadFinished EventType = EventType(core.EventDownloadFinished) // File content downloaded and verified
+)
+
+// Event is delivered to Syncer.Subscribe handlers
+type Event struct {
+	Type     EventType
+	Time     time.Time
+	UpdateID uint64 // UpdateApplied
+	PeerID   string // Peer events, and the peer a download came from
+}
+
+// Syncer follows and drives a node's sync with the vault's other devices.
+// Sync runs in the background as long as the node does.
+type Syncer interface {
+	// SyncNow asks the peers for the latest update instead of waiting for
+	// the next poll
+	SyncNow()
+	// Status returns what the node holds and how current it is
+	Status() Status
+	// Peers returns the vault's other devices
+	Peers() []Peer
+	// Rounds returns the recent reconciliation rounds, oldest first
+	Rounds() []SyncRound
+	// Bind adds the device showing phrase to the vault (master only)
+	Bind(ctx context.Context, phrase string) error
+	// Subscribe calls handler for every event, one at a time on a goroutine
+	// of its own. The returned function cancels the subscription.
+	Subscribe(handler func(Event)) (cancel func())
+}
+
+// syncer is the Syncer of a running node
+type syncer struct {
+	core *core.Core
+}
+
+func (s *syncer) SyncNow() {
+	s.core.RequestLatestUpdate()
+}
+
+func (s *syncer) Status() Status {
+	st := s.core.Status()
+	return Status{
+		Master:          s.core.IsMaster(),
+		HasVaultKey:     s.core.Storage() != nil,
+		Entries:         st.Entries,
+		FilesStored:     st.FilesComplete,
+		FilesTotal:      st.FilesTotal,
+		BytesStored:     st.BytesStored,
+		BytesReferenced: st.BytesReferenced,
+		LastUpdateID:    st.LastUpdateID,
+		LastUpdateTime:  st.LastUpdateTime,
+	}
+}
+
+func (s *syncer) Peers() []Peer {
+	var peers []Peer
+	for _, id := range s.core.GetOtherPeerIDs() {
+		online, lastSeen := s.core.GetPeerStatus(id)
+		peers = append(peers, Peer{ID: id, Online: online, LastSeen: lastSeen, Path: s.core.GetPeerPath(id)})
+	}
+	return peers
+}
+
+func (s *syncer) Rounds() []SyncRound {
+	var rounds []SyncRound
+	for _, r := range s.core.GetSyncRounds() {
+		rounds = append(rounds, SyncRound{
+			UpdateID:        r.UpdateID,
+			Peer:            r.Peer,
+			Mode:            r.Mode,
+			Started:         r.Started,
+			Duration:        r.Duration,
+			EntriesFetched:  r.EntriesFetched,
+			EntriesDeleted:  r.EntriesDeleted,
+			FilesDownloaded: r.FilesDownloaded,
+			Err:             r.Error,
+		})
+	}
+	return rounds
+}
+
+func (s *syncer) Bind(ctx context.Context, phrase string) error {
+	return s.core.BindNewPeerWithProgress(ctx, phrase, nil)
+}
+
+func (s *syncer) Subscribe(handler func(Event)) (cancel func()) {
+	return s.core.Subscribe(func(e core.Event) {
+		event := Event{Type: EventType(e.Type), Time: e.Time, PeerID: e.PeerID}
+		if e.Update != nil {
+			event.UpdateID = e.Update.UpdateID
+		}
+		handler(event)
+	}, core.EventEntryAdded, core.EventEntryRemoved, core.EventUpdateApplied,
+		core.EventPeerJoined, core.EventPeerLeft, core.EventDownloadFinished)
+}
@@ -0,0 +1,167 @@
+package endershare
+
+import (
+	"io"
+	"time"
+
+	"github.com/notassigned/endershare/internal/core"
+	"github.com/notassigned/endershare/internal/storage"
+)
+
+// FolderID identifies a folder of the vault. Folders keep their ID when they
+// are renamed or moved.
+type FolderID string
+
+// Root is the top folder of the vault
+const Root FolderID = FolderID(storage.RootFolderID)
+
+// Entry is a file or folder in the vault
+type Entry struct {
+	Name   string
+	Folder bool
+	ID     FolderID // Folders only
+	Parent FolderID
+
+	// Files only
+	Size       int64     // Plaintext bytes
+	ModifiedAt time.Time // Of the local file it was added from
+	Local      bool      // Content stored on this node rather than fetched on first read
+	LockedBy   string    // Device a checked out file is being edited on, "" if it isn't
+}
+
+// Vault reads and changes the files and folders of a vault. Files are named
+// within their folder. Changes are refused with ErrNotMaster on replicas and
+// published to the vault's other devices once stored.
+type Vault interface {
+	// List returns the files and folders in folder
+	List(folder FolderID) ([]Entry, error)
+	// Lookup returns the folder at a slash-separated path such as "photos/2024"
+	Lookup(path string) (FolderID, error)
+	// Stat returns the file called name in folder
+	Stat(name string, folder FolderID) (Entry, error)
+	// Open streams the content of a file, fetching it from a peer or the
+	// BlobStore first if it isn't stored on this node
+	Open(name string, folder FolderID) (io.ReadCloser, error)
+
+	// Add stores the content of r as the file name in folder. Adding a name
+	// that exists keeps the earlier content as a version of the file.
+	Add(r io.Reader, name string, folder FolderID) error
+	// CreateFolder creates a folder called name in parent and returns its ID
+	CreateFolder(name string, parent FolderID) (FolderID, error)
+	// Rename gives a file a new name in its folder
+	Rename(name string, folder FolderID, newName string) error
+	// Remove moves a file to the trash
+	Remove(name string, folder FolderID) error
+	// RemoveFolder moves a folder and everything in it to the trash
+	RemoveFolder(folder FolderID) error
+
+	// Lock checks a file out on this device so the others see it is being
+	// edited. Locks are advisory, only locking a file another device holds
+	// is refused, with ErrFileLocked.
+	Lock(name string, folder FolderID) error
+	// Unlock releases this device's lock on a file, or with force any lock
+	Unlock(name string, folder FolderID, force bool) error
+
+	// Offload moves the content of the files below folder to the BlobStore
+	// to free the node's disk, and returns how many blobs were offloaded and
+	// the bytes freed. Pinned files are left alone.
+	Offload(folder FolderID) (int, int64, error)
+}
+
+// vault is the Vault of a node holding the vault key
+type vault struct {
+	core *core.Core
+	stor *storage.Storage
+}
+
+func (v *vault) List(folder FolderID) ([]Entry, error) {
+	items, err := v.stor.ListFolder(storage.FolderID(folder))
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]Entry, 0, len(items))
+	for _, item := range items {
+		switch e := item.(type) {
+		case storage.FileEntry:
+			entries = append(entries, v.fileEntry(&e))
+		case storage.FolderEntry:
+			entries = append(entries, Entry{
+				Name:   e.Name,
+				Folder: true,
+				ID:     FolderID(e.FolderID),
+				Parent: FolderID(e.ParentFolderID),
+			})
+		}
+	}
+	return entries, nil
+}
+
+// fileEntry converts a file's metadata
+func (v *vault) fileEntry(f *storage.FileEntry) Entry {
+	return Entry{
+		Name:       f.Name,
+		Parent:     FolderID(f.FolderID),
+		Size:       f.Size,
+		ModifiedAt: f.ModifiedAt,
+		Local:      v.stor.IsLocal(f.Name, f.FolderID),
+		LockedBy:   lockedBy(f.Lock),
+	}
+}
+
+// lockedBy names the device holding a lock, "" for none
+func lockedBy(l *storage.FileLock) string {
+	if l == nil {
+		return ""
+	}
+	return l.Who()
+}
+
+func (v *vault) Lookup(path string) (FolderID, error) {
+	id, err := v.core.ResolveFolder(path)
+	return FolderID(id), err
+}
+
+func (v *vault) Stat(name string, folder FolderID) (Entry, error) {
+	f, err := v.stor.StatFile(name, storage.FolderID(folder))
+	if err != nil {
+		return Entry{}, err
+	}
+	return v.fileEntry(f), nil
+}
+
+func (v *vault) Open(name string, folder FolderID) (io.ReadCloser, error) {
+	return v.stor.OpenFileReader(name, storage.FolderID(folder))
+}
+
+func (v *vault) Add(r io.Reader, name string, folder FolderID) error {
+	return v.core.AddFile(r, name, storage.FolderID(folder), nil)
+}
+
+func (v *vault) CreateFolder(name string, parent FolderID) (FolderID, error) {
+	id, err := v.core.CreateFolder(name, storage.FolderID(parent), nil)
+	return FolderID(id), err
+}
+
+func (v *vault) Rename(name string, folder FolderID, newName string) error {
+	return v.core.RenameFile(name, storage.FolderID(folder), newName, nil)
+}
+
+func (v *vault) Remove(name string, folder FolderID) error {
+	return v.core.TrashFile(name, storage.FolderID(folder), nil)
+}
+
+func (v *vault) RemoveFolder(folder FolderID) error {
+	return v.core.TrashFolder(storage.FolderID(folder), nil)
+}
+
+func (v *vault) Lock(name string, folder FolderID) error {
+	return v.core.LockFile(name, storage.FolderID(folder), nil)
+}
+
+func (v *vault) Unlock(name string, folder FolderID, force bool) error {
+	return v.core.UnlockFile(name, storage.FolderID(folder), force, nil)
+}
+
+func (v *vault) Offload(folder FolderID) (int, int64, error) {
+	return v.stor.OffloadFolder(storage.FolderID(folder))
+}